@@ -0,0 +1,205 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mynewt.apache.org/newt/newt/image"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/util"
+)
+
+// If set, specifies the timestamp, in seconds since the Unix epoch, recorded
+// for each file in an artifact archive.  Otherwise, the epoch itself is used.
+const SOURCE_DATE_EPOCH_ENV = "SOURCE_DATE_EPOCH"
+
+// A file to be stored in an artifact archive.  Name is the file's path within
+// the archive.
+type ArchiveEntry struct {
+	Name string
+	Path string
+}
+
+type archiveEntrySorter struct {
+	entries []ArchiveEntry
+}
+
+func (s archiveEntrySorter) Len() int {
+	return len(s.entries)
+}
+func (s archiveEntrySorter) Swap(i, j int) {
+	s.entries[i], s.entries[j] = s.entries[j], s.entries[i]
+}
+func (s archiveEntrySorter) Less(i, j int) bool {
+	return s.entries[i].Name < s.entries[j].Name
+}
+
+// Determines the timestamp recorded in artifact archives.
+func ArchiveTime() (time.Time, error) {
+	epochStr := os.Getenv(SOURCE_DATE_EPOCH_ENV)
+	if epochStr == "" {
+		return time.Unix(0, 0), nil
+	}
+
+	epoch, err := strconv.ParseInt(epochStr, 10, 64)
+	if err != nil || epoch < 0 {
+		return time.Time{}, util.FmtNewtError(
+			"Invalid $%s: %s", SOURCE_DATE_EPOCH_ENV, epochStr)
+	}
+
+	return time.Unix(epoch, 0), nil
+}
+
+// Writes the specified files to a tar archive.  The archive depends only on
+// the entries' names and contents: entries are sorted by name, and each is
+// recorded with the specified modification time, fixed permissions, and no
+// owner.
+func WriteArchive(w io.Writer, entries []ArchiveEntry, mtime time.Time) error {
+	sorted := make([]ArchiveEntry, len(entries))
+	copy(sorted, entries)
+	sort.Sort(archiveEntrySorter{sorted})
+
+	tw := tar.NewWriter(w)
+	for _, entry := range sorted {
+		data, err := ioutil.ReadFile(entry.Path)
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     entry.Name,
+			Mode:     0644,
+			Size:     int64(len(data)),
+			ModTime:  mtime,
+			Format:   tar.FormatUSTAR,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return util.ChildNewtError(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Writes an artifact archive to the specified file.  If the file name ends in
+// ".gz" or ".tgz", the archive is gzip-compressed; the gzip header records no
+// name or timestamp.
+func WriteArchiveFile(path string, entries []ArchiveEntry,
+	mtime time.Time) error {
+
+	f, err := os.Create(path)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	defer f.Close()
+
+	if !strings.HasSuffix(path, ".gz") && !strings.HasSuffix(path, ".tgz") {
+		return WriteArchive(f, entries, mtime)
+	}
+
+	gw := gzip.NewWriter(f)
+	if err := WriteArchive(gw, entries, mtime); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Lists the artifacts of a single build that exist: the image, its digest
+// and UF2 file, the elf file and its binary and map, and the manifest.
+func buildArtifacts(targetName string, buildName string,
+	appPkg *pkg.LocalPackage) []ArchiveEntry {
+
+	if appPkg == nil {
+		return nil
+	}
+
+	appName := appPkg.Name()
+	imgPath := AppImgPath(targetName, buildName, appName)
+	elfPath := AppElfPath(targetName, buildName, appName)
+
+	paths := []string{
+		imgPath,
+		image.DigestPath(imgPath),
+		strings.TrimSuffix(imgPath, ".img") + ".uf2",
+		elfPath,
+		AppBinPath(targetName, buildName, appName),
+		elfPath + ".map",
+		ManifestPath(targetName, buildName, appName),
+	}
+
+	entries := []ArchiveEntry{}
+	for _, path := range paths {
+		if util.NodeExist(path) {
+			entries = append(entries, ArchiveEntry{
+				Name: buildName + "/" + filepath.Base(path),
+				Path: path,
+			})
+		}
+	}
+
+	return entries
+}
+
+// Lists the target's build artifacts that exist.  Each is named after its
+// build ("app" or "loader") and file name.  An error is returned if the
+// target has no image; i.e., if it has not been built and imaged.
+func (t *TargetBuilder) ArchiveEntries() ([]ArchiveEntry, error) {
+	targetName := t.target.Name()
+
+	entries := buildArtifacts(targetName, BUILD_NAME_APP, t.target.App())
+	entries = append(entries,
+		buildArtifacts(targetName, BUILD_NAME_LOADER, t.target.Loader())...)
+
+	haveImg := false
+	for _, entry := range entries {
+		if filepath.Ext(entry.Path) == ".img" {
+			haveImg = true
+		}
+	}
+	if !haveImg {
+		return nil, util.FmtNewtError(
+			"Target %s has no image; run \"newt create-image\" first",
+			t.target.FullName())
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,183 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteArchiveReproducible(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"blinky.img":      "image contents",
+		"blinky.elf":      "elf contents",
+		"blinky.elf.map":  "map contents",
+		"manifest.json":   "{}\n",
+		"boot.img":        "loader image",
+		"blinky.img.hash": "0123456789abcdef",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries := []ArchiveEntry{
+		{"app/manifest.json", filepath.Join(dir, "manifest.json")},
+		{"app/blinky.img", filepath.Join(dir, "blinky.img")},
+		{"loader/boot.img", filepath.Join(dir, "boot.img")},
+		{"app/blinky.elf", filepath.Join(dir, "blinky.elf")},
+		{"app/blinky.elf.map", filepath.Join(dir, "blinky.elf.map")},
+		{"app/blinky.img.hash", filepath.Join(dir, "blinky.img.hash")},
+	}
+
+	// The same entries in a different order.
+	reversed := make([]ArchiveEntry, len(entries))
+	for i, entry := range entries {
+		reversed[len(entries)-1-i] = entry
+	}
+
+	mtime := time.Unix(1500000000, 0)
+
+	for _, ext := range []string{".tar", ".tgz"} {
+		path1 := filepath.Join(dir, "first"+ext)
+		if err := WriteArchiveFile(path1, entries, mtime); err != nil {
+			t.Fatal(err)
+		}
+
+		// Touch the artifacts; file times must not affect the archive.
+		later := time.Now().Add(time.Hour)
+		for _, entry := range entries {
+			if err := os.Chtimes(entry.Path, later, later); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		path2 := filepath.Join(dir, "second"+ext)
+		if err := WriteArchiveFile(path2, reversed, mtime); err != nil {
+			t.Fatal(err)
+		}
+
+		data1, err := ioutil.ReadFile(path1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data2, err := ioutil.ReadFile(path2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data1, data2) {
+			t.Errorf("%s: archives differ", ext)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteArchive(buf, entries, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names = append(names, hdr.Name)
+		if !hdr.ModTime.Equal(mtime) {
+			t.Errorf("%s: wrong mtime: %s", hdr.Name, hdr.ModTime)
+		}
+		if hdr.Mode != 0644 || hdr.Uid != 0 || hdr.Gid != 0 ||
+			hdr.Uname != "" || hdr.Gname != "" {
+
+			t.Errorf("%s: unnormalized header: mode=%o uid=%d gid=%d "+
+				"uname=%s gname=%s", hdr.Name, hdr.Mode, hdr.Uid, hdr.Gid,
+				hdr.Uname, hdr.Gname)
+		}
+	}
+
+	expNames := []string{
+		"app/blinky.elf",
+		"app/blinky.elf.map",
+		"app/blinky.img",
+		"app/blinky.img.hash",
+		"app/manifest.json",
+		"loader/boot.img",
+	}
+	if len(names) != len(expNames) {
+		t.Fatalf("wrong entries: want=%v have=%v", expNames, names)
+	}
+	for i, name := range expNames {
+		if names[i] != name {
+			t.Errorf("wrong entry order: want=%v have=%v", expNames, names)
+			break
+		}
+	}
+}
+
+func TestArchiveTime(t *testing.T) {
+	defer os.Setenv(SOURCE_DATE_EPOCH_ENV, os.Getenv(SOURCE_DATE_EPOCH_ENV))
+
+	tests := []struct {
+		env     string
+		exp     int64
+		invalid bool
+	}{
+		{env: "", exp: 0},
+		{env: "1500000000", exp: 1500000000},
+		{env: "-5", invalid: true},
+		{env: "yesterday", invalid: true},
+	}
+
+	for _, test := range tests {
+		os.Setenv(SOURCE_DATE_EPOCH_ENV, test.env)
+
+		mtime, err := ArchiveTime()
+		if test.invalid {
+			if err == nil {
+				t.Errorf("$%s=%s: expected error; none reported",
+					SOURCE_DATE_EPOCH_ENV, test.env)
+			}
+		} else if err != nil {
+			t.Errorf("$%s=%s: unexpected error: %s",
+				SOURCE_DATE_EPOCH_ENV, test.env, err.Error())
+		} else if mtime.Unix() != test.exp {
+			t.Errorf("$%s=%s: wrong time: want=%d have=%d",
+				SOURCE_DATE_EPOCH_ENV, test.env, test.exp, mtime.Unix())
+		}
+	}
+}
@@ -0,0 +1,115 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/target"
+)
+
+// Two targets whose build directories coincide or overlap.  The targets
+// overwrite each other's artifacts when both are built.
+type BinDirCollision struct {
+	TargetA *target.Target
+	TargetB *target.Target
+	DirA    string
+	DirB    string
+
+	// Whether B's directory lies within A's rather than coinciding with it.
+	Nested bool
+}
+
+type binDirTargetSorter struct {
+	targets []*target.Target
+}
+
+func (s binDirTargetSorter) Len() int {
+	return len(s.targets)
+}
+func (s binDirTargetSorter) Swap(i, j int) {
+	s.targets[i], s.targets[j] = s.targets[j], s.targets[i]
+}
+func (s binDirTargetSorter) Less(i, j int) bool {
+	return s.targets[i].FullName() < s.targets[j].FullName()
+}
+
+// A pair of colliding build directories, identified by index.  If nested is
+// set, directory b lies within directory a.
+type binDirPair struct {
+	a      int
+	b      int
+	nested bool
+}
+
+// Compares build directories pairwise, case-insensitively.  The result is
+// ordered by the indices of the directories.
+func binDirCollisionPairs(dirs []string) []binDirPair {
+	keys := make([]string, len(dirs))
+	for i, dir := range dirs {
+		keys[i] = strings.ToLower(dir)
+	}
+
+	pairs := []binDirPair{}
+	for i, _ := range dirs {
+		for j := i + 1; j < len(dirs); j++ {
+			switch {
+			case keys[i] == keys[j]:
+				pairs = append(pairs, binDirPair{i, j, false})
+			case strings.HasPrefix(keys[j], keys[i]+"/"):
+				pairs = append(pairs, binDirPair{i, j, true})
+			case strings.HasPrefix(keys[i], keys[j]+"/"):
+				pairs = append(pairs, binDirPair{j, i, true})
+			}
+		}
+	}
+
+	return pairs
+}
+
+// Identifies pairs of targets with colliding build directories.  Directories
+// are compared case-insensitively, since they collide on case-insensitive
+// filesystems.  A directory nested within another target's directory also
+// collides, e.g., target "a/app" builds into the app directory of target
+// "a".  The result is sorted by target name.
+func BinDirCollisions(targets []*target.Target) []BinDirCollision {
+	sorted := append([]*target.Target{}, targets...)
+	sort.Sort(binDirTargetSorter{sorted})
+
+	dirs := make([]string, len(sorted))
+	for i, t := range sorted {
+		dirs[i] = filepath.Clean(TargetBinDir(t.Name()))
+	}
+
+	collisions := []BinDirCollision{}
+	for _, p := range binDirCollisionPairs(dirs) {
+		collisions = append(collisions, BinDirCollision{
+			TargetA: sorted[p.a],
+			TargetB: sorted[p.b],
+			DirA:    dirs[p.a],
+			DirB:    dirs[p.b],
+			Nested:  p.nested,
+		})
+	}
+
+	return collisions
+}
@@ -0,0 +1,67 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBinDirCollisionPairs(t *testing.T) {
+	tests := []struct {
+		name string
+		dirs []string
+		want []binDirPair
+	}{
+		{
+			name: "distinct",
+			dirs: []string{"bin/a", "bin/b", "bin/ab"},
+			want: []binDirPair{},
+		},
+		{
+			name: "differ only in case",
+			dirs: []string{"bin/Blinky", "bin/blinky"},
+			want: []binDirPair{{0, 1, false}},
+		},
+		{
+			name: "nested",
+			dirs: []string{"bin/a", "bin/a/app"},
+			want: []binDirPair{{0, 1, true}},
+		},
+		{
+			name: "nested; outer listed second",
+			dirs: []string{"bin/a/app", "bin/b", "bin/A"},
+			want: []binDirPair{{2, 0, true}},
+		},
+		{
+			name: "prefix without separator",
+			dirs: []string{"bin/a", "bin/app"},
+			want: []binDirPair{},
+		},
+	}
+
+	for _, test := range tests {
+		got := binDirCollisionPairs(test.dirs)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: binDirCollisionPairs(%v) = %v; want %v", test.name,
+				test.dirs, got, test.want)
+		}
+	}
+}
@@ -27,6 +27,7 @@ import (
 	log "github.com/Sirupsen/logrus"
 
 	"mynewt.apache.org/newt/newt/image"
+	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
 	"mynewt.apache.org/newt/newt/repo"
@@ -230,6 +231,7 @@ func (b *Builder) newCompiler(bpkg *BuildPackage,
 	}
 
 	c.AddInfo(b.compilerInfo)
+	c.DetectUnusedIncludes = b.targetBuilder.DetectUnusedIncludes
 
 	if bpkg != nil {
 		log.Debugf("Generating build flags for package %s", bpkg.FullName())
@@ -243,6 +245,22 @@ func (b *Builder) newCompiler(bpkg *BuildPackage,
 	return c, nil
 }
 
+// Returns the include directories used when compiling any of the builder's
+// packages.  Packages are visited in build order; each package contributes
+// its directories in the order they appear on its compiler command line.
+func (b *Builder) IncludePaths() ([]string, error) {
+	paths := []string{}
+	for _, bpkg := range b.sortedBuildPackages() {
+		c, err := b.newCompiler(bpkg, b.PkgBinDir(bpkg))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, c.IncludePaths()...)
+	}
+
+	return util.UniqueStrings(paths), nil
+}
+
 // Compiles and archives a package.
 func (b *Builder) buildPackage(bpkg *BuildPackage) error {
 	c, err := b.newCompiler(bpkg, b.PkgBinDir(bpkg))
@@ -322,12 +340,15 @@ func (b *Builder) ExtractSymbolInfo() (error, *symbol.SymbolMap) {
 	return nil, syms
 }
 
-func (b *Builder) link(elfName string, linkerScripts []string,
-	keepSymbols []string) error {
+// Creates the compiler used to link the specified elf file, and collects the
+// libraries to link: each package's trimmed archives followed by its
+// prebuilt libraries.
+func (b *Builder) linkCompiler(elfName string, linkerScripts []string) (
+	*toolchain.Compiler, []string, error) {
 
 	c, err := b.newCompiler(b.appPkg, b.FileBinDir(elfName))
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	/* Always used the trimmed archive files. */
@@ -338,7 +359,42 @@ func (b *Builder) link(elfName string, linkerScripts []string,
 		pkgNames = append(pkgNames, archiveNames...)
 	}
 
+	// Prebuilt libraries get linked as-is.  Make sure each one was built for
+	// the same architecture as the rest of the image.
+	if err := b.validatePrebuiltLibs(c, pkgNames); err != nil {
+		return nil, nil, err
+	}
+	for _, bpkg := range b.PkgMap {
+		pkgNames = append(pkgNames, bpkg.PrebuiltLibs...)
+	}
+
+	// System libraries resolved via pkg-config get linked into the image
+	// regardless of which package requested them.
+	c.AddInfo(b.pkgConfigLinkInfo())
+
 	c.LinkerScripts = linkerScripts
+
+	return c, pkgNames, nil
+}
+
+func (b *Builder) link(elfName string, linkerScripts []string,
+	keepSymbols []string) error {
+
+	defer newtutil.StartPhase("link")()
+
+	c, pkgNames, err := b.linkCompiler(elfName, linkerScripts)
+	if err != nil {
+		return err
+	}
+
+	// Only the final app elf gets stripped; temporary and test elfs are left
+	// intact.
+	if elfName == b.AppElfPath() {
+		tgt := b.GetTarget()
+		c.StripDebug = tgt.StripDebug
+		c.KeepUnstripped = tgt.KeepUnstripped
+	}
+
 	err = c.CompileElf(elfName, pkgNames, keepSymbols, b.linkElf)
 	if err != nil {
 		return err
@@ -347,6 +403,61 @@ func (b *Builder) link(elfName string, linkerScripts []string,
 	return nil
 }
 
+// Calculates the command that links the builder's app elf.  The packages
+// must already have been built; the command refers to their archives.
+func (b *Builder) LinkCmd(linkerScripts []string, elfLib string) (
+	string, error) {
+
+	c, pkgNames, err := b.linkCompiler(b.AppElfPath(), linkerScripts)
+	if err != nil {
+		return "", err
+	}
+
+	if len(pkgNames) == 0 {
+		return "", util.FmtNewtError(
+			"No libraries found for %s build; build the target first",
+			b.buildName)
+	}
+
+	return c.LinkCmd(b.AppElfPath(), pkgNames, nil, elfLib), nil
+}
+
+func (b *Builder) validatePrebuiltLibs(c *toolchain.Compiler,
+	archiveNames []string) error {
+
+	if len(archiveNames) == 0 {
+		// Nothing to compare against.
+		return nil
+	}
+
+	refArch := ""
+	for _, bpkg := range b.sortedBuildPackages() {
+		for _, lib := range bpkg.PrebuiltLibs {
+			if refArch == "" {
+				var err error
+				refArch, err = c.ObjArch(archiveNames[0])
+				if err != nil {
+					return err
+				}
+			}
+
+			arch, err := c.ObjArch(lib)
+			if err != nil {
+				return err
+			}
+
+			if arch != refArch {
+				return util.FmtNewtError(
+					"Prebuilt library %s (package %s) has incompatible "+
+						"architecture; expected=%s actual=%s",
+					lib, bpkg.Name(), refArch, arch)
+			}
+		}
+	}
+
+	return nil
+}
+
 // Populates the builder with all the packages that need to be built and
 // configures each package's build settings.  After this function executes,
 // packages are ready to be built.
@@ -358,6 +469,17 @@ func (b *Builder) PrepBuild() error {
 		}
 	}
 
+	// Ensure all prebuilt and system libraries are present before anything
+	// gets built.
+	for _, bpkg := range b.sortedBuildPackages() {
+		if err := bpkg.loadPrebuiltLibs(b); err != nil {
+			return err
+		}
+		if err := bpkg.loadPkgConfig(b); err != nil {
+			return err
+		}
+	}
+
 	b.logDepInfo()
 
 	// Populate the base set of compiler flags.  Flags from the following
@@ -449,6 +571,8 @@ func (b *Builder) addSysinitBpkg() (*BuildPackage, error) {
 }
 
 func (b *Builder) Build() error {
+	defer newtutil.StartPhase("compile")()
+
 	b.CleanArtifacts()
 
 	// Build the packages alphabetically to ensure a consistent order.
@@ -540,6 +664,12 @@ func (b *Builder) Test(p *pkg.LocalPackage) error {
 		return err
 	}
 
+	if b.coverageEnabled() {
+		if err := b.removeCoverageData(); err != nil {
+			return err
+		}
+	}
+
 	// Run the tests.
 	if err := os.Chdir(filepath.Dir(testFilename)); err != nil {
 		return err
@@ -554,6 +684,11 @@ func (b *Builder) Test(p *pkg.LocalPackage) error {
 		return newtError
 	}
 
+	if b.coverageEnabled() {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Coverage data written to %s\n", b.BinDir())
+	}
+
 	return nil
 }
 
@@ -651,6 +786,8 @@ func (b *Builder) buildRomElf(common *symbol.SymbolMap) error {
 func (b *Builder) CreateImage(version string,
 	keystr string, keyId uint8, loaderImg *image.Image) (*image.Image, error) {
 
+	defer newtutil.StartPhase("image")()
+
 	img, err := image.NewImage(b.AppBinPath(), b.AppImgPath())
 	if err != nil {
 		return nil, err
@@ -668,6 +805,48 @@ func (b *Builder) CreateImage(version string,
 		}
 	}
 
+	if sigType := b.targetBuilder.ImageDetachedSigType; sigType != 0 {
+		if keystr != "" {
+			return nil, util.NewNewtError(
+				"A signing key cannot be specified for detached signing")
+		}
+		img.DetachedSigType = sigType
+		img.DigestPath = image.DigestPath(img.TargetImg)
+		img.KeyId = keyId
+	}
+
+	img.GitDesc = b.targetBuilder.ImageGitDesc
+
+	img.Dependencies, err = image.ParseDependencies(
+		project.GetProject().ImageDependencies())
+	if err != nil {
+		return nil, err
+	}
+
+	img.HeaderOffset = b.targetBuilder.ImageHeaderOffset
+	img.HeaderFill = b.targetBuilder.ImageHeaderFill
+	img.TrailerReserve = b.targetBuilder.ImageTrailerReserve
+	img.Magic = b.targetBuilder.ImageMagic
+
+	if b.targetBuilder.ImageCfgHash {
+		img.CfgHash = b.cfg.Hash()
+	}
+
+	if b.targetBuilder.ImageDryRunSign {
+		digest, err := img.SigningDigest(loaderImg)
+		if err != nil {
+			return nil, err
+		}
+		img.Hash = digest.Digest
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Dry run; %s not written.  Digest to be signed: %x\n"+
+				"    covers file offsets 0x%x-0x%x; stored in hash TLV at "+
+				"offset 0x%x\n", img.TargetImg, digest.Digest, digest.Offset,
+			digest.Offset+digest.Size, digest.HashOffset)
+		return img, nil
+	}
+
 	err = img.Generate(loaderImg)
 	if err != nil {
 		return nil, err
@@ -675,6 +854,11 @@ func (b *Builder) CreateImage(version string,
 
 	util.StatusMessage(util.VERBOSITY_DEFAULT,
 		"App image succesfully generated: %s\n", img.TargetImg)
+	if img.DigestPath != "" {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Image digest for detached signing written to %s\n",
+			img.DigestPath)
+	}
 
 	return img, nil
 }
@@ -687,6 +871,7 @@ func (b *Builder) CreateImage(version string,
 func (b *Builder) CleanArtifacts() {
 	paths := []string{
 		b.AppImgPath(),
+		image.DigestPath(b.AppImgPath()),
 		b.AppBinPath(),
 		b.ManifestPath(),
 	}
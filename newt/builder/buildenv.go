@@ -0,0 +1,194 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/util"
+)
+
+// A single aspect of the environment a target is built in, e.g., the
+// toolchain version or a package's resolved compiler flags.
+type BuildEnvItem struct {
+	Key   string
+	Value string
+}
+
+type buildEnvSorter struct {
+	items []BuildEnvItem
+}
+
+func (s buildEnvSorter) Len() int {
+	return len(s.items)
+}
+func (s buildEnvSorter) Swap(i, j int) {
+	s.items[i], s.items[j] = s.items[j], s.items[i]
+}
+func (s buildEnvSorter) Less(i, j int) bool {
+	return s.items[i].Key < s.items[j].Key
+}
+
+// Describes the environment the target is built in: the newt version, the
+// toolchain and its version, the build profile, and the resolved flags of
+// every package.  Unlike a fingerprint, source file contents are not
+// included; two machines with equal environments produce identical builds
+// from identical sources.  Paths within the project are made relative to the
+// project directory.  The items are sorted by key.
+func (t *TargetBuilder) BuildEnv() ([]BuildEnvItem, error) {
+	if err := t.PrepBuild(); err != nil {
+		return nil, err
+	}
+
+	projBase := project.GetProject().Path() + "/"
+	items := []BuildEnvItem{}
+	add := func(key string, value string) {
+		items = append(items, BuildEnvItem{
+			Key:   key,
+			Value: strings.Replace(value, projBase, "", -1),
+		})
+	}
+
+	c, err := t.NewCompiler(t.AppBuilder.BinDir())
+	if err != nil {
+		return nil, err
+	}
+
+	add("newt_version", newtutil.NewtVersionStr)
+	add("toolchain", t.compilerPkg.FullName())
+	add("toolchain_version", c.Version())
+	add("build_profile", t.target.BuildProfile)
+
+	builders := []*Builder{t.AppBuilder}
+	if t.LoaderBuilder != nil {
+		builders = append(builders, t.LoaderBuilder)
+	}
+	for _, b := range builders {
+		for _, bpkg := range b.sortedBuildPackages() {
+			pc, err := b.newCompiler(bpkg, b.PkgBinDir(bpkg))
+			if err != nil {
+				return nil, err
+			}
+
+			// Each summary line is "<flag-type> <flags>".
+			for _, line := range pc.FlagSummary() {
+				parts := strings.SplitN(line, " ", 2)
+				if len(parts) < 2 {
+					parts = append(parts, "")
+				}
+				add(fmt.Sprintf("%s:%s:%s", b.buildName, bpkg.FullName(),
+					parts[0]), parts[1])
+			}
+		}
+	}
+
+	sort.Sort(buildEnvSorter{items})
+	return items, nil
+}
+
+// Calculates a digest of a build environment.  Equal environments always
+// produce the same digest.
+func BuildEnvDigest(items []BuildEnvItem) string {
+	h := sha256.New()
+	for _, item := range items {
+		fmt.Fprintf(h, "%s\t%s\n", item.Key, item.Value)
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// Serializes a build environment as one "<key>\t<value>" line per item.
+func FormatBuildEnv(items []BuildEnvItem) string {
+	buf := ""
+	for _, item := range items {
+		buf += item.Key + "\t" + item.Value + "\n"
+	}
+
+	return buf
+}
+
+// Parses a build environment serialized by FormatBuildEnv.
+func ParseBuildEnv(text string) ([]BuildEnvItem, error) {
+	items := []BuildEnvItem{}
+	for i, line := range strings.Split(text, "\n") {
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) != 2 {
+			return nil, util.FmtNewtError(
+				"Invalid build environment entry at line %d: \"%s\"",
+				i+1, line)
+		}
+		items = append(items, BuildEnvItem{parts[0], parts[1]})
+	}
+
+	sort.Sort(buildEnvSorter{items})
+	return items, nil
+}
+
+// Itemizes the differences between two build environments, sorted by key.
+// An item present in only one environment is reported as missing from the
+// other.
+func DiffBuildEnvs(a []BuildEnvItem, b []BuildEnvItem) []string {
+	amap := map[string]string{}
+	for _, item := range a {
+		amap[item.Key] = item.Value
+	}
+	bmap := map[string]string{}
+	for _, item := range b {
+		bmap[item.Key] = item.Value
+	}
+
+	keys := []string{}
+	for k, _ := range amap {
+		keys = append(keys, k)
+	}
+	for k, _ := range bmap {
+		if _, ok := amap[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	diffs := []string{}
+	for _, k := range keys {
+		av, ina := amap[k]
+		bv, inb := bmap[k]
+
+		switch {
+		case !inb:
+			diffs = append(diffs, fmt.Sprintf("%s: only in first: %s", k, av))
+		case !ina:
+			diffs = append(diffs, fmt.Sprintf("%s: only in second: %s", k, bv))
+		case av != bv:
+			diffs = append(diffs,
+				fmt.Sprintf("%s: first=\"%s\" second=\"%s\"", k, av, bv))
+		}
+	}
+
+	return diffs
+}
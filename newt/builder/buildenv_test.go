@@ -0,0 +1,107 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"reflect"
+	"testing"
+)
+
+// A build environment as reported by BuildEnv, with the toolchain version
+// replaced by the specified string.
+func testBuildEnv(toolchainVersion string) []BuildEnvItem {
+	return []BuildEnvItem{
+		{"app:@apache-mynewt-core/kernel/os:cflags",
+			"-DMYNEWT=1 -Os -Wall -Werror"},
+		{"app:@apache-mynewt-core/kernel/os:lflags", ""},
+		{"app:apps/blinky:cflags", "-DMYNEWT=1 -Os -Wall -Werror"},
+		{"build_profile", "default"},
+		{"newt_version", "1.1.0-dev"},
+		{"toolchain", "@apache-mynewt-core/compiler/arm-none-eabi-m4"},
+		{"toolchain_version", toolchainVersion},
+	}
+}
+
+func TestBuildEnvDigest(t *testing.T) {
+	gcc6 := "arm-none-eabi-gcc (GNU Tools for ARM Embedded Processors) " +
+		"6.3.1 20170620"
+	gcc7 := "arm-none-eabi-gcc (GNU Tools for Arm Embedded Processors " +
+		"7-2017-q4-major) 7.2.1 20170904"
+
+	digest := BuildEnvDigest(testBuildEnv(gcc6))
+	if len(digest) != 64 {
+		t.Errorf("digest is not a hex sha256: %s", digest)
+	}
+
+	if d := BuildEnvDigest(testBuildEnv(gcc6)); d != digest {
+		t.Errorf("digest of identical environment differs: %s != %s",
+			d, digest)
+	}
+
+	// A round trip through the serialized form preserves the digest.
+	parsed, err := ParseBuildEnv(FormatBuildEnv(testBuildEnv(gcc6)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := BuildEnvDigest(parsed); d != digest {
+		t.Errorf("digest changed after serialization: %s != %s", d, digest)
+	}
+
+	if d := BuildEnvDigest(testBuildEnv(gcc7)); d == digest {
+		t.Errorf("digest unchanged after toolchain version change")
+	}
+}
+
+func TestDiffBuildEnvs(t *testing.T) {
+	first := testBuildEnv("6.3.1")
+	second := append(testBuildEnv("7.2.1"),
+		BuildEnvItem{"loader:@mcuboot/boot/bootutil:cflags", "-Os"})
+	second[2].Value = "-DMYNEWT=1 -O0 -g"
+	second = append(second[:1], second[2:]...)
+
+	exp := []string{
+		"app:@apache-mynewt-core/kernel/os:lflags: only in first: ",
+		"app:apps/blinky:cflags: first=\"-DMYNEWT=1 -Os -Wall -Werror\" " +
+			"second=\"-DMYNEWT=1 -O0 -g\"",
+		"loader:@mcuboot/boot/bootutil:cflags: only in second: -Os",
+		"toolchain_version: first=\"6.3.1\" second=\"7.2.1\"",
+	}
+
+	diffs := DiffBuildEnvs(first, second)
+	if !reflect.DeepEqual(diffs, exp) {
+		t.Errorf("wrong differences:\nwant=%q\nhave=%q", exp, diffs)
+	}
+
+	if diffs := DiffBuildEnvs(first, testBuildEnv("6.3.1")); len(diffs) != 0 {
+		t.Errorf("unexpected differences: %q", diffs)
+	}
+}
+
+func TestParseBuildEnvInvalid(t *testing.T) {
+	_, err := ParseBuildEnv("newt_version\t1.1.0\ntoolchain_version\n")
+	if err == nil {
+		t.Fatalf("expected error; none reported")
+	}
+
+	exp := "Invalid build environment entry at line 2: \"toolchain_version\""
+	if err.Error() != exp {
+		t.Errorf("wrong error: want=%s have=%s", exp, err.Error())
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/resolve"
 	"mynewt.apache.org/newt/newt/syscfg"
 	"mynewt.apache.org/newt/newt/toolchain"
 	"mynewt.apache.org/newt/util"
@@ -39,6 +40,13 @@ type BuildPackage struct {
 
 	ci                *toolchain.CompilerInfo
 	SourceDirectories []string
+
+	// Prebuilt .a and .o files that get linked without compilation.
+	PrebuiltLibs []string
+
+	// Flags reported by pkg-config for the package's system libraries.
+	PkgConfigCflags []string
+	PkgConfigLflags []string
 }
 
 // Recursively iterates through an pkg's dependencies, adding each pkg
@@ -65,6 +73,11 @@ func (bpkg *BuildPackage) collectDepsAux(b *Builder,
 		dpkg := p.(*pkg.LocalPackage)
 
 		dbpkg := b.PkgMap[dpkg]
+		if dbpkg == nil &&
+			resolve.PkgExcluded(dpkg, b.targetBuilder.target.ExcludedPkgs()) {
+
+			continue
+		}
 		if dbpkg == nil {
 			return util.FmtNewtError("Package not found %s; required by %s",
 				dpkg.Name(), bpkg.Name())
@@ -131,6 +144,7 @@ func (bpkg *BuildPackage) CompilerInfo(
 		"pkg.lflags")
 	ci.Aflags = newtutil.GetStringSliceFeatures(bpkg.PkgV, features,
 		"pkg.aflags")
+	ci.Cflags = append(ci.Cflags, bpkg.PkgConfigCflags...)
 
 	// Package-specific injected settings get specified as C flags on the
 	// command line.
@@ -162,6 +176,22 @@ func (bpkg *BuildPackage) CompilerInfo(
 		ci.IgnoreDirs = append(ci.IgnoreDirs, re)
 	}
 
+	// Skip conditional source files whose conditions do not hold.
+	excluded, err := b.cfg.ExcludedSrcsForLpkg(bpkg.LocalPackage,
+		b.targetBuilder.bspPkg.Arch)
+	if err != nil {
+		return nil, err
+	}
+	for _, cs := range excluded {
+		path, err := filepath.Abs(bpkg.BasePath() + "/" + cs.File)
+		if err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+		log.Debugf("Excluding source file %s; condition %s does not hold",
+			path, cs.Cond.String())
+		ci.IgnorePaths = append(ci.IgnorePaths, path)
+	}
+
 	bpkg.SourceDirectories = newtutil.GetStringSliceFeatures(bpkg.PkgV,
 		features, "pkg.src_dirs")
 
@@ -176,6 +206,37 @@ func (bpkg *BuildPackage) CompilerInfo(
 	return bpkg.ci, nil
 }
 
+// Reads the package's list of prebuilt libraries (pkg.prebuilt_libs).  Paths
+// are relative to the package directory.  An error is returned if a listed
+// file does not exist or is not an archive or object file.
+func (bpkg *BuildPackage) loadPrebuiltLibs(b *Builder) error {
+	features := b.cfg.FeaturesForLpkg(bpkg.LocalPackage)
+	relPaths := newtutil.GetStringSliceFeatures(bpkg.PkgV, features,
+		"pkg.prebuilt_libs")
+
+	bpkg.PrebuiltLibs = []string{}
+	for _, relPath := range relPaths {
+		path := bpkg.BasePath() + "/" + relPath
+
+		ext := filepath.Ext(path)
+		if ext != ".a" && ext != ".o" {
+			return util.FmtNewtError(
+				"Package %s specifies invalid prebuilt library %s; "+
+					"must be a .a or .o file", bpkg.Name(), relPath)
+		}
+
+		if util.NodeNotExist(path) {
+			return util.FmtNewtError(
+				"Package %s specifies nonexistent prebuilt library %s",
+				bpkg.Name(), path)
+		}
+
+		bpkg.PrebuiltLibs = append(bpkg.PrebuiltLibs, path)
+	}
+
+	return nil
+}
+
 // Searches for a package which can satisfy bpkg's API requirement.  If such a
 // package is found, bpkg's API requirement is marked as satisfied, and the
 // package is added to bpkg's dependency list.
@@ -282,6 +343,15 @@ func (bpkg *BuildPackage) resolveDeps(
 	proj := project.GetProject()
 	newDeps := newtutil.GetStringSliceFeatures(bpkg.PkgV, features,
 		"pkg.deps")
+
+	condDeps, err := cfg.CondDepsForLpkg(bpkg.LocalPackage)
+	if err != nil {
+		return err
+	}
+	for _, cd := range condDeps {
+		newDeps = append(newDeps, cd.Dep)
+	}
+
 	for _, newDepStr := range newDeps {
 		newDep, err := pkg.NewDependency(bpkg.Repo(), newDepStr)
 		if err != nil {
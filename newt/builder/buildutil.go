@@ -97,7 +97,7 @@ func (b *Builder) sortedLocalPackages() []*pkg.LocalPackage {
 
 func (b *Builder) logDepInfo() {
 	// Log feature set.
-	log.Debugf("Feature set: [" + b.FeatureString() + "]")
+	log.Debugf("Feature set: [%s]", b.FeatureString())
 
 	// Log API set.
 	apis := make([]string, 0, len(b.apiMap))
@@ -109,7 +109,7 @@ func (b *Builder) logDepInfo() {
 	log.Debugf("API set:")
 	for _, api := range apis {
 		bpkg := b.apiMap[api]
-		log.Debugf("    * " + api + " (" + bpkg.FullName() + ")")
+		log.Debugf("    * %s (%s)", api, bpkg.FullName())
 	}
 
 	// Log dependency graph.
@@ -131,7 +131,6 @@ func (b *Builder) logDepInfo() {
 			}
 			buffer.WriteString(dep.String())
 		}
-		log.Debugf("    * " + bpkg.Name() + " [" +
-			buffer.String() + "]")
+		log.Debugf("    * %s [%s]", bpkg.Name(), buffer.String())
 	}
 }
@@ -0,0 +1,87 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/newt/toolchain"
+	"mynewt.apache.org/newt/util"
+)
+
+// The architecture of BSPs whose builds run on the build host.
+const HOST_BSP_ARCH = "sim"
+
+// The extension of the coverage counter files an instrumented executable
+// writes alongside each object file when it exits.
+const COVERAGE_DATA_EXT = ".gcda"
+
+// Ensures the coverage build profile is only used with host targets; an
+// instrumented executable must be able to write its coverage data to the
+// build host's file system.
+func checkCoverageTarget(t *target.Target, bsp *pkg.BspPackage) error {
+	if t.BuildProfile != toolchain.COVERAGE_BUILD_PROFILE {
+		return nil
+	}
+
+	if bsp.Arch != HOST_BSP_ARCH {
+		return util.FmtNewtError(
+			"Build profile \"%s\" requires a host target; BSP %s has "+
+				"arch \"%s\", not \"%s\"", toolchain.COVERAGE_BUILD_PROFILE,
+			bsp.FullName(), bsp.Arch, HOST_BSP_ARCH)
+	}
+
+	return nil
+}
+
+func (b *Builder) coverageEnabled() bool {
+	return b.targetBuilder.target.BuildProfile ==
+		toolchain.COVERAGE_BUILD_PROFILE
+}
+
+// Removes the coverage counter files left in the build's bin directory by
+// previous runs.  The counters accumulate across runs otherwise, so each
+// test run would report the combined coverage of every earlier run.  The
+// notes (.gcno) files written at compile time are retained.
+func (b *Builder) removeCoverageData() error {
+	dir := b.BinDir()
+	if util.NodeNotExist(dir) {
+		return nil
+	}
+
+	return filepath.Walk(dir,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return util.ChildNewtError(err)
+			}
+
+			if !info.IsDir() && strings.HasSuffix(path, COVERAGE_DATA_EXT) {
+				if err := os.Remove(path); err != nil {
+					return util.ChildNewtError(err)
+				}
+			}
+
+			return nil
+		})
+}
@@ -0,0 +1,193 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// A file that differs between two builds of the same target.  A size of -1
+// indicates that the file is absent from that build.
+type OutputDiff struct {
+	Path  string
+	SizeA int
+	SizeB int
+
+	// Number of differing bytes, including bytes beyond the end of the
+	// shorter file; the number of contiguous runs they form; and the offset
+	// of the first.
+	DiffBytes int
+	DiffRuns  int
+	FirstDiff int
+}
+
+func (d OutputDiff) String() string {
+	switch {
+	case d.SizeA < 0:
+		return fmt.Sprintf("%s: only in second build", d.Path)
+	case d.SizeB < 0:
+		return fmt.Sprintf("%s: only in first build", d.Path)
+	}
+
+	s := fmt.Sprintf("%s: %d bytes differ in %d run(s), first at offset 0x%x",
+		d.Path, d.DiffBytes, d.DiffRuns, d.FirstDiff)
+	if d.SizeA != d.SizeB {
+		s += fmt.Sprintf("; size %d vs. %d", d.SizeA, d.SizeB)
+	}
+
+	return s
+}
+
+// Compares two files' contents byte by byte.
+func diffBytes(a []byte, b []byte) (count int, runs int, first int) {
+	first = -1
+	inRun := false
+
+	n := util.IntMin(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] == b[i] {
+			inRun = false
+			continue
+		}
+
+		if first == -1 {
+			first = i
+		}
+		if !inRun {
+			runs++
+			inRun = true
+		}
+		count++
+	}
+
+	if len(a) != len(b) {
+		if first == -1 {
+			first = n
+		}
+		if !inRun {
+			runs++
+		}
+		count += util.IntMax(len(a), len(b)) - n
+	}
+
+	return count, runs, first
+}
+
+// Returns the paths, relative to dir, of the regular files beneath dir.
+func outputFiles(dir string) (map[string]bool, error) {
+	files := map[string]bool{}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files[rel] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return files, nil
+}
+
+// Compares the outputs of two builds, located in dirA and dirB.  Files whose
+// base names appear in ignore are skipped.  The result lists each file that
+// differs, sorted by path.
+func CompareBuildOutputs(dirA string, dirB string,
+	ignore []string) ([]OutputDiff, error) {
+
+	filesA, err := outputFiles(dirA)
+	if err != nil {
+		return nil, err
+	}
+	filesB, err := outputFiles(dirB)
+	if err != nil {
+		return nil, err
+	}
+
+	ignoreMap := map[string]bool{}
+	for _, name := range ignore {
+		ignoreMap[name] = true
+	}
+
+	paths := []string{}
+	for path, _ := range filesA {
+		paths = append(paths, path)
+	}
+	for path, _ := range filesB {
+		if !filesA[path] {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	diffs := []OutputDiff{}
+	for _, path := range paths {
+		if ignoreMap[filepath.Base(path)] {
+			continue
+		}
+
+		d := OutputDiff{
+			Path:  path,
+			SizeA: -1,
+			SizeB: -1,
+		}
+
+		var a, b []byte
+		if filesA[path] {
+			if a, err = ioutil.ReadFile(filepath.Join(dirA, path)); err != nil {
+				return nil, util.ChildNewtError(err)
+			}
+			d.SizeA = len(a)
+		}
+		if filesB[path] {
+			if b, err = ioutil.ReadFile(filepath.Join(dirB, path)); err != nil {
+				return nil, util.ChildNewtError(err)
+			}
+			d.SizeB = len(b)
+		}
+
+		if d.SizeA >= 0 && d.SizeB >= 0 {
+			d.DiffBytes, d.DiffRuns, d.FirstDiff = diffBytes(a, b)
+			if d.DiffBytes == 0 {
+				continue
+			}
+		}
+
+		diffs = append(diffs, d)
+	}
+
+	return diffs, nil
+}
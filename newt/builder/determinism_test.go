@@ -0,0 +1,99 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTestBuildOutput(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCompareBuildOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-determinism")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dirA := filepath.Join(dir, "a")
+	dirB := filepath.Join(dir, "b")
+
+	// The second build embeds a different build time in the version object
+	// and the elf.
+	writeTestBuildOutput(t, dirA, map[string]string{
+		"app/apps/blinky/src/main.o":     "main object",
+		"app/sys/id/src/id.o":            "id: built 2017-06-01 12:00:00\x00",
+		"app/apps/blinky/blinky.elf":     "ELF...12:00:00...12:00:00",
+		"app/apps/blinky/blinky.elf.cmd": "gcc -o blinky.elf /tmp/a",
+		"app/apps/blinky/blinky.map":     "map",
+	})
+	writeTestBuildOutput(t, dirB, map[string]string{
+		"app/apps/blinky/src/main.o":     "main object",
+		"app/sys/id/src/id.o":            "id: built 2017-06-01 12:00:07\x00",
+		"app/apps/blinky/blinky.elf":     "ELF...12:00:07...12:00:07!",
+		"app/apps/blinky/blinky.elf.cmd": "gcc -o blinky.elf /tmp/b",
+		"app/apps/blinky/blinky.lst":     "listing",
+	})
+
+	diffs, err := CompareBuildOutputs(dirA, dirB, []string{"blinky.elf.cmd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{
+		"app/apps/blinky/blinky.elf: 3 bytes differ in 2 run(s), " +
+			"first at offset 0xd; size 25 vs. 26",
+		"app/apps/blinky/blinky.lst: only in second build",
+		"app/apps/blinky/blinky.map: only in first build",
+		"app/sys/id/src/id.o: 1 bytes differ in 1 run(s), " +
+			"first at offset 0x1c",
+	}
+
+	act := []string{}
+	for _, d := range diffs {
+		act = append(act, d.String())
+	}
+	if !reflect.DeepEqual(act, exp) {
+		t.Errorf("wrong differences:\nwant=%q\nhave=%q", exp, act)
+	}
+
+	// A build compared with itself is deterministic.
+	diffs, err = CompareBuildOutputs(dirA, dirA, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("unexpected differences: %+v", diffs)
+	}
+}
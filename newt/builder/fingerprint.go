@@ -0,0 +1,169 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/util"
+)
+
+// Accumulates the inputs of a build.  Absolute paths are made relative to the
+// project directory so that the same project checked out in two locations
+// yields the same fingerprint.
+type fingerprinter struct {
+	h        hash.Hash
+	projBase string
+}
+
+func newFingerprinter() *fingerprinter {
+	return &fingerprinter{
+		h:        sha256.New(),
+		projBase: project.GetProject().Path() + "/",
+	}
+}
+
+func (fp *fingerprinter) add(format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	line = strings.Replace(line, fp.projBase, "", -1)
+	fp.h.Write([]byte(line + "\n"))
+}
+
+// Adds the path and contents of every file in a package directory.  Hidden
+// entries and "bin" directories are skipped; they do not contain inputs.
+func (fp *fingerprinter) addPkgFiles(bpkg *BuildPackage) error {
+	base := bpkg.BasePath()
+
+	return filepath.Walk(base,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			name := info.Name()
+			skip := strings.HasPrefix(name, ".") ||
+				(info.IsDir() && name == "bin")
+			if path != base && skip {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			fileHash := sha256.New()
+			if _, err := io.Copy(fileHash, f); err != nil {
+				return err
+			}
+
+			relPath, err := filepath.Rel(base, path)
+			if err != nil {
+				return err
+			}
+			fp.add("    file %s %x", relPath, fileHash.Sum(nil))
+			return nil
+		})
+}
+
+func (fp *fingerprinter) addBuilder(b *Builder) error {
+	fp.add("build %s", b.buildName)
+
+	names := make([]string, 0, len(b.cfg.Settings))
+	for name, _ := range b.cfg.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fp.add("syscfg %s=%s", name, b.cfg.Settings[name].Value)
+	}
+
+	for _, bpkg := range b.sortedBuildPackages() {
+		fp.add("pkg %s", bpkg.FullName())
+
+		// Generated packages are derived from the syscfg values above.
+		if bpkg.Type() != pkg.PACKAGE_TYPE_GENERATED {
+			if err := fp.addPkgFiles(bpkg); err != nil {
+				return util.FmtNewtError(
+					"Failed to read source files of package %s: %s",
+					bpkg.FullName(), err.Error())
+			}
+		}
+
+		c, err := b.newCompiler(bpkg, b.PkgBinDir(bpkg))
+		if err != nil {
+			return err
+		}
+		for _, line := range c.FlagSummary() {
+			fp.add("    %s", line)
+		}
+	}
+
+	return nil
+}
+
+// Calculates a digest of every input to the target's build: the source files
+// of each resolved package, the syscfg values, the compiler flags, and the
+// toolchain version.  Identical inputs always produce the same digest.
+func (t *TargetBuilder) Fingerprint() (string, error) {
+	if err := t.PrepBuild(); err != nil {
+		return "", err
+	}
+
+	fp := newFingerprinter()
+
+	fp.add("target %s", t.target.FullName())
+	fp.add("build_profile %s", t.target.BuildProfile)
+
+	c, err := t.NewCompiler(t.AppBuilder.BinDir())
+	if err != nil {
+		return "", err
+	}
+	fp.add("toolchain %s %s", t.compilerPkg.FullName(), c.Version())
+
+	builders := []*Builder{t.AppBuilder}
+	if t.LoaderBuilder != nil {
+		builders = append(builders, t.LoaderBuilder)
+	}
+	for _, b := range builders {
+		if err := fp.addBuilder(b); err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("%x", fp.h.Sum(nil)), nil
+}
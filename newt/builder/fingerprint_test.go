@@ -0,0 +1,119 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/pkg"
+)
+
+// Writes the specified files beneath dir.
+func testWriteFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Fingerprints a package located at <projDir>/pkgs/foo containing the
+// specified files.
+func testFingerprintPkg(t *testing.T, projDir string,
+	files map[string]string) string {
+
+	pkgDir := filepath.Join(projDir, "pkgs", "foo")
+	testWriteFiles(t, pkgDir, files)
+
+	fp := &fingerprinter{
+		h:        sha256.New(),
+		projBase: projDir + "/",
+	}
+	fp.add("pkg %s", pkgDir)
+
+	bpkg := &BuildPackage{LocalPackage: pkg.NewLocalPackage(nil, pkgDir)}
+	if err := fp.addPkgFiles(bpkg); err != nil {
+		t.Fatal(err)
+	}
+
+	return fmt.Sprintf("%x", fp.h.Sum(nil))
+}
+
+func TestFingerprintPkgFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-fingerprint-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base := map[string]string{
+		"pkg.yml":       "pkg.name: foo\n",
+		"src/foo.c":     "int foo;\n",
+		"include/foo.h": "extern int foo;\n",
+	}
+	with := func(extra map[string]string) map[string]string {
+		files := map[string]string{}
+		for k, v := range base {
+			files[k] = v
+		}
+		for k, v := range extra {
+			files[k] = v
+		}
+		return files
+	}
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		same  bool
+	}{
+		{"identical", base, true},
+		{"hidden file", with(map[string]string{".swp": "x"}), true},
+		{"hidden dir", with(map[string]string{".git/HEAD": "x"}), true},
+		{"bin dir", with(map[string]string{"bin/foo.o": "x"}), true},
+		{"modified source", with(map[string]string{"src/foo.c": "int bar;\n"}),
+			false},
+		{"added source", with(map[string]string{"src/bar.c": "int bar;\n"}),
+			false},
+	}
+
+	// Each package is fingerprinted in a different project directory; the
+	// project location does not contribute to the digest.
+	want := testFingerprintPkg(t, filepath.Join(dir, "base"), base)
+	for i, test := range tests {
+		projDir := filepath.Join(dir, fmt.Sprintf("proj%d", i))
+		got := testFingerprintPkg(t, projDir, test.files)
+
+		if test.same && got != want {
+			t.Errorf("%s: fingerprint changed", test.name)
+		} else if !test.same && got == want {
+			t.Errorf("%s: fingerprint unchanged", test.name)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/syscfg"
+	"mynewt.apache.org/newt/util"
+)
+
+// The syscfg setting that identifies a boot loader app.  A boot loader is
+// written to the boot loader area rather than to an image slot, and it is
+// programmed as a raw binary rather than an image.
+const BOOT_LOADER_SETTING = "BOOT_LOADER"
+
+// The flash capacity a target's build requires of one flash device.
+type FlashRequirement struct {
+	Device int
+
+	// The flash areas the build populates, ordered by offset.
+	Areas []string
+
+	// One past the highest address occupied by the build's images.
+	ContentEnd int
+
+	// One past the end of the last populated area.  The device must be at
+	// least this large.
+	MinSize int
+
+	// The device's capacity, as specified by the BSP; 0 if unspecified.
+	Capacity int
+}
+
+type flashRequirementSorter struct {
+	reqs []FlashRequirement
+}
+
+func (s flashRequirementSorter) Len() int {
+	return len(s.reqs)
+}
+func (s flashRequirementSorter) Swap(i, j int) {
+	s.reqs[i], s.reqs[j] = s.reqs[j], s.reqs[i]
+}
+func (s flashRequirementSorter) Less(i, j int) bool {
+	return s.reqs[i].Device < s.reqs[j].Device
+}
+
+// Determines the flash areas the target's build populates.  Areas that
+// receive an image or binary map to its size; areas claimed by flash_owner
+// settings, which are populated at runtime, map to 0.
+func (t *TargetBuilder) populatedAreas(cfg syscfg.Cfg) (map[string]int, error) {
+	targetName := t.target.Name()
+	areas := map[string]int{}
+
+	addFile := func(areaName string, path string) error {
+		info, err := os.Stat(path)
+		if err != nil {
+			return util.FmtNewtError(
+				"Cannot determine flash footprint; %s does not exist: %s",
+				path, err.Error())
+		}
+		areas[areaName] = int(info.Size())
+		return nil
+	}
+
+	bootEntry := cfg.Settings[BOOT_LOADER_SETTING]
+	if bootEntry.IsTrue() {
+		path := AppBinPath(targetName, BUILD_NAME_APP, t.appPkg.Name())
+		if err := addFile(flash.FLASH_AREA_NAME_BOOTLOADER, path); err != nil {
+			return nil, err
+		}
+	} else {
+		appImgPath, loaderImgPath, err := t.ImagePaths()
+		if err != nil {
+			return nil, err
+		}
+
+		appSlot := flash.FLASH_AREA_NAME_IMAGE_0
+		if loaderImgPath != "" {
+			appSlot = flash.FLASH_AREA_NAME_IMAGE_1
+			if err := addFile(flash.FLASH_AREA_NAME_IMAGE_0,
+				loaderImgPath); err != nil {
+
+				return nil, err
+			}
+		}
+		if err := addFile(appSlot, appImgPath); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, entry := range cfg.Settings {
+		if entry.SettingType == syscfg.CFG_SETTING_TYPE_FLASH_OWNER &&
+			entry.Value != "" {
+
+			if _, ok := areas[entry.Value]; !ok {
+				areas[entry.Value] = 0
+			}
+		}
+	}
+
+	return areas, nil
+}
+
+// Calculates the minimum size of each flash device that the target's build
+// populates.  A device must hold every populated area in full: the images
+// and boot loader the build produces, and the areas claimed by flash_owner
+// settings.  The images must already have been created.
+func (t *TargetBuilder) FlashRequirements() ([]FlashRequirement, error) {
+	cfgResolution, err := t.ExportCfg()
+	if err != nil {
+		return nil, err
+	}
+
+	areas, err := t.populatedAreas(cfgResolution.Cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return flashRequirements(t.bspPkg.FlashMap, areas)
+}
+
+// Calculates the minimum size of each flash device from the populated areas
+// and the size of their contents (see populatedAreas).  An error is returned
+// if a populated area is missing from the flash map.
+func flashRequirements(flashMap flash.FlashMap,
+	areas map[string]int) ([]FlashRequirement, error) {
+
+	remaining := make(map[string]bool, len(areas))
+	for name, _ := range areas {
+		remaining[name] = true
+	}
+
+	devReqs := map[int]*FlashRequirement{}
+	for _, area := range flashMap.SortedAreas() {
+		contentSize, ok := areas[area.Name]
+		if !ok {
+			continue
+		}
+		delete(remaining, area.Name)
+
+		req := devReqs[area.Device]
+		if req == nil {
+			req = &FlashRequirement{
+				Device:   area.Device,
+				Capacity: flashMap.Capacity(area.Device),
+			}
+			devReqs[area.Device] = req
+		}
+
+		req.Areas = append(req.Areas, area.Name)
+		req.MinSize = util.IntMax(req.MinSize, area.Offset+area.Size)
+		if contentSize > 0 {
+			req.ContentEnd = util.IntMax(req.ContentEnd,
+				area.Offset+contentSize)
+		}
+	}
+
+	// Any remaining areas are missing from the flash map.
+	if len(remaining) > 0 {
+		missing := make([]string, 0, len(remaining))
+		for name, _ := range remaining {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+
+		return nil, util.FmtNewtError(
+			"Cannot determine flash footprint; BSP flash map does not "+
+				"contain %s", strings.Join(missing, ", "))
+	}
+
+	reqs := []FlashRequirement{}
+	for _, req := range devReqs {
+		reqs = append(reqs, *req)
+	}
+	sort.Sort(flashRequirementSorter{reqs})
+
+	return reqs, nil
+}
@@ -0,0 +1,157 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+)
+
+// A BSP flash map spanning an internal flash with a known capacity and an
+// external flash without one.
+var testFlashSizeMap = map[string]interface{}{
+	"devices": map[string]interface{}{
+		"0": map[string]interface{}{"capacity": "512kB"},
+	},
+	"areas": map[string]interface{}{
+		flash.FLASH_AREA_NAME_BOOTLOADER: map[string]interface{}{
+			"device": "0", "offset": "0x00000000", "size": "16kB",
+		},
+		flash.FLASH_AREA_NAME_IMAGE_0: map[string]interface{}{
+			"device": "0", "offset": "0x00008000", "size": "232kB",
+		},
+		flash.FLASH_AREA_NAME_IMAGE_1: map[string]interface{}{
+			"device": "0", "offset": "0x00042000", "size": "232kB",
+		},
+		flash.FLASH_AREA_NAME_IMAGE_SCRATCH: map[string]interface{}{
+			"device": "0", "offset": "0x0007c000", "size": "4kB",
+		},
+		"FLASH_AREA_LOGS": map[string]interface{}{
+			"user_id": "0", "device": "1", "offset": "0x00000000",
+			"size": "64kB",
+		},
+		"FLASH_AREA_NFFS": map[string]interface{}{
+			"user_id": "1", "device": "1", "offset": "0x00010000",
+			"size": "64kB",
+		},
+	},
+}
+
+func TestFlashRequirements(t *testing.T) {
+	flashMap, err := flash.Read(testFlashSizeMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		areas   map[string]int
+		reqs    []FlashRequirement
+		errText string
+	}{
+		{
+			name: "boot loader and app",
+			areas: map[string]int{
+				flash.FLASH_AREA_NAME_BOOTLOADER: 12000,
+				flash.FLASH_AREA_NAME_IMAGE_0:    100000,
+			},
+			reqs: []FlashRequirement{
+				{
+					Device: 0,
+					Areas: []string{
+						flash.FLASH_AREA_NAME_BOOTLOADER,
+						flash.FLASH_AREA_NAME_IMAGE_0,
+					},
+					ContentEnd: 0x8000 + 100000,
+					MinSize:    0x8000 + 232*1024,
+					Capacity:   512 * 1024,
+				},
+			},
+		},
+		{
+			name: "split image and flash owner",
+			areas: map[string]int{
+				flash.FLASH_AREA_NAME_IMAGE_0: 20000,
+				flash.FLASH_AREA_NAME_IMAGE_1: 150000,
+				"FLASH_AREA_NFFS":             0,
+			},
+			reqs: []FlashRequirement{
+				{
+					Device: 0,
+					Areas: []string{
+						flash.FLASH_AREA_NAME_IMAGE_0,
+						flash.FLASH_AREA_NAME_IMAGE_1,
+					},
+					ContentEnd: 0x42000 + 150000,
+					MinSize:    0x42000 + 232*1024,
+					Capacity:   512 * 1024,
+				},
+				{
+					Device:     1,
+					Areas:      []string{"FLASH_AREA_NFFS"},
+					ContentEnd: 0,
+					MinSize:    0x10000 + 64*1024,
+					Capacity:   0,
+				},
+			},
+		},
+		{
+			name: "area missing from flash map",
+			areas: map[string]int{
+				flash.FLASH_AREA_NAME_IMAGE_0: 20000,
+				"FLASH_AREA_REBOOT_LOG":       0,
+				"FLASH_AREA_CONFIG":           0,
+			},
+			errText: "BSP flash map does not contain FLASH_AREA_CONFIG, " +
+				"FLASH_AREA_REBOOT_LOG",
+		},
+	}
+
+	for _, test := range tests {
+		numAreas := len(test.areas)
+
+		reqs, err := flashRequirements(flashMap, test.areas)
+		if len(test.areas) != numAreas {
+			t.Errorf("%s: populated areas modified", test.name)
+		}
+
+		if test.errText != "" {
+			if err == nil {
+				t.Errorf("%s: expected error; none reported", test.name)
+			} else if !strings.Contains(err.Error(), test.errText) {
+				t.Errorf("%s: error \"%s\" does not contain \"%s\"",
+					test.name, err.Error(), test.errText)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(reqs, test.reqs) {
+			t.Errorf("%s: wrong requirements:\nwant=%+v\nhave=%+v",
+				test.name, test.reqs, reqs)
+		}
+	}
+}
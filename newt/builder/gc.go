@@ -0,0 +1,197 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Subdirectories that identify a build output directory: "generated" is
+// present in every target's output; "sections" in every manufacturing
+// image's output.
+var buildDirMarkers = []string{
+	"generated",
+	"sections",
+}
+
+// Summarizes a single build output directory (one target or manufacturing
+// image).
+type BuildDirInfo struct {
+	Path string
+
+	// The most recent modification time of any file in the directory.
+	ModTime time.Time
+
+	// Total size, in bytes, of all files in the directory.
+	Size int64
+}
+
+type buildDirSorter struct {
+	infos []BuildDirInfo
+}
+
+func (s buildDirSorter) Len() int {
+	return len(s.infos)
+}
+func (s buildDirSorter) Swap(i, j int) {
+	s.infos[i], s.infos[j] = s.infos[j], s.infos[i]
+}
+func (s buildDirSorter) Less(i, j int) bool {
+	return s.infos[i].Path < s.infos[j].Path
+}
+
+func isBuildDir(path string) bool {
+	for _, marker := range buildDirMarkers {
+		info, err := os.Stat(path + "/" + marker)
+		if err == nil && info.IsDir() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func buildDirInfo(path string) (BuildDirInfo, error) {
+	bdi := BuildDirInfo{Path: path}
+
+	err := filepath.Walk(path,
+		func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if info.ModTime().After(bdi.ModTime) {
+				bdi.ModTime = info.ModTime()
+			}
+			if !info.IsDir() {
+				bdi.Size += info.Size()
+			}
+			return nil
+		})
+	if err != nil {
+		return bdi, util.ChildNewtError(err)
+	}
+
+	return bdi, nil
+}
+
+// Finds every build output directory beneath the specified root.  The
+// results are sorted by path.
+func FindBuildDirs(root string) ([]BuildDirInfo, error) {
+	infos := []BuildDirInfo{}
+
+	if util.NodeNotExist(root) {
+		return infos, nil
+	}
+
+	err := filepath.Walk(root,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !info.IsDir() || path == root || !isBuildDir(path) {
+				return nil
+			}
+
+			bdi, err := buildDirInfo(path)
+			if err != nil {
+				return err
+			}
+			infos = append(infos, bdi)
+
+			// Build directories are not nested.
+			return filepath.SkipDir
+		})
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	sort.Sort(buildDirSorter{infos})
+	return infos, nil
+}
+
+// Finds the build output directories beneath the project's bin directory
+// that have not been modified within the specified duration.
+func StaleBuildDirs(age time.Duration, now time.Time) ([]BuildDirInfo, error) {
+	return staleBuildDirs(BinRoot(), age, now)
+}
+
+func staleBuildDirs(root string, age time.Duration, now time.Time) (
+	[]BuildDirInfo, error) {
+
+	infos, err := FindBuildDirs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	stale := []BuildDirInfo{}
+	for _, bdi := range infos {
+		if now.Sub(bdi.ModTime) > age {
+			stale = append(stale, bdi)
+		}
+	}
+
+	return stale, nil
+}
+
+// Deletes a build output directory.  An error is returned if the directory
+// is not located within the project's bin directory.
+func RemoveBuildDir(path string) error {
+	return removeBuildDir(BinRoot(), path)
+}
+
+func removeBuildDir(root string, path string) error {
+	if !InBinDir(root, path) {
+		return util.FmtNewtError(
+			"Refusing to delete %s; path is outside the build tree (%s)",
+			path, root)
+	}
+
+	if err := os.RemoveAll(path); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Parses an age string.  In addition to the units accepted by
+// time.ParseDuration, a "d" suffix indicates a number of days.
+func ParseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err == nil && days >= 0 {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return d, nil
+	}
+
+	return 0, util.FmtNewtError(
+		"Invalid age \"%s\"; must be a duration (e.g., 36h) or a number "+
+			"of days (e.g., 30d)", s)
+}
@@ -0,0 +1,185 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Creates a build directory containing a marker subdirectory and one file of
+// the specified size, and backdates everything in it to mtime.
+func writeTestBuildDir(t *testing.T, path string, marker string, size int,
+	mtime time.Time) {
+
+	if err := os.MkdirAll(filepath.Join(path, marker), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(path, marker, "out.bin"),
+		make([]byte, size), 0644); err != nil {
+
+		t.Fatal(err)
+	}
+
+	err := filepath.Walk(path,
+		func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Chtimes(p, mtime, mtime)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaleBuildDirs(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	dir, err := ioutil.TempDir("", "newt-gc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "bin")
+	dirs := []struct {
+		name   string
+		marker string
+		size   int
+		age    time.Duration
+	}{
+		{"targets/old", "generated", 100, 72 * time.Hour},
+		{"targets/recent", "generated", 200, time.Hour},
+		{"mfgs/old_mfg", "sections", 300, 30 * 24 * time.Hour},
+		{"targets/not_output", "misc", 400, 72 * time.Hour},
+	}
+	for _, d := range dirs {
+		writeTestBuildDir(t, filepath.Join(root, d.name), d.marker, d.size,
+			now.Add(-d.age))
+	}
+
+	// A recently modified file anywhere in a directory keeps it fresh.
+	writeTestBuildDir(t, filepath.Join(root, "targets/touched"), "generated",
+		10, now.Add(-72*time.Hour))
+	if err := os.Chtimes(
+		filepath.Join(root, "targets/touched/generated/out.bin"),
+		now, now); err != nil {
+
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		age       time.Duration
+		wantPaths []string
+		wantSize  int64
+	}{
+		{48 * time.Hour, []string{"mfgs/old_mfg", "targets/old"}, 400},
+		{10 * 24 * time.Hour, []string{"mfgs/old_mfg"}, 300},
+		{0, []string{"mfgs/old_mfg", "targets/old", "targets/recent"}, 600},
+	}
+
+	for _, test := range tests {
+		stale, err := staleBuildDirs(root, test.age, now)
+		if err != nil {
+			t.Fatalf("age=%s: %v", test.age, err)
+		}
+
+		paths := []string{}
+		var size int64
+		for _, bdi := range stale {
+			rel, _ := filepath.Rel(root, bdi.Path)
+			paths = append(paths, rel)
+			size += bdi.Size
+		}
+
+		if strings.Join(paths, ",") != strings.Join(test.wantPaths, ",") {
+			t.Errorf("age=%s: stale=%v; want %v", test.age, paths,
+				test.wantPaths)
+		}
+		if size != test.wantSize {
+			t.Errorf("age=%s: reclaimable=%d; want %d", test.age, size,
+				test.wantSize)
+		}
+	}
+
+	// Collect the stale directories; everything else remains.
+	stale, err := staleBuildDirs(root, 48*time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bdi := range stale {
+		if err := removeBuildDir(root, bdi.Path); err != nil {
+			t.Errorf("remove %s: %v", bdi.Path, err)
+		}
+	}
+
+	for _, name := range []string{"targets/old", "mfgs/old_mfg"} {
+		if _, err := os.Stat(filepath.Join(root, name)); !os.IsNotExist(err) {
+			t.Errorf("%s not collected", name)
+		}
+	}
+	for _, name := range []string{
+		"targets/recent", "targets/touched", "targets/not_output",
+	} {
+		if _, err := os.Stat(filepath.Join(root, name)); err != nil {
+			t.Errorf("%s collected: %v", name, err)
+		}
+	}
+}
+
+func TestRemoveBuildDirOutsideBin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-gc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "bin")
+	for _, name := range []string{"bin/targets/blinky", "src", "bin_old"} {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []string{
+		root,
+		dir,
+		filepath.Join(dir, "src"),
+		filepath.Join(dir, "bin_old"),
+		filepath.Join(root, "..", "src"),
+	}
+
+	for _, path := range tests {
+		err := removeBuildDir(root, path)
+		if err == nil {
+			t.Errorf("%s: expected error", path)
+		} else if !strings.Contains(err.Error(), "outside the build tree") {
+			t.Errorf("%s: unexpected error: %v", path, err)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s: deleted", path)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/resolve"
+	"mynewt.apache.org/newt/newt/toolchain"
+	"mynewt.apache.org/newt/util"
+)
+
+// A source file that does not compile when only its package's declared
+// include paths are available.
+type IsolationFailure struct {
+	Pkg    string
+	File   string
+	Output string
+}
+
+// Calculates the include paths exported by the specified package and its
+// direct dependencies.  Unlike recursiveIncludePaths, the headers of indirect
+// dependencies are not included.
+func (bpkg *BuildPackage) directIncludePaths(b *Builder) ([]string, error) {
+	bspPkg := b.targetBuilder.bspPkg
+	incls := bpkg.publicIncludeDirs(bspPkg)
+
+	for _, dep := range bpkg.Deps() {
+		if dep.Name == "" {
+			break
+		}
+
+		p := project.GetProject().ResolveDependency(dep)
+		if p == nil {
+			return nil, util.FmtNewtError("Cannot resolve dependency %+v", dep)
+		}
+		dpkg := p.(*pkg.LocalPackage)
+
+		dbpkg := b.PkgMap[dpkg]
+		if dbpkg == nil {
+			if resolve.PkgExcluded(dpkg,
+				b.targetBuilder.target.ExcludedPkgs()) {
+
+				continue
+			}
+			return nil, util.FmtNewtError(
+				"Package not found %s; required by %s",
+				dpkg.Name(), bpkg.Name())
+		}
+
+		incls = append(incls, dbpkg.publicIncludeDirs(bspPkg)...)
+	}
+
+	return incls, nil
+}
+
+// Creates a compiler for the specified package that only searches the
+// package's declared include paths.  The include paths that the target, app,
+// and BSP would otherwise contribute to every package are omitted.
+func (b *Builder) isolatedCompiler(bpkg *BuildPackage) (
+	*toolchain.Compiler, *toolchain.CompilerInfo, error) {
+
+	c, err := b.targetBuilder.NewCompiler(b.PkgBinDir(bpkg))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	baseCi := *b.compilerInfo
+	baseCi.Includes = nil
+	c.AddInfo(&baseCi)
+
+	ci, err := bpkg.CompilerInfo(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	incls, err := bpkg.directIncludePaths(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	isoCi := *ci
+	isoCi.Includes = append(bpkg.privateIncludeDirs(b), incls...)
+	c.AddInfo(&isoCi)
+
+	return c, ci, nil
+}
+
+func isolationSrcType(path string) (int, bool) {
+	switch filepath.Ext(path) {
+	case ".c":
+		return toolchain.COMPILER_TYPE_C, true
+	case ".cc", ".cpp", ".cxx":
+		return toolchain.COMPILER_TYPE_CPP, true
+	default:
+		return 0, false
+	}
+}
+
+// Collects the C and C++ files beneath a source directory, honoring the
+// package's ignore settings.  If skipArch is true, "arch" directories are not
+// descended into.
+func collectIsolationSrcs(dir string, skipArch bool,
+	ci *toolchain.CompilerInfo) ([]string, error) {
+
+	srcs := []string{}
+	if util.NodeNotExist(dir) {
+		return srcs, nil
+	}
+
+	err := filepath.Walk(dir,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			name := info.Name()
+			if info.IsDir() {
+				if path == dir {
+					return nil
+				}
+				if skipArch && name == "arch" {
+					return filepath.SkipDir
+				}
+				for _, re := range ci.IgnoreDirs {
+					if re.MatchString(name) {
+						return filepath.SkipDir
+					}
+				}
+				return nil
+			}
+
+			if _, ok := isolationSrcType(path); !ok {
+				return nil
+			}
+			for _, re := range ci.IgnoreFiles {
+				if re.MatchString(name) {
+					return nil
+				}
+			}
+			if abs, err := filepath.Abs(path); err == nil {
+				for _, ign := range ci.IgnorePaths {
+					if abs == ign {
+						return nil
+					}
+				}
+			}
+
+			srcs = append(srcs, filepath.ToSlash(path))
+			return nil
+		})
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return srcs, nil
+}
+
+// Lists the C and C++ files that building the specified package compiles.
+func (b *Builder) isolationSrcs(bpkg *BuildPackage,
+	ci *toolchain.CompilerInfo) ([]string, error) {
+
+	srcDirs := []string{}
+	for _, relDir := range bpkg.SourceDirectories {
+		srcDirs = append(srcDirs, bpkg.BasePath()+"/"+relDir)
+	}
+	if len(srcDirs) == 0 {
+		srcDirs = append(srcDirs, bpkg.BasePath()+"/src")
+	}
+
+	arch := b.targetBuilder.bspPkg.Arch
+	srcs := []string{}
+	for _, dir := range srcDirs {
+		dirSrcs, err := collectIsolationSrcs(dir, true, ci)
+		if err != nil {
+			return nil, err
+		}
+		srcs = append(srcs, dirSrcs...)
+
+		archSrcs, err := collectIsolationSrcs(dir+"/arch/"+arch, false, ci)
+		if err != nil {
+			return nil, err
+		}
+		srcs = append(srcs, archSrcs...)
+	}
+
+	return srcs, nil
+}
+
+// Compiles each of the builder's source files with only its package's
+// declared include paths: the package's own directories and those exported by
+// its direct dependencies.  A file that fails probably relies on a header
+// exported by an indirect dependency.  No object files are produced.
+func (b *Builder) CheckIsolation() ([]IsolationFailure, error) {
+	failures := []IsolationFailure{}
+
+	for _, bpkg := range b.sortedBuildPackages() {
+		// Generated code is not written against any package's includes.
+		if bpkg.Type() == pkg.PACKAGE_TYPE_GENERATED {
+			continue
+		}
+
+		c, ci, err := b.isolatedCompiler(bpkg)
+		if err != nil {
+			return nil, err
+		}
+
+		srcs, err := b.isolationSrcs(bpkg, ci)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, src := range srcs {
+			util.StatusMessage(util.VERBOSITY_VERBOSE, "Checking %s\n", src)
+
+			typ, _ := isolationSrcType(src)
+			if err := c.CheckFile(src, typ); err != nil {
+				failures = append(failures, IsolationFailure{
+					Pkg:    bpkg.FullName(),
+					File:   src,
+					Output: strings.TrimSpace(err.Error()),
+				})
+			}
+		}
+	}
+
+	return failures, nil
+}
+
+// Checks that each of the target's source files compiles with only its
+// package's declared include paths (see Builder.CheckIsolation).  The result
+// maps each build name ("app" or "loader") to its failures.
+func (t *TargetBuilder) CheckIsolation() (
+	map[string][]IsolationFailure, error) {
+
+	if err := t.PrepBuild(); err != nil {
+		return nil, err
+	}
+
+	builders := []*Builder{t.AppBuilder}
+	if t.LoaderBuilder != nil {
+		builders = append(builders, t.LoaderBuilder)
+	}
+
+	failureMap := map[string][]IsolationFailure{}
+	for _, b := range builders {
+		if err := t.reloadBsp(b); err != nil {
+			return nil, err
+		}
+
+		failures, err := b.CheckIsolation()
+		if err != nil {
+			return nil, err
+		}
+		failureMap[b.buildName] = failures
+	}
+
+	return failureMap, nil
+}
@@ -0,0 +1,130 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/toolchain"
+)
+
+func TestCollectIsolationSrcs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-isolation-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := []string{
+		"src/a.c",
+		"src/b.cpp",
+		"src/c.h",
+		"src/d.s",
+		"src/sub/e.cc",
+		"src/arch/cortex_m4/f.c",
+		"src/test/g.c",
+		"src/h_skip.c",
+		"src/i.c",
+	}
+	for _, name := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	absI, err := filepath.Abs(filepath.Join(dir, "src/i.c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ci := toolchain.NewCompilerInfo()
+	ci.IgnoreDirs = []*regexp.Regexp{regexp.MustCompile("^test$")}
+	ci.IgnoreFiles = []*regexp.Regexp{regexp.MustCompile("_skip\\.c$")}
+	ci.IgnorePaths = []string{absI}
+
+	tests := []struct {
+		name     string
+		dir      string
+		skipArch bool
+		want     []string
+	}{
+		{
+			name:     "skip arch",
+			dir:      "src",
+			skipArch: true,
+			want:     []string{"src/a.c", "src/b.cpp", "src/sub/e.cc"},
+		},
+		{
+			name:     "include arch",
+			dir:      "src",
+			skipArch: false,
+			want: []string{
+				"src/a.c",
+				"src/arch/cortex_m4/f.c",
+				"src/b.cpp",
+				"src/sub/e.cc",
+			},
+		},
+		{
+			name: "arch dir",
+			dir:  "src/arch/cortex_m4",
+			want: []string{"src/arch/cortex_m4/f.c"},
+		},
+		{
+			name: "missing dir",
+			dir:  "src/arch/mips",
+			want: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		srcs, err := collectIsolationSrcs(filepath.Join(dir, test.dir),
+			test.skipArch, ci)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+
+		got := []string{}
+		for _, src := range srcs {
+			rel, err := filepath.Rel(dir, src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, filepath.ToSlash(rel))
+		}
+		sort.Strings(got)
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: collectIsolationSrcs() = %v; want %v", test.name,
+				got, test.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/syscfg"
+	"mynewt.apache.org/newt/util"
+)
+
+// A BSP may provide a linker script template (bsp.linkerscript_template)
+// rather than a static script.  The template contains placeholders of the
+// following forms:
+//
+//     ${ORIGIN:<flash-area>}      Offset of the flash area
+//     ${LENGTH:<flash-area>}      Size of the flash area
+//     ${SYSCFG:<setting>}         Value of the syscfg setting
+//
+// For example:
+//
+//     MEMORY
+//     {
+//       FLASH (rx) : ORIGIN = ${ORIGIN:FLASH_AREA_IMAGE_0}, LENGTH = ${LENGTH:FLASH_AREA_IMAGE_0}
+//       RAM (rwx) : ORIGIN = ${SYSCFG:RAM_ORIGIN}, LENGTH = ${SYSCFG:RAM_SIZE}
+//     }
+//
+// The generated script replaces the BSP's bsp.linkerscript setting; it must
+// contain exactly one MEMORY command.
+
+var ldTemplateRe = regexp.MustCompile(`\$\{(ORIGIN|LENGTH|SYSCFG):(\w+)\}`)
+
+// Substitutes flash map and syscfg values for the placeholders in a linker
+// script template.  Every placeholder must refer to an existing flash area or
+// setting.
+func expandLinkerTemplate(tmpl []byte, flashMap flash.FlashMap,
+	settings map[string]syscfg.CfgEntry) ([]byte, error) {
+
+	var firstErr error
+	out := ldTemplateRe.ReplaceAllFunc(tmpl, func(ph []byte) []byte {
+		m := ldTemplateRe.FindSubmatch(ph)
+		kind := string(m[1])
+		name := string(m[2])
+
+		if kind == "SYSCFG" {
+			entry, ok := settings[name]
+			if !ok {
+				if firstErr == nil {
+					firstErr = util.FmtNewtError(
+						"linker script template refers to undefined syscfg "+
+							"setting \"%s\"", name)
+				}
+				return ph
+			}
+			return []byte(entry.Value)
+		}
+
+		area, ok := flashMap.Areas[name]
+		if !ok {
+			if firstErr == nil {
+				firstErr = util.FmtNewtError(
+					"linker script template refers to undefined flash area "+
+						"\"%s\"", name)
+			}
+			return ph
+		}
+
+		if kind == "ORIGIN" {
+			return []byte(fmt.Sprintf("0x%08x", area.Offset))
+		} else {
+			return []byte(fmt.Sprintf("0x%x", area.Size))
+		}
+	})
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if _, err := flash.ParseSingleLinkerMemory(out); err != nil {
+		return nil, util.PreNewtError(err, "Generated linker script")
+	}
+
+	return out, nil
+}
+
+// Path of the linker script generated from the BSP's template.  A ".tmpl"
+// suffix is removed from the template's file name.
+func (t *TargetBuilder) linkerScriptPath() string {
+	name := strings.TrimSuffix(
+		filepath.Base(t.bspPkg.LinkerScriptTemplate), ".tmpl")
+	return GeneratedBinDir(t.target.Name()) + "/" + name
+}
+
+// Generates the target's linker script from the BSP's template, if the BSP
+// specifies one, and links with it instead of the BSP's static scripts.  The
+// script is only rewritten if its contents change; this prevents needless
+// relinking.
+func (t *TargetBuilder) generateLinkerScript(cfg syscfg.Cfg) error {
+	tmplPath := t.bspPkg.LinkerScriptTemplate
+	if tmplPath == "" {
+		return nil
+	}
+
+	tmpl, err := ioutil.ReadFile(tmplPath)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	script, err := expandLinkerTemplate(tmpl, t.bspPkg.FlashMap, cfg.Settings)
+	if err != nil {
+		return util.PreNewtError(err, "BSP \"%s\"", t.bspPkg.Name())
+	}
+
+	path := t.linkerScriptPath()
+	t.bspPkg.LinkerScripts = []string{path}
+
+	writeReqd, err := util.FileContentsChanged(path, script)
+	if err != nil {
+		return err
+	}
+	if !writeReqd {
+		log.Debugf("Linker script unchanged; not writing %s", path)
+		return nil
+	}
+
+	log.Debugf("Writing linker script generated from %s to %s",
+		tmplPath, path)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return util.ChildNewtError(err)
+	}
+	if err := ioutil.WriteFile(path, script, 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Reloads the BSP's settings with the features of the specified build.  The
+// BSP's linker scripts are reset by the reload, so a templated script is
+// regenerated.
+func (t *TargetBuilder) reloadBsp(b *Builder) error {
+	if err := t.bspPkg.Reload(b.cfg.Features()); err != nil {
+		return err
+	}
+
+	return t.generateLinkerScript(b.cfg)
+}
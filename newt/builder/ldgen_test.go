@@ -0,0 +1,112 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/syscfg"
+)
+
+func TestExpandLinkerTemplate(t *testing.T) {
+	fm, err := flash.NewFlashMap([]flash.FlashArea{
+		{
+			Name:   flash.FLASH_AREA_NAME_IMAGE_0,
+			Id:     1,
+			Offset: 0xc000,
+			Size:   0x32000,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := map[string]syscfg.CfgEntry{
+		"RAM_ORIGIN": {Name: "RAM_ORIGIN", Value: "0x20000000"},
+		"RAM_SIZE":   {Name: "RAM_SIZE", Value: "64K"},
+	}
+
+	const memory = "MEMORY\n{\n" +
+		"  FLASH (rx) : ORIGIN = ${ORIGIN:FLASH_AREA_IMAGE_0}, " +
+		"LENGTH = ${LENGTH:FLASH_AREA_IMAGE_0}\n" +
+		"  RAM (rwx) : ORIGIN = ${SYSCFG:RAM_ORIGIN}, " +
+		"LENGTH = ${SYSCFG:RAM_SIZE}\n" +
+		"}\n"
+
+	tests := []struct {
+		name    string
+		tmpl    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "flash areas and settings",
+			tmpl: memory,
+			want: []string{
+				"ORIGIN = 0x0000c000, LENGTH = 0x32000",
+				"ORIGIN = 0x20000000, LENGTH = 64K",
+			},
+		},
+		{
+			name: "undefined flash area",
+			tmpl: strings.Replace(memory, "LENGTH:FLASH_AREA_IMAGE_0",
+				"LENGTH:FLASH_AREA_IMAGE_1", 1),
+			wantErr: "undefined flash area \"FLASH_AREA_IMAGE_1\"",
+		},
+		{
+			name: "undefined setting",
+			tmpl: strings.Replace(memory, "SYSCFG:RAM_SIZE",
+				"SYSCFG:RAM_LEN", 1),
+			wantErr: "undefined syscfg setting \"RAM_LEN\"",
+		},
+		{
+			name:    "no memory command",
+			tmpl:    "SECTIONS { }",
+			wantErr: "exactly one MEMORY command",
+		},
+	}
+
+	for _, test := range tests {
+		out, err := expandLinkerTemplate([]byte(test.tmpl), fm, settings)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: expected error containing %q; got %v",
+					test.name, test.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+		for _, want := range test.want {
+			if !strings.Contains(string(out), want) {
+				t.Errorf("%s: output missing %q; got:\n%s",
+					test.name, want, out)
+			}
+		}
+		if strings.Contains(string(out), "${") {
+			t.Errorf("%s: unexpanded placeholder in output:\n%s",
+				test.name, out)
+		}
+	}
+}
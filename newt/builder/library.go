@@ -26,9 +26,12 @@ package builder
 
 import (
 	"bytes"
+	"fmt"
+	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"mynewt.apache.org/newt/newt/symbol"
 	"mynewt.apache.org/newt/util"
@@ -217,3 +220,96 @@ func (b *Builder) CopySymbols(sm *symbol.SymbolMap) error {
 
 	return err
 }
+
+// Parses the app's link map and reports the weak symbols that are overridden
+// by a strong definition in another package.  The map is only produced when
+// the compiler.ld.mapfile setting is enabled.
+func (b *Builder) WeakOverrides() ([]symbol.WeakOverride, error) {
+	mapFile := b.AppElfPath() + ".map"
+	f, err := os.Open(mapFile)
+	if err != nil {
+		return nil, util.FmtNewtError(
+			"Failed to read link map (is compiler.ld.mapfile enabled?): %s",
+			err.Error())
+	}
+	defer f.Close()
+
+	overrides, err := symbol.ParseMapWeakOverrides(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// The map identifies definitions by archive; report them by package.
+	archivePkgs := map[string]string{}
+	for _, bpkg := range b.sortedBuildPackages() {
+		archivePkgs[filepath.Clean(b.ArchivePath(bpkg))] = bpkg.Name()
+	}
+	pkgName := func(archive string) string {
+		if name, ok := archivePkgs[filepath.Clean(archive)]; ok {
+			return name
+		}
+		return archive
+	}
+
+	for i, _ := range overrides {
+		overrides[i].Weak.Bpkg = pkgName(overrides[i].Weak.Bpkg)
+		overrides[i].Strong.Bpkg = pkgName(overrides[i].Strong.Bpkg)
+	}
+
+	return overrides, nil
+}
+
+// Parses each package archive in the build and reports the global symbols
+// that are strongly defined by more than one package.  Packages which don't
+// produce an archive are ignored.
+func (b *Builder) DuplicateSymbols() []symbol.DuplicateSymbol {
+	sms := []*symbol.SymbolMap{}
+	for _, bpkg := range b.sortedBuildPackages() {
+		err, sm := b.ParseObjectLibrary(bpkg)
+		if err == nil {
+			sms = append(sms, sm)
+		}
+	}
+
+	return symbol.DuplicateSymbols(sms)
+}
+
+// Describes a set of duplicate symbol definitions, one symbol per line.
+func DuplicateSymbolsText(buildName string,
+	dups []symbol.DuplicateSymbol) string {
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "Duplicate symbol definitions (%s):\n", buildName)
+	for _, dup := range dups {
+		strongPkgs := make([]string, len(dup.Strong))
+		for i, info := range dup.Strong {
+			strongPkgs[i] = info.Bpkg
+		}
+		fmt.Fprintf(buf, "    * %s: defined by %s", dup.Name,
+			strings.Join(strongPkgs, ", "))
+
+		if len(dup.Weak) > 0 {
+			weakPkgs := make([]string, len(dup.Weak))
+			for i, info := range dup.Weak {
+				weakPkgs[i] = info.Bpkg
+			}
+			fmt.Fprintf(buf, " (weak in %s)", strings.Join(weakPkgs, ", "))
+		}
+		buf.WriteString("\n")
+	}
+
+	return buf.String()
+}
+
+// Fails if any global symbol is strongly defined by more than one package.
+// This catches would-be "multiple definition" link errors and names the
+// offending packages.
+func (b *Builder) checkDuplicateSymbols() error {
+	dups := b.DuplicateSymbols()
+	if len(dups) == 0 {
+		return nil
+	}
+
+	return util.NewNewtError(
+		strings.TrimSpace(DuplicateSymbolsText(b.buildName, dups)))
+}
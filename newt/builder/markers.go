@@ -0,0 +1,134 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// An occurrence of a forbidden marker in a generated file.
+type MarkerHit struct {
+	Path   string
+	Line   int
+	Marker string
+}
+
+func (hit MarkerHit) String() string {
+	return fmt.Sprintf("%s:%d: %s", hit.Path, hit.Line, hit.Marker)
+}
+
+func scanFileMarkers(path string, markers []string) ([]MarkerHit, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+	defer f.Close()
+
+	hits := []MarkerHit{}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		for _, marker := range markers {
+			if strings.Contains(scanner.Text(), marker) {
+				hits = append(hits, MarkerHit{path, lineNum, marker})
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return hits, nil
+}
+
+// Searches the C source and header files beneath the specified directories
+// for any of the markers.  Nonexistent directories are skipped.
+func ScanMarkers(dirs []string, markers []string) ([]MarkerHit, error) {
+	hits := []MarkerHit{}
+	if len(markers) == 0 {
+		return hits, nil
+	}
+
+	for _, dir := range dirs {
+		if util.NodeNotExist(dir) {
+			continue
+		}
+
+		err := filepath.Walk(dir,
+			func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+
+				ext := filepath.Ext(path)
+				if info.IsDir() || (ext != ".h" && ext != ".c") {
+					return nil
+				}
+
+				fileHits, err := scanFileMarkers(path, markers)
+				if err != nil {
+					return err
+				}
+				hits = append(hits, fileHits...)
+				return nil
+			})
+		if err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+	}
+
+	return hits, nil
+}
+
+// Checks the target's generated syscfg, sysinit, and flash map files for the
+// markers listed in target.forbidden_markers.  Any occurrence is an error.
+func (t *TargetBuilder) CheckGeneratedMarkers() error {
+	markers := t.target.ForbiddenMarkers()
+	if len(markers) == 0 {
+		return nil
+	}
+
+	hits, err := ScanMarkers([]string{
+		GeneratedIncludeDir(t.target.Name()),
+		GeneratedSrcDir(t.target.Name()),
+	}, markers)
+	if err != nil {
+		return err
+	}
+
+	if len(hits) == 0 {
+		return nil
+	}
+
+	str := "Forbidden markers (target.forbidden_markers) found in " +
+		"generated files:\n"
+	for _, hit := range hits {
+		str += "    " + hit.String() + "\n"
+	}
+
+	return util.NewNewtError(strings.TrimSpace(str))
+}
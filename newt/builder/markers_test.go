@@ -0,0 +1,154 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/newt/target"
+)
+
+// Generated files of the test target, relative to its generated directory.
+var testGeneratedFiles = map[string]string{
+	"include/syscfg/syscfg.h": "#ifndef H_MYNEWT_SYSCFG_\n" +
+		"#define H_MYNEWT_SYSCFG_\n" +
+		"/* TODO: fill in */\n" +
+		"#define MYNEWT_VAL_OS_MAIN_STACK_SIZE (768)\n" +
+		"#endif\n",
+	"include/sysflash/sysflash.h": "#define FLASH_AREA_BOOTLOADER 0\n",
+	"src/sim-sysinit-app.c": "void sysinit_app(void)\n" +
+		"{\n" +
+		"    /* FIXME */ os_pkg_init(); /* XXX TODO */\n" +
+		"}\n",
+	"src/notes.txt": "TODO: not a C file\n",
+}
+
+func TestCheckGeneratedMarkers(t *testing.T) {
+	defer interfaces.SetProject(interfaces.GetProject())
+
+	dir, err := ioutil.TempDir("", "newt-markers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "project.yml"),
+		[]byte("project.name: test\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := project.InitProject(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer project.ResetProject()
+
+	lpkg := pkg.NewLocalPackage(&repo.Repo{},
+		filepath.Join(dir, "targets", "sim"))
+	lpkg.SetName("targets/sim")
+	tgt := target.NewTarget(lpkg)
+
+	genDir := GeneratedBaseDir(tgt.Name())
+	for name, contents := range testGeneratedFiles {
+		path := filepath.Join(genDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		markers string
+		hits    []string
+	}{
+		{
+			markers: "",
+			hits:    nil,
+		},
+		{
+			markers: "PLACEHOLDER",
+			hits:    nil,
+		},
+		{
+			markers: "TODO",
+			hits: []string{
+				"include/syscfg/syscfg.h:3: TODO",
+				"src/sim-sysinit-app.c:3: TODO",
+			},
+		},
+		{
+			markers: "FIXME TODO",
+			hits: []string{
+				"include/syscfg/syscfg.h:3: TODO",
+				"src/sim-sysinit-app.c:3: FIXME",
+				"src/sim-sysinit-app.c:3: TODO",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		tgt.Vars["target.forbidden_markers"] = test.markers
+		tb := &TargetBuilder{target: tgt}
+
+		err := tb.CheckGeneratedMarkers()
+		if test.hits == nil {
+			if err != nil {
+				t.Errorf("markers=\"%s\": unexpected error: %s",
+					test.markers, err.Error())
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Errorf("markers=\"%s\": expected error; none reported",
+				test.markers)
+			continue
+		}
+
+		lines := strings.Split(err.Error(), "\n")
+		if !strings.HasPrefix(lines[0], "Forbidden markers") {
+			t.Errorf("markers=\"%s\": wrong error: %s",
+				test.markers, err.Error())
+		}
+
+		hits := []string{}
+		for _, line := range lines[1:] {
+			rel, err := filepath.Rel(genDir, strings.TrimSpace(line))
+			if err != nil {
+				t.Fatal(err)
+			}
+			hits = append(hits, rel)
+		}
+
+		if strings.Join(hits, "\n") != strings.Join(test.hits, "\n") {
+			t.Errorf("markers=\"%s\": wrong hits:\nwant=%v\nhave=%v",
+				test.markers, test.hits, hits)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/image"
+	"mynewt.apache.org/newt/newt/target"
+)
+
+// Writes an image file of the specified size to the given directory.
+func writeTestImage(t *testing.T, dir string, name string,
+	size int) *image.Image {
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatalf("failed to write image: %s", err.Error())
+	}
+
+	return &image.Image{TargetImg: path}
+}
+
+func TestCheckMaxImageSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maximg")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	appImg := writeTestImage(t, dir, "app.img", 2048)
+	loaderImg := writeTestImage(t, dir, "loader.img", 512)
+
+	tests := []struct {
+		name      string
+		maxSize   string
+		loaderImg *image.Image
+		errText   string
+	}{
+		{
+			name:    "no limit",
+			maxSize: "",
+		},
+		{
+			name:    "within limit",
+			maxSize: "4096",
+		},
+		{
+			name:    "exactly at limit",
+			maxSize: "2048",
+		},
+		{
+			name:    "hex limit",
+			maxSize: "0x1000",
+		},
+		{
+			name:    "app over limit",
+			maxSize: "2000",
+			errText: "exceeds target.max_image_size by 48 bytes; " +
+				"size=2048 max=2000",
+		},
+		{
+			name:      "loader over limit",
+			maxSize:   "256",
+			loaderImg: loaderImg,
+			errText:   "loader.img exceeds target.max_image_size by 256",
+		},
+		{
+			name:    "invalid limit",
+			maxSize: "big",
+			errText: "Invalid target.max_image_size \"big\"",
+		},
+		{
+			name:    "zero limit",
+			maxSize: "0",
+			errText: "must be a positive integer",
+		},
+	}
+
+	for _, test := range tests {
+		tgt := &target.Target{
+			Vars: map[string]string{
+				"target.max_image_size": test.maxSize,
+			},
+		}
+		tb := &TargetBuilder{target: tgt}
+
+		err := tb.checkMaxImageSize(appImg, test.loaderImg)
+		if test.errText == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s",
+					test.name, err.Error())
+			}
+		} else if err == nil {
+			t.Errorf("%s: expected error; none reported", test.name)
+		} else if !strings.Contains(err.Error(), test.errText) {
+			t.Errorf("%s: error \"%s\" does not contain \"%s\"",
+				test.name, err.Error(), test.errText)
+		}
+	}
+}
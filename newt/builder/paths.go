@@ -21,6 +21,7 @@ package builder
 
 import (
 	"path/filepath"
+	"strings"
 
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
@@ -33,6 +34,20 @@ func BinRoot() string {
 	return project.GetProject().Path() + "/bin"
 }
 
+// Indicates whether a path is located within the specified bin directory.
+// The bin directory itself is not considered to be within it.  Build output
+// is only ever deleted from such paths.
+func InBinDir(binRoot string, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(binRoot), filepath.Clean(path))
+	if err != nil || rel == "." || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+
+		return false
+	}
+
+	return true
+}
+
 func TargetBinDir(targetName string) string {
 	return BinRoot() + "/" + targetName
 }
@@ -132,6 +147,11 @@ func (b *Builder) AppImgPath() string {
 		".img"
 }
 
+func (b *Builder) AppUf2Path() string {
+	return b.PkgBinDir(b.appPkg) + "/" + filepath.Base(b.appPkg.Name()) +
+		".uf2"
+}
+
 func (b *Builder) AppBinPath() string {
 	return b.AppElfPath() + ".bin"
 }
@@ -0,0 +1,51 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"testing"
+)
+
+func TestInBinDir(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/proj/bin/targets/blinky", true},
+		{"/proj/bin/targets/blinky/", true},
+		{"/proj/bin/x", true},
+		{"/proj/bin/..x", true},
+		{"/proj/bin", false},
+		{"/proj/bin/", false},
+		{"/proj/bin/.", false},
+		{"/proj", false},
+		{"/proj/bin/..", false},
+		{"/proj/bin/../targets/blinky", false},
+		{"/proj/bin2/targets/blinky", false},
+		{"/other/bin/targets/blinky", false},
+		{"proj/bin/targets/blinky", false},
+	}
+
+	for _, test := range tests {
+		if got := InBinDir("/proj/bin", test.path); got != test.want {
+			t.Errorf("InBinDir(%s)=%v; want %v", test.path, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/toolchain"
+	"mynewt.apache.org/newt/util"
+)
+
+// If set, this environment variable names the pkg-config executable to run.
+const PKG_CONFIG_ENV = "PKG_CONFIG"
+
+const PKG_CONFIG_DEFAULT = "pkg-config"
+
+// pkg-config libraries only apply to host builds; i.e., targets whose BSP
+// has this architecture.
+const PKG_CONFIG_ARCH = "sim"
+
+func pkgConfigTool() string {
+	if tool := os.Getenv(PKG_CONFIG_ENV); tool != "" {
+		return tool
+	}
+
+	return PKG_CONFIG_DEFAULT
+}
+
+// Runs pkg-config with the specified option for a single library and splits
+// its output into individual flags.
+func runPkgConfig(lib string, opt string) ([]string, error) {
+	tool := pkgConfigTool()
+
+	log.Debugf("%s %s %s", tool, opt, lib)
+	o, err := exec.Command(tool, opt, lib).CombinedOutput()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return nil, util.FmtNewtError(
+				"Failed to run %s; is pkg-config installed? %s",
+				tool, err.Error())
+		}
+		return nil, util.FmtNewtError(
+			"pkg-config library \"%s\" not found: %s",
+			lib, strings.TrimSpace(string(o)))
+	}
+
+	return strings.Fields(string(o)), nil
+}
+
+// Resolves the package's pkg-config libraries (pkg.pkg_config) into compiler
+// and linker flags.  The libraries are ignored unless the target is a host
+// build.
+func (bpkg *BuildPackage) loadPkgConfig(b *Builder) error {
+	features := b.cfg.FeaturesForLpkg(bpkg.LocalPackage)
+	libs := newtutil.GetStringSliceFeatures(bpkg.PkgV, features,
+		"pkg.pkg_config")
+
+	bpkg.PkgConfigCflags = []string{}
+	bpkg.PkgConfigLflags = []string{}
+	if len(libs) == 0 {
+		return nil
+	}
+
+	if b.targetBuilder.bspPkg.Arch != PKG_CONFIG_ARCH {
+		log.Debugf("Ignoring pkg-config libraries of package %s; "+
+			"not a host build", bpkg.Name())
+		return nil
+	}
+
+	for _, lib := range libs {
+		cflags, err := runPkgConfig(lib, "--cflags")
+		if err != nil {
+			return util.PreNewtError(err, "Package %s", bpkg.Name())
+		}
+		lflags, err := runPkgConfig(lib, "--libs")
+		if err != nil {
+			return util.PreNewtError(err, "Package %s", bpkg.Name())
+		}
+
+		bpkg.PkgConfigCflags = append(bpkg.PkgConfigCflags, cflags...)
+		bpkg.PkgConfigLflags = append(bpkg.PkgConfigLflags, lflags...)
+	}
+
+	return nil
+}
+
+// Collects the linker flags of every package's pkg-config libraries.
+func (b *Builder) pkgConfigLinkInfo() *toolchain.CompilerInfo {
+	ci := toolchain.NewCompilerInfo()
+	for _, bpkg := range b.sortedBuildPackages() {
+		ci.Lflags = append(ci.Lflags, bpkg.PkgConfigLflags...)
+	}
+
+	return ci
+}
@@ -0,0 +1,241 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/newt/syscfg"
+	"mynewt.apache.org/newt/newt/toolchain"
+	"mynewt.apache.org/newt/util"
+)
+
+// Stands in for pkg-config; knows about two libraries.
+const testPkgConfigScript = `#!/bin/sh
+case "$2" in
+libusb-1.0)
+    case "$1" in
+    --cflags) echo "-I/usr/include/libusb-1.0" ;;
+    --libs) echo "-lusb-1.0" ;;
+    esac
+    ;;
+sdl2)
+    case "$1" in
+    --cflags) echo "-I/usr/include/SDL2 -D_REENTRANT" ;;
+    --libs) echo "-L/usr/lib/sdl -lSDL2" ;;
+    esac
+    ;;
+*)
+    echo "Package $2 was not found in the pkg-config search path." >&2
+    exit 1
+    ;;
+esac
+`
+
+// Creates a builder for the specified architecture containing one package
+// per entry in pkgLibs; each package uses the listed pkg-config libraries.
+func testPkgConfigBuilder(t *testing.T, dir string, arch string,
+	pkgLibs map[string][]string) *Builder {
+
+	b := &Builder{
+		PkgMap: map[*pkg.LocalPackage]*BuildPackage{},
+		cfg:    syscfg.NewCfg(),
+		targetBuilder: &TargetBuilder{
+			bspPkg: &pkg.BspPackage{Arch: arch},
+		},
+	}
+
+	for name, libs := range pkgLibs {
+		yml := "pkg.name: " + name + "\npkg.pkg_config:\n"
+		for _, lib := range libs {
+			yml += "    - " + lib + "\n"
+		}
+
+		pkgDir := filepath.Join(dir, arch, name)
+		if err := os.MkdirAll(pkgDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		err := ioutil.WriteFile(filepath.Join(pkgDir, "pkg.yml"),
+			[]byte(yml), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lpkg, err := pkg.LoadLocalPackage(&repo.Repo{}, pkgDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.PkgMap[lpkg] = NewBuildPackage(lpkg)
+	}
+
+	return b
+}
+
+func TestPkgConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-pkgconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "pkg-config")
+	err = ioutil.WriteFile(script, []byte(testPkgConfigScript), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Setenv(PKG_CONFIG_ENV, os.Getenv(PKG_CONFIG_ENV))
+	os.Setenv(PKG_CONFIG_ENV, script)
+
+	pkgLibs := map[string][]string{
+		"hw/sim_usb":  []string{"libusb-1.0"},
+		"apps/sim_ui": []string{"sdl2", "libusb-1.0"},
+	}
+
+	tests := []struct {
+		arch   string
+		cflags map[string][]string
+		lflags []string
+	}{
+		{
+			arch: PKG_CONFIG_ARCH,
+			cflags: map[string][]string{
+				"hw/sim_usb": []string{"-I/usr/include/libusb-1.0"},
+				"apps/sim_ui": []string{
+					"-I/usr/include/SDL2",
+					"-D_REENTRANT",
+					"-I/usr/include/libusb-1.0",
+				},
+			},
+			lflags: []string{"-L/usr/lib/sdl", "-lSDL2", "-lusb-1.0"},
+		},
+		{
+			arch:   "cortex_m4",
+			cflags: map[string][]string{},
+			lflags: nil,
+		},
+	}
+
+	for _, test := range tests {
+		b := testPkgConfigBuilder(t, dir, test.arch, pkgLibs)
+
+		for _, bpkg := range b.sortedBuildPackages() {
+			if err := bpkg.loadPkgConfig(b); err != nil {
+				t.Fatalf("%s: %s: %s", test.arch, bpkg.Name(), err.Error())
+			}
+
+			ci, err := bpkg.CompilerInfo(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c := &toolchain.Compiler{}
+			c.AddInfo(ci)
+			cmd, err := c.CompileFileCmd("main.c", toolchain.COMPILER_TYPE_C)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			exp := test.cflags[bpkg.Name()]
+			for _, flag := range exp {
+				if !strings.Contains(cmd, " "+flag+" ") {
+					t.Errorf("%s: %s: compile command lacks \"%s\": %s",
+						test.arch, bpkg.Name(), flag, cmd)
+				}
+			}
+			if len(exp) == 0 && strings.Contains(cmd, "/usr/include") {
+				t.Errorf("%s: %s: unexpected pkg-config flags: %s",
+					test.arch, bpkg.Name(), cmd)
+			}
+		}
+
+		c := &toolchain.Compiler{}
+		c.AddInfo(b.pkgConfigLinkInfo())
+		cmd := c.LinkCmd("sim_ui.elf", []string{"main.o"}, nil, "")
+
+		for _, flag := range test.lflags {
+			if !strings.Contains(cmd+" ", " "+flag+" ") {
+				t.Errorf("%s: link command lacks \"%s\": %s",
+					test.arch, flag, cmd)
+			}
+		}
+		if len(test.lflags) == 0 && strings.Contains(cmd, "-l") {
+			t.Errorf("%s: unexpected pkg-config flags: %s", test.arch, cmd)
+		}
+	}
+}
+
+func TestPkgConfigErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-pkgconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "pkg-config")
+	err = ioutil.WriteFile(script, []byte(testPkgConfigScript), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Setenv(PKG_CONFIG_ENV, os.Getenv(PKG_CONFIG_ENV))
+
+	tests := []struct {
+		tool    string
+		lib     string
+		errText string
+	}{
+		{
+			tool: script,
+			lib:  "gtk+-3.0",
+			errText: "Package hw/sim_gui; pkg-config library \"gtk+-3.0\" " +
+				"not found: Package gtk+-3.0 was not found",
+		},
+		{
+			tool:    filepath.Join(dir, "no-such-tool"),
+			lib:     "sdl2",
+			errText: "is pkg-config installed?",
+		},
+	}
+
+	for _, test := range tests {
+		os.Setenv(PKG_CONFIG_ENV, test.tool)
+
+		b := testPkgConfigBuilder(t, dir, PKG_CONFIG_ARCH,
+			map[string][]string{"hw/sim_gui": []string{test.lib}})
+		bpkg := b.sortedBuildPackages()[0]
+
+		err := bpkg.loadPkgConfig(b)
+		if err == nil {
+			t.Errorf("%s: expected error; none reported", test.lib)
+		} else if !strings.Contains(err.(*util.NewtError).Text,
+			test.errText) {
+
+			t.Errorf("%s: error \"%s\" does not contain \"%s\"",
+				test.lib, err.Error(), test.errText)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/syscfg"
+	"mynewt.apache.org/newt/util"
+)
+
+// A reference to a flash area by a package.
+type PkgFlashRef struct {
+	Area string
+
+	// Either "syscfg <setting-name>" or "<file>:<line>", with the file path
+	// relative to the package directory.
+	Source string
+
+	// Whether the area exists in the target's flash map.
+	Known bool
+}
+
+type pkgFlashRefSorter struct {
+	refs []PkgFlashRef
+}
+
+func (s pkgFlashRefSorter) Len() int {
+	return len(s.refs)
+}
+func (s pkgFlashRefSorter) Swap(i, j int) {
+	s.refs[i], s.refs[j] = s.refs[j], s.refs[i]
+}
+func (s pkgFlashRefSorter) Less(i, j int) bool {
+	if s.refs[i].Area != s.refs[j].Area {
+		return s.refs[i].Area < s.refs[j].Area
+	}
+	return s.refs[i].Source < s.refs[j].Source
+}
+
+var flashAreaIdentRe = regexp.MustCompile(
+	`\b` + flash.FLASH_AREA_NAME_PREFIX + `[A-Za-z0-9_]+\b`)
+
+func isFlashSrcFile(path string) bool {
+	switch filepath.Ext(path) {
+	case ".c", ".h", ".cpp", ".cc", ".hpp", ".s", ".S":
+		return true
+	default:
+		return false
+	}
+}
+
+// Indicates whether a setting's resolved value names a flash area.
+func settingNamesFlashArea(entry syscfg.CfgEntry) bool {
+	if entry.Value == "" {
+		return false
+	}
+
+	return entry.SettingType == syscfg.CFG_SETTING_TYPE_FLASH_OWNER ||
+		strings.HasPrefix(entry.Value, flash.FLASH_AREA_NAME_PREFIX)
+}
+
+// Finds the syscfg settings that the package defines or overrides whose
+// resolved values name a flash area.
+func pkgSyscfgFlashRefs(cfg syscfg.Cfg, lpkg *pkg.LocalPackage,
+	flashMap flash.FlashMap) []PkgFlashRef {
+
+	refs := []PkgFlashRef{}
+	for _, entry := range cfg.Settings {
+		if !settingNamesFlashArea(entry) {
+			continue
+		}
+
+		for _, point := range entry.History {
+			if point.Source != nil &&
+				point.Source.FullName() == lpkg.FullName() {
+
+				_, known := flashMap.Areas[entry.Value]
+				refs = append(refs, PkgFlashRef{
+					Area:   entry.Value,
+					Source: "syscfg " + entry.Name,
+					Known:  known,
+				})
+				break
+			}
+		}
+	}
+
+	return refs
+}
+
+// Finds the flash area identifiers in the package's source files.  Only
+// identifiers that name an area in the flash map are reported; others (e.g.,
+// FLASH_AREA_COUNT) are not areas.  Nested packages and hidden entries are
+// skipped.  Each area is reported at most once per file, at its first
+// occurrence.
+func pkgSrcFlashRefs(lpkg *pkg.LocalPackage,
+	flashMap flash.FlashMap) ([]PkgFlashRef, error) {
+
+	base := lpkg.BasePath()
+	refs := []PkgFlashRef{}
+
+	err := filepath.Walk(base,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			name := info.Name()
+			if path != base && strings.HasPrefix(name, ".") {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() {
+				if path != base && util.NodeExist(
+					filepath.Join(path, pkg.PACKAGE_FILE_NAME)) {
+
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !isFlashSrcFile(path) {
+				return nil
+			}
+
+			relPath, err := filepath.Rel(base, path)
+			if err != nil {
+				return err
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			seen := map[string]bool{}
+			scanner := bufio.NewScanner(f)
+			for lineNum := 1; scanner.Scan(); lineNum++ {
+				for _, ident := range flashAreaIdentRe.FindAllString(
+					scanner.Text(), -1) {
+
+					if _, ok := flashMap.Areas[ident]; !ok || seen[ident] {
+						continue
+					}
+					seen[ident] = true
+					refs = append(refs, PkgFlashRef{
+						Area: ident,
+						Source: fmt.Sprintf("%s:%d",
+							filepath.ToSlash(relPath), lineNum),
+						Known: true,
+					})
+				}
+			}
+
+			return scanner.Err()
+		})
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return refs, nil
+}
+
+// Lists the flash areas that a package references, either through syscfg
+// settings it defines or overrides, or by name in its source files.  Setting
+// values are resolved for the target.
+func (t *TargetBuilder) PkgFlashRefs(lpkg *pkg.LocalPackage) (
+	[]PkgFlashRef, error) {
+
+	cfgResolution, err := t.ExportCfg()
+	if err != nil {
+		return nil, err
+	}
+
+	return pkgFlashRefs(cfgResolution.Cfg, lpkg, t.bspPkg.FlashMap)
+}
+
+// Lists the flash areas that a package references, given the target's
+// resolved configuration and flash map.  The result is sorted by area name,
+// then by source.
+func pkgFlashRefs(cfg syscfg.Cfg, lpkg *pkg.LocalPackage,
+	flashMap flash.FlashMap) ([]PkgFlashRef, error) {
+
+	refs := pkgSyscfgFlashRefs(cfg, lpkg, flashMap)
+
+	srcRefs, err := pkgSrcFlashRefs(lpkg, flashMap)
+	if err != nil {
+		return nil, err
+	}
+	refs = append(refs, srcRefs...)
+
+	sort.Sort(pkgFlashRefSorter{refs})
+	return refs, nil
+}
+
+// Lists the flash areas that the target's resolved syscfg settings name,
+// regardless of which package defines each setting.
+func (t *TargetBuilder) SyscfgFlashRefs() ([]PkgFlashRef, error) {
+	cfgResolution, err := t.ExportCfg()
+	if err != nil {
+		return nil, err
+	}
+
+	flashMap := t.bspPkg.FlashMap
+
+	refs := []PkgFlashRef{}
+	for _, entry := range cfgResolution.Cfg.Settings {
+		if settingNamesFlashArea(entry) {
+			_, known := flashMap.Areas[entry.Value]
+			refs = append(refs, PkgFlashRef{
+				Area:   entry.Value,
+				Source: "syscfg " + entry.Name,
+				Known:  known,
+			})
+		}
+	}
+
+	sort.Sort(pkgFlashRefSorter{refs})
+	return refs, nil
+}
@@ -0,0 +1,194 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/newt/syscfg"
+)
+
+func TestSettingNamesFlashArea(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry syscfg.CfgEntry
+		want  bool
+	}{
+		{
+			name: "flash owner",
+			entry: syscfg.CfgEntry{
+				Value:       "FLASH_AREA_NFFS",
+				SettingType: syscfg.CFG_SETTING_TYPE_FLASH_OWNER,
+			},
+			want: true,
+		},
+		{
+			name: "flash owner without prefix",
+			entry: syscfg.CfgEntry{
+				Value:       "LOG_AREA",
+				SettingType: syscfg.CFG_SETTING_TYPE_FLASH_OWNER,
+			},
+			want: true,
+		},
+		{
+			name:  "raw setting with area name",
+			entry: syscfg.CfgEntry{Value: "FLASH_AREA_REBOOT_LOG"},
+			want:  true,
+		},
+		{
+			name:  "raw setting",
+			entry: syscfg.CfgEntry{Value: "1"},
+			want:  false,
+		},
+		{
+			name: "empty flash owner",
+			entry: syscfg.CfgEntry{
+				SettingType: syscfg.CFG_SETTING_TYPE_FLASH_OWNER,
+			},
+			want: false,
+		},
+	}
+
+	for _, test := range tests {
+		if got := settingNamesFlashArea(test.entry); got != test.want {
+			t.Errorf("%s: got %t; want %t", test.name, got, test.want)
+		}
+	}
+}
+
+// Source files of the package whose flash references are listed.  The nested
+// package and the hidden directory are not part of it.
+var testPkgFlashFiles = map[string]string{
+	"pkg.yml": "pkg.name: sys/reboot\n",
+	"src/reboot.c": "#include \"sysflash/sysflash.h\"\n" +
+		"\n" +
+		"static int reboot_areas = FLASH_AREA_COUNT;\n" +
+		"\n" +
+		"int reboot_init(void) { return FLASH_AREA_REBOOT_LOG; }\n" +
+		"int reboot_erase(void) { return FLASH_AREA_REBOOT_LOG; }\n",
+	"include/reboot/reboot.h": "#ifndef H_REBOOT_\n" +
+		"#define H_REBOOT_\n" +
+		"#define REBOOT_IMG_AREA FLASH_AREA_IMAGE_1\n" +
+		"#endif\n",
+	"src/README.md":     "Uses FLASH_AREA_IMAGE_0.\n",
+	"test/pkg.yml":      "pkg.name: sys/reboot/test\n",
+	"test/src/test.c":   "int a = FLASH_AREA_NFFS;\n",
+	".hidden/scratch.c": "int b = FLASH_AREA_NFFS;\n",
+}
+
+func TestPkgFlashRefs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-pkgflash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, contents := range testPkgFlashFiles {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lpkg := pkg.NewLocalPackage(&repo.Repo{}, dir)
+	lpkg.SetName("sys/reboot")
+	other := pkg.NewLocalPackage(&repo.Repo{}, filepath.Join(dir, "other"))
+	other.SetName("sys/log")
+
+	flashMap, err := flash.Read(map[string]interface{}{
+		"areas": map[string]interface{}{
+			flash.FLASH_AREA_NAME_IMAGE_0: map[string]interface{}{
+				"device": "0", "offset": "0x8000", "size": "128kB",
+			},
+			flash.FLASH_AREA_NAME_IMAGE_1: map[string]interface{}{
+				"device": "0", "offset": "0x28000", "size": "128kB",
+			},
+			"FLASH_AREA_REBOOT_LOG": map[string]interface{}{
+				"user_id": "0", "device": "0", "offset": "0x48000",
+				"size": "16kB",
+			},
+			"FLASH_AREA_NFFS": map[string]interface{}{
+				"user_id": "1", "device": "0", "offset": "0x4c000",
+				"size": "32kB",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := syscfg.NewCfg()
+	cfg.Settings["REBOOT_LOG_FLASH_AREA"] = syscfg.CfgEntry{
+		Name:        "REBOOT_LOG_FLASH_AREA",
+		Value:       "FLASH_AREA_REBOOT_LOG",
+		SettingType: syscfg.CFG_SETTING_TYPE_FLASH_OWNER,
+		History: []syscfg.CfgPoint{
+			{Value: "FLASH_AREA_REBOOT_LOG", Source: lpkg},
+		},
+	}
+	cfg.Settings["REBOOT_SPARE_AREA"] = syscfg.CfgEntry{
+		Name:  "REBOOT_SPARE_AREA",
+		Value: "FLASH_AREA_REBOOT_SPARE",
+		History: []syscfg.CfgPoint{
+			{Value: "", Source: other},
+			{Value: "FLASH_AREA_REBOOT_SPARE", Source: lpkg},
+		},
+	}
+	cfg.Settings["LOG_FCB_FLASH_AREA"] = syscfg.CfgEntry{
+		Name:        "LOG_FCB_FLASH_AREA",
+		Value:       "FLASH_AREA_NFFS",
+		SettingType: syscfg.CFG_SETTING_TYPE_FLASH_OWNER,
+		History: []syscfg.CfgPoint{
+			{Value: "FLASH_AREA_NFFS", Source: other},
+		},
+	}
+	cfg.Settings["REBOOT_LOG_ENTRIES"] = syscfg.CfgEntry{
+		Name:  "REBOOT_LOG_ENTRIES",
+		Value: "10",
+		History: []syscfg.CfgPoint{
+			{Value: "10", Source: lpkg},
+		},
+	}
+
+	refs, err := pkgFlashRefs(cfg, lpkg, flashMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []PkgFlashRef{
+		{flash.FLASH_AREA_NAME_IMAGE_1, "include/reboot/reboot.h:3", true},
+		{"FLASH_AREA_REBOOT_LOG", "src/reboot.c:5", true},
+		{"FLASH_AREA_REBOOT_LOG", "syscfg REBOOT_LOG_FLASH_AREA", true},
+		{"FLASH_AREA_REBOOT_SPARE", "syscfg REBOOT_SPARE_AREA", false},
+	}
+	if !reflect.DeepEqual(refs, exp) {
+		t.Errorf("wrong flash references:\nwant=%+v\nhave=%+v", exp, refs)
+	}
+}
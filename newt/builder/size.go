@@ -28,6 +28,7 @@ import (
 	"strconv"
 	"strings"
 
+	"mynewt.apache.org/newt/newt/symbol"
 	"mynewt.apache.org/newt/util"
 )
 
@@ -375,3 +376,120 @@ func (b *Builder) Size() error {
 
 	return nil
 }
+
+// The size of a single function in a linked image.  Pkg names the package
+// whose archive defines the function; if several packages define a local
+// function of the same name, each is listed.
+type FuncSize struct {
+	Name string
+	Pkg  string
+	Size int
+}
+
+type FuncSizeSorter []FuncSize
+
+func (s FuncSizeSorter) Len() int {
+	return len(s)
+}
+func (s FuncSizeSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s FuncSizeSorter) Less(i, j int) bool {
+	if s[i].Size != s[j].Size {
+		return s[i].Size > s[j].Size
+	}
+	return s[i].Name < s[j].Name
+}
+
+// Selects the n largest functions from an elf symbol map.  Each function is
+// attributed to the packages whose symbol maps define it.  Data symbols are
+// ignored.  If n is 0, all functions are returned.
+func largestFunctions(elfSyms *symbol.SymbolMap,
+	pkgSyms []*symbol.SymbolMap, n int) []FuncSize {
+
+	owners := map[string][]string{}
+	for _, sm := range pkgSyms {
+		for name, si := range *sm {
+			if si.IsFunction() {
+				owners[name] = append(owners[name], si.Bpkg)
+			}
+		}
+	}
+
+	funcs := []FuncSize{}
+	for name, si := range *elfSyms {
+		if !si.IsFunction() {
+			continue
+		}
+
+		pkgs := owners[name]
+		sort.Strings(pkgs)
+		pkg := strings.Join(pkgs, ",")
+		if pkg == "" {
+			pkg = "?"
+		}
+
+		funcs = append(funcs, FuncSize{
+			Name: name,
+			Pkg:  pkg,
+			Size: si.Size,
+		})
+	}
+	sort.Sort(FuncSizeSorter(funcs))
+
+	if n > 0 && len(funcs) > n {
+		funcs = funcs[:n]
+	}
+
+	return funcs
+}
+
+// Reports the n largest functions in the builder's linked app.  The app must
+// already have been built.
+func (b *Builder) LargestFunctions(n int) ([]FuncSize, error) {
+	err, elfSyms := b.ParseObjectElf(b.AppElfPath())
+	if err != nil {
+		return nil, err
+	}
+
+	pkgSyms := []*symbol.SymbolMap{}
+	for _, bpkg := range b.sortedBuildPackages() {
+		err, sm := b.ParseObjectLibrary(bpkg)
+		if err == nil {
+			pkgSyms = append(pkgSyms, sm)
+		}
+	}
+
+	return largestFunctions(elfSyms, pkgSyms, n), nil
+}
+
+func printFuncSizes(funcs []FuncSize) {
+	fmt.Printf("%8s %-32s %s\n", "size", "package", "function")
+	for _, f := range funcs {
+		fmt.Printf("%8d %-32s %s\n", f.Size, f.Pkg, f.Name)
+	}
+}
+
+// Prints the n largest functions of each image in the target.
+func (t *TargetBuilder) SizeFuncs(n int) error {
+	if err := t.PrepBuild(); err != nil {
+		return err
+	}
+
+	builders := []*Builder{t.AppBuilder}
+	if t.LoaderBuilder != nil {
+		builders = append(builders, t.LoaderBuilder)
+	}
+
+	for _, b := range builders {
+		funcs, err := b.LargestFunctions(n)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Largest functions in image: %s\n", b.buildName)
+		printFuncSizes(funcs)
+	}
+
+	return nil
+}
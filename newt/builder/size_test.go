@@ -0,0 +1,100 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"reflect"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/symbol"
+)
+
+// Objdump symbol table flags for global and local functions and objects.
+const (
+	testCodeGlobalFunc = "g     F"
+	testCodeLocalFunc  = "l     F"
+	testCodeGlobalData = "g     O"
+)
+
+// Builds a symbol map from a list of (name, flags, size) triples, all
+// belonging to the named package.
+func testSizeSymbols(bpkg string, syms ...interface{}) *symbol.SymbolMap {
+	sm := symbol.NewSymbolMap()
+	for i := 0; i+2 < len(syms); i += 3 {
+		sm.Add(symbol.SymbolInfo{
+			Bpkg: bpkg,
+			Name: syms[i].(string),
+			Code: syms[i+1].(string),
+			Size: syms[i+2].(int),
+		})
+	}
+
+	return sm
+}
+
+func TestLargestFunctions(t *testing.T) {
+	elfSyms := testSizeSymbols("elf",
+		"main", testCodeGlobalFunc, 200,
+		"os_sched", testCodeGlobalFunc, 500,
+		"init", testCodeLocalFunc, 500,
+		"hal_uart_init", testCodeGlobalFunc, 120,
+		"__aeabi_memcpy", testCodeGlobalFunc, 300,
+		"g_log_buf", testCodeGlobalData, 4096,
+	)
+
+	pkgSyms := []*symbol.SymbolMap{
+		testSizeSymbols("apps/blinky",
+			"main", testCodeGlobalFunc, 200),
+		testSizeSymbols("kernel/os",
+			"os_sched", testCodeGlobalFunc, 500,
+			"init", testCodeLocalFunc, 500),
+		testSizeSymbols("hw/hal",
+			"hal_uart_init", testCodeGlobalFunc, 120,
+			"init", testCodeLocalFunc, 500),
+		testSizeSymbols("sys/log",
+			"g_log_buf", testCodeGlobalData, 4096),
+	}
+
+	all := []FuncSize{
+		{"init", "hw/hal,kernel/os", 500},
+		{"os_sched", "kernel/os", 500},
+		{"__aeabi_memcpy", "?", 300},
+		{"main", "apps/blinky", 200},
+		{"hal_uart_init", "hw/hal", 120},
+	}
+
+	tests := []struct {
+		name string
+		n    int
+		want []FuncSize
+	}{
+		{"top three", 3, all[:3]},
+		{"top one", 1, all[:1]},
+		{"all functions", 0, all},
+		{"more than available", 10, all},
+	}
+
+	for _, test := range tests {
+		got := largestFunctions(elfSyms, pkgSyms, test.n)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v; want %+v", test.name, got, test.want)
+		}
+	}
+}
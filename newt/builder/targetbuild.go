@@ -31,8 +31,10 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 
+	"mynewt.apache.org/newt/newt/flash"
 	"mynewt.apache.org/newt/newt/image"
 	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
 	"mynewt.apache.org/newt/newt/resolve"
@@ -59,6 +61,47 @@ type TargetBuilder struct {
 	LoaderList    interfaces.PackageList
 
 	injectedSettings map[string]string
+
+	// Syscfg values specified in the environment or on the command line.
+	syscfgOverrides map[string]string
+
+	// If non-empty, recorded in each generated image's trailer.
+	ImageGitDesc string
+
+	// Offset of the header within each generated image file, and the value
+	// of the bytes preceding it.
+	ImageHeaderOffset int
+	ImageHeaderFill   byte
+
+	// Number of erased bytes reserved after each generated image's trailer.
+	ImageTrailerReserve int
+
+	// If non-zero, the magic written to each generated image's header.
+	ImageMagic uint32
+
+	// If true, a hash of the resolved syscfg is recorded in each generated
+	// image's trailer.
+	ImageCfgHash bool
+
+	// Warn about headers that source files include without using.
+	DetectUnusedIncludes bool
+
+	// If ImageUf2 is true, a UF2 file with the specified family ID is
+	// generated alongside each image.
+	ImageUf2         bool
+	ImageUf2FamilyId uint32
+
+	// If non-zero, images are prepared for detached signing with a
+	// signature TLV of this type rather than being signed by newt.
+	ImageDetachedSigType uint8
+
+	// If true, image creation only reports the digest that would be signed;
+	// no image files are written.
+	ImageDryRunSign bool
+
+	// Fail before linking if a global symbol is strongly defined by more
+	// than one package.
+	CheckDupSymbols bool
 }
 
 func NewTargetTester(target *target.Target,
@@ -72,6 +115,17 @@ func NewTargetTester(target *target.Target,
 	if err != nil {
 		return nil, err
 	}
+	if err := bspPkg.SetBuildProfile(target.BuildProfile); err != nil {
+		return nil, err
+	}
+	if err := checkCoverageTarget(target, bspPkg); err != nil {
+		return nil, err
+	}
+
+	overrides, err := syscfg.Overrides(syscfg.OverrideFlag)
+	if err != nil {
+		return nil, err
+	}
 
 	compilerPkg, err := project.GetProject().ResolvePackage(
 		bspPkg.Repo(), bspPkg.CompilerName)
@@ -87,6 +141,7 @@ func NewTargetTester(target *target.Target,
 		loaderPkg:        target.Loader(),
 		testPkg:          testPkg,
 		injectedSettings: map[string]string{},
+		syscfgOverrides:  overrides,
 	}
 
 	return t, nil
@@ -99,8 +154,16 @@ func NewTargetBuilder(target *target.Target) (*TargetBuilder, error) {
 func (t *TargetBuilder) NewCompiler(dstDir string) (*toolchain.Compiler, error) {
 	c, err := toolchain.NewCompiler(t.compilerPkg.BasePath(), dstDir,
 		t.target.BuildProfile)
+	if err != nil {
+		return nil, err
+	}
 
-	return c, err
+	c.Env, err = t.target.BuildEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
 }
 
 func (t *TargetBuilder) ExportCfg() (resolve.CfgResolution, error) {
@@ -145,11 +208,18 @@ func (t *TargetBuilder) ExportCfg() (resolve.CfgResolution, error) {
 		seeds = append(seeds, t.testPkg)
 	}
 
+	apiPrefs, err := t.target.ApiPrefs()
+	if err != nil {
+		return resolve.CfgResolution{}, err
+	}
+
 	cfgResolution, err := resolve.ResolveCfg(seeds, t.injectedSettings,
-		t.bspPkg.FlashMap)
+		t.syscfgOverrides,
+		t.bspPkg.FlashMap, apiPrefs, t.target.ExcludedPkgs())
 	if err != nil {
 		return cfgResolution, err
 	}
+	cfgResolution.CheckRequiredFeatures(t.target.RequiredFeatures())
 
 	return cfgResolution, nil
 }
@@ -161,6 +231,10 @@ func (t *TargetBuilder) validateAndWriteCfg(
 		return util.NewNewtError(errText)
 	}
 
+	if warnText := cfgResolution.FlagWarningText(); warnText != "" {
+		util.StatusMessage(util.VERBOSITY_QUIET, "Warning: %s", warnText)
+	}
+
 	if err := syscfg.EnsureWritten(cfgResolution.Cfg,
 		GeneratedIncludeDir(t.target.Name())); err != nil {
 
@@ -209,6 +283,72 @@ func (t *TargetBuilder) generateSysinit(
 	return nil
 }
 
+// Calculates the sysinit call order of the target's app and, for split
+// images, its loader.  The loader order is nil for non-split targets.
+func (t *TargetBuilder) SysinitOrder() (
+	appCalls []sysinit.InitCall, loaderCalls []sysinit.InitCall, err error) {
+
+	cfgResolution, err := t.ExportCfg()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if errText := cfgResolution.ErrorText(); errText != "" {
+		return nil, nil, util.NewNewtError(errText)
+	}
+
+	loaderPkgs, appPkgs, err := t.resolvePkgs(cfgResolution)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if loaderPkgs != nil {
+		loaderCalls = sysinit.CallOrder(loaderPkgs)
+	}
+	appCalls = sysinit.CallOrder(appPkgs)
+
+	return appCalls, loaderCalls, nil
+}
+
+// Checks the target's generated sysinit functions against the packages the
+// target resolves to.  The loader problems are nil for non-split targets.
+func (t *TargetBuilder) SysinitCoverage() (
+	appProblems []string, loaderProblems []string, err error) {
+
+	cfgResolution, err := t.ExportCfg()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if errText := cfgResolution.ErrorText(); errText != "" {
+		return nil, nil, util.NewNewtError(errText)
+	}
+
+	loaderPkgs, appPkgs, err := t.resolvePkgs(cfgResolution)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	srcDir := GeneratedSrcDir(t.target.Name())
+	targetName := pkg.ShortName(t.target.Package())
+
+	if loaderPkgs != nil {
+		loaderProblems, err = sysinit.CheckGeneratedCoverage(loaderPkgs,
+			srcDir, targetName, true)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	appProblems, err = sysinit.CheckGeneratedCoverage(appPkgs, srcDir,
+		targetName, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return appProblems, loaderProblems, nil
+}
+
 func (t *TargetBuilder) generateFlashMap() error {
 	return t.bspPkg.FlashMap.EnsureWritten(
 		GeneratedSrcDir(t.target.Name()),
@@ -231,6 +371,8 @@ func (t *TargetBuilder) generateCode(
 }
 
 func (t *TargetBuilder) PrepBuild() error {
+	defer newtutil.StartPhase("resolve")()
+
 	cfgResolution, err := t.ExportCfg()
 	if err != nil {
 		return err
@@ -241,6 +383,14 @@ func (t *TargetBuilder) PrepBuild() error {
 		return util.NewNewtError(flashErrText)
 	}
 
+	flashWarnText := t.bspPkg.FlashMap.WarningText() +
+		t.bspPkg.FlashMap.CapacityErrorText() +
+		t.bspPkg.FlashMap.UndersizedSlotText(image.MinSlotSize(1))
+	if flashWarnText != "" {
+		util.StatusMessage(util.VERBOSITY_QUIET, "Warning: %s",
+			flashWarnText)
+	}
+
 	if err := t.validateAndWriteCfg(cfgResolution); err != nil {
 		return err
 	}
@@ -288,9 +438,71 @@ func (t *TargetBuilder) PrepBuild() error {
 		return err
 	}
 
+	if err := t.CheckGeneratedMarkers(); err != nil {
+		return err
+	}
+
+	if err := t.generateLinkerScript(cfgResolution.Cfg); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// Returns the ordered include path of the target's app.  For split images,
+// the loader's include directories follow those of the app.
+func (t *TargetBuilder) IncludePaths() ([]string, error) {
+	if err := t.PrepBuild(); err != nil {
+		return nil, err
+	}
+
+	paths, err := t.AppBuilder.IncludePaths()
+	if err != nil {
+		return nil, err
+	}
+
+	if t.LoaderBuilder != nil {
+		loaderPaths, err := t.LoaderBuilder.IncludePaths()
+		if err != nil {
+			return nil, err
+		}
+		paths = util.UniqueStrings(append(paths, loaderPaths...))
+	}
+
+	return paths, nil
+}
+
+// Calculates the commands that link the target's elf files.  For split
+// images, the loader's command comes first.  The loader's final link also
+// retains symbols shared with the app; these are only known during a full
+// build and are not included.
+func (t *TargetBuilder) LinkCmds() ([]string, error) {
+	if err := t.PrepBuild(); err != nil {
+		return nil, err
+	}
+
+	if t.LoaderBuilder == nil {
+		cmd, err := t.AppBuilder.LinkCmd(t.bspPkg.LinkerScripts, "")
+		if err != nil {
+			return nil, err
+		}
+		return []string{cmd}, nil
+	}
+
+	loaderCmd, err := t.LoaderBuilder.LinkCmd(t.bspPkg.LinkerScripts, "")
+	if err != nil {
+		return nil, err
+	}
+
+	appCmd, err := t.AppBuilder.LinkCmd(t.bspPkg.Part2LinkerScripts,
+		t.LoaderBuilder.AppLinkerElfPath())
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{loaderCmd, appCmd}, nil
+}
+
 func (t *TargetBuilder) buildLoader() error {
 	/* Link the app as a test (using the normal single image linker script) */
 	if err := t.AppBuilder.TestLink(t.bspPkg.LinkerScripts); err != nil {
@@ -300,7 +512,7 @@ func (t *TargetBuilder) buildLoader() error {
 	/* rebuild the loader */
 	project.ResetDeps(t.LoaderList)
 
-	if err := t.bspPkg.Reload(t.LoaderBuilder.cfg.Features()); err != nil {
+	if err := t.reloadBsp(t.LoaderBuilder); err != nil {
 		return err
 	}
 
@@ -308,6 +520,12 @@ func (t *TargetBuilder) buildLoader() error {
 		return err
 	}
 
+	if t.CheckDupSymbols {
+		if err := t.LoaderBuilder.checkDuplicateSymbols(); err != nil {
+			return err
+		}
+	}
+
 	/* perform a test link of the loader */
 	if err := t.LoaderBuilder.TestLink(t.bspPkg.LinkerScripts); err != nil {
 		return err
@@ -337,6 +555,31 @@ func (t *TargetBuilder) buildLoader() error {
 
 }
 
+// Verifies that the compiler satisfies the BSP's toolchain version
+// requirements, if any.
+func (t *TargetBuilder) checkToolchainVersion() error {
+	if t.bspPkg.ToolchainMinVersion == nil &&
+		t.bspPkg.ToolchainMaxVersion == nil {
+
+		return nil
+	}
+
+	c, err := t.NewCompiler(t.AppBuilder.BinDir())
+	if err != nil {
+		return err
+	}
+
+	if err := c.CheckVersion(t.bspPkg.ToolchainMinVersion,
+		t.bspPkg.ToolchainMaxVersion); err != nil {
+
+		return util.PreNewtError(err,
+			"BSP \"%s\" toolchain requirement not met",
+			t.bspPkg.FullName())
+	}
+
+	return nil
+}
+
 func (t *TargetBuilder) Build() error {
 	if err := t.PrepBuild(); err != nil {
 		return err
@@ -345,7 +588,11 @@ func (t *TargetBuilder) Build() error {
 	/* Build the Apps */
 	project.ResetDeps(t.AppList)
 
-	if err := t.bspPkg.Reload(t.AppBuilder.cfg.Features()); err != nil {
+	if err := t.reloadBsp(t.AppBuilder); err != nil {
+		return err
+	}
+
+	if err := t.checkToolchainVersion(); err != nil {
 		return err
 	}
 
@@ -353,6 +600,12 @@ func (t *TargetBuilder) Build() error {
 		return err
 	}
 
+	if t.CheckDupSymbols {
+		if err := t.AppBuilder.checkDuplicateSymbols(); err != nil {
+			return err
+		}
+	}
+
 	var linkerScripts []string
 	if t.LoaderBuilder == nil {
 		linkerScripts = t.bspPkg.LinkerScripts
@@ -376,6 +629,41 @@ func (t *TargetBuilder) Build() error {
 	return nil
 }
 
+// Compiles the target's packages without linking and reports the global
+// symbols that are strongly defined by more than one package.  The result
+// maps each build name ("app" or "loader") to its duplicates.
+func (t *TargetBuilder) DuplicateSymbols() (
+	map[string][]symbol.DuplicateSymbol, error) {
+
+	if err := t.PrepBuild(); err != nil {
+		return nil, err
+	}
+
+	type buildSet struct {
+		b    *Builder
+		list interfaces.PackageList
+	}
+	sets := []buildSet{{t.AppBuilder, t.AppList}}
+	if t.LoaderBuilder != nil {
+		sets = append(sets, buildSet{t.LoaderBuilder, t.LoaderList})
+	}
+
+	dupMap := map[string][]symbol.DuplicateSymbol{}
+	for _, set := range sets {
+		project.ResetDeps(set.list)
+		if err := t.reloadBsp(set.b); err != nil {
+			return nil, err
+		}
+		if err := set.b.Build(); err != nil {
+			return nil, err
+		}
+
+		dupMap[set.b.buildName] = set.b.DuplicateSymbols()
+	}
+
+	return dupMap, nil
+}
+
 /*
  * This function re-links the loader adding symbols from libraries
  * shared with the app. Returns a list of the common packages shared
@@ -562,7 +850,8 @@ func readManifest(path string) (*image.ImageManifest, error) {
 	manifest := &image.ImageManifest{}
 	if err := json.Unmarshal(content, &manifest); err != nil {
 		return nil, util.FmtNewtError(
-			"Failure decoding manifest with path \"%s\": %s", err.Error())
+			"Failure decoding manifest with path \"%s\": %s", path,
+			err.Error())
 	}
 
 	return manifest, nil
@@ -588,6 +877,25 @@ func (t *TargetBuilder) createManifest() error {
 
 	manifest.Repos = rm.AllRepos()
 
+	for _, area := range t.bspPkg.FlashMap.SortedAreas() {
+		manifest.FlashMap = append(manifest.FlashMap,
+			image.ImageManifestFlashArea{
+				Name:   area.Name,
+				Id:     area.Id,
+				Device: area.Device,
+				Offset: area.Offset,
+				Size:   area.Size,
+			})
+	}
+
+	c, err := t.NewCompiler(t.AppBuilder.BinDir())
+	if err != nil {
+		return err
+	}
+	manifest.NewtVersion = newtutil.NewtVersionStr
+	manifest.CompilerVersion = c.Version()
+	manifest.LinkerVersion = c.LinkerVersion()
+
 	vars := t.GetTarget().Vars
 	keys := make([]string, 0, len(vars))
 	for k := range vars {
@@ -617,6 +925,46 @@ func (t *TargetBuilder) createManifest() error {
 	return nil
 }
 
+// Returns the flash map recorded in the manifest of the target's most recent
+// build.  This is the map the build was linked against, which may differ from
+// the BSP's current one.
+func (t *TargetBuilder) BuiltFlashMap() (flash.FlashMap, error) {
+	if t.appPkg == nil {
+		return flash.FlashMap{}, util.FmtNewtError(
+			"Target %s does not specify an app", t.target.FullName())
+	}
+
+	path := ManifestPath(t.target.Name(), BUILD_NAME_APP, t.appPkg.Name())
+	if util.NodeNotExist(path) {
+		return flash.FlashMap{}, util.FmtNewtError(
+			"Manifest %s does not exist; run \"newt build %s\" first",
+			path, t.target.Name())
+	}
+
+	manifest, err := readManifest(path)
+	if err != nil {
+		return flash.FlashMap{}, err
+	}
+	if len(manifest.FlashMap) == 0 {
+		return flash.FlashMap{}, util.FmtNewtError(
+			"Manifest %s does not record a flash map; rebuild target %s",
+			path, t.target.Name())
+	}
+
+	areas := make([]flash.FlashArea, len(manifest.FlashMap))
+	for i, area := range manifest.FlashMap {
+		areas[i] = flash.FlashArea{
+			Name:   area.Name,
+			Id:     area.Id,
+			Device: area.Device,
+			Offset: area.Offset,
+			Size:   area.Size,
+		}
+	}
+
+	return flash.NewFlashMap(areas)
+}
+
 // Reads an existing manifest file and augments it with image fields:
 //     * Image version
 //     * App image path
@@ -667,10 +1015,59 @@ func (t *TargetBuilder) augmentManifest(
 	return nil
 }
 
+// Ensures the image header fits within an image slot when placed at the
+// configured offset.
+func (t *TargetBuilder) validateImageHeaderOffset() error {
+	if t.ImageHeaderOffset == 0 {
+		return nil
+	}
+	if t.ImageHeaderOffset < 0 {
+		return util.FmtNewtError("Invalid image header offset: %d",
+			t.ImageHeaderOffset)
+	}
+
+	slot, ok := t.bspPkg.FlashMap.Areas[flash.FLASH_AREA_NAME_IMAGE_0]
+	if !ok {
+		return util.FmtNewtError(
+			"Cannot validate image header offset; BSP flash map does not "+
+				"contain %s", flash.FLASH_AREA_NAME_IMAGE_0)
+	}
+
+	if t.ImageHeaderOffset+image.IMAGE_HEADER_SIZE > slot.Size {
+		return util.FmtNewtError(
+			"Image header offset 0x%x outside of image slot; slot-size=0x%x",
+			t.ImageHeaderOffset, slot.Size)
+	}
+
+	return nil
+}
+
 // @return                      app-image, loader-image, error
 func (t *TargetBuilder) CreateImages(version string,
 	keystr string, keyId uint8) (*image.Image, *image.Image, error) {
 
+	errText := t.bspPkg.FlashMap.SectorAlignmentErrorText()
+	if errText != "" {
+		return nil, nil, util.NewNewtError(strings.TrimSpace(errText))
+	}
+
+	if t.bspPkg.ImageSlotAlign >= 0 {
+		errText := t.bspPkg.FlashMap.MisalignedSlotText(
+			t.bspPkg.ImageSlotAlign)
+		if errText != "" {
+			return nil, nil, util.NewNewtError(strings.TrimSpace(errText))
+		}
+	}
+
+	if err := t.validateImageHeaderOffset(); err != nil {
+		return nil, nil, err
+	}
+
+	// Reject an invalid size limit before spending time on the build.
+	if _, err := t.target.MaxImageSize(); err != nil {
+		return nil, nil, err
+	}
+
 	if err := t.Build(); err != nil {
 		return nil, nil, err
 	}
@@ -692,10 +1089,179 @@ func (t *TargetBuilder) CreateImages(version string,
 		return nil, nil, err
 	}
 
+	if t.ImageDryRunSign {
+		return appImg, loaderImg, nil
+	}
+
 	buildId := image.CreateBuildId(appImg, loaderImg)
 	if err := t.augmentManifest(appImg, loaderImg, buildId); err != nil {
 		return nil, nil, err
 	}
 
+	if err := t.checkMaxImageSize(appImg, loaderImg); err != nil {
+		return nil, nil, err
+	}
+
+	loaderImgPath := ""
+	if loaderImg != nil {
+		loaderImgPath = loaderImg.TargetImg
+	}
+	if err := t.CheckImageFit(appImg.TargetImg, loaderImgPath); err != nil {
+		return nil, nil, err
+	}
+
+	if t.ImageUf2 {
+		if err := t.createUf2s(appImg, loaderImg); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	return appImg, loaderImg, nil
 }
+
+// Ensures that no image file exceeds the target's maximum image size
+// (target.max_image_size), if one is specified.
+func (t *TargetBuilder) checkMaxImageSize(appImg *image.Image,
+	loaderImg *image.Image) error {
+
+	maxSize, err := t.target.MaxImageSize()
+	if err != nil || maxSize == 0 {
+		return err
+	}
+
+	for _, img := range []*image.Image{loaderImg, appImg} {
+		if img == nil {
+			continue
+		}
+
+		info, err := os.Stat(img.TargetImg)
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+
+		size := int(info.Size())
+		if size > maxSize {
+			return util.FmtNewtError(
+				"Image %s exceeds target.max_image_size by %d bytes; "+
+					"size=%d max=%d",
+				img.TargetImg, size-maxSize, size, maxSize)
+		}
+
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Image %s size %d is within target.max_image_size (%d); "+
+				"%d bytes remaining\n",
+			img.TargetImg, size, maxSize, maxSize-size)
+	}
+
+	return nil
+}
+
+// Ensures that each image file fits, trailer included, in the slot it runs
+// from: the first slot, or the second for the app half of a split image.  An
+// empty path is skipped.
+func (t *TargetBuilder) CheckImageFit(appImgPath string,
+	loaderImgPath string) error {
+
+	appSlot := flash.FLASH_AREA_NAME_IMAGE_0
+	if loaderImgPath != "" {
+		appSlot = flash.FLASH_AREA_NAME_IMAGE_1
+	}
+
+	for _, pair := range [][2]string{
+		{loaderImgPath, flash.FLASH_AREA_NAME_IMAGE_0},
+		{appImgPath, appSlot},
+	} {
+		imgPath, slotName := pair[0], pair[1]
+		if imgPath == "" {
+			continue
+		}
+
+		slot, ok := t.bspPkg.FlashMap.Areas[slotName]
+		if !ok {
+			return util.FmtNewtError(
+				"Cannot check image size; BSP flash map does not contain %s",
+				slotName)
+		}
+
+		fit, err := image.ReadImageFit(imgPath, t.ImageHeaderOffset)
+		if err != nil {
+			return err
+		}
+		if err := fit.CheckSlot(imgPath, slotName, slot.Size); err != nil {
+			return err
+		}
+
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Image %s fits in %s; header=%d payload=%d trailer=%d "+
+				"reserve=%d, %d bytes remaining\n", imgPath, slotName,
+			fit.HeaderSize, fit.PayloadSize, fit.TrailerSize, fit.ReserveSize,
+			slot.Size-fit.Size())
+	}
+
+	return nil
+}
+
+// Returns the paths of the target's existing image files.  The loader path is
+// empty unless the target is a split image.  An error is returned if an image
+// has not been created.
+func (t *TargetBuilder) ImagePaths() (string, string, error) {
+	targetName := t.target.Name()
+
+	appImgPath := AppImgPath(targetName, BUILD_NAME_APP, t.appPkg.Name())
+	loaderImgPath := ""
+	if t.loaderPkg != nil {
+		loaderImgPath = AppImgPath(targetName, BUILD_NAME_LOADER,
+			t.loaderPkg.Name())
+	}
+
+	for _, path := range []string{appImgPath, loaderImgPath} {
+		if path != "" && util.NodeNotExist(path) {
+			return "", "", util.FmtNewtError(
+				"Image %s does not exist; run \"newt create-image\" first",
+				path)
+		}
+	}
+
+	return appImgPath, loaderImgPath, nil
+}
+
+// Generates a UF2 file for each image.  An image is placed at the start of
+// the slot it runs from: the first slot, or the second for the app half of a
+// split image.
+func (t *TargetBuilder) createUf2s(appImg *image.Image,
+	loaderImg *image.Image) error {
+
+	slotAddr := func(areaName string) (uint32, error) {
+		area, ok := t.bspPkg.FlashMap.Areas[areaName]
+		if !ok {
+			return 0, util.FmtNewtError(
+				"Cannot generate UF2 image; BSP flash map does not "+
+					"contain %s", areaName)
+		}
+		return uint32(area.Offset), nil
+	}
+
+	appSlot := flash.FLASH_AREA_NAME_IMAGE_0
+	if loaderImg != nil {
+		addr, err := slotAddr(flash.FLASH_AREA_NAME_IMAGE_0)
+		if err != nil {
+			return err
+		}
+		if err := image.WriteUf2(loaderImg.TargetImg,
+			t.LoaderBuilder.AppUf2Path(), addr,
+			t.ImageUf2FamilyId); err != nil {
+
+			return err
+		}
+
+		appSlot = flash.FLASH_AREA_NAME_IMAGE_1
+	}
+
+	addr, err := slotAddr(appSlot)
+	if err != nil {
+		return err
+	}
+
+	return image.WriteUf2(appImg.TargetImg, t.AppBuilder.AppUf2Path(), addr,
+		t.ImageUf2FamilyId)
+}
@@ -0,0 +1,118 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/image"
+	"mynewt.apache.org/newt/newt/project"
+)
+
+// Describes the fully resolved definition of the target: its packages,
+// build profile, target settings, syscfg values, flash map, and the commit
+// of each repo that contributes a package to the build.  Unlike a
+// fingerprint, package contents are not included; the definition identifies
+// what is built, not the bytes it is built from.  Two audits describe the
+// same build if their definitions are equal.  Paths within the project are
+// made relative to the project directory.  The items are sorted by key.
+func (t *TargetBuilder) TargetDef() ([]BuildEnvItem, error) {
+	if err := t.PrepBuild(); err != nil {
+		return nil, err
+	}
+
+	return t.targetDef(), nil
+}
+
+// Describes the target's definition; the target must already be prepared for
+// building.
+func (t *TargetBuilder) targetDef() []BuildEnvItem {
+	projBase := project.GetProject().Path() + "/"
+	items := []BuildEnvItem{}
+	add := func(key string, format string, args ...interface{}) {
+		value := fmt.Sprintf(format, args...)
+		items = append(items, BuildEnvItem{
+			Key:   key,
+			Value: strings.Replace(value, projBase, "", -1),
+		})
+	}
+
+	add("target", "%s", t.target.FullName())
+	add("bsp", "%s", t.bspPkg.FullName())
+	if t.appPkg != nil {
+		add("app", "%s", t.appPkg.FullName())
+	}
+	if t.loaderPkg != nil {
+		add("loader", "%s", t.loaderPkg.FullName())
+	}
+	add("build_profile", "%s", t.target.BuildProfile)
+
+	for k, v := range t.target.Vars {
+		add("var:"+k, "%s", v)
+	}
+
+	settings := t.AppBuilder.cfg.Settings
+	for name, entry := range settings {
+		add("syscfg:"+name, "%s", entry.Value)
+	}
+
+	fm := t.bspPkg.FlashMap
+	for _, area := range fm.SortedAreas() {
+		add("flash:"+area.Name, "id=%d device=%d offset=0x%x size=%d",
+			area.Id, area.Device, area.Offset, area.Size)
+	}
+	for _, res := range fm.SortedReserves() {
+		add("flash_reserve:"+res.Name, "device=%d offset=0x%x size=%d",
+			res.Device, res.Offset, res.Size)
+	}
+	for _, dev := range fm.DeviceIds() {
+		add(fmt.Sprintf("flash_device:%d", dev),
+			"erase_val=0x%02x sector_size=%d capacity=%d write_size=%d",
+			fm.EraseVal(dev), fm.SectorSize(dev), fm.Capacity(dev),
+			fm.WriteSize(dev))
+	}
+	if fm.SlotSize != 0 {
+		add("flash_slot_size", "%d", fm.SlotSize)
+	}
+
+	// Each package's repo is recorded as it is in an image manifest.
+	rm := image.NewRepoManager()
+	builders := []*Builder{t.AppBuilder}
+	if t.LoaderBuilder != nil {
+		builders = append(builders, t.LoaderBuilder)
+	}
+	for _, b := range builders {
+		for _, lpkg := range b.sortedLocalPackages() {
+			rm.GetImageManifestPkg(lpkg)
+		}
+	}
+	for _, repo := range rm.AllRepos() {
+		dirty := ""
+		if repo.Dirty {
+			dirty = " dirty"
+		}
+		add("repo:"+repo.Name, "%s%s", repo.Commit, dirty)
+	}
+
+	sort.Sort(buildEnvSorter{items})
+	return items
+}
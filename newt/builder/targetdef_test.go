@@ -0,0 +1,179 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/newt/syscfg"
+	"mynewt.apache.org/newt/newt/target"
+)
+
+func testDefPkg(dir string, name string) *pkg.LocalPackage {
+	lpkg := pkg.NewLocalPackage(&repo.Repo{}, filepath.Join(dir, name))
+	lpkg.SetName(name)
+	return lpkg
+}
+
+// Creates a prepared target builder for a simple blinky target.  Each call
+// returns an identical, independent definition.
+func testDefTargetBuilder(t *testing.T, dir string) *TargetBuilder {
+	tgt := target.NewTarget(testDefPkg(dir, "targets/blinky_nrf52"))
+	tgt.BuildProfile = "optimized"
+	tgt.Vars["target.app"] = "apps/blinky"
+	tgt.Vars["target.bsp"] = "hw/bsp/nrf52dk"
+
+	fm, err := flash.Read(map[string]interface{}{
+		"areas": map[string]interface{}{
+			flash.FLASH_AREA_NAME_BOOTLOADER: map[string]interface{}{
+				"device": "0", "offset": "0x0", "size": "16kB",
+			},
+			flash.FLASH_AREA_NAME_IMAGE_0: map[string]interface{}{
+				"device": "0", "offset": "0x8000", "size": "232kB",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := syscfg.NewCfg()
+	cfg.Settings["OS_MAIN_STACK_SIZE"] = syscfg.CfgEntry{
+		Name:  "OS_MAIN_STACK_SIZE",
+		Value: "768",
+	}
+	cfg.Settings["LOG_LEVEL"] = syscfg.CfgEntry{
+		Name:  "LOG_LEVEL",
+		Value: "1",
+	}
+
+	return &TargetBuilder{
+		target: tgt,
+		bspPkg: &pkg.BspPackage{
+			LocalPackage: testDefPkg(dir, "hw/bsp/nrf52dk"),
+			FlashMap:     fm,
+		},
+		appPkg: testDefPkg(dir, "apps/blinky"),
+		AppBuilder: &Builder{
+			PkgMap: map[*pkg.LocalPackage]*BuildPackage{},
+			cfg:    cfg,
+		},
+	}
+}
+
+func TestTargetDefDigest(t *testing.T) {
+	defer interfaces.SetProject(interfaces.GetProject())
+
+	dir, err := ioutil.TempDir("", "newt-targetdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "project.yml"),
+		[]byte("project.name: test\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := project.InitProject(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer project.ResetProject()
+
+	digest := BuildEnvDigest(testDefTargetBuilder(t, dir).targetDef())
+
+	tests := []struct {
+		name   string
+		modify func(tb *TargetBuilder)
+	}{
+		{
+			name: "bsp",
+			modify: func(tb *TargetBuilder) {
+				tb.bspPkg.LocalPackage = testDefPkg(dir, "hw/bsp/nrf52840pdk")
+			},
+		},
+		{
+			name: "app",
+			modify: func(tb *TargetBuilder) {
+				tb.appPkg = testDefPkg(dir, "apps/bleprph")
+			},
+		},
+		{
+			name: "loader",
+			modify: func(tb *TargetBuilder) {
+				tb.loaderPkg = testDefPkg(dir, "apps/boot")
+			},
+		},
+		{
+			name: "build profile",
+			modify: func(tb *TargetBuilder) {
+				tb.target.BuildProfile = "debug"
+			},
+		},
+		{
+			name: "target variable",
+			modify: func(tb *TargetBuilder) {
+				tb.target.Vars["target.cflags"] = "-DBLINK_FAST"
+			},
+		},
+		{
+			name: "syscfg value",
+			modify: func(tb *TargetBuilder) {
+				entry := tb.AppBuilder.cfg.Settings["LOG_LEVEL"]
+				entry.Value = "0"
+				tb.AppBuilder.cfg.Settings["LOG_LEVEL"] = entry
+			},
+		},
+		{
+			name: "flash area",
+			modify: func(tb *TargetBuilder) {
+				area := tb.bspPkg.FlashMap.Areas[flash.FLASH_AREA_NAME_IMAGE_0]
+				area.Size = 200 * 1024
+				tb.bspPkg.FlashMap.Areas[flash.FLASH_AREA_NAME_IMAGE_0] = area
+			},
+		},
+	}
+
+	// An unchanged target always produces the same digest.
+	for i := 0; i < 3; i++ {
+		d := BuildEnvDigest(testDefTargetBuilder(t, dir).targetDef())
+		if d != digest {
+			t.Fatalf("digest of unchanged target differs: %s != %s",
+				d, digest)
+		}
+	}
+
+	for _, test := range tests {
+		tb := testDefTargetBuilder(t, dir)
+		test.modify(tb)
+
+		if d := BuildEnvDigest(tb.targetDef()); d == digest {
+			t.Errorf("%s: digest unchanged after modification", test.name)
+		}
+	}
+}
@@ -21,10 +21,18 @@ package cli
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"mynewt.apache.org/newt/newt/builder"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
@@ -100,6 +108,31 @@ func pkgToUnitTests(pack *pkg.LocalPackage) []*pkg.LocalPackage {
 
 var extraJtagCmd string
 var noGDB_flag bool
+var buildWeakOverrides bool
+var buildUnusedIncludes bool
+var buildDupSymbols bool
+var buildKeepGoing bool
+var buildJobs int
+
+func printWeakOverrides(buildName string, b *builder.Builder) {
+	overrides, err := b.WeakOverrides()
+	if err != nil {
+		util.StatusMessage(util.VERBOSITY_QUIET, "Error: %s\n",
+			strings.TrimSpace(err.Error()))
+		return
+	}
+	if len(overrides) == 0 {
+		return
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Weak symbol overrides (%s):\n", buildName)
+	for _, o := range overrides {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"    * %s: %s overridden by %s\n",
+			o.Weak.Name, o.Weak.Bpkg, o.Strong.Bpkg)
+	}
+}
 
 func buildRunCmd(cmd *cobra.Command, args []string) {
 	if len(args) < 1 {
@@ -125,37 +158,362 @@ func buildRunCmd(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	if buildJobs > 1 && len(targets) > 1 {
+		buildTargetsParallel(cmd, targets)
+		return
+	}
+
+	names := make([]string, len(targets))
 	for i, _ := range targets {
-		// Reset the global state for the next build.
-		// XXX: It is not good that this is necessary.  This is certainly going
-		// to bite us...
-		if err := ResetGlobalState(); err != nil {
-			NewtUsage(nil, err)
+		names[i] = targets[i].Name()
+	}
+
+	if err := buildTargetsSerial(names, buildTarget); err != nil {
+		NewtUsage(nil, err)
+	}
+}
+
+// Builds the named targets one at a time with the specified function.  The
+// first failure stops the build unless --keep-going is specified, in which
+// case the remaining targets are built and the returned error summarizes
+// which targets succeeded and which failed.
+func buildTargetsSerial(names []string, build func(name string) error) error {
+	builtNames := []string{}
+	failedNames := []string{}
+	for _, name := range names {
+		err := build(name)
+		if err == nil {
+			builtNames = append(builtNames, name)
+			continue
 		}
 
-		// Look up the target by name.  This has to be done a second time here
-		// now that the project has been reset.
-		t := ResolveTarget(targets[i].Name())
-		if t == nil {
-			NewtUsage(nil, util.NewNewtError("Failed to resolve target: "+
-				targets[i].Name()))
+		if !buildKeepGoing {
+			return err
 		}
 
-		util.StatusMessage(util.VERBOSITY_DEFAULT, "Building target %s\n",
-			t.FullName())
+		util.StatusMessage(util.VERBOSITY_QUIET, "Error: %s\n",
+			strings.TrimSpace(err.Error()))
+		failedNames = append(failedNames, name)
+	}
 
-		b, err := builder.NewTargetBuilder(t)
-		if err != nil {
-			NewtUsage(nil, err)
+	if buildKeepGoing {
+		builtStr := fmt.Sprintf("Built targets: [%s]",
+			strings.Join(builtNames, " "))
+		failStr := fmt.Sprintf("Failed targets: [%s]",
+			strings.Join(failedNames, " "))
+
+		if len(failedNames) > 0 {
+			return util.FmtNewtError("Build failure(s):\n%s\n%s",
+				builtStr, failStr)
 		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s\n", builtStr)
+	}
 
-		if err := b.Build(); err != nil {
-			NewtUsage(nil, err)
+	return nil
+}
+
+// The name of the file in each target's bin directory that holds the output
+// of its most recent parallel build.
+const PARALLEL_BUILD_LOG_NAME = "build.log"
+
+// The outcome of building a single target in a child newt process.
+type parallelBuildResult struct {
+	name    string
+	output  []byte
+	logPath string
+	err     error
+}
+
+// The global flags that name a file that newt writes to.  A child newt
+// process writes to its own copy of each file, so that it does not replace
+// the parent's file or those of the other children.
+var parallelBuildFileFlags = map[string]bool{
+	"outfile":  true,
+	"log-file": true,
+}
+
+// Returns the path of a child's copy of a file named by one of the global
+// file flags; the target name is appended to the parent's path.
+func childOutputPath(path string, name string) string {
+	return path + "." + strings.Replace(name, "/", "_", -1)
+}
+
+// Constructs the arguments for a child newt process that builds the named
+// target with the same settings as this one.  Every global flag that was
+// specified on the command line is passed on to the child.
+func parallelBuildArgs(rootFlags *pflag.FlagSet, name string) []string {
+	args := []string{}
+
+	rootFlags.VisitAll(func(f *pflag.Flag) {
+		if !f.Changed {
+			return
 		}
 
+		val := f.Value.String()
+		if parallelBuildFileFlags[f.Name] {
+			val = childOutputPath(val, name)
+		}
+		args = append(args, "--"+f.Name+"="+val)
+	})
+
+	args = append(args, "build")
+	if buildWeakOverrides {
+		args = append(args, "--weak-overrides")
+	}
+	if buildUnusedIncludes {
+		args = append(args, "--unused-includes")
+	}
+	if buildDupSymbols {
+		args = append(args, "--dup-symbols")
+	}
+
+	return append(args, name)
+}
+
+// Builds a single target in a child newt process.  The child's output is
+// captured rather than displayed, and is also written to the target's bin
+// directory.
+func buildTargetChild(exe string, rootFlags *pflag.FlagSet,
+	name string) parallelBuildResult {
+
+	res := parallelBuildResult{
+		name: name,
+		logPath: filepath.Join(builder.TargetBinDir(name),
+			PARALLEL_BUILD_LOG_NAME),
+	}
+
+	cmd := exec.Command(exe, parallelBuildArgs(rootFlags, name)...)
+	res.output, res.err = cmd.CombinedOutput()
+	if res.err != nil {
+		res.err = util.FmtNewtError("Failed to build target %s: %s", name,
+			res.err.Error())
+	}
+
+	// The log is a convenience; failing to write it does not fail the
+	// build.
+	if err := os.MkdirAll(filepath.Dir(res.logPath), 0755); err == nil {
+		ioutil.WriteFile(res.logPath, res.output, 0644)
+	}
+
+	return res
+}
+
+// Builds several targets concurrently, at most buildJobs at a time.  The
+// targets share the project's global state, so each is built by its own
+// child newt process.
+func buildTargetsParallel(cmd *cobra.Command, targets []*target.Target) {
+	if collisions := builder.BinDirCollisions(targets); len(collisions) > 0 {
+		errText := "Targets cannot be built concurrently; they share a " +
+			"bin directory:\n"
+		for _, c := range collisions {
+			errText += fmt.Sprintf("    * %s and %s\n",
+				c.TargetA.FullName(), c.TargetB.FullName())
+		}
+		NewtUsage(nil, util.NewNewtError(strings.TrimSpace(errText)))
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+	rootFlags := cmd.Root().PersistentFlags()
+
+	names := make([]string, len(targets))
+	for i, _ := range targets {
+		names[i] = targets[i].Name()
+	}
+
+	err = buildParallel(names, buildJobs,
+		func(name string) parallelBuildResult {
+			return buildTargetChild(exe, rootFlags, name)
+		})
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+}
+
+// Builds the named targets with the specified function, at most jobs at a
+// time.  Each target's output is displayed in one piece once its build
+// completes, so the output of concurrent builds is never interleaved.  Unless
+// --keep-going is specified, no new builds are started after one fails.  The
+// returned error lists the targets that failed and where their logs are.
+func buildParallel(names []string, jobs int,
+	build func(name string) parallelBuildResult) error {
+
+	sem := make(chan struct{}, jobs)
+	results := make(chan parallelBuildResult, len(names))
+	var anyFailed int32
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		name := name
+
+		sem <- struct{}{}
+		if !buildKeepGoing && atomic.LoadInt32(&anyFailed) != 0 {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			res := build(name)
+			if res.err != nil {
+				atomic.StoreInt32(&anyFailed, 1)
+			}
+			results <- res
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	builtNames := []string{}
+	failures := []parallelBuildResult{}
+	for res := range results {
+		util.StatusMessage(util.VERBOSITY_QUIET, "==> %s\n", res.name)
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s", string(res.output))
+
+		if res.err == nil {
+			builtNames = append(builtNames, res.name)
+		} else {
+			failures = append(failures, res)
+		}
+	}
+
+	sort.Strings(builtNames)
+	builtStr := fmt.Sprintf("Built targets: [%s]",
+		strings.Join(builtNames, " "))
+
+	if len(failures) > 0 {
+		errText := "Build failure(s):\n" + builtStr + "\nFailed targets:\n"
+		for _, res := range failures {
+			errText += fmt.Sprintf("    * %s (log: %s)\n", res.name,
+				res.logPath)
+		}
+		untried := len(names) - len(builtNames) - len(failures)
+		if untried > 0 {
+			errText += fmt.Sprintf("Not attempted: %d target(s)\n", untried)
+		}
+		return util.NewNewtError(strings.TrimSpace(errText))
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "%s\n", builtStr)
+	return nil
+}
+
+// Builds the named target from a freshly reset project.
+func buildTarget(name string) error {
+	// Reset the global state for the next build.
+	// XXX: It is not good that this is necessary.  This is certainly going
+	// to bite us...
+	if err := ResetGlobalState(); err != nil {
+		return err
+	}
+
+	// Look up the target by name.  This has to be done a second time here
+	// now that the project has been reset.
+	t := ResolveTarget(name)
+	if t == nil {
+		return util.NewNewtError("Failed to resolve target: " + name)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Building target %s\n",
+		t.FullName())
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		return err
+	}
+
+	b.DetectUnusedIncludes = buildUnusedIncludes
+	b.CheckDupSymbols = buildDupSymbols
+	if err := b.Build(); err != nil {
+		return err
+	}
+
+	if buildWeakOverrides {
+		if b.LoaderBuilder != nil {
+			printWeakOverrides(builder.BUILD_NAME_LOADER, b.LoaderBuilder)
+		}
+		printWeakOverrides(builder.BUILD_NAME_APP, b.AppBuilder)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Target successfully built: %s\n", t.Name())
+
+	return nil
+}
+
+// The suffix of the directory that holds a target's first build while
+// determinism is being measured.
+const DETERMINISM_FIRST_SUFFIX = ".first"
+
+func determinismRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target"))
+	}
+
+	InitProject()
+
+	t := ResolveTarget(args[0])
+	if t == nil {
+		NewtUsage(cmd, util.NewNewtError("Invalid target name: "+args[0]))
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+
+	// Each build starts from a clean bin directory and runs in its own
+	// child process, so that nothing carries over from the first build.
+	binDir := builder.TargetBinDir(t.Name())
+	firstDir := binDir + DETERMINISM_FIRST_SUFFIX
+	cleanDir(firstDir)
+
+	for i := 1; i <= 2; i++ {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "Building %s (%d of 2)\n",
+			t.FullName(), i)
+
+		cleanDir(binDir)
+		res := buildTargetChild(exe, cmd.Root().PersistentFlags(), t.Name())
+		if res.err != nil {
+			util.StatusMessage(util.VERBOSITY_QUIET, "%s", string(res.output))
+			cleanDir(firstDir)
+			NewtUsage(nil, res.err)
+		}
+
+		if i == 1 {
+			if err := os.Rename(binDir, firstDir); err != nil {
+				NewtUsage(nil, util.ChildNewtError(err))
+			}
+		}
+	}
+
+	diffs, err := builder.CompareBuildOutputs(firstDir, binDir,
+		[]string{PARALLEL_BUILD_LOG_NAME})
+	cleanDir(firstDir)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if len(diffs) == 0 {
 		util.StatusMessage(util.VERBOSITY_DEFAULT,
-			"Target successfully built: %s\n", t.Name())
+			"Builds of %s are identical\n", t.FullName())
+		return
 	}
+
+	for _, d := range diffs {
+		util.StatusMessage(util.VERBOSITY_QUIET, "    * %s\n", d.String())
+	}
+	NewtUsage(nil, util.FmtNewtError(
+		"%d output file(s) of %s differ between builds", len(diffs),
+		t.FullName()))
 }
 
 func cleanDir(path string) {
@@ -299,7 +657,7 @@ func testRunCmd(cmd *cobra.Command, args []string) {
 			passedPkgs = append(passedPkgs, pack)
 		} else {
 			newtError := err.(*util.NewtError)
-			util.StatusMessage(util.VERBOSITY_QUIET, newtError.Text)
+			util.StatusMessage(util.VERBOSITY_QUIET, "%s", newtError.Text)
 			failedPkgs = append(failedPkgs, pack)
 		}
 	}
@@ -382,6 +740,290 @@ func sizeRunCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+var sizeFuncsCount int
+
+func sizeFuncsRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target"))
+	}
+
+	InitProject()
+
+	t := ResolveTarget(args[0])
+	if t == nil {
+		NewtUsage(cmd, util.NewNewtError("Invalid target name: "+args[0]))
+	}
+
+	if sizeFuncsCount < 0 {
+		NewtUsage(cmd, util.NewNewtError("Function count must not be "+
+			"negative"))
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if err := b.SizeFuncs(sizeFuncsCount); err != nil {
+		NewtUsage(cmd, err)
+	}
+}
+
+func dupSymbolsRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target"))
+	}
+
+	InitProject()
+
+	t := ResolveTarget(args[0])
+	if t == nil {
+		NewtUsage(cmd, util.NewNewtError("Invalid target name: "+args[0]))
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	dupMap, err := b.DuplicateSymbols()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	found := false
+	for _, buildName := range []string{
+		builder.BUILD_NAME_LOADER, builder.BUILD_NAME_APP} {
+
+		dups := dupMap[buildName]
+		if len(dups) > 0 {
+			util.StatusMessage(util.VERBOSITY_QUIET, "%s",
+				builder.DuplicateSymbolsText(buildName, dups))
+			found = true
+		}
+	}
+
+	if found {
+		NewtUsage(nil, util.NewNewtError("Duplicate symbol definitions "+
+			"detected"))
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"No duplicate symbol definitions\n")
+}
+
+func checkIsolationRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target"))
+	}
+
+	InitProject()
+
+	t := ResolveTarget(args[0])
+	if t == nil {
+		NewtUsage(cmd, util.NewNewtError("Invalid target name: "+args[0]))
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	failureMap, err := b.CheckIsolation()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	count := 0
+	for _, buildName := range []string{
+		builder.BUILD_NAME_LOADER, builder.BUILD_NAME_APP} {
+
+		for _, f := range failureMap[buildName] {
+			util.StatusMessage(util.VERBOSITY_QUIET,
+				"%s (%s, %s):\n%s\n", f.File, f.Pkg, buildName, f.Output)
+			count++
+		}
+	}
+
+	if count > 0 {
+		NewtUsage(nil, util.FmtNewtError(
+			"%d source file(s) do not compile with their package's "+
+				"declared includes", count))
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"All source files compile in isolation\n")
+}
+
+func archiveRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify target and output file"))
+	}
+
+	InitProject()
+
+	t := ResolveTarget(args[0])
+	if t == nil {
+		NewtUsage(cmd, util.NewNewtError("Invalid target name: "+args[0]))
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	entries, err := b.ArchiveEntries()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	mtime, err := builder.ArchiveTime()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if err := builder.WriteArchiveFile(args[1], entries, mtime); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	for _, entry := range entries {
+		util.StatusMessage(util.VERBOSITY_VERBOSE, "    %s\n", entry.Name)
+	}
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Archived %d artifact(s) of target %s to %s\n",
+		len(entries), t.FullName(), args[1])
+}
+
+func fingerprintRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target"))
+	}
+
+	InitProject()
+
+	t := ResolveTarget(args[0])
+	if t == nil {
+		NewtUsage(cmd, util.NewNewtError("Invalid target name: "+args[0]))
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	fingerprint, err := b.Fingerprint()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_QUIET, "%s\n", fingerprint)
+}
+
+var buildEnvOutput string
+var buildEnvCompare string
+
+func buildEnvRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target"))
+	}
+
+	InitProject()
+
+	t := ResolveTarget(args[0])
+	if t == nil {
+		NewtUsage(cmd, util.NewNewtError("Invalid target name: "+args[0]))
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	items, err := b.BuildEnv()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if buildEnvOutput != "" {
+		err := ioutil.WriteFile(buildEnvOutput,
+			[]byte(builder.FormatBuildEnv(items)), 0644)
+		if err != nil {
+			NewtUsage(nil, util.ChildNewtError(err))
+		}
+	}
+
+	digest := builder.BuildEnvDigest(items)
+	util.StatusMessage(util.VERBOSITY_QUIET, "%s\n", digest)
+
+	if buildEnvCompare == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(buildEnvCompare)
+	if err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+	other, err := builder.ParseBuildEnv(string(data))
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	diffs := builder.DiffBuildEnvs(items, other)
+	if len(diffs) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Build environment matches %s\n", buildEnvCompare)
+		return
+	}
+
+	errText := fmt.Sprintf("Build environment differs from %s "+
+		"(first=local, second=%s):\n", buildEnvCompare, buildEnvCompare)
+	for _, d := range diffs {
+		errText += fmt.Sprintf("    * %s\n", d)
+	}
+	NewtUsage(nil, util.NewNewtError(strings.TrimSpace(errText)))
+}
+
+var gcAge string = "30d"
+var gcDelete bool = false
+
+func gcRunCmd(cmd *cobra.Command, args []string) {
+	age, err := builder.ParseAge(gcAge)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	InitProject()
+
+	stale, err := builder.StaleBuildDirs(age, time.Now())
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	var total int64
+	for _, bdi := range stale {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s (%d bytes, %s)\n",
+			bdi.Path, bdi.Size, bdi.ModTime.Format(time.RFC3339))
+
+		if gcDelete {
+			if err := builder.RemoveBuildDir(bdi.Path); err != nil {
+				NewtUsage(nil, err)
+			}
+		}
+		total += bdi.Size
+	}
+
+	if gcDelete {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Deleted %d build directories; reclaimed %d bytes\n",
+			len(stale), total)
+	} else {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"%d build directories older than %s; %d bytes reclaimable\n",
+			len(stale), gcAge, total)
+	}
+}
+
 func AddBuildCommands(cmd *cobra.Command) {
 	buildCmd := &cobra.Command{
 		Use:   "build <target-name> [target-names...]",
@@ -391,6 +1033,24 @@ func AddBuildCommands(cmd *cobra.Command) {
 
 	buildCmd.ValidArgs = targetList()
 	cmd.AddCommand(buildCmd)
+	buildCmd.PersistentFlags().BoolVarP(&buildWeakOverrides,
+		"weak-overrides", "", false,
+		"Report weak symbols that are overridden by another package")
+	buildCmd.PersistentFlags().BoolVarP(&buildUnusedIncludes,
+		"unused-includes", "", false,
+		"Warn about included headers whose declarations are not used "+
+			"(advisory)")
+	buildCmd.PersistentFlags().BoolVarP(&buildDupSymbols,
+		"dup-symbols", "", false,
+		"Check for symbols defined by more than one package before linking")
+	buildCmd.PersistentFlags().BoolVarP(&buildKeepGoing,
+		"keep-going", "k", false,
+		"Continue building the remaining targets after a failure; "+
+			"summarize the results at the end")
+	buildCmd.PersistentFlags().IntVarP(&buildJobs, "jobs", "j", 1,
+		"Number of targets to build concurrently; each target's output "+
+			"is displayed when its build completes and is written to "+
+			PARALLEL_BUILD_LOG_NAME+" in its bin directory")
 
 	cleanCmd := &cobra.Command{
 		Use:   "clean <target-name> [target-names...] | all",
@@ -401,6 +1061,27 @@ func AddBuildCommands(cmd *cobra.Command) {
 	cleanCmd.ValidArgs = append(targetList(), "all")
 	cmd.AddCommand(cleanCmd)
 
+	gcHelpText := "List the build output directories that have not been " +
+		"modified within the specified age.  With --delete, the listed " +
+		"directories are removed.  Only directories within the project's " +
+		"bin directory are considered."
+	gcHelpEx := "  newt gc\n"
+	gcHelpEx += "  newt gc --age 7d --delete\n"
+	gcHelpEx += "  newt gc --age 36h"
+
+	gcCmd := &cobra.Command{
+		Use:     "gc",
+		Short:   "Deletes stale build artifacts",
+		Long:    gcHelpText,
+		Example: gcHelpEx,
+		Run:     gcRunCmd,
+	}
+	gcCmd.PersistentFlags().StringVarP(&gcAge, "age", "", gcAge,
+		"Minimum age of collected build output (e.g., 36h, 30d)")
+	gcCmd.PersistentFlags().BoolVarP(&gcDelete, "delete", "", false,
+		"Delete stale build output rather than just listing it")
+	cmd.AddCommand(gcCmd)
+
 	testCmd := &cobra.Command{
 		Use:   "test <package-name> [package-names...] | all",
 		Short: "Executes unit tests for one or more packages",
@@ -452,4 +1133,133 @@ func AddBuildCommands(cmd *cobra.Command) {
 	sizeCmd.ValidArgs = targetList()
 	cmd.AddCommand(sizeCmd)
 
+	sizeFuncsHelpText := "List the largest functions in the image built " +
+		"for <target-name>, along with the package defining each.  Data " +
+		"symbols are not listed.  The target must already have been built."
+
+	sizeFuncsCmd := &cobra.Command{
+		Use:   "size-funcs <target-name>",
+		Short: "Largest functions in a target's image",
+		Long:  sizeFuncsHelpText,
+		Run:   sizeFuncsRunCmd,
+	}
+	sizeFuncsCmd.PersistentFlags().IntVarP(&sizeFuncsCount, "count", "n",
+		20, "Number of functions to list (0 lists all)")
+
+	sizeFuncsCmd.ValidArgs = targetList()
+	cmd.AddCommand(sizeFuncsCmd)
+
+	dupSymbolsHelpText := "Compile <target-name> without linking and " +
+		"report global symbols that more than one package defines.  Such " +
+		"symbols cause \"multiple definition\" errors at link time.  Weak " +
+		"definitions that are overridden by a strong one are intentional " +
+		"and are not reported."
+
+	dupSymbolsCmd := &cobra.Command{
+		Use:   "dup-symbols <target-name>",
+		Short: "Check a target for symbols defined by multiple packages",
+		Long:  dupSymbolsHelpText,
+		Run:   dupSymbolsRunCmd,
+	}
+
+	dupSymbolsCmd.ValidArgs = targetList()
+	cmd.AddCommand(dupSymbolsCmd)
+
+	checkIsolationHelpText := "Compile each source file of <target-name> " +
+		"with only the include paths its package declares: the package's " +
+		"own directories and those exported by its direct dependencies.  " +
+		"Files that fail rely on headers leaked by an indirect dependency " +
+		"or by the target, app, or BSP, and break if the dependency graph " +
+		"changes.  No object files are produced."
+
+	checkIsolationCmd := &cobra.Command{
+		Use:   "check-isolation <target-name>",
+		Short: "Check that source files compile with declared includes only",
+		Long:  checkIsolationHelpText,
+		Run:   checkIsolationRunCmd,
+	}
+
+	checkIsolationCmd.ValidArgs = targetList()
+	cmd.AddCommand(checkIsolationCmd)
+
+	archiveHelpText := "Collect the build artifacts of <target-name> " +
+		"(images, elf and binary files, linker maps, and manifests) into a " +
+		"tar archive.  The archive is reproducible: files are sorted by " +
+		"name and recorded without ownership, with fixed permissions, and " +
+		"with the timestamp given by $" + builder.SOURCE_DATE_EPOCH_ENV +
+		" (default: the Unix epoch).  An output file ending in .gz or .tgz " +
+		"is gzip-compressed."
+
+	archiveCmd := &cobra.Command{
+		Use:   "archive <target-name> <output-file>",
+		Short: "Write a reproducible archive of a target's build artifacts",
+		Long:  archiveHelpText,
+		Run:   archiveRunCmd,
+	}
+
+	archiveCmd.ValidArgs = targetList()
+	cmd.AddCommand(archiveCmd)
+
+	fingerprintHelpText := "Print a digest of every input to the build of " +
+		"<target-name>: package source files, syscfg values, compiler " +
+		"flags, and toolchain version.  The digest is independent of the " +
+		"project's location, making it suitable as a CI cache key."
+
+	fingerprintCmd := &cobra.Command{
+		Use:   "fingerprint <target-name>",
+		Short: "Print a digest of a target's build inputs",
+		Long:  fingerprintHelpText,
+		Run:   fingerprintRunCmd,
+	}
+
+	fingerprintCmd.ValidArgs = targetList()
+	cmd.AddCommand(fingerprintCmd)
+
+	buildEnvHelpText := "Print a digest of the environment that " +
+		"<target-name> is built in: the newt version, the toolchain and its " +
+		"version, the build profile, and the resolved flags of every " +
+		"package.  Machines with equal digests produce identical builds " +
+		"from identical sources.  The environment can be saved with " +
+		"--output and compared against a saved environment with " +
+		"--compare; each difference is listed."
+	buildEnvHelpEx := "  newt build-env <target-name>\n"
+	buildEnvHelpEx += "  newt build-env --output ci-env.txt my_target1\n"
+	buildEnvHelpEx += "  newt build-env --compare ci-env.txt my_target1"
+
+	buildEnvCmd := &cobra.Command{
+		Use:     "build-env <target-name>",
+		Short:   "Print a digest of a target's build environment",
+		Long:    buildEnvHelpText,
+		Example: buildEnvHelpEx,
+		Run:     buildEnvRunCmd,
+	}
+	buildEnvCmd.PersistentFlags().StringVarP(&buildEnvOutput, "output", "",
+		"", "File to save the build environment to")
+	buildEnvCmd.PersistentFlags().StringVarP(&buildEnvCompare, "compare",
+		"", "", "Saved build environment to compare against")
+
+	buildEnvCmd.ValidArgs = targetList()
+	cmd.AddCommand(buildEnvCmd)
+
+	determinismHelpText := "Build the target specified by <target-name> " +
+		"twice, each time from a clean bin directory, and report each " +
+		"output file that differs between the two builds: the number of " +
+		"differing bytes, the runs they form, and the offset of the first.  " +
+		"Object files, archives, and images are all compared, which helps " +
+		"pinpoint the source of nondeterminism (e.g., embedded timestamps " +
+		"or paths).  The target's bin directory holds the second build " +
+		"afterwards."
+	determinismHelpEx := "  newt determinism <target-name>\n"
+	determinismHelpEx += "  newt determinism my_target1"
+
+	determinismCmd := &cobra.Command{
+		Use:       "determinism",
+		Short:     "Build a target twice and report differing outputs",
+		Long:      determinismHelpText,
+		Example:   determinismHelpEx,
+		Run:       determinismRunCmd,
+		ValidArgs: targetList(),
+	}
+	cmd.AddCommand(determinismCmd)
+
 }
@@ -0,0 +1,378 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"mynewt.apache.org/newt/util"
+)
+
+func TestBuildKeepGoing(t *testing.T) {
+	defer func(keepGoing bool, verbosity int) {
+		buildKeepGoing = keepGoing
+		util.Verbosity = verbosity
+	}(buildKeepGoing, util.Verbosity)
+	util.Verbosity = util.VERBOSITY_SILENT
+
+	tests := []struct {
+		name      string
+		targets   []string
+		broken    []string
+		keepGoing bool
+		wantBuilt []string
+		wantErr   []string
+	}{
+		{
+			name:      "stop at first failure",
+			targets:   []string{"blinky", "broken", "slinky"},
+			broken:    []string{"broken"},
+			keepGoing: false,
+			wantBuilt: []string{"blinky"},
+			wantErr:   []string{"broken: compile failed"},
+		},
+		{
+			name:      "keep going past failure",
+			targets:   []string{"blinky", "broken", "slinky"},
+			broken:    []string{"broken"},
+			keepGoing: true,
+			wantBuilt: []string{"blinky", "slinky"},
+			wantErr: []string{
+				"Built targets: [blinky slinky]",
+				"Failed targets: [broken]",
+			},
+		},
+		{
+			name:      "keep going with several failures",
+			targets:   []string{"bad1", "blinky", "bad2"},
+			broken:    []string{"bad1", "bad2"},
+			keepGoing: true,
+			wantBuilt: []string{"blinky"},
+			wantErr: []string{
+				"Built targets: [blinky]",
+				"Failed targets: [bad1 bad2]",
+			},
+		},
+		{
+			name:      "keep going without failures",
+			targets:   []string{"blinky", "slinky"},
+			keepGoing: true,
+			wantBuilt: []string{"blinky", "slinky"},
+		},
+	}
+
+	for _, test := range tests {
+		buildKeepGoing = test.keepGoing
+
+		built := []string{}
+		err := buildTargetsSerial(test.targets, func(name string) error {
+			for _, b := range test.broken {
+				if name == b {
+					return util.FmtNewtError("%s: compile failed", name)
+				}
+			}
+			built = append(built, name)
+			return nil
+		})
+
+		if strings.Join(built, " ") != strings.Join(test.wantBuilt, " ") {
+			t.Errorf("%s: built=%v; want %v", test.name, built,
+				test.wantBuilt)
+		}
+
+		if len(test.wantErr) == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expected error", test.name)
+			continue
+		}
+		for _, w := range test.wantErr {
+			if !strings.Contains(err.Error(), w) {
+				t.Errorf("%s: error %q does not contain %q", test.name,
+					err.Error(), w)
+			}
+		}
+	}
+}
+
+// Creates a root command with the same global flags as newt, and a build
+// subcommand that records the arguments it would pass to a child building
+// the named target.
+func newTestRootCmd(name string, childArgs *[]string) *cobra.Command {
+	bools := make([]bool, 4)
+	strs := make([]string, 4)
+
+	rootCmd := &cobra.Command{Use: "newt"}
+	rootCmd.PersistentFlags().BoolVarP(&bools[0], "verbose", "v", false, "")
+	rootCmd.PersistentFlags().BoolVarP(&bools[1], "quiet", "q", false, "")
+	rootCmd.PersistentFlags().BoolVarP(&bools[2], "silent", "s", false, "")
+	rootCmd.PersistentFlags().StringVarP(&strs[0], "loglevel", "l", "WARN",
+		"")
+	rootCmd.PersistentFlags().StringVarP(&strs[1], "outfile", "o", "", "")
+	rootCmd.PersistentFlags().StringVarP(&strs[2], "log-file", "", "", "")
+	rootCmd.PersistentFlags().BoolVarP(&bools[3], "timing", "", false, "")
+	rootCmd.PersistentFlags().StringVarP(&strs[3], "syscfg", "", "", "")
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use: "build",
+		Run: func(cmd *cobra.Command, args []string) {
+			*childArgs = parallelBuildArgs(cmd.Root().PersistentFlags(),
+				name)
+		},
+	})
+
+	return rootCmd
+}
+
+func TestParallelBuildArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		args   []string
+		want   []string
+	}{
+		{
+			name:   "no global flags",
+			target: "blinky",
+			args:   []string{"build", "blinky", "slinky"},
+			want:   []string{"build", "blinky"},
+		},
+		{
+			name:   "verbosity and log level",
+			target: "blinky",
+			args:   []string{"-v", "-l", "DEBUG", "build", "blinky"},
+			want: []string{
+				"--loglevel=DEBUG", "--verbose=true", "build", "blinky",
+			},
+		},
+		{
+			name:   "flags after the subcommand",
+			target: "slinky",
+			args: []string{
+				"build", "--timing", "--syscfg", "A=1:B=2", "slinky",
+			},
+			want: []string{
+				"--syscfg=A=1:B=2", "--timing=true", "build", "slinky",
+			},
+		},
+		{
+			name:   "each child gets its own output files",
+			target: "my/blinky",
+			args: []string{
+				"--log-file", "/tmp/all.log", "-o", "tee.txt", "build",
+				"my/blinky",
+			},
+			want: []string{
+				"--log-file=/tmp/all.log.my_blinky",
+				"--outfile=tee.txt.my_blinky",
+				"build", "my/blinky",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		var got []string
+		rootCmd := newTestRootCmd(test.target, &got)
+		rootCmd.SetArgs(test.args)
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("%s: args=%v; want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBuildParallel(t *testing.T) {
+	defer func(keepGoing bool, verbosity int) {
+		buildKeepGoing = keepGoing
+		util.Verbosity = verbosity
+	}(buildKeepGoing, util.Verbosity)
+	util.Verbosity = util.VERBOSITY_SILENT
+
+	tests := []struct {
+		name      string
+		targets   []string
+		jobs      int
+		keepGoing bool
+
+		// The number of builds that must be running at once before any
+		// of them is allowed to finish.
+		together int
+
+		wantBuilt []string
+		wantErr   []string
+		notInErr  []string
+	}{
+		{
+			name:      "three targets at once",
+			targets:   []string{"blinky", "slinky", "bleprph"},
+			jobs:      3,
+			together:  3,
+			wantBuilt: []string{"blinky", "slinky", "bleprph"},
+		},
+		{
+			name:      "failure attributed to its target",
+			targets:   []string{"blinky", "broken", "slinky"},
+			jobs:      3,
+			together:  3,
+			wantBuilt: []string{"blinky", "slinky"},
+			wantErr: []string{
+				"Built targets: [blinky slinky]",
+				"* broken (log: ",
+				filepath.Join("broken", PARALLEL_BUILD_LOG_NAME),
+			},
+			notInErr: []string{"* blinky", "* slinky", "Not attempted"},
+		},
+		{
+			name:      "no new builds after a failure",
+			targets:   []string{"broken", "blinky", "slinky"},
+			jobs:      1,
+			wantBuilt: []string{},
+			wantErr:   []string{"* broken", "Not attempted: 2 target(s)"},
+		},
+		{
+			name:      "keep going after a failure",
+			targets:   []string{"broken", "blinky", "slinky"},
+			jobs:      2,
+			keepGoing: true,
+			wantBuilt: []string{"blinky", "slinky"},
+			wantErr:   []string{"Built targets: [blinky slinky]"},
+			notInErr:  []string{"Not attempted"},
+		},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "newt-build")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		buildKeepGoing = test.keepGoing
+
+		var running int32
+		var maxRunning int32
+
+		var started sync.WaitGroup
+		allStarted := make(chan struct{})
+		if test.together > 0 {
+			started.Add(test.together)
+			go func() {
+				started.Wait()
+				close(allStarted)
+			}()
+		}
+
+		build := func(name string) parallelBuildResult {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+
+			if test.together > 0 {
+				started.Done()
+				select {
+				case <-allStarted:
+				case <-time.After(5 * time.Second):
+				}
+			}
+
+			res := parallelBuildResult{
+				name:    name,
+				logPath: filepath.Join(dir, name, PARALLEL_BUILD_LOG_NAME),
+			}
+			if name == "broken" {
+				res.err = util.FmtNewtError("%s: compile failed", name)
+				return res
+			}
+
+			res.err = os.MkdirAll(filepath.Join(dir, name), 0755)
+			if res.err == nil {
+				res.err = ioutil.WriteFile(
+					filepath.Join(dir, name, "app.elf"), []byte(name), 0644)
+			}
+			return res
+		}
+
+		err = buildParallel(test.targets, test.jobs, build)
+
+		if int(maxRunning) > test.jobs {
+			t.Errorf("%s: %d builds at once; limit is %d", test.name,
+				maxRunning, test.jobs)
+		}
+		if int(maxRunning) < test.together {
+			t.Errorf("%s: %d builds at once; expected %d", test.name,
+				maxRunning, test.together)
+		}
+
+		for _, name := range test.wantBuilt {
+			data, err := ioutil.ReadFile(filepath.Join(dir, name, "app.elf"))
+			if err != nil || string(data) != name {
+				t.Errorf("%s: missing artifact for %s", test.name, name)
+			}
+		}
+		artifacts, _ := filepath.Glob(filepath.Join(dir, "*", "app.elf"))
+		if len(artifacts) != len(test.wantBuilt) {
+			t.Errorf("%s: %d artifacts; want %d", test.name, len(artifacts),
+				len(test.wantBuilt))
+		}
+
+		if len(test.wantErr) == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expected error", test.name)
+			continue
+		}
+		for _, w := range test.wantErr {
+			if !strings.Contains(err.Error(), w) {
+				t.Errorf("%s: error %q does not contain %q", test.name,
+					err.Error(), w)
+			}
+		}
+		for _, w := range test.notInErr {
+			if strings.Contains(err.Error(), w) {
+				t.Errorf("%s: error %q contains %q", test.name,
+					err.Error(), w)
+			}
+		}
+	}
+}
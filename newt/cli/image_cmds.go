@@ -20,13 +20,47 @@
 package cli
 
 import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/image"
+	"mynewt.apache.org/newt/newt/mfg"
+	"mynewt.apache.org/newt/newt/project"
 	"mynewt.apache.org/newt/util"
 )
 
+// Environment variable that overrides the captured "git describe" string.
+// This allows reproducible builds outside of the original checkout.
+const GIT_DESC_ENV = "NEWT_GIT_DESCRIBE"
+
+var imageGitDesc bool
+var imageRequireSig bool
+var imageHeaderOffset string
+var imageUf2Family string
+var imageHeaderFill string
+var imageTrailerReserve string
+var imageDryRunSign bool
+var imageDeltaSrcHash string
+var imageDetachedSig string
+var imageCertChain string
+var imageRootCerts []string
+var imageOtaCompression string = image.COMPRESSION_DEFLATE
+var imageMagic string
+var imageCfgHash bool
+var imageSecretArea string = flash.FLASH_AREA_NAME_IMAGE_0
+var imageSecretMinEntropy float64
+var imageBootVersion string
+var imageBootDepName string = image.BOOT_DEP_NAME
+var imageSigningRequestOutput string
+
 func createImageRunCmd(cmd *cobra.Command, args []string) {
 	var keyId uint8
 	var keystr string
@@ -35,7 +69,7 @@ func createImageRunCmd(cmd *cobra.Command, args []string) {
 		NewtUsage(cmd, util.NewNewtError("Must specify target and version"))
 	}
 
-	InitProject()
+	proj := InitProject()
 
 	targetName := args[0]
 	t := ResolveTarget(targetName)
@@ -43,7 +77,11 @@ func createImageRunCmd(cmd *cobra.Command, args []string) {
 		NewtUsage(cmd, util.NewNewtError("Invalid target name: "+targetName))
 	}
 
+	// Reject a malformed version before spending time on the build.
 	version := args[1]
+	if _, err := image.ParseVersion(version); err != nil {
+		NewtUsage(cmd, err)
+	}
 
 	if len(args) > 2 {
 		if len(args) > 3 {
@@ -62,20 +100,607 @@ func createImageRunCmd(cmd *cobra.Command, args []string) {
 		NewtUsage(nil, err)
 	}
 
-	if _, _, err := b.CreateImages(version, keystr, keyId); err != nil {
+	if imageHeaderOffset != "" {
+		off, err := util.AtoiNoOct(imageHeaderOffset)
+		if err != nil || off < 0 {
+			NewtUsage(cmd, util.FmtNewtError(
+				"Invalid header offset: %s", imageHeaderOffset))
+		}
+		b.ImageHeaderOffset = off
+	}
+
+	fill, err := util.AtoiNoOct(imageHeaderFill)
+	if err != nil || fill < 0 || fill > 0xff {
+		NewtUsage(cmd, util.FmtNewtError(
+			"Invalid header fill value: %s", imageHeaderFill))
+	}
+	b.ImageHeaderFill = byte(fill)
+
+	if imageTrailerReserve != "" {
+		reserve, err := util.AtoiNoOct(imageTrailerReserve)
+		if err != nil || reserve < 0 {
+			NewtUsage(cmd, util.FmtNewtError(
+				"Invalid trailer reserve: %s", imageTrailerReserve))
+		}
+		b.ImageTrailerReserve = reserve
+	}
+
+	// The target's magic setting overrides the project's.
+	magicStr := t.ImageMagic()
+	if magicStr == "" {
+		magicStr = proj.ImageMagic()
+	}
+	magic, err := image.ParseMagic(magicStr)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+	b.ImageMagic = magic
+	image.ExpectedMagic = magic
+
+	uf2Family := imageUf2Family
+	if uf2Family == "" {
+		uf2Family = t.Uf2Family
+	}
+	if uf2Family != "" {
+		familyId, err := image.ParseUf2Family(uf2Family)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+		b.ImageUf2 = true
+		b.ImageUf2FamilyId = familyId
+	}
+
+	if imageDetachedSig != "" {
+		if keystr != "" {
+			NewtUsage(cmd, util.NewNewtError(
+				"Cannot specify a signing key with --detached-sig"))
+		}
+		if b.ImageUf2 || imageRequireSig {
+			NewtUsage(cmd, util.NewNewtError(
+				"--detached-sig cannot be combined with --uf2-family or "+
+					"--require-signature; the image is not signed yet"))
+		}
+
+		sigType, err := image.ParseDetachedSigType(imageDetachedSig)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+		b.ImageDetachedSigType = sigType
+	}
+
+	if imageGitDesc {
+		b.ImageGitDesc = os.Getenv(GIT_DESC_ENV)
+		if b.ImageGitDesc == "" {
+			b.ImageGitDesc = image.GitDescribe(proj.Path())
+		}
+	}
+
+	b.ImageCfgHash = imageCfgHash
+	b.ImageDryRunSign = imageDryRunSign
+	if imageDryRunSign && (imageRequireSig || b.ImageUf2) {
+		NewtUsage(cmd, util.NewNewtError(
+			"--dry-run-sign cannot be combined with --require-signature or "+
+				"--uf2-family; no image is written"))
+	}
+
+	appImg, loaderImg, err := b.CreateImages(version, keystr, keyId)
+	if err != nil {
+		NewtUsage(cmd, err)
+		return
+	}
+
+	if imageRequireSig {
+		for _, img := range []*image.Image{appImg, loaderImg} {
+			if img == nil {
+				continue
+			}
+			err := image.RequireSignature(img.TargetImg, img.HeaderOffset)
+			if err != nil {
+				NewtUsage(nil, err)
+			}
+		}
+	}
+}
+
+func compareImagesRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		NewtUsage(cmd, util.NewNewtError("Must specify two image files"))
+	}
+
+	hdr1, payload1, err := image.ReadImage(args[0])
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+	hdr2, payload2, err := image.ReadImage(args[1])
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	// Version numbers are expected to change between builds; they are not
+	// part of the payload.
+	if hdr1.Vers != hdr2.Vers {
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Ignoring version difference: %s vs. %s\n",
+			hdr1.Vers.String(), hdr2.Vers.String())
+	}
+
+	off := image.ComparePayloads(payload1, payload2)
+	if off == -1 {
+		util.StatusMessage(util.VERBOSITY_QUIET, "Images are equal\n")
+	} else {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"Images differ; first difference at payload offset %d "+
+				"(sizes %d and %d)\n", off, len(payload1), len(payload2))
+	}
+}
+
+func dumpImageTlvsRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify an image file"))
+	}
+
+	tlvs, err := image.ReadImageTlvs(args[0], 0)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	for i, tlv := range tlvs {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"TLV %d: offset=%d type=%d len=%d\n    %s\n",
+			i, tlv.Offset, tlv.Header.Type, tlv.Header.Len,
+			hex.EncodeToString(tlv.Data))
+	}
+}
+
+func verifyImageChainRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify an image file"))
+	}
+
+	result, err := image.VerifyImageChain(args[0], imageCertChain,
+		imageRootCerts, time.Now())
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Image signature verified; leaf=%s\n", image.CertName(result.Leaf))
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Certificate chain:\n")
+	for _, cert := range result.Chain {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"    * %s (expires %s)\n", image.CertName(cert),
+			cert.NotAfter.Format(time.RFC3339))
+	}
+}
+
+// Determines the header magic that verified images must carry: the --magic
+// argument if specified, otherwise the enclosing project's setting, if any.
+func verifyImageMagic(cmd *cobra.Command) uint32 {
+	magicStr := imageMagic
+	if magicStr == "" {
+		if proj, err := project.TryGetProject(); err == nil {
+			magicStr = proj.ImageMagic()
+		}
+	}
+
+	magic, err := image.ParseMagic(magicStr)
+	if err != nil {
 		NewtUsage(cmd, err)
+	}
+	return magic
+}
+
+func verifyImageRunCmd(cmd *cobra.Command, args []string) {
+	image.ExpectedMagic = verifyImageMagic(cmd)
+
+	if imageCertChain != "" {
+		verifyImageChainRunCmd(cmd, args)
+		return
+	}
+
+	if len(args) < 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify an image file and at least one trusted key"))
+	}
+
+	keys, err := image.LoadTrustStore(args[1:])
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	key, err := image.VerifyImage(args[0], keys)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Image signature verified; key=%s\n", key.Name)
+
+	tlvs, err := image.ReadImageTlvs(args[0], 0)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	deps, err := image.TlvDependencies(tlvs)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+	for _, dep := range deps {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "Requires %s\n",
+			dep.String())
+	}
+
+	if cfgHash := image.TlvCfgHash(tlvs); cfgHash != nil {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Configuration hash: %s\n", hex.EncodeToString(cfgHash))
+	}
+}
+
+func createOtaBundleRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 3 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify a bundle file, a signing key, and at least one "+
+				"image file"))
+	}
+
+	if err := image.WriteBundle(args[0], args[2:], args[1]); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Wrote signed bundle descriptor %s (%d images)\n", args[0],
+		len(args)-2)
+}
+
+func verifyOtaBundleRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify a bundle file and at least one trusted key"))
+	}
+
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+
+	keys, err := image.LoadTrustStore(args[1:])
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	manifest, key, err := image.VerifyBundle(data, keys)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Bundle signature verified; key=%s\n", key.Name)
+	for _, img := range manifest.Images {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"    * %s: version=%s size=%d hash=%s\n",
+			img.Name, img.Version, img.Size, img.Hash)
+	}
+}
+
+func otaSizeRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify an image file"))
+	}
+
+	prevPath := ""
+	if len(args) >= 2 {
+		prevPath = args[1]
+	}
+
+	size, err := image.EstimateOtaSize(args[0], prevPath,
+		imageOtaCompression)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	pct := func(n int, d int) float64 {
+		if d == 0 {
+			return 0
+		}
+		return float64(n) * 100 / float64(d)
+	}
+
+	util.StatusMessage(util.VERBOSITY_QUIET,
+		"Compression:      %s\n", size.Compression)
+	util.StatusMessage(util.VERBOSITY_QUIET,
+		"Image:            %d bytes\n", size.ImageSize)
+	util.StatusMessage(util.VERBOSITY_QUIET,
+		"Compressed image: %d bytes (%.1f%%)\n", size.CompressedSize,
+		pct(size.CompressedSize, size.ImageSize))
+
+	if size.DeltaSize >= 0 {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"Delta:            %d bytes (%.1f%%)\n", size.DeltaSize,
+			pct(size.DeltaSize, size.ImageSize))
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"Compressed delta: %d bytes (%.1f%%)\n",
+			size.CompressedDeltaSize,
+			pct(size.CompressedDeltaSize, size.ImageSize))
+	}
+}
+
+func createDeltaRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 3 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify source image, target image, and output file"))
+	}
+
+	var srcHash []byte
+	if imageDeltaSrcHash != "" {
+		var err error
+		srcHash, err = hex.DecodeString(imageDeltaSrcHash)
+		if err != nil {
+			NewtUsage(cmd, util.FmtNewtError(
+				"Invalid source hash: %s", err.Error()))
+		}
+	}
+
+	if err := image.WriteDelta(args[0], args[1], srcHash,
+		args[2]); err != nil {
+
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Delta image written to %s\n",
+		args[2])
+}
+
+func injectSignatureRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify an image file and a signature file"))
+	}
+
+	if err := image.InjectSignature(args[0], args[1]); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Signature added to %s\n", args[0])
+}
+
+func signingRequestRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify an image file"))
+	}
+
+	reqPath := imageSigningRequestOutput
+	if reqPath == "" {
+		reqPath = image.SigningRequestPath(args[0])
+	}
+
+	if err := image.WriteSigningRequest(args[0], reqPath); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Signing request written to %s\n", reqPath)
+}
+
+func injectSigningResponseRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify an image file and a signing response file"))
+	}
+
+	if err := image.InjectSigningResponse(args[0], args[1]); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Signature added to %s\n", args[0])
+}
+
+func printTlvCode(name string, code int, size int) {
+	sizeStr := "variable"
+	if size >= 0 {
+		sizeStr = strconv.Itoa(size)
+	}
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"    %-28s code=0x%02x size=%s\n", name, code, sizeStr)
+}
+
+func checkVersionRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify a version"))
+	}
+
+	ver, err := image.ParseVersion(args[0])
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Version %s is valid; image header version: %s\n", args[0],
+		ver.String())
+}
+
+func scanImageSecretsRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify an image file"))
+	}
+
+	image.ExpectedMagic = verifyImageMagic(cmd)
+
+	findings, err := mfg.ScanImageSecrets(args[0], imageSecretArea,
+		imageSecretMinEntropy)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if len(findings) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"No secrets found in %s\n", args[0])
 		return
 	}
+
+	errText := fmt.Sprintf("Image %s contains possible secrets:\n", args[0])
+	for _, f := range findings {
+		errText += fmt.Sprintf("    * %s\n", f.String())
+	}
+	NewtUsage(nil, util.NewNewtError(strings.TrimSpace(errText)))
+}
+
+func checkImageVersionRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify an image file"))
+	}
+	image.ExpectedMagic = verifyImageMagic(cmd)
+
+	ver, err := image.CheckImageVersion(args[0])
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Image %s version is consistent: %s\n", args[0], ver.String())
+}
+
+func checkImageHashRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify an image file and the expected hash"))
+	}
+	image.ExpectedMagic = verifyImageMagic(cmd)
+
+	hash, match, err := image.CheckImageHash(args[0], args[1])
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if !match {
+		NewtUsage(nil, util.FmtNewtError(
+			"Image %s hash mismatch; expected=%s calculated=%x",
+			args[0], strings.ToLower(strings.TrimSpace(args[1])), hash))
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Image %s hash matches: %x\n", args[0], hash)
+}
+
+func checkBootCompatRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify an app image and a boot loader file"))
+	}
+
+	var bootVer *image.ImageVersion
+	if imageBootVersion != "" {
+		ver, err := image.ParseVersion(imageBootVersion)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+		bootVer = &ver
+	}
+
+	bc, err := image.CheckBootCompat(args[0], args[1], imageBootDepName,
+		bootVer)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"App image: magic=0x%08x header-size=%d\n", bc.AppMagic, bc.AppHdrSz)
+	for _, dep := range bc.AppDeps {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    Requires %s\n",
+			dep.String())
+	}
+
+	verStr := "unknown"
+	if bc.BootVersion != nil {
+		verStr = bc.BootVersion.String()
+	}
+	magics := []string{}
+	for _, magic := range bc.BootMagics {
+		magics = append(magics, fmt.Sprintf("0x%08x", magic))
+	}
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Boot loader: image=%t version=%s magics=[%s]\n", bc.BootIsImg,
+		verStr, strings.Join(magics, ", "))
+
+	if !bc.Compatible() {
+		errText := fmt.Sprintf("App image %s is incompatible with boot "+
+			"loader %s:\n", args[0], args[1])
+		for _, p := range bc.Problems {
+			errText += fmt.Sprintf("    * %s\n", p)
+		}
+		NewtUsage(nil, util.NewNewtError(strings.TrimSpace(errText)))
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"App image is compatible with the boot loader\n")
+}
+
+func checkImageSetRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify a boot loader file and an app image"))
+	}
+
+	set := mfg.ImageSet{
+		BootPath: args[0],
+		AppPath:  args[1],
+	}
+	if len(args) >= 3 {
+		set.MfgManifestPath = args[2]
+	}
+
+	c, err := mfg.CheckImageSet(set)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	for _, w := range c.Warnings {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "Warning: %s\n", w)
+	}
+
+	if !c.Consistent() {
+		errText := "Image set is inconsistent:\n"
+		for _, p := range c.Problems {
+			errText += fmt.Sprintf("    * %s\n", p)
+		}
+		NewtUsage(nil, util.NewNewtError(strings.TrimSpace(errText)))
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Image set is consistent\n")
+}
+
+func tlvCodesRunCmd(cmd *cobra.Command, args []string) {
+	// Reflect the project's TLV code overrides, if run within a project.
+	if proj, err := project.TryGetProject(); err == nil {
+		if err := mfg.SetMetaTlvCodes(proj.MetaTlvCodes()); err != nil {
+			NewtUsage(nil, err)
+		}
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Meta region TLVs:\n")
+	for _, desc := range mfg.MetaTlvCodes() {
+		printTlvCode(desc.Name, mfg.MetaTlvWireCode(desc.Code), desc.Size)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Image trailer TLVs:\n")
+	for _, desc := range image.TlvCodes() {
+		printTlvCode(desc.Name, desc.Code, desc.Size)
+	}
 }
 
 func AddImageCommands(cmd *cobra.Command) {
 	createImageHelpText := "Create image by adding image header to created " +
 		"binary file for <target-name>. Version number in the header is set " +
-		"to be <version>.\n\nTo sign the image give private key as <signing_key>."
+		"to be <version>.\n\nTo sign the image give private key as <signing_key>." +
+		"  The key is either a PEM file or a PKCS#11 URI (\"pkcs11:...\") " +
+		"identifying a key held by a hardware token."
 	createImageHelpEx := "  newt create-image <target-name> <version>\n"
 	createImageHelpEx += "  newt create-image my_target1 1.2.0\n"
 	createImageHelpEx += "  newt create-image my_target1 1.2.0.3\n"
 	createImageHelpEx += "  newt create-image my_target1 1.2.0.3 private.pem\n"
+	createImageHelpEx += "  newt create-image my_target1 1.2.0.3 " +
+		"'pkcs11:token=build;object=img?module-path=/usr/lib/p11.so'\n"
 
 	createImageCmd := &cobra.Command{
 		Use:     "create-image",
@@ -85,6 +710,394 @@ func AddImageCommands(cmd *cobra.Command) {
 		Run:     createImageRunCmd,
 	}
 
+	createImageCmd.PersistentFlags().BoolVarP(&imageGitDesc, "git-describe",
+		"", false, "Record the output of \"git describe\" in the image "+
+			"trailer (overridden by $"+GIT_DESC_ENV+")")
+	createImageCmd.PersistentFlags().StringVarP(&imageHeaderOffset,
+		"header-offset", "", "", "Place the image header at the specified "+
+			"offset within the image file")
+	createImageCmd.PersistentFlags().StringVarP(&imageHeaderFill,
+		"header-fill", "", "0xff", "Value of the bytes preceding an offset "+
+			"image header")
+	createImageCmd.PersistentFlags().StringVarP(&imageTrailerReserve,
+		"trailer-reserve", "", "", "Reserve the specified number of erased "+
+			"bytes after the image trailer for TLVs added later; the "+
+			"reserve counts toward the slot size")
+	createImageCmd.PersistentFlags().BoolVarP(&imageDryRunSign,
+		"dry-run-sign", "", false, "Report the digest that would be signed "+
+			"and its offset within the image, without writing the image")
+	createImageCmd.PersistentFlags().BoolVarP(&imageCfgHash, "cfg-hash",
+		"", false, "Record a hash of the target's resolved syscfg in the "+
+			"image trailer")
+	createImageCmd.PersistentFlags().BoolVarP(&imageRequireSig,
+		"require-signature", "", false, "Fail if the resulting image does "+
+			"not contain a signature TLV")
+	createImageCmd.PersistentFlags().StringVarP(&imageUf2Family,
+		"uf2-family", "", "", "Also generate a UF2 file for the specified "+
+			"device family (name or numeric ID); overrides the target's "+
+			"target.uf2_family setting")
+	createImageCmd.PersistentFlags().StringVarP(&imageDetachedSig,
+		"detached-sig", "", "", "Prepare the image for signing by an "+
+			"external tool with the specified algorithm (rsa2048 or "+
+			"ecdsa224); the digest is written to <image>.digest")
 	createImageCmd.ValidArgs = targetList()
 	cmd.AddCommand(createImageCmd)
+
+	injectSignatureHelpText := "Add a signature produced by an external " +
+		"signer to an image created with \"create-image --detached-sig\".  " +
+		"The signature file contains the raw signature of the image's " +
+		"digest file: 256 bytes for rsa2048, or an ASN.1-encoded (r, s) " +
+		"pair for ecdsa224.  The image is modified in place; use " +
+		"verify-image to check the result."
+	injectSignatureHelpEx := "  newt inject-signature <image-file> " +
+		"<signature-file>\n"
+	injectSignatureHelpEx += "  newt inject-signature " +
+		"bin/targets/my_target1/app/apps/blinky/blinky.img blinky.sig"
+
+	injectSignatureCmd := &cobra.Command{
+		Use:     "inject-signature",
+		Short:   "Add a detached signature to an image",
+		Long:    injectSignatureHelpText,
+		Example: injectSignatureHelpEx,
+		Run:     injectSignatureRunCmd,
+	}
+	cmd.AddCommand(injectSignatureCmd)
+
+	signingRequestHelpText := "Create a signing request for an image " +
+		"created with \"create-image --detached-sig\".  The request is a " +
+		"JSON document containing the image digest, the image's name, " +
+		"version, key ID, and size, and the requested hash and signature " +
+		"algorithms, for consumption by an external signing authority.  " +
+		"The request is written to <image-file>.sigreq.json unless " +
+		"--output is specified."
+	signingRequestHelpEx := "  newt signing-request <image-file>\n"
+	signingRequestHelpEx += "  newt signing-request " +
+		"bin/targets/my_target1/app/apps/blinky/blinky.img " +
+		"--output blinky.req"
+
+	signingRequestCmd := &cobra.Command{
+		Use:     "signing-request",
+		Short:   "Create a signing request for an external signer",
+		Long:    signingRequestHelpText,
+		Example: signingRequestHelpEx,
+		Run:     signingRequestRunCmd,
+	}
+	signingRequestCmd.PersistentFlags().StringVarP(
+		&imageSigningRequestOutput, "output", "", "",
+		"File to write the signing request to")
+	cmd.AddCommand(signingRequestCmd)
+
+	injectSigningResponseHelpText := "Add the signature from a signing " +
+		"response to the image it was requested for (see " +
+		"signing-request).  The response is a JSON document with hex-" +
+		"encoded \"digest\" and \"signature\" fields; the digest must " +
+		"match the image's.  The image is modified in place; use " +
+		"verify-image to check the result."
+	injectSigningResponseHelpEx := "  newt inject-signing-response " +
+		"<image-file> <response-file>\n"
+	injectSigningResponseHelpEx += "  newt inject-signing-response " +
+		"bin/targets/my_target1/app/apps/blinky/blinky.img blinky.resp"
+
+	injectSigningResponseCmd := &cobra.Command{
+		Use:     "inject-signing-response",
+		Short:   "Add the signature from a signing response to an image",
+		Long:    injectSigningResponseHelpText,
+		Example: injectSigningResponseHelpEx,
+		Run:     injectSigningResponseRunCmd,
+	}
+	cmd.AddCommand(injectSigningResponseCmd)
+
+	compareImagesHelpText := "Compare the payloads of two image files, " +
+		"ignoring their headers and trailers.  This indicates whether the " +
+		"code is unchanged even though the image hash or signature differs."
+	compareImagesHelpEx := "  newt compare-images <image-1> <image-2>\n"
+
+	compareImagesCmd := &cobra.Command{
+		Use:     "compare-images",
+		Short:   "Compare the payloads of two images",
+		Long:    compareImagesHelpText,
+		Example: compareImagesHelpEx,
+		Run:     compareImagesRunCmd,
+	}
+	cmd.AddCommand(compareImagesCmd)
+
+	dumpImageTlvsHelpText := "Print each TLV in the trailer of an image " +
+		"file as raw hex.  TLVs are not interpreted; unknown types are " +
+		"dumped as well."
+	dumpImageTlvsHelpEx := "  newt dump-image-tlvs <image>\n"
+
+	dumpImageTlvsCmd := &cobra.Command{
+		Use:     "dump-image-tlvs",
+		Short:   "Dump the TLVs of an image trailer",
+		Long:    dumpImageTlvsHelpText,
+		Example: dumpImageTlvsHelpEx,
+		Run:     dumpImageTlvsRunCmd,
+	}
+	cmd.AddCommand(dumpImageTlvsCmd)
+
+	verifyImageHelpText := "Verify the signature of an image against a " +
+		"trust store.  The store consists of one or more PEM key files " +
+		"or directories of \"*.pem\" files; RSA and EC keys may be mixed.  " +
+		"The image validates if any trusted key matches its signature.  " +
+		"With --chain, the image is instead verified against a " +
+		"certificate chain: the chain must validate up to a --root CA, " +
+		"each certificate must be current and permitted for its use, and " +
+		"the leaf certificate's key must match the signature."
+	verifyImageHelpEx := "  newt verify-image <image> <key-or-dir> " +
+		"[key-or-dir...]\n"
+	verifyImageHelpEx += "  newt verify-image my_app.img keys/\n"
+	verifyImageHelpEx += "  newt verify-image --chain signer.pem " +
+		"--root root-ca.pem my_app.img"
+
+	verifyImageCmd := &cobra.Command{
+		Use:     "verify-image",
+		Short:   "Verify an image signature against trusted keys",
+		Long:    verifyImageHelpText,
+		Example: verifyImageHelpEx,
+		Run:     verifyImageRunCmd,
+	}
+	verifyImageCmd.PersistentFlags().StringVarP(&imageCertChain, "chain", "",
+		"", "PEM file containing the signing certificate followed by any "+
+			"intermediate CAs; verifies against --root instead of keys")
+	verifyImageCmd.PersistentFlags().StringSliceVarP(&imageRootCerts,
+		"root", "", nil, "PEM file containing trusted root CA "+
+			"certificates (with --chain)")
+	verifyImageCmd.PersistentFlags().StringVarP(&imageMagic, "magic", "",
+		"", "Image header magic the image must carry; overrides the "+
+			"project's project.image_magic setting")
+	cmd.AddCommand(verifyImageCmd)
+
+	createOtaBundleHelpText := "Create a signed descriptor of a set of " +
+		"images for an OTA server.  The descriptor records each image's " +
+		"version, size, and hash, and is signed with <key-file>, a PEM " +
+		"private key or a PKCS#11 URI."
+	createOtaBundleHelpEx := "  newt create-ota-bundle <bundle-file> " +
+		"<key-file> <image> [images...]\n"
+	createOtaBundleHelpEx += "  newt create-ota-bundle bundle.json " +
+		"key.pem app.img boot.img"
+
+	createOtaBundleCmd := &cobra.Command{
+		Use:     "create-ota-bundle",
+		Short:   "Create a signed descriptor of a set of OTA images",
+		Long:    createOtaBundleHelpText,
+		Example: createOtaBundleHelpEx,
+		Run:     createOtaBundleRunCmd,
+	}
+	cmd.AddCommand(createOtaBundleCmd)
+
+	verifyOtaBundleHelpText := "Verify the signature of an OTA bundle " +
+		"descriptor against one or more trusted public keys, and list the " +
+		"images it describes.  Each key argument is a PEM file or a " +
+		"directory of PEM files."
+	verifyOtaBundleHelpEx := "  newt verify-ota-bundle <bundle-file> " +
+		"<key-or-dir> [keys-or-dirs...]\n"
+	verifyOtaBundleHelpEx += "  newt verify-ota-bundle bundle.json keys/"
+
+	verifyOtaBundleCmd := &cobra.Command{
+		Use:     "verify-ota-bundle",
+		Short:   "Verify a signed OTA bundle descriptor",
+		Long:    verifyOtaBundleHelpText,
+		Example: verifyOtaBundleHelpEx,
+		Run:     verifyOtaBundleRunCmd,
+	}
+	cmd.AddCommand(verifyOtaBundleCmd)
+
+	createDeltaHelpText := "Create a delta image that transforms " +
+		"<source-image> into <target-image>.  The delta records the " +
+		"versions and hashes of both images; a device must only apply it " +
+		"to a slot containing the source image."
+	createDeltaHelpEx := "  newt create-delta <source-image> " +
+		"<target-image> <delta-file>\n"
+	createDeltaHelpEx += "  newt create-delta app-1.0.img app-1.1.img " +
+		"app-1.0-1.1.delta"
+
+	createDeltaCmd := &cobra.Command{
+		Use:     "create-delta",
+		Short:   "Create a delta image between two image versions",
+		Long:    createDeltaHelpText,
+		Example: createDeltaHelpEx,
+		Run:     createDeltaRunCmd,
+	}
+	createDeltaCmd.PersistentFlags().StringVarP(&imageDeltaSrcHash,
+		"source-hash", "", "", "Hex hash the source image must have "+
+			"(e.g., as reported by the device)")
+	cmd.AddCommand(createDeltaCmd)
+
+	otaSizeHelpText := "Estimate the number of bytes needed to transfer " +
+		"<image> over the air.  The image size is reported both raw and " +
+		"compressed.  If <previous-image> is specified, the size of a " +
+		"delta from it (see create-delta) is reported as well.  " +
+		"Percentages are relative to the raw image size."
+	otaSizeHelpEx := "  newt ota-size <image> [previous-image]\n"
+	otaSizeHelpEx += "  newt ota-size --compression gzip app-1.1.img " +
+		"app-1.0.img"
+
+	otaSizeCmd := &cobra.Command{
+		Use:     "ota-size",
+		Short:   "Estimate the OTA transfer size of an image",
+		Long:    otaSizeHelpText,
+		Example: otaSizeHelpEx,
+		Run:     otaSizeRunCmd,
+	}
+	otaSizeCmd.PersistentFlags().StringVarP(&imageOtaCompression,
+		"compression", "", image.COMPRESSION_DEFLATE,
+		"Compression method; one of: "+
+			strings.Join(image.CompressionMethods(), ", "))
+	cmd.AddCommand(otaSizeCmd)
+
+	tlvCodesHelpText := "List every TLV type that newt can write to the " +
+		"manufacturing meta region or to an image trailer, along with its " +
+		"code and data size."
+	scanImageSecretsHelpText := "Search an image for data that looks " +
+		"like a key or token that should not ship: PEM blocks, JWTs, " +
+		"cloud credentials, and runs of high-entropy data.  The image " +
+		"header and trailer, which contain hashes and signatures, are " +
+		"searched only for patterns.  Each finding is reported with its " +
+		"offset within the image file and the flash area the image is " +
+		"destined for."
+	scanImageSecretsHelpEx := "  newt scan-image-secrets <image>\n"
+	scanImageSecretsHelpEx += "  newt scan-image-secrets --area " +
+		"FLASH_AREA_IMAGE_1 my_app.img"
+
+	scanImageSecretsCmd := &cobra.Command{
+		Use:     "scan-image-secrets <image>",
+		Short:   "Search an image for embedded secrets",
+		Long:    scanImageSecretsHelpText,
+		Example: scanImageSecretsHelpEx,
+		Run:     scanImageSecretsRunCmd,
+	}
+	scanImageSecretsCmd.PersistentFlags().StringVarP(&imageSecretArea,
+		"area", "", flash.FLASH_AREA_NAME_IMAGE_0,
+		"Flash area the image is destined for")
+	scanImageSecretsCmd.PersistentFlags().Float64VarP(&imageSecretMinEntropy,
+		"min-entropy", "", mfg.SECRET_MIN_ENTROPY,
+		"Minimum entropy (bits/byte) of a window reported as high-entropy "+
+			"data; 0 disables the entropy search")
+	scanImageSecretsCmd.PersistentFlags().StringVarP(&imageMagic, "magic", "",
+		"", "Image header magic the image must carry; overrides the "+
+			"project's project.image_magic setting")
+	cmd.AddCommand(scanImageSecretsCmd)
+
+	checkBootCompatHelpText := "Determine whether a boot loader can boot " +
+		"an app image.  The boot loader is either a newt image or a raw " +
+		"binary.  Its code must reference the app image's header magic, " +
+		"the app image's header must be a valid size, and each of the app " +
+		"image's dependencies on the boot loader must be met by the boot " +
+		"loader's version.  The version is read from the boot loader's " +
+		"image header unless --boot-version is specified."
+	checkBootCompatHelpEx := "  newt check-boot-compat <app-image> " +
+		"<boot-loader>\n"
+	checkBootCompatHelpEx += "  newt check-boot-compat --boot-version 1.2.0 " +
+		"my_app.img boot.elf.bin"
+
+	checkBootCompatCmd := &cobra.Command{
+		Use:     "check-boot-compat <app-image> <boot-loader>",
+		Short:   "Verify that a boot loader can boot an app image",
+		Long:    checkBootCompatHelpText,
+		Example: checkBootCompatHelpEx,
+		Run:     checkBootCompatRunCmd,
+	}
+	checkBootCompatCmd.PersistentFlags().StringVarP(&imageBootVersion,
+		"boot-version", "", "", "Version of the boot loader; required if "+
+			"the boot loader is a raw binary and the app depends on it")
+	checkBootCompatCmd.PersistentFlags().StringVarP(&imageBootDepName,
+		"dep-name", "", image.BOOT_DEP_NAME,
+		"Component name by which the app's dependencies refer to the boot "+
+			"loader")
+	cmd.AddCommand(checkBootCompatCmd)
+
+	checkImageSetHelpText := "Cross-validate a set of artifacts intended " +
+		"to be deployed together: a boot loader, an app image to be " +
+		"delivered as a field update, and optionally the manifest of the " +
+		"mfg image the devices were manufactured with.  The boot loader " +
+		"must be able to boot the app (see check-boot-compat), all " +
+		"artifacts must agree on the system flash areas, the image slots " +
+		"must be the same size and large enough for the app, and the mfg " +
+		"image must contain the same boot loader build.  Flash maps are " +
+		"read from the manifest.json files that newt writes alongside the " +
+		"boot loader and app images."
+	checkImageSetHelpEx := "  newt check-image-set <boot-loader> " +
+		"<app-image> [mfg-manifest]\n"
+	checkImageSetHelpEx += "  newt check-image-set " +
+		"bin/targets/my_boot/app/@mcuboot/boot/mynewt/mynewt.img " +
+		"bin/targets/my_app/app/apps/my_app/my_app.img " +
+		"bin/mfgs/my_mfg/manifest.json"
+
+	checkImageSetCmd := &cobra.Command{
+		Use:     "check-image-set <boot-loader> <app-image> [mfg-manifest]",
+		Short:   "Verify that a boot loader, app, and mfg image are consistent",
+		Long:    checkImageSetHelpText,
+		Example: checkImageSetHelpEx,
+		Run:     checkImageSetRunCmd,
+	}
+	cmd.AddCommand(checkImageSetCmd)
+
+	checkImageHashHelpText := "Calculate the hash of <image> (the SHA256 " +
+		"of its header and payload, as recorded in its hash TLV) and " +
+		"compare it against <expected-hash>, a hex-encoded value such as " +
+		"one stored by an OTA server.  The calculated hash is displayed " +
+		"either way.  The hash of the second half of a split image covers " +
+		"its loader, so such images cannot be checked."
+	checkImageHashHelpEx := "  newt check-image-hash <image> " +
+		"<expected-hash>\n"
+	checkImageHashHelpEx += "  newt check-image-hash my_app.img " +
+		"3e0d4c...9a21"
+
+	checkImageHashCmd := &cobra.Command{
+		Use:     "check-image-hash <image> <expected-hash>",
+		Short:   "Verify an image's hash against an expected value",
+		Long:    checkImageHashHelpText,
+		Example: checkImageHashHelpEx,
+		Run:     checkImageHashRunCmd,
+	}
+	checkImageHashCmd.PersistentFlags().StringVarP(&imageMagic, "magic", "",
+		"", "Image header magic the image must carry; overrides the "+
+			"project's project.image_magic setting")
+	cmd.AddCommand(checkImageHashCmd)
+
+	checkImageVersionHelpText := "Ensure that each version TLV in " +
+		"<image>'s trailer records the same version as the image header.  " +
+		"Tools that read the version from different places otherwise " +
+		"report conflicting information.  An image without a version TLV " +
+		"passes.  verify-image performs the same check."
+	checkImageVersionHelpEx := "  newt check-image-version my_app.img"
+
+	checkImageVersionCmd := &cobra.Command{
+		Use:     "check-image-version <image>",
+		Short:   "Verify that an image's version TLVs match its header",
+		Long:    checkImageVersionHelpText,
+		Example: checkImageVersionHelpEx,
+		Run:     checkImageVersionRunCmd,
+	}
+	checkImageVersionCmd.PersistentFlags().StringVarP(&imageMagic, "magic",
+		"", "", "Image header magic the image must carry; overrides the "+
+			"project's project.image_magic setting")
+	cmd.AddCommand(checkImageVersionCmd)
+
+	tlvCodesHelpEx := "  newt tlv-codes\n"
+
+	tlvCodesCmd := &cobra.Command{
+		Use:     "tlv-codes",
+		Short:   "List the TLV codes newt can emit",
+		Long:    tlvCodesHelpText,
+		Example: tlvCodesHelpEx,
+		Run:     tlvCodesRunCmd,
+	}
+	cmd.AddCommand(tlvCodesCmd)
+
+	checkVersionHelpText := "Check that a version string is suitable for " +
+		"an image header.  A version has the form " +
+		"major[.minor[.revision[.build]]]; omitted components are zero.  " +
+		"The major and minor components must not exceed 255, the " +
+		"revision 65535, and the build number 4294967295."
+	checkVersionHelpEx := "  newt check-version 1.2.3.4\n"
+
+	checkVersionCmd := &cobra.Command{
+		Use:     "check-version <version>",
+		Short:   "Validate an image version string",
+		Long:    checkVersionHelpText,
+		Example: checkVersionHelpEx,
+		Run:     checkVersionRunCmd,
+	}
+	cmd.AddCommand(checkVersionCmd)
 }
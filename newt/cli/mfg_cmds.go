@@ -20,6 +20,13 @@
 package cli
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
 	"github.com/spf13/cobra"
 
 	"mynewt.apache.org/newt/newt/mfg"
@@ -27,6 +34,68 @@ import (
 	"mynewt.apache.org/newt/util"
 )
 
+// Environment variable consulted for the mfg HMAC key when --hmac-key is not
+// specified.
+const MFG_HMAC_KEY_ENV = "NEWT_MFG_HMAC_KEY"
+
+var mfgHmacKey string
+var mfgSerialCount int
+var mfgSerialFile string
+var mfgSrec bool
+var mfgChunkSize string
+var mfgCompress string
+var mfgCompressDict string
+var mfgDryRunSign bool
+var mfgDiffHash bool
+var mfgScriptTool string
+var mfgMinEntropy float64
+var mfgBootCheckDump string
+var mfgDeviceBases []string
+var mfgGoldenDevice int
+var mfgHashOffset string
+var mfgGoldenIgnore []string
+var mfgGoldenIgnoreAreas []string
+var mfgSecretMinEntropy float64
+var mfgTlvOrder []string
+var mfgCheckDumpDevice int
+
+// Determines the HMAC key to use for the mfg meta region.  The key is a hex
+// string; nil is returned if no key was specified.
+func mfgResolveHmacKey() ([]byte, error) {
+	keyStr := mfgHmacKey
+	if keyStr == "" {
+		keyStr = os.Getenv(MFG_HMAC_KEY_ENV)
+	}
+
+	keyStr = strings.TrimPrefix(strings.TrimSpace(keyStr), "0x")
+	if keyStr == "" {
+		return nil, nil
+	}
+
+	key, err := hex.DecodeString(keyStr)
+	if err != nil {
+		return nil, util.FmtNewtError(
+			"Invalid mfg HMAC key; must be a hex string: %s", err.Error())
+	}
+
+	return key, nil
+}
+
+func loadMfgImage(lpkg *pkg.LocalPackage) (*mfg.MfgImage, error) {
+	mi, err := mfg.Load(lpkg)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := mfgResolveHmacKey()
+	if err != nil {
+		return nil, err
+	}
+	mi.SetHmacKey(key)
+
+	return mi, nil
+}
+
 func ResolveMfgPkg(pkgName string) (*pkg.LocalPackage, error) {
 	proj := InitProject()
 
@@ -59,7 +128,18 @@ func mfgCreate(mi *mfg.MfgImage) {
 		"Creating a manufacturing image from the following files:\n%s\n",
 		pathStr)
 
-	outputPaths, err := mi.CreateMfgImage()
+	var outputPaths []string
+	var err error
+	if mfgSerialCount > 0 {
+		if mfgSerialFile == "" {
+			NewtUsage(nil, util.NewNewtError(
+				"--serial-count requires --serial-file"))
+		}
+		outputPaths, err = mi.CreateSerialMfgImages(mfgSerialCount,
+			mfg.CounterFileSerialSource(mfgSerialFile))
+	} else {
+		outputPaths, err = mi.CreateMfgImage()
+	}
 	if err != nil {
 		NewtUsage(nil, err)
 	}
@@ -72,6 +152,21 @@ func mfgCreate(mi *mfg.MfgImage) {
 		"Generated the following files:\n%s", pathStr)
 }
 
+func mfgDryRun(mi *mfg.MfgImage) {
+	digest, offset, err := mi.SealDigest()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Dry run; no files written.  Meta hash: %x\n"+
+			"    stored in section 0 at offset 0x%x\n", digest, offset)
+	if sealCmd := mi.SealCmd(); sealCmd != "" {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"    would be sealed by: %s %x\n", sealCmd, digest)
+	}
+}
+
 func mfgLoad(mi *mfg.MfgImage) {
 	binPath, err := mi.Upload()
 	if err != nil {
@@ -93,11 +188,43 @@ func mfgCreateRunCmd(cmd *cobra.Command, args []string) {
 		NewtUsage(cmd, err)
 	}
 
-	mi, err := mfg.Load(lpkg)
+	mi, err := loadMfgImage(lpkg)
 	if err != nil {
 		NewtUsage(nil, err)
 	}
 
+	if mfgSrec {
+		mi.EnableSrec()
+	}
+
+	if mfgChunkSize != "" {
+		size, err := util.AtoiNoOct(mfgChunkSize)
+		if err != nil || size <= 0 {
+			NewtUsage(cmd, util.FmtNewtError(
+				"Invalid chunk size: %s", mfgChunkSize))
+		}
+		mi.SetChunkSize(size)
+	}
+
+	if mfgCompress != "" || mfgCompressDict != "" {
+		algo := mfgCompress
+		if algo == "" {
+			algo = mi.CompressAlgo()
+		}
+		if err := mi.SetCompression(algo, mfgCompressDict); err != nil {
+			NewtUsage(cmd, err)
+		}
+	}
+
+	if mfgDryRunSign {
+		if mfgSerialCount > 0 {
+			NewtUsage(cmd, util.NewNewtError(
+				"--dry-run-sign cannot be combined with --serial-count"))
+		}
+		mfgDryRun(mi)
+		return
+	}
+
 	mfgCreate(mi)
 }
 
@@ -112,7 +239,7 @@ func mfgLoadRunCmd(cmd *cobra.Command, args []string) {
 		NewtUsage(cmd, err)
 	}
 
-	mi, err := mfg.Load(lpkg)
+	mi, err := loadMfgImage(lpkg)
 	if err != nil {
 		NewtUsage(nil, err)
 	}
@@ -131,7 +258,7 @@ func mfgDeployRunCmd(cmd *cobra.Command, args []string) {
 		NewtUsage(cmd, err)
 	}
 
-	mi, err := mfg.Load(lpkg)
+	mi, err := loadMfgImage(lpkg)
 	if err != nil {
 		NewtUsage(nil, err)
 	}
@@ -140,42 +267,1067 @@ func mfgDeployRunCmd(cmd *cobra.Command, args []string) {
 	mfgLoad(mi)
 }
 
-func AddMfgCommands(cmd *cobra.Command) {
-	mfgHelpText := ""
-	mfgHelpEx := ""
-	mfgCmd := &cobra.Command{
-		Use:     "mfg",
-		Short:   "Manufacturing flash image commands",
-		Long:    mfgHelpText,
-		Example: mfgHelpEx,
-		Run: func(cmd *cobra.Command, args []string) {
-			cmd.Usage()
-		},
+func mfgLayoutRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify mfg package name"))
 	}
 
-	cmd.AddCommand(mfgCmd)
+	pkgName := args[0]
+	lpkg, err := ResolveMfgPkg(pkgName)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
 
-	mfgCreateCmd := &cobra.Command{
-		Use:       "create <mfg-package-name>",
-		Short:     "Create a manufacturing flash image",
-		Run:       mfgCreateRunCmd,
-		ValidArgs: mfgList(),
+	mi, err := loadMfgImage(lpkg)
+	if err != nil {
+		NewtUsage(nil, err)
 	}
-	mfgCmd.AddCommand(mfgCreateCmd)
 
-	mfgLoadCmd := &cobra.Command{
-		Use:       "load <mfg-package-name>",
-		Short:     "Load a manufacturing flash image onto a device",
-		Run:       mfgLoadRunCmd,
-		ValidArgs: mfgList(),
+	layout, err := mi.MetaLayout()
+	if err != nil {
+		NewtUsage(nil, err)
 	}
-	mfgCmd.AddCommand(mfgLoadCmd)
 
-	mfgDeployCmd := &cobra.Command{
-		Use:       "deploy <mfg-package-name>",
-		Short:     "Builds and uploads a manufacturing image (build + load)",
-		Run:       mfgDeployRunCmd,
-		ValidArgs: mfgList(),
+	buf, err := json.MarshalIndent(layout, "", "  ")
+	if err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
 	}
-	mfgCmd.AddCommand(mfgDeployCmd)
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "%s\n", string(buf))
+}
+
+func mfgFlashMapRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify flash dump filename"))
+	}
+
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+
+	policy, err := mfg.ParseMetaOrderPolicy(mfgTlvOrder)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	meta, err := mfg.ParseMeta(data)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+	if err := meta.CheckOrder(policy); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	flashMap, err := meta.FlashMap()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	bases, err := mfg.ParseDeviceBases(mfgDeviceBases)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Meta region found at offset 0x%x (%d bytes)\n",
+		meta.Offset, meta.Size)
+	for _, area := range flashMap.SortedAreas() {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"%-32s id=%-3d device=%d offset=0x%08x size=0x%x addr=0x%08x\n",
+			area.Name, area.Id, area.Device, area.Offset, area.Size,
+			bases[area.Device]+area.Offset)
+	}
+
+	if errText := flashMap.ErrorText(); errText != "" {
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s", errText)
+	}
+}
+
+func mfgUpdateRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify mfg package name and flash area name"))
+	}
+
+	pkgName := args[0]
+	lpkg, err := ResolveMfgPkg(pkgName)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	mi, err := loadMfgImage(lpkg)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	outputPaths, err := mi.UpdateArea(args[1])
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	pathStr := ""
+	for _, path := range outputPaths {
+		pathStr += "    * " + path + "\n"
+	}
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Updated the following files:\n%s", pathStr)
+}
+
+func mfgVerifyRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify mfg package name"))
+	}
+
+	pkgName := args[0]
+	lpkg, err := ResolveMfgPkg(pkgName)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	mi, err := loadMfgImage(lpkg)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	problems, err := mi.Verify()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if len(problems) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Manufacturing image %s verified successfully\n", lpkg.Name())
+		return
+	}
+
+	errText := fmt.Sprintf("Manufacturing image %s failed verification:\n",
+		lpkg.Name())
+	for _, p := range problems {
+		errText += fmt.Sprintf("    * %s\n", p.String())
+	}
+	NewtUsage(nil, util.NewNewtError(strings.TrimSpace(errText)))
+}
+
+func mfgSectorsRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify mfg package name"))
+	}
+
+	pkgName := args[0]
+	lpkg, err := ResolveMfgPkg(pkgName)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	mi, err := loadMfgImage(lpkg)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	ranges, err := mi.SectorRanges()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	for _, r := range ranges {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"device=%d sectors=%d-%d offset=0x%08x size=0x%x\n",
+			r.Device, r.First, r.Last, r.Offset, r.Size)
+	}
+}
+
+func mfgEntropyRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify mfg package name"))
+	}
+
+	pkgName := args[0]
+	lpkg, err := ResolveMfgPkg(pkgName)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	mi, err := loadMfgImage(lpkg)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	entropies, err := mi.AreaEntropies(mfgMinEntropy)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	low := []string{}
+	for _, ae := range entropies {
+		note := ""
+		if ae.ExpectEncrypted {
+			note = " (expected encrypted)"
+		}
+		if ae.Low {
+			note = " (LOW; expected encrypted)"
+			low = append(low, ae.Area)
+		}
+
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"%s: device=%d size=%d entropy=%.3f%s\n",
+			ae.Area, ae.Device, ae.Size, ae.Entropy, note)
+	}
+
+	if len(low) > 0 {
+		NewtUsage(nil, util.FmtNewtError(
+			"Flash areas expected to be encrypted have entropy below %.2f "+
+				"bits/byte: %s", mfgMinEntropy, strings.Join(low, ", ")))
+	}
+}
+
+func mfgSecretsRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify mfg package name"))
+	}
+
+	pkgName := args[0]
+	lpkg, err := ResolveMfgPkg(pkgName)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	mi, err := loadMfgImage(lpkg)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	findings, err := mi.ScanSecrets(mfgSecretMinEntropy)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if len(findings) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"No secrets found in manufacturing image %s\n", pkgName)
+		return
+	}
+
+	errText := fmt.Sprintf(
+		"Manufacturing image %s contains possible secrets:\n", pkgName)
+	for _, f := range findings {
+		errText += fmt.Sprintf("    * %s\n", f.String())
+	}
+	NewtUsage(nil, util.NewNewtError(strings.TrimSpace(errText)))
+}
+
+func mfgTestVectorsRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify output directory"))
+	}
+
+	jsonPath, vecs, err := mfg.WriteMetaVectors(args[0])
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	for _, vec := range vecs {
+		util.StatusMessage(util.VERBOSITY_VERBOSE, "    %s (%d bytes)\n",
+			vec.File, vec.Size)
+	}
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Wrote %d meta region test vectors; description: %s\n", len(vecs),
+		jsonPath)
+}
+
+func mfgMapRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify mfg package name"))
+	}
+
+	pkgName := args[0]
+	lpkg, err := ResolveMfgPkg(pkgName)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	mi, err := loadMfgImage(lpkg)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	path, err := mi.WriteMapFile()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Wrote manufacturing image map to %s\n", path)
+}
+
+func mfgMetaSymbolsRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify mfg package name"))
+	}
+
+	pkgName := args[0]
+	lpkg, err := ResolveMfgPkg(pkgName)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	mi, err := loadMfgImage(lpkg)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	paths, err := mi.WriteMetaSymbols()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	pathStr := ""
+	for _, path := range paths {
+		pathStr += "    * " + path + "\n"
+	}
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Wrote the following files:\n%s", pathStr)
+}
+
+func mfgSimulateRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify mfg package name"))
+	}
+
+	pkgName := args[0]
+	lpkg, err := ResolveMfgPkg(pkgName)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	mi, err := loadMfgImage(lpkg)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	problems, err := mi.SimulateFlash()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if len(problems) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Meta region intact after simulated flash write\n")
+		return
+	}
+
+	errText := fmt.Sprintf("Manufacturing image %s failed flash "+
+		"simulation:\n", lpkg.Name())
+	for _, p := range problems {
+		errText += fmt.Sprintf("    * %s\n", p.String())
+	}
+	NewtUsage(nil, util.NewNewtError(strings.TrimSpace(errText)))
+}
+
+func mfgEmptyAreasRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify mfg package name"))
+	}
+
+	pkgName := args[0]
+	lpkg, err := ResolveMfgPkg(pkgName)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	mi, err := loadMfgImage(lpkg)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	empty, err := mi.EmptyAreas()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if len(empty) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"No flash areas left erased\n")
+		return
+	}
+
+	for _, ea := range empty {
+		note := "never populated"
+		if ea.Intentional {
+			note = "intentionally empty"
+		}
+
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"%s: device=%d offset=0x%x size=%d (%s)\n",
+			ea.Area, ea.Device, ea.Offset, ea.Size, note)
+	}
+}
+
+func mfgUnreferencedAreasRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify mfg package name"))
+	}
+
+	pkgName := args[0]
+	lpkg, err := ResolveMfgPkg(pkgName)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	mi, err := loadMfgImage(lpkg)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	unrefd, err := mi.UnreferencedAreas()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if len(unrefd) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"No unreferenced flash areas\n")
+		return
+	}
+
+	for _, area := range unrefd {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"Warning: flash area %s (device=%d offset=0x%x size=%d) is "+
+				"neither populated nor referenced by syscfg\n",
+			area.Name, area.Device, area.Offset, area.Size)
+	}
+}
+
+func mfgBootCheckRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify mfg package name"))
+	}
+
+	pkgName := args[0]
+	lpkg, err := ResolveMfgPkg(pkgName)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	mi, err := loadMfgImage(lpkg)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if !mi.HasBootMagic() {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"Warning: BSP does not specify bsp.boot_magic; only checking "+
+				"for empty boot areas\n")
+	}
+
+	problems, err := mi.CheckBoot(mfgBootCheckDump)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if len(problems) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Boot loader present in all boot areas\n")
+		return
+	}
+
+	errText := fmt.Sprintf("Manufacturing image %s failed boot check:\n",
+		lpkg.Name())
+	for _, p := range problems {
+		errText += fmt.Sprintf("    * %s\n", p.String())
+	}
+	NewtUsage(nil, util.NewNewtError(strings.TrimSpace(errText)))
+}
+
+func mfgDiffRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		NewtUsage(cmd,
+			util.NewNewtError("Must specify two flash dump filenames"))
+	}
+
+	metas := make([]mfg.Meta, 2)
+	for i, filename := range args[:2] {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			NewtUsage(nil, util.ChildNewtError(err))
+		}
+
+		metas[i], err = mfg.ParseMeta(data)
+		if err != nil {
+			NewtUsage(nil, util.FmtNewtError("%s: %s", filename, err.Error()))
+		}
+	}
+
+	diffs := mfg.DiffMeta(metas[0], metas[1], mfgDiffHash)
+	if len(diffs) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Meta regions are identical\n")
+		return
+	}
+
+	for _, diff := range diffs {
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s\n", diff)
+	}
+}
+
+func mfgGoldenRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify mfg package name and golden image filename"))
+	}
+
+	pkgName := args[0]
+	lpkg, err := ResolveMfgPkg(pkgName)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	mi, err := loadMfgImage(lpkg)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	ignore := []mfg.GoldenRegion{}
+	for _, s := range mfgGoldenIgnore {
+		r, err := mfg.ParseGoldenRegion(s)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+		ignore = append(ignore, r)
+	}
+	for _, name := range mfgGoldenIgnoreAreas {
+		device, r, err := mi.AreaGoldenRegion(name)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+		if device == mfgGoldenDevice {
+			ignore = append(ignore, r)
+		}
+	}
+
+	mismatch, err := mi.CompareGolden(mfgGoldenDevice, args[1], ignore)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if mismatch != nil {
+		NewtUsage(nil, util.FmtNewtError(
+			"Manufacturing image %s does not match golden image %s; %s",
+			lpkg.Name(), args[1], mismatch.String()))
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Manufacturing image %s matches golden image %s (%d regions "+
+			"ignored)\n", lpkg.Name(), args[1], len(ignore))
+}
+
+func mfgCheckDumpRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify mfg package name and flash dump filename"))
+	}
+
+	pkgName := args[0]
+	lpkg, err := ResolveMfgPkg(pkgName)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	mi, err := loadMfgImage(lpkg)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	mismatches, err := mi.CheckDump(mfgCheckDumpDevice, args[1])
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if len(mismatches) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Flash dump %s matches manufacturing image %s\n",
+			args[1], lpkg.Name())
+		return
+	}
+
+	errText := fmt.Sprintf(
+		"Flash dump %s does not match manufacturing image %s:\n",
+		args[1], lpkg.Name())
+	for _, m := range mismatches {
+		errText += fmt.Sprintf("    * %s\n", m.String())
+	}
+	NewtUsage(nil, util.NewNewtError(strings.TrimSpace(errText)))
+}
+
+func mfgHashOffsetRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify mfg package name"))
+	}
+
+	pkgName := args[0]
+	lpkg, err := ResolveMfgPkg(pkgName)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	mi, err := loadMfgImage(lpkg)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	expected := -1
+	if mfgHashOffset != "" {
+		expected, err = util.AtoiNoOct(mfgHashOffset)
+		if err != nil || expected < 0 {
+			NewtUsage(cmd, util.FmtNewtError(
+				"Invalid hash offset: %s", mfgHashOffset))
+		}
+	}
+
+	off, err := mi.CheckHashOffset(expected)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Meta hash offset of %s is stable at 0x%x\n", lpkg.Name(), off)
+}
+
+func mfgScriptRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify mfg package name"))
+	}
+
+	pkgName := args[0]
+	lpkg, err := ResolveMfgPkg(pkgName)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	mi, err := loadMfgImage(lpkg)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	script, err := mi.FlashScript(mfgScriptTool)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_QUIET, "%s", script)
+}
+
+func mfgCArrayRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify mfg package name"))
+	}
+
+	pkgName := args[0]
+	lpkg, err := ResolveMfgPkg(pkgName)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	mi, err := loadMfgImage(lpkg)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	src, err := mi.MetaCArray()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_QUIET, "%s", src)
+}
+
+func AddMfgCommands(cmd *cobra.Command) {
+	mfgHelpText := ""
+	mfgHelpEx := ""
+	mfgCmd := &cobra.Command{
+		Use:     "mfg",
+		Short:   "Manufacturing flash image commands",
+		Long:    mfgHelpText,
+		Example: mfgHelpEx,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+		},
+	}
+
+	cmd.AddCommand(mfgCmd)
+
+	mfgCreateCmd := &cobra.Command{
+		Use:       "create <mfg-package-name>",
+		Short:     "Create a manufacturing flash image",
+		Run:       mfgCreateRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgCreateCmd.PersistentFlags().StringVarP(&mfgHmacKey, "hmac-key", "",
+		"", "Hex key for the meta region HMAC (default: $"+
+			MFG_HMAC_KEY_ENV+")")
+	mfgCreateCmd.PersistentFlags().IntVarP(&mfgSerialCount, "serial-count",
+		"", 0, "Number of serialized image copies to create")
+	mfgCreateCmd.PersistentFlags().StringVarP(&mfgSerialFile, "serial-file",
+		"", "", "Counter file from which serial numbers are allocated")
+	mfgCreateCmd.PersistentFlags().BoolVarP(&mfgSrec, "srec", "", false,
+		"Also write the image as a Motorola S-record file (as with "+
+			"mfg.srec)")
+	mfgCreateCmd.PersistentFlags().BoolVarP(&mfgDryRunSign, "dry-run-sign",
+		"", false, "Report the meta hash that would be sealed and its "+
+			"offset, without running the sealing tool or writing the image")
+	mfgCreateCmd.PersistentFlags().StringVarP(&mfgChunkSize, "chunk-size",
+		"", "", "Also write the image as chunk files of the specified size, "+
+			"with an index of each chunk's address and CRC (as with "+
+			"mfg.chunk_size)")
+	mfgCreateCmd.PersistentFlags().StringVarP(&mfgCompress, "compress", "",
+		"", "Also write each section compressed with the specified "+
+			"algorithm (zstd) (as with mfg.compression)")
+	mfgCreateCmd.PersistentFlags().StringVarP(&mfgCompressDict,
+		"compress-dict", "", "", "Dictionary to compress the sections with "+
+			"(as with mfg.compression_dict)")
+	mfgCmd.AddCommand(mfgCreateCmd)
+
+	mfgUpdateHelpText := "Rebuild a previously created manufacturing " +
+		"image after the image in one slot has changed.  Only the " +
+		"specified flash area (FLASH_AREA_IMAGE_0 or FLASH_AREA_IMAGE_1) " +
+		"is rewritten; the meta region's hash, HMAC, and CRCs are " +
+		"recalculated."
+
+	mfgUpdateCmd := &cobra.Command{
+		Use:       "update <mfg-package-name> <flash-area-name>",
+		Short:     "Rewrite one image slot of a manufacturing image",
+		Long:      mfgUpdateHelpText,
+		Run:       mfgUpdateRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgUpdateCmd.PersistentFlags().StringVarP(&mfgHmacKey, "hmac-key", "",
+		"", "Hex key for the meta region HMAC (default: $"+
+			MFG_HMAC_KEY_ENV+")")
+	mfgCmd.AddCommand(mfgUpdateCmd)
+
+	mfgLoadCmd := &cobra.Command{
+		Use:       "load <mfg-package-name>",
+		Short:     "Load a manufacturing flash image onto a device",
+		Run:       mfgLoadRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgLoadCmd.PersistentFlags().StringVarP(&mfgHmacKey, "hmac-key", "",
+		"", "Hex key for the meta region HMAC (default: $"+
+			MFG_HMAC_KEY_ENV+")")
+	mfgCmd.AddCommand(mfgLoadCmd)
+
+	mfgDeployCmd := &cobra.Command{
+		Use:       "deploy <mfg-package-name>",
+		Short:     "Builds and uploads a manufacturing image (build + load)",
+		Run:       mfgDeployRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgDeployCmd.PersistentFlags().StringVarP(&mfgHmacKey, "hmac-key", "",
+		"", "Hex key for the meta region HMAC (default: $"+
+			MFG_HMAC_KEY_ENV+")")
+	mfgCmd.AddCommand(mfgDeployCmd)
+
+	mfgLayoutCmd := &cobra.Command{
+		Use:       "layout <mfg-package-name>",
+		Short:     "Display the layout of the manufacturing meta region (JSON)",
+		Run:       mfgLayoutRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgLayoutCmd.PersistentFlags().StringVarP(&mfgHmacKey, "hmac-key", "",
+		"", "Hex key for the meta region HMAC (default: $"+
+			MFG_HMAC_KEY_ENV+")")
+	mfgCmd.AddCommand(mfgLayoutCmd)
+
+	mfgFlashMapCmd := &cobra.Command{
+		Use:   "flashmap <flash-dump-file>",
+		Short: "Reconstruct the flash map from a raw flash dump",
+		Run:   mfgFlashMapRunCmd,
+	}
+	mfgFlashMapCmd.PersistentFlags().StringSliceVarP(&mfgDeviceBases,
+		"device-base", "", nil, "Programming base of a flash device, as "+
+			"<device>=<base>; used to compute absolute addresses "+
+			"(default: 0)")
+	mfgFlashMapCmd.PersistentFlags().StringSliceVarP(&mfgTlvOrder,
+		"tlv-order", "", nil, "TLV ordering rule the meta region must "+
+			"obey ("+mfg.META_ORDER_HASH_LAST+" or "+
+			mfg.META_ORDER_FLASH_AREAS_CONTIGUOUS+"); may be repeated")
+	mfgCmd.AddCommand(mfgFlashMapCmd)
+
+	mfgVerifyCmd := &cobra.Command{
+		Use:       "verify <mfg-package-name>",
+		Short:     "Verify a manufacturing image against its manifest",
+		Run:       mfgVerifyRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgVerifyCmd.PersistentFlags().StringVarP(&mfgHmacKey, "hmac-key", "",
+		"", "Hex key for the meta region HMAC (default: $"+
+			MFG_HMAC_KEY_ENV+")")
+	mfgCmd.AddCommand(mfgVerifyCmd)
+
+	mfgSectorsCmd := &cobra.Command{
+		Use:       "sectors <mfg-package-name>",
+		Short:     "List the flash sectors written by a manufacturing image",
+		Run:       mfgSectorsRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgCmd.AddCommand(mfgSectorsCmd)
+
+	mfgEntropyHelpText := "Calculate the Shannon entropy, in bits per " +
+		"byte, of the data a manufacturing image writes to each flash " +
+		"area.  Erased flash at the end of an area is not measured.  " +
+		"Areas listed in mfg.encrypted_areas whose entropy falls below " +
+		"the minimum are reported as errors, since they likely contain " +
+		"unencrypted data.  The image must already have been created."
+
+	mfgEntropyCmd := &cobra.Command{
+		Use:       "entropy <mfg-package-name>",
+		Short:     "Display the entropy of each flash area",
+		Long:      mfgEntropyHelpText,
+		Run:       mfgEntropyRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgEntropyCmd.PersistentFlags().Float64VarP(&mfgMinEntropy,
+		"min-entropy", "", mfg.ENTROPY_MIN_ENCRYPTED,
+		"Minimum entropy (bits/byte) of areas expected to be encrypted")
+	mfgCmd.AddCommand(mfgEntropyCmd)
+
+	mfgSecretsHelpText := "Search a manufacturing image for data that " +
+		"looks like a key or token that should not ship: PEM blocks, " +
+		"JWTs, cloud credentials, and runs of high-entropy data.  The meta " +
+		"region, image headers and trailers, and areas listed in " +
+		"mfg.encrypted_areas are searched only for patterns.  Each finding " +
+		"is reported with its offset and the flash area containing it.  " +
+		"The image must already have been created."
+
+	mfgSecretsCmd := &cobra.Command{
+		Use:       "secrets <mfg-package-name>",
+		Short:     "Search a manufacturing image for embedded secrets",
+		Long:      mfgSecretsHelpText,
+		Run:       mfgSecretsRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgSecretsCmd.PersistentFlags().Float64VarP(&mfgSecretMinEntropy,
+		"min-entropy", "", mfg.SECRET_MIN_ENTROPY,
+		"Minimum entropy (bits/byte) of a window reported as high-entropy "+
+			"data; 0 disables the entropy search")
+	mfgCmd.AddCommand(mfgSecretsCmd)
+
+	mfgTestVectorsHelpText := "Write a set of manufacturing meta region " +
+		"test vectors to <output-dir>, for testing boot loader parsers.  " +
+		"The vectors cover several flash area counts, regions with and " +
+		"without a hash TLV (the latter being secondary regions of a " +
+		"chained layout), regions with every optional TLV, and both byte " +
+		"orders.  Each vector is written as a binary file; " +
+		mfg.META_VECTORS_JSON_NAME + " describes the expected parse results " +
+		"of each.  Little endian vectors are parsed back and checked " +
+		"against their descriptions before they are written."
+
+	mfgTestVectorsCmd := &cobra.Command{
+		Use:   "test-vectors <output-dir>",
+		Short: "Generate meta region test vectors",
+		Long:  mfgTestVectorsHelpText,
+		Run:   mfgTestVectorsRunCmd,
+	}
+	mfgCmd.AddCommand(mfgTestVectorsCmd)
+
+	mfgMapHelpText := "Write a text file that maps each byte range of a " +
+		"manufacturing image to its source: the boot loader, an image " +
+		"slot, a raw entry, the meta region, or erased flash.  The image " +
+		"must already have been created."
+
+	mfgMapCmd := &cobra.Command{
+		Use:       "map <mfg-package-name>",
+		Short:     "Write a map of a manufacturing image's contents",
+		Long:      mfgMapHelpText,
+		Run:       mfgMapRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgCmd.AddCommand(mfgMapCmd)
+
+	mfgMetaSymbolsHelpText := "Write a linker script fragment " +
+		"(mfg_meta.ld) and a C header (mfg_meta.h) that locate the " +
+		"manufacturing meta region, so that a running image can read it.  " +
+		"The symbols give the region's flash device, offset, size, and " +
+		"absolute address (including mfg.device_base.<device>).  Setting " +
+		"mfg.meta_symbols in mfg.yml writes these files whenever the " +
+		"manufacturing image is created."
+
+	mfgMetaSymbolsCmd := &cobra.Command{
+		Use:       "meta-symbols <mfg-package-name>",
+		Short:     "Write linker symbols locating the meta region",
+		Long:      mfgMetaSymbolsHelpText,
+		Run:       mfgMetaSymbolsRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgCmd.AddCommand(mfgMetaSymbolsCmd)
+
+	mfgSimulateHelpText := "Simulate programming a created manufacturing " +
+		"image into erased flash, sized from the BSP's flash map, then " +
+		"read the meta region back from the simulated flash as a device " +
+		"would.  The region must be found where the flash map places it, " +
+		"must match the built image, and its flash areas must match the " +
+		"BSP's flash map."
+
+	mfgSimulateCmd := &cobra.Command{
+		Use:       "simulate <mfg-package-name>",
+		Short:     "Check the meta region in a simulated flash write",
+		Long:      mfgSimulateHelpText,
+		Run:       mfgSimulateRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgCmd.AddCommand(mfgSimulateCmd)
+
+	mfgEmptyAreasHelpText := "List the flash areas that a manufacturing " +
+		"image leaves erased; i.e., whose content in the image is " +
+		"entirely the device's erase value.  Areas listed in " +
+		"mfg.empty_areas are reported as intentionally empty; all others " +
+		"as never populated.  The image must already have been created."
+
+	mfgEmptyAreasCmd := &cobra.Command{
+		Use:       "empty-areas <mfg-package-name>",
+		Short:     "List flash areas left erased by an mfg image",
+		Long:      mfgEmptyAreasHelpText,
+		Run:       mfgEmptyAreasRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgCmd.AddCommand(mfgEmptyAreasCmd)
+
+	mfgUnreferencedAreasHelpText := "List the flash areas in the " +
+		"BSP's flash map that nothing uses: the manufacturing image " +
+		"leaves them erased, the mfg package does not use them as boot, " +
+		"placeholder, or meta chain areas or list them in " +
+		"mfg.empty_areas, and no syscfg setting of the boot loader or any " +
+		"image names them.  Such an area often indicates a configuration " +
+		"mistake.  System areas are not reported.  The image must already " +
+		"have been created."
+
+	mfgUnreferencedAreasCmd := &cobra.Command{
+		Use:       "unreferenced-areas <mfg-package-name>",
+		Short:     "List flash areas an mfg image neither populates nor uses",
+		Long:      mfgUnreferencedAreasHelpText,
+		Run:       mfgUnreferencedAreasRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgCmd.AddCommand(mfgUnreferencedAreasCmd)
+
+	mfgBootCheckHelpText := "Confirm that each boot area of a " +
+		"manufacturing image contains a boot loader.  An area that is " +
+		"entirely erased is reported as empty.  If the BSP specifies " +
+		"bsp.boot_magic (a hex string) and optionally " +
+		"bsp.boot_magic_offset, the area must contain the magic at that " +
+		"offset.  By default the created image is inspected; --dump " +
+		"inspects a raw dump of flash device 0 instead."
+
+	mfgBootCheckCmd := &cobra.Command{
+		Use:       "bootcheck <mfg-package-name>",
+		Short:     "Check that the boot loader is in place",
+		Long:      mfgBootCheckHelpText,
+		Run:       mfgBootCheckRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgBootCheckCmd.PersistentFlags().StringVarP(&mfgBootCheckDump, "dump",
+		"", "", "Raw dump of flash device 0 to inspect")
+	mfgCmd.AddCommand(mfgBootCheckCmd)
+
+	mfgDiffCmd := &cobra.Command{
+		Use:   "diff <flash-dump-file-a> <flash-dump-file-b>",
+		Short: "Compare the meta regions of two raw flash dumps",
+		Run:   mfgDiffRunCmd,
+	}
+	mfgDiffCmd.PersistentFlags().BoolVarP(&mfgDiffHash, "hash", "", false,
+		"Compare hash, HMAC, and CRC TLVs as well")
+	mfgCmd.AddCommand(mfgDiffCmd)
+
+	mfgGoldenHelpText := "Compare the section that a manufacturing image " +
+		"writes to a flash device against a stored golden image, and " +
+		"report the first differing offset.  Differences within ignored " +
+		"regions, such as timestamps or serial numbers, are disregarded.  " +
+		"Regions are specified as <offset>:<size> pairs relative to the " +
+		"start of the device, or by flash area name.  The image must " +
+		"already have been created."
+	mfgGoldenHelpEx := "  newt mfg golden <mfg-package-name> <golden-file>\n"
+	mfgGoldenHelpEx += "  newt mfg golden --ignore 0x4000:16 " +
+		"--ignore-area FLASH_AREA_NFFS my_mfg golden.bin"
+
+	mfgGoldenCmd := &cobra.Command{
+		Use:       "golden <mfg-package-name> <golden-file>",
+		Short:     "Compare a manufacturing image against a golden image",
+		Long:      mfgGoldenHelpText,
+		Example:   mfgGoldenHelpEx,
+		Run:       mfgGoldenRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgGoldenCmd.PersistentFlags().IntVarP(&mfgGoldenDevice, "device", "",
+		0, "Flash device whose section to compare")
+	mfgGoldenCmd.PersistentFlags().StringSliceVarP(&mfgGoldenIgnore,
+		"ignore", "", nil, "Region to disregard, as <offset>:<size>")
+	mfgGoldenCmd.PersistentFlags().StringSliceVarP(&mfgGoldenIgnoreAreas,
+		"ignore-area", "", nil, "Flash area to disregard")
+	mfgCmd.AddCommand(mfgGoldenCmd)
+
+	mfgCheckDumpHelpText := "Compare a raw dump of a flash device against " +
+		"the section that a manufacturing image writes to that device, " +
+		"one flash area at a time, and report the first differing offset " +
+		"in each area.  Erased padding at the end of each area's expected " +
+		"contents is disregarded.  The image must already have been " +
+		"created."
+	mfgCheckDumpHelpEx := "  newt mfg check-dump <mfg-package-name> " +
+		"<flash-dump-file>\n"
+	mfgCheckDumpHelpEx += "  newt mfg check-dump --device 1 my_mfg " +
+		"dev1.bin"
+
+	mfgCheckDumpCmd := &cobra.Command{
+		Use:       "check-dump <mfg-package-name> <flash-dump-file>",
+		Short:     "Verify that a flash dump matches a manufacturing image",
+		Long:      mfgCheckDumpHelpText,
+		Example:   mfgCheckDumpHelpEx,
+		Run:       mfgCheckDumpRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgCheckDumpCmd.PersistentFlags().IntVarP(&mfgCheckDumpDevice, "device",
+		"", 0, "Flash device that the dump was read from")
+	mfgCmd.AddCommand(mfgCheckDumpCmd)
+
+	mfgHashOffsetHelpText := "Build the meta region of a manufacturing " +
+		"image and ensure that its hash lands at the expected offset " +
+		"within section 0.  The expected offset is taken from --expect, or " +
+		"from the package's mfg.meta_hash_offset setting.  A change to the " +
+		"meta region's TLVs can shift the hash, breaking boot loaders " +
+		"that expect it at a hardcoded address.  The image does not need " +
+		"to have been created."
+
+	mfgHashOffsetCmd := &cobra.Command{
+		Use:       "hash-offset <mfg-package-name>",
+		Short:     "Check that the meta hash offset has not shifted",
+		Long:      mfgHashOffsetHelpText,
+		Run:       mfgHashOffsetRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgHashOffsetCmd.PersistentFlags().StringVarP(&mfgHashOffset, "expect",
+		"", "", "Expected offset of the meta hash within section 0")
+	mfgCmd.AddCommand(mfgHashOffsetCmd)
+
+	mfgScriptCmd := &cobra.Command{
+		Use:       "script <mfg-package-name>",
+		Short:     "Generate a script that programs a manufacturing image",
+		Run:       mfgScriptRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgScriptCmd.PersistentFlags().StringVarP(&mfgScriptTool, "tool", "",
+		mfg.FLASH_SCRIPT_TOOL_JLINK,
+		"Programming tool the script invokes (jlink or openocd)")
+	mfgCmd.AddCommand(mfgScriptCmd)
+
+	mfgCArrayHelpText := "Build the manufacturing image and print its " +
+		"meta region as a C uint8_t array, along with macros giving the " +
+		"offsets of the hash and of each TLV within the region."
+
+	mfgCArrayCmd := &cobra.Command{
+		Use:       "carray <mfg-package-name>",
+		Short:     "Print a manufacturing image's meta region as a C array",
+		Long:      mfgCArrayHelpText,
+		Run:       mfgCArrayRunCmd,
+		ValidArgs: mfgList(),
+	}
+	mfgCmd.AddCommand(mfgCArrayCmd)
 }
@@ -20,13 +20,23 @@
 package cli
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/util"
 )
 
 var NewTypeStr = "pkg"
+var pkgFmtCheck bool = false
 
 func pkgNewCmd(cmd *cobra.Command, args []string) {
 	NewTypeStr = strings.ToUpper(NewTypeStr)
@@ -40,6 +50,255 @@ func pkgNewCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+// Finds all packages in the list matching the specified name.  A name matches
+// if it is identical to a package's name, or to the last element of a
+// package's name.  If the name specifies a repo, only that repo is searched.
+func pkgWhichMatches(packs interfaces.PackageList,
+	name string) ([]*pkg.LocalPackage, error) {
+
+	repoName, pkgName, err := newtutil.ParsePackageString(name)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []*pkg.LocalPackage{}
+	for rname, packHash := range packs {
+		if repoName != "" && rname != repoName {
+			continue
+		}
+
+		for _, pack := range *packHash {
+			lpkg := pack.(*pkg.LocalPackage)
+			if lpkg.Name() == pkgName ||
+				filepath.Base(lpkg.Name()) == pkgName {
+
+				matches = append(matches, lpkg)
+			}
+		}
+	}
+
+	return pkg.SortLclPkgs(matches), nil
+}
+
+func repoCommitString(path string) string {
+	res, err := util.ShellCommand(fmt.Sprintf("cd %s && git rev-parse HEAD",
+		path))
+	if err != nil {
+		return "UNKNOWN"
+	}
+
+	return strings.TrimSpace(string(res))
+}
+
+func pkgWhichCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify a package name"))
+	}
+
+	proj := InitProject()
+
+	matches, err := pkgWhichMatches(proj.PackageList(), args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	if len(matches) == 0 {
+		NewtUsage(nil, util.FmtNewtError("No package matching \"%s\"",
+			args[0]))
+	}
+
+	if len(matches) > 1 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Package name \"%s\" is ambiguous; %d matches:\n",
+			args[0], len(matches))
+	}
+
+	for _, lpkg := range matches {
+		r := lpkg.Repo()
+
+		versStr := "local"
+		if !r.IsLocal() {
+			versStr = "not installed"
+			if vers := proj.InstalledVersion(r.Name()); vers != nil {
+				versStr = vers.String()
+			}
+		}
+
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s\n", lpkg.FullName())
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"    repo:    %s\n"+
+				"    version: %s\n"+
+				"    commit:  %s\n"+
+				"    path:    %s\n",
+			r.Name(), versStr, repoCommitString(r.Path()), lpkg.BasePath())
+	}
+}
+
+func pkgRevdepCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify a package name"))
+	}
+
+	proj := InitProject()
+
+	matches, err := pkgWhichMatches(proj.PackageList(), args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+	if len(matches) == 0 {
+		NewtUsage(nil, util.FmtNewtError("No package matching \"%s\"",
+			args[0]))
+	}
+	if len(matches) > 1 {
+		names := make([]string, len(matches))
+		for i, lpkg := range matches {
+			names[i] = lpkg.FullName()
+		}
+		NewtUsage(nil, util.FmtNewtError(
+			"Package name \"%s\" is ambiguous; matches: %s",
+			args[0], strings.Join(names, ", ")))
+	}
+
+	lpkg := matches[0]
+	revDeps := proj.ReverseDeps(lpkg)
+	if len(revDeps) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"No packages depend on %s\n", lpkg.FullName())
+		return
+	}
+
+	direct := []project.RevDep{}
+	transitive := []project.RevDep{}
+	for _, rd := range revDeps {
+		if rd.Direct {
+			direct = append(direct, rd)
+		} else {
+			transitive = append(transitive, rd)
+		}
+	}
+
+	if len(direct) > 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Packages that depend on %s directly:\n", lpkg.FullName())
+		for _, rd := range direct {
+			util.StatusMessage(util.VERBOSITY_QUIET, "    %s\n",
+				rd.Pkg.FullName())
+		}
+	}
+
+	if len(transitive) > 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Packages that depend on %s transitively:\n", lpkg.FullName())
+		for _, rd := range transitive {
+			util.StatusMessage(util.VERBOSITY_QUIET, "    %s (via %s)\n",
+				rd.Pkg.FullName(), rd.Via.FullName())
+		}
+	}
+}
+
+func pkgOrphansCmd(cmd *cobra.Command, args []string) {
+	proj := InitProject()
+
+	repoNames := []string{}
+	for repoName, _ := range proj.PackageList() {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+
+	count := 0
+	for _, repoName := range repoNames {
+		r := proj.FindRepo(repoName)
+		if r == nil {
+			continue
+		}
+
+		orphans, err := pkg.FindOrphanPackages(r, r.Path())
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+
+		for _, o := range orphans {
+			name := o.Path
+			if !r.IsLocal() {
+				name = newtutil.BuildPackageString(r.Name(), o.Path)
+			}
+			util.StatusMessage(util.VERBOSITY_QUIET, "%s: %s\n",
+				name, o.Reason)
+		}
+		count += len(orphans)
+	}
+
+	if count > 0 {
+		NewtUsage(nil, util.FmtNewtError(
+			"%d directory(s) skipped during package resolution", count))
+	}
+}
+
+// Determines the set of pkg.yml files to format.  Each argument is either a
+// pkg.yml file or a package directory.  If no arguments are specified, every
+// package in the local repo is formatted.
+func pkgFmtPaths(args []string) []string {
+	paths := []string{}
+
+	if len(args) == 0 {
+		proj := InitProject()
+		lpkgs := []*pkg.LocalPackage{}
+		rname := proj.LocalRepo().Name()
+		if packHash := proj.PackageList()[rname]; packHash != nil {
+			for _, pack := range *packHash {
+				lpkgs = append(lpkgs, pack.(*pkg.LocalPackage))
+			}
+		}
+
+		for _, lpkg := range pkg.SortLclPkgs(lpkgs) {
+			paths = append(paths, lpkg.BasePath()+"/"+pkg.PACKAGE_FILE_NAME)
+		}
+
+		return paths
+	}
+
+	for _, arg := range args {
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			arg = arg + "/" + pkg.PACKAGE_FILE_NAME
+		}
+		paths = append(paths, arg)
+	}
+
+	return paths
+}
+
+func pkgFmtCmd(cmd *cobra.Command, args []string) {
+	unformatted := []string{}
+
+	for _, path := range pkgFmtPaths(args) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			NewtUsage(nil, util.ChildNewtError(err))
+		}
+
+		formatted := pkg.FormatPkgYml(string(data))
+		if formatted == string(data) {
+			continue
+		}
+
+		unformatted = append(unformatted, path)
+		if pkgFmtCheck {
+			util.StatusMessage(util.VERBOSITY_QUIET, "%s\n", path)
+			continue
+		}
+
+		if err := ioutil.WriteFile(path, []byte(formatted), 0644); err != nil {
+			NewtUsage(nil, util.ChildNewtError(err))
+		}
+		util.StatusMessage(util.VERBOSITY_VERBOSE, "Formatted %s\n", path)
+	}
+
+	if pkgFmtCheck && len(unformatted) > 0 {
+		NewtUsage(nil, util.FmtNewtError(
+			"%d package file(s) not normalized", len(unformatted)))
+	}
+}
+
 func AddPackageCommands(cmd *cobra.Command) {
 	/* Add the base package command, on top of which other commands are
 	 * keyed
@@ -75,4 +334,80 @@ func AddPackageCommands(cmd *cobra.Command) {
 		"pkg", "Type of package to create: pkg, bsp, sdk.  Default pkg.")
 
 	pkgCmd.AddCommand(newCmd)
+
+	whichCmdHelpText := "Show the repo that provides <package-name>, along " +
+		"with the repo's installed version and the package's path.  If " +
+		"multiple packages match, all are listed."
+	whichCmdHelpEx := "  newt pkg which <package-name>\n"
+	whichCmdHelpEx += "  newt pkg which kernel/os\n"
+	whichCmdHelpEx += "  newt pkg which @apache-mynewt-core/kernel/os"
+
+	whichCmd := &cobra.Command{
+		Use:     "which",
+		Short:   "Show which repo provides a package",
+		Long:    whichCmdHelpText,
+		Example: whichCmdHelpEx,
+		Run:     pkgWhichCmd,
+	}
+
+	pkgCmd.AddCommand(whichCmd)
+
+	revdepCmdHelpText := "List every package in the project that depends " +
+		"on <package-name>, either directly or through other packages.  " +
+		"All dependencies are considered, including those that are only " +
+		"enabled by a feature, so the list covers every target.  Each " +
+		"transitive dependent is shown with the dependency it reaches " +
+		"the package through."
+	revdepCmdHelpEx := "  newt pkg revdep <package-name>\n"
+	revdepCmdHelpEx += "  newt pkg revdep sys/log/full"
+
+	revdepCmd := &cobra.Command{
+		Use:     "revdep",
+		Short:   "List packages that depend on a package",
+		Long:    revdepCmdHelpText,
+		Example: revdepCmdHelpEx,
+		Run:     pkgRevdepCmd,
+	}
+
+	pkgCmd.AddCommand(revdepCmd)
+
+	orphansCmdHelpText := "Find directories that look like packages but " +
+		"are ignored when packages are resolved: directories with source " +
+		"files under src or include but no pkg.yml, and directories whose " +
+		"pkg.yml is empty or cannot be parsed.  Every installed repo is " +
+		"scanned.  newt exits with an error status if any are found."
+	orphansCmdHelpEx := "  newt pkg orphans"
+
+	orphansCmd := &cobra.Command{
+		Use:     "orphans",
+		Short:   "Find package directories without a usable pkg.yml",
+		Long:    orphansCmdHelpText,
+		Example: orphansCmdHelpEx,
+		Run:     pkgOrphansCmd,
+	}
+
+	pkgCmd.AddCommand(orphansCmd)
+
+	fmtCmdHelpText := "Rewrite pkg.yml files in canonical form: descriptive " +
+		"keys first, remaining keys sorted, and dependency and API lists " +
+		"sorted.  Comments directly above a key or list item move with " +
+		"it.  Each argument is a pkg.yml file or a package directory; if " +
+		"no arguments are given, every package in the local repo is " +
+		"formatted.  With --check, files that are not normalized are " +
+		"listed and left unmodified."
+	fmtCmdHelpEx := "  newt pkg fmt\n"
+	fmtCmdHelpEx += "  newt pkg fmt apps/blinky\n"
+	fmtCmdHelpEx += "  newt pkg fmt --check"
+
+	fmtCmd := &cobra.Command{
+		Use:     "fmt",
+		Short:   "Normalize pkg.yml files",
+		Long:    fmtCmdHelpText,
+		Example: fmtCmdHelpEx,
+		Run:     pkgFmtCmd,
+	}
+	fmtCmd.PersistentFlags().BoolVarP(&pkgFmtCheck, "check", "", false,
+		"Report unnormalized files without modifying them")
+
+	pkgCmd.AddCommand(fmtCmd)
 }
@@ -0,0 +1,93 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/repo"
+)
+
+// Builds a package list in which each repo contains the named packages.  Each
+// package's base path is "/<repo>/<package>".
+func testPackageList(repos map[string][]string) interfaces.PackageList {
+	packs := interfaces.PackageList{}
+	for rname, names := range repos {
+		packHash := map[string]interfaces.PackageInterface{}
+		for _, name := range names {
+			lpkg := pkg.NewLocalPackage(&repo.Repo{}, "/"+rname+"/"+name)
+			lpkg.SetName(name)
+			packHash[name] = lpkg
+		}
+		packs[rname] = &packHash
+	}
+
+	return packs
+}
+
+func TestPkgWhichMatches(t *testing.T) {
+	packs := testPackageList(map[string][]string{
+		"apache-mynewt-core": {"kernel/os", "sys/log/full", "hw/bsp/nrf52dk"},
+		"mcuboot":            {"boot/bootutil"},
+		"local":              {"apps/blinky", "sys/log/full"},
+	})
+
+	tests := []struct {
+		name string
+		arg  string
+		want []string
+	}{
+		{"full name", "kernel/os", []string{"/apache-mynewt-core/kernel/os"}},
+		{"last element", "bootutil", []string{"/mcuboot/boot/bootutil"}},
+		{"ambiguous", "sys/log/full", []string{
+			"/apache-mynewt-core/sys/log/full", "/local/sys/log/full",
+		}},
+		{"ambiguous last element", "full", []string{
+			"/apache-mynewt-core/sys/log/full", "/local/sys/log/full",
+		}},
+		{"repo qualified", "@apache-mynewt-core/sys/log/full", []string{
+			"/apache-mynewt-core/sys/log/full",
+		}},
+		{"wrong repo", "@mcuboot/kernel/os", []string{}},
+		{"partial element", "log", []string{}},
+		{"unknown", "net/nimble", []string{}},
+	}
+
+	for _, test := range tests {
+		matches, err := pkgWhichMatches(packs, test.arg)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err.Error())
+		}
+
+		paths := []string{}
+		for _, lpkg := range matches {
+			paths = append(paths, strings.TrimSuffix(lpkg.BasePath(), "/"))
+		}
+		sort.Strings(paths)
+
+		if strings.Join(paths, " ") != strings.Join(test.want, " ") {
+			t.Errorf("%s: matches=%v; want %v", test.name, paths, test.want)
+		}
+	}
+}
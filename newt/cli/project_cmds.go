@@ -20,6 +20,7 @@
 package cli
 
 import (
+	"fmt"
 	"os"
 	"sort"
 	"strings"
@@ -29,11 +30,13 @@ import (
 	"mynewt.apache.org/newt/newt/interfaces"
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/repo"
 	"mynewt.apache.org/newt/util"
 )
 
 var projectForce bool = false
 var syncForce bool = false
+var projectValidateAllRepos bool = false
 
 func newRunCmd(cmd *cobra.Command, args []string) {
 	if len(args) < 1 {
@@ -182,6 +185,126 @@ func syncRunCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+func validateRunCmd(cmd *cobra.Command, args []string) {
+	proj := InitProject()
+
+	schema, ok, err := proj.Schema()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+	if !ok {
+		NewtUsage(nil, util.FmtNewtError(
+			"Project does not define a schema (%s)",
+			project.PROJECT_SCHEMA_FILE_NAME))
+	}
+
+	violations := proj.Validate(schema, projectValidateAllRepos)
+	if len(violations) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Project conforms to its schema\n")
+		return
+	}
+
+	for _, v := range violations {
+		util.StatusMessage(util.VERBOSITY_QUIET, "    * %s\n", v.String())
+	}
+	NewtUsage(nil, util.FmtNewtError("%d schema violation(s)",
+		len(violations)))
+}
+
+func checkRepoDepsRunCmd(cmd *cobra.Command, args []string) {
+	proj := InitProject()
+	interfaces.SetProject(proj)
+
+	conflicts, err := proj.VersionConflicts()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if len(conflicts) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Repository version requirements are satisfiable\n")
+		return
+	}
+
+	for _, c := range conflicts {
+		util.StatusMessage(util.VERBOSITY_QUIET, "    * %s\n", c.String())
+	}
+	NewtUsage(nil, util.FmtNewtError(
+		"%d repository version conflict(s)", len(conflicts)))
+}
+
+// Describes the state of a repository's working copy in a single line.
+func repoStatusDesc(rs repo.RepoStatus) string {
+	var desc string
+	switch {
+	case !rs.Installed:
+		desc = "not installed"
+
+	case !rs.IsGit:
+		desc = "not a git repository"
+
+	default:
+		branch := rs.Branch
+		if branch == "" {
+			branch = "(detached)"
+		}
+		commit := rs.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		desc = fmt.Sprintf("branch=%s commit=%s", branch, commit)
+
+		if rs.Dirty {
+			desc += " dirty"
+		} else {
+			desc += " clean"
+		}
+
+		if rs.Version != nil {
+			desc += fmt.Sprintf(" version=%s", rs.Version.String())
+			switch {
+			case rs.Expected == "":
+				desc += " (no matching branch in repository " +
+					"description)"
+			case rs.Matches:
+				desc += fmt.Sprintf(" (matches %s)", rs.Expected)
+			default:
+				desc += fmt.Sprintf(" (expected %s)", rs.Expected)
+			}
+		}
+	}
+
+	return desc
+}
+
+func statusRunCmd(cmd *cobra.Command, args []string) {
+	proj := InitProject()
+	repos := proj.Repos()
+
+	ps, err := project.LoadProjectState()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	repoNames := []string{}
+	for repoName, _ := range repos {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+
+	for _, repoName := range repoNames {
+		r := repos[repoName]
+		rs, err := r.Status(ps.GetInstalledVersion(r.Name()))
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "@%s: %s\n",
+			repoName, repoStatusDesc(rs))
+	}
+}
+
 func AddProjectCommands(cmd *cobra.Command) {
 	installHelpText := ""
 	installHelpEx := ""
@@ -249,4 +372,59 @@ func AddProjectCommands(cmd *cobra.Command) {
 	}
 
 	cmd.AddCommand(infoCmd)
+
+	statusHelpText := "Show the git status of each repository in the " +
+		"current project: its branch, whether it has uncommitted " +
+		"changes, and whether it is checked out at the installed version."
+	statusHelpEx := "  newt status\n"
+
+	statusCmd := &cobra.Command{
+		Use:     "status",
+		Short:   "Show repository status",
+		Long:    statusHelpText,
+		Example: statusHelpEx,
+		Run:     statusRunCmd,
+	}
+
+	cmd.AddCommand(statusCmd)
+
+	validateHelpText := "Check project.yml and each package's pkg.yml " +
+		"against the rules in the project's " +
+		project.PROJECT_SCHEMA_FILE_NAME + ".  The rules list required " +
+		"fields (project.required, pkg.required) and the values allowed " +
+		"for fields (project.allowed, pkg.allowed).  By default, only " +
+		"packages in the local repository are checked."
+	validateHelpEx := "  newt validate\n"
+	validateHelpEx += "  newt validate --all-repos"
+
+	validateCmd := &cobra.Command{
+		Use:     "validate",
+		Short:   "Check project files against the project schema",
+		Long:    validateHelpText,
+		Example: validateHelpEx,
+		Run:     validateRunCmd,
+	}
+	validateCmd.PersistentFlags().BoolVarP(&projectValidateAllRepos,
+		"all-repos", "", false, "Also check packages in installed "+
+			"repositories")
+
+	cmd.AddCommand(validateCmd)
+
+	checkRepoDepsHelpText := "Download the description of each " +
+		"repository and check that the version requirements placed on " +
+		"each repository, by project.yml and by other repositories, can " +
+		"be satisfied together.  Each unsatisfiable combination is " +
+		"reported with the requirement of every requester.  No " +
+		"repository is installed or upgraded."
+	checkRepoDepsHelpEx := "  newt check-repo-deps"
+
+	checkRepoDepsCmd := &cobra.Command{
+		Use:     "check-repo-deps",
+		Short:   "Check that repository version requirements are satisfiable",
+		Long:    checkRepoDepsHelpText,
+		Example: checkRepoDepsHelpEx,
+		Run:     checkRepoDepsRunCmd,
+	}
+
+	cmd.AddCommand(checkRepoDepsCmd)
 }
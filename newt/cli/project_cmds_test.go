@@ -0,0 +1,111 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"testing"
+
+	"mynewt.apache.org/newt/newt/repo"
+)
+
+func TestRepoStatusDesc(t *testing.T) {
+	vers, err := repo.LoadVersion("1.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := "0123456789abcdef0123456789abcdef01234567"
+
+	tests := []struct {
+		name string
+		rs   repo.RepoStatus
+		desc string
+	}{
+		{
+			name: "not installed",
+			rs:   repo.RepoStatus{},
+			desc: "not installed",
+		},
+		{
+			name: "not git",
+			rs: repo.RepoStatus{
+				Installed: true,
+				Version:   vers,
+			},
+			desc: "not a git repository",
+		},
+		{
+			name: "local",
+			rs: repo.RepoStatus{
+				Installed: true,
+				IsGit:     true,
+				Branch:    "master",
+				Commit:    commit,
+			},
+			desc: "branch=master commit=0123456789ab clean",
+		},
+		{
+			name: "matches version",
+			rs: repo.RepoStatus{
+				Installed: true,
+				IsGit:     true,
+				Branch:    "master",
+				Commit:    commit,
+				Version:   vers,
+				Expected:  "mynewt_1_2_0_tag",
+				Matches:   true,
+			},
+			desc: "branch=master commit=0123456789ab clean " +
+				"version=1.2.0-none (matches mynewt_1_2_0_tag)",
+		},
+		{
+			name: "dirty and detached",
+			rs: repo.RepoStatus{
+				Installed: true,
+				IsGit:     true,
+				Commit:    commit,
+				Dirty:     true,
+				Version:   vers,
+				Expected:  "mynewt_1_2_0_tag",
+			},
+			desc: "branch=(detached) commit=0123456789ab dirty " +
+				"version=1.2.0-none (expected mynewt_1_2_0_tag)",
+		},
+		{
+			name: "unknown version",
+			rs: repo.RepoStatus{
+				Installed: true,
+				IsGit:     true,
+				Branch:    "develop",
+				Commit:    "abc123",
+				Version:   vers,
+			},
+			desc: "branch=develop commit=abc123 clean version=1.2.0-none " +
+				"(no matching branch in repository description)",
+		},
+	}
+
+	for _, test := range tests {
+		desc := repoStatusDesc(test.rs)
+		if desc != test.desc {
+			t.Errorf("%s: wrong description:\nwant=%s\nhave=%s",
+				test.name, test.desc, desc)
+		}
+	}
+}
@@ -22,6 +22,7 @@ package cli
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -31,14 +32,29 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/image"
+	"mynewt.apache.org/newt/newt/mfg"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/syscfg"
+	"mynewt.apache.org/newt/newt/sysinit"
 	"mynewt.apache.org/newt/newt/target"
 	"mynewt.apache.org/newt/util"
-	"mynewt.apache.org/newt/viper"
+	"mynewt.apache.org/newt/yaml"
 )
 
 var targetForce bool = false
+var targetPurge bool = false
+var targetShowFormat string
+var targetIncludePathJson bool = false
+var targetBspVersionsStrict bool = false
+var targetFlashIdsGlobal bool = false
+var targetMarkers string
+var targetLinkerRegion string = "FLASH"
+var targetLinkerArea string
+var targetSlotAlign int = 1
+var targetFitHeaderOffset string
+var targetSlotAlignReq string
 
 func resolveExistingTargetArg(arg string) (*target.Target, error) {
 	t := ResolveTarget(arg)
@@ -83,6 +99,183 @@ func pkgVarSliceString(pack *pkg.LocalPackage, key string) string {
 	return buffer.String()
 }
 
+// Structured representation of a target, emitted by "target show --format".
+// Syscfg holds the resolved values of the settings that any package in the
+// build overrides; it is omitted if the target's configuration cannot be
+// resolved.
+type targetShowInfo struct {
+	Name         string            `json:"name"`
+	Bsp          string            `json:"bsp"`
+	App          string            `json:"app,omitempty"`
+	Loader       string            `json:"loader,omitempty"`
+	BuildProfile string            `json:"build_profile"`
+	Vars         map[string]string `json:"vars"`
+	Syscfg       map[string]string `json:"syscfg,omitempty"`
+	Cflags       []string          `json:"cflags"`
+	Lflags       []string          `json:"lflags"`
+	Aflags       []string          `json:"aflags"`
+}
+
+func pkgVarSortedSlice(pack *pkg.LocalPackage, key string) []string {
+	vals := pack.PkgV.GetStringSlice(key)
+	sort.Strings(vals)
+
+	if vals == nil {
+		vals = []string{}
+	}
+	return vals
+}
+
+// Collects the resolved values of the overridden settings in a syscfg
+// configuration.
+func cfgOverrides(cfg syscfg.Cfg) map[string]string {
+	overrides := map[string]string{}
+	for name, entry := range cfg.Settings {
+		if len(entry.History) > 1 {
+			overrides[name] = entry.Value
+		}
+	}
+
+	return overrides
+}
+
+// Resolves the settings that are overridden in a target's build.
+func targetShowSyscfg(t *target.Target) (map[string]string, error) {
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		return nil, err
+	}
+
+	cfgResolution, err := b.ExportCfg()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfgOverrides(cfgResolution.Cfg), nil
+}
+
+func newTargetShowInfo(t *target.Target,
+	overrides map[string]string) targetShowInfo {
+
+	info := targetShowInfo{
+		Name:         t.FullName(),
+		Bsp:          t.BspName,
+		App:          t.AppName,
+		Loader:       t.LoaderName,
+		BuildProfile: t.BuildProfile,
+		Vars:         map[string]string{},
+	}
+
+	for k, v := range t.Vars {
+		info.Vars[strings.TrimPrefix(k, "target.")] = v
+	}
+
+	info.Syscfg = overrides
+	info.Cflags = pkgVarSortedSlice(t.Package(), "pkg.cflags")
+	info.Lflags = pkgVarSortedSlice(t.Package(), "pkg.lflags")
+	info.Aflags = pkgVarSortedSlice(t.Package(), "pkg.aflags")
+
+	return info
+}
+
+func writeYamlMap(buf *bytes.Buffer, indent string, name string,
+	m map[string]string) {
+
+	if len(m) == 0 {
+		fmt.Fprintf(buf, "%s%s: {}\n", indent, name)
+		return
+	}
+
+	keys := make([]string, 0, len(m))
+	for k, _ := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(buf, "%s%s:\n", indent, name)
+	for _, k := range keys {
+		fmt.Fprintf(buf, "%s    %s: %s\n", indent, k, yaml.EscapeString(m[k]))
+	}
+}
+
+func writeYamlSlice(buf *bytes.Buffer, indent string, name string,
+	vals []string) {
+
+	if len(vals) == 0 {
+		fmt.Fprintf(buf, "%s%s: []\n", indent, name)
+		return
+	}
+
+	fmt.Fprintf(buf, "%s%s:\n", indent, name)
+	for _, v := range vals {
+		fmt.Fprintf(buf, "%s    - %s\n", indent, yaml.EscapeString(v))
+	}
+}
+
+// Produces YAML with the same structure as the JSON encoding of a slice of
+// targetShowInfo objects.
+func targetShowInfosYaml(infos []targetShowInfo) string {
+	buf := bytes.Buffer{}
+
+	for _, info := range infos {
+		fmt.Fprintf(&buf, "- name: %s\n", yaml.EscapeString(info.Name))
+		fmt.Fprintf(&buf, "  bsp: %s\n", yaml.EscapeString(info.Bsp))
+		if info.App != "" {
+			fmt.Fprintf(&buf, "  app: %s\n", yaml.EscapeString(info.App))
+		}
+		if info.Loader != "" {
+			fmt.Fprintf(&buf, "  loader: %s\n",
+				yaml.EscapeString(info.Loader))
+		}
+		fmt.Fprintf(&buf, "  build_profile: %s\n",
+			yaml.EscapeString(info.BuildProfile))
+		writeYamlMap(&buf, "  ", "vars", info.Vars)
+		if info.Syscfg != nil {
+			writeYamlMap(&buf, "  ", "syscfg", info.Syscfg)
+		}
+		writeYamlSlice(&buf, "  ", "cflags", info.Cflags)
+		writeYamlSlice(&buf, "  ", "lflags", info.Lflags)
+		writeYamlSlice(&buf, "  ", "aflags", info.Aflags)
+	}
+
+	return buf.String()
+}
+
+func targetShowFormatted(cmd *cobra.Command, targetNames []string) {
+	if targetShowFormat != "json" && targetShowFormat != "yaml" {
+		NewtUsage(cmd, util.FmtNewtError(
+			"Invalid output format \"%s\"; must be json or yaml",
+			targetShowFormat))
+	}
+
+	infos := make([]targetShowInfo, 0, len(targetNames))
+	for _, name := range targetNames {
+		t := target.GetTargets()[name]
+
+		// Incomplete targets are still shown, without their syscfg.
+		overrides, err := targetShowSyscfg(t)
+		if err != nil {
+			log.Warnf("Failed to resolve syscfg for target %s: %s",
+				t.FullName(), strings.TrimSpace(err.Error()))
+		}
+
+		infos = append(infos, newTargetShowInfo(t, overrides))
+	}
+
+	switch targetShowFormat {
+	case "json":
+		b, err := json.MarshalIndent(infos, "", "  ")
+		if err != nil {
+			NewtUsage(nil, util.ChildNewtError(err))
+		}
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s\n", string(b))
+
+	case "yaml":
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s",
+			targetShowInfosYaml(infos))
+	}
+}
+
 func targetShowCmd(cmd *cobra.Command, args []string) {
 	InitProject()
 	targetNames := []string{}
@@ -109,10 +302,15 @@ func targetShowCmd(cmd *cobra.Command, args []string) {
 
 	sort.Strings(targetNames)
 
+	if targetShowFormat != "" {
+		targetShowFormatted(cmd, targetNames)
+		return
+	}
+
 	for _, name := range targetNames {
 		kvPairs := map[string]string{}
 
-		util.StatusMessage(util.VERBOSITY_DEFAULT, name+"\n")
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s\n", name)
 
 		target := target.GetTargets()[name]
 		for k, v := range target.Vars {
@@ -232,13 +430,12 @@ func targetSetCmd(cmd *cobra.Command, args []string) {
 		// A few variables are special cases; they get set in the base package
 		// instead of the target.
 		if kv[0] == "target.syscfg" {
-			t.Package().SyscfgV = viper.New()
 			kv, err := targetSyscfgKVFromStr(kv[1])
 			if err != nil {
 				NewtUsage(cmd, err)
 			}
 
-			t.Package().SyscfgV.Set("syscfg.vals", kv)
+			t.SetSyscfgVals(kv)
 		} else if kv[0] == "target.cflags" ||
 			kv[0] == "target.lflags" ||
 			kv[0] == "target.aflags" {
@@ -253,10 +450,10 @@ func targetSetCmd(cmd *cobra.Command, args []string) {
 		} else {
 			if kv[1] == "" {
 				// User specified empty value; delete variable.
-				delete(t.Vars, kv[0])
+				t.UnsetVar(kv[0])
 			} else {
 				// Assign value to specified variable.
-				t.Vars[kv[0]] = kv[1]
+				t.SetVar(kv[0], kv[1])
 			}
 		}
 	}
@@ -304,6 +501,44 @@ func targetCreateCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+// Removes the build output directory of the specified target.  The user is
+// prompted for confirmation unless the delete is forced.  Only paths within
+// the project's bin directory are ever removed.
+func targetPurgeBinDir(t *target.Target) error {
+	return purgeBinDir(builder.BinRoot(), builder.TargetBinDir(t.Name()),
+		t.FullName())
+}
+
+func purgeBinDir(binRoot string, binDir string, targetName string) error {
+	if !builder.InBinDir(binRoot, binDir) {
+		return util.FmtNewtError(
+			"Refusing to purge %s; path is outside the build tree (%s)",
+			binDir, binRoot)
+	}
+
+	if util.NodeNotExist(binDir) {
+		return nil
+	}
+
+	if !targetForce {
+		scanner := bufio.NewScanner(os.Stdin)
+		fmt.Printf("Delete build output directory %s? (y/N): ", binDir)
+		rc := scanner.Scan()
+		if !rc || strings.ToLower(scanner.Text()) != "y" {
+			return nil
+		}
+	}
+
+	if err := os.RemoveAll(binDir); err != nil {
+		return util.NewNewtError(err.Error())
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Build output for target %s successfully deleted.\n", targetName)
+
+	return nil
+}
+
 func targetDelOne(t *target.Target) error {
 	if !targetForce {
 		// Determine if the target directory contains extra user files.  If it
@@ -331,6 +566,12 @@ func targetDelOne(t *target.Target) error {
 	util.StatusMessage(util.VERBOSITY_DEFAULT,
 		"Target %s successfully deleted.\n", t.FullName())
 
+	if targetPurge {
+		if err := targetPurgeBinDir(t); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -402,6 +643,47 @@ func targetCopyCmd(cmd *cobra.Command, args []string) {
 		srcTarget.FullName(), dstTarget.FullName())
 }
 
+func targetRenameCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		NewtUsage(cmd, util.NewNewtError("Must specify exactly one "+
+			"source target and one destination name"))
+	}
+
+	proj := InitProject()
+
+	srcTarget, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	if ResolveTarget(args[1]) == srcTarget {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Target %s unchanged; old and new names are identical\n",
+			srcTarget.FullName())
+		return
+	}
+
+	if !srcTarget.Package().Repo().IsLocal() {
+		NewtUsage(nil, util.FmtNewtError(
+			"Cannot rename target %s; target is not in the local repo",
+			srcTarget.FullName()))
+	}
+
+	dstName, err := ResolveNewTargetName(args[1])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	dstTarget, err := srcTarget.Rename(proj.LocalRepo(), dstName)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Target successfully renamed; %s --> %s\n",
+		srcTarget.FullName(), dstTarget.FullName())
+}
+
 func printSetting(entry syscfg.CfgEntry) {
 	util.StatusMessage(util.VERBOSITY_DEFAULT,
 		"  * Setting: %s\n", entry.Name)
@@ -419,7 +701,7 @@ func printSetting(entry syscfg.CfgEntry) {
 			"    * Overridden: ")
 		for i := 1; i < len(entry.History); i++ {
 			util.StatusMessage(util.VERBOSITY_DEFAULT, "%s, ",
-				entry.History[i].Source.Name())
+				entry.History[i].Name())
 		}
 		util.StatusMessage(util.VERBOSITY_DEFAULT,
 			"default=%s\n", entry.History[0].Value)
@@ -494,107 +776,1699 @@ func targetConfigCmd(cmd *cobra.Command, args []string) {
 	printCfg(t.Name(), cfgResolution.Cfg)
 }
 
-func AddTargetCommands(cmd *cobra.Command) {
-	targetHelpText := ""
-	targetHelpEx := ""
-	targetCmd := &cobra.Command{
-		Use:     "target",
-		Short:   "Command for manipulating targets",
-		Long:    targetHelpText,
-		Example: targetHelpEx,
-		Run: func(cmd *cobra.Command, args []string) {
-			cmd.Usage()
-		},
+func resolveTargetCfg(t *target.Target) syscfg.Cfg {
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
 	}
 
-	cmd.AddCommand(targetCmd)
+	cfgResolution, err := b.ExportCfg()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
 
-	showHelpText := "Show all the variables for the target specified " +
-		"by <target-name>."
-	showHelpEx := "  newt target show <target-name>\n"
-	showHelpEx += "  newt target show my_target1"
+	return cfgResolution.Cfg
+}
 
-	showCmd := &cobra.Command{
-		Use:     "show",
-		Short:   "View target configuration variables",
-		Long:    showHelpText,
-		Example: showHelpEx,
-		Run:     targetShowCmd,
+func targetConfigDiffCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		NewtUsage(cmd, util.NewNewtError("Must specify two target names"))
 	}
-	showCmd.ValidArgs = targetList()
-	targetCmd.AddCommand(showCmd)
 
-	setHelpText := "Set a target variable (<var-name>) on target " +
-		"<target-name> to value <value>."
-	setHelpEx := "  newt target set <target-name> <var-name>=<value>\n"
-	setHelpEx += "  newt target set my_target1 var_name=value\n"
-	setHelpEx += "  newt target set my_target1 arch=cortex_m4\n"
-	setHelpEx += "  newt target set my_target1 var_name   (display valid values for <var_name>)"
+	InitProject()
 
-	setCmd := &cobra.Command{
-		Use:     "set",
-		Short:   "Set target configuration variable",
-		Long:    setHelpText,
-		Example: setHelpEx,
-		Run:     targetSetCmd,
+	ta, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+	tb, err := resolveExistingTargetArg(args[1])
+	if err != nil {
+		NewtUsage(cmd, err)
 	}
-	setCmd.ValidArgs = targetList()
-	targetCmd.AddCommand(setCmd)
 
-	createHelpText := "Create a target specified by <target-name>."
-	createHelpEx := "  newt target create <target-name>\n"
-	createHelpEx += "  newt target create my_target1"
+	diffs := syscfg.DiffCfgs(resolveTargetCfg(ta), resolveTargetCfg(tb))
+	if len(diffs) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Targets %s and %s have identical syscfg\n",
+			ta.FullName(), tb.FullName())
+		return
+	}
 
-	createCmd := &cobra.Command{
-		Use:     "create",
-		Short:   "Create a target",
-		Long:    createHelpText,
-		Example: createHelpEx,
-		Run:     targetCreateCmd,
+	util.StatusMessage(util.VERBOSITY_QUIET, "--- %s\n+++ %s\n",
+		ta.FullName(), tb.FullName())
+	for _, d := range diffs {
+		if d.InA {
+			util.StatusMessage(util.VERBOSITY_QUIET, "-%s: %s\n",
+				d.Name, d.ValueA)
+		}
+		if d.InB {
+			util.StatusMessage(util.VERBOSITY_QUIET, "+%s: %s\n",
+				d.Name, d.ValueB)
+		}
 	}
+}
 
-	targetCmd.AddCommand(createCmd)
+func targetOverridesCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
 
-	delHelpText := "Delete the target specified by <target-name>."
-	delHelpEx := "  newt target delete <target-name>\n"
-	delHelpEx += "  newt target delete my_target1"
+	InitProject()
 
-	delCmd := &cobra.Command{
-		Use:     "delete",
-		Short:   "Delete target",
-		Long:    delHelpText,
-		Example: delHelpEx,
-		Run:     targetDelCmd,
+	targets := []*target.Target{}
+	for _, arg := range args {
+		t, err := resolveExistingTargetArg(arg)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+		targets = append(targets, t)
 	}
-	delCmd.PersistentFlags().BoolVarP(&targetForce, "force", "f", false,
-		"Force delete of targets with user files without prompt")
 
-	targetCmd.AddCommand(delCmd)
+	for i, t := range targets {
+		if i != 0 {
+			util.StatusMessage(util.VERBOSITY_QUIET, "\n")
+		}
 
-	copyHelpText := "Create a new target by cloning <src-target>."
-	copyHelpEx := "  newt target copy <src-target> <dst-target>\n"
-	copyHelpEx += "  newt target copy blinky_sim my_target"
+		cfg := resolveTargetCfg(t)
+		overrides := cfg.OverriddenSettings()
 
-	copyCmd := &cobra.Command{
-		Use:       "copy",
-		Short:     "Copy target",
-		Long:      copyHelpText,
-		Example:   copyHelpEx,
-		Run:       targetCopyCmd,
-		ValidArgs: targetList(),
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s (%d overridden)\n",
+			t.FullName(), len(overrides))
+		for _, o := range overrides {
+			util.StatusMessage(util.VERBOSITY_QUIET,
+				"    %s: %s -> %s (defined by %s; overridden by %s)\n",
+				o.Name, o.Default, o.Value, o.DefinedBy, o.OverriddenBy)
+		}
 	}
+}
 
-	targetCmd.AddCommand(copyCmd)
+func targetFlashIdsCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
 
-	configHelpText := "View a target's system configuration."
+	InitProject()
 
-	configCmd := &cobra.Command{
-		Use:       "config",
-		Short:     "View target system configuration",
-		Long:      configHelpText,
-		Run:       targetConfigCmd,
-		ValidArgs: targetList(),
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+	if t.Bsp() == nil {
+		NewtUsage(nil, util.FmtNewtError(
+			"Target %s does not specify a valid BSP", t.FullName()))
 	}
 
-	targetCmd.AddCommand(configCmd)
+	bsp, err := pkg.NewBspPackage(t.Bsp())
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	scope := "device"
+	if targetFlashIdsGlobal {
+		scope = "global"
+	}
+
+	collisions := bsp.FlashMap.IdCollisions(targetFlashIdsGlobal)
+	if len(collisions) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"No flash area ID collisions in target %s (scope: %s)\n",
+			t.FullName(), scope)
+		return
+	}
+
+	util.StatusMessage(util.VERBOSITY_QUIET, "%s",
+		bsp.FlashMap.IdCollisionText(targetFlashIdsGlobal))
+	NewtUsage(nil, util.FmtNewtError(
+		"%d flash area ID collision(s) in target %s (scope: %s)",
+		len(collisions), t.FullName(), scope))
+}
+
+func targetBsp(t *target.Target) *pkg.BspPackage {
+	if t.Bsp() == nil {
+		NewtUsage(nil, util.FmtNewtError(
+			"Target %s does not specify a valid BSP", t.FullName()))
+	}
+
+	bsp, err := pkg.NewBspPackage(t.Bsp())
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	return bsp
+}
+
+func targetBspFlashMap(t *target.Target) flash.FlashMap {
+	return targetBsp(t).FlashMap
+}
+
+func targetOtaCompatCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify deployed and updated target names"))
+	}
+
+	InitProject()
+
+	deployed, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+	updated, err := resolveExistingTargetArg(args[1])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	problems := flash.OtaProblems(targetBspFlashMap(deployed),
+		targetBspFlashMap(updated))
+	if len(problems) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Image slots of %s and %s are compatible for OTA\n",
+			deployed.FullName(), updated.FullName())
+		return
+	}
+
+	errText := fmt.Sprintf("Image slots of %s and %s are not compatible "+
+		"for OTA:\n", deployed.FullName(), updated.FullName())
+	for _, p := range problems {
+		errText += fmt.Sprintf("    * %s\n", p)
+	}
+	NewtUsage(nil, util.NewNewtError(strings.TrimSpace(errText)))
+}
+
+func builtFlashMap(t *target.Target) flash.FlashMap {
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	fm, err := b.BuiltFlashMap()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	return fm
+}
+
+func targetBootAppFlashCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify boot loader and app target names"))
+	}
+
+	InitProject()
+
+	boot, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+	app, err := resolveExistingTargetArg(args[1])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	problems := flash.BootAppProblems(builtFlashMap(boot), builtFlashMap(app))
+	if len(problems) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"%s and %s were built against the same flash layout\n",
+			boot.FullName(), app.FullName())
+		return
+	}
+
+	errText := fmt.Sprintf("%s and %s were built against different flash "+
+		"layouts:\n", boot.FullName(), app.FullName())
+	for _, p := range problems {
+		errText += fmt.Sprintf("    * %s\n", p)
+	}
+	NewtUsage(nil, util.NewNewtError(strings.TrimSpace(errText)))
+}
+
+func targetApiConflictsCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	InitProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	cfgResolution, err := b.ExportCfg()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if len(cfgResolution.ApiConflicts) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"No API provider conflicts in target %s\n", t.FullName())
+		return
+	}
+
+	unresolved := 0
+	for _, conflict := range cfgResolution.ApiConflicts {
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s:\n", conflict.Api)
+		for _, lpkg := range conflict.Providers {
+			suffix := ""
+			if lpkg == conflict.Preferred {
+				suffix = " (preferred)"
+			}
+			util.StatusMessage(util.VERBOSITY_QUIET, "    %s%s\n",
+				lpkg.FullName(), suffix)
+		}
+
+		if conflict.Preferred == nil {
+			unresolved++
+		}
+	}
+
+	if unresolved > 0 {
+		NewtUsage(nil, util.FmtNewtError(
+			"%d API conflict(s) without a preferred provider; "+
+				"specify one with target.api_prefs", unresolved))
+	}
+}
+
+func targetCheckMarkersCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	InitProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	markers := t.ForbiddenMarkers()
+	if targetMarkers != "" {
+		markers = strings.Fields(targetMarkers)
+	}
+	if len(markers) == 0 {
+		NewtUsage(cmd, util.FmtNewtError(
+			"No markers specified; set target.forbidden_markers in "+
+				"target %s or use --markers", t.FullName()))
+	}
+
+	dirs := []string{
+		builder.GeneratedIncludeDir(t.Name()),
+		builder.GeneratedSrcDir(t.Name()),
+	}
+	if util.NodeNotExist(dirs[0]) && util.NodeNotExist(dirs[1]) {
+		NewtUsage(nil, util.FmtNewtError(
+			"Target %s has no generated files; build it first",
+			t.FullName()))
+	}
+
+	hits, err := builder.ScanMarkers(dirs, markers)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if len(hits) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"No forbidden markers in generated files of target %s\n",
+			t.FullName())
+		return
+	}
+
+	for _, hit := range hits {
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s\n", hit.String())
+	}
+	NewtUsage(nil, util.FmtNewtError(
+		"%d forbidden marker(s) in generated files of target %s",
+		len(hits), t.FullName()))
+}
+
+func printSysinitOrder(fnName string, calls []sysinit.InitCall) {
+	util.StatusMessage(util.VERBOSITY_QUIET, "%s:\n", fnName)
+	for _, c := range calls {
+		util.StatusMessage(util.VERBOSITY_QUIET, "    %d.%d: %s (%s)\n",
+			c.Stage, c.Index, c.FnName, c.Pkg.Name())
+	}
+
+	conflicts := sysinit.CallConflicts(calls)
+	if len(conflicts) > 0 {
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s conflicts:\n", fnName)
+		for _, c := range conflicts {
+			util.StatusMessage(util.VERBOSITY_QUIET, "    * %s\n", c)
+		}
+	}
+}
+
+func targetSysinitCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	InitProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	appCalls, loaderCalls, err := b.SysinitOrder()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if loaderCalls != nil {
+		printSysinitOrder("sysinit_loader", loaderCalls)
+		util.StatusMessage(util.VERBOSITY_QUIET, "\n")
+	}
+	printSysinitOrder("sysinit_app", appCalls)
+}
+
+func targetSysinitCoverageCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	InitProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	appProblems, loaderProblems, err := b.SysinitCoverage()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	errText := ""
+	for _, p := range loaderProblems {
+		errText += fmt.Sprintf("    * sysinit_loader: %s\n", p)
+	}
+	for _, p := range appProblems {
+		errText += fmt.Sprintf("    * sysinit_app: %s\n", p)
+	}
+
+	if errText == "" {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Generated sysinit of target %s calls every package init "+
+				"function\n", t.FullName())
+		return
+	}
+
+	NewtUsage(nil, util.NewNewtError(strings.TrimSpace(fmt.Sprintf(
+		"Generated sysinit of target %s is incomplete:\n%s",
+		t.FullName(), errText))))
+}
+
+func targetCheckSlotsCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+	if targetSlotAlign < 1 {
+		NewtUsage(cmd, util.FmtNewtError(
+			"Invalid flash write alignment: %d", targetSlotAlign))
+	}
+
+	InitProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	flashMap := targetBspFlashMap(t)
+	minSize := image.MinSlotSize(targetSlotAlign)
+
+	slots := flashMap.UndersizedSlots(minSize)
+	if len(slots) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Image slots of target %s can hold an image\n", t.FullName())
+		return
+	}
+
+	util.StatusMessage(util.VERBOSITY_QUIET, "%s",
+		flashMap.UndersizedSlotText(minSize))
+	NewtUsage(nil, util.FmtNewtError(
+		"%d image slot(s) of target %s too small to hold any image",
+		len(slots), t.FullName()))
+}
+
+func targetPkgFlashAreasCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify target name and package name"))
+	}
+
+	proj := InitProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	lpkg, err := proj.ResolvePackage(proj.LocalRepo(), args[1])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	refs, err := b.PkgFlashRefs(lpkg)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if len(refs) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Package %s references no flash areas\n", lpkg.FullName())
+		return
+	}
+
+	for _, ref := range refs {
+		suffix := ""
+		if !ref.Known {
+			suffix = " (not in flash map)"
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%-32s %s%s\n",
+			ref.Area, ref.Source, suffix)
+	}
+}
+
+var targetWriteAlignPad bool
+
+func targetCheckWriteAlignCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	InitProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+	if t.App() == nil {
+		NewtUsage(nil, util.FmtNewtError(
+			"Target %s does not specify an app", t.FullName()))
+	}
+
+	// Images are written to the device containing the image slots.
+	flashMap := targetBspFlashMap(t)
+	device := 0
+	if slot, ok := flashMap.Areas[flash.FLASH_AREA_NAME_IMAGE_0]; ok {
+		device = slot.Device
+	}
+
+	writeSize := flashMap.WriteSize(device)
+	if writeSize == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Flash device %d of target %s does not specify a write_size; "+
+				"nothing to check\n", device, t.FullName())
+		return
+	}
+
+	imgPaths := []string{
+		builder.AppImgPath(t.Name(), builder.BUILD_NAME_APP, t.App().Name()),
+	}
+	if t.Loader() != nil {
+		imgPaths = append(imgPaths, builder.AppImgPath(t.Name(),
+			builder.BUILD_NAME_LOADER, t.Loader().Name()))
+	}
+
+	for _, path := range imgPaths {
+		if util.NodeNotExist(path) {
+			NewtUsage(nil, util.FmtNewtError(
+				"Image %s does not exist; run \"newt create-image %s\" "+
+					"first", path, t.Name()))
+		}
+
+		padLen, err := image.CheckWriteAlign(path, writeSize,
+			targetWriteAlignPad, flashMap.EraseVal(device))
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+
+		if padLen > 0 {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"Padded image %s with %d byte(s) to a multiple of %d\n",
+				path, padLen, writeSize)
+		} else {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"Image %s length is a multiple of %d\n", path, writeSize)
+		}
+	}
+}
+
+func targetCheckSlotSizesCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	InitProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	errText := targetBspFlashMap(t).AsymmetricSlotText()
+	if errText == "" {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Image slots of target %s are symmetric\n", t.FullName())
+		return
+	}
+
+	util.StatusMessage(util.VERBOSITY_QUIET, "%s", errText)
+	NewtUsage(nil, util.FmtNewtError(
+		"Image slots of target %s are asymmetric", t.FullName()))
+}
+
+func targetCheckSlotAlignCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	InitProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	bsp := targetBsp(t)
+	align := bsp.ImageSlotAlign
+	if targetSlotAlignReq != "" {
+		if targetSlotAlignReq == "sector" {
+			align = 0
+		} else {
+			align, err = util.AtoiNoOct(targetSlotAlignReq)
+			if err != nil || align <= 0 {
+				NewtUsage(cmd, util.FmtNewtError(
+					"Invalid slot alignment: %s", targetSlotAlignReq))
+			}
+		}
+	}
+	if align < 0 {
+		NewtUsage(nil, util.FmtNewtError(
+			"BSP %s does not specify bsp.image_slot_align; specify "+
+				"--require", bsp.FullName()))
+	}
+
+	slots := bsp.FlashMap.MisalignedSlots(align)
+	if len(slots) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Image slots of target %s are aligned\n", t.FullName())
+		return
+	}
+
+	util.StatusMessage(util.VERBOSITY_QUIET, "%s",
+		bsp.FlashMap.MisalignedSlotText(align))
+	NewtUsage(nil, util.FmtNewtError(
+		"%d image slot(s) of target %s misaligned", len(slots), t.FullName()))
+}
+
+func targetCheckBinDirsCmd(cmd *cobra.Command, args []string) {
+	InitProject()
+
+	targets := []*target.Target{}
+	for _, t := range target.GetTargets() {
+		targets = append(targets, t)
+	}
+
+	collisions := builder.BinDirCollisions(targets)
+	if len(collisions) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"No build directory collisions among %d targets\n", len(targets))
+		return
+	}
+
+	errText := "Targets share a build directory:\n"
+	for _, c := range collisions {
+		if c.Nested {
+			errText += fmt.Sprintf("    * %s (%s) is within %s (%s)\n",
+				c.TargetB.FullName(), c.DirB, c.TargetA.FullName(), c.DirA)
+		} else if c.DirA != c.DirB {
+			errText += fmt.Sprintf("    * %s (%s) and %s (%s) differ only "+
+				"in case\n", c.TargetA.FullName(), c.DirA,
+				c.TargetB.FullName(), c.DirB)
+		} else {
+			errText += fmt.Sprintf("    * %s and %s both build in %s\n",
+				c.TargetA.FullName(), c.TargetB.FullName(), c.DirA)
+		}
+	}
+	NewtUsage(nil, util.NewNewtError(strings.TrimSpace(errText)))
+}
+
+func targetCheckFitCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	InitProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+	if t.App() == nil {
+		NewtUsage(nil, util.FmtNewtError(
+			"Target %s does not specify a valid app", t.FullName()))
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if targetFitHeaderOffset != "" {
+		off, err := util.AtoiNoOct(targetFitHeaderOffset)
+		if err != nil || off < 0 {
+			NewtUsage(cmd, util.FmtNewtError(
+				"Invalid header offset: %s", targetFitHeaderOffset))
+		}
+		b.ImageHeaderOffset = off
+	}
+
+	appImgPath, loaderImgPath, err := b.ImagePaths()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if err := b.CheckImageFit(appImgPath, loaderImgPath); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Images of target %s fit in their slots\n", t.FullName())
+}
+
+var targetFlashKconfigOutput string
+
+func targetFlashKconfigCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	InitProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	frag, err := targetBspFlashMap(t).Kconfig()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if targetFlashKconfigOutput == "" {
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s", frag)
+		return
+	}
+
+	err = ioutil.WriteFile(targetFlashKconfigOutput, []byte(frag), 0644)
+	if err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Flash map Kconfig fragment written to %s\n",
+		targetFlashKconfigOutput)
+}
+
+var targetMetaSizeOpts mfg.MetaSizeOptions
+
+func targetMetaSizeCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	InitProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	bd, err := mfg.CalcMetaSize(targetBspFlashMap(t), targetMetaSizeOpts)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	for _, e := range bd.Entries {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"%-28s count=%-3d size=%d\n", e.Name, e.Count, e.Size)
+	}
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "%-28s size=%d\n",
+		"TOTAL", bd.Size)
+	if bd.Reserved != bd.Size {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"%-28s size=%d (including alignment padding)\n",
+			"RESERVED", bd.Reserved)
+	}
+}
+
+func targetFlashSizeCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	InitProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+	if t.App() == nil {
+		NewtUsage(nil, util.FmtNewtError(
+			"Target %s does not specify a valid app", t.FullName()))
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	reqs, err := b.FlashRequirements()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	overrun := []string{}
+	for _, req := range reqs {
+		capStr := "unspecified"
+		if req.Capacity != 0 {
+			capStr = fmt.Sprintf("0x%x", req.Capacity)
+		}
+
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"device %d: minimum size 0x%x (%d bytes); content ends at 0x%x; "+
+				"capacity %s\n", req.Device, req.MinSize, req.MinSize,
+			req.ContentEnd, capStr)
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    areas: %s\n",
+			strings.Join(req.Areas, ", "))
+
+		if req.Capacity != 0 && req.MinSize > req.Capacity {
+			overrun = append(overrun, fmt.Sprintf("device %d", req.Device))
+		}
+	}
+
+	if len(overrun) > 0 {
+		NewtUsage(nil, util.FmtNewtError(
+			"Target %s requires more flash than the BSP provides: %s",
+			t.FullName(), strings.Join(overrun, ", ")))
+	}
+}
+
+var targetDefHashList bool
+
+func targetDefHashCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	InitProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	items, err := b.TargetDef()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if targetDefHashList {
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s",
+			builder.FormatBuildEnv(items))
+	}
+	util.StatusMessage(util.VERBOSITY_QUIET, "%s\n",
+		builder.BuildEnvDigest(items))
+}
+
+func targetCheckLinkerCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	InitProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+	if t.Bsp() == nil {
+		NewtUsage(nil, util.FmtNewtError(
+			"Target %s does not specify a valid BSP", t.FullName()))
+	}
+
+	bsp, err := pkg.NewBspPackage(t.Bsp())
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	scripts := append([]string{}, bsp.LinkerScripts...)
+	scripts = append(scripts, bsp.Part2LinkerScripts...)
+	if len(scripts) == 0 {
+		NewtUsage(nil, util.FmtNewtError(
+			"BSP %s does not specify a linker script", bsp.Name()))
+	}
+
+	numProblems := 0
+	for _, script := range scripts {
+		regions, err := flash.ReadLinkerMemory(script)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+
+		if len(regions) == 0 {
+			util.StatusMessage(util.VERBOSITY_VERBOSE,
+				"%s: no MEMORY command; skipping\n", script)
+			continue
+		}
+
+		found := false
+		for _, region := range regions {
+			if region.Name != targetLinkerRegion {
+				continue
+			}
+			found = true
+
+			problems := bsp.FlashMap.LinkerRegionProblems(region,
+				targetLinkerArea)
+			for _, p := range problems {
+				util.StatusMessage(util.VERBOSITY_QUIET, "%s: %s\n",
+					script, p)
+			}
+			numProblems += len(problems)
+		}
+
+		if !found {
+			util.StatusMessage(util.VERBOSITY_QUIET,
+				"%s: no memory region named %s\n", script,
+				targetLinkerRegion)
+			numProblems++
+		}
+	}
+
+	if numProblems > 0 {
+		NewtUsage(nil, util.FmtNewtError(
+			"%d linker script / flash map discrepancy(s) in target %s",
+			numProblems, t.FullName()))
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Linker scripts of target %s agree with its flash map\n",
+		t.FullName())
+}
+
+func targetIncludePathCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	InitProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	paths, err := b.IncludePaths()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if targetIncludePathJson {
+		buf, err := json.MarshalIndent(paths, "", "  ")
+		if err != nil {
+			NewtUsage(nil, util.ChildNewtError(err))
+		}
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s\n", string(buf))
+		return
+	}
+
+	for _, path := range paths {
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s\n", path)
+	}
+}
+
+func targetLinkCmdCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	InitProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	cmds, err := b.LinkCmds()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	for _, linkCmd := range cmds {
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s\n", linkCmd)
+	}
+}
+
+func targetBspVersionsCmd(cmd *cobra.Command, args []string) {
+	InitProject()
+
+	targets := []*target.Target{}
+	if len(args) == 0 {
+		for _, t := range target.GetTargets() {
+			targets = append(targets, t)
+		}
+	} else {
+		for _, arg := range args {
+			t, err := resolveExistingTargetArg(arg)
+			if err != nil {
+				NewtUsage(cmd, err)
+			}
+			targets = append(targets, t)
+		}
+	}
+
+	report := target.BspVersions(targets)
+	for _, bv := range report.Versions {
+		util.StatusMessage(util.VERBOSITY_VERBOSE, "%s: %s (%s %s)\n",
+			bv.Target.FullName(), bv.BspName, bv.Repo, bv.Version)
+	}
+
+	if len(report.Versions) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"No targets with a resolvable BSP\n")
+		return
+	}
+
+	if len(report.Outliers) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"All %d targets use BSP repo version %s\n",
+			len(report.Versions), report.Majority)
+		return
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"BSP repo version skew detected; most targets use version %s:\n",
+		report.Majority)
+	for _, bv := range report.Outliers {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"    %s: %s (%s %s)\n",
+			bv.Target.FullName(), bv.BspName, bv.Repo, bv.Version)
+	}
+
+	if targetBspVersionsStrict {
+		NewtUsage(nil, util.FmtNewtError(
+			"%d target(s) use an inconsistent BSP repo version",
+			len(report.Outliers)))
+	}
+}
+
+func AddTargetCommands(cmd *cobra.Command) {
+	targetHelpText := ""
+	targetHelpEx := ""
+	targetCmd := &cobra.Command{
+		Use:     "target",
+		Short:   "Command for manipulating targets",
+		Long:    targetHelpText,
+		Example: targetHelpEx,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+		},
+	}
+
+	cmd.AddCommand(targetCmd)
+
+	showHelpText := "Show all the variables for the target specified " +
+		"by <target-name>."
+	showHelpEx := "  newt target show <target-name>\n"
+	showHelpEx += "  newt target show my_target1\n"
+	showHelpEx += "  newt target show --format json my_target1"
+
+	showCmd := &cobra.Command{
+		Use:     "show",
+		Short:   "View target configuration variables",
+		Long:    showHelpText,
+		Example: showHelpEx,
+		Run:     targetShowCmd,
+	}
+	showCmd.PersistentFlags().StringVarP(&targetShowFormat, "format", "",
+		"", "Output format (json or yaml)")
+	showCmd.ValidArgs = targetList()
+	targetCmd.AddCommand(showCmd)
+
+	setHelpText := "Set a target variable (<var-name>) on target " +
+		"<target-name> to value <value>."
+	setHelpEx := "  newt target set <target-name> <var-name>=<value>\n"
+	setHelpEx += "  newt target set my_target1 var_name=value\n"
+	setHelpEx += "  newt target set my_target1 arch=cortex_m4\n"
+	setHelpEx += "  newt target set my_target1 var_name   (display valid values for <var_name>)"
+
+	setCmd := &cobra.Command{
+		Use:     "set",
+		Short:   "Set target configuration variable",
+		Long:    setHelpText,
+		Example: setHelpEx,
+		Run:     targetSetCmd,
+	}
+	setCmd.ValidArgs = targetList()
+	targetCmd.AddCommand(setCmd)
+
+	createHelpText := "Create a target specified by <target-name>."
+	createHelpEx := "  newt target create <target-name>\n"
+	createHelpEx += "  newt target create my_target1"
+
+	createCmd := &cobra.Command{
+		Use:     "create",
+		Short:   "Create a target",
+		Long:    createHelpText,
+		Example: createHelpEx,
+		Run:     targetCreateCmd,
+	}
+
+	targetCmd.AddCommand(createCmd)
+
+	delHelpText := "Delete the target specified by <target-name>.  If " +
+		"--purge is specified, the target's build output directory is " +
+		"deleted as well."
+	delHelpEx := "  newt target delete <target-name>\n"
+	delHelpEx += "  newt target delete my_target1\n"
+	delHelpEx += "  newt target delete --purge my_target1"
+
+	delCmd := &cobra.Command{
+		Use:     "delete",
+		Short:   "Delete target",
+		Long:    delHelpText,
+		Example: delHelpEx,
+		Run:     targetDelCmd,
+	}
+	delCmd.PersistentFlags().BoolVarP(&targetForce, "force", "f", false,
+		"Force delete of targets with user files without prompt")
+	delCmd.PersistentFlags().BoolVarP(&targetPurge, "purge", "", false,
+		"Also delete the target's build output directory")
+
+	targetCmd.AddCommand(delCmd)
+
+	copyHelpText := "Create a new target by cloning <src-target>."
+	copyHelpEx := "  newt target copy <src-target> <dst-target>\n"
+	copyHelpEx += "  newt target copy blinky_sim my_target"
+
+	copyCmd := &cobra.Command{
+		Use:       "copy",
+		Short:     "Copy target",
+		Long:      copyHelpText,
+		Example:   copyHelpEx,
+		Run:       targetCopyCmd,
+		ValidArgs: targetList(),
+	}
+
+	targetCmd.AddCommand(copyCmd)
+
+	renameHelpText := "Rename <src-target> to <dst-target>.  The target's " +
+		"settings and directory contents are preserved."
+	renameHelpEx := "  newt target rename <src-target> <dst-target>\n"
+	renameHelpEx += "  newt target rename blinky_sim my_target"
+
+	renameCmd := &cobra.Command{
+		Use:       "rename",
+		Short:     "Rename target",
+		Long:      renameHelpText,
+		Example:   renameHelpEx,
+		Run:       targetRenameCmd,
+		ValidArgs: targetList(),
+	}
+
+	targetCmd.AddCommand(renameCmd)
+
+	configHelpText := "View a target's system configuration."
+
+	configCmd := &cobra.Command{
+		Use:       "config",
+		Short:     "View target system configuration",
+		Long:      configHelpText,
+		Run:       targetConfigCmd,
+		ValidArgs: targetList(),
+	}
+
+	targetCmd.AddCommand(configCmd)
+
+	configDiffHelpText := "Resolve the system configuration of two " +
+		"targets and show the settings that differ.  The output resembles " +
+		"a unified diff: a setting with different values appears once with " +
+		"a \"-\" prefix (first target) and once with a \"+\" prefix " +
+		"(second target); a setting that only one target defines appears " +
+		"only with that target's prefix."
+	configDiffHelpEx := "  newt target config-diff <target-name> " +
+		"<target-name>\n"
+	configDiffHelpEx += "  newt target config-diff my_target1 my_target2"
+
+	configDiffCmd := &cobra.Command{
+		Use:       "config-diff",
+		Short:     "Compare the system configuration of two targets",
+		Long:      configDiffHelpText,
+		Example:   configDiffHelpEx,
+		Run:       targetConfigDiffCmd,
+		ValidArgs: targetList(),
+	}
+
+	targetCmd.AddCommand(configDiffCmd)
+
+	overridesHelpText := "For each specified target, list the syscfg " +
+		"settings whose resolved values differ from the defaults declared " +
+		"by their defining packages.  Each setting is shown with its " +
+		"default value, its resolved value, and the package that supplied " +
+		"the resolved value."
+	overridesHelpEx := "  newt target overrides <target-name> " +
+		"[target-names...]\n"
+	overridesHelpEx += "  newt target overrides my_target1 my_target2"
+
+	overridesCmd := &cobra.Command{
+		Use:       "overrides",
+		Short:     "List the syscfg settings that targets override",
+		Long:      overridesHelpText,
+		Example:   overridesHelpEx,
+		Run:       targetOverridesCmd,
+		ValidArgs: targetList(),
+	}
+
+	targetCmd.AddCommand(overridesCmd)
+
+	apiConflictsHelpText := "List the APIs that are provided by more than " +
+		"one package in the target specified by <target-name>.  A " +
+		"conflict is an error unless the target names a preferred " +
+		"provider in its target.api_prefs setting, e.g., " +
+		"\"log=@apache-mynewt-core/sys/log/full\"."
+	apiConflictsHelpEx := "  newt target api-conflicts <target-name>\n"
+	apiConflictsHelpEx += "  newt target api-conflicts my_target1"
+
+	apiConflictsCmd := &cobra.Command{
+		Use:       "api-conflicts",
+		Short:     "Show APIs with multiple providers",
+		Long:      apiConflictsHelpText,
+		Example:   apiConflictsHelpEx,
+		Run:       targetApiConflictsCmd,
+		ValidArgs: targetList(),
+	}
+
+	targetCmd.AddCommand(apiConflictsCmd)
+
+	includePathHelpText := "Print the ordered list of include directories " +
+		"that newt passes to the compiler when building the target " +
+		"specified by <target-name>.  This is intended for editor and " +
+		"IDE integration."
+	includePathHelpEx := "  newt target include-path <target-name>\n"
+	includePathHelpEx += "  newt target include-path --json my_target1"
+
+	includePathCmd := &cobra.Command{
+		Use:       "include-path",
+		Short:     "Show target include path",
+		Long:      includePathHelpText,
+		Example:   includePathHelpEx,
+		Run:       targetIncludePathCmd,
+		ValidArgs: targetList(),
+	}
+	includePathCmd.PersistentFlags().BoolVarP(&targetIncludePathJson,
+		"json", "j", false, "Output the include path as a JSON array")
+
+	targetCmd.AddCommand(includePathCmd)
+
+	linkCmdHelpText := "Print the linker invocation for the target " +
+		"specified by <target-name>, including the linker scripts, " +
+		"libraries, and flags.  The target must already have been built."
+	linkCmdHelpEx := "  newt target link-cmd <target-name>\n"
+	linkCmdHelpEx += "  newt target link-cmd my_target1"
+
+	linkCmdCmd := &cobra.Command{
+		Use:       "link-cmd",
+		Short:     "Show target linker command",
+		Long:      linkCmdHelpText,
+		Example:   linkCmdHelpEx,
+		Run:       targetLinkCmdCmd,
+		ValidArgs: targetList(),
+	}
+
+	targetCmd.AddCommand(linkCmdCmd)
+
+	bspVersionsHelpText := "Report the version of the repo containing " +
+		"each target's BSP, and flag targets that use a different version " +
+		"than the majority.  If no targets are specified, all targets in " +
+		"the project are checked.  The report is informational unless " +
+		"--strict is specified, in which case skew is an error."
+	bspVersionsHelpEx := "  newt target bsp-versions [target-name...]\n"
+	bspVersionsHelpEx += "  newt target bsp-versions --strict"
+
+	bspVersionsCmd := &cobra.Command{
+		Use:       "bsp-versions",
+		Short:     "Check targets for BSP repo version skew",
+		Long:      bspVersionsHelpText,
+		Example:   bspVersionsHelpEx,
+		Run:       targetBspVersionsCmd,
+		ValidArgs: targetList(),
+	}
+	bspVersionsCmd.PersistentFlags().BoolVarP(&targetBspVersionsStrict,
+		"strict", "", false, "Fail if any target's BSP repo version differs "+
+			"from the majority")
+
+	targetCmd.AddCommand(bspVersionsCmd)
+
+	flashIdsHelpText := "Check that the flash areas in the BSP of the " +
+		"target specified by <target-name> have unique IDs.  By default, " +
+		"IDs are scoped per flash device, so areas in different devices " +
+		"may share an ID.  With --global, IDs must be unique across all " +
+		"devices, as some boot loaders require."
+	flashIdsHelpEx := "  newt target flash-ids <target-name>\n"
+	flashIdsHelpEx += "  newt target flash-ids --global my_target1"
+
+	flashIdsCmd := &cobra.Command{
+		Use:       "flash-ids",
+		Short:     "Check target flash area IDs for collisions",
+		Long:      flashIdsHelpText,
+		Example:   flashIdsHelpEx,
+		Run:       targetFlashIdsCmd,
+		ValidArgs: targetList(),
+	}
+	flashIdsCmd.PersistentFlags().BoolVarP(&targetFlashIdsGlobal,
+		"global", "", false, "Require flash area IDs to be unique across "+
+			"all devices")
+
+	targetCmd.AddCommand(flashIdsCmd)
+
+	otaCompatHelpText := "Check that images built for <updated-target> " +
+		"can be installed over the air on devices running " +
+		"<deployed-target>.  The image slots (FLASH_AREA_IMAGE_0 and " +
+		"FLASH_AREA_IMAGE_1) in the two targets' BSP flash maps must have " +
+		"identical devices, offsets, and sizes; other flash areas are " +
+		"ignored."
+	otaCompatHelpEx := "  newt target ota-compat <deployed-target> " +
+		"<updated-target>\n"
+	otaCompatHelpEx += "  newt target ota-compat my_target_v1 my_target_v2"
+
+	otaCompatCmd := &cobra.Command{
+		Use:       "ota-compat",
+		Short:     "Check two targets' flash maps for OTA compatibility",
+		Long:      otaCompatHelpText,
+		Example:   otaCompatHelpEx,
+		Run:       targetOtaCompatCmd,
+		ValidArgs: targetList(),
+	}
+
+	targetCmd.AddCommand(otaCompatCmd)
+
+	bootAppFlashHelpText := "Check that the boot loader built for " +
+		"<boot-target> and the app built for <app-target> agree on the " +
+		"flash layout.  The flash map each build was linked against is " +
+		"read from its manifest; the system areas (boot loader, image " +
+		"slots, and scratch) must have identical IDs, devices, offsets, " +
+		"and sizes.  Both targets must have been built."
+	bootAppFlashHelpEx := "  newt target boot-app-flash <boot-target> " +
+		"<app-target>\n"
+	bootAppFlashHelpEx += "  newt target boot-app-flash my_boot my_blinky"
+
+	bootAppFlashCmd := &cobra.Command{
+		Use:       "boot-app-flash",
+		Short:     "Check that a boot loader and app agree on the flash map",
+		Long:      bootAppFlashHelpText,
+		Example:   bootAppFlashHelpEx,
+		Run:       targetBootAppFlashCmd,
+		ValidArgs: targetList(),
+	}
+
+	targetCmd.AddCommand(bootAppFlashCmd)
+
+	checkSlotsHelpText := "Check that each image slot in the BSP of the " +
+		"target specified by <target-name> is larger than the overhead of " +
+		"an image: the image header, the hash TLV, and the boot trailer at " +
+		"the end of the slot.  A smaller slot cannot hold any image.  The " +
+		"boot trailer's size depends on the flash device's write " +
+		"alignment."
+	checkSlotsHelpEx := "  newt target check-slots <target-name>\n"
+	checkSlotsHelpEx += "  newt target check-slots --align 8 my_target1"
+
+	checkSlotsCmd := &cobra.Command{
+		Use:       "check-slots",
+		Short:     "Check target image slots for a minimum viable size",
+		Long:      checkSlotsHelpText,
+		Example:   checkSlotsHelpEx,
+		Run:       targetCheckSlotsCmd,
+		ValidArgs: targetList(),
+	}
+	checkSlotsCmd.PersistentFlags().IntVarP(&targetSlotAlign, "align", "",
+		1, "Minimum write size, in bytes, of the flash device")
+
+	targetCmd.AddCommand(checkSlotsCmd)
+
+	checkSlotSizesHelpText := "Check that the image slots " +
+		"(FLASH_AREA_IMAGE_0 and FLASH_AREA_IMAGE_1) in the BSP of the " +
+		"target specified by <target-name> are the same size.  The boot " +
+		"loader's swap logic depends on symmetric slots; a target with a " +
+		"single image slot passes."
+	checkSlotSizesHelpEx := "  newt target check-slot-sizes <target-name>"
+
+	checkSlotSizesCmd := &cobra.Command{
+		Use:       "check-slot-sizes",
+		Short:     "Check that a target's image slots are the same size",
+		Long:      checkSlotSizesHelpText,
+		Example:   checkSlotSizesHelpEx,
+		Run:       targetCheckSlotSizesCmd,
+		ValidArgs: targetList(),
+	}
+
+	targetCmd.AddCommand(checkSlotSizesCmd)
+
+	checkWriteAlignHelpText := "Ensure that the length of each image of " +
+		"the target specified by <target-name> is a multiple of the " +
+		"program unit of the flash device holding its image slots " +
+		"(the device's write_size in the BSP's flash map).  Some flash " +
+		"controllers only write whole program units.  With --pad, a " +
+		"misaligned image is padded with the device's erase value; " +
+		"otherwise, it is reported as an error.  The padding follows the " +
+		"trailer and does not affect the image hash."
+	checkWriteAlignHelpEx := "  newt target check-write-align " +
+		"<target-name>\n"
+	checkWriteAlignHelpEx += "  newt target check-write-align --pad " +
+		"my_target1"
+
+	checkWriteAlignCmd := &cobra.Command{
+		Use:       "check-write-align",
+		Short:     "Check that target images fill whole flash program units",
+		Long:      checkWriteAlignHelpText,
+		Example:   checkWriteAlignHelpEx,
+		Run:       targetCheckWriteAlignCmd,
+		ValidArgs: targetList(),
+	}
+	checkWriteAlignCmd.PersistentFlags().BoolVarP(&targetWriteAlignPad,
+		"pad", "", false, "Pad misaligned images instead of failing")
+
+	targetCmd.AddCommand(checkWriteAlignCmd)
+
+	pkgFlashAreasHelpText := "List the flash areas referenced by the " +
+		"package specified by <package-name> when built for the target " +
+		"specified by <target-name>.  A package references an area " +
+		"through a syscfg setting it defines or overrides whose resolved " +
+		"value names the area, or by naming the area in one of its " +
+		"source files."
+	pkgFlashAreasHelpEx := "  newt target pkg-flash-areas <target-name> " +
+		"<package-name>\n"
+	pkgFlashAreasHelpEx += "  newt target pkg-flash-areas my_target1 " +
+		"@apache-mynewt-core/sys/log/full"
+
+	pkgFlashAreasCmd := &cobra.Command{
+		Use:       "pkg-flash-areas",
+		Short:     "List the flash areas a package references",
+		Long:      pkgFlashAreasHelpText,
+		Example:   pkgFlashAreasHelpEx,
+		Run:       targetPkgFlashAreasCmd,
+		ValidArgs: targetList(),
+	}
+
+	targetCmd.AddCommand(pkgFlashAreasCmd)
+
+	checkFitHelpText := "Check that each image of the target specified " +
+		"by <target-name> fits in the slot it runs from.  The image header, " +
+		"payload, and trailer (including any signature) must all fit; an " +
+		"image whose payload fits but whose trailer does not is rejected.  " +
+		"The images must already have been created."
+	checkFitHelpEx := "  newt target check-fit <target-name>\n"
+	checkFitHelpEx += "  newt target check-fit --header-offset 0x20 my_target1"
+
+	checkFitCmd := &cobra.Command{
+		Use:       "check-fit",
+		Short:     "Check that target images fit in their slots",
+		Long:      checkFitHelpText,
+		Example:   checkFitHelpEx,
+		Run:       targetCheckFitCmd,
+		ValidArgs: targetList(),
+	}
+	checkFitCmd.PersistentFlags().StringVarP(&targetFitHeaderOffset,
+		"header-offset", "", "", "Offset of the header within each image "+
+			"file, as specified to create-image")
+
+	targetCmd.AddCommand(checkFitCmd)
+
+	flashSizeHelpText := "Calculate the minimum size of each flash device " +
+		"that the target specified by <target-name> requires.  A device " +
+		"must hold every flash area the build populates: the boot loader " +
+		"or image slots that receive the build's output, and any area " +
+		"claimed by a flash_owner setting.  Devices are reported " +
+		"separately.  The images must already have been created."
+	flashSizeHelpEx := "  newt target flash-size <target-name>\n"
+	flashSizeHelpEx += "  newt target flash-size my_target1"
+
+	flashSizeCmd := &cobra.Command{
+		Use:       "flash-size",
+		Short:     "Calculate the flash capacity a target requires",
+		Long:      flashSizeHelpText,
+		Example:   flashSizeHelpEx,
+		Run:       targetFlashSizeCmd,
+		ValidArgs: targetList(),
+	}
+
+	targetCmd.AddCommand(flashSizeCmd)
+
+	flashKconfigHelpText := "Render the BSP flash map of the target " +
+		"specified by <target-name> as a Kconfig fragment.  Each flash " +
+		"area produces CONFIG_<AREA>_ID, _DEVICE, _OFFSET, and _SIZE " +
+		"symbols, where <AREA> is the area name upper-cased with invalid " +
+		"characters replaced by underscores.  The fragment is printed " +
+		"unless --output is specified."
+	flashKconfigHelpEx := "  newt target flash-kconfig <target-name>\n"
+	flashKconfigHelpEx += "  newt target flash-kconfig my_target1 " +
+		"--output flash.conf"
+
+	flashKconfigCmd := &cobra.Command{
+		Use:       "flash-kconfig",
+		Short:     "Render a target's flash map as a Kconfig fragment",
+		Long:      flashKconfigHelpText,
+		Example:   flashKconfigHelpEx,
+		Run:       targetFlashKconfigCmd,
+		ValidArgs: targetList(),
+	}
+	flashKconfigCmd.PersistentFlags().StringVarP(&targetFlashKconfigOutput,
+		"output", "", "", "File to write the fragment to")
+
+	targetCmd.AddCommand(flashKconfigCmd)
+
+	metaSizeHelpText := "Calculate the size of the manufacturing meta " +
+		"region for the BSP flash map of the target specified by " +
+		"<target-name>, without building anything.  The region consists " +
+		"of a header, one flash area TLV per flash area, a hash TLV, " +
+		"and a footer, plus any optional TLVs selected with the flags " +
+		"below.  A per-TLV-type breakdown is printed."
+	metaSizeHelpEx := "  newt target meta-size <target-name>\n"
+	metaSizeHelpEx += "  newt target meta-size my_target1 --hmac " +
+		"--salt-size 16"
+
+	metaSizeCmd := &cobra.Command{
+		Use:       "meta-size",
+		Short:     "Display the size of a target's manufacturing meta region",
+		Long:      metaSizeHelpText,
+		Example:   metaSizeHelpEx,
+		Run:       targetMetaSizeCmd,
+		ValidArgs: targetList(),
+	}
+	metaSizeCmd.PersistentFlags().BoolVarP(&targetMetaSizeOpts.Hmac,
+		"hmac", "", false, "Include an HMAC TLV")
+	metaSizeCmd.PersistentFlags().BoolVarP(&targetMetaSizeOpts.Crc,
+		"crc", "", false, "Include a CRC TLV")
+	metaSizeCmd.PersistentFlags().BoolVarP(&targetMetaSizeOpts.RegionCrc,
+		"region-crc", "", false, "Include a region CRC TLV")
+	metaSizeCmd.PersistentFlags().BoolVarP(&targetMetaSizeOpts.Serial,
+		"serial", "", false, "Include a serial number TLV")
+	metaSizeCmd.PersistentFlags().IntVarP(&targetMetaSizeOpts.SaltSize,
+		"salt-size", "", 0, "Include a hash salt TLV of this many bytes")
+	metaSizeCmd.PersistentFlags().IntVarP(&targetMetaSizeOpts.LicenseSize,
+		"license-size", "", 0, "Include a license TLV of this many bytes")
+
+	targetCmd.AddCommand(metaSizeCmd)
+
+	checkSlotAlignHelpText := "Check that each image slot of the target " +
+		"specified by <target-name> starts on the boundary its boot loader " +
+		"requires.  The requirement is taken from the BSP's " +
+		"bsp.image_slot_align setting unless --require is specified.  " +
+		"A requirement of \"sector\" indicates the erase sector size of " +
+		"the slot's flash device."
+	checkSlotAlignHelpEx := "  newt target check-slot-align <target-name>\n"
+	checkSlotAlignHelpEx += "  newt target check-slot-align --require " +
+		"0x20000 my_target1"
+
+	checkSlotAlignCmd := &cobra.Command{
+		Use:       "check-slot-align",
+		Short:     "Check that image slots are aligned as required",
+		Long:      checkSlotAlignHelpText,
+		Example:   checkSlotAlignHelpEx,
+		Run:       targetCheckSlotAlignCmd,
+		ValidArgs: targetList(),
+	}
+	checkSlotAlignCmd.PersistentFlags().StringVarP(&targetSlotAlignReq,
+		"require", "", "", "Required slot alignment, or \"sector\"; "+
+			"overrides bsp.image_slot_align")
+
+	targetCmd.AddCommand(checkSlotAlignCmd)
+
+	checkBinDirsHelpText := "Check that no two targets in the project " +
+		"build into the same directory.  Directories that differ only in " +
+		"case collide on case-insensitive filesystems, and a target whose " +
+		"directory lies within another target's directory overwrites that " +
+		"target's artifacts; both are reported."
+
+	checkBinDirsCmd := &cobra.Command{
+		Use:   "check-bin-dirs",
+		Short: "Check that targets do not share build directories",
+		Long:  checkBinDirsHelpText,
+		Run:   targetCheckBinDirsCmd,
+	}
+
+	targetCmd.AddCommand(checkBinDirsCmd)
+
+	checkMarkersHelpText := "Scan the generated syscfg, sysinit, and flash " +
+		"map files of the target specified by <target-name> for forbidden " +
+		"marker strings, such as template placeholders.  The markers are " +
+		"read from the target's target.forbidden_markers setting (a " +
+		"whitespace-separated list) unless --markers is given.  When " +
+		"target.forbidden_markers is set, the build performs this check " +
+		"automatically."
+	checkMarkersHelpEx := "  newt target check-markers <target-name>\n"
+	checkMarkersHelpEx += "  newt target check-markers " +
+		"--markers \"TODO FIXME\" my_target1"
+
+	checkMarkersCmd := &cobra.Command{
+		Use:       "check-markers",
+		Short:     "Check generated target files for forbidden markers",
+		Long:      checkMarkersHelpText,
+		Example:   checkMarkersHelpEx,
+		Run:       targetCheckMarkersCmd,
+		ValidArgs: targetList(),
+	}
+	checkMarkersCmd.PersistentFlags().StringVarP(&targetMarkers,
+		"markers", "", "", "Whitespace-separated markers to search for "+
+			"(overrides target.forbidden_markers)")
+
+	targetCmd.AddCommand(checkMarkersCmd)
+
+	sysinitHelpText := "Display the order in which the generated sysinit " +
+		"code of the target specified by <target-name> calls package init " +
+		"functions.  Each call is shown as <stage>.<index>: <function> " +
+		"(<package>).  Stages shared by several packages are flagged; " +
+		"calls within such a stage are ordered by package name only."
+	sysinitHelpEx := "  newt target sysinit <target-name>\n"
+	sysinitHelpEx += "  newt target sysinit my_target1"
+
+	sysinitCmd := &cobra.Command{
+		Use:       "sysinit",
+		Short:     "Display the sysinit call order of a target",
+		Long:      sysinitHelpText,
+		Example:   sysinitHelpEx,
+		Run:       targetSysinitCmd,
+		ValidArgs: targetList(),
+	}
+
+	targetCmd.AddCommand(sysinitCmd)
+
+	sysinitCoverageHelpText := "Check that the generated sysinit source " +
+		"of the target specified by <target-name> calls the init " +
+		"function of every package that declares one (pkg.init_function), " +
+		"in the stage the package declares (pkg.init_stage).  Packages " +
+		"that declare an init function without a numeric stage, and calls " +
+		"that belong to no such package, are also reported.  The target " +
+		"must have been built."
+	sysinitCoverageHelpEx := "  newt target sysinit-coverage <target-name>\n"
+	sysinitCoverageHelpEx += "  newt target sysinit-coverage my_target1"
+
+	sysinitCoverageCmd := &cobra.Command{
+		Use:       "sysinit-coverage",
+		Short:     "Check that a target's generated sysinit is complete",
+		Long:      sysinitCoverageHelpText,
+		Example:   sysinitCoverageHelpEx,
+		Run:       targetSysinitCoverageCmd,
+		ValidArgs: targetList(),
+	}
+
+	targetCmd.AddCommand(sysinitCoverageCmd)
+
+	checkLinkerHelpText := "Compare the memory regions in the linker " +
+		"scripts of the BSP of the target specified by <target-name> " +
+		"against its flash map.  Each script's region (FLASH by default) " +
+		"must have the same origin and length as the flash area it " +
+		"describes.  Unless --area is specified, that area is the one " +
+		"starting at, or else containing, the region's origin.  Scripts " +
+		"without a MEMORY command are skipped."
+	checkLinkerHelpEx := "  newt target check-linker <target-name>\n"
+	checkLinkerHelpEx += "  newt target check-linker --area " +
+		"FLASH_AREA_IMAGE_0 my_target1"
+
+	checkLinkerCmd := &cobra.Command{
+		Use:       "check-linker",
+		Short:     "Check a target's linker scripts against its flash map",
+		Long:      checkLinkerHelpText,
+		Example:   checkLinkerHelpEx,
+		Run:       targetCheckLinkerCmd,
+		ValidArgs: targetList(),
+	}
+	checkLinkerCmd.PersistentFlags().StringVarP(&targetLinkerRegion,
+		"region", "", "FLASH", "Name of the linker script memory region "+
+			"to check")
+	checkLinkerCmd.PersistentFlags().StringVarP(&targetLinkerArea,
+		"area", "", "", "Flash area the region must match (default: "+
+			"inferred from the region's origin)")
+
+	targetCmd.AddCommand(checkLinkerCmd)
+
+	defHashHelpText := "Print a digest of the fully resolved definition " +
+		"of the target specified by <target-name>: its BSP, app, and " +
+		"loader packages, build profile, target settings, syscfg values, " +
+		"flash map, and the commit of each repo that contributes a " +
+		"package.  Source file contents are not included (see " +
+		"\"newt fingerprint\").  Two audits that print the same digest " +
+		"describe the same build.  With --list, the hashed items are " +
+		"printed before the digest."
+	defHashHelpEx := "  newt target def-hash <target-name>\n"
+	defHashHelpEx += "  newt target def-hash --list my_target1"
+
+	defHashCmd := &cobra.Command{
+		Use:       "def-hash",
+		Short:     "Print a digest of a target's resolved definition",
+		Long:      defHashHelpText,
+		Example:   defHashHelpEx,
+		Run:       targetDefHashCmd,
+		ValidArgs: targetList(),
+	}
+	defHashCmd.PersistentFlags().BoolVarP(&targetDefHashList, "list", "",
+		false, "Print each hashed item before the digest")
+
+	targetCmd.AddCommand(defHashCmd)
 }
@@ -0,0 +1,281 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/newt/syscfg"
+	"mynewt.apache.org/newt/newt/target"
+)
+
+func testShowTarget() *target.Target {
+	lpkg := pkg.NewLocalPackage(&repo.Repo{}, "/test/targets/blinky_nrf")
+	lpkg.SetName("targets/blinky_nrf")
+	lpkg.SetType(pkg.PACKAGE_TYPE_TARGET)
+	lpkg.PkgV.Set("pkg.cflags", []string{"-DTEST", "-DDEBUG"})
+
+	t := target.NewTarget(lpkg)
+	t.BspName = "hw/bsp/nordic_pca10056"
+	t.AppName = "apps/blinky"
+	t.BuildProfile = "debug"
+	t.Vars = map[string]string{
+		"target.bsp":           t.BspName,
+		"target.app":           t.AppName,
+		"target.build_profile": t.BuildProfile,
+	}
+
+	return t
+}
+
+// A resolved configuration in which the target overrides LOG_LEVEL and the
+// BSP overrides UART_0; SHELL_TASK keeps its default.
+func testShowCfg() syscfg.Cfg {
+	libPkg := pkg.NewLocalPackage(&repo.Repo{}, "/test/sys/log")
+	bspPkg := pkg.NewLocalPackage(&repo.Repo{}, "/test/hw/bsp")
+	tgtPkg := pkg.NewLocalPackage(&repo.Repo{}, "/test/targets/blinky_nrf")
+
+	cfg := syscfg.NewCfg()
+	cfg.Settings["LOG_LEVEL"] = syscfg.CfgEntry{
+		Name:  "LOG_LEVEL",
+		Value: "2",
+		History: []syscfg.CfgPoint{
+			{Value: "0", Source: libPkg},
+			{Value: "2", Source: tgtPkg},
+		},
+	}
+	cfg.Settings["UART_0"] = syscfg.CfgEntry{
+		Name:  "UART_0",
+		Value: "1",
+		History: []syscfg.CfgPoint{
+			{Value: "0", Source: libPkg},
+			{Value: "1", Source: bspPkg},
+		},
+	}
+	cfg.Settings["SHELL_TASK"] = syscfg.CfgEntry{
+		Name:    "SHELL_TASK",
+		Value:   "0",
+		History: []syscfg.CfgPoint{{Value: "0", Source: libPkg}},
+	}
+
+	return cfg
+}
+
+func TestTargetShowInfoJson(t *testing.T) {
+	info := newTargetShowInfo(testShowTarget(), cfgOverrides(testShowCfg()))
+
+	b, err := json.Marshal([]targetShowInfo{info})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 {
+		t.Fatalf("got %d targets; want 1", len(decoded))
+	}
+	obj := decoded[0]
+
+	tests := []struct {
+		path []string
+		want string
+	}{
+		{[]string{"name"}, "targets/blinky_nrf"},
+		{[]string{"bsp"}, "hw/bsp/nordic_pca10056"},
+		{[]string{"app"}, "apps/blinky"},
+		{[]string{"build_profile"}, "debug"},
+		{[]string{"vars", "bsp"}, "hw/bsp/nordic_pca10056"},
+		{[]string{"vars", "build_profile"}, "debug"},
+		{[]string{"syscfg", "LOG_LEVEL"}, "2"},
+		{[]string{"syscfg", "UART_0"}, "1"},
+		{[]string{"cflags"}, "[-DDEBUG -DTEST]"},
+		{[]string{"lflags"}, "[]"},
+	}
+
+	for _, test := range tests {
+		var node interface{} = obj
+		for _, key := range test.path {
+			m, ok := node.(map[string]interface{})
+			if !ok {
+				node = nil
+				break
+			}
+			node = m[key]
+		}
+
+		if got := fmt.Sprint(node); got != test.want {
+			t.Errorf("%s=%s; want %s", strings.Join(test.path, "."), got,
+				test.want)
+		}
+	}
+
+	syscfgObj := obj["syscfg"].(map[string]interface{})
+	if _, ok := syscfgObj["SHELL_TASK"]; ok {
+		t.Errorf("syscfg contains SHELL_TASK, which is not overridden")
+	}
+	if _, ok := obj["loader"]; ok {
+		t.Errorf("output contains loader; target has none")
+	}
+}
+
+func TestTargetShowInfoYaml(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string]string
+		want      []string
+		unwanted  []string
+	}{
+		{
+			name:      "resolved",
+			overrides: cfgOverrides(testShowCfg()),
+			want: []string{
+				"- name: \"targets/blinky_nrf\"\n",
+				"  bsp: \"hw/bsp/nordic_pca10056\"\n",
+				"  syscfg:\n      LOG_LEVEL: \"2\"\n      UART_0: \"1\"\n",
+				"  cflags:\n      - \"-DDEBUG\"\n      - \"-DTEST\"\n",
+			},
+			unwanted: []string{"SHELL_TASK"},
+		},
+		{
+			name:      "unresolved",
+			overrides: nil,
+			want:      []string{"  app: \"apps/blinky\"\n"},
+			unwanted:  []string{"syscfg"},
+		},
+	}
+
+	for _, test := range tests {
+		info := newTargetShowInfo(testShowTarget(), test.overrides)
+		out := targetShowInfosYaml([]targetShowInfo{info})
+
+		for _, w := range test.want {
+			if !strings.Contains(out, w) {
+				t.Errorf("%s: output missing %q:\n%s", test.name, w, out)
+			}
+		}
+		for _, u := range test.unwanted {
+			if strings.Contains(out, u) {
+				t.Errorf("%s: output contains %q:\n%s", test.name, u, out)
+			}
+		}
+	}
+}
+
+func TestPurgeBinDir(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// The directory to purge, relative to the test's temporary
+		// directory; the bin directory is "proj/bin".
+		dir       string
+		wantErr   bool
+		wantGone  bool
+		wantExist []string
+	}{
+		{
+			name:      "target output",
+			dir:       "proj/bin/targets/blinky",
+			wantGone:  true,
+			wantExist: []string{"proj/bin/targets/slinky"},
+		},
+		{
+			name:      "bin directory itself",
+			dir:       "proj/bin",
+			wantErr:   true,
+			wantExist: []string{"proj/bin/targets/blinky"},
+		},
+		{
+			name:      "outside bin directory",
+			dir:       "proj/bin/../targets/blinky",
+			wantErr:   true,
+			wantExist: []string{"proj/targets/blinky"},
+		},
+		{
+			name:      "bin directory prefix",
+			dir:       "proj/bin2/targets/blinky",
+			wantErr:   true,
+			wantExist: []string{"proj/bin2/targets/blinky"},
+		},
+		{
+			name: "no build output",
+			dir:  "proj/bin/targets/never_built",
+		},
+	}
+
+	savedForce := targetForce
+	targetForce = true
+	defer func() { targetForce = savedForce }()
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "newt-purge")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Stub artifacts for two built targets, plus target definitions and
+		// a look-alike directory outside the bin directory.
+		for _, f := range []string{
+			"proj/bin/targets/blinky/app/apps/blinky/blinky.elf",
+			"proj/bin/targets/slinky/app/apps/slinky/slinky.elf",
+			"proj/targets/blinky/target.yml",
+			"proj/bin2/targets/blinky/blinky.elf",
+		} {
+			path := filepath.Join(dir, f)
+			os.MkdirAll(filepath.Dir(path), 0755)
+			if err := ioutil.WriteFile(path, []byte("stub"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		binRoot := filepath.Join(dir, "proj/bin")
+		err = purgeBinDir(binRoot, dir+"/"+test.dir, "targets/blinky")
+		if test.wantErr && err == nil {
+			t.Errorf("%s: expected error", test.name)
+		} else if !test.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+
+		if test.wantGone && !os.IsNotExist(statErr(dir, test.dir)) {
+			t.Errorf("%s: %s not deleted", test.name, test.dir)
+		}
+		for _, p := range test.wantExist {
+			if err := statErr(dir, p); err != nil {
+				t.Errorf("%s: %s deleted", test.name, p)
+			}
+		}
+
+		os.RemoveAll(dir)
+	}
+}
+
+func statErr(dir string, rel string) error {
+	_, err := os.Stat(filepath.Join(dir, rel))
+	return err
+}
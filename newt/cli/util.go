@@ -30,6 +30,7 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"mynewt.apache.org/newt/newt/mfg"
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
@@ -45,7 +46,7 @@ func NewtUsage(cmd *cobra.Command, err error) {
 	if err != nil {
 		sErr := err.(*util.NewtError)
 		log.Debugf("%s", sErr.StackTrace)
-		fmt.Fprintf(os.Stderr, "Error: %s\n", sErr.Text)
+		util.ErrorMessage(util.VERBOSITY_SILENT, "Error: %s\n", sErr.Text)
 	}
 
 	if cmd != nil {
@@ -53,6 +54,11 @@ func NewtUsage(cmd *cobra.Command, err error) {
 		fmt.Printf("%s - ", cmd.Name())
 		cmd.Help()
 	}
+
+	if err := util.CloseLogFile(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to write log file: %s\n",
+			err.Error())
+	}
 	os.Exit(1)
 }
 
@@ -210,5 +216,9 @@ func InitProject() *project.Project {
 		util.ErrorMessage(util.VERBOSITY_QUIET, "* Warning: %s\n", w)
 	}
 
+	if err := mfg.SetMetaTlvCodes(p.MetaTlvCodes()); err != nil {
+		NewtUsage(nil, err)
+	}
+
 	return p
 }
@@ -28,6 +28,7 @@ import (
 	"mynewt.apache.org/newt/newt/interfaces"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/toolchain"
 	"mynewt.apache.org/newt/util"
 )
 
@@ -95,6 +96,9 @@ func buildProfileValues() ([]string, error) {
 		}
 	}
 
+	// The coverage profile is provided by newt itself.
+	profileMap[toolchain.COVERAGE_BUILD_PROFILE] = struct{}{}
+
 	values := make([]string, 0, len(profileMap))
 	for k, _ := range profileMap {
 		values = append(values, k)
@@ -0,0 +1,509 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package flash
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// A flash map can be extracted from a device tree source file.  Each node
+// with a "fixed-partitions" compatible string describes the partitions of
+// the flash device represented by its parent node:
+//
+//     flash0: flash@0 {
+//         erase-block-size = <4096>;
+//
+//         partitions {
+//             compatible = "fixed-partitions";
+//             #address-cells = <1>;
+//             #size-cells = <1>;
+//
+//             boot_partition: partition@0 {
+//                 label = "mcuboot";
+//                 reg = <0x00000000 0x8000>;
+//             };
+//             ...
+//         };
+//     };
+//
+// Flash devices are numbered in the order their partitions nodes appear.  A
+// partition's label (or, lacking one, its node name) determines its area
+// name; the labels that conventionally identify the boot loader and image
+// slots map to the corresponding system areas.  Every other partition
+// becomes a user area, numbered in order of appearance.  Preprocessor
+// directives are ignored, so cell values must be plain numbers.
+
+const DTS_COMPAT_FIXED_PARTITIONS = "fixed-partitions"
+
+var dtsSystemLabelMap = map[string]string{
+	"boot":          FLASH_AREA_NAME_BOOTLOADER,
+	"bootloader":    FLASH_AREA_NAME_BOOTLOADER,
+	"mcuboot":       FLASH_AREA_NAME_BOOTLOADER,
+	"image-0":       FLASH_AREA_NAME_IMAGE_0,
+	"slot0":         FLASH_AREA_NAME_IMAGE_0,
+	"image-1":       FLASH_AREA_NAME_IMAGE_1,
+	"slot1":         FLASH_AREA_NAME_IMAGE_1,
+	"image-scratch": FLASH_AREA_NAME_IMAGE_SCRATCH,
+	"scratch":       FLASH_AREA_NAME_IMAGE_SCRATCH,
+}
+
+type dtsProp struct {
+	strs  []string
+	cells []uint64
+}
+
+type dtsNode struct {
+	name     string
+	props    map[string]dtsProp
+	children []*dtsNode
+}
+
+type dtsParser struct {
+	toks []string
+	pos  int
+}
+
+func isDtsPunct(c byte) bool {
+	return strings.IndexByte("{};=<>,[]", c) != -1
+}
+
+// Removes comments and preprocessor directives from device tree source.
+func stripDts(src string) string {
+	b := &bytes.Buffer{}
+
+	for i := 0; i < len(src); i++ {
+		switch {
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end == -1 {
+				return b.String()
+			}
+			i += end + 3
+
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end == -1 {
+				return b.String()
+			}
+			i += end - 1
+
+		case src[i] == '"':
+			end := strings.IndexByte(src[i+1:], '"')
+			if end == -1 {
+				end = len(src) - i - 1
+			}
+			b.WriteString(src[i : i+end+2])
+			i += end + 1
+
+		default:
+			b.WriteByte(src[i])
+		}
+	}
+
+	return b.String()
+}
+
+func isDtsDirective(line string) bool {
+	line = strings.TrimSpace(line)
+	for _, d := range []string{
+		"#include", "#define", "#undef", "#if", "#else", "#elif", "#endif",
+		"/include/",
+	} {
+		if strings.HasPrefix(line, d) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func tokenizeDts(src string) []string {
+	lines := strings.Split(stripDts(src), "\n")
+	for i, line := range lines {
+		if isDtsDirective(line) {
+			lines[i] = ""
+		}
+	}
+	src = strings.Join(lines, "\n")
+
+	toks := []string{}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '"':
+			end := strings.IndexByte(src[i+1:], '"')
+			if end == -1 {
+				end = len(src) - i - 1
+			}
+			toks = append(toks, src[i:i+end+2])
+			i += end + 2
+
+		case isDtsPunct(c):
+			toks = append(toks, string(c))
+			i++
+
+		default:
+			start := i
+			for i < len(src) && !isDtsPunct(src[i]) &&
+				strings.IndexByte(" \t\n\r\"", src[i]) == -1 {
+
+				i++
+			}
+			toks = append(toks, src[start:i])
+		}
+	}
+
+	return toks
+}
+
+func (p *dtsParser) peek() string {
+	if p.pos >= len(p.toks) {
+		return ""
+	}
+	return p.toks[p.pos]
+}
+
+func (p *dtsParser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *dtsParser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		return util.FmtNewtError(
+			"Invalid device tree source; expected \"%s\", got \"%s\"",
+			tok, got)
+	}
+	return nil
+}
+
+func parseDtsCell(tok string) (uint64, error) {
+	val, err := strconv.ParseUint(tok, 0, 64)
+	if err != nil {
+		return 0, util.FmtNewtError(
+			"Unsupported device tree cell value \"%s\"; must be a number",
+			tok)
+	}
+	return val, nil
+}
+
+// Parses a property value: a comma-separated list of strings, cell lists,
+// and byte strings.  The terminating semicolon is consumed.
+func (p *dtsParser) parseValue() (dtsProp, error) {
+	prop := dtsProp{}
+
+	for {
+		tok := p.next()
+		switch {
+		case strings.HasPrefix(tok, "\""):
+			prop.strs = append(prop.strs, strings.Trim(tok, "\""))
+
+		case tok == "<":
+			for p.peek() != ">" {
+				if p.peek() == "" {
+					return prop, util.NewNewtError(
+						"Invalid device tree source; unterminated cell list")
+				}
+				cell := p.next()
+				if strings.HasPrefix(cell, "&") {
+					// Phandle references carry no flash geometry.
+					continue
+				}
+				val, err := parseDtsCell(cell)
+				if err != nil {
+					return prop, err
+				}
+				prop.cells = append(prop.cells, val)
+			}
+			p.next()
+
+		case tok == "[":
+			for p.peek() != "]" && p.peek() != "" {
+				p.next()
+			}
+			p.next()
+
+		default:
+			if strings.HasPrefix(tok, "&") {
+				break
+			}
+			return prop, util.FmtNewtError(
+				"Invalid device tree source; unexpected \"%s\" in "+
+					"property value", tok)
+		}
+
+		switch sep := p.next(); sep {
+		case ",":
+		case ";":
+			return prop, nil
+		default:
+			return prop, util.FmtNewtError(
+				"Invalid device tree source; expected \",\" or \";\", "+
+					"got \"%s\"", sep)
+		}
+	}
+}
+
+// Parses the body of a node, up to and including its closing brace.
+func (p *dtsParser) parseBody(node *dtsNode) error {
+	for {
+		switch p.peek() {
+		case "":
+			return util.FmtNewtError(
+				"Invalid device tree source; node \"%s\" not terminated",
+				node.name)
+
+		case "}":
+			p.next()
+			return nil
+
+		case ";":
+			p.next()
+			continue
+		}
+
+		// Skip labels.
+		name := p.next()
+		for strings.HasSuffix(name, ":") {
+			name = p.next()
+		}
+
+		switch p.next() {
+		case "{":
+			child := &dtsNode{
+				name:  name,
+				props: map[string]dtsProp{},
+			}
+			if err := p.parseBody(child); err != nil {
+				return err
+			}
+			if err := p.expect(";"); err != nil {
+				return err
+			}
+			node.children = append(node.children, child)
+
+		case "=":
+			prop, err := p.parseValue()
+			if err != nil {
+				return err
+			}
+			node.props[name] = prop
+
+		case ";":
+			// Boolean property or directive such as /dts-v1/.
+			node.props[name] = dtsProp{}
+
+		default:
+			p.pos--
+			return util.FmtNewtError(
+				"Invalid device tree source; unexpected \"%s\" after \"%s\"",
+				p.peek(), name)
+		}
+	}
+}
+
+// Parses device tree source into a single tree.  Top-level nodes (the root
+// node and any nodes referenced by label) become children of a synthetic
+// top node.
+func parseDts(src string) (*dtsNode, error) {
+	p := &dtsParser{toks: append(tokenizeDts(src), "}")}
+	top := &dtsNode{props: map[string]dtsProp{}}
+
+	if err := p.parseBody(top); err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.toks) {
+		return nil, util.NewNewtError(
+			"Invalid device tree source; unbalanced braces")
+	}
+
+	return top, nil
+}
+
+func (node *dtsNode) isFixedPartitions() bool {
+	for _, s := range node.props["compatible"].strs {
+		if s == DTS_COMPAT_FIXED_PARTITIONS {
+			return true
+		}
+	}
+	return false
+}
+
+func (node *dtsNode) cellCount(prop string) (int, error) {
+	p, ok := node.props[prop]
+	if !ok {
+		return 1, nil
+	}
+	if len(p.cells) != 1 || p.cells[0] < 1 || p.cells[0] > 2 {
+		return 0, util.FmtNewtError(
+			"Unsupported %s in device tree node \"%s\"", prop, node.name)
+	}
+	return int(p.cells[0]), nil
+}
+
+func joinCells(cells []uint64) uint64 {
+	val := uint64(0)
+	for _, c := range cells {
+		val = val<<32 | c
+	}
+	return val
+}
+
+// Determines the name of the flash area a partition maps to.
+func dtsAreaName(node *dtsNode) string {
+	label := strings.SplitN(node.name, "@", 2)[0]
+	if strs := node.props["label"].strs; len(strs) > 0 {
+		label = strs[0]
+	}
+
+	if strings.HasPrefix(label, FLASH_AREA_NAME_PREFIX) {
+		return label
+	}
+
+	key := strings.ToLower(strings.Replace(label, "_", "-", -1))
+	if name, ok := dtsSystemLabelMap[key]; ok {
+		return name
+	}
+
+	return FLASH_AREA_NAME_PREFIX +
+		strings.ToUpper(strings.Replace(label, "-", "_", -1))
+}
+
+type dtsFlashState struct {
+	areas       []FlashArea
+	sectorSizes map[int]int
+	nextDevice  int
+	nextUserId  int
+}
+
+func (st *dtsFlashState) addPartitions(dev *dtsNode, parts *dtsNode) error {
+	device := st.nextDevice
+	st.nextDevice++
+
+	if ebs, ok := dev.props["erase-block-size"]; ok && len(ebs.cells) == 1 {
+		st.sectorSizes[device] = int(ebs.cells[0])
+	}
+
+	addrCells, err := parts.cellCount("#address-cells")
+	if err != nil {
+		return err
+	}
+	sizeCells, err := parts.cellCount("#size-cells")
+	if err != nil {
+		return err
+	}
+
+	for _, child := range parts.children {
+		name := dtsAreaName(child)
+
+		reg, ok := child.props["reg"]
+		if !ok || len(reg.cells) != addrCells+sizeCells {
+			return flashAreaErr(name,
+				"partition \"%s\" must have a reg property of %d cells",
+				child.name, addrCells+sizeCells)
+		}
+
+		area := FlashArea{
+			Name:   name,
+			Device: device,
+			Offset: int(joinCells(reg.cells[:addrCells])),
+			Size:   int(joinCells(reg.cells[addrCells:])),
+		}
+
+		if id, ok := SYSTEM_AREA_NAME_ID_MAP[name]; ok {
+			area.Id = id
+		} else {
+			area.Id = st.nextUserId + AREA_USER_ID_MIN
+			st.nextUserId++
+		}
+
+		st.areas = append(st.areas, area)
+	}
+
+	return nil
+}
+
+func (st *dtsFlashState) walk(node *dtsNode) error {
+	for _, child := range node.children {
+		if child.isFixedPartitions() {
+			if err := st.addPartitions(node, child); err != nil {
+				return err
+			}
+		} else if err := st.walk(child); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Extracts a flash map from the partitions described by device tree source.
+// As with a flash map read from a BSP definition, overlaps and ID conflicts
+// are recorded in the returned map rather than reported as errors.
+func ParseDts(src []byte) (FlashMap, error) {
+	root, err := parseDts(string(src))
+	if err != nil {
+		return newFlashMap(), err
+	}
+
+	st := &dtsFlashState{
+		sectorSizes: map[int]int{},
+	}
+	if err := st.walk(root); err != nil {
+		return newFlashMap(), err
+	}
+	if len(st.areas) == 0 {
+		return newFlashMap(), util.FmtNewtError(
+			"Device tree source contains no \"%s\" partitions",
+			DTS_COMPAT_FIXED_PARTITIONS)
+	}
+
+	flashMap, err := NewFlashMap(st.areas)
+	if err != nil {
+		return flashMap, err
+	}
+	flashMap.SectorSizes = st.sectorSizes
+
+	return flashMap, nil
+}
+
+// Reads a flash map from the specified device tree source file.
+func ReadDts(path string) (FlashMap, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return newFlashMap(), util.ChildNewtError(err)
+	}
+
+	flashMap, err := ParseDts(src)
+	if err != nil {
+		return flashMap, util.PreNewtError(err, "%s", path)
+	}
+
+	return flashMap, nil
+}
@@ -0,0 +1,149 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package flash
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testDts = `
+/dts-v1/;
+#include <nordic/nrf52840.dtsi>
+
+/ {
+	soc {
+		/* Internal flash. */
+		flash0: flash@0 {
+			compatible = "soc-nv-flash";
+			erase-block-size = <4096>;
+
+			partitions {
+				compatible = "fixed-partitions";
+				#address-cells = <1>;
+				#size-cells = <1>;
+
+				boot_partition: partition@0 {
+					label = "mcuboot";
+					reg = <0x00000000 0xc000>;
+				};
+				slot0_partition: partition@c000 {
+					label = "image-0";
+					reg = <0x0000c000 0x32000>;
+				};
+				slot1_partition: partition@3e000 {
+					label = "image-1";
+					reg = <0x0003e000 0x32000>;
+				};
+				storage_partition: partition@fa000 {
+					label = "storage";
+					reg = <0x000fa000 0x00006000>;
+				};
+			};
+		};
+	};
+
+	/* External flash with 64-bit addresses. */
+	qspi {
+		flash1: flash@1 {
+			partitions {
+				compatible = "fixed-partitions";
+				#address-cells = <2>;
+				#size-cells = <1>;
+
+				log@0 {
+					reg = <0x0 0x0 0x10000>;
+				};
+			};
+		};
+	};
+};
+`
+
+func TestParseDts(t *testing.T) {
+	fm, err := ParseDts([]byte(testDts))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []FlashArea{
+		{Name: FLASH_AREA_NAME_BOOTLOADER, Id: 0, Device: 0, Offset: 0,
+			Size: 0xc000},
+		{Name: FLASH_AREA_NAME_IMAGE_0, Id: 1, Device: 0, Offset: 0xc000,
+			Size: 0x32000},
+		{Name: FLASH_AREA_NAME_IMAGE_1, Id: 2, Device: 0, Offset: 0x3e000,
+			Size: 0x32000},
+		{Name: "FLASH_AREA_STORAGE", Id: AREA_USER_ID_MIN, Device: 0,
+			Offset: 0xfa000, Size: 0x6000},
+		{Name: "FLASH_AREA_LOG", Id: AREA_USER_ID_MIN + 1, Device: 1,
+			Offset: 0, Size: 0x10000},
+	}
+	if got := fm.SortedAreas(); !reflect.DeepEqual(got, want) {
+		t.Errorf("areas=%+v; want %+v", got, want)
+	}
+
+	if got := fm.SectorSize(0); got != 4096 {
+		t.Errorf("SectorSize(0)=%d; want 4096", got)
+	}
+	if got := fm.SectorSize(1); got != 0 {
+		t.Errorf("SectorSize(1)=%d; want 0", got)
+	}
+	if text := fm.ErrorText(); text != "" {
+		t.Errorf("unexpected flash map errors:\n%s", text)
+	}
+}
+
+func TestParseDtsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"no partitions", `/ { flash@0 { erase-block-size = <4096>; }; };`},
+		{"short reg", `/ { flash@0 { partitions {
+			compatible = "fixed-partitions";
+			#address-cells = <1>; #size-cells = <1>;
+			p@0 { reg = <0x0>; };
+		}; }; };`},
+		{"unterminated node", `/ { flash@0 { partitions {`},
+	}
+
+	for _, test := range tests {
+		if _, err := ParseDts([]byte(test.src)); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
+
+func TestParseDtsOverlap(t *testing.T) {
+	src := `/ { flash@0 { partitions {
+		compatible = "fixed-partitions";
+		#address-cells = <1>; #size-cells = <1>;
+		a@0 { label = "a"; reg = <0x0 0x2000>; };
+		b@1000 { label = "b"; reg = <0x1000 0x2000>; };
+	}; }; };`
+
+	fm, err := ParseDts([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fm.Overlaps) != 1 {
+		t.Errorf("overlaps=%v; want one pair", fm.Overlaps)
+	}
+}
@@ -36,6 +36,9 @@ import (
 	"mynewt.apache.org/newt/util"
 )
 
+// Prefix shared by the names of all flash areas.
+const FLASH_AREA_NAME_PREFIX = "FLASH_AREA_"
+
 const FLASH_AREA_NAME_BOOTLOADER = "FLASH_AREA_BOOTLOADER"
 const FLASH_AREA_NAME_IMAGE_0 = "FLASH_AREA_IMAGE_0"
 const FLASH_AREA_NAME_IMAGE_1 = "FLASH_AREA_IMAGE_1"
@@ -50,6 +53,9 @@ var SYSTEM_AREA_NAME_ID_MAP = map[string]int{
 
 const AREA_USER_ID_MIN = 16
 
+// The value that erased flash reads as, unless a device specifies otherwise.
+const ERASE_VAL_DFLT = 0xff
+
 const HEADER_PATH = "sysflash/sysflash.h"
 const C_VAR_NAME = "sysflash_map_dflt"
 const C_VAR_COMMENT = `/**
@@ -68,16 +74,64 @@ type FlashArea struct {
 }
 
 type FlashMap struct {
-	Areas       map[string]FlashArea
-	Overlaps    [][]FlashArea
+	Areas    map[string]FlashArea
+	Overlaps [][]FlashArea
+
+	// Pairs of areas in the same device with the same ID.
 	IdConflicts [][]FlashArea
+
+	// Pairs of areas in different devices with the same ID.  These are only
+	// conflicts for boot loaders that require IDs to be globally unique.
+	DeviceIdConflicts [][]FlashArea
+
+	// Erase values of devices that don't erase to ERASE_VAL_DFLT.
+	EraseVals map[int]byte
+
+	// Erase sector sizes of devices that specify one.
+	SectorSizes map[int]int
+
+	// Physical sizes of devices that specify one.
+	Capacities map[int]int
+
+	// Program unit sizes of devices that specify one; writes to such a
+	// device must be a multiple of this size.
+	WriteSizes map[int]int
+
+	// Image slot size expected by the boot loader; 0 if unspecified.
+	SlotSize int
+
+	// Spans that no area may occupy, and the areas that occupy them anyway.
+	Reserves        map[string]FlashReserve
+	ReserveOverlaps []ReserveOverlap
 }
 
 func newFlashMap() FlashMap {
 	return FlashMap{
-		Areas:    map[string]FlashArea{},
-		Overlaps: [][]FlashArea{},
+		Areas:       map[string]FlashArea{},
+		Overlaps:    [][]FlashArea{},
+		EraseVals:   map[int]byte{},
+		SectorSizes: map[int]int{},
+		Capacities:  map[int]int{},
+		WriteSizes:  map[int]int{},
+		Reserves:    map[string]FlashReserve{},
+	}
+}
+
+// Creates a flash map from the specified areas.  Overlaps and ID conflicts
+// are detected as they are when a flash map is read from a BSP definition.
+func NewFlashMap(areas []FlashArea) (FlashMap, error) {
+	flashMap := newFlashMap()
+
+	for _, area := range areas {
+		if _, ok := flashMap.Areas[area.Name]; ok {
+			return flashMap, flashAreaErr(area.Name, "name conflict")
+		}
+		flashMap.Areas[area.Name] = area
 	}
+
+	flashMap.detectOverlaps()
+
+	return flashMap, nil
 }
 
 func flashAreaErr(areaName string, format string, args ...interface{}) error {
@@ -152,7 +206,7 @@ func parseFlashArea(
 		case "size":
 			area.Size, err = parseSize(v)
 			if err != nil {
-				return area, flashAreaErr(name, err.Error())
+				return area, flashAreaErr(name, "%s", err.Error())
 			}
 			sizePresent = true
 
@@ -179,30 +233,210 @@ func parseFlashArea(
 	return area, nil
 }
 
-func (flashMap FlashMap) unSortedAreas() []FlashArea {
-	areas := make([]FlashArea, 0, len(flashMap.Areas))
-	for _, area := range flashMap.Areas {
-		areas = append(areas, area)
+// Per-device settings from the flash map's "devices" mapping.
+type flashDevice struct {
+	id         int
+	eraseVal   byte
+	sectorSize int
+	capacity   int
+	writeSize  int
+}
+
+func parseDevice(deviceStr string,
+	ymlFields map[string]interface{}) (flashDevice, error) {
+
+	dev := flashDevice{}
+
+	var err error
+	dev.id, err = util.AtoiNoOct(deviceStr)
+	if err != nil {
+		return dev, util.FmtNewtError(
+			"failure while parsing flash device \"%s\": invalid device id",
+			deviceStr)
+	}
+
+	eraseVal := ERASE_VAL_DFLT
+
+	fields := cast.ToStringMapString(ymlFields)
+	for k, v := range fields {
+		switch k {
+		case "erase_val":
+			eraseVal, err = util.AtoiNoOct(v)
+			if err != nil || eraseVal < 0 || eraseVal > 0xff {
+				return dev, util.FmtNewtError(
+					"failure while parsing flash device %d: invalid "+
+						"erase_val: %s; must be a single byte", dev.id, v)
+			}
+
+		case "sector_size":
+			dev.sectorSize, err = parseSize(v)
+			if err != nil || dev.sectorSize <= 0 {
+				return dev, util.FmtNewtError(
+					"failure while parsing flash device %d: invalid "+
+						"sector_size: %s", dev.id, v)
+			}
+
+		case "capacity":
+			dev.capacity, err = parseSize(v)
+			if err != nil || dev.capacity <= 0 {
+				return dev, util.FmtNewtError(
+					"failure while parsing flash device %d: invalid "+
+						"capacity: %s", dev.id, v)
+			}
+
+		case "write_size":
+			dev.writeSize, err = parseSize(v)
+			if err != nil || dev.writeSize <= 0 {
+				return dev, util.FmtNewtError(
+					"failure while parsing flash device %d: invalid "+
+						"write_size: %s", dev.id, v)
+			}
+
+		default:
+			util.StatusMessage(util.VERBOSITY_QUIET,
+				"Warning: flash device %d contains unrecognized field: %s",
+				dev.id, k)
+		}
+	}
+
+	dev.eraseVal = byte(eraseVal)
+	return dev, nil
+}
+
+// Indicates the value that the specified device reads as when erased.
+func (flashMap FlashMap) EraseVal(device int) byte {
+	if val, ok := flashMap.EraseVals[device]; ok {
+		return val
+	}
+
+	return ERASE_VAL_DFLT
+}
+
+// Indicates the erase sector size of the specified device, or 0 if the device
+// does not specify one.
+func (flashMap FlashMap) SectorSize(device int) int {
+	return flashMap.SectorSizes[device]
+}
+
+// Reports flash areas that do not start and end on an erase sector boundary
+// of their device.  Such areas cannot be erased independently of their
+// neighbors.  Devices without a sector size are not checked.
+func (flashMap FlashMap) SectorAlignmentErrorText() string {
+	str := ""
+
+	for _, area := range flashMap.SortedAreas() {
+		sectorSize := flashMap.SectorSize(area.Device)
+		if sectorSize == 0 {
+			continue
+		}
+
+		if area.Offset%sectorSize != 0 || area.Size%sectorSize != 0 {
+			str += fmt.Sprintf("    %s: device=%d offset=0x%x size=0x%x "+
+				"sector-size=0x%x\n", area.Name, area.Device, area.Offset,
+				area.Size, sectorSize)
+		}
+	}
+
+	if str == "" {
+		return ""
 	}
 
-	return areas
+	return "Flash areas not aligned to erase sectors:\n" + str
+}
+
+// Indicates the physical size of the specified device, or 0 if the device
+// does not specify one.
+func (flashMap FlashMap) Capacity(device int) int {
+	return flashMap.Capacities[device]
+}
+
+// Indicates the program unit size of the specified device, or 0 if the device
+// does not specify one.
+func (flashMap FlashMap) WriteSize(device int) int {
+	return flashMap.WriteSizes[device]
 }
 
+// Reports flash areas that extend past the end of their device.  Writes to
+// such areas fail when the device is programmed.  Devices without a capacity
+// are not checked.
+func (flashMap FlashMap) CapacityErrorText() string {
+	str := ""
+
+	for _, area := range flashMap.SortedAreas() {
+		capacity := flashMap.Capacity(area.Device)
+		if capacity == 0 {
+			continue
+		}
+
+		end := area.Offset + area.Size
+		if end > capacity {
+			str += fmt.Sprintf("    %s: device=%d end=0x%x capacity=0x%x "+
+				"overrun=%d\n", area.Name, area.Device, end, capacity,
+				end-capacity)
+		}
+	}
+
+	if str == "" {
+		return ""
+	}
+
+	return "Flash areas extend beyond device capacity:\n" + str
+}
+
+type areaSorter struct {
+	areas []FlashArea
+}
+
+func (s areaSorter) Len() int {
+	return len(s.areas)
+}
+func (s areaSorter) Swap(i, j int) {
+	s.areas[i], s.areas[j] = s.areas[j], s.areas[i]
+}
+func (s areaSorter) Less(i, j int) bool {
+	a := s.areas[i]
+	b := s.areas[j]
+
+	if a.Id != b.Id {
+		return a.Id < b.Id
+	}
+
+	// Ties are broken by device, then offset, then name; the same order in
+	// which mfg image parts are sorted.
+	if a.Device != b.Device {
+		return a.Device < b.Device
+	}
+	if a.Offset != b.Offset {
+		return a.Offset < b.Offset
+	}
+	return a.Name < b.Name
+}
+
+// Returns the flash map's areas sorted by ID.  Areas sharing an ID are
+// ordered by device, then offset, then name, so the order never depends on
+// map iteration.
 func (flashMap FlashMap) SortedAreas() []FlashArea {
-	idMap := make(map[int]FlashArea, len(flashMap.Areas))
-	ids := make([]int, 0, len(flashMap.Areas))
+	sorter := areaSorter{
+		areas: make([]FlashArea, 0, len(flashMap.Areas)),
+	}
 	for _, area := range flashMap.Areas {
-		idMap[area.Id] = area
-		ids = append(ids, area.Id)
+		sorter.areas = append(sorter.areas, area)
 	}
-	sort.Ints(ids)
 
-	areas := make([]FlashArea, len(ids))
-	for i, id := range ids {
-		areas[i] = idMap[id]
+	sort.Sort(sorter)
+	return sorter.areas
+}
+
+// Groups the flash map's areas by device.  Each device's areas are sorted by
+// ID.
+func (flashMap FlashMap) AreasByDevice() map[int][]FlashArea {
+	deviceAreas := map[int][]FlashArea{}
+
+	for _, area := range flashMap.SortedAreas() {
+		deviceAreas[area.Device] = append(deviceAreas[area.Device], area)
 	}
 
-	return areas
+	return deviceAreas
 }
 
 func (flashMap FlashMap) DeviceIds() []int {
@@ -238,9 +472,12 @@ func areasDistinct(a FlashArea, b FlashArea) bool {
 
 func (flashMap *FlashMap) detectOverlaps() {
 	flashMap.Overlaps = [][]FlashArea{}
+	flashMap.IdConflicts = [][]FlashArea{}
+	flashMap.DeviceIdConflicts = [][]FlashArea{}
 
-	// Convert the map to a slice.
-	areas := flashMap.unSortedAreas()
+	// Convert the map to a slice.  A sorted slice keeps the reported pairs in
+	// a consistent order.
+	areas := flashMap.SortedAreas()
 
 	for i := 0; i < len(areas)-1; i++ {
 		iarea := areas[i]
@@ -253,25 +490,57 @@ func (flashMap *FlashMap) detectOverlaps() {
 			}
 
 			if iarea.Id == jarea.Id {
-				flashMap.IdConflicts = append(
-					flashMap.IdConflicts, []FlashArea{iarea, jarea})
+				pair := []FlashArea{iarea, jarea}
+				if iarea.Device == jarea.Device {
+					flashMap.IdConflicts = append(flashMap.IdConflicts, pair)
+				} else {
+					flashMap.DeviceIdConflicts = append(
+						flashMap.DeviceIdConflicts, pair)
+				}
 			}
 		}
 	}
+
+	flashMap.detectReserveOverlaps()
 }
 
-func (flashMap FlashMap) ErrorText() string {
-	str := ""
+// Returns the pairs of areas with the same ID.  By default, IDs are scoped
+// per device, and areas in different devices may share an ID.  If global is
+// true, IDs must be unique across all devices.
+func (flashMap FlashMap) IdCollisions(global bool) [][]FlashArea {
+	pairs := append([][]FlashArea{}, flashMap.IdConflicts...)
+	if global {
+		pairs = append(pairs, flashMap.DeviceIdConflicts...)
+	}
 
-	if len(flashMap.IdConflicts) > 0 {
-		str += "Conflicting flash area IDs detected:\n"
+	return pairs
+}
 
-		for _, pair := range flashMap.IdConflicts {
+// Describes the pairs of areas with the same ID; see IdCollisions.
+func (flashMap FlashMap) IdCollisionText(global bool) string {
+	pairs := flashMap.IdCollisions(global)
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	str := "Conflicting flash area IDs detected:\n"
+	for _, pair := range pairs {
+		if pair[0].Device == pair[1].Device {
 			str += fmt.Sprintf("    (%d) %s =/= %s\n",
 				pair[0].Id-AREA_USER_ID_MIN, pair[0].Name, pair[1].Name)
+		} else {
+			str += fmt.Sprintf("    (%d) %s (device %d) =/= %s (device %d)\n",
+				pair[0].Id-AREA_USER_ID_MIN, pair[0].Name, pair[0].Device,
+				pair[1].Name, pair[1].Device)
 		}
 	}
 
+	return str
+}
+
+func (flashMap FlashMap) ErrorText() string {
+	str := flashMap.IdCollisionText(false)
+
 	if len(flashMap.Overlaps) > 0 {
 		str += "Overlapping flash areas detected:\n"
 
@@ -280,9 +549,239 @@ func (flashMap FlashMap) ErrorText() string {
 		}
 	}
 
+	str += flashMap.ReserveOverlapText()
+
 	return str
 }
 
+// Reports image slots whose sizes differ from each other or from the expected
+// slot size.  A mismatch does not prevent a build, but typically causes
+// upgrades to fail.
+func (flashMap FlashMap) WarningText() string {
+	str := ""
+
+	slots := []FlashArea{}
+	for _, name := range []string{
+		FLASH_AREA_NAME_IMAGE_0,
+		FLASH_AREA_NAME_IMAGE_1,
+	} {
+		if area, ok := flashMap.Areas[name]; ok {
+			slots = append(slots, area)
+		}
+	}
+
+	if flashMap.SlotSize != 0 {
+		for _, slot := range slots {
+			if slot.Size != flashMap.SlotSize {
+				str += fmt.Sprintf("    %s: size=%d expected=%d\n",
+					slot.Name, slot.Size, flashMap.SlotSize)
+			}
+		}
+	} else {
+		str += flashMap.asymmetricSlotText()
+	}
+
+	if str == "" {
+		return ""
+	}
+
+	return "Image slot size mismatch detected:\n" + str
+}
+
+func (flashMap FlashMap) asymmetricSlotText() string {
+	slot0, ok0 := flashMap.Areas[FLASH_AREA_NAME_IMAGE_0]
+	slot1, ok1 := flashMap.Areas[FLASH_AREA_NAME_IMAGE_1]
+	if !ok0 || !ok1 || slot0.Size == slot1.Size {
+		return ""
+	}
+
+	return fmt.Sprintf("    %s: size=%d =/= %s: size=%d\n",
+		slot0.Name, slot0.Size, slot1.Name, slot1.Size)
+}
+
+// Reports image slots that differ in size from each other.  The boot
+// loader's swap logic requires both slots of an A/B layout to be the same
+// size.  An empty string is returned if the flash map has fewer than two
+// image slots or if the sizes match.
+func (flashMap FlashMap) AsymmetricSlotText() string {
+	str := flashMap.asymmetricSlotText()
+	if str == "" {
+		return ""
+	}
+
+	return "Image slots differ in size:\n" + str
+}
+
+// Identifies the image slots that are no larger than minSize bytes, the
+// overhead of an image and its boot trailer.  No image fits in such a slot.
+func (flashMap FlashMap) UndersizedSlots(minSize int) []FlashArea {
+	slots := []FlashArea{}
+	for _, name := range []string{
+		FLASH_AREA_NAME_IMAGE_0,
+		FLASH_AREA_NAME_IMAGE_1,
+	} {
+		if area, ok := flashMap.Areas[name]; ok && area.Size <= minSize {
+			slots = append(slots, area)
+		}
+	}
+
+	return slots
+}
+
+// Describes each image slot that is too small to hold an image (see
+// UndersizedSlots).  An empty string is returned if every slot is large
+// enough.
+func (flashMap FlashMap) UndersizedSlotText(minSize int) string {
+	str := ""
+	for _, slot := range flashMap.UndersizedSlots(minSize) {
+		str += fmt.Sprintf("    %s: size=%d minimum=%d\n",
+			slot.Name, slot.Size, minSize+1)
+	}
+
+	if str == "" {
+		return ""
+	}
+
+	return "Image slot too small to hold any image:\n" + str
+}
+
+// Lists the image slots that do not start on the specified boundary.  If
+// align is 0, each slot must instead start on an erase sector boundary of its
+// device; devices without a sector size are not checked.
+func (flashMap FlashMap) MisalignedSlots(align int) []FlashArea {
+	slots := []FlashArea{}
+	for _, name := range []string{
+		FLASH_AREA_NAME_IMAGE_0,
+		FLASH_AREA_NAME_IMAGE_1,
+	} {
+		area, ok := flashMap.Areas[name]
+		if !ok {
+			continue
+		}
+
+		required := align
+		if required == 0 {
+			required = flashMap.SectorSize(area.Device)
+		}
+		if required != 0 && area.Offset%required != 0 {
+			slots = append(slots, area)
+		}
+	}
+
+	return slots
+}
+
+// Describes each image slot that is not suitably aligned (see
+// MisalignedSlots).  An empty string is returned if every slot is aligned.
+func (flashMap FlashMap) MisalignedSlotText(align int) string {
+	str := ""
+	for _, slot := range flashMap.MisalignedSlots(align) {
+		required := align
+		if required == 0 {
+			required = flashMap.SectorSize(slot.Device)
+		}
+		str += fmt.Sprintf("    %s: device=%d offset=0x%x "+
+			"required-alignment=0x%x\n", slot.Name, slot.Device,
+			slot.Offset, required)
+	}
+
+	if str == "" {
+		return ""
+	}
+
+	return "Image slot not aligned as the boot loader requires:\n" + str
+}
+
+// Determines whether images built against the updated flash map can be
+// installed over the air on devices that use the deployed map.  Both maps
+// must place each image slot at the same device, offset, and size; other
+// areas are not compared.  Each incompatibility is described by a string; the
+// result is empty if the maps are compatible.
+func OtaProblems(deployed FlashMap, updated FlashMap) []string {
+	problems := []string{}
+
+	for _, name := range []string{
+		FLASH_AREA_NAME_IMAGE_0,
+		FLASH_AREA_NAME_IMAGE_1,
+	} {
+		da, dok := deployed.Areas[name]
+		ua, uok := updated.Areas[name]
+
+		switch {
+		case !dok && !uok:
+
+		case !uok:
+			problems = append(problems, fmt.Sprintf(
+				"%s missing from updated flash map", name))
+
+		case !dok:
+			problems = append(problems, fmt.Sprintf(
+				"%s missing from deployed flash map", name))
+
+		case da.Device != ua.Device || da.Offset != ua.Offset ||
+			da.Size != ua.Size:
+
+			problems = append(problems, fmt.Sprintf(
+				"%s differs; deployed: device=%d offset=0x%x size=%d, "+
+					"updated: device=%d offset=0x%x size=%d",
+				name, da.Device, da.Offset, da.Size,
+				ua.Device, ua.Offset, ua.Size))
+		}
+	}
+
+	return problems
+}
+
+// Determines whether a boot loader and an app were built against compatible
+// flash maps.  Each system area (the boot loader, image slots, and scratch
+// area) must have the same ID, device, offset, and size in both maps; user
+// areas are not compared.  Each mismatch is described by a string; the result
+// is empty if the maps agree.
+func BootAppProblems(boot FlashMap, app FlashMap) []string {
+	return SystemAreaProblems("boot loader", boot, "app", app)
+}
+
+// Compares the system areas of two flash maps, as BootAppProblems does.
+// aName and bName identify the maps' owners in the resulting descriptions.
+func SystemAreaProblems(aName string, a FlashMap,
+	bName string, b FlashMap) []string {
+
+	names := make([]string, 0, len(SYSTEM_AREA_NAME_ID_MAP))
+	for name, _ := range SYSTEM_AREA_NAME_ID_MAP {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	problems := []string{}
+	for _, name := range names {
+		aa, aok := a.Areas[name]
+		ba, bok := b.Areas[name]
+
+		switch {
+		case !aok && !bok:
+
+		case !bok:
+			problems = append(problems, fmt.Sprintf(
+				"%s missing from %s flash map", name, bName))
+
+		case !aok:
+			problems = append(problems, fmt.Sprintf(
+				"%s missing from %s flash map", name, aName))
+
+		case aa.Id != ba.Id || aa.Device != ba.Device ||
+			aa.Offset != ba.Offset || aa.Size != ba.Size:
+
+			problems = append(problems, fmt.Sprintf(
+				"%s differs; %s: id=%d device=%d offset=0x%x "+
+					"size=%d, %s: id=%d device=%d offset=0x%x size=%d",
+				name, aName, aa.Id, aa.Device, aa.Offset, aa.Size,
+				bName, ba.Id, ba.Device, ba.Offset, ba.Size))
+		}
+	}
+
+	return problems
+}
+
 func Read(ymlFlashMap map[string]interface{}) (FlashMap, error) {
 	flashMap := newFlashMap()
 
@@ -301,12 +800,55 @@ func Read(ymlFlashMap map[string]interface{}) (FlashMap, error) {
 		ymlArea := cast.ToStringMap(v)
 		area, err := parseFlashArea(k, ymlArea)
 		if err != nil {
-			return flashMap, flashAreaErr(k, err.Error())
+			return flashMap, flashAreaErr(k, "%s", err.Error())
 		}
 
 		flashMap.Areas[k] = area
 	}
 
+	// The optional "devices" mapping contains per-device settings.
+	deviceMap := cast.ToStringMap(ymlFlashMap["devices"])
+	for k, v := range deviceMap {
+		dev, err := parseDevice(k, cast.ToStringMap(v))
+		if err != nil {
+			return flashMap, err
+		}
+
+		if dev.eraseVal != ERASE_VAL_DFLT {
+			flashMap.EraseVals[dev.id] = dev.eraseVal
+		}
+		if dev.sectorSize != 0 {
+			flashMap.SectorSizes[dev.id] = dev.sectorSize
+		}
+		if dev.capacity != 0 {
+			flashMap.Capacities[dev.id] = dev.capacity
+		}
+		if dev.writeSize != 0 {
+			flashMap.WriteSizes[dev.id] = dev.writeSize
+		}
+	}
+
+	// The optional "reserved" mapping contains spans that no area may use.
+	reserveMap := cast.ToStringMap(ymlFlashMap["reserved"])
+	for k, v := range reserveMap {
+		res, err := parseReserve(k, cast.ToStringMap(v))
+		if err != nil {
+			return flashMap, err
+		}
+
+		flashMap.Reserves[k] = res
+	}
+
+	// The optional "slot_size" field specifies the size of each image slot.
+	if ymlSlotSize := ymlFlashMap["slot_size"]; ymlSlotSize != nil {
+		var err error
+		flashMap.SlotSize, err = parseSize(cast.ToString(ymlSlotSize))
+		if err != nil {
+			return flashMap, util.FmtNewtError(
+				"invalid flash map slot_size: %s", err.Error())
+		}
+	}
+
 	flashMap.detectOverlaps()
 
 	return flashMap, nil
@@ -322,7 +864,7 @@ func (area FlashArea) writeHeader(w io.Writer) {
 }
 
 func (flashMap FlashMap) writeHeader(w io.Writer) {
-	fmt.Fprintf(w, newtutil.GeneratedPreamble())
+	fmt.Fprint(w, newtutil.GeneratedPreamble())
 
 	fmt.Fprintf(w, "#ifndef H_MYNEWT_SYSFLASH_\n")
 	fmt.Fprintf(w, "#define H_MYNEWT_SYSFLASH_\n")
@@ -360,7 +902,7 @@ func (area FlashArea) writeSrc(w io.Writer) {
 }
 
 func (flashMap FlashMap) writeSrc(w io.Writer) {
-	fmt.Fprintf(w, newtutil.GeneratedPreamble())
+	fmt.Fprint(w, newtutil.GeneratedPreamble())
 
 	fmt.Fprintf(w, "#include \"%s\"\n", HEADER_PATH)
 	fmt.Fprintf(w, "\n")
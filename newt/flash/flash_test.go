@@ -0,0 +1,750 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package flash
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Builds the YAML representation of a flash area, as read from a BSP
+// definition.
+func ymlArea(fields ...string) map[string]interface{} {
+	m := map[string]interface{}{}
+	for i := 0; i+1 < len(fields); i += 2 {
+		m[fields[i]] = fields[i+1]
+	}
+	return m
+}
+
+func areaNames(areas []FlashArea) []string {
+	names := make([]string, len(areas))
+	for i, area := range areas {
+		names[i] = area.Name
+	}
+	return names
+}
+
+// SortedAreas yields the same order regardless of the order in which the
+// areas were supplied.
+func TestSortedAreasDeterministic(t *testing.T) {
+	tests := []struct {
+		desc  string
+		areas []FlashArea
+		want  []string
+	}{
+		{
+			desc: "distinct IDs",
+			areas: []FlashArea{
+				{Name: "C", Id: 2, Device: 0, Offset: 0x0000, Size: 0x100},
+				{Name: "A", Id: 0, Device: 0, Offset: 0x1000, Size: 0x100},
+				{Name: "B", Id: 1, Device: 0, Offset: 0x2000, Size: 0x100},
+			},
+			want: []string{"A", "B", "C"},
+		},
+		{
+			desc: "shared ID; tie broken by device",
+			areas: []FlashArea{
+				{Name: "A", Id: 1, Device: 1, Offset: 0x0000, Size: 0x100},
+				{Name: "B", Id: 1, Device: 0, Offset: 0x1000, Size: 0x100},
+				{Name: "C", Id: 0, Device: 2, Offset: 0x0000, Size: 0x100},
+			},
+			want: []string{"C", "B", "A"},
+		},
+		{
+			desc: "shared ID and device; tie broken by offset",
+			areas: []FlashArea{
+				{Name: "A", Id: 1, Device: 0, Offset: 0x2000, Size: 0x100},
+				{Name: "B", Id: 1, Device: 0, Offset: 0x1000, Size: 0x100},
+				{Name: "C", Id: 1, Device: 0, Offset: 0x3000, Size: 0x100},
+			},
+			want: []string{"B", "A", "C"},
+		},
+		{
+			desc: "shared ID, device, and offset; tie broken by name",
+			areas: []FlashArea{
+				{Name: "Z", Id: 3, Device: 0, Offset: 0x1000, Size: 0x100},
+				{Name: "M", Id: 3, Device: 0, Offset: 0x1000, Size: 0x100},
+				{Name: "A", Id: 3, Device: 0, Offset: 0x1000, Size: 0x100},
+			},
+			want: []string{"A", "M", "Z"},
+		},
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for _, test := range tests {
+		for i := 0; i < 20; i++ {
+			shuffled := append([]FlashArea{}, test.areas...)
+			rng.Shuffle(len(shuffled), func(i, j int) {
+				shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+			})
+
+			flashMap := newFlashMap()
+			for _, area := range shuffled {
+				flashMap.Areas[area.Name] = area
+			}
+
+			got := areaNames(flashMap.SortedAreas())
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s: SortedAreas() = %v; want %v",
+					test.desc, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+// AreasByDevice preserves the sorted order within each device.
+func TestAreasByDevice(t *testing.T) {
+	flashMap, err := NewFlashMap([]FlashArea{
+		{Name: "D1_B", Id: 4, Device: 1, Offset: 0x0000, Size: 0x100},
+		{Name: "D0_B", Id: 2, Device: 0, Offset: 0x0000, Size: 0x100},
+		{Name: "D1_A", Id: 3, Device: 1, Offset: 0x1000, Size: 0x100},
+		{Name: "D0_A", Id: 1, Device: 0, Offset: 0x1000, Size: 0x100},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int][]string{
+		0: {"D0_A", "D0_B"},
+		1: {"D1_A", "D1_B"},
+	}
+
+	byDevice := flashMap.AreasByDevice()
+	if len(byDevice) != len(want) {
+		t.Fatalf("AreasByDevice() has %d devices; want %d",
+			len(byDevice), len(want))
+	}
+	for device, names := range want {
+		if got := areaNames(byDevice[device]); !reflect.DeepEqual(got, names) {
+			t.Errorf("device %d: %v; want %v", device, got, names)
+		}
+	}
+}
+
+// A two-device flash map read from a BSP definition is grouped by device; the
+// groups together contain every area exactly once.
+func TestAreasByDeviceBsp(t *testing.T) {
+	tests := []struct {
+		desc  string
+		areas map[string]interface{}
+		want  map[int][]string
+	}{
+		{
+			desc: "internal and external flash",
+			areas: map[string]interface{}{
+				FLASH_AREA_NAME_BOOTLOADER: ymlArea("device", "0",
+					"offset", "0x00000000", "size", "16kB"),
+				FLASH_AREA_NAME_IMAGE_0: ymlArea("device", "0",
+					"offset", "0x00008000", "size", "232kB"),
+				FLASH_AREA_NAME_IMAGE_1: ymlArea("device", "1",
+					"offset", "0x00000000", "size", "232kB"),
+				"FLASH_AREA_NFFS": ymlArea("user_id", "1", "device", "1",
+					"offset", "0x00040000", "size", "64kB"),
+				"FLASH_AREA_LOGS": ymlArea("user_id", "0", "device", "1",
+					"offset", "0x00050000", "size", "64kB"),
+			},
+			want: map[int][]string{
+				0: {FLASH_AREA_NAME_BOOTLOADER, FLASH_AREA_NAME_IMAGE_0},
+				1: {FLASH_AREA_NAME_IMAGE_1, "FLASH_AREA_LOGS",
+					"FLASH_AREA_NFFS"},
+			},
+		},
+		{
+			desc:  "no areas",
+			areas: map[string]interface{}{},
+			want:  map[int][]string{},
+		},
+	}
+
+	for _, test := range tests {
+		fm, err := Read(map[string]interface{}{"areas": test.areas})
+		if err != nil {
+			t.Fatalf("%s: %s", test.desc, err.Error())
+		}
+
+		byDevice := fm.AreasByDevice()
+
+		got := map[int][]string{}
+		numAreas := 0
+		for device, areas := range byDevice {
+			got[device] = areaNames(areas)
+			numAreas += len(areas)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: AreasByDevice()=%v; want %v", test.desc, got,
+				test.want)
+		}
+		if numAreas != len(fm.Areas) {
+			t.Errorf("%s: groups contain %d areas; map has %d", test.desc,
+				numAreas, len(fm.Areas))
+		}
+		if len(byDevice) != len(fm.DeviceIds()) {
+			t.Errorf("%s: %d groups; map has %d devices", test.desc,
+				len(byDevice), len(fm.DeviceIds()))
+		}
+	}
+}
+
+// Reads a flash map containing a boot loader area and the specified devices
+// mapping.
+func readDevices(devices map[string]interface{}) (FlashMap, error) {
+	return Read(map[string]interface{}{
+		"areas": map[string]interface{}{
+			FLASH_AREA_NAME_BOOTLOADER: ymlArea("device", "0",
+				"offset", "0", "size", "16kB"),
+		},
+		"devices": devices,
+	})
+}
+
+func TestEraseVal(t *testing.T) {
+	tests := []struct {
+		name    string
+		val     string
+		want    byte
+		wantErr bool
+	}{
+		{"zero", "0x00", 0x00, false},
+		{"decimal", "165", 0xa5, false},
+		{"default value", "0xff", 0xff, false},
+		{"too large", "0x100", 0, true},
+		{"negative", "-1", 0, true},
+		{"not a number", "erased", 0, true},
+	}
+
+	for _, test := range tests {
+		fm, err := readDevices(map[string]interface{}{
+			"1": ymlArea("erase_val", test.val),
+		})
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if got := fm.EraseVal(1); got != test.want {
+			t.Errorf("%s: EraseVal(1)=0x%02x; want 0x%02x",
+				test.name, got, test.want)
+		}
+
+		// Devices without a setting read as the default.
+		if got := fm.EraseVal(0); got != ERASE_VAL_DFLT {
+			t.Errorf("%s: EraseVal(0)=0x%02x; want 0x%02x",
+				test.name, got, ERASE_VAL_DFLT)
+		}
+	}
+}
+
+// Builds a flash map containing image slots of the specified sizes.  A size
+// of 0 omits the slot.
+func slotMap(t *testing.T, size0 int, size1 int) FlashMap {
+	areas := []FlashArea{}
+	if size0 != 0 {
+		areas = append(areas, FlashArea{Name: FLASH_AREA_NAME_IMAGE_0,
+			Id: 1, Device: 0, Offset: 0x10000, Size: size0})
+	}
+	if size1 != 0 {
+		areas = append(areas, FlashArea{Name: FLASH_AREA_NAME_IMAGE_1,
+			Id: 2, Device: 0, Offset: 0x80000, Size: size1})
+	}
+
+	fm, err := NewFlashMap(areas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fm
+}
+
+func TestSlotSizeWarning(t *testing.T) {
+	tests := []struct {
+		name     string
+		size0    int
+		size1    int
+		slotSize int
+		want     []string
+	}{
+		{"symmetric", 0x20000, 0x20000, 0, nil},
+		{"asymmetric", 0x20000, 0x18000, 0, []string{
+			"FLASH_AREA_IMAGE_0: size=131072 =/= " +
+				"FLASH_AREA_IMAGE_1: size=98304"}},
+		{"single slot", 0x20000, 0, 0, nil},
+		{"matches expected", 0x20000, 0x20000, 0x20000, nil},
+		{"differs from expected", 0x20000, 0x18000, 0x20000, []string{
+			"FLASH_AREA_IMAGE_1: size=98304 expected=131072"}},
+		{"both differ from expected", 0x10000, 0x10000, 0x20000, []string{
+			"FLASH_AREA_IMAGE_0: size=65536 expected=131072",
+			"FLASH_AREA_IMAGE_1: size=65536 expected=131072"}},
+	}
+
+	for _, test := range tests {
+		fm := slotMap(t, test.size0, test.size1)
+		fm.SlotSize = test.slotSize
+
+		text := fm.WarningText()
+		if len(test.want) == 0 {
+			if text != "" {
+				t.Errorf("%s: unexpected warning:\n%s", test.name, text)
+			}
+			continue
+		}
+
+		if !strings.HasPrefix(text, "Image slot size mismatch detected:\n") {
+			t.Errorf("%s: warning lacks heading:\n%s", test.name, text)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(text, want) {
+				t.Errorf("%s: warning does not contain %q:\n%s",
+					test.name, want, text)
+			}
+		}
+	}
+}
+
+func TestSectorAlignment(t *testing.T) {
+	tests := []struct {
+		name string
+		area FlashArea
+		want string
+	}{
+		{"aligned", FlashArea{Name: "A", Device: 0, Offset: 0x2000,
+			Size: 0x4000}, ""},
+		{"unaligned offset", FlashArea{Name: "A", Device: 0, Offset: 0x2100,
+			Size: 0x1000},
+			"A: device=0 offset=0x2100 size=0x1000 sector-size=0x1000"},
+		{"unaligned size", FlashArea{Name: "A", Device: 0, Offset: 0x2000,
+			Size: 0x1800},
+			"A: device=0 offset=0x2000 size=0x1800 sector-size=0x1000"},
+		{"device without sector size", FlashArea{Name: "A", Device: 1,
+			Offset: 0x2100, Size: 0x10}, ""},
+	}
+
+	for _, test := range tests {
+		fm, err := NewFlashMap([]FlashArea{test.area})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fm.SectorSizes[0] = 0x1000
+
+		text := fm.SectorAlignmentErrorText()
+		if test.want == "" {
+			if text != "" {
+				t.Errorf("%s: unexpected error:\n%s", test.name, text)
+			}
+		} else if !strings.Contains(text, test.want) {
+			t.Errorf("%s: error does not contain %q:\n%s",
+				test.name, test.want, text)
+		}
+	}
+
+	// The sector size is read from the devices mapping.
+	fm, err := readDevices(map[string]interface{}{
+		"0": ymlArea("sector_size", "4kB"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fm.SectorSize(0); got != 0x1000 {
+		t.Errorf("SectorSize(0)=%d; want 4096", got)
+	}
+
+	if _, err := readDevices(map[string]interface{}{
+		"0": ymlArea("sector_size", "0"),
+	}); err == nil {
+		t.Errorf("expected error for zero sector size")
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	tests := []struct {
+		name string
+		area FlashArea
+		want string
+	}{
+		{"fits", FlashArea{Name: "A", Device: 0, Offset: 0x1000,
+			Size: 0x7000}, ""},
+		{"overruns", FlashArea{Name: "A", Device: 0, Offset: 0x7000,
+			Size: 0x2000},
+			"A: device=0 end=0x9000 capacity=0x8000 overrun=4096"},
+		{"starts past end", FlashArea{Name: "A", Device: 0, Offset: 0x8000,
+			Size: 0x10},
+			"A: device=0 end=0x8010 capacity=0x8000 overrun=16"},
+		{"device without capacity", FlashArea{Name: "A", Device: 1,
+			Offset: 0x100000, Size: 0x1000}, ""},
+	}
+
+	for _, test := range tests {
+		fm, err := NewFlashMap([]FlashArea{test.area})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fm.Capacities[0] = 0x8000
+
+		text := fm.CapacityErrorText()
+		if test.want == "" {
+			if text != "" {
+				t.Errorf("%s: unexpected error:\n%s", test.name, text)
+			}
+		} else if !strings.Contains(text, test.want) {
+			t.Errorf("%s: error does not contain %q:\n%s",
+				test.name, test.want, text)
+		}
+	}
+
+	fm, err := readDevices(map[string]interface{}{
+		"0": ymlArea("capacity", "32kB"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fm.Capacity(0); got != 0x8000 {
+		t.Errorf("Capacity(0)=%d; want 32768", got)
+	}
+	if got := fm.Capacity(1); got != 0 {
+		t.Errorf("Capacity(1)=%d; want 0", got)
+	}
+}
+
+func TestIdCollisions(t *testing.T) {
+	tests := []struct {
+		name      string
+		areas     []FlashArea
+		perDevice int
+		global    int
+		wantErr   bool
+	}{
+		{"unique", []FlashArea{
+			{Name: "A", Id: 16, Device: 0, Offset: 0, Size: 0x100},
+			{Name: "B", Id: 17, Device: 1, Offset: 0, Size: 0x100},
+		}, 0, 0, false},
+		{"shared across devices", []FlashArea{
+			{Name: "A", Id: 16, Device: 0, Offset: 0, Size: 0x100},
+			{Name: "B", Id: 16, Device: 1, Offset: 0, Size: 0x100},
+		}, 0, 1, false},
+		{"shared within device", []FlashArea{
+			{Name: "A", Id: 16, Device: 0, Offset: 0x000, Size: 0x100},
+			{Name: "B", Id: 16, Device: 0, Offset: 0x100, Size: 0x100},
+		}, 1, 1, true},
+	}
+
+	for _, test := range tests {
+		fm, err := NewFlashMap(test.areas)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n := len(fm.IdCollisions(false)); n != test.perDevice {
+			t.Errorf("%s: %d per-device collisions; want %d",
+				test.name, n, test.perDevice)
+		}
+		if n := len(fm.IdCollisions(true)); n != test.global {
+			t.Errorf("%s: %d global collisions; want %d",
+				test.name, n, test.global)
+		}
+
+		// Only per-device collisions are errors by default.
+		if got := fm.ErrorText() != ""; got != test.wantErr {
+			t.Errorf("%s: error text=%q", test.name, fm.ErrorText())
+		}
+		if test.global > 0 && !strings.Contains(fm.IdCollisionText(true),
+			"(0) A") {
+
+			t.Errorf("%s: collision text does not name the areas:\n%s",
+				test.name, fm.IdCollisionText(true))
+		}
+	}
+}
+
+func TestAsymmetricSlots(t *testing.T) {
+	tests := []struct {
+		name  string
+		size0 int
+		size1 int
+		want  bool
+	}{
+		{"symmetric", 0x20000, 0x20000, false},
+		{"asymmetric", 0x20000, 0x1f000, true},
+		{"single slot", 0x20000, 0, false},
+	}
+
+	for _, test := range tests {
+		fm := slotMap(t, test.size0, test.size1)
+
+		text := fm.AsymmetricSlotText()
+		if !test.want {
+			if text != "" {
+				t.Errorf("%s: unexpected error:\n%s", test.name, text)
+			}
+			continue
+		}
+
+		for _, name := range []string{
+			FLASH_AREA_NAME_IMAGE_0,
+			FLASH_AREA_NAME_IMAGE_1,
+		} {
+			if !strings.Contains(text, name) {
+				t.Errorf("%s: error does not name %s:\n%s",
+					test.name, name, text)
+			}
+		}
+	}
+}
+
+func TestMisalignedSlots(t *testing.T) {
+	// Slot 0 starts at 0x10000 and slot 1 at 0x80000.
+	tests := []struct {
+		name       string
+		align      int
+		sectorSize int
+		want       []string
+		wantAlign  string
+	}{
+		{"aligned", 0x10000, 0, nil, ""},
+		{"slot 0 misaligned", 0x20000, 0,
+			[]string{FLASH_AREA_NAME_IMAGE_0}, "0x20000"},
+		{"both misaligned", 0x30000, 0,
+			[]string{FLASH_AREA_NAME_IMAGE_0, FLASH_AREA_NAME_IMAGE_1},
+			"0x30000"},
+		{"sector aligned", 0, 0x1000, nil, ""},
+		{"sector misaligned", 0, 0x20000,
+			[]string{FLASH_AREA_NAME_IMAGE_0}, "0x20000"},
+		{"no requirement", 0, 0, nil, ""},
+	}
+
+	for _, test := range tests {
+		fm := slotMap(t, 0x20000, 0x20000)
+		if test.sectorSize != 0 {
+			fm.SectorSizes[0] = test.sectorSize
+		}
+
+		got := areaNames(fm.MisalignedSlots(test.align))
+		if len(got) != len(test.want) ||
+			(len(got) > 0 && !reflect.DeepEqual(got, test.want)) {
+
+			t.Errorf("%s: misaligned=%v; want %v", test.name, got, test.want)
+			continue
+		}
+
+		text := fm.MisalignedSlotText(test.align)
+		if len(test.want) == 0 {
+			if text != "" {
+				t.Errorf("%s: unexpected error:\n%s", test.name, text)
+			}
+			continue
+		}
+		if !strings.Contains(text, test.want[0]) ||
+			!strings.Contains(text, "required-alignment="+test.wantAlign) {
+
+			t.Errorf("%s: error does not name slot and alignment:\n%s",
+				test.name, text)
+		}
+	}
+}
+
+func TestUndersizedSlots(t *testing.T) {
+	const minSize = 0x100
+
+	tests := []struct {
+		name  string
+		size0 int
+		size1 int
+		want  []string
+	}{
+		{"large enough", 0x20000, 0x101, nil},
+		{"exactly overhead", 0x20000, minSize,
+			[]string{FLASH_AREA_NAME_IMAGE_1}},
+		{"both too small", 0x80, 0x40,
+			[]string{FLASH_AREA_NAME_IMAGE_0, FLASH_AREA_NAME_IMAGE_1}},
+	}
+
+	for _, test := range tests {
+		fm := slotMap(t, test.size0, test.size1)
+
+		got := areaNames(fm.UndersizedSlots(minSize))
+		if len(got) != len(test.want) ||
+			(len(got) > 0 && !reflect.DeepEqual(got, test.want)) {
+
+			t.Errorf("%s: undersized=%v; want %v", test.name, got, test.want)
+			continue
+		}
+
+		text := fm.UndersizedSlotText(minSize)
+		if len(test.want) == 0 {
+			if text != "" {
+				t.Errorf("%s: unexpected warning:\n%s", test.name, text)
+			}
+		} else if !strings.Contains(text, "minimum=257") {
+			t.Errorf("%s: warning does not state minimum size:\n%s",
+				test.name, text)
+		}
+	}
+}
+
+// Returns a copy of the flash map with the named area modified.
+func withArea(t *testing.T, fm FlashMap, name string,
+	f func(area *FlashArea)) FlashMap {
+
+	areas := []FlashArea{}
+	for _, area := range fm.SortedAreas() {
+		if area.Name == name {
+			f(&area)
+		}
+		areas = append(areas, area)
+	}
+
+	modified, err := NewFlashMap(areas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return modified
+}
+
+func TestOtaProblems(t *testing.T) {
+	deployed := slotMap(t, 0x20000, 0x20000)
+	deployed.Areas["FLASH_AREA_NFFS"] = FlashArea{Name: "FLASH_AREA_NFFS",
+		Id: 17, Device: 0, Offset: 0xc0000, Size: 0x4000}
+
+	tests := []struct {
+		name    string
+		updated FlashMap
+		want    []string
+	}{
+		{"identical", deployed, nil},
+		{"user area changed", withArea(t, deployed, "FLASH_AREA_NFFS",
+			func(a *FlashArea) { a.Size = 0x8000 }), nil},
+		{"slot resized", withArea(t, deployed, FLASH_AREA_NAME_IMAGE_1,
+			func(a *FlashArea) { a.Size = 0x18000 }),
+			[]string{"FLASH_AREA_IMAGE_1 differs"}},
+		{"slot moved", withArea(t, deployed, FLASH_AREA_NAME_IMAGE_0,
+			func(a *FlashArea) { a.Offset = 0x8000 }),
+			[]string{"FLASH_AREA_IMAGE_0 differs"}},
+		{"slot removed", slotMap(t, 0x20000, 0),
+			[]string{"FLASH_AREA_IMAGE_1 missing from updated flash map"}},
+	}
+
+	for _, test := range tests {
+		got := OtaProblems(deployed, test.updated)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: problems=%q; want %q", test.name, got, test.want)
+			continue
+		}
+		for i, want := range test.want {
+			if !strings.HasPrefix(got[i], want) {
+				t.Errorf("%s: problem %d=%q; want %q",
+					test.name, i, got[i], want)
+			}
+		}
+	}
+
+	// A slot the deployed devices lack is also a problem.
+	if got := OtaProblems(slotMap(t, 0x20000, 0), deployed); len(got) != 1 ||
+		!strings.Contains(got[0], "missing from deployed flash map") {
+
+		t.Errorf("added slot: problems=%q", got)
+	}
+}
+
+func TestBootAppProblems(t *testing.T) {
+	boot, err := NewFlashMap([]FlashArea{
+		{Name: FLASH_AREA_NAME_BOOTLOADER, Id: 0, Device: 0, Offset: 0,
+			Size: 0x4000},
+		{Name: FLASH_AREA_NAME_IMAGE_0, Id: 1, Device: 0, Offset: 0x10000,
+			Size: 0x20000},
+		{Name: FLASH_AREA_NAME_IMAGE_1, Id: 2, Device: 0, Offset: 0x80000,
+			Size: 0x20000},
+		{Name: "FLASH_AREA_NFFS", Id: 17, Device: 0, Offset: 0xc0000,
+			Size: 0x4000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		app  FlashMap
+		want []string
+	}{
+		{"identical", boot, nil},
+		{"user area differs", withArea(t, boot, "FLASH_AREA_NFFS",
+			func(a *FlashArea) { a.Offset = 0xd0000 }), nil},
+		{"boot loader resized", withArea(t, boot,
+			FLASH_AREA_NAME_BOOTLOADER,
+			func(a *FlashArea) { a.Size = 0x8000 }),
+			[]string{"FLASH_AREA_BOOTLOADER differs; boot loader: id=0 " +
+				"device=0 offset=0x0 size=16384, app: id=0 device=0 " +
+				"offset=0x0 size=32768"}},
+		{"slot on other device", withArea(t, boot, FLASH_AREA_NAME_IMAGE_1,
+			func(a *FlashArea) { a.Device = 1 }),
+			[]string{"FLASH_AREA_IMAGE_1 differs"}},
+		{"scratch added", func() FlashMap {
+			fm := withArea(t, boot, "", nil)
+			fm.Areas[FLASH_AREA_NAME_IMAGE_SCRATCH] = FlashArea{
+				Name: FLASH_AREA_NAME_IMAGE_SCRATCH, Id: 3, Device: 0,
+				Offset: 0xf0000, Size: 0x4000}
+			return fm
+		}(), []string{
+			"FLASH_AREA_IMAGE_SCRATCH missing from boot loader flash map"}},
+	}
+
+	for _, test := range tests {
+		got := BootAppProblems(boot, test.app)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: problems=%q; want %q", test.name, got, test.want)
+			continue
+		}
+		for i, want := range test.want {
+			if !strings.HasPrefix(got[i], want) {
+				t.Errorf("%s: problem %d=%q; want %q",
+					test.name, i, got[i], want)
+			}
+		}
+	}
+}
+
+func TestWriteSize(t *testing.T) {
+	fm, err := readDevices(map[string]interface{}{
+		"0": ymlArea("write_size", "8"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fm.WriteSize(0); got != 8 {
+		t.Errorf("WriteSize(0)=%d; want 8", got)
+	}
+	if got := fm.WriteSize(1); got != 0 {
+		t.Errorf("WriteSize(1)=%d; want 0", got)
+	}
+
+	for _, val := range []string{"0", "-8", "eight"} {
+		if _, err := readDevices(map[string]interface{}{
+			"0": ymlArea("write_size", val),
+		}); err == nil {
+			t.Errorf("write_size=%s: expected error", val)
+		}
+	}
+}
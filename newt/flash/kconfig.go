@@ -0,0 +1,95 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package flash
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+// A flash map can be rendered as a Kconfig fragment for tooling that expects
+// Zephyr-style configuration.  Each area produces four symbols:
+//
+//     CONFIG_FLASH_AREA_IMAGE_0_ID=1
+//     CONFIG_FLASH_AREA_IMAGE_0_DEVICE=0
+//     CONFIG_FLASH_AREA_IMAGE_0_OFFSET=0x00008000
+//     CONFIG_FLASH_AREA_IMAGE_0_SIZE=0x00020000
+//
+// The symbol stem is the area name, upper-cased, with each character that is
+// not a letter, digit, or underscore replaced by an underscore.
+
+const KCONFIG_SYMBOL_PREFIX = "CONFIG_"
+
+// Converts a flash area name to the stem of its Kconfig symbols.
+func KconfigSymbolStem(areaName string) string {
+	b := []byte(strings.ToUpper(areaName))
+	for i, c := range b {
+		if !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') && c != '_' {
+			b[i] = '_'
+		}
+	}
+
+	stem := string(b)
+	if stem == "" || (stem[0] >= '0' && stem[0] <= '9') {
+		stem = "_" + stem
+	}
+
+	return stem
+}
+
+// Renders the flash map as a Kconfig fragment; areas appear in the order of
+// SortedAreas.  An error is returned if two area names sanitize to the same
+// symbol stem.
+func (flashMap FlashMap) Kconfig() (string, error) {
+	areas := flashMap.SortedAreas()
+
+	stemAreas := map[string]string{}
+	for _, area := range areas {
+		stem := KconfigSymbolStem(area.Name)
+		if other, ok := stemAreas[stem]; ok {
+			return "", util.FmtNewtError(
+				"Flash areas \"%s\" and \"%s\" map to the same Kconfig "+
+					"symbol %s%s", other, area.Name, KCONFIG_SYMBOL_PREFIX,
+				stem)
+		}
+		stemAreas[stem] = area.Name
+	}
+
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "# This file was generated by %s\n",
+		newtutil.NewtVersionStr)
+
+	for _, area := range areas {
+		sym := KCONFIG_SYMBOL_PREFIX + KconfigSymbolStem(area.Name)
+
+		fmt.Fprintf(buf, "\n# %s\n", area.Name)
+		fmt.Fprintf(buf, "%s_ID=%d\n", sym, area.Id)
+		fmt.Fprintf(buf, "%s_DEVICE=%d\n", sym, area.Device)
+		fmt.Fprintf(buf, "%s_OFFSET=0x%08x\n", sym, area.Offset)
+		fmt.Fprintf(buf, "%s_SIZE=0x%08x\n", sym, area.Size)
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,101 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package flash
+
+import (
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+)
+
+func TestKconfigSymbolStem(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"FLASH_AREA_IMAGE_0", "FLASH_AREA_IMAGE_0"},
+		{"flash_area_nffs", "FLASH_AREA_NFFS"},
+		{"FLASH-AREA.LOG 1", "FLASH_AREA_LOG_1"},
+		{"0_AREA", "_0_AREA"},
+		{"", "_"},
+	}
+
+	for _, test := range tests {
+		if got := KconfigSymbolStem(test.name); got != test.want {
+			t.Errorf("KconfigSymbolStem(%q)=%q; want %q",
+				test.name, got, test.want)
+		}
+	}
+}
+
+const testKconfigFixture = `
+# FLASH_AREA_BOOTLOADER
+CONFIG_FLASH_AREA_BOOTLOADER_ID=0
+CONFIG_FLASH_AREA_BOOTLOADER_DEVICE=0
+CONFIG_FLASH_AREA_BOOTLOADER_OFFSET=0x00000000
+CONFIG_FLASH_AREA_BOOTLOADER_SIZE=0x00004000
+
+# FLASH_AREA_IMAGE_0
+CONFIG_FLASH_AREA_IMAGE_0_ID=1
+CONFIG_FLASH_AREA_IMAGE_0_DEVICE=0
+CONFIG_FLASH_AREA_IMAGE_0_OFFSET=0x00008000
+CONFIG_FLASH_AREA_IMAGE_0_SIZE=0x00020000
+
+# flash-area.log
+CONFIG_FLASH_AREA_LOG_ID=17
+CONFIG_FLASH_AREA_LOG_DEVICE=1
+CONFIG_FLASH_AREA_LOG_OFFSET=0x00001000
+CONFIG_FLASH_AREA_LOG_SIZE=0x00002000
+`
+
+func TestKconfig(t *testing.T) {
+	fm, err := NewFlashMap([]FlashArea{
+		{Name: "flash-area.log", Id: 17, Device: 1, Offset: 0x1000,
+			Size: 0x2000},
+		{Name: FLASH_AREA_NAME_IMAGE_0, Id: 1, Device: 0, Offset: 0x8000,
+			Size: 0x20000},
+		{Name: FLASH_AREA_NAME_BOOTLOADER, Id: 0, Device: 0, Offset: 0,
+			Size: 0x4000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := fm.Kconfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "# This file was generated by " + newtutil.NewtVersionStr + "\n" +
+		testKconfigFixture
+	if got != want {
+		t.Errorf("Kconfig mismatch; got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Names that sanitize to the same stem are rejected.
+	fm.Areas["FLASH_AREA_LOG"] = FlashArea{Name: "FLASH_AREA_LOG", Id: 18,
+		Device: 1, Offset: 0x4000, Size: 0x1000}
+	if _, err := fm.Kconfig(); err == nil ||
+		!strings.Contains(err.Error(), "CONFIG_FLASH_AREA_LOG") {
+
+		t.Errorf("expected symbol collision error; got %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package flash
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// The MEMORY command of a linker script defines the regions that sections are
+// placed in:
+//
+//     MEMORY
+//     {
+//       FLASH (rx) : ORIGIN = 0x00008000, LENGTH = 0x3a000
+//       RAM (rwx) : ORIGIN = 0x20000000, LENGTH = 64K
+//     }
+//
+// Origins and lengths must be numbers, optionally with a K or M suffix, or
+// sums and differences of numbers.  Other expressions are rejected.
+
+// A single region from a linker script's MEMORY command.
+type MemRegion struct {
+	Name   string
+	Attrs  string
+	Origin int
+	Length int
+}
+
+var ldMemoryRe = regexp.MustCompile(`\bMEMORY\s*{([^}]*)}`)
+
+var ldRegionRe = regexp.MustCompile(
+	`(\w+)\s*(?:\(([^)]*)\))?\s*:\s*(?:ORIGIN|org|o)\s*=\s*([^,]+?)\s*,\s*` +
+		`(?:LENGTH|len|l)\s*=\s*([^\n,]+)`)
+
+var ldTermRe = regexp.MustCompile(`^\s*([+-]?)\s*([0-9a-fA-Fx]+)([KM]?)\s*`)
+
+func parseLdNumber(expr string) (int, error) {
+	total := 0
+	rest := strings.TrimSpace(expr)
+	if rest == "" {
+		return 0, util.NewNewtError("empty expression")
+	}
+
+	for first := true; rest != ""; first = false {
+		m := ldTermRe.FindStringSubmatch(rest)
+		if m == nil || (m[1] == "" && !first) {
+			return 0, util.FmtNewtError("unsupported expression \"%s\"",
+				strings.TrimSpace(expr))
+		}
+		rest = rest[len(m[0]):]
+
+		num, err := strconv.ParseInt(m[2], 0, 64)
+		if err != nil {
+			return 0, util.FmtNewtError("invalid number \"%s\"", m[2])
+		}
+
+		switch m[3] {
+		case "K":
+			num *= 1024
+		case "M":
+			num *= 1024 * 1024
+		}
+
+		if m[1] == "-" {
+			total -= int(num)
+		} else {
+			total += int(num)
+		}
+	}
+
+	return total, nil
+}
+
+// Extracts the memory regions from the MEMORY command of linker script
+// source.  An empty slice is returned if the script has no MEMORY command
+// (e.g., if it includes its memory layout from another file).
+func ParseLinkerMemory(src []byte) ([]MemRegion, error) {
+	regions := []MemRegion{}
+
+	m := ldMemoryRe.FindStringSubmatch(stripDts(string(src)))
+	if m == nil {
+		return regions, nil
+	}
+
+	for _, rm := range ldRegionRe.FindAllStringSubmatch(m[1], -1) {
+		origin, err := parseLdNumber(rm[3])
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"memory region %s has invalid origin: %s", rm[1], err.Error())
+		}
+
+		length, err := parseLdNumber(rm[4])
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"memory region %s has invalid length: %s", rm[1], err.Error())
+		}
+
+		regions = append(regions, MemRegion{
+			Name:   rm[1],
+			Attrs:  strings.TrimSpace(rm[2]),
+			Origin: origin,
+			Length: length,
+		})
+	}
+
+	return regions, nil
+}
+
+// Extracts the memory regions from linker script source that must contain
+// exactly one MEMORY command defining at least one region.
+func ParseSingleLinkerMemory(src []byte) ([]MemRegion, error) {
+	count := len(ldMemoryRe.FindAllString(stripDts(string(src)), -1))
+	if count != 1 {
+		return nil, util.FmtNewtError(
+			"linker script must contain exactly one MEMORY command; "+
+				"found %d", count)
+	}
+
+	regions, err := ParseLinkerMemory(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(regions) == 0 {
+		return nil, util.NewNewtError(
+			"linker script MEMORY command defines no regions")
+	}
+
+	return regions, nil
+}
+
+// Reads the memory regions from the specified linker script.
+func ReadLinkerMemory(path string) ([]MemRegion, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	regions, err := ParseLinkerMemory(src)
+	if err != nil {
+		return nil, util.PreNewtError(err, "%s", path)
+	}
+
+	return regions, nil
+}
+
+// Finds the flash area that a memory region describes.  If areaName is
+// non-empty, that area is used.  Otherwise, the area starting at the region's
+// origin is preferred, then the area containing it.
+func (flashMap FlashMap) areaForRegion(region MemRegion,
+	areaName string) (FlashArea, bool) {
+
+	if areaName != "" {
+		area, ok := flashMap.Areas[areaName]
+		return area, ok
+	}
+
+	areas := flashMap.SortedAreas()
+	for _, area := range areas {
+		if area.Offset == region.Origin {
+			return area, true
+		}
+	}
+	for _, area := range areas {
+		if region.Origin > area.Offset &&
+			region.Origin < area.Offset+area.Size {
+
+			return area, true
+		}
+	}
+
+	return FlashArea{}, false
+}
+
+// Compares a linker script memory region against the flash area it describes
+// (see areaForRegion).  Each discrepancy is described by a string; the result
+// is empty if the region and the area agree.
+func (flashMap FlashMap) LinkerRegionProblems(region MemRegion,
+	areaName string) []string {
+
+	area, ok := flashMap.areaForRegion(region, areaName)
+	if !ok {
+		if areaName != "" {
+			return []string{fmt.Sprintf("flash area %s does not exist",
+				areaName)}
+		}
+		return []string{fmt.Sprintf(
+			"region %s (origin=0x%x) does not start within any flash area",
+			region.Name, region.Origin)}
+	}
+
+	problems := []string{}
+	if region.Origin != area.Offset {
+		problems = append(problems, fmt.Sprintf(
+			"region %s origin 0x%x differs from %s offset 0x%x",
+			region.Name, region.Origin, area.Name, area.Offset))
+	}
+	if region.Length != area.Size {
+		problems = append(problems, fmt.Sprintf(
+			"region %s length 0x%x differs from %s size 0x%x",
+			region.Name, region.Length, area.Name, area.Size))
+	}
+
+	return problems
+}
@@ -0,0 +1,196 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package flash
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLdNumber(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    int
+		wantErr bool
+	}{
+		{"0x8000", 0x8000, false},
+		{"256K", 256 * 1024, false},
+		{"1M", 1024 * 1024, false},
+		{"0x20000 + 0x8000", 0x28000, false},
+		{"512K - 0x8000 - 0x1000", 512*1024 - 0x9000, false},
+		{"", 0, true},
+		{"ORIGIN(FLASH)", 0, true},
+		{"0x1000 0x2000", 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := parseLdNumber(test.expr)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected error", test.expr)
+			}
+		} else if err != nil || got != test.want {
+			t.Errorf("%q: value=0x%x err=%v; want 0x%x",
+				test.expr, got, err, test.want)
+		}
+	}
+}
+
+const testLinkerScript = `
+/* Linker script for the test BSP. */
+MEMORY
+{
+  FLASH (rx) : ORIGIN = 0x0000c000, LENGTH = 0x32000
+  RAM (rwx) : ORIGIN = 0x20000000, LENGTH = 64K
+}
+
+SECTIONS
+{
+    .text : { *(.text*) } > FLASH
+}
+`
+
+func TestParseLinkerMemory(t *testing.T) {
+	regions, err := ParseSingleLinkerMemory([]byte(testLinkerScript))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []MemRegion{
+		{Name: "FLASH", Attrs: "rx", Origin: 0xc000, Length: 0x32000},
+		{Name: "RAM", Attrs: "rwx", Origin: 0x20000000, Length: 0x10000},
+	}
+	if !reflect.DeepEqual(regions, want) {
+		t.Errorf("regions=%+v; want %+v", regions, want)
+	}
+
+	// A script without a MEMORY command yields no regions, but is not a
+	// valid standalone script.
+	noMem := []byte("SECTIONS { }")
+	if regions, err := ParseLinkerMemory(noMem); err != nil ||
+		len(regions) != 0 {
+
+		t.Errorf("no MEMORY: regions=%+v err=%v", regions, err)
+	}
+	if _, err := ParseSingleLinkerMemory(noMem); err == nil {
+		t.Errorf("no MEMORY: expected error")
+	}
+}
+
+func TestLinkerRegionProblems(t *testing.T) {
+	fm := slotMap(t, 0x20000, 0x20000)
+
+	tests := []struct {
+		name     string
+		region   MemRegion
+		areaName string
+		want     []string
+	}{
+		{"matches", MemRegion{Name: "FLASH", Origin: 0x10000,
+			Length: 0x20000}, "", nil},
+		{"origin differs", MemRegion{Name: "FLASH", Origin: 0x10200,
+			Length: 0x20000}, "", []string{
+			"region FLASH origin 0x10200 differs from FLASH_AREA_IMAGE_0 " +
+				"offset 0x10000"}},
+		{"length differs", MemRegion{Name: "FLASH", Origin: 0x10000,
+			Length: 0x1f000}, "", []string{
+			"region FLASH length 0x1f000 differs from FLASH_AREA_IMAGE_0 " +
+				"size 0x20000"}},
+		{"explicit area", MemRegion{Name: "FLASH", Origin: 0x10000,
+			Length: 0x20000}, FLASH_AREA_NAME_IMAGE_1, []string{
+			"origin 0x10000 differs from FLASH_AREA_IMAGE_1 offset " +
+				"0x80000"}},
+		{"outside every area", MemRegion{Name: "FLASH", Origin: 0x4000,
+			Length: 0x1000}, "", []string{"does not start within any"}},
+		{"missing area", MemRegion{Name: "FLASH"}, "FLASH_AREA_NONE",
+			[]string{"flash area FLASH_AREA_NONE does not exist"}},
+	}
+
+	for _, test := range tests {
+		got := fm.LinkerRegionProblems(test.region, test.areaName)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: problems=%q; want %q", test.name, got, test.want)
+			continue
+		}
+		for i, want := range test.want {
+			if !strings.Contains(got[i], want) {
+				t.Errorf("%s: problem %d=%q; want it to contain %q",
+					test.name, i, got[i], want)
+			}
+		}
+	}
+}
+
+func TestParseSingleLinkerMemory(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		regions int
+		wantErr string
+	}{
+		{
+			name:    "one command",
+			src:     testLinkerScript,
+			regions: 2,
+		},
+		{
+			name:    "no command",
+			src:     "SECTIONS { }",
+			wantErr: "found 0",
+		},
+		{
+			name: "two commands",
+			src: "MEMORY { FLASH (rx) : ORIGIN = 0, LENGTH = 4K }\n" +
+				"MEMORY { RAM (rwx) : ORIGIN = 0x20000000, LENGTH = 4K }",
+			wantErr: "found 2",
+		},
+		{
+			name: "commented-out command",
+			src: "/* MEMORY { RAM (rwx) : ORIGIN = 0, LENGTH = 1K } */\n" +
+				"MEMORY { FLASH (rx) : ORIGIN = 0, LENGTH = 4K }",
+			regions: 1,
+		},
+		{
+			name:    "no regions",
+			src:     "MEMORY { }",
+			wantErr: "defines no regions",
+		},
+	}
+
+	for _, test := range tests {
+		regions, err := ParseSingleLinkerMemory([]byte(test.src))
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: expected error containing %q; got %v",
+					test.name, test.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+		if len(regions) != test.regions {
+			t.Errorf("%s: got %d regions; want %d",
+				test.name, len(regions), test.regions)
+		}
+	}
+}
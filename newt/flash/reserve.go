@@ -0,0 +1,198 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package flash
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// A span of flash that no area may occupy, declared in the flash map's
+// "reserved" mapping.  Reserves typically cover hardware-defined regions,
+// such as option bytes or a vendor recovery loader, that are not part of
+// the flash map proper.
+type FlashReserve struct {
+	Name   string
+	Device int
+	Offset int
+	Size   int
+}
+
+// A flash area that overlaps a reserved span.
+type ReserveOverlap struct {
+	Area    FlashArea
+	Reserve FlashReserve
+}
+
+func parseReserve(
+	name string, ymlFields map[string]interface{}) (FlashReserve, error) {
+
+	res := FlashReserve{
+		Name: name,
+	}
+
+	reserveErr := func(format string, args ...interface{}) error {
+		return util.NewNewtError(
+			"failure while parsing reserved flash region \"" + name +
+				"\": " + fmt.Sprintf(format, args...))
+	}
+
+	devicePresent := false
+	offsetPresent := false
+	sizePresent := false
+
+	var err error
+
+	fields := cast.ToStringMapString(ymlFields)
+	for k, v := range fields {
+		switch k {
+		case "device":
+			res.Device, err = util.AtoiNoOct(v)
+			if err != nil {
+				return res, reserveErr("invalid device: %s", v)
+			}
+			devicePresent = true
+
+		case "offset":
+			res.Offset, err = util.AtoiNoOct(v)
+			if err != nil {
+				return res, reserveErr("invalid offset: %s", v)
+			}
+			offsetPresent = true
+
+		case "size":
+			res.Size, err = parseSize(v)
+			if err != nil || res.Size <= 0 {
+				return res, reserveErr("invalid size: %s", v)
+			}
+			sizePresent = true
+
+		default:
+			util.StatusMessage(util.VERBOSITY_QUIET,
+				"Warning: reserved flash region \"%s\" contains "+
+					"unrecognized field: %s", name, k)
+		}
+	}
+
+	if !devicePresent {
+		return res, reserveErr("required field \"device\" missing")
+	}
+	if !offsetPresent {
+		return res, reserveErr("required field \"offset\" missing")
+	}
+	if !sizePresent {
+		return res, reserveErr("required field \"size\" missing")
+	}
+
+	return res, nil
+}
+
+// Indicates whether the specified span overlaps the reserve.
+func (res FlashReserve) Overlaps(device int, offset int, size int) bool {
+	return res.Device == device &&
+		offset < res.Offset+res.Size && res.Offset < offset+size
+}
+
+type reserveSorter struct {
+	reserves []FlashReserve
+}
+
+func (s reserveSorter) Len() int {
+	return len(s.reserves)
+}
+func (s reserveSorter) Swap(i, j int) {
+	s.reserves[i], s.reserves[j] = s.reserves[j], s.reserves[i]
+}
+func (s reserveSorter) Less(i, j int) bool {
+	a := s.reserves[i]
+	b := s.reserves[j]
+
+	if a.Device != b.Device {
+		return a.Device < b.Device
+	}
+	if a.Offset != b.Offset {
+		return a.Offset < b.Offset
+	}
+	return a.Name < b.Name
+}
+
+// Returns the flash map's reserves sorted by device, then offset.
+func (flashMap FlashMap) SortedReserves() []FlashReserve {
+	sorter := reserveSorter{
+		reserves: make([]FlashReserve, 0, len(flashMap.Reserves)),
+	}
+	for _, res := range flashMap.Reserves {
+		sorter.reserves = append(sorter.reserves, res)
+	}
+
+	sort.Sort(sorter)
+	return sorter.reserves
+}
+
+// Returns the first reserve that the specified span overlaps, or nil if the
+// span is clear of all reserves.
+func (flashMap FlashMap) ReserveOverlapping(
+	device int, offset int, size int) *FlashReserve {
+
+	for _, res := range flashMap.SortedReserves() {
+		if res.Overlaps(device, offset, size) {
+			return &res
+		}
+	}
+
+	return nil
+}
+
+func (flashMap *FlashMap) detectReserveOverlaps() {
+	flashMap.ReserveOverlaps = []ReserveOverlap{}
+
+	for _, area := range flashMap.SortedAreas() {
+		for _, res := range flashMap.SortedReserves() {
+			if res.Overlaps(area.Device, area.Offset, area.Size) {
+				flashMap.ReserveOverlaps = append(flashMap.ReserveOverlaps,
+					ReserveOverlap{Area: area, Reserve: res})
+			}
+		}
+	}
+}
+
+// Describes each flash area that overlaps a reserved span, along with the
+// overlapping bytes.
+func (flashMap FlashMap) ReserveOverlapText() string {
+	if len(flashMap.ReserveOverlaps) == 0 {
+		return ""
+	}
+
+	str := "Flash areas overlapping reserved regions detected:\n"
+	for _, o := range flashMap.ReserveOverlaps {
+		start := util.IntMax(o.Area.Offset, o.Reserve.Offset)
+		end := util.IntMin(o.Area.Offset+o.Area.Size,
+			o.Reserve.Offset+o.Reserve.Size)
+
+		str += fmt.Sprintf("    %s =/= %s (device=%d overlap=0x%x-0x%x)\n",
+			o.Area.Name, o.Reserve.Name, o.Area.Device, start, end)
+	}
+
+	return str
+}
@@ -0,0 +1,125 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package flash
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadReserves(t *testing.T) {
+	tests := []struct {
+		name     string
+		reserved map[string]interface{}
+		want     FlashReserve
+		wantErr  bool
+	}{
+		{"valid", map[string]interface{}{
+			"OPTION_BYTES": ymlArea("device", "0", "offset", "0x1f000",
+				"size", "4kB"),
+		}, FlashReserve{"OPTION_BYTES", 0, 0x1f000, 0x1000}, false},
+		{"missing device", map[string]interface{}{
+			"R": ymlArea("offset", "0", "size", "16"),
+		}, FlashReserve{}, true},
+		{"missing offset", map[string]interface{}{
+			"R": ymlArea("device", "0", "size", "16"),
+		}, FlashReserve{}, true},
+		{"missing size", map[string]interface{}{
+			"R": ymlArea("device", "0", "offset", "0"),
+		}, FlashReserve{}, true},
+		{"zero size", map[string]interface{}{
+			"R": ymlArea("device", "0", "offset", "0", "size", "0"),
+		}, FlashReserve{}, true},
+	}
+
+	for _, test := range tests {
+		fm, err := Read(map[string]interface{}{
+			"areas": map[string]interface{}{
+				FLASH_AREA_NAME_BOOTLOADER: ymlArea("device", "0",
+					"offset", "0", "size", "16kB"),
+			},
+			"reserved": test.reserved,
+		})
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if got := fm.Reserves[test.want.Name]; got != test.want {
+			t.Errorf("%s: reserve=%+v; want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestReserveOverlaps(t *testing.T) {
+	res := FlashReserve{Name: "RES", Device: 0, Offset: 0x1000, Size: 0x100}
+
+	tests := []struct {
+		name    string
+		area    FlashArea
+		overlap bool
+	}{
+		{"before", FlashArea{Name: "A", Device: 0, Offset: 0x0000,
+			Size: 0x1000}, false},
+		{"after", FlashArea{Name: "A", Device: 0, Offset: 0x1100,
+			Size: 0x100}, false},
+		{"straddles start", FlashArea{Name: "A", Device: 0, Offset: 0x0f00,
+			Size: 0x101}, true},
+		{"straddles end", FlashArea{Name: "A", Device: 0, Offset: 0x10ff,
+			Size: 0x100}, true},
+		{"contains", FlashArea{Name: "A", Device: 0, Offset: 0x0000,
+			Size: 0x2000}, true},
+		{"other device", FlashArea{Name: "A", Device: 1, Offset: 0x1000,
+			Size: 0x100}, false},
+	}
+
+	for _, test := range tests {
+		fm := newFlashMap()
+		fm.Areas[test.area.Name] = test.area
+		fm.Reserves[res.Name] = res
+		fm.detectOverlaps()
+
+		if got := len(fm.ReserveOverlaps) > 0; got != test.overlap {
+			t.Errorf("%s: overlap=%v; want %v", test.name, got, test.overlap)
+			continue
+		}
+
+		text := fm.ErrorText()
+		if test.overlap && !strings.Contains(text, "A =/= RES") {
+			t.Errorf("%s: error text does not report overlap:\n%s",
+				test.name, text)
+		} else if !test.overlap && text != "" {
+			t.Errorf("%s: unexpected error text:\n%s", test.name, text)
+		}
+
+		span := fm.ReserveOverlapping(test.area.Device, test.area.Offset,
+			test.area.Size)
+		if (span != nil) != test.overlap {
+			t.Errorf("%s: ReserveOverlapping=%v; want overlap=%v",
+				test.name, span, test.overlap)
+		}
+	}
+}
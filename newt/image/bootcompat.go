@@ -0,0 +1,176 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// The component name by which image dependencies conventionally refer to the
+// boot loader.
+const BOOT_DEP_NAME = "bootloader"
+
+// The result of checking an app image against a boot loader.
+type BootCompat struct {
+	AppMagic   uint32
+	AppHdrSz   int
+	AppDeps    []ImageDependency
+	BootIsImg  bool
+	BootMagics []uint32 // Known image magics referenced by the boot loader.
+
+	// The boot loader's version; nil if it could not be determined.
+	BootVersion *ImageVersion
+
+	// Reasons the app image is incompatible with the boot loader; empty if
+	// it is compatible.
+	Problems []string
+}
+
+func (bc BootCompat) Compatible() bool {
+	return len(bc.Problems) == 0
+}
+
+// Indicates whether the boot loader code contains the specified magic as a
+// little endian 32-bit constant.  A boot loader that checks image headers
+// for a magic value must contain it somewhere in its code.
+func codeHasMagic(code []byte, magic uint32) bool {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, magic)
+	return bytes.Contains(code, buf)
+}
+
+// Inspects an app image and a boot loader, and determines whether the boot
+// loader can boot the image.  The boot loader file is either a newt image or
+// a raw binary.  The following are checked:
+//   - The boot loader code references the app image's header magic.
+//   - The app image's header is large enough to hold a full image header
+//     and is word aligned.
+//   - Each of the app image's dependencies on depName is satisfied by the
+//     boot loader's version.
+//
+// The boot loader's version is taken from its image header, unless
+// bootVersion is non-nil.  If the version is unknown, an app image that
+// depends on the boot loader is reported as incompatible.
+func CheckBootCompat(appPath string, bootPath string, depName string,
+	bootVersion *ImageVersion) (BootCompat, error) {
+
+	bc := BootCompat{}
+	problem := func(format string, args ...interface{}) {
+		bc.Problems = append(bc.Problems, fmt.Sprintf(format, args...))
+	}
+
+	appData, err := ioutil.ReadFile(appPath)
+	if err != nil {
+		return bc, util.ChildNewtError(err)
+	}
+
+	// Accept any header magic in the app image; whether the boot loader
+	// expects it is one of the things being checked.
+	appHdr := ImageHdr{}
+	if err := binary.Read(bytes.NewReader(appData), binary.LittleEndian,
+		&appHdr); err != nil {
+
+		return bc, util.FmtNewtError(
+			"Image %s too small to contain header", appPath)
+	}
+	bc.AppMagic = appHdr.Magic
+	bc.AppHdrSz = int(appHdr.HdrSz)
+
+	_, _, trailer, err := parseImageMagic(appPath, appData, appHdr.Magic)
+	if err != nil {
+		return bc, err
+	}
+	tlvs, err := parseImageTlvs(appPath, appData, appHdr, trailer)
+	if err != nil {
+		return bc, err
+	}
+
+	bc.AppDeps, err = TlvDependencies(tlvs)
+	if err != nil {
+		return bc, err
+	}
+
+	bootData, err := ioutil.ReadFile(bootPath)
+	if err != nil {
+		return bc, util.ChildNewtError(err)
+	}
+
+	// Determine whether the boot loader is itself an image.  If so, only its
+	// payload is its code.
+	bootCode := bootData
+	for _, magic := range []uint32{appHdr.Magic, IMAGE_MAGIC} {
+		bootHdr, bootPayload, _, err := parseImageMagic(bootPath, bootData,
+			magic)
+		if err == nil {
+			bc.BootIsImg = true
+			bootCode = bootPayload
+			ver := bootHdr.Vers
+			bc.BootVersion = &ver
+			break
+		}
+	}
+	if bootVersion != nil {
+		bc.BootVersion = bootVersion
+	}
+
+	magics := []uint32{IMAGE_MAGIC}
+	if appHdr.Magic != IMAGE_MAGIC {
+		magics = append(magics, appHdr.Magic)
+	}
+	for _, magic := range magics {
+		if codeHasMagic(bootCode, magic) {
+			bc.BootMagics = append(bc.BootMagics, magic)
+		}
+	}
+
+	if !codeHasMagic(bootCode, appHdr.Magic) {
+		problem("boot loader does not reference the app image's header "+
+			"magic (0x%08x)", appHdr.Magic)
+	}
+
+	if bc.AppHdrSz < IMAGE_HEADER_SIZE {
+		problem("app image header size (%d) is less than the image header "+
+			"(%d bytes)", bc.AppHdrSz, IMAGE_HEADER_SIZE)
+	} else if bc.AppHdrSz%4 != 0 {
+		problem("app image header size (%d) is not a multiple of 4",
+			bc.AppHdrSz)
+	}
+
+	for _, dep := range bc.AppDeps {
+		if dep.Name != depName {
+			continue
+		}
+
+		if bc.BootVersion == nil {
+			problem("app image requires %s, but the boot loader's version "+
+				"is unknown", dep.String())
+		} else if bc.BootVersion.Compare(dep.MinVersion) < 0 {
+			problem("app image requires %s, but the boot loader is version "+
+				"%s", dep.String(), bc.BootVersion.String())
+		}
+	}
+
+	return bc, nil
+}
@@ -0,0 +1,149 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckBootCompat(t *testing.T) {
+	dir, _, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	// Boot loader code that checks for the standard image magic.
+	bootCode := make([]byte, 0x200)
+	binary.LittleEndian.PutUint32(bootCode[0x80:], IMAGE_MAGIC)
+
+	rawBoot := filepath.Join(dir, "boot.bin")
+	if err := ioutil.WriteFile(rawBoot, bootCode, 0644); err != nil {
+		t.Fatal(err)
+	}
+	rawNoMagic := filepath.Join(dir, "boot-nomagic.bin")
+	if err := ioutil.WriteFile(rawNoMagic, make([]byte, 0x200),
+		0644); err != nil {
+
+		t.Fatal(err)
+	}
+
+	// A boot loader image of version 1.2.3.4.
+	imgBoot := testImageFromBin(t, dir, "boot.img", bootCode)
+
+	bootDep := func(vers string) []ImageDependency {
+		ver, err := ParseVersion(vers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []ImageDependency{{BOOT_DEP_NAME, ver}}
+	}
+
+	tests := []struct {
+		name        string
+		bootPath    string
+		bootVersion *ImageVersion
+		deps        []ImageDependency
+		magic       uint32
+		want        string // Expected problem; "" if compatible.
+	}{
+		{
+			name:     "raw boot loader",
+			bootPath: rawBoot,
+		},
+		{
+			name:     "missing magic",
+			bootPath: rawNoMagic,
+			want:     "does not reference the app image's header magic",
+		},
+		{
+			name:     "custom magic",
+			bootPath: rawBoot,
+			magic:    0x12345678,
+			want:     "header magic (0x12345678)",
+		},
+		{
+			name:     "unknown boot version",
+			bootPath: rawBoot,
+			deps:     bootDep("1.0"),
+			want:     "the boot loader's version is unknown",
+		},
+		{
+			name:        "specified boot version",
+			bootPath:    rawBoot,
+			bootVersion: &ImageVersion{2, 0, 0, 0},
+			deps:        bootDep("1.0"),
+		},
+		{
+			name:     "boot image satisfies dependency",
+			bootPath: imgBoot,
+			deps:     bootDep("1.2.3.4"),
+		},
+		{
+			name:     "boot image too old",
+			bootPath: imgBoot,
+			deps:     bootDep("1.3"),
+			want: "requires bootloader >= 1.3.0.0, but the boot loader " +
+				"is version 1.2.3.4",
+		},
+		{
+			name:     "other component",
+			bootPath: imgBoot,
+			deps: []ImageDependency{
+				{"radio", ImageVersion{9, 0, 0, 0}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		appPath := testBuildImage(t, dir, binPath, func(img *Image) {
+			img.Dependencies = test.deps
+			img.Magic = test.magic
+		})
+
+		bc, err := CheckBootCompat(appPath, test.bootPath, BOOT_DEP_NAME,
+			test.bootVersion)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+
+		if bc.BootIsImg != (test.bootPath == imgBoot) {
+			t.Errorf("%s: BootIsImg=%v", test.name, bc.BootIsImg)
+		}
+
+		if test.want == "" {
+			if !bc.Compatible() {
+				t.Errorf("%s: unexpected problems: %v", test.name,
+					bc.Problems)
+			}
+			continue
+		}
+
+		if len(bc.Problems) != 1 ||
+			!strings.Contains(bc.Problems[0], test.want) {
+
+			t.Errorf("%s: problems=%v; want one containing \"%s\"",
+				test.name, bc.Problems, test.want)
+		}
+	}
+}
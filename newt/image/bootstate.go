@@ -0,0 +1,170 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// The boot loader records the swap state of each image slot in a trailer at
+// the very end of the slot's flash area.  The trailer has the following
+// structure; each flag occupies a full flash write unit ("align"), of which
+// only the first byte is meaningful.
+//
+//  +-----------------------------------------+
+//  | Magic (16 bytes)                        |
+//  +-----------------------------------------+
+//  | Swap status (status-count * 3 * align)  |
+//  +-----------------------------------------+
+//  | Copy done (align)                       |
+//  +-----------------------------------------+
+//  | Image OK (align)                        |
+//  +-----------------------------------------+  <- end of flash area
+//
+// An image slot's trailer has room for the status of BOOT_STATUS_MAX_ENTRIES
+// sectors; the scratch area's trailer only records a single sector.  The
+// trailer is present only if the magic is valid; flags read as
+// BOOT_FLAG_SET when set and as erased flash otherwise.
+
+type BootTrailerFormat int
+
+const (
+	BOOT_TRAILER_SLOT BootTrailerFormat = iota
+	BOOT_TRAILER_SCRATCH
+)
+
+const BOOT_MAGIC_SZ = 16
+const BOOT_STATUS_MAX_ENTRIES = 128
+const BOOT_STATUS_STATE_COUNT = 3
+const BOOT_FLAG_SET = 0x01
+
+var bootMagic = []uint32{
+	0xf395c277,
+	0x7fefd260,
+	0x0f505235,
+	0x8079b62c,
+}
+
+type BootState int
+
+const (
+	// No valid trailer; nothing has been requested of the boot loader.
+	BOOT_STATE_UNSET BootState = iota
+
+	// An upgrade has been requested but not yet performed.
+	BOOT_STATE_PENDING
+
+	// The image has been swapped in and is running in test mode; it gets
+	// reverted on the next reset unless it is confirmed.
+	BOOT_STATE_TEST
+
+	// The image has been marked as permanently good.
+	BOOT_STATE_CONFIRMED
+)
+
+var bootStateNames = map[BootState]string{
+	BOOT_STATE_UNSET:     "unset",
+	BOOT_STATE_PENDING:   "pending",
+	BOOT_STATE_TEST:      "test",
+	BOOT_STATE_CONFIRMED: "confirmed",
+}
+
+func (state BootState) String() string {
+	return bootStateNames[state]
+}
+
+func bootMagicBytes() []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, bootMagic)
+	return buf.Bytes()
+}
+
+// Calculates the size of a boot trailer in the specified format.  align is
+// the flash device's minimum write size.
+func BootTrailerSize(format BootTrailerFormat, align int) int {
+	statusEntries := BOOT_STATUS_MAX_ENTRIES
+	if format == BOOT_TRAILER_SCRATCH {
+		statusEntries = 1
+	}
+
+	return BOOT_MAGIC_SZ + statusEntries*BOOT_STATUS_STATE_COUNT*align +
+		2*align
+}
+
+// Calculates the smallest image slot that can hold a valid image: one with an
+// image header, a hash TLV, and room for the boot trailer, but no payload.
+// align is the flash device's minimum write size.
+func MinSlotSize(align int) int {
+	return IMAGE_HEADER_SIZE + 4 + 32 +
+		BootTrailerSize(BOOT_TRAILER_SLOT, align)
+}
+
+// Determines the boot state of a slot or scratch area from its trailer.  data
+// contains the end of the flash area; the trailer occupies its final bytes.
+// A trailer with a missing or corrupt magic indicates the unset state.
+func ParseBootState(data []byte, format BootTrailerFormat, align int) (
+	BootState, error) {
+
+	if align < 1 {
+		return BOOT_STATE_UNSET, util.FmtNewtError(
+			"Invalid flash write alignment: %d", align)
+	}
+
+	trailerSz := BootTrailerSize(format, align)
+	if len(data) < trailerSz {
+		return BOOT_STATE_UNSET, util.FmtNewtError(
+			"Boot trailer truncated; need %d bytes, have %d",
+			trailerSz, len(data))
+	}
+
+	trailer := data[len(data)-trailerSz:]
+	if !bytes.Equal(trailer[:BOOT_MAGIC_SZ], bootMagicBytes()) {
+		return BOOT_STATE_UNSET, nil
+	}
+
+	copyDone := trailer[trailerSz-2*align] == BOOT_FLAG_SET
+	imageOk := trailer[trailerSz-align] == BOOT_FLAG_SET
+
+	switch {
+	case imageOk:
+		return BOOT_STATE_CONFIRMED, nil
+	case copyDone:
+		return BOOT_STATE_TEST, nil
+	default:
+		return BOOT_STATE_PENDING, nil
+	}
+}
+
+// Determines the boot state recorded in a dump of a slot or scratch area.
+// The file must end at the end of the flash area.
+func ReadBootState(path string, format BootTrailerFormat, align int) (
+	BootState, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return BOOT_STATE_UNSET, util.ChildNewtError(err)
+	}
+
+	return ParseBootState(data, format, align)
+}
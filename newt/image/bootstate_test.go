@@ -0,0 +1,118 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Builds the end of a flash area containing a boot trailer in the specified
+// format.  Erased flash reads as 0xff.
+func testBootTrailer(format BootTrailerFormat, align int, magic bool,
+	copyDone bool, imageOk bool) []byte {
+
+	trailerSz := BootTrailerSize(format, align)
+	data := bytes.Repeat([]byte{0xff}, 0x100+trailerSz)
+	trailer := data[len(data)-trailerSz:]
+
+	if magic {
+		copy(trailer, bootMagicBytes())
+	}
+	if copyDone {
+		trailer[trailerSz-2*align] = BOOT_FLAG_SET
+	}
+	if imageOk {
+		trailer[trailerSz-align] = BOOT_FLAG_SET
+	}
+
+	return data
+}
+
+func TestBootTrailerSize(t *testing.T) {
+	tests := []struct {
+		format BootTrailerFormat
+		align  int
+		want   int
+	}{
+		{BOOT_TRAILER_SLOT, 1, 16 + 128*3 + 2},
+		{BOOT_TRAILER_SLOT, 8, 16 + 128*3*8 + 16},
+		{BOOT_TRAILER_SCRATCH, 1, 16 + 3 + 2},
+		{BOOT_TRAILER_SCRATCH, 4, 16 + 3*4 + 8},
+	}
+
+	for _, test := range tests {
+		got := BootTrailerSize(test.format, test.align)
+		if got != test.want {
+			t.Errorf("BootTrailerSize(%d, %d) = %d; want %d",
+				test.format, test.align, got, test.want)
+		}
+	}
+}
+
+func TestParseBootState(t *testing.T) {
+	tests := []struct {
+		format   BootTrailerFormat
+		align    int
+		magic    bool
+		copyDone bool
+		imageOk  bool
+		want     BootState
+	}{
+		{BOOT_TRAILER_SLOT, 1, false, false, false, BOOT_STATE_UNSET},
+		{BOOT_TRAILER_SLOT, 1, false, true, true, BOOT_STATE_UNSET},
+		{BOOT_TRAILER_SLOT, 1, true, false, false, BOOT_STATE_PENDING},
+		{BOOT_TRAILER_SLOT, 1, true, true, false, BOOT_STATE_TEST},
+		{BOOT_TRAILER_SLOT, 1, true, true, true, BOOT_STATE_CONFIRMED},
+		{BOOT_TRAILER_SLOT, 8, true, true, false, BOOT_STATE_TEST},
+		{BOOT_TRAILER_SLOT, 8, true, false, true, BOOT_STATE_CONFIRMED},
+		{BOOT_TRAILER_SCRATCH, 1, true, false, false, BOOT_STATE_PENDING},
+		{BOOT_TRAILER_SCRATCH, 4, true, true, false, BOOT_STATE_TEST},
+	}
+
+	for _, test := range tests {
+		data := testBootTrailer(test.format, test.align, test.magic,
+			test.copyDone, test.imageOk)
+
+		got, err := ParseBootState(data, test.format, test.align)
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %s", test, err.Error())
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%+v: state %s; want %s", test, got.String(),
+				test.want.String())
+		}
+	}
+}
+
+func TestParseBootStateErrors(t *testing.T) {
+	data := testBootTrailer(BOOT_TRAILER_SLOT, 1, true, false, false)
+
+	// Too short to hold a trailer.
+	short := data[len(data)-BootTrailerSize(BOOT_TRAILER_SLOT, 1)+1:]
+	if _, err := ParseBootState(short, BOOT_TRAILER_SLOT, 1); err == nil {
+		t.Errorf("truncated trailer: expected error")
+	}
+
+	if _, err := ParseBootState(data, BOOT_TRAILER_SLOT, 0); err == nil {
+		t.Errorf("zero alignment: expected error")
+	}
+}
@@ -0,0 +1,242 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// An OTA bundle descriptor is a JSON file that indexes a set of images for an
+// OTA server.  It holds a manifest describing each image, and a signature of
+// the manifest.  The signature covers the SHA256 digest of the manifest's
+// compact JSON encoding, so the descriptor may be reformatted without
+// invalidating it.
+
+const BUNDLE_FORMAT_VERSION = 1
+
+const BUNDLE_SIG_RSA2048 = "rsa2048"
+const BUNDLE_SIG_ECDSA = "ecdsa"
+
+type BundleImage struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Size    int    `json:"size"`
+
+	// The image's SHA256 hash TLV, hex encoded.
+	Hash string `json:"hash"`
+}
+
+type BundleManifest struct {
+	FormatVersion int           `json:"format_version"`
+	Images        []BundleImage `json:"images"`
+}
+
+type Bundle struct {
+	Manifest json.RawMessage `json:"manifest"`
+	SigType  string          `json:"sig_type"`
+
+	// Hex encoded; an ECDSA signature is ASN.1 encoded.
+	Signature string `json:"signature"`
+}
+
+// Describes a single image for inclusion in a bundle.  The image's hash is
+// checked against its contents.
+func readBundleImage(imgPath string) (BundleImage, error) {
+	data, hdr, _, hashTlv, err := readVerifiedImage(imgPath)
+	if err != nil {
+		return BundleImage{}, err
+	}
+
+	return BundleImage{
+		Name:    filepath.Base(imgPath),
+		Version: hdr.Vers.String(),
+		Size:    len(data),
+		Hash:    hex.EncodeToString(hashTlv.Data),
+	}, nil
+}
+
+func bundleDigest(manifest []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := json.Compact(buf, manifest); err != nil {
+		return nil, util.FmtNewtError("Malformed bundle manifest: %s",
+			err.Error())
+	}
+
+	digest := sha256.Sum256(buf.Bytes())
+	return digest[:], nil
+}
+
+// Creates a signed bundle descriptor for the specified images.  keyFile is
+// either the path of a PEM private key or a PKCS#11 URI, as accepted by
+// create-image.
+func CreateBundle(imgPaths []string, keyFile string) ([]byte, error) {
+	manifest := BundleManifest{
+		FormatVersion: BUNDLE_FORMAT_VERSION,
+		Images:        make([]BundleImage, len(imgPaths)),
+	}
+	for i, imgPath := range imgPaths {
+		var err error
+		manifest.Images[i], err = readBundleImage(imgPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	manifestJson, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	// Reuse the image signing code; the digest takes the place of the image
+	// hash.
+	signer := &Image{}
+	if err := signer.SetSigningKey(keyFile, 0); err != nil {
+		return nil, err
+	}
+	signer.Hash, err = bundleDigest(manifestJson)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := Bundle{Manifest: manifestJson}
+	var sig []byte
+	if signer.signsRSA() {
+		bundle.SigType = BUNDLE_SIG_RSA2048
+		sig, err = signer.signRSA()
+	} else {
+		bundle.SigType = BUNDLE_SIG_ECDSA
+		sig, err = signer.signEC()
+	}
+	if err != nil {
+		return nil, err
+	}
+	bundle.Signature = hex.EncodeToString(sig)
+
+	data, err := json.MarshalIndent(bundle, "", "    ")
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return append(data, '\n'), nil
+}
+
+// Creates a signed bundle descriptor and writes it to the specified file.
+func WriteBundle(bundlePath string, imgPaths []string, keyFile string) error {
+	data, err := CreateBundle(imgPaths, keyFile)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(bundlePath, data, 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+func bundleSigVerifies(key *TrustedKey, sigType string, digest []byte,
+	sig []byte) bool {
+
+	switch sigType {
+	case BUNDLE_SIG_RSA2048:
+		return key.RSA != nil &&
+			rsa.VerifyPKCS1v15(key.RSA, crypto.SHA256, digest, sig) == nil
+
+	case BUNDLE_SIG_ECDSA:
+		var ecSig ECDSASig
+		if key.EC == nil {
+			return false
+		}
+		if _, err := asn1.Unmarshal(sig, &ecSig); err != nil {
+			return false
+		}
+		return ecdsa.Verify(key.EC, digest, ecSig.R, ecSig.S)
+
+	default:
+		return false
+	}
+}
+
+// Checks a bundle descriptor's signature against a trust store.  On success,
+// the bundle's manifest and the key that verified it are returned.
+func VerifyBundle(data []byte, keys []TrustedKey) (
+	BundleManifest, *TrustedKey, error) {
+
+	manifest := BundleManifest{}
+
+	bundle := Bundle{}
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return manifest, nil, util.FmtNewtError(
+			"Malformed bundle descriptor: %s", err.Error())
+	}
+	if bundle.SigType != BUNDLE_SIG_RSA2048 &&
+		bundle.SigType != BUNDLE_SIG_ECDSA {
+
+		return manifest, nil, util.FmtNewtError(
+			"Bundle descriptor has unsupported signature type \"%s\"",
+			bundle.SigType)
+	}
+
+	sig, err := hex.DecodeString(bundle.Signature)
+	if err != nil {
+		return manifest, nil, util.FmtNewtError(
+			"Bundle descriptor contains malformed signature: %s",
+			err.Error())
+	}
+
+	digest, err := bundleDigest(bundle.Manifest)
+	if err != nil {
+		return manifest, nil, err
+	}
+
+	var match *TrustedKey
+	for i, _ := range keys {
+		if bundleSigVerifies(&keys[i], bundle.SigType, digest, sig) {
+			match = &keys[i]
+			break
+		}
+	}
+	if match == nil {
+		return manifest, nil, util.NewNewtError(
+			"Bundle descriptor is not signed by any trusted key")
+	}
+
+	if err := json.Unmarshal(bundle.Manifest, &manifest); err != nil {
+		return manifest, nil, util.FmtNewtError(
+			"Malformed bundle manifest: %s", err.Error())
+	}
+	if manifest.FormatVersion != BUNDLE_FORMAT_VERSION {
+		return manifest, nil, util.FmtNewtError(
+			"Unsupported bundle format version %d", manifest.FormatVersion)
+	}
+
+	return manifest, match, nil
+}
@@ -0,0 +1,114 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBundle(t *testing.T) {
+	dir, keyPath, _ := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	imgPaths := []string{
+		testImageFromBin(t, dir, "a.img", []byte("first image")),
+		testImageFromBin(t, dir, "b.img", bytes.Repeat([]byte{1}, 300)),
+	}
+
+	otherPath := filepath.Join(dir, "other.pem")
+	testWriteEcKey(t, otherPath)
+	trusted, err := LoadTrustStore([]string{otherPath, keyPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	untrusted, err := LoadTrustStore([]string{otherPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := CreateBundle(imgPaths, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The signature survives reformatting of the descriptor.
+	reformatted := &bytes.Buffer{}
+	if err := json.Indent(reformatted, data, "", "\t"); err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := bytes.Replace(data, []byte(`"version": "1.2.3.4"`),
+		[]byte(`"version": "1.2.3.5"`), 1)
+	if bytes.Equal(tampered, data) {
+		t.Fatalf("bundle manifest does not contain image version")
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		keys    []TrustedKey
+		wantErr bool
+	}{
+		{"trusted", data, trusted, false},
+		{"reformatted", reformatted.Bytes(), trusted, false},
+		{"untrusted", data, untrusted, true},
+		{"tampered", tampered, trusted, true},
+		{"malformed", []byte("{"), trusted, true},
+	}
+
+	for _, test := range tests {
+		manifest, key, err := VerifyBundle(test.data, test.keys)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+
+		if key.Name != keyPath {
+			t.Errorf("%s: verified by %s; want %s", test.name, key.Name,
+				keyPath)
+		}
+		if len(manifest.Images) != len(imgPaths) {
+			t.Errorf("%s: manifest lists %d images; want %d", test.name,
+				len(manifest.Images), len(imgPaths))
+			continue
+		}
+		for i, imgPath := range imgPaths {
+			img := manifest.Images[i]
+			want, err := readBundleImage(imgPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img != want {
+				t.Errorf("%s: image %d is %+v; want %+v", test.name, i,
+					img, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"time"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// The result of verifying an image against a certificate chain.
+type ChainResult struct {
+	// The certificate whose key signed the image.
+	Leaf *x509.Certificate
+
+	// The validated chain, from the leaf to the root CA.
+	Chain []*x509.Certificate
+}
+
+// Produces a readable name for a certificate: its common name, or its full
+// subject if it lacks one.
+func CertName(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	return cert.Subject.String()
+}
+
+// Reads every certificate from a PEM file, in file order.  Blocks other than
+// certificates are ignored.
+func ReadCertFile(path string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, util.FmtNewtError("Invalid certificate in %s: %s",
+				path, err.Error())
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, util.FmtNewtError("File %s contains no certificates",
+			path)
+	}
+
+	return certs, nil
+}
+
+// Ensures each CA certificate in a validated chain may sign certificates.
+// Certificates without a key usage extension are unrestricted.
+func checkChainUsage(chain []*x509.Certificate) error {
+	for _, cert := range chain[1:] {
+		if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+			return util.FmtNewtError(
+				"Certificate \"%s\" is not permitted to sign certificates",
+				CertName(cert))
+		}
+	}
+
+	return nil
+}
+
+// Verifies an image against a certificate chain anchored at a trusted root
+// CA.  The chain file contains the leaf certificate first, followed by any
+// intermediate CAs; the root files contain the trusted roots.  Each
+// certificate must be valid at the specified time and permitted for its use:
+// the leaf for digital signatures (and code signing, if it restricts its
+// extended usage), and every CA for certificate signing.  Finally, the leaf's
+// key must verify the image signature.
+func VerifyImageChain(imgPath string, chainPath string, rootPaths []string,
+	now time.Time) (ChainResult, error) {
+
+	result := ChainResult{}
+
+	chainCerts, err := ReadCertFile(chainPath)
+	if err != nil {
+		return result, err
+	}
+
+	if len(rootPaths) == 0 {
+		return result, util.NewNewtError("No root CA certificates specified")
+	}
+
+	roots := x509.NewCertPool()
+	for _, path := range rootPaths {
+		certs, err := ReadCertFile(path)
+		if err != nil {
+			return result, err
+		}
+		for _, cert := range certs {
+			roots.AddCert(cert)
+		}
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range chainCerts[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	leaf := chainCerts[0]
+	if leaf.KeyUsage != 0 &&
+		leaf.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+
+		return result, util.FmtNewtError(
+			"Certificate \"%s\" is not permitted to sign",
+			CertName(leaf))
+	}
+
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return result, util.FmtNewtError(
+			"Certificate chain %s does not validate: %s",
+			chainPath, err.Error())
+	}
+
+	var usageErr error
+	for _, chain := range chains {
+		if usageErr = checkChainUsage(chain); usageErr == nil {
+			result.Chain = chain
+			break
+		}
+	}
+	if result.Chain == nil {
+		return result, usageErr
+	}
+
+	key := TrustedKey{
+		Name: CertName(leaf),
+	}
+	switch pub := leaf.PublicKey.(type) {
+	case *rsa.PublicKey:
+		key.RSA = pub
+	case *ecdsa.PublicKey:
+		key.EC = pub
+	default:
+		return result, util.FmtNewtError(
+			"Certificate \"%s\" has an unsupported key type", key.Name)
+	}
+
+	if _, err := VerifyImage(imgPath, []TrustedKey{key}); err != nil {
+		return result, err
+	}
+
+	result.Leaf = leaf
+	return result, nil
+}
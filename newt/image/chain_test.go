@@ -0,0 +1,197 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testCertStart = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Creates a certificate for pub, valid for one year from testCertStart.  If
+// parent is nil, the certificate is self-signed by key.
+func testCert(t *testing.T, name string, isCA bool, usage x509.KeyUsage,
+	pub interface{}, parent *x509.Certificate,
+	key *ecdsa.PrivateKey) *x509.Certificate {
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             testCertStart,
+		NotAfter:              testCertStart.AddDate(1, 0, 0),
+		KeyUsage:              usage,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if !isCA {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+	}
+	if parent == nil {
+		parent = tmpl
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func testWriteCerts(t *testing.T, path string, certs ...*x509.Certificate) {
+	data := []byte{}
+	for _, cert := range certs {
+		data = append(data, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: cert.Raw,
+		})...)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testCaKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestVerifyImageChain(t *testing.T) {
+	dir, _, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	signerPath := filepath.Join(dir, "signer.pem")
+	signer := testWriteEcKey(t, signerPath)
+	otherPath := filepath.Join(dir, "other.pem")
+	other := testWriteEcKey(t, otherPath)
+
+	const caUsage = x509.KeyUsageCertSign
+	const leafUsage = x509.KeyUsageDigitalSignature
+
+	rootKey := testCaKey(t)
+	root := testCert(t, "root", true, caUsage, &rootKey.PublicKey, nil,
+		rootKey)
+	interKey := testCaKey(t)
+	inter := testCert(t, "intermediate", true, caUsage, &interKey.PublicKey,
+		root, rootKey)
+	badInter := testCert(t, "no-certsign", true, leafUsage,
+		&interKey.PublicKey, root, rootKey)
+	leaf := testCert(t, "signer", false, leafUsage, &signer.PublicKey,
+		inter, interKey)
+	badLeaf := testCert(t, "signer", false, leafUsage, &signer.PublicKey,
+		badInter, interKey)
+	otherLeaf := testCert(t, "other", false, leafUsage, &other.PublicKey,
+		inter, interKey)
+	encLeaf := testCert(t, "encipher", false, x509.KeyUsageKeyEncipherment,
+		&signer.PublicKey, inter, interKey)
+
+	strayKey := testCaKey(t)
+	stray := testCert(t, "stray", true, caUsage, &strayKey.PublicKey, nil,
+		strayKey)
+
+	rootPath := filepath.Join(dir, "root.pem")
+	testWriteCerts(t, rootPath, root)
+	strayPath := filepath.Join(dir, "stray.pem")
+	testWriteCerts(t, strayPath, stray)
+
+	imgPath := testBuildImage(t, dir, binPath, func(img *Image) {
+		if err := img.SetSigningKey(signerPath, 0); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	valid := testCertStart.AddDate(0, 6, 0)
+
+	tests := []struct {
+		name    string
+		chain   []*x509.Certificate
+		root    string
+		now     time.Time
+		wantErr string // Expected error substring; "" if none.
+	}{
+		{"valid", []*x509.Certificate{leaf, inter}, rootPath, valid, ""},
+		{"expired", []*x509.Certificate{leaf, inter}, rootPath,
+			testCertStart.AddDate(2, 0, 0), "does not validate"},
+		{"untrusted root", []*x509.Certificate{leaf, inter}, strayPath,
+			valid, "does not validate"},
+		{"missing intermediate", []*x509.Certificate{leaf}, rootPath,
+			valid, "does not validate"},
+		{"intermediate cannot sign certificates",
+			[]*x509.Certificate{badLeaf, badInter}, rootPath, valid,
+			"no-certsign"},
+		{"leaf cannot sign",
+			[]*x509.Certificate{encLeaf, inter}, rootPath, valid,
+			"\"encipher\" is not permitted to sign"},
+		{"leaf did not sign image",
+			[]*x509.Certificate{otherLeaf, inter}, rootPath, valid,
+			"is not signed by any trusted key"},
+	}
+
+	chainPath := filepath.Join(dir, "chain.pem")
+	for _, test := range tests {
+		testWriteCerts(t, chainPath, test.chain...)
+
+		result, err := VerifyImageChain(imgPath, chainPath,
+			[]string{test.root}, test.now)
+		if test.wantErr != "" {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			} else if !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error \"%s\" does not contain \"%s\"",
+					test.name, err.Error(), test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+
+		names := []string{}
+		for _, cert := range result.Chain {
+			names = append(names, CertName(cert))
+		}
+		if CertName(result.Leaf) != "signer" ||
+			strings.Join(names, " ") != "signer intermediate root" {
+
+			t.Errorf("%s: leaf %s, chain %v", test.name,
+				CertName(result.Leaf), names)
+		}
+	}
+}
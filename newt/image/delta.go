@@ -0,0 +1,307 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/fnv"
+	"io/ioutil"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// A delta image transforms one image file (the source) into another (the
+// target).  It consists of a header followed by a sequence of operations:
+//
+// <Header>
+//   Magic (0x8149da5f)                       uint32
+//   Header size                              uint16
+//   Padding (0xffff)                         uint16
+//   Source version                           8 bytes
+//   Target version                           8 bytes
+//   Source file size                         uint32
+//   Target file size                         uint32
+//   Source image hash                        32 bytes
+//   Target image hash                        32 bytes
+//
+// <Operations>
+//   Copy:  type (0x01), source offset (uint32), length (uint32)
+//   Data:  type (0x02), length (uint32), length bytes of literal data
+//
+// The operations are applied in order, each appending to the target.  A
+// device must only apply a delta to a slot whose image hash matches the
+// header's source hash.  All integers are little endian.
+
+const DELTA_MAGIC = 0x8149da5f
+
+const (
+	DELTA_OP_COPY = 0x01
+	DELTA_OP_DATA = 0x02
+)
+
+// The smallest run of matching bytes worth encoding as a copy.
+const deltaMinMatch = 16
+
+type DeltaHdr struct {
+	Magic   uint32
+	HdrSz   uint16
+	Pad     uint16
+	SrcVers ImageVersion
+	DstVers ImageVersion
+	SrcSz   uint32
+	DstSz   uint32
+	SrcHash [32]byte
+	DstHash [32]byte
+}
+
+func deltaBlockHash(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
+
+type deltaEncoder struct {
+	buf     *bytes.Buffer
+	literal []byte
+}
+
+func (enc *deltaEncoder) flushLiteral() {
+	if len(enc.literal) == 0 {
+		return
+	}
+
+	enc.buf.WriteByte(DELTA_OP_DATA)
+	binary.Write(enc.buf, binary.LittleEndian, uint32(len(enc.literal)))
+	enc.buf.Write(enc.literal)
+	enc.literal = nil
+}
+
+func (enc *deltaEncoder) copyOp(srcOff int, length int) {
+	enc.flushLiteral()
+
+	enc.buf.WriteByte(DELTA_OP_COPY)
+	binary.Write(enc.buf, binary.LittleEndian, uint32(srcOff))
+	binary.Write(enc.buf, binary.LittleEndian, uint32(length))
+}
+
+func matchLen(src []byte, srcOff int, dst []byte, dstOff int) int {
+	n := 0
+	for srcOff+n < len(src) && dstOff+n < len(dst) &&
+		src[srcOff+n] == dst[dstOff+n] {
+
+		n++
+	}
+	return n
+}
+
+// Calculates the operations that transform src into dst.  Runs of dst found
+// anywhere in src become copies; everything else is sent literally.  A run
+// continuing where the previous copy left off is preferred, since images
+// usually change in place.
+func diffData(src []byte, dst []byte) []byte {
+	index := map[uint64]int{}
+	for i := 0; i+deltaMinMatch <= len(src); i++ {
+		key := deltaBlockHash(src[i : i+deltaMinMatch])
+		if _, ok := index[key]; !ok {
+			index[key] = i
+		}
+	}
+
+	enc := &deltaEncoder{buf: &bytes.Buffer{}}
+	next := 0
+
+	for pos := 0; pos < len(dst); {
+		bestOff := -1
+		bestLen := 0
+
+		if n := matchLen(src, next, dst, pos); n >= deltaMinMatch {
+			bestOff, bestLen = next, n
+		} else if pos+deltaMinMatch <= len(dst) {
+			key := deltaBlockHash(dst[pos : pos+deltaMinMatch])
+			if off, ok := index[key]; ok {
+				if n := matchLen(src, off, dst, pos); n >= deltaMinMatch {
+					bestOff, bestLen = off, n
+				}
+			}
+		}
+
+		if bestOff == -1 {
+			enc.literal = append(enc.literal, dst[pos])
+			pos++
+			next++
+			continue
+		}
+
+		enc.copyOp(bestOff, bestLen)
+		pos += bestLen
+		next = bestOff + bestLen
+	}
+	enc.flushLiteral()
+
+	return enc.buf.Bytes()
+}
+
+// Applies a delta to the source image contents and returns the target image
+// contents.  The sizes of the source and the produced target are checked.
+func ApplyDelta(src []byte, delta []byte) ([]byte, error) {
+	hdr := DeltaHdr{}
+	rd := bytes.NewReader(delta)
+	if err := binary.Read(rd, binary.LittleEndian, &hdr); err != nil {
+		return nil, util.NewNewtError("Delta too small to contain header")
+	}
+	if hdr.Magic != DELTA_MAGIC {
+		return nil, util.FmtNewtError(
+			"Delta has bad magic; expected=0x%08x actual=0x%08x",
+			DELTA_MAGIC, hdr.Magic)
+	}
+	if int(hdr.SrcSz) != len(src) {
+		return nil, util.FmtNewtError(
+			"Delta source size mismatch; delta=%d actual=%d",
+			hdr.SrcSz, len(src))
+	}
+
+	if int(hdr.HdrSz) > len(delta) {
+		return nil, util.FmtNewtError(
+			"Delta truncated; header size=%d delta size=%d",
+			hdr.HdrSz, len(delta))
+	}
+
+	ops := delta[hdr.HdrSz:]
+	dst := []byte{}
+	for off := 0; off < len(ops); {
+		op := ops[off]
+		off++
+
+		switch op {
+		case DELTA_OP_COPY:
+			if off+8 > len(ops) {
+				return nil, util.NewNewtError(
+					"Delta copy operation truncated")
+			}
+			srcOff := int(binary.LittleEndian.Uint32(ops[off:]))
+			length := int(binary.LittleEndian.Uint32(ops[off+4:]))
+			off += 8
+
+			if srcOff+length > len(src) {
+				return nil, util.FmtNewtError(
+					"Delta copy beyond end of source; offset=%d length=%d",
+					srcOff, length)
+			}
+			dst = append(dst, src[srcOff:srcOff+length]...)
+
+		case DELTA_OP_DATA:
+			if off+4 > len(ops) {
+				return nil, util.NewNewtError(
+					"Delta data operation truncated")
+			}
+			length := int(binary.LittleEndian.Uint32(ops[off:]))
+			off += 4
+
+			if off+length > len(ops) {
+				return nil, util.NewNewtError(
+					"Delta data operation truncated")
+			}
+			dst = append(dst, ops[off:off+length]...)
+			off += length
+
+		default:
+			return nil, util.FmtNewtError(
+				"Delta contains unknown operation type %d", op)
+		}
+	}
+
+	if len(dst) != int(hdr.DstSz) {
+		return nil, util.FmtNewtError(
+			"Delta target size mismatch; delta=%d produced=%d",
+			hdr.DstSz, len(dst))
+	}
+
+	return dst, nil
+}
+
+// Creates a delta that transforms the image at srcPath into the image at
+// dstPath.  Both images' hashes are verified first.  If srcHash is non-nil,
+// the source image's hash must match it; this ensures the delta is built
+// against the image actually present on the device.
+func CreateDelta(srcPath string, dstPath string, srcHash []byte) (
+	[]byte, error) {
+
+	src, srcHdr, _, srcHashTlv, err := readVerifiedImage(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	if srcHash != nil && !bytes.Equal(srcHash, srcHashTlv.Data) {
+		return nil, util.FmtNewtError(
+			"Source image %s hash mismatch; expected=%x actual=%x",
+			srcPath, srcHash, srcHashTlv.Data)
+	}
+
+	dst, dstHdr, _, dstHashTlv, err := readVerifiedImage(dstPath)
+	if err != nil {
+		return nil, err
+	}
+
+	hdr := DeltaHdr{
+		Magic:   DELTA_MAGIC,
+		HdrSz:   uint16(binary.Size(DeltaHdr{})),
+		Pad:     0xffff,
+		SrcVers: srcHdr.Vers,
+		DstVers: dstHdr.Vers,
+		SrcSz:   uint32(len(src)),
+		DstSz:   uint32(len(dst)),
+	}
+	copy(hdr.SrcHash[:], srcHashTlv.Data)
+	copy(hdr.DstHash[:], dstHashTlv.Data)
+
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, binary.LittleEndian, hdr); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+	buf.Write(diffData(src, dst))
+
+	// Make sure the delta reproduces the target exactly.
+	check, err := ApplyDelta(src, buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(check, dst) {
+		return nil, util.NewNewtError(
+			"Internal error; delta does not reproduce target image")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Creates a delta between two images and writes it to outPath.
+func WriteDelta(srcPath string, dstPath string, srcHash []byte,
+	outPath string) error {
+
+	delta, err := CreateDelta(srcPath, dstPath, srcHash)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(outPath, delta, 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
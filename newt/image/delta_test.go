@@ -0,0 +1,176 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Generates an image from the specified binary contents and moves it to
+// dir/name.
+func testImageFromBin(t *testing.T, dir string, name string,
+	bin []byte) string {
+
+	binPath := filepath.Join(dir, name+".bin")
+	if err := ioutil.WriteFile(binPath, bin, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	imgPath := filepath.Join(dir, name)
+	if err := os.Rename(testBuildImage(t, dir, binPath, nil),
+		imgPath); err != nil {
+
+		t.Fatal(err)
+	}
+
+	return imgPath
+}
+
+func TestDelta(t *testing.T) {
+	dir, _, _ := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	src := make([]byte, 4096)
+	for i, _ := range src {
+		src[i] = byte(i * 7)
+	}
+
+	modify := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte{}, src...))
+	}
+
+	tests := []struct {
+		name string
+		dst  []byte
+	}{
+		{"identical", src},
+		{"changed in place", modify(func(b []byte) []byte {
+			copy(b[1000:], []byte("patched"))
+			return b
+		})},
+		{"inserted", modify(func(b []byte) []byte {
+			return append(b[:2000], append([]byte("inserted"),
+				b[2000:]...)...)
+		})},
+		{"truncated", src[:3000]},
+		{"unrelated", bytes.Repeat([]byte{0x5a}, 100)},
+	}
+
+	srcPath := testImageFromBin(t, dir, "src.img", src)
+	srcData, err := ioutil.ReadFile(srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		dstPath := testImageFromBin(t, dir, "dst.img", test.dst)
+		dstData, err := ioutil.ReadFile(dstPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		delta, err := CreateDelta(srcPath, dstPath, nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+
+		got, err := ApplyDelta(srcData, delta)
+		if err != nil {
+			t.Errorf("%s: ApplyDelta: unexpected error: %s", test.name,
+				err.Error())
+			continue
+		}
+		if !bytes.Equal(got, dstData) {
+			t.Errorf("%s: delta does not reproduce target", test.name)
+		}
+
+		// A delta against a mostly unchanged source is much smaller than
+		// the target.
+		if test.name != "unrelated" && len(delta) > len(dstData)/4 {
+			t.Errorf("%s: delta size %d; target size %d", test.name,
+				len(delta), len(dstData))
+		}
+
+		// A delta only applies to the source it was built against.
+		if _, err := ApplyDelta(srcData[1:], delta); err == nil {
+			t.Errorf("%s: ApplyDelta to wrong source: expected error",
+				test.name)
+		}
+	}
+}
+
+// A delta is only built against the expected source image.
+func TestDeltaSourceHash(t *testing.T) {
+	dir, _, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	bin, err := ioutil.ReadFile(binPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcPath := testImageFromBin(t, dir, "src.img", bin)
+	dstPath := testImageFromBin(t, dir, "dst.img", bin)
+
+	srcHash, err := CalcImageHash(srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		hash    []byte
+		wantErr bool
+	}{
+		{"no hash", nil, false},
+		{"matching hash", srcHash, false},
+		{"mismatched hash", make([]byte, len(srcHash)), true},
+	}
+
+	for _, test := range tests {
+		_, err := CreateDelta(srcPath, dstPath, test.hash)
+		if test.wantErr && err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+		if !test.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+		}
+	}
+}
+
+func TestApplyDeltaErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		delta []byte
+	}{
+		{"empty", []byte{}},
+		{"bad magic", make([]byte, 100)},
+	}
+
+	for _, test := range tests {
+		if _, err := ApplyDelta(nil, test.delta); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// An image can be prepared for signing by an external, possibly air-gapped,
+// signer.  Its header declares the signature TLV, but the trailer omits it;
+// the image digest is written to a separate file instead.  The signer signs
+// the raw 32-byte digest, and InjectSignature adds the resulting signature
+// TLV to the image.  Since the signature is not covered by the image hash,
+// the digest remains valid.
+
+const DETACHED_SIG_RSA2048 = "rsa2048"
+const DETACHED_SIG_ECDSA224 = "ecdsa224"
+
+var detachedSigTypes = map[string]uint8{
+	DETACHED_SIG_RSA2048:  IMAGE_TLV_RSA2048,
+	DETACHED_SIG_ECDSA224: IMAGE_TLV_ECDSA224,
+}
+
+// The size of a signature TLV's data.  An ECDSA signature is ASN.1 encoded
+// and zero-padded to this size.
+func sigTlvSize(typ uint8) int {
+	switch typ {
+	case IMAGE_TLV_RSA2048:
+		return 256
+	case IMAGE_TLV_ECDSA224:
+		return 68
+	default:
+		return 0
+	}
+}
+
+// Converts the name of a detached signature algorithm ("rsa2048" or
+// "ecdsa224") to the corresponding signature TLV type.
+func ParseDetachedSigType(name string) (uint8, error) {
+	typ, ok := detachedSigTypes[strings.ToLower(name)]
+	if !ok {
+		return 0, util.FmtNewtError(
+			"Invalid detached signature type: \"%s\"; must be %s or %s",
+			name, DETACHED_SIG_RSA2048, DETACHED_SIG_ECDSA224)
+	}
+
+	return typ, nil
+}
+
+// Returns the path of the file that receives the digest of an image prepared
+// for detached signing.
+func DigestPath(imgPath string) string {
+	return imgPath + ".digest"
+}
+
+// Determines the signature TLV type that an image header declares, or 0 if
+// the image is unsigned.
+func hdrSigType(hdr ImageHdr) uint8 {
+	switch {
+	case hdr.Flags&IMAGE_F_PKCS15_RSA2048_SHA256 != 0:
+		return IMAGE_TLV_RSA2048
+	case hdr.Flags&IMAGE_F_ECDSA224_SHA256 != 0:
+		return IMAGE_TLV_ECDSA224
+	default:
+		return 0
+	}
+}
+
+// Checks an externally produced signature and converts it to the contents
+// of a signature TLV of the specified type.  An RSA signature must be exactly
+// 256 bytes; an ECDSA signature must be a single ASN.1 sequence of two
+// integers that fits in 68 bytes.
+func detachedSigTlvData(typ uint8, sig []byte) ([]byte, error) {
+	size := sigTlvSize(typ)
+
+	switch typ {
+	case IMAGE_TLV_RSA2048:
+		if len(sig) != size {
+			return nil, util.FmtNewtError(
+				"Invalid RSA2048 signature; must be %d bytes, is %d",
+				size, len(sig))
+		}
+		return sig, nil
+
+	case IMAGE_TLV_ECDSA224:
+		var ecSig ECDSASig
+		rest, err := asn1.Unmarshal(sig, &ecSig)
+		if err != nil || len(rest) != 0 {
+			return nil, util.NewNewtError(
+				"Invalid ECDSA224 signature; must be an ASN.1-encoded " +
+					"(r, s) pair")
+		}
+		if len(sig) > size {
+			return nil, util.FmtNewtError(
+				"Invalid ECDSA224 signature; must be at most %d bytes, is %d",
+				size, len(sig))
+		}
+
+		data := make([]byte, size)
+		copy(data, sig)
+		return data, nil
+
+	default:
+		return nil, util.FmtNewtError(
+			"Unsupported signature TLV type: %d", typ)
+	}
+}
+
+// Adds an externally produced signature to an image that was prepared for
+// detached signing.  The signature file contains the raw signature of the
+// image digest, in the format the algorithm declared by the image header
+// requires.  The image file is rewritten in place.
+func InjectSignature(imgPath string, sigPath string) error {
+	sig, err := ioutil.ReadFile(sigPath)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return injectSignatureData(imgPath, sig, "Signature file "+sigPath)
+}
+
+// An image that was prepared for detached signing and not yet signed.
+type detachedImage struct {
+	hdr     ImageHdr
+	sigType uint8
+	hash    []byte // Contents of the hash TLV; this is what gets signed.
+
+	// Offset within the file where the signature TLV gets inserted.
+	insertOff int
+}
+
+// Parses the contents of an image file that is awaiting a detached
+// signature.
+func parseDetachedImage(imgPath string, data []byte) (detachedImage, error) {
+	di := detachedImage{}
+
+	hdr, _, trailer, err := parseImage(imgPath, data)
+	if err != nil {
+		return di, err
+	}
+
+	sigType := hdrSigType(hdr)
+	if sigType == 0 {
+		return di, util.FmtNewtError(
+			"Image %s header does not declare a signature", imgPath)
+	}
+	sigSz := sigTlvSize(sigType)
+
+	// Any erased bytes beyond the unsigned trailer are a trailer reserve;
+	// they remain at the end of the file.
+	tlvHdrSz := binary.Size(ImageTrailerTlv{})
+	reserve := len(trailer) + tlvHdrSz + sigSz - int(hdr.TlvSz)
+	if reserve < 0 || !bytes.Equal(trailer[len(trailer)-reserve:],
+		bytes.Repeat([]byte{0xff}, reserve)) {
+
+		return di, util.FmtNewtError(
+			"Image %s trailer size mismatch; header specifies %d bytes, "+
+				"file contains %d; image already signed or not prepared "+
+				"for detached signing", imgPath, hdr.TlvSz, len(trailer))
+	}
+
+	// The signature immediately follows the hash TLV, which comes first.
+	hashTlv := ImageTrailerTlv{}
+	err = binary.Read(bytes.NewReader(trailer), binary.LittleEndian, &hashTlv)
+	if err != nil || hashTlv.Type != IMAGE_TLV_SHA256 ||
+		tlvHdrSz+int(hashTlv.Len) > len(trailer) {
+
+		return di, util.FmtNewtError(
+			"Image %s trailer does not begin with a hash TLV", imgPath)
+	}
+
+	di.hdr = hdr
+	di.sigType = sigType
+	di.hash = trailer[tlvHdrSz : tlvHdrSz+int(hashTlv.Len)]
+	di.insertOff = len(data) - len(trailer) + tlvHdrSz + int(hashTlv.Len)
+
+	return di, nil
+}
+
+// Adds the specified raw signature to an image prepared for detached
+// signing.  sigDesc identifies the signature's origin in error messages.
+func injectSignatureData(imgPath string, sig []byte, sigDesc string) error {
+	data, err := ioutil.ReadFile(imgPath)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	di, err := parseDetachedImage(imgPath, data)
+	if err != nil {
+		return err
+	}
+
+	sigData, err := detachedSigTlvData(di.sigType, sig)
+	if err != nil {
+		return util.PreNewtError(err, "%s", sigDesc)
+	}
+
+	buf := &bytes.Buffer{}
+	buf.Write(data[:di.insertOff])
+	binary.Write(buf, binary.LittleEndian, ImageTrailerTlv{
+		Type: di.sigType,
+		Pad:  0,
+		Len:  uint16(sigTlvSize(di.sigType)),
+	})
+	buf.Write(sigData)
+	buf.Write(data[di.insertOff:])
+
+	if err := ioutil.WriteFile(imgPath, buf.Bytes(), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/asn1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseDetachedSigType(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint8
+		wantErr bool
+	}{
+		{"rsa2048", IMAGE_TLV_RSA2048, false},
+		{"ECDSA224", IMAGE_TLV_ECDSA224, false},
+		{"ecdsa256", 0, true},
+		{"", 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseDetachedSigType(test.in)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseDetachedSigType(%q): expected error", test.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDetachedSigType(%q): unexpected error: %s",
+				test.in, err.Error())
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseDetachedSigType(%q) = %d; want %d", test.in, got,
+				test.want)
+		}
+	}
+}
+
+// Signs a digest with an EC key, as an external signer would.
+func testSignDigest(t *testing.T, key *ecdsa.PrivateKey,
+	digest []byte) []byte {
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := asn1.Marshal(ECDSASig{R: r, S: s})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sig
+}
+
+// An image prepared for detached signing verifies once the external
+// signature is injected.
+func TestInjectSignature(t *testing.T) {
+	dir, _, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	keyPath := filepath.Join(dir, "signer.pem")
+	key := testWriteEcKey(t, keyPath)
+	keys, err := LoadTrustStore([]string{keyPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sigPath := filepath.Join(dir, "app.sig")
+
+	for _, reserve := range []int{0, 64} {
+		var digestPath string
+		imgPath := testBuildImage(t, dir, binPath, func(img *Image) {
+			img.DetachedSigType = IMAGE_TLV_ECDSA224
+			img.DigestPath = DigestPath(img.TargetImg)
+			img.TrailerReserve = reserve
+			digestPath = img.DigestPath
+		})
+
+		if _, err := VerifyImage(imgPath, keys); err == nil {
+			t.Errorf("reserve %d: unsigned image verified", reserve)
+		}
+
+		digest, err := ioutil.ReadFile(digestPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A malformed signature is rejected.
+		if err := ioutil.WriteFile(sigPath, []byte("garbage"),
+			0644); err != nil {
+
+			t.Fatal(err)
+		}
+		if err := InjectSignature(imgPath, sigPath); err == nil {
+			t.Errorf("reserve %d: malformed signature injected", reserve)
+		}
+
+		sig := testSignDigest(t, key, digest)
+		if err := ioutil.WriteFile(sigPath, sig, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := InjectSignature(imgPath, sigPath); err != nil {
+			t.Errorf("reserve %d: unexpected error: %s", reserve,
+				err.Error())
+			continue
+		}
+
+		if _, err := VerifyImage(imgPath, keys); err != nil {
+			t.Errorf("reserve %d: signed image does not verify: %s",
+				reserve, err.Error())
+		}
+		fit, err := ReadImageFit(imgPath, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fit.ReserveSize != reserve {
+			t.Errorf("reserve %d: reserve is %d after signing", reserve,
+				fit.ReserveSize)
+		}
+
+		// An image can only be signed once.
+		if err := InjectSignature(imgPath, sigPath); err == nil {
+			t.Errorf("reserve %d: signature injected twice", reserve)
+		}
+	}
+}
+
+// An image whose header does not declare a signature cannot be signed.
+func TestInjectSignatureUnsigned(t *testing.T) {
+	dir, _, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	imgPath := testBuildImage(t, dir, binPath, nil)
+	sigPath := filepath.Join(dir, "app.sig")
+	if err := ioutil.WriteFile(sigPath, make([]byte, 256), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := InjectSignature(imgPath, sigPath); err == nil {
+		t.Errorf("signature injected into image without declared signature")
+	}
+}
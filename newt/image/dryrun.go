@@ -0,0 +1,76 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io/ioutil"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// The digest that signing an image covers, and where it lives in the image
+// file.  Offsets are relative to the start of the file, so they include any
+// header offset.
+type SigningDigest struct {
+	Digest []byte
+
+	// The range of the image file that the digest covers: the header and the
+	// payload.  For the app half of a split image, the loader's hash is
+	// prepended to this range when hashing.
+	Offset int
+	Size   int
+
+	// Location of the digest itself, in the data of the hash TLV.
+	HashOffset int
+}
+
+// Calculates the digest that Generate would sign, without writing the image
+// file.  The image's version, key, and trailer settings must already be
+// configured, since they are recorded in the hashed header.
+func (image *Image) SigningDigest(loader *Image) (SigningDigest, error) {
+	bin, err := ioutil.ReadFile(image.SourceBin)
+	if err != nil {
+		return SigningDigest{}, util.NewNewtError(
+			"Can't read app binary: " + err.Error())
+	}
+
+	hdr, err := image.makeHeader(uint32(len(bin)), loader)
+	if err != nil {
+		return SigningDigest{}, err
+	}
+
+	hash := sha256.New()
+	if loader != nil {
+		binary.Write(hash, binary.LittleEndian, loader.Hash)
+	}
+	binary.Write(hash, binary.LittleEndian, hdr)
+	hash.Write(bin)
+
+	size := int(hdr.HdrSz) + len(bin)
+
+	return SigningDigest{
+		Digest:     hash.Sum(nil),
+		Offset:     image.HeaderOffset,
+		Size:       size,
+		HashOffset: image.HeaderOffset + size + binary.Size(ImageTrailerTlv{}),
+	}, nil
+}
@@ -0,0 +1,95 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The dry-run digest is the one the generated image records and signs.
+func TestSigningDigest(t *testing.T) {
+	dir, keyPath, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		headerOffset int
+		signed       bool
+	}{
+		{0, false},
+		{0, true},
+		{0x20, true},
+	}
+
+	for _, test := range tests {
+		imgPath := filepath.Join(dir, "dryrun.img")
+		img, err := NewImage(binPath, imgPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := img.SetVersion("1.2.3.4"); err != nil {
+			t.Fatal(err)
+		}
+		if test.signed {
+			if err := img.SetSigningKey(keyPath, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		img.HeaderOffset = test.headerOffset
+
+		sd, err := img.SigningDigest(nil)
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %s", test, err.Error())
+			continue
+		}
+
+		// A dry run does not write the image.
+		if _, err := os.Stat(imgPath); !os.IsNotExist(err) {
+			t.Errorf("%+v: dry run wrote image file", test)
+		}
+
+		if err := img.Generate(nil); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(imgPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(imgPath)
+
+		if sd.Offset != test.headerOffset {
+			t.Errorf("%+v: digest offset %d", test, sd.Offset)
+		}
+		hash := sha256.Sum256(data[sd.Offset : sd.Offset+sd.Size])
+		if !bytes.Equal(hash[:], sd.Digest) {
+			t.Errorf("%+v: digest %x does not cover [%d, %d)", test,
+				sd.Digest, sd.Offset, sd.Offset+sd.Size)
+		}
+		recorded := data[sd.HashOffset : sd.HashOffset+len(sd.Digest)]
+		if !bytes.Equal(recorded, sd.Digest) {
+			t.Errorf("%+v: hash TLV records %x; want %x", test, recorded,
+				sd.Digest)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"io/ioutil"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// The space that an image file occupies in its slot.
+type ImageFit struct {
+	// The image header and any padding preceding it.
+	HeaderSize int
+
+	PayloadSize int
+
+	// The TLVs following the payload, including any signature.
+	TrailerSize int
+
+	// Bytes following the trailer that are reserved for TLVs added later.
+	ReserveSize int
+}
+
+func (fit ImageFit) Size() int {
+	return fit.HeaderSize + fit.PayloadSize + fit.TrailerSize + fit.ReserveSize
+}
+
+// Determines the space that an image file occupies.  headerOffset is the
+// number of bytes that precede the image header in the file.
+func ReadImageFit(imgPath string, headerOffset int) (ImageFit, error) {
+	data, err := ioutil.ReadFile(imgPath)
+	if err != nil {
+		return ImageFit{}, util.ChildNewtError(err)
+	}
+
+	if headerOffset < 0 || headerOffset > len(data) {
+		return ImageFit{}, util.FmtNewtError(
+			"Image %s too small to contain header at offset 0x%x",
+			imgPath, headerOffset)
+	}
+
+	hdr, _, trailer, err := parseImage(imgPath, data[headerOffset:])
+	if err != nil {
+		return ImageFit{}, err
+	}
+
+	return ImageFit{
+		HeaderSize:  headerOffset + int(hdr.HdrSz),
+		PayloadSize: int(hdr.ImgSz),
+		TrailerSize: int(hdr.TlvSz),
+		ReserveSize: util.IntMax(len(trailer)-int(hdr.TlvSz), 0),
+	}, nil
+}
+
+// Ensures an image fits in the specified slot.  The error distinguishes an
+// image whose payload fits but whose trailer does not; the slot must hold the
+// trailer and any trailer reserve as well.
+func (fit ImageFit) CheckSlot(imgPath string, slotName string,
+	slotSize int) error {
+
+	overflow := fit.Size() - slotSize
+	if overflow <= 0 {
+		return nil
+	}
+
+	if fit.HeaderSize+fit.PayloadSize <= slotSize {
+		return util.FmtNewtError(
+			"Image %s does not fit in %s; the payload fits, but the "+
+				"trailer (%d bytes, %d reserved) overflows the slot by %d "+
+				"bytes; header=%d payload=%d trailer=%d reserve=%d "+
+				"slot-size=%d",
+			imgPath, slotName, fit.TrailerSize+fit.ReserveSize,
+			fit.ReserveSize, overflow, fit.HeaderSize, fit.PayloadSize,
+			fit.TrailerSize, fit.ReserveSize, slotSize)
+	}
+
+	return util.FmtNewtError(
+		"Image %s is too large to fit in %s; header=%d payload=%d "+
+			"trailer=%d reserve=%d slot-size=%d overflow=%d",
+		imgPath, slotName, fit.HeaderSize, fit.PayloadSize, fit.TrailerSize,
+		fit.ReserveSize, slotSize, overflow)
+}
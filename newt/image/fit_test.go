@@ -0,0 +1,132 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCheckSlot(t *testing.T) {
+	fit := ImageFit{
+		HeaderSize:  32,
+		PayloadSize: 1000,
+		TrailerSize: 40,
+		ReserveSize: 8,
+	}
+
+	tests := []struct {
+		slotSize int
+		wantErr  string // Expected error substring; "" if the image fits.
+	}{
+		{2000, ""},
+		{1080, ""},
+		{1079, "the payload fits, but the trailer (48 bytes, 8 reserved) " +
+			"overflows the slot by 1 bytes"},
+		{1032, "the payload fits, but the trailer"},
+		{1031, "is too large to fit in FLASH_AREA_IMAGE_0"},
+	}
+
+	for _, test := range tests {
+		err := fit.CheckSlot("app.img", "FLASH_AREA_IMAGE_0", test.slotSize)
+		if test.wantErr == "" {
+			if err != nil {
+				t.Errorf("slot size %d: unexpected error: %s",
+					test.slotSize, err.Error())
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Errorf("slot size %d: expected error", test.slotSize)
+		} else if !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("slot size %d: error \"%s\" does not contain \"%s\"",
+				test.slotSize, err.Error(), test.wantErr)
+		}
+	}
+}
+
+// The trailer reserve is appended as erased flash and counted by the slot-fit
+// check, but not hashed or included in the header's TLV size.
+func TestTrailerReserve(t *testing.T) {
+	dir, _, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	basePath := testBuildImage(t, dir, binPath, nil)
+	base, err := ReadImageFit(basePath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseHash, err := CalcImageHash(basePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, reserve := range []int{0, 1, 256} {
+		imgPath := testBuildImage(t, dir, binPath, func(img *Image) {
+			img.TrailerReserve = reserve
+		})
+
+		fit, err := ReadImageFit(imgPath, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fit.ReserveSize != reserve {
+			t.Errorf("reserve %d: ReserveSize=%d", reserve, fit.ReserveSize)
+		}
+		if fit.PayloadSize != base.PayloadSize {
+			t.Errorf("reserve %d: PayloadSize=%d; want %d", reserve,
+				fit.PayloadSize, base.PayloadSize)
+		}
+
+		data, err := ioutil.ReadFile(imgPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != fit.Size() {
+			t.Errorf("reserve %d: file size %d; fit size %d", reserve,
+				len(data), fit.Size())
+		}
+		pad := data[len(data)-reserve:]
+		if !bytes.Equal(pad, bytes.Repeat([]byte{0xff}, reserve)) {
+			t.Errorf("reserve %d: reserve not erased", reserve)
+		}
+
+		hash, err := CalcImageHash(imgPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(hash, baseHash) {
+			t.Errorf("reserve %d: reserve changed the image hash", reserve)
+		}
+
+		// A slot that holds the image without its reserve is too small.
+		if reserve > 0 {
+			if err := fit.CheckSlot(imgPath, "FLASH_AREA_IMAGE_0",
+				fit.Size()-1); err == nil {
+
+				t.Errorf("reserve %d: expected slot overflow", reserve)
+			}
+		}
+	}
+}
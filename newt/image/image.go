@@ -61,6 +61,199 @@ type Image struct {
 	SigningEC  *ecdsa.PrivateKey
 	KeyId      uint8
 	Hash       []byte
+
+	// If non-nil, the image is signed by a PKCS#11 token rather than with a
+	// key held in memory.
+	SigningToken *Pkcs11Key
+
+	// If non-zero, the image is prepared for detached signing with a
+	// signature TLV of this type; the image digest is written to DigestPath
+	// rather than being signed.
+	DetachedSigType uint8
+	DigestPath      string
+
+	// If non-empty, recorded in a trailer TLV to identify the source
+	// revision.
+	GitDesc string
+
+	// Components the image requires, each at a minimum version.  Each is
+	// recorded in its own trailer TLV.
+	Dependencies []ImageDependency
+
+	// If non-empty, a hash of the build's resolved syscfg, recorded in a
+	// trailer TLV so that devices can report their configuration.
+	CfgHash []byte
+
+	// Number of bytes preceding the image header in the image file; each is
+	// set to HeaderFill.  The padding is not covered by the image hash.
+	HeaderOffset int
+	HeaderFill   byte
+
+	// Number of erased (0xff) bytes appended after the trailer, reserving
+	// space for TLVs added later.  The reserve is neither hashed nor counted
+	// in the header's TLV size.
+	TrailerReserve int
+
+	// If non-zero, written to the image header in place of IMAGE_MAGIC.
+	// Forked boot loaders may expect a different magic than stock Mynewt.
+	Magic uint32
+}
+
+// A component that an image requires, such as a boot loader, and the
+// component's minimum acceptable version.
+type ImageDependency struct {
+	Name       string
+	MinVersion ImageVersion
+}
+
+func (dep ImageDependency) String() string {
+	return fmt.Sprintf("%s >= %s", dep.Name, dep.MinVersion.String())
+}
+
+// Produces the data of the dependency's TLV.
+func (dep ImageDependency) TlvData() []byte {
+	buf := bytes.Buffer{}
+	binary.Write(&buf, binary.LittleEndian, dep.MinVersion)
+	buf.WriteString(dep.Name)
+	return buf.Bytes()
+}
+
+// Interprets the data of an image dependency TLV.
+func ParseDependencyTlv(data []byte) (ImageDependency, error) {
+	dep := ImageDependency{}
+
+	if len(data) <= IMAGE_DEP_VERSION_SZ {
+		return dep, util.FmtNewtError(
+			"Image dependency TLV too short; len=%d", len(data))
+	}
+
+	r := bytes.NewReader(data[:IMAGE_DEP_VERSION_SZ])
+	if err := binary.Read(r, binary.LittleEndian, &dep.MinVersion); err != nil {
+		return dep, util.ChildNewtError(err)
+	}
+	dep.Name = string(data[IMAGE_DEP_VERSION_SZ:])
+
+	return dep, nil
+}
+
+// Converts a map of component names to version strings into a sorted list of
+// image dependencies.
+func ParseDependencies(deps map[string]string) ([]ImageDependency, error) {
+	names := make([]string, 0, len(deps))
+	for name, _ := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := []ImageDependency{}
+	for _, name := range names {
+		if name == "" {
+			return nil, util.NewNewtError(
+				"Image dependency has an empty component name")
+		}
+
+		ver, err := ParseVersion(deps[name])
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"Invalid version for image dependency \"%s\": %s",
+				name, err.Error())
+		}
+
+		dep := ImageDependency{
+			Name:       name,
+			MinVersion: ver,
+		}
+		if len(dep.TlvData()) > 0xffff {
+			return nil, util.FmtNewtError(
+				"Image dependency name too long: %s", name)
+		}
+		result = append(result, dep)
+	}
+
+	return result, nil
+}
+
+// Extracts the dependencies from a set of image TLVs.
+func TlvDependencies(tlvs []ImageTlv) ([]ImageDependency, error) {
+	deps := []ImageDependency{}
+	for _, tlv := range tlvs {
+		if tlv.Header.Type != IMAGE_TLV_DEP {
+			continue
+		}
+
+		dep, err := ParseDependencyTlv(tlv.Data)
+		if err != nil {
+			return nil, err
+		}
+		deps = append(deps, dep)
+	}
+
+	return deps, nil
+}
+
+// Extracts the configuration hash from a set of image TLVs.  Nil is returned
+// if the image does not contain one.
+func TlvCfgHash(tlvs []ImageTlv) []byte {
+	for _, tlv := range tlvs {
+		if tlv.Header.Type == IMAGE_TLV_CFG_HASH {
+			return tlv.Data
+		}
+	}
+
+	return nil
+}
+
+// Ensures each version TLV in a set of image TLVs records the same version as
+// the image header.  An image without a version TLV is consistent.
+func CheckVersionTlvs(imgPath string, hdr ImageHdr, tlvs []ImageTlv) error {
+	for _, tlv := range tlvs {
+		if tlv.Header.Type != IMAGE_TLV_VERSION {
+			continue
+		}
+
+		if len(tlv.Data) != IMAGE_TLV_VERSION_SZ {
+			return util.FmtNewtError(
+				"Image %s contains malformed version TLV at offset %d; "+
+					"len=%d, expected %d", imgPath, tlv.Offset,
+				len(tlv.Data), IMAGE_TLV_VERSION_SZ)
+		}
+
+		ver := ImageVersion{}
+		if err := binary.Read(bytes.NewReader(tlv.Data), binary.LittleEndian,
+			&ver); err != nil {
+
+			return util.ChildNewtError(err)
+		}
+
+		if ver != hdr.Vers {
+			return util.FmtNewtError(
+				"Image %s version mismatch; header=%s tlv=%s (offset %d)",
+				imgPath, hdr.Vers.String(), ver.String(), tlv.Offset)
+		}
+	}
+
+	return nil
+}
+
+// Reads an image file and ensures its version TLVs, if any, agree with its
+// header.  The header version is returned.
+func CheckImageVersion(imgPath string) (ImageVersion, error) {
+	data, err := ioutil.ReadFile(imgPath)
+	if err != nil {
+		return ImageVersion{}, util.ChildNewtError(err)
+	}
+
+	hdr, _, trailer, err := parseImage(imgPath, data)
+	if err != nil {
+		return ImageVersion{}, err
+	}
+
+	tlvs, err := parseImageTlvs(imgPath, data, hdr, trailer)
+	if err != nil {
+		return hdr.Vers, err
+	}
+
+	return hdr.Vers, CheckVersionTlvs(imgPath, hdr, tlvs)
 }
 
 type ImageHdr struct {
@@ -86,6 +279,26 @@ const (
 	IMAGE_MAGIC = 0x96f3b83c /* Image header magic */
 )
 
+// The header magic that images read by this package must carry.  Images built
+// for a boot loader that uses a custom magic can only be read after this is
+// set accordingly.
+var ExpectedMagic uint32 = IMAGE_MAGIC
+
+// Parses an image header magic specified as a decimal or 0x-prefixed
+// hexadecimal number.  An empty string yields IMAGE_MAGIC.
+func ParseMagic(s string) (uint32, error) {
+	if s == "" {
+		return IMAGE_MAGIC, nil
+	}
+
+	magic, err := strconv.ParseUint(s, 0, 32)
+	if err != nil || magic == 0 {
+		return 0, util.FmtNewtError("Invalid image magic: %s", s)
+	}
+
+	return uint32(magic), nil
+}
+
 const (
 	IMAGE_HEADER_SIZE = 32
 )
@@ -108,8 +321,46 @@ const (
 	IMAGE_TLV_SHA256   = 1
 	IMAGE_TLV_RSA2048  = 2
 	IMAGE_TLV_ECDSA224 = 3
+	IMAGE_TLV_GIT_DESC = 0x40 /* "git describe" string; informational */
+	IMAGE_TLV_DEP      = 0x41 /* Minimum version of a required component */
+	IMAGE_TLV_CFG_HASH = 0x42 /* SHA256 of resolved syscfg; informational */
+	IMAGE_TLV_VERSION  = 0x43 /* Image version; must match the header */
 )
 
+// A version TLV contains a single ImageVersion.  Newt does not write one;
+// external signing and packaging tools may.
+const IMAGE_TLV_VERSION_SZ = 8
+
+// An image dependency TLV contains an ImageVersion followed by the name of the
+// required component.  The name is not null-terminated; its length is implied
+// by the TLV length.
+const IMAGE_DEP_VERSION_SZ = 8
+
+// Describes a TLV type that newt can write to an image trailer.  Size is the
+// fixed length of the TLV data, or -1 if the length varies.
+type TlvCodeDesc struct {
+	Name string
+	Code int
+	Size int
+}
+
+// Returns every image trailer TLV type, ordered by code.
+func TlvCodes() []TlvCodeDesc {
+	return []TlvCodeDesc{
+		{"IMAGE_TLV_SHA256", IMAGE_TLV_SHA256, 32},
+		{"IMAGE_TLV_RSA2048", IMAGE_TLV_RSA2048, 256},
+		{"IMAGE_TLV_ECDSA224", IMAGE_TLV_ECDSA224, 68},
+		{"IMAGE_TLV_GIT_DESC", IMAGE_TLV_GIT_DESC, -1},
+		{"IMAGE_TLV_DEP", IMAGE_TLV_DEP, -1},
+		{"IMAGE_TLV_CFG_HASH", IMAGE_TLV_CFG_HASH, 32},
+		{"IMAGE_TLV_VERSION", IMAGE_TLV_VERSION, IMAGE_TLV_VERSION_SZ},
+	}
+}
+
+// Recorded in place of a "git describe" string if the source directory is not
+// a git repo.
+const GIT_DESC_UNKNOWN = "unknown"
+
 /*
  * Data that's going to go to build manifest file
  */
@@ -125,6 +376,23 @@ type ImageManifest struct {
 	LoaderPkgs []*ImageManifestPkg `json:"loader_pkgs"`
 	TgtVars    []string            `json:"target"`
 	Repos      []ImageManifestRepo `json:"repos"`
+
+	// The flash map the build was linked against.
+	FlashMap []ImageManifestFlashArea `json:"flash_map,omitempty"`
+
+	// Versions of the tools that produced the build, as reported by each
+	// tool when the build was performed.  Empty if a tool reported none.
+	NewtVersion     string `json:"newt_version,omitempty"`
+	CompilerVersion string `json:"compiler_version,omitempty"`
+	LinkerVersion   string `json:"linker_version,omitempty"`
+}
+
+type ImageManifestFlashArea struct {
+	Name   string `json:"name"`
+	Id     int    `json:"id"`
+	Device int    `json:"device"`
+	Offset int    `json:"offset"`
+	Size   int    `json:"size"`
 }
 
 type ImageManifestPkg struct {
@@ -156,59 +424,80 @@ func NewImage(srcBinPath string, dstImgPath string) (*Image, error) {
 	return image, nil
 }
 
-func (image *Image) SetVersion(versStr string) error {
-	var err error
-	var major uint64
-	var minor uint64
-	var rev uint64
-	var buildNum uint64
+// The components of an image version, in order, along with the size of
+// the header field each one occupies.
+var versionFieldNames = []string{"major", "minor", "revision", "build"}
+var versionFieldBits = []int{8, 8, 16, 32}
+
+// Parses a version string of the form major[.minor[.revision[.build]]].
+// Omitted components are zero.  Each component must be a decimal number that
+// fits in its header field; anything else is rejected rather than silently
+// truncated.
+func ParseVersion(versStr string) (ImageVersion, error) {
+	ver := ImageVersion{}
 
 	components := strings.Split(versStr, ".")
-	major, err = strconv.ParseUint(components[0], 10, 8)
-	if err != nil {
-		return util.NewNewtError(fmt.Sprintf("Invalid version string %s",
-			versStr))
+	if len(components) > len(versionFieldNames) {
+		return ver, util.FmtNewtError(
+			"Invalid version string \"%s\"; must be of the form "+
+				"major[.minor[.revision[.build]]]", versStr)
 	}
-	if len(components) > 1 {
-		minor, err = strconv.ParseUint(components[1], 10, 8)
-		if err != nil {
-			return util.NewNewtError(fmt.Sprintf("Invalid version string %s",
-				versStr))
+
+	vals := make([]uint64, len(versionFieldNames))
+	for i, comp := range components {
+		if comp == "" || strings.Trim(comp, "0123456789") != "" {
+			return ver, util.FmtNewtError(
+				"Invalid version string \"%s\"; %s component \"%s\" is "+
+					"not a decimal number", versStr, versionFieldNames[i],
+				comp)
 		}
-	}
-	if len(components) > 2 {
-		rev, err = strconv.ParseUint(components[2], 10, 16)
+
+		val, err := strconv.ParseUint(comp, 10, versionFieldBits[i])
 		if err != nil {
-			return util.NewNewtError(fmt.Sprintf("Invalid version string %s",
-				versStr))
+			return ver, util.FmtNewtError(
+				"Invalid version string \"%s\"; %s component %s exceeds "+
+					"maximum of %d", versStr, versionFieldNames[i], comp,
+				uint64(1)<<uint(versionFieldBits[i])-1)
 		}
+		vals[i] = val
 	}
-	if len(components) > 3 {
-		buildNum, err = strconv.ParseUint(components[3], 10, 32)
-		if err != nil {
-			return util.NewNewtError(fmt.Sprintf("Invalid version string %s",
-				versStr))
-		}
+
+	ver.Major = uint8(vals[0])
+	ver.Minor = uint8(vals[1])
+	ver.Rev = uint16(vals[2])
+	ver.BuildNum = uint32(vals[3])
+
+	return ver, nil
+}
+
+func (image *Image) SetVersion(versStr string) error {
+	ver, err := ParseVersion(versStr)
+	if err != nil {
+		return err
 	}
-	image.Version.Major = uint8(major)
-	image.Version.Minor = uint8(minor)
-	image.Version.Rev = uint16(rev)
-	image.Version.BuildNum = uint32(buildNum)
+
+	image.Version = ver
 	log.Debugf("Assigning version number %d.%d.%d.%d\n",
 		image.Version.Major, image.Version.Minor,
 		image.Version.Rev, image.Version.BuildNum)
 
-	buf := new(bytes.Buffer)
-	err = binary.Write(buf, binary.LittleEndian, image.Version)
-	if err != nil {
-		fmt.Printf("Bombing out\n")
-		return nil
-	}
-
 	return nil
 }
 
+// Specifies the key the image is signed with.  fileName is either the path of
+// a PEM file containing the private key, or a PKCS#11 URI identifying a key
+// held by a token.
 func (image *Image) SetSigningKey(fileName string, keyId uint8) error {
+	if strings.HasPrefix(fileName, PKCS11_URI_PREFIX) {
+		key, err := LoadPkcs11Key(fileName)
+		if err != nil {
+			return err
+		}
+		image.SigningToken = &key
+		image.KeyId = keyId
+		return nil
+	}
+
 	data, err := ioutil.ReadFile(fileName)
 	if err != nil {
 		return util.NewNewtError(fmt.Sprintf("Error reading key file: %s", err))
@@ -247,6 +536,122 @@ func (image *Image) SetSigningKey(fileName string, keyId uint8) error {
 	return nil
 }
 
+func (image *Image) signsRSA() bool {
+	if image.DetachedSigType != 0 {
+		return image.DetachedSigType == IMAGE_TLV_RSA2048
+	}
+	if image.SigningToken != nil {
+		_, ok := image.SigningToken.PublicKey.(*rsa.PublicKey)
+		return ok
+	}
+	return image.SigningRSA != nil
+}
+
+func (image *Image) signsEC() bool {
+	if image.DetachedSigType != 0 {
+		return image.DetachedSigType == IMAGE_TLV_ECDSA224
+	}
+	if image.SigningToken != nil {
+		_, ok := image.SigningToken.PublicKey.(*ecdsa.PublicKey)
+		return ok
+	}
+	return image.SigningEC != nil
+}
+
+func (image *Image) signRSA() ([]byte, error) {
+	if image.SigningToken != nil {
+		return image.SigningToken.signRSA(image.Hash)
+	}
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, image.SigningRSA,
+		crypto.SHA256, image.Hash)
+	if err != nil {
+		return nil, util.NewNewtError(fmt.Sprintf(
+			"Failed to compute signature: %s", err))
+	}
+
+	return signature, nil
+}
+
+// Returns an ASN.1-encoded ECDSA signature of the image hash.
+func (image *Image) signEC() ([]byte, error) {
+	if image.SigningToken != nil {
+		return image.SigningToken.signEC(image.Hash)
+	}
+
+	r, s, err := ecdsa.Sign(rand.Reader, image.SigningEC, image.Hash)
+	if err != nil {
+		return nil, util.NewNewtError(fmt.Sprintf(
+			"Failed to compute signature: %s", err))
+	}
+
+	var ECDSA ECDSASig
+	ECDSA.R = r
+	ECDSA.S = s
+	signature, err := asn1.Marshal(ECDSA)
+	if err != nil {
+		return nil, util.NewNewtError(fmt.Sprintf(
+			"Failed to construct signature: %s", err))
+	}
+
+	return signature, nil
+}
+
+// Constructs the header of the image, whose payload is imgSz bytes long.
+func (image *Image) makeHeader(imgSz uint32, loader *Image) (*ImageHdr, error) {
+	magic := image.Magic
+	if magic == 0 {
+		magic = IMAGE_MAGIC
+	}
+
+	hdr := &ImageHdr{
+		Magic: magic,
+		TlvSz: 0,
+		KeyId: 0,
+		Pad1:  0,
+		HdrSz: IMAGE_HEADER_SIZE,
+		Pad2:  0,
+		ImgSz: imgSz,
+		Flags: 0,
+		Vers:  image.Version,
+		Pad3:  0,
+	}
+
+	if image.signsRSA() {
+		hdr.TlvSz = 4 + 256
+		hdr.Flags = IMAGE_F_PKCS15_RSA2048_SHA256
+		hdr.KeyId = image.KeyId
+	} else if image.signsEC() {
+		hdr.TlvSz = 4 + 68
+		hdr.Flags = IMAGE_F_ECDSA224_SHA256
+		hdr.KeyId = image.KeyId
+	}
+
+	hdr.TlvSz += 4 + 32
+	hdr.Flags |= IMAGE_F_SHA256
+
+	if image.GitDesc != "" {
+		if len(image.GitDesc) > 0xffff {
+			return nil, util.NewNewtError("git describe string too long")
+		}
+		hdr.TlvSz += 4 + uint16(len(image.GitDesc))
+	}
+
+	for _, dep := range image.Dependencies {
+		hdr.TlvSz += 4 + uint16(len(dep.TlvData()))
+	}
+
+	if len(image.CfgHash) > 0 {
+		hdr.TlvSz += 4 + uint16(len(image.CfgHash))
+	}
+
+	if loader != nil {
+		hdr.Flags |= IMAGE_F_NON_BOOTABLE
+	}
+
+	return hdr, nil
+}
+
 func (image *Image) Generate(loader *Image) error {
 	binFile, err := os.Open(image.SourceBin)
 	if err != nil {
@@ -269,6 +674,17 @@ func (image *Image) Generate(loader *Image) error {
 	}
 	defer imgFile.Close()
 
+	/*
+	 * Padding for bootloaders that expect the header at a nonzero offset.
+	 */
+	if image.HeaderOffset > 0 {
+		pad := bytes.Repeat([]byte{image.HeaderFill}, image.HeaderOffset)
+		if _, err := imgFile.Write(pad); err != nil {
+			return util.NewNewtError(fmt.Sprintf("Failed to write to %s: %s",
+				image.TargetImg, err.Error()))
+		}
+	}
+
 	/*
 	 * Compute hash while updating the file.
 	 */
@@ -285,34 +701,9 @@ func (image *Image) Generate(loader *Image) error {
 	/*
 	 * First the header
 	 */
-	hdr := &ImageHdr{
-		Magic: IMAGE_MAGIC,
-		TlvSz: 0,
-		KeyId: 0,
-		Pad1:  0,
-		HdrSz: IMAGE_HEADER_SIZE,
-		Pad2:  0,
-		ImgSz: uint32(binInfo.Size()),
-		Flags: 0,
-		Vers:  image.Version,
-		Pad3:  0,
-	}
-
-	if image.SigningRSA != nil {
-		hdr.TlvSz = 4 + 256
-		hdr.Flags = IMAGE_F_PKCS15_RSA2048_SHA256
-		hdr.KeyId = image.KeyId
-	} else if image.SigningEC != nil {
-		hdr.TlvSz = 4 + 68
-		hdr.Flags = IMAGE_F_ECDSA224_SHA256
-		hdr.KeyId = image.KeyId
-	}
-
-	hdr.TlvSz += 4 + 32
-	hdr.Flags |= IMAGE_F_SHA256
-
-	if loader != nil {
-		hdr.Flags |= IMAGE_F_NON_BOOTABLE
+	hdr, err := image.makeHeader(uint32(binInfo.Size()), loader)
+	if err != nil {
+		return err
 	}
 
 	err = binary.Write(imgFile, binary.LittleEndian, hdr)
@@ -372,7 +763,16 @@ func (image *Image) Generate(loader *Image) error {
 			err.Error()))
 	}
 
-	if image.SigningRSA != nil {
+	if image.DetachedSigType != 0 {
+		/*
+		 * The signature TLV gets added once the digest has been signed.
+		 */
+		err = ioutil.WriteFile(image.DigestPath, image.Hash, 0644)
+		if err != nil {
+			return util.NewNewtError(fmt.Sprintf("Failed to write digest: %s",
+				err.Error()))
+		}
+	} else if image.signsRSA() {
 		/*
 		 * If signing key was set, generate TLV for that.
 		 */
@@ -381,11 +781,9 @@ func (image *Image) Generate(loader *Image) error {
 			Pad:  0,
 			Len:  256, /* 2048 bits */
 		}
-		signature, err := rsa.SignPKCS1v15(rand.Reader, image.SigningRSA,
-			crypto.SHA256, image.Hash)
+		signature, err := image.signRSA()
 		if err != nil {
-			return util.NewNewtError(fmt.Sprintf(
-				"Failed to compute signature: %s", err))
+			return err
 		}
 
 		err = binary.Write(imgFile, binary.LittleEndian, tlv)
@@ -398,21 +796,10 @@ func (image *Image) Generate(loader *Image) error {
 			return util.NewNewtError(fmt.Sprintf("Failed to append sig: %s",
 				err.Error()))
 		}
-	}
-	if image.SigningEC != nil {
-		r, s, err := ecdsa.Sign(rand.Reader, image.SigningEC, image.Hash)
-		if err != nil {
-			return util.NewNewtError(fmt.Sprintf(
-				"Failed to compute signature: %s", err))
-		}
-
-		var ECDSA ECDSASig
-		ECDSA.R = r
-		ECDSA.S = s
-		signature, err := asn1.Marshal(ECDSA)
+	} else if image.signsEC() {
+		signature, err := image.signEC()
 		if err != nil {
-			return util.NewNewtError(fmt.Sprintf(
-				"Failed to construct signature: %s", err))
+			return err
 		}
 		if len(signature) > 68 {
 			return util.NewNewtError(fmt.Sprintf(
@@ -441,12 +828,298 @@ func (image *Image) Generate(loader *Image) error {
 		}
 	}
 
+	if image.GitDesc != "" {
+		tlv := &ImageTrailerTlv{
+			Type: IMAGE_TLV_GIT_DESC,
+			Pad:  0,
+			Len:  uint16(len(image.GitDesc)),
+		}
+		err = binary.Write(imgFile, binary.LittleEndian, tlv)
+		if err != nil {
+			return util.NewNewtError(fmt.Sprintf("Failed to serialize image "+
+				"trailer: %s", err.Error()))
+		}
+		_, err = imgFile.Write([]byte(image.GitDesc))
+		if err != nil {
+			return util.NewNewtError(fmt.Sprintf(
+				"Failed to append git describe string: %s", err.Error()))
+		}
+	}
+
+	for _, dep := range image.Dependencies {
+		data := dep.TlvData()
+		tlv := &ImageTrailerTlv{
+			Type: IMAGE_TLV_DEP,
+			Pad:  0,
+			Len:  uint16(len(data)),
+		}
+		err = binary.Write(imgFile, binary.LittleEndian, tlv)
+		if err != nil {
+			return util.NewNewtError(fmt.Sprintf("Failed to serialize image "+
+				"trailer: %s", err.Error()))
+		}
+		_, err = imgFile.Write(data)
+		if err != nil {
+			return util.NewNewtError(fmt.Sprintf(
+				"Failed to append image dependency: %s", err.Error()))
+		}
+	}
+
+	if len(image.CfgHash) > 0 {
+		tlv := &ImageTrailerTlv{
+			Type: IMAGE_TLV_CFG_HASH,
+			Pad:  0,
+			Len:  uint16(len(image.CfgHash)),
+		}
+		err = binary.Write(imgFile, binary.LittleEndian, tlv)
+		if err != nil {
+			return util.NewNewtError(fmt.Sprintf("Failed to serialize image "+
+				"trailer: %s", err.Error()))
+		}
+		_, err = imgFile.Write(image.CfgHash)
+		if err != nil {
+			return util.NewNewtError(fmt.Sprintf(
+				"Failed to append configuration hash: %s", err.Error()))
+		}
+	}
+
+	if image.TrailerReserve > 0 {
+		pad := bytes.Repeat([]byte{0xff}, image.TrailerReserve)
+		if _, err := imgFile.Write(pad); err != nil {
+			return util.NewNewtError(fmt.Sprintf(
+				"Failed to append trailer reserve: %s", err.Error()))
+		}
+	}
+
 	util.StatusMessage(util.VERBOSITY_VERBOSE,
 		"Computed Hash for image %s as %s \n",
 		image.TargetImg, hex.EncodeToString(image.Hash))
 	return nil
 }
 
+// Reads an image file, returning its header and payload.  The payload
+// consists of the bytes following the header, up to but not including the
+// trailer.
+func ReadImage(imgPath string) (ImageHdr, []byte, error) {
+	data, err := ioutil.ReadFile(imgPath)
+	if err != nil {
+		return ImageHdr{}, nil, util.ChildNewtError(err)
+	}
+
+	hdr, payload, _, err := parseImage(imgPath, data)
+	return hdr, payload, err
+}
+
+// A single TLV from an image trailer.  The data is not interpreted.
+type ImageTlv struct {
+	Header ImageTrailerTlv
+	Offset int // Offset of the TLV header within the image file.
+	Data   []byte
+}
+
+// Reads the TLVs from an image file's trailer.  TLVs of unknown type are
+// included; each TLV is delimited by its length field only.  The image header
+// is located headerOffset bytes into the file.
+func ReadImageTlvs(imgPath string, headerOffset int) ([]ImageTlv, error) {
+	data, err := ioutil.ReadFile(imgPath)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	if headerOffset < 0 || headerOffset > len(data) {
+		return nil, util.FmtNewtError(
+			"Image %s too small to contain header at offset 0x%x",
+			imgPath, headerOffset)
+	}
+
+	hdr, _, trailer, err := parseImage(imgPath, data[headerOffset:])
+	if err != nil {
+		return nil, err
+	}
+
+	return parseImageTlvs(imgPath, data, hdr, trailer)
+}
+
+// Splits an image's trailer into TLVs.
+func parseImageTlvs(imgPath string, data []byte, hdr ImageHdr,
+	trailer []byte) ([]ImageTlv, error) {
+
+	if len(trailer) < int(hdr.TlvSz) {
+		return nil, util.FmtNewtError(
+			"Image %s trailer truncated; header specifies %d bytes, "+
+				"file contains %d", imgPath, hdr.TlvSz, len(trailer))
+	}
+	// Any bytes following the TLVs (e.g., a trailer reserve) are not part
+	// of the trailer.
+	trailerOff := len(data) - len(trailer)
+	trailer = trailer[:hdr.TlvSz]
+
+	tlvs := []ImageTlv{}
+	for off := 0; off < len(trailer); {
+		tlv := ImageTlv{
+			Offset: trailerOff + off,
+		}
+
+		r := bytes.NewReader(trailer[off:])
+		if err := binary.Read(r, binary.LittleEndian, &tlv.Header); err != nil {
+			return nil, util.FmtNewtError(
+				"Image %s contains truncated TLV header at offset %d",
+				imgPath, tlv.Offset)
+		}
+		off += binary.Size(tlv.Header)
+
+		end := off + int(tlv.Header.Len)
+		if end > len(trailer) {
+			return nil, util.FmtNewtError(
+				"Image %s contains truncated TLV at offset %d; "+
+					"type=%d len=%d", imgPath, tlv.Offset, tlv.Header.Type,
+				tlv.Header.Len)
+		}
+		tlv.Data = trailer[off:end]
+		off = end
+
+		tlvs = append(tlvs, tlv)
+	}
+
+	return tlvs, nil
+}
+
+// Ensures an image file's trailer contains a signature TLV (RSA2048 or
+// ECDSA224).  An error is returned if the image is unsigned.  The image
+// header is located headerOffset bytes into the file.
+func RequireSignature(imgPath string, headerOffset int) error {
+	tlvs, err := ReadImageTlvs(imgPath, headerOffset)
+	if err != nil {
+		return err
+	}
+
+	for _, tlv := range tlvs {
+		switch tlv.Header.Type {
+		case IMAGE_TLV_RSA2048, IMAGE_TLV_ECDSA224:
+			return nil
+		}
+	}
+
+	return util.FmtNewtError("Image %s does not contain a signature TLV",
+		imgPath)
+}
+
+// Locates the payload of the image at the start of data.  Returns the
+// payload's start and end offsets, and false if data does not begin with a
+// valid image.
+func PayloadBounds(data []byte) (int, int, bool) {
+	hdr, payload, _, err := parseImage("", data)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	start := int(hdr.HdrSz)
+	return start, start + len(payload), true
+}
+
+// Splits the contents of an image file into header, payload, and the
+// remaining bytes following the payload (the trailer).
+func parseImage(imgPath string, data []byte) (
+	ImageHdr, []byte, []byte, error) {
+
+	return parseImageMagic(imgPath, data, ExpectedMagic)
+}
+
+// Splits the contents of an image file carrying the specified header magic.
+func parseImageMagic(imgPath string, data []byte, magic uint32) (
+	ImageHdr, []byte, []byte, error) {
+
+	hdr := ImageHdr{}
+
+	err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &hdr)
+	if err != nil {
+		return hdr, nil, nil, util.FmtNewtError(
+			"Image %s too small to contain header", imgPath)
+	}
+
+	if hdr.Magic != magic {
+		return hdr, nil, nil, util.FmtNewtError(
+			"Image %s has bad magic; expected=0x%08x actual=0x%08x",
+			imgPath, magic, hdr.Magic)
+	}
+
+	start := int(hdr.HdrSz)
+	end := start + int(hdr.ImgSz)
+	if start > len(data) || end > len(data) {
+		return hdr, nil, nil, util.FmtNewtError(
+			"Image %s truncated; header specifies %d bytes of payload, "+
+				"file contains %d", imgPath, hdr.ImgSz, len(data)-start)
+	}
+
+	return hdr, data[start:end], data[end:], nil
+}
+
+// Compares the payloads of two images.  Returns -1 if the payloads are
+// identical; otherwise, the offset within the payload of the first differing
+// byte.  If one payload is a prefix of the other, the offset is the length of
+// the shorter one.
+func ComparePayloads(a []byte, b []byte) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+
+	if len(a) != len(b) {
+		return n
+	}
+
+	return -1
+}
+
+func (ver ImageVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d.%d",
+		ver.Major, ver.Minor, ver.Rev, ver.BuildNum)
+}
+
+// Compares two versions field by field.  Returns -1, 0, or 1 if ver is older
+// than, equal to, or newer than other.
+func (ver ImageVersion) Compare(other ImageVersion) int {
+	a := []uint64{uint64(ver.Major), uint64(ver.Minor), uint64(ver.Rev),
+		uint64(ver.BuildNum)}
+	b := []uint64{uint64(other.Major), uint64(other.Minor),
+		uint64(other.Rev), uint64(other.BuildNum)}
+
+	for i, _ := range a {
+		if a[i] < b[i] {
+			return -1
+		} else if a[i] > b[i] {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// Describes the source revision of the specified directory with
+// "git describe --always --dirty".  If the directory is not in a git repo,
+// GIT_DESC_UNKNOWN is returned.
+func GitDescribe(dir string) string {
+	res, err := util.ShellCommand(fmt.Sprintf(
+		"cd %s && git describe --always --dirty", dir))
+	if err != nil {
+		log.Debugf("Unable to describe git revision of %s: %v", dir, err)
+		return GIT_DESC_UNKNOWN
+	}
+
+	desc := strings.TrimSpace(string(res))
+	if desc == "" {
+		return GIT_DESC_UNKNOWN
+	}
+
+	return desc
+}
+
 func CreateBuildId(app *Image, loader *Image) []byte {
 	return app.Hash
 }
@@ -0,0 +1,867 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Creates a temporary directory containing an EC signing key and a small
+// application binary.  Returns the directory, the key path, and the binary
+// path.
+func testImageFiles(t *testing.T) (string, string, string) {
+	dir, err := ioutil.TempDir("", "newt-image-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyPath := filepath.Join(dir, "key.pem")
+	testWriteEcKey(t, keyPath)
+
+	bin := make([]byte, 1000)
+	for i, _ := range bin {
+		bin[i] = byte(i)
+	}
+	binPath := filepath.Join(dir, "app.bin")
+	if err := ioutil.WriteFile(binPath, bin, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, keyPath, binPath
+}
+
+// Generates an image of version 1.2.3.4 from the specified binary.  setup, if
+// non-nil, configures the image before it is generated.
+func testBuildImage(t *testing.T, dir string, binPath string,
+	setup func(img *Image)) string {
+
+	imgPath := filepath.Join(dir, "app.img")
+	img, err := NewImage(binPath, imgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := img.SetVersion("1.2.3.4"); err != nil {
+		t.Fatal(err)
+	}
+	if setup != nil {
+		setup(img)
+	}
+
+	if err := img.Generate(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return imgPath
+}
+
+// Generates an image with its header at the specified offset, optionally
+// signed.
+func testGenerateImage(t *testing.T, dir string, keyPath string,
+	binPath string, headerOffset int, signed bool) string {
+
+	return testBuildImage(t, dir, binPath, func(img *Image) {
+		if signed {
+			if err := img.SetSigningKey(keyPath, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		img.HeaderOffset = headerOffset
+		img.HeaderFill = 0xff
+	})
+}
+
+func TestRequireSignatureHeaderOffset(t *testing.T) {
+	dir, keyPath, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		genOffset  int
+		readOffset int
+		signed     bool
+		wantErr    bool
+	}{
+		{0, 0, true, false},
+		{0x20, 0x20, true, false},
+		{0x400, 0x400, true, false},
+
+		// Unsigned images are rejected at any offset.
+		{0, 0, false, true},
+		{0x20, 0x20, false, true},
+
+		// The header must be sought at the offset it was written to.
+		{0x20, 0, true, true},
+		{0, 0x20, true, true},
+
+		// Offset past the end of the file.
+		{0, 0x100000, true, true},
+	}
+
+	for _, test := range tests {
+		imgPath := testGenerateImage(t, dir, keyPath, binPath,
+			test.genOffset, test.signed)
+
+		err := RequireSignature(imgPath, test.readOffset)
+		if test.wantErr && err == nil {
+			t.Errorf("RequireSignature(offset=0x%x) of image at 0x%x "+
+				"(signed=%v): expected error",
+				test.readOffset, test.genOffset, test.signed)
+		}
+		if !test.wantErr && err != nil {
+			t.Errorf("RequireSignature(offset=0x%x) of image at 0x%x "+
+				"(signed=%v): unexpected error: %s",
+				test.readOffset, test.genOffset, test.signed, err.Error())
+		}
+	}
+}
+
+// Both RSA and EC signatures satisfy the signature requirement.
+func TestRequireSignature(t *testing.T) {
+	dir, ecPath, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	rsaPath := filepath.Join(dir, "rsa.pem")
+	testWriteRsaKey(t, rsaPath)
+
+	tests := []struct {
+		name    string
+		keyPath string
+		wantTlv uint8
+		wantErr bool
+	}{
+		{"unsigned", "", 0, true},
+		{"ec", ecPath, IMAGE_TLV_ECDSA224, false},
+		{"rsa", rsaPath, IMAGE_TLV_RSA2048, false},
+	}
+
+	for _, test := range tests {
+		imgPath := testBuildImage(t, dir, binPath, func(img *Image) {
+			if test.keyPath != "" {
+				if err := img.SetSigningKey(test.keyPath, 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+
+		err := RequireSignature(imgPath, 0)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+
+		tlvs, err := ReadImageTlvs(imgPath, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, tlv := range tlvs {
+			if tlv.Header.Type == test.wantTlv {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: image lacks signature TLV %d", test.name,
+				test.wantTlv)
+		}
+	}
+}
+
+// TLV offsets are relative to the start of the file, not the header.
+func TestReadImageTlvs(t *testing.T) {
+	dir, keyPath, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	imgPath := testGenerateImage(t, dir, keyPath, binPath, 0, true)
+	orig, err := ioutil.ReadFile(imgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hdr := ImageHdr{}
+	err = binary.Read(bytes.NewReader(orig), binary.LittleEndian, &hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trailerOff := int(hdr.HdrSz) + int(hdr.ImgSz)
+
+	tests := []struct {
+		name    string
+		modify  func(data []byte) []byte
+		wantErr bool
+	}{
+		{"unmodified", func(data []byte) []byte { return data }, false},
+		{
+			"padding after trailer",
+			func(data []byte) []byte {
+				return append(data, bytes.Repeat([]byte{0xff}, 16)...)
+			},
+			false,
+		},
+		{
+			"truncated trailer",
+			func(data []byte) []byte { return data[:len(data)-10] },
+			true,
+		},
+		{
+			"oversized TLV",
+			func(data []byte) []byte {
+				binary.LittleEndian.PutUint16(data[trailerOff+2:], 0xffff)
+				return data
+			},
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		data := test.modify(append([]byte{}, orig...))
+		if err := ioutil.WriteFile(imgPath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		tlvs, err := ReadImageTlvs(imgPath, 0)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+
+		types := []uint8{}
+		for _, tlv := range tlvs {
+			types = append(types, tlv.Header.Type)
+		}
+		want := []uint8{IMAGE_TLV_SHA256, IMAGE_TLV_ECDSA224}
+		if !reflect.DeepEqual(types, want) {
+			t.Errorf("%s: TLV types %v; want %v", test.name, types, want)
+		}
+
+		// TLVs are contiguous, starting immediately after the payload.
+		off := trailerOff
+		for i, tlv := range tlvs {
+			if tlv.Offset != off {
+				t.Errorf("%s: TLV %d at offset %d; want %d", test.name, i,
+					tlv.Offset, off)
+			}
+			if !bytes.Equal(tlv.Data, data[off+4:off+4+len(tlv.Data)]) {
+				t.Errorf("%s: TLV %d data does not match file contents",
+					test.name, i)
+			}
+			off += 4 + int(tlv.Header.Len)
+		}
+	}
+}
+
+func TestReadImageTlvsHeaderOffset(t *testing.T) {
+	dir, keyPath, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	base := testGenerateImage(t, dir, keyPath, binPath, 0, true)
+	baseTlvs, err := ReadImageTlvs(base, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const off = 0x80
+	shifted := testGenerateImage(t, dir, keyPath, binPath, off, true)
+	tlvs, err := ReadImageTlvs(shifted, off)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tlvs) != len(baseTlvs) {
+		t.Fatalf("TLV count %d; want %d", len(tlvs), len(baseTlvs))
+	}
+	for i, tlv := range tlvs {
+		if tlv.Header.Type != baseTlvs[i].Header.Type {
+			t.Errorf("TLV %d type %d; want %d",
+				i, tlv.Header.Type, baseTlvs[i].Header.Type)
+		}
+		if tlv.Offset != baseTlvs[i].Offset+off {
+			t.Errorf("TLV %d offset 0x%x; want 0x%x",
+				i, tlv.Offset, baseTlvs[i].Offset+off)
+		}
+	}
+}
+
+func TestCfgHashTlv(t *testing.T) {
+	dir, _, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	hash := bytes.Repeat([]byte{0xa5}, 32)
+	tests := []struct {
+		name string
+		hash []byte
+	}{
+		{"no hash", nil},
+		{"hash", hash},
+	}
+
+	for _, test := range tests {
+		imgPath := testBuildImage(t, dir, binPath, func(img *Image) {
+			img.CfgHash = test.hash
+		})
+
+		tlvs, err := ReadImageTlvs(imgPath, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := TlvCfgHash(tlvs); !bytes.Equal(got, test.hash) {
+			t.Errorf("%s: TlvCfgHash() = %x; want %x", test.name, got,
+				test.hash)
+		}
+	}
+}
+
+func TestGitDescTlv(t *testing.T) {
+	dir, _, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name string
+		desc string
+	}{
+		{"no description", ""},
+		{"description", "v1.2.0-3-gabcdef0-dirty"},
+	}
+
+	for _, test := range tests {
+		imgPath := testBuildImage(t, dir, binPath, func(img *Image) {
+			img.GitDesc = test.desc
+		})
+
+		tlvs, err := ReadImageTlvs(imgPath, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := ""
+		for _, tlv := range tlvs {
+			if tlv.Header.Type == IMAGE_TLV_GIT_DESC {
+				got = string(tlv.Data)
+			}
+		}
+		if got != test.desc {
+			t.Errorf("%s: git describe TLV = %q; want %q", test.name, got,
+				test.desc)
+		}
+	}
+}
+
+func TestGitDescribe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-gitdesc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if desc := GitDescribe(dir); desc != GIT_DESC_UNKNOWN {
+		t.Errorf("GitDescribe(non-repo) = %q; want %q", desc,
+			GIT_DESC_UNKNOWN)
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	cmds := [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com",
+			"commit", "-q", "--allow-empty", "-m", "initial"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com",
+			"tag", "-a", "-m", "release", "v1.0.0"},
+	}
+	for _, args := range cmds {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s: %s", args, err.Error(), out)
+		}
+	}
+
+	if desc := GitDescribe(dir); desc != "v1.0.0" {
+		t.Errorf("GitDescribe(tagged repo) = %q; want %q", desc, "v1.0.0")
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ImageVersion
+		wantErr bool
+	}{
+		{"1", ImageVersion{1, 0, 0, 0}, false},
+		{"1.2", ImageVersion{1, 2, 0, 0}, false},
+		{"1.2.3.4", ImageVersion{1, 2, 3, 4}, false},
+		{"255.255.65535.4294967295",
+			ImageVersion{255, 255, 65535, 4294967295}, false},
+
+		// Components must be decimal numbers.
+		{"", ImageVersion{}, true},
+		{"1..3", ImageVersion{}, true},
+		{"1.2.3.", ImageVersion{}, true},
+		{"1.x", ImageVersion{}, true},
+		{"1.-2", ImageVersion{}, true},
+		{"0x1", ImageVersion{}, true},
+
+		// Components must fit in their header fields.
+		{"256", ImageVersion{}, true},
+		{"1.256", ImageVersion{}, true},
+		{"1.2.65536", ImageVersion{}, true},
+		{"1.2.3.4294967296", ImageVersion{}, true},
+
+		// At most four components.
+		{"1.2.3.4.5", ImageVersion{}, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseVersion(test.in)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseVersion(%q): expected error", test.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseVersion(%q): unexpected error: %s",
+				test.in, err.Error())
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseVersion(%q) = %s; want %s",
+				test.in, got.String(), test.want.String())
+		}
+	}
+}
+
+func testVersionTlv(data []byte) ImageTlv {
+	return ImageTlv{
+		Header: ImageTrailerTlv{
+			Type: IMAGE_TLV_VERSION,
+			Len:  uint16(len(data)),
+		},
+		Data: data,
+	}
+}
+
+func TestCheckVersionTlvs(t *testing.T) {
+	hdr := ImageHdr{Vers: ImageVersion{1, 2, 3, 4}}
+
+	verData := func(ver ImageVersion) []byte {
+		buf := bytes.Buffer{}
+		binary.Write(&buf, binary.LittleEndian, ver)
+		return buf.Bytes()
+	}
+	other := ImageTlv{
+		Header: ImageTrailerTlv{Type: IMAGE_TLV_SHA256, Len: 32},
+		Data:   make([]byte, 32),
+	}
+
+	tests := []struct {
+		name    string
+		tlvs    []ImageTlv
+		wantErr string // Expected error substring; "" if none.
+	}{
+		{"no version tlv", []ImageTlv{other}, ""},
+		{
+			"matching",
+			[]ImageTlv{other, testVersionTlv(verData(hdr.Vers))},
+			"",
+		},
+		{
+			"mismatch",
+			[]ImageTlv{testVersionTlv(verData(ImageVersion{1, 2, 3, 5}))},
+			"version mismatch; header=1.2.3.4 tlv=1.2.3.5",
+		},
+		{
+			"second mismatches",
+			[]ImageTlv{
+				testVersionTlv(verData(hdr.Vers)),
+				testVersionTlv(verData(ImageVersion{2, 0, 0, 0})),
+			},
+			"version mismatch; header=1.2.3.4 tlv=2.0.0.0",
+		},
+		{
+			"malformed",
+			[]ImageTlv{testVersionTlv(make([]byte, 4))},
+			"malformed version TLV",
+		},
+	}
+
+	for _, test := range tests {
+		err := CheckVersionTlvs("test.img", hdr, test.tlvs)
+		if test.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", test.name,
+					err.Error())
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Errorf("%s: expected error", test.name)
+		} else if !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: error \"%s\" does not contain \"%s\"",
+				test.name, err.Error(), test.wantErr)
+		}
+	}
+}
+
+// Images generated by newt carry no version TLV and are consistent.
+func TestCheckImageVersion(t *testing.T) {
+	dir, _, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	imgPath := testBuildImage(t, dir, binPath, nil)
+	ver, err := CheckImageVersion(imgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ImageVersion{1, 2, 3, 4}); ver != want {
+		t.Errorf("CheckImageVersion() = %s; want %s", ver.String(),
+			want.String())
+	}
+}
+
+func TestParseDependencies(t *testing.T) {
+	tests := []struct {
+		name    string
+		deps    map[string]string
+		want    []ImageDependency
+		wantErr bool
+	}{
+		{"none", map[string]string{}, []ImageDependency{}, false},
+		{
+			"sorted by name",
+			map[string]string{"radio": "2.1", "boot": "1.0.0.3"},
+			[]ImageDependency{
+				{"boot", ImageVersion{1, 0, 0, 3}},
+				{"radio", ImageVersion{2, 1, 0, 0}},
+			},
+			false,
+		},
+		{"empty name", map[string]string{"": "1.0"}, nil, true},
+		{"bad version", map[string]string{"boot": "1.x"}, nil, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseDependencies(test.deps)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: ParseDependencies() = %v; want %v", test.name,
+				got, test.want)
+		}
+	}
+}
+
+// Dependencies written to an image are read back from its TLVs.
+func TestDependencyTlvs(t *testing.T) {
+	dir, _, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name string
+		deps []ImageDependency
+	}{
+		{"none", []ImageDependency{}},
+		{"one", []ImageDependency{{"boot", ImageVersion{1, 0, 0, 3}}}},
+		{
+			"two",
+			[]ImageDependency{
+				{"boot", ImageVersion{1, 0, 0, 3}},
+				{"radio", ImageVersion{2, 1, 0, 0}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		imgPath := testBuildImage(t, dir, binPath, func(img *Image) {
+			img.Dependencies = test.deps
+		})
+
+		tlvs, err := ReadImageTlvs(imgPath, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := TlvDependencies(tlvs)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(got, test.deps) {
+			t.Errorf("%s: TlvDependencies() = %v; want %v", test.name,
+				got, test.deps)
+		}
+	}
+}
+
+func TestParseDependencyTlvShort(t *testing.T) {
+	for _, n := range []int{0, 4, IMAGE_DEP_VERSION_SZ} {
+		if _, err := ParseDependencyTlv(make([]byte, n)); err == nil {
+			t.Errorf("ParseDependencyTlv(len=%d): expected error", n)
+		}
+	}
+}
+
+func TestParseMagic(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint32
+		wantErr bool
+	}{
+		{"", IMAGE_MAGIC, false},
+		{"0x12345678", 0x12345678, false},
+		{"305419896", 0x12345678, false},
+		{"0", 0, true},
+		{"0x100000000", 0, true},
+		{"magic", 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseMagic(test.in)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseMagic(%q): expected error", test.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMagic(%q): unexpected error: %s",
+				test.in, err.Error())
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseMagic(%q) = 0x%08x; want 0x%08x",
+				test.in, got, test.want)
+		}
+	}
+}
+
+// An image with a custom magic is only readable when that magic is expected.
+func TestCustomMagic(t *testing.T) {
+	dir, _, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+	defer func() { ExpectedMagic = IMAGE_MAGIC }()
+
+	const custom = 0x12345678
+
+	tests := []struct {
+		genMagic  uint32
+		readMagic uint32
+		wantErr   bool
+	}{
+		{0, IMAGE_MAGIC, false},
+		{custom, IMAGE_MAGIC, true},
+		{custom, custom, false},
+		{0, custom, true},
+	}
+
+	for _, test := range tests {
+		imgPath := testBuildImage(t, dir, binPath, func(img *Image) {
+			img.Magic = test.genMagic
+		})
+
+		ExpectedMagic = test.readMagic
+		hdr, _, err := ReadImage(imgPath)
+		ExpectedMagic = IMAGE_MAGIC
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ReadImage(magic=0x%08x) of image with magic "+
+					"0x%08x: expected error", test.readMagic, test.genMagic)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ReadImage(magic=0x%08x) of image with magic 0x%08x: "+
+				"unexpected error: %s", test.readMagic, test.genMagic,
+				err.Error())
+			continue
+		}
+		if hdr.Magic != test.readMagic {
+			t.Errorf("image magic 0x%08x; want 0x%08x", hdr.Magic,
+				test.readMagic)
+		}
+	}
+}
+
+func TestComparePayloads(t *testing.T) {
+	tests := []struct {
+		a    []byte
+		b    []byte
+		want int
+	}{
+		{[]byte{}, []byte{}, -1},
+		{[]byte{1, 2, 3}, []byte{1, 2, 3}, -1},
+		{[]byte{1, 2, 3}, []byte{1, 9, 3}, 1},
+		{[]byte{1, 2, 3}, []byte{1, 2}, 2},
+		{[]byte{1}, []byte{1, 2, 3}, 1},
+	}
+
+	for _, test := range tests {
+		if got := ComparePayloads(test.a, test.b); got != test.want {
+			t.Errorf("ComparePayloads(%v, %v) = %d; want %d",
+				test.a, test.b, got, test.want)
+		}
+	}
+}
+
+// The payload bounds exclude the header and trailer, so images built from
+// the same binary compare equal even if their trailers differ.
+func TestPayloadBounds(t *testing.T) {
+	dir, keyPath, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	bin, err := ioutil.ReadFile(binPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payloads := [][]byte{}
+	for _, signed := range []bool{false, true} {
+		imgPath := testGenerateImage(t, dir, keyPath, binPath, 0, signed)
+		data, err := ioutil.ReadFile(imgPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start, end, ok := PayloadBounds(data)
+		if !ok {
+			t.Fatalf("PayloadBounds(signed=%v): not an image", signed)
+		}
+		if start != IMAGE_HEADER_SIZE || end-start != len(bin) {
+			t.Errorf("PayloadBounds(signed=%v) = [%d, %d); want [%d, %d)",
+				signed, start, end, IMAGE_HEADER_SIZE,
+				IMAGE_HEADER_SIZE+len(bin))
+		}
+		payloads = append(payloads, data[start:end])
+	}
+
+	if off := ComparePayloads(payloads[0], payloads[1]); off != -1 {
+		t.Errorf("payloads differ at offset %d", off)
+	}
+
+	if _, _, ok := PayloadBounds(bin); ok {
+		t.Errorf("PayloadBounds() of raw binary: expected failure")
+	}
+}
+
+// Tool versions are recorded in the manifest only when reported.
+func TestManifestToolVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest ImageManifest
+		want     map[string]string
+	}{
+		{
+			name:     "no versions",
+			manifest: ImageManifest{},
+			want:     map[string]string{},
+		},
+		{
+			name: "all versions",
+			manifest: ImageManifest{
+				NewtVersion:     "1.4.0",
+				CompilerVersion: "gcc 9.2.1",
+				LinkerVersion:   "GNU ld 2.34",
+			},
+			want: map[string]string{
+				"newt_version":     "1.4.0",
+				"compiler_version": "gcc 9.2.1",
+				"linker_version":   "GNU ld 2.34",
+			},
+		},
+		{
+			name: "linker unreported",
+			manifest: ImageManifest{
+				NewtVersion:     "1.4.0",
+				CompilerVersion: "clang 10.0.0",
+			},
+			want: map[string]string{
+				"newt_version":     "1.4.0",
+				"compiler_version": "clang 10.0.0",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		buf, err := json.Marshal(test.manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(buf, &fields); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, key := range []string{
+			"newt_version", "compiler_version", "linker_version"} {
+
+			val, ok := fields[key]
+			want, wantOk := test.want[key]
+			if ok != wantOk || (ok && val != want) {
+				t.Errorf("%s: %s = %v (present=%t); want %q (present=%t)",
+					test.name, key, val, ok, want, wantOk)
+			}
+		}
+	}
+}
+
+// TLV codes are listed in increasing order, without duplicates.
+func TestTlvCodes(t *testing.T) {
+	prev := 0
+	for _, desc := range TlvCodes() {
+		if desc.Code <= prev {
+			t.Errorf("%s: code %d follows %d", desc.Name, desc.Code, prev)
+		}
+		if desc.Size == 0 || desc.Size < -1 {
+			t.Errorf("%s: invalid size %d", desc.Name, desc.Size)
+		}
+		prev = desc.Code
+	}
+}
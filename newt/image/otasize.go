@@ -0,0 +1,129 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Compression methods that an OTA transfer may apply to an image or delta.
+const (
+	COMPRESSION_NONE    = "none"
+	COMPRESSION_DEFLATE = "deflate"
+	COMPRESSION_GZIP    = "gzip"
+)
+
+func CompressionMethods() []string {
+	return []string{
+		COMPRESSION_NONE,
+		COMPRESSION_DEFLATE,
+		COMPRESSION_GZIP,
+	}
+}
+
+// Compresses data with the specified method at the best compression level.
+func Compress(data []byte, method string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	var w io.WriteCloser
+	var err error
+	switch method {
+	case COMPRESSION_NONE:
+		return data, nil
+	case COMPRESSION_DEFLATE:
+		w, err = flate.NewWriter(buf, flate.BestCompression)
+	case COMPRESSION_GZIP:
+		w, err = gzip.NewWriterLevel(buf, gzip.BestCompression)
+	default:
+		return nil, util.FmtNewtError(
+			"Unknown compression method \"%s\"", method)
+	}
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// The number of bytes an OTA transfer of an image requires.
+type OtaSize struct {
+	Compression string
+
+	// Full image.
+	ImageSize      int
+	CompressedSize int
+
+	// Delta from the previous image; -1 if no previous image was given.
+	DeltaSize           int
+	CompressedDeltaSize int
+}
+
+// Estimates the transfer cost of the image at imgPath.  If prevPath is
+// non-empty, the cost of a delta from that image (see CreateDelta) is
+// estimated as well.
+func EstimateOtaSize(imgPath string, prevPath string,
+	compression string) (OtaSize, error) {
+
+	size := OtaSize{
+		Compression:         compression,
+		DeltaSize:           -1,
+		CompressedDeltaSize: -1,
+	}
+
+	data, _, _, _, err := readVerifiedImage(imgPath)
+	if err != nil {
+		return size, err
+	}
+	size.ImageSize = len(data)
+
+	compressed, err := Compress(data, compression)
+	if err != nil {
+		return size, err
+	}
+	size.CompressedSize = len(compressed)
+
+	if prevPath != "" {
+		delta, err := CreateDelta(prevPath, imgPath, nil)
+		if err != nil {
+			return size, err
+		}
+		size.DeltaSize = len(delta)
+
+		compressed, err := Compress(delta, compression)
+		if err != nil {
+			return size, err
+		}
+		size.CompressedDeltaSize = len(compressed)
+	}
+
+	return size, nil
+}
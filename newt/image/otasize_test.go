@@ -0,0 +1,122 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	data := bytes.Repeat([]byte("compressible "), 100)
+
+	for _, method := range CompressionMethods() {
+		compressed, err := Compress(data, method)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", method, err.Error())
+			continue
+		}
+
+		var r io.Reader
+		switch method {
+		case COMPRESSION_NONE:
+			r = bytes.NewReader(compressed)
+		case COMPRESSION_DEFLATE:
+			r = flate.NewReader(bytes.NewReader(compressed))
+		case COMPRESSION_GZIP:
+			r, err = gzip.NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Errorf("%s: invalid output: %s", method, err.Error())
+				continue
+			}
+		}
+
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Errorf("%s: invalid output: %s", method, err.Error())
+			continue
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: output does not decompress to input", method)
+		}
+		if method != COMPRESSION_NONE && len(compressed) >= len(data) {
+			t.Errorf("%s: did not compress; %d bytes", method,
+				len(compressed))
+		}
+	}
+
+	if _, err := Compress(data, "lz4"); err == nil {
+		t.Errorf("unknown method: expected error")
+	}
+}
+
+func TestEstimateOtaSize(t *testing.T) {
+	dir, _, _ := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	bin := make([]byte, 4096)
+	for i, _ := range bin {
+		bin[i] = byte(i * 13)
+	}
+	prevPath := testImageFromBin(t, dir, "prev.img", bin)
+	bin[100] ^= 0xff
+	imgPath := testImageFromBin(t, dir, "app.img", bin)
+
+	data, err := ioutil.ReadFile(imgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := EstimateOtaSize(imgPath, "", COMPRESSION_NONE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := OtaSize{
+		Compression:         COMPRESSION_NONE,
+		ImageSize:           len(data),
+		CompressedSize:      len(data),
+		DeltaSize:           -1,
+		CompressedDeltaSize: -1,
+	}
+	if size != want {
+		t.Errorf("no previous image: size %+v; want %+v", size, want)
+	}
+
+	size, err = EstimateOtaSize(imgPath, prevPath, COMPRESSION_GZIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size.ImageSize != len(data) {
+		t.Errorf("image size %d; want %d", size.ImageSize, len(data))
+	}
+
+	// A one-byte change yields a delta far smaller than the image.
+	if size.DeltaSize <= 0 || size.DeltaSize > len(data)/4 {
+		t.Errorf("delta size %d; image size %d", size.DeltaSize, len(data))
+	}
+	if size.CompressedDeltaSize <= 0 {
+		t.Errorf("compressed delta size %d", size.CompressedDeltaSize)
+	}
+}
@@ -0,0 +1,330 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"io/ioutil"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Signing keys whose "filename" begins with this prefix are PKCS#11 URIs
+// (RFC 7512) identifying a private key held by a hardware token.  The key
+// never leaves the token; the token signs the image hash.  Supported
+// attributes:
+//
+//	Path: token, object, id, type (must be "private" if specified)
+//	Query: module-path, pin-value, pin-source (file path or "file:" URI)
+//
+// Example:
+//
+//	pkcs11:token=build;object=img-key?module-path=/usr/lib/libsofthsm2.so&pin-source=/etc/newt/pin
+const PKCS11_URI_PREFIX = "pkcs11:"
+
+// PKCS#11 signing mechanisms, named as pkcs11-tool names them.
+const PKCS11_MECH_RSA_PKCS = "RSA-PKCS"
+const PKCS11_MECH_ECDSA = "ECDSA"
+
+// The DER encoding of a PKCS#1 v1.5 DigestInfo header for a SHA-256 digest.
+// The RSA-PKCS mechanism signs its input as-is, so this must precede the
+// digest.
+var pkcs1Sha256Prefix = []byte{
+	0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01,
+	0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20,
+}
+
+// Identifies a private key held by a PKCS#11 token.
+type Pkcs11Key struct {
+	Uri        string
+	ModulePath string // Empty means the backend's default module.
+	Token      string // Token label.
+	Object     string // Key label.
+	Id         []byte
+	Pin        string
+
+	// The key's public half, as read from the token.
+	PublicKey crypto.PublicKey
+}
+
+// Performs operations with keys held by a PKCS#11 token.
+type Pkcs11Backend interface {
+	// Reads the public half of a key as a DER-encoded SubjectPublicKeyInfo.
+	ReadPublicKey(key Pkcs11Key) ([]byte, error)
+
+	// Signs data with a key using the specified mechanism.  ECDSA
+	// signatures are returned in ASN.1 form.
+	Sign(key Pkcs11Key, mechanism string, data []byte) ([]byte, error)
+}
+
+// The backend used for all PKCS#11 operations.  By default, operations are
+// performed by OpenSC's pkcs11-tool utility.
+var Pkcs11 Pkcs11Backend = &pkcs11ToolBackend{}
+
+func pkcs11UriUnescape(uri string, val string) (string, error) {
+	s, err := url.PathUnescape(val)
+	if err != nil {
+		return "", util.FmtNewtError("Invalid PKCS#11 URI \"%s\": %s",
+			uri, err.Error())
+	}
+	return s, nil
+}
+
+func readPkcs11Pin(uri string, source string) (string, error) {
+	source = strings.TrimPrefix(source, "file:")
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return "", util.FmtNewtError(
+			"Failed to read PIN for PKCS#11 URI \"%s\": %s", uri, err.Error())
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Parses a PKCS#11 URI identifying a private key.  The key's public half is
+// not read.
+func ParsePkcs11Uri(uri string) (Pkcs11Key, error) {
+	key := Pkcs11Key{Uri: uri}
+
+	if !strings.HasPrefix(uri, PKCS11_URI_PREFIX) {
+		return key, util.FmtNewtError(
+			"Invalid PKCS#11 URI \"%s\"; must begin with \"%s\"",
+			uri, PKCS11_URI_PREFIX)
+	}
+
+	rest := strings.TrimPrefix(uri, PKCS11_URI_PREFIX)
+	path := rest
+	query := ""
+	if idx := strings.Index(rest, "?"); idx != -1 {
+		path = rest[:idx]
+		query = rest[idx+1:]
+	}
+
+	parseAttrs := func(s string, sep string) (map[string]string, error) {
+		attrs := map[string]string{}
+		for _, field := range strings.Split(s, sep) {
+			if field == "" {
+				continue
+			}
+			parts := strings.SplitN(field, "=", 2)
+			if len(parts) != 2 {
+				return nil, util.FmtNewtError(
+					"Invalid PKCS#11 URI \"%s\"; malformed attribute \"%s\"",
+					uri, field)
+			}
+			val, err := pkcs11UriUnescape(uri, parts[1])
+			if err != nil {
+				return nil, err
+			}
+			attrs[parts[0]] = val
+		}
+		return attrs, nil
+	}
+
+	pathAttrs, err := parseAttrs(path, ";")
+	if err != nil {
+		return key, err
+	}
+	queryAttrs, err := parseAttrs(query, "&")
+	if err != nil {
+		return key, err
+	}
+
+	key.Token = pathAttrs["token"]
+	key.Object = pathAttrs["object"]
+	key.Id = []byte(pathAttrs["id"])
+	if typ, ok := pathAttrs["type"]; ok && typ != "private" {
+		return key, util.FmtNewtError(
+			"Invalid PKCS#11 URI \"%s\"; signing requires a private key, "+
+				"not type=%s", uri, typ)
+	}
+	if key.Object == "" && len(key.Id) == 0 {
+		return key, util.FmtNewtError(
+			"Invalid PKCS#11 URI \"%s\"; must specify an object or id", uri)
+	}
+
+	key.ModulePath = queryAttrs["module-path"]
+	key.Pin = queryAttrs["pin-value"]
+	if source := queryAttrs["pin-source"]; source != "" {
+		if key.Pin, err = readPkcs11Pin(uri, source); err != nil {
+			return key, err
+		}
+	}
+
+	return key, nil
+}
+
+// Parses a PKCS#11 URI and reads the identified key's public half from the
+// token.  Only 2048-bit RSA and ECDSA keys are supported.
+func LoadPkcs11Key(uri string) (Pkcs11Key, error) {
+	key, err := ParsePkcs11Uri(uri)
+	if err != nil {
+		return key, err
+	}
+
+	der, err := Pkcs11.ReadPublicKey(key)
+	if err != nil {
+		return key, err
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return key, util.FmtNewtError(
+			"Failed to parse public key of PKCS#11 key \"%s\": %s",
+			uri, err.Error())
+	}
+
+	switch p := pub.(type) {
+	case *rsa.PublicKey:
+		if p.N.BitLen() != 2048 {
+			return key, util.FmtNewtError(
+				"PKCS#11 key \"%s\" is a %d-bit RSA key; only 2048-bit RSA "+
+					"keys are supported", uri, p.N.BitLen())
+		}
+	case *ecdsa.PublicKey:
+	default:
+		return key, util.FmtNewtError(
+			"PKCS#11 key \"%s\" has unsupported type; EC/RSA only", uri)
+	}
+	key.PublicKey = pub
+
+	return key, nil
+}
+
+// Signs a SHA-256 hash with an RSA key held by a token.  The signature is
+// checked against the key's public half before it is returned.
+func (key *Pkcs11Key) signRSA(hash []byte) ([]byte, error) {
+	data := append(append([]byte{}, pkcs1Sha256Prefix...), hash...)
+	sig, err := Pkcs11.Sign(*key, PKCS11_MECH_RSA_PKCS, data)
+	if err != nil {
+		return nil, err
+	}
+
+	pub := key.PublicKey.(*rsa.PublicKey)
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash, sig); err != nil {
+		return nil, util.FmtNewtError(
+			"PKCS#11 token produced an invalid signature for key \"%s\": %s",
+			key.Uri, err.Error())
+	}
+
+	return sig, nil
+}
+
+// Signs a hash with an EC key held by a token, returning an ASN.1 signature.
+// The signature is checked against the key's public half before it is
+// returned.
+func (key *Pkcs11Key) signEC(hash []byte) ([]byte, error) {
+	sig, err := Pkcs11.Sign(*key, PKCS11_MECH_ECDSA, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	var ecSig ECDSASig
+	if _, err := asn1.Unmarshal(sig, &ecSig); err != nil ||
+		!ecdsa.Verify(key.PublicKey.(*ecdsa.PublicKey), hash,
+			ecSig.R, ecSig.S) {
+
+		return nil, util.FmtNewtError(
+			"PKCS#11 token produced an invalid signature for key \"%s\"",
+			key.Uri)
+	}
+
+	return sig, nil
+}
+
+// Performs PKCS#11 operations by running OpenSC's pkcs11-tool.
+type pkcs11ToolBackend struct{}
+
+const pkcs11ToolName = "pkcs11-tool"
+
+func (b *pkcs11ToolBackend) keyArgs(key Pkcs11Key) []string {
+	args := []string{}
+	if key.ModulePath != "" {
+		args = append(args, "--module", key.ModulePath)
+	}
+	if key.Token != "" {
+		args = append(args, "--token-label", key.Token)
+	}
+	if key.Object != "" {
+		args = append(args, "--label", key.Object)
+	}
+	if len(key.Id) > 0 {
+		args = append(args, "--id", hex.EncodeToString(key.Id))
+	}
+	return args
+}
+
+func (b *pkcs11ToolBackend) run(key Pkcs11Key, args []string,
+	input []byte) ([]byte, error) {
+
+	path, err := exec.LookPath(pkcs11ToolName)
+	if err != nil {
+		return nil, util.FmtNewtError(
+			"Cannot use PKCS#11 key \"%s\"; %s (OpenSC) not found in PATH",
+			key.Uri, pkcs11ToolName)
+	}
+
+	log.Debugf("%s %s", path, strings.Join(args, " "))
+
+	// The PIN is passed after logging so that it doesn't end up in the log.
+	if key.Pin != "" {
+		args = append(args, "--login", "--pin", key.Pin)
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, util.FmtNewtError(
+			"PKCS#11 operation on key \"%s\" failed; token or key "+
+				"unavailable? %s: %s", key.Uri, err.Error(),
+			strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
+
+func (b *pkcs11ToolBackend) ReadPublicKey(key Pkcs11Key) ([]byte, error) {
+	args := append(b.keyArgs(key), "--read-object", "--type", "pubkey")
+	return b.run(key, args, nil)
+}
+
+func (b *pkcs11ToolBackend) Sign(key Pkcs11Key, mechanism string,
+	data []byte) ([]byte, error) {
+
+	args := append(b.keyArgs(key), "--sign", "--mechanism", mechanism)
+	if mechanism == PKCS11_MECH_ECDSA {
+		args = append(args, "--signature-format", "openssl")
+	}
+	return b.run(key, args, data)
+}
@@ -0,0 +1,241 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"mynewt.apache.org/newt/util"
+)
+
+func TestParsePkcs11Uri(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-pkcs11-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pinPath := filepath.Join(dir, "pin")
+	if err := ioutil.WriteFile(pinPath, []byte("1234\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		uri     string
+		want    Pkcs11Key
+		wantErr bool
+	}{
+		{
+			uri:  "pkcs11:object=img-key",
+			want: Pkcs11Key{Object: "img-key", Id: []byte{}},
+		},
+		{
+			uri: "pkcs11:token=build;object=img%20key;type=private" +
+				"?module-path=/usr/lib/softhsm.so&pin-value=0000",
+			want: Pkcs11Key{
+				ModulePath: "/usr/lib/softhsm.so",
+				Token:      "build",
+				Object:     "img key",
+				Id:         []byte{},
+				Pin:        "0000",
+			},
+		},
+		{
+			uri:  "pkcs11:id=%01%02",
+			want: Pkcs11Key{Id: []byte{1, 2}},
+		},
+		{
+			uri:  "pkcs11:object=k?pin-source=" + pinPath,
+			want: Pkcs11Key{Object: "k", Id: []byte{}, Pin: "1234"},
+		},
+		{
+			uri:  "pkcs11:object=k?pin-source=file:" + pinPath,
+			want: Pkcs11Key{Object: "k", Id: []byte{}, Pin: "1234"},
+		},
+
+		{uri: "object=img-key", wantErr: true},
+		{uri: "pkcs11:token=build", wantErr: true},
+		{uri: "pkcs11:object=k;type=public", wantErr: true},
+		{uri: "pkcs11:object", wantErr: true},
+		{uri: "pkcs11:object=%zz", wantErr: true},
+		{uri: "pkcs11:object=k?pin-source=/nonexistent", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParsePkcs11Uri(test.uri)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParsePkcs11Uri(%q): expected error", test.uri)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePkcs11Uri(%q): unexpected error: %s", test.uri,
+				err.Error())
+			continue
+		}
+
+		test.want.Uri = test.uri
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParsePkcs11Uri(%q) = %+v; want %+v", test.uri, got,
+				test.want)
+		}
+	}
+}
+
+// A PKCS#11 backend holding software keys, indexed by object label.  If
+// corrupt is set, the token produces invalid signatures.
+type testPkcs11Backend struct {
+	keys    map[string]crypto.Signer
+	corrupt bool
+}
+
+func (b *testPkcs11Backend) ReadPublicKey(key Pkcs11Key) ([]byte, error) {
+	signer, ok := b.keys[key.Object]
+	if !ok {
+		return nil, util.FmtNewtError("no such key: %s", key.Object)
+	}
+
+	return x509.MarshalPKIXPublicKey(signer.Public())
+}
+
+func (b *testPkcs11Backend) Sign(key Pkcs11Key, mechanism string,
+	data []byte) ([]byte, error) {
+
+	var sig []byte
+	var err error
+
+	switch k := b.keys[key.Object].(type) {
+	case *rsa.PrivateKey:
+		if mechanism != PKCS11_MECH_RSA_PKCS {
+			return nil, util.FmtNewtError("bad mechanism: %s", mechanism)
+		}
+		// The RSA-PKCS mechanism signs the DigestInfo as-is.
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, 0, data)
+
+	case *ecdsa.PrivateKey:
+		if mechanism != PKCS11_MECH_ECDSA {
+			return nil, util.FmtNewtError("bad mechanism: %s", mechanism)
+		}
+		r, s, serr := ecdsa.Sign(rand.Reader, k, data)
+		if serr != nil {
+			return nil, serr
+		}
+		sig, err = asn1.Marshal(ECDSASig{R: r, S: s})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if b.corrupt {
+		sig[len(sig)-1] ^= 0xff
+	}
+	return sig, nil
+}
+
+// Images signed by a token verify against the token's public key.
+func TestPkcs11Signing(t *testing.T) {
+	dir, _, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &testPkcs11Backend{
+		keys: map[string]crypto.Signer{
+			"ec":    ecKey,
+			"rsa":   rsaKey,
+			"small": smallKey,
+		},
+	}
+	defer func(b Pkcs11Backend) { Pkcs11 = b }(Pkcs11)
+	Pkcs11 = backend
+
+	keys := []TrustedKey{
+		{Name: "ec", EC: &ecKey.PublicKey},
+		{Name: "rsa", RSA: &rsaKey.PublicKey},
+	}
+
+	tests := []struct {
+		object  string
+		corrupt bool
+		wantErr bool
+	}{
+		{"ec", false, false},
+		{"rsa", false, false},
+		{"ec", true, true},
+		{"rsa", true, true},
+		{"small", false, true},
+		{"missing", false, true},
+	}
+
+	for _, test := range tests {
+		backend.corrupt = test.corrupt
+
+		imgPath := filepath.Join(dir, "token.img")
+		img, err := NewImage(binPath, imgPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = img.SetSigningKey("pkcs11:object="+test.object, 0)
+		if err == nil {
+			err = img.Generate(nil)
+		}
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%+v: expected error", test)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %s", test, err.Error())
+			continue
+		}
+
+		key, err := VerifyImage(imgPath, keys)
+		if err != nil {
+			t.Errorf("%+v: image does not verify: %s", test, err.Error())
+		} else if key.Name != test.object {
+			t.Errorf("%+v: verified by %s", test, key.Name)
+		}
+	}
+}
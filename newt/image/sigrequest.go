@@ -0,0 +1,182 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// A signing request packages the digest of an image prepared for detached
+// signing (see InjectSignature) with enough metadata for an external signing
+// authority to decide whether to sign it.  The authority returns a signing
+// response containing the digest and the signature, which
+// InjectSigningResponse adds to the image.  Both are JSON documents; binary
+// values are hex encoded.
+
+const SIGNING_REQUEST_FORMAT = 1
+const SIGNING_HASH_ALG = "sha256"
+
+type SigningRequest struct {
+	Format    int    `json:"format"`
+	Image     string `json:"image"`
+	Version   string `json:"version"`
+	KeyId     int    `json:"key_id"`
+	ImageSize int    `json:"image_size"`
+	HashAlg   string `json:"hash_algorithm"`
+	SigAlg    string `json:"signature_algorithm"`
+	Digest    string `json:"digest"`
+}
+
+type SigningResponse struct {
+	Digest    string `json:"digest"`
+	Signature string `json:"signature"`
+}
+
+// Returns the default path of the signing request for the specified image.
+func SigningRequestPath(imgPath string) string {
+	return imgPath + ".sigreq.json"
+}
+
+func detachedSigTypeName(typ uint8) string {
+	for name, t := range detachedSigTypes {
+		if t == typ {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// Reads an image prepared for detached signing.  The digest is checked
+// against the image contents unless the image is the second half of a split
+// image, whose hash covers the loader as well.
+func readDetachedImage(imgPath string) ([]byte, detachedImage, error) {
+	data, err := ioutil.ReadFile(imgPath)
+	if err != nil {
+		return nil, detachedImage{}, util.ChildNewtError(err)
+	}
+
+	di, err := parseDetachedImage(imgPath, data)
+	if err != nil {
+		return nil, di, err
+	}
+
+	if di.hdr.Flags&IMAGE_F_NON_BOOTABLE == 0 {
+		hashEnd := int(di.hdr.HdrSz) + int(di.hdr.ImgSz)
+		hash := sha256.Sum256(data[:hashEnd])
+		if !bytes.Equal(hash[:], di.hash) {
+			return nil, di, util.FmtNewtError(
+				"Image %s hash mismatch; trailer=%x calculated=%x",
+				imgPath, di.hash, hash)
+		}
+	}
+
+	return data, di, nil
+}
+
+// Creates a signing request for an image prepared for detached signing.
+func NewSigningRequest(imgPath string) (SigningRequest, error) {
+	data, di, err := readDetachedImage(imgPath)
+	if err != nil {
+		return SigningRequest{}, err
+	}
+
+	return SigningRequest{
+		Format:    SIGNING_REQUEST_FORMAT,
+		Image:     filepath.Base(imgPath),
+		Version:   di.hdr.Vers.String(),
+		KeyId:     int(di.hdr.KeyId),
+		ImageSize: len(data),
+		HashAlg:   SIGNING_HASH_ALG,
+		SigAlg:    detachedSigTypeName(di.sigType),
+		Digest:    hex.EncodeToString(di.hash),
+	}, nil
+}
+
+// Writes a signing request for an image prepared for detached signing to the
+// specified file.
+func WriteSigningRequest(imgPath string, reqPath string) error {
+	req, err := NewSigningRequest(imgPath)
+	if err != nil {
+		return err
+	}
+
+	buf, err := json.MarshalIndent(req, "", "  ")
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	if err := ioutil.WriteFile(reqPath, append(buf, '\n'), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Adds the signature in a signing response to the image it was requested
+// for.  The response's digest must match the image's; this guards against
+// injecting a signature meant for another image.  The image file is
+// rewritten in place.
+func InjectSigningResponse(imgPath string, respPath string) error {
+	buf, err := ioutil.ReadFile(respPath)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	resp := SigningResponse{}
+	if err := json.Unmarshal(buf, &resp); err != nil {
+		return util.FmtNewtError(
+			"Signing response %s is not valid JSON: %s",
+			respPath, err.Error())
+	}
+
+	digest, err := hex.DecodeString(resp.Digest)
+	if err != nil || len(digest) == 0 {
+		return util.FmtNewtError(
+			"Signing response %s contains invalid digest: \"%s\"",
+			respPath, resp.Digest)
+	}
+	sig, err := hex.DecodeString(resp.Signature)
+	if err != nil || len(sig) == 0 {
+		return util.FmtNewtError(
+			"Signing response %s contains invalid signature", respPath)
+	}
+
+	_, di, err := readDetachedImage(imgPath)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(digest, di.hash) {
+		return util.FmtNewtError(
+			"Signing response %s is for a different image; "+
+				"response digest=%x image digest=%x",
+			respPath, digest, di.hash)
+	}
+
+	return injectSignatureData(imgPath, sig, "Signing response "+respPath)
+}
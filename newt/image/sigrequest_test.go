@@ -0,0 +1,129 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A signing request describes the image; the corresponding response signs
+// it.
+func TestSigningRequest(t *testing.T) {
+	dir, _, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	keyPath := filepath.Join(dir, "signer.pem")
+	key := testWriteEcKey(t, keyPath)
+	keys, err := LoadTrustStore([]string{keyPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imgPath := testBuildImage(t, dir, binPath, func(img *Image) {
+		img.DetachedSigType = IMAGE_TLV_ECDSA224
+		img.DigestPath = DigestPath(img.TargetImg)
+		img.KeyId = 3
+	})
+	data, err := ioutil.ReadFile(imgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := ioutil.ReadFile(DigestPath(imgPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reqPath := SigningRequestPath(imgPath)
+	if err := WriteSigningRequest(imgPath, reqPath); err != nil {
+		t.Fatal(err)
+	}
+	reqJson, err := ioutil.ReadFile(reqPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := SigningRequest{}
+	if err := json.Unmarshal(reqJson, &req); err != nil {
+		t.Fatal(err)
+	}
+
+	want := SigningRequest{
+		Format:    SIGNING_REQUEST_FORMAT,
+		Image:     "app.img",
+		Version:   "1.2.3.4",
+		KeyId:     3,
+		ImageSize: len(data),
+		HashAlg:   SIGNING_HASH_ALG,
+		SigAlg:    DETACHED_SIG_ECDSA224,
+		Digest:    hex.EncodeToString(digest),
+	}
+	if req != want {
+		t.Errorf("signing request %+v; want %+v", req, want)
+	}
+
+	writeResp := func(digest []byte, sig []byte) string {
+		respPath := filepath.Join(dir, "resp.json")
+		buf, err := json.Marshal(SigningResponse{
+			Digest:    hex.EncodeToString(digest),
+			Signature: hex.EncodeToString(sig),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(respPath, buf, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return respPath
+	}
+
+	// A response for another image is rejected.
+	other := make([]byte, len(digest))
+	err = InjectSigningResponse(imgPath,
+		writeResp(other, testSignDigest(t, key, other)))
+	if err == nil || !strings.Contains(err.Error(), "different image") {
+		t.Errorf("response for other image: got error %v", err)
+	}
+
+	// A response without a signature is rejected.
+	if err := InjectSigningResponse(imgPath,
+		writeResp(digest, nil)); err == nil {
+
+		t.Errorf("response without signature: expected error")
+	}
+
+	err = InjectSigningResponse(imgPath,
+		writeResp(digest, testSignDigest(t, key, digest)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyImage(imgPath, keys); err != nil {
+		t.Errorf("signed image does not verify: %s", err.Error())
+	}
+
+	// A signed image no longer awaits a signature.
+	if _, err := NewSigningRequest(imgPath); err == nil {
+		t.Errorf("signing request for signed image: expected error")
+	}
+}
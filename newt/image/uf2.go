@@ -0,0 +1,164 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// A UF2 file consists of 512-byte blocks, each of which carries 256 bytes
+// of data destined for a particular flash address:
+//
+//   Magic start 0 (0x0a324655)                  uint32
+//   Magic start 1 (0x9e5d5157)                  uint32
+//   Flags                                       uint32
+//   Target address                              uint32
+//   Payload size (256)                          uint32
+//   Block number (starting at 0)                uint32
+//   Total number of blocks                      uint32
+//   Family ID                                   uint32
+//   Data (payload followed by zero padding)     476 bytes
+//   Magic end (0x0ab16f30)                      uint32
+//
+// All integers are little endian.  The family ID identifies the type of
+// device the file is intended for; boot loaders reject files for other
+// families.
+
+const UF2_MAGIC_START0 = 0x0a324655
+const UF2_MAGIC_START1 = 0x9e5d5157
+const UF2_MAGIC_END = 0x0ab16f30
+
+const UF2_BLOCK_SZ = 512
+const UF2_PAYLOAD_SZ = 256
+const UF2_DATA_SZ = 476
+
+const UF2_FLAG_FAMILY_ID_PRESENT = 0x00002000
+
+type Uf2BlockHdr struct {
+	Magic0    uint32
+	Magic1    uint32
+	Flags     uint32
+	Addr      uint32
+	PayloadSz uint32
+	BlockNo   uint32
+	NumBlocks uint32
+	FamilyId  uint32
+}
+
+// Family IDs of common devices, as registered in the UF2 specification.
+var uf2Families = map[string]uint32{
+	"atmega32":  0x16573617,
+	"esp32s2":   0xbfdd4eee,
+	"nrf51":     0x1b57745f,
+	"nrf52":     0x1b57745f,
+	"nrf52833":  0x621e937a,
+	"nrf52840":  0xada52840,
+	"rp2040":    0xe48bff56,
+	"samd21":    0x68ed2b88,
+	"samd51":    0x55114460,
+	"stm32f1":   0x5ee21072,
+	"stm32f4":   0x57755a57,
+	"stm32f407": 0x6d0922fa,
+	"stm32f7":   0x53b80f00,
+	"stm32l4":   0x00ff6919,
+}
+
+// Parses a UF2 family ID.  The ID is either a number or the name of a known
+// device family (e.g., "nrf52840").
+func ParseUf2Family(s string) (uint32, error) {
+	if id, ok := uf2Families[strings.ToLower(s)]; ok {
+		return id, nil
+	}
+
+	id, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		names := make([]string, 0, len(uf2Families))
+		for name, _ := range uf2Families {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return 0, util.FmtNewtError(
+			"Invalid UF2 family \"%s\"; must be a number or one of: %s",
+			s, strings.Join(names, ", "))
+	}
+
+	return uint32(id), nil
+}
+
+// Converts a binary into UF2 blocks.  The binary is placed at baseAddr.  If
+// the binary's size is not a multiple of the payload size, the final block
+// is padded with 0xff (erased flash).
+func Uf2Encode(data []byte, baseAddr uint32, familyId uint32) []byte {
+	numBlocks := (len(data) + UF2_PAYLOAD_SZ - 1) / UF2_PAYLOAD_SZ
+	buf := &bytes.Buffer{}
+
+	for i := 0; i < numBlocks; i++ {
+		hdr := Uf2BlockHdr{
+			Magic0:    UF2_MAGIC_START0,
+			Magic1:    UF2_MAGIC_START1,
+			Flags:     UF2_FLAG_FAMILY_ID_PRESENT,
+			Addr:      baseAddr + uint32(i*UF2_PAYLOAD_SZ),
+			PayloadSz: UF2_PAYLOAD_SZ,
+			BlockNo:   uint32(i),
+			NumBlocks: uint32(numBlocks),
+			FamilyId:  familyId,
+		}
+		binary.Write(buf, binary.LittleEndian, hdr)
+
+		payload := bytes.Repeat([]byte{0xff}, UF2_PAYLOAD_SZ)
+		copy(payload, data[i*UF2_PAYLOAD_SZ:])
+		buf.Write(payload)
+		buf.Write(make([]byte, UF2_DATA_SZ-UF2_PAYLOAD_SZ))
+
+		binary.Write(buf, binary.LittleEndian, uint32(UF2_MAGIC_END))
+	}
+
+	return buf.Bytes()
+}
+
+// Converts the image file at imgPath into a UF2 file at uf2Path.  The image
+// is placed at baseAddr, the start of the slot it is written to.
+func WriteUf2(imgPath string, uf2Path string, baseAddr uint32,
+	familyId uint32) error {
+
+	data, err := ioutil.ReadFile(imgPath)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	uf2 := Uf2Encode(data, baseAddr, familyId)
+	if err := ioutil.WriteFile(uf2Path, uf2, 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"UF2 image successfully generated: %s (%d blocks at 0x%08x)\n",
+		uf2Path, len(uf2)/UF2_BLOCK_SZ, baseAddr)
+
+	return nil
+}
@@ -0,0 +1,132 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseUf2Family(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint32
+		wantErr bool
+	}{
+		{"nrf52840", 0xada52840, false},
+		{"NRF52840", 0xada52840, false},
+		{"0xada52840", 0xada52840, false},
+		{"1234", 1234, false},
+		{"bogus", 0, true},
+		{"0x100000000", 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseUf2Family(test.in)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseUf2Family(%q): expected error", test.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseUf2Family(%q): unexpected error: %s",
+				test.in, err.Error())
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseUf2Family(%q) = 0x%08x; want 0x%08x",
+				test.in, got, test.want)
+		}
+	}
+}
+
+func TestUf2Encode(t *testing.T) {
+	const base = 0x8000
+	const family = 0xada52840
+
+	tests := []struct {
+		size      int
+		numBlocks int
+	}{
+		{0, 0},
+		{1, 1},
+		{UF2_PAYLOAD_SZ, 1},
+		{UF2_PAYLOAD_SZ + 1, 2},
+		{3*UF2_PAYLOAD_SZ - 7, 3},
+	}
+
+	for _, test := range tests {
+		data := make([]byte, test.size)
+		for i, _ := range data {
+			data[i] = byte(i % 251)
+		}
+
+		uf2 := Uf2Encode(data, base, family)
+		if len(uf2) != test.numBlocks*UF2_BLOCK_SZ {
+			t.Errorf("size %d: encoded %d bytes; want %d blocks",
+				test.size, len(uf2), test.numBlocks)
+			continue
+		}
+
+		decoded := []byte{}
+		for i := 0; i < test.numBlocks; i++ {
+			block := uf2[i*UF2_BLOCK_SZ : (i+1)*UF2_BLOCK_SZ]
+
+			hdr := Uf2BlockHdr{}
+			binary.Read(bytes.NewReader(block), binary.LittleEndian, &hdr)
+			want := Uf2BlockHdr{
+				Magic0:    UF2_MAGIC_START0,
+				Magic1:    UF2_MAGIC_START1,
+				Flags:     UF2_FLAG_FAMILY_ID_PRESENT,
+				Addr:      base + uint32(i*UF2_PAYLOAD_SZ),
+				PayloadSz: UF2_PAYLOAD_SZ,
+				BlockNo:   uint32(i),
+				NumBlocks: uint32(test.numBlocks),
+				FamilyId:  family,
+			}
+			if hdr != want {
+				t.Errorf("size %d: block %d header %+v; want %+v",
+					test.size, i, hdr, want)
+			}
+
+			end := binary.LittleEndian.Uint32(block[UF2_BLOCK_SZ-4:])
+			if end != UF2_MAGIC_END {
+				t.Errorf("size %d: block %d end magic 0x%08x", test.size,
+					i, end)
+			}
+
+			decoded = append(decoded, block[32:32+UF2_PAYLOAD_SZ]...)
+		}
+
+		// The final block is padded with erased flash.
+		if test.numBlocks > 0 {
+			if !bytes.Equal(decoded[:test.size], data) {
+				t.Errorf("size %d: payload mismatch", test.size)
+			}
+			pad := decoded[test.size:]
+			if !bytes.Equal(pad, bytes.Repeat([]byte{0xff}, len(pad))) {
+				t.Errorf("size %d: final block not padded with 0xff",
+					test.size)
+			}
+		}
+	}
+}
@@ -0,0 +1,319 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// A public key that image signatures are checked against.  Exactly one of
+// RSA and EC is non-nil.
+type TrustedKey struct {
+	Name string
+	RSA  *rsa.PublicKey
+	EC   *ecdsa.PublicKey
+}
+
+// Extracts a public key from a single PEM block.  Private keys are accepted
+// as well; only their public part is used.
+func parseTrustedKey(block *pem.Block) (*rsa.PublicKey, *ecdsa.PublicKey,
+	error) {
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch key := pub.(type) {
+		case *rsa.PublicKey:
+			return key, nil, nil
+		case *ecdsa.PublicKey:
+			return nil, key, nil
+		default:
+			return nil, nil, fmt.Errorf("unsupported public key type")
+		}
+
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		return key, nil, err
+
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &key.PublicKey, nil, nil
+
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, &key.PublicKey, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported PEM block type \"%s\"",
+			block.Type)
+	}
+}
+
+// Reads every key from a PEM file.  A file containing several keys yields a
+// key for each; the keys are named "<path>#<index>".
+func readTrustedKeyFile(path string) ([]TrustedKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	blocks := []*pem.Block{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+
+	if len(blocks) == 0 {
+		return nil, util.FmtNewtError("Key file %s contains no PEM data",
+			path)
+	}
+
+	keys := make([]TrustedKey, len(blocks))
+	for i, block := range blocks {
+		keys[i].Name = path
+		if len(blocks) > 1 {
+			keys[i].Name = fmt.Sprintf("%s#%d", path, i)
+		}
+
+		keys[i].RSA, keys[i].EC, err = parseTrustedKey(block)
+		if err != nil {
+			return nil, util.FmtNewtError("Invalid key in %s: %s",
+				keys[i].Name, err.Error())
+		}
+	}
+
+	return keys, nil
+}
+
+// Loads a trust store from the specified paths.  Each path is either a PEM
+// key file or a directory; every "*.pem" file in a directory is loaded, in
+// alphabetical order.  Stores may mix RSA and EC keys.
+func LoadTrustStore(paths []string) ([]TrustedKey, error) {
+	keys := []TrustedKey{}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+
+		files := []string{path}
+		if info.IsDir() {
+			files, err = filepath.Glob(filepath.Join(path, "*.pem"))
+			if err != nil {
+				return nil, util.ChildNewtError(err)
+			}
+			sort.Strings(files)
+		}
+
+		for _, file := range files {
+			fileKeys, err := readTrustedKeyFile(file)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, fileKeys...)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, util.NewNewtError("Trust store contains no keys")
+	}
+
+	return keys, nil
+}
+
+func findImageTlv(tlvs []ImageTlv, typ uint8) *ImageTlv {
+	for i, _ := range tlvs {
+		if tlvs[i].Header.Type == typ {
+			return &tlvs[i]
+		}
+	}
+
+	return nil
+}
+
+// Reads an image and checks its hash TLV against the image contents.  The
+// hash is recalculated unless the image is the second half of a split image,
+// whose hash covers the loader as well.  Returns the image's contents, header,
+// TLVs, and the hash TLV.
+func readVerifiedImage(imgPath string) ([]byte, ImageHdr, []ImageTlv,
+	*ImageTlv, error) {
+
+	data, err := ioutil.ReadFile(imgPath)
+	if err != nil {
+		return nil, ImageHdr{}, nil, nil, util.ChildNewtError(err)
+	}
+
+	hdr, _, trailer, err := parseImage(imgPath, data)
+	if err != nil {
+		return nil, hdr, nil, nil, err
+	}
+
+	tlvs, err := ReadImageTlvs(imgPath, 0)
+	if err != nil {
+		return nil, hdr, nil, nil, err
+	}
+
+	hashTlv := findImageTlv(tlvs, IMAGE_TLV_SHA256)
+	if hashTlv == nil {
+		return nil, hdr, nil, nil, util.FmtNewtError(
+			"Image %s does not contain a hash TLV", imgPath)
+	}
+
+	if err := CheckVersionTlvs(imgPath, hdr, tlvs); err != nil {
+		return nil, hdr, nil, nil, err
+	}
+
+	if hdr.Flags&IMAGE_F_NON_BOOTABLE == 0 {
+		hash := sha256.Sum256(data[:len(data)-len(trailer)])
+		if !bytes.Equal(hash[:], hashTlv.Data) {
+			return nil, hdr, nil, nil, util.FmtNewtError(
+				"Image %s hash mismatch; trailer=%x calculated=%x",
+				imgPath, hashTlv.Data, hash)
+		}
+	}
+
+	return data, hdr, tlvs, hashTlv, nil
+}
+
+// Calculates the hash of an image's header and payload; this is the value its
+// hash TLV records and the one OTA servers identify it by.  The hash of the
+// second half of a split image covers its loader, so it cannot be calculated
+// from the image alone.
+func CalcImageHash(imgPath string) ([]byte, error) {
+	data, err := ioutil.ReadFile(imgPath)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	hdr, _, trailer, err := parseImage(imgPath, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if hdr.Flags&IMAGE_F_NON_BOOTABLE != 0 {
+		return nil, util.FmtNewtError(
+			"Image %s is the second half of a split image; its hash covers "+
+				"the loader and cannot be calculated", imgPath)
+	}
+
+	hash := sha256.Sum256(data[:len(data)-len(trailer)])
+	return hash[:], nil
+}
+
+// Compares the hash of an image (see CalcImageHash) against an expected
+// value, specified as hex.  Returns the calculated hash and whether it
+// matches.
+func CheckImageHash(imgPath string, expectedHex string) ([]byte, bool,
+	error) {
+
+	digits := strings.TrimPrefix(
+		strings.ToLower(strings.TrimSpace(expectedHex)), "0x")
+	expected, err := hex.DecodeString(digits)
+	if err != nil || len(expected) != sha256.Size {
+		return nil, false, util.FmtNewtError(
+			"Invalid expected hash \"%s\"; must be %d hex-encoded bytes",
+			expectedHex, sha256.Size)
+	}
+
+	hash, err := CalcImageHash(imgPath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return hash, bytes.Equal(hash, expected), nil
+}
+
+// Checks the signature TLVs of an image against a trust store.  The image
+// validates if any trusted key verifies any of its signatures; the matching
+// key is returned.  The image hash is checked first; see readVerifiedImage.
+func VerifyImage(imgPath string, keys []TrustedKey) (*TrustedKey, error) {
+	_, _, tlvs, hashTlv, err := readVerifiedImage(imgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaTlv := findImageTlv(tlvs, IMAGE_TLV_RSA2048)
+	ecTlv := findImageTlv(tlvs, IMAGE_TLV_ECDSA224)
+	if rsaTlv == nil && ecTlv == nil {
+		return nil, util.FmtNewtError(
+			"Image %s does not contain a signature TLV", imgPath)
+	}
+
+	var ecSig ECDSASig
+	if ecTlv != nil {
+		// The signature is zero-padded to the TLV's fixed size.
+		if _, err := asn1.Unmarshal(ecTlv.Data, &ecSig); err != nil {
+			return nil, util.FmtNewtError(
+				"Image %s contains malformed ECDSA signature: %s",
+				imgPath, err.Error())
+		}
+	}
+
+	for i, _ := range keys {
+		key := &keys[i]
+
+		if key.RSA != nil && rsaTlv != nil {
+			err := rsa.VerifyPKCS1v15(key.RSA, crypto.SHA256, hashTlv.Data,
+				rsaTlv.Data)
+			if err == nil {
+				return key, nil
+			}
+		}
+
+		if key.EC != nil && ecTlv != nil {
+			if ecdsa.Verify(key.EC, hashTlv.Data, ecSig.R, ecSig.S) {
+				return key, nil
+			}
+		}
+	}
+
+	return nil, util.FmtNewtError(
+		"Image %s is not signed by any trusted key", imgPath)
+}
@@ -0,0 +1,293 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Generates an EC signing key and writes it to the specified path as PEM.
+func testWriteEcKey(t *testing.T, path string) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pemData := pem.EncodeToMemory(&pem.Block{
+		Type:  "EC PRIVATE KEY",
+		Bytes: der,
+	})
+	if err := ioutil.WriteFile(path, pemData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func TestLoadTrustStore(t *testing.T) {
+	dir, keyPath, _ := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	storeDir := filepath.Join(dir, "store")
+	if err := os.Mkdir(storeDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	testWriteEcKey(t, filepath.Join(storeDir, "b.pem"))
+	testWriteEcKey(t, filepath.Join(storeDir, "a.pem"))
+	if err := ioutil.WriteFile(filepath.Join(storeDir, "notes.txt"),
+		[]byte("not a key"), 0644); err != nil {
+
+		t.Fatal(err)
+	}
+
+	// Two keys in a single file.
+	multiPath := filepath.Join(dir, "multi.pem")
+	testWriteEcKey(t, multiPath)
+	first, err := ioutil.ReadFile(multiPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testWriteEcKey(t, multiPath)
+	second, err := ioutil.ReadFile(multiPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(multiPath, append(first, second...),
+		0644); err != nil {
+
+		t.Fatal(err)
+	}
+
+	badPath := filepath.Join(dir, "bad.pem")
+	if err := ioutil.WriteFile(badPath, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	emptyDir := filepath.Join(dir, "empty")
+	if err := os.Mkdir(emptyDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		paths   []string
+		want    []string
+		wantErr bool
+	}{
+		{"file", []string{keyPath}, []string{keyPath}, false},
+		{
+			"directory",
+			[]string{storeDir},
+			[]string{
+				filepath.Join(storeDir, "a.pem"),
+				filepath.Join(storeDir, "b.pem"),
+			},
+			false,
+		},
+		{
+			"multiple keys in file",
+			[]string{multiPath},
+			[]string{multiPath + "#0", multiPath + "#1"},
+			false,
+		},
+		{"not pem", []string{badPath}, nil, true},
+		{"no keys", []string{emptyDir}, nil, true},
+		{"missing", []string{filepath.Join(dir, "missing")}, nil, true},
+	}
+
+	for _, test := range tests {
+		keys, err := LoadTrustStore(test.paths)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+
+		names := []string{}
+		for _, key := range keys {
+			if key.EC == nil || key.RSA != nil {
+				t.Errorf("%s: key %s is not an EC key", test.name, key.Name)
+			}
+			names = append(names, key.Name)
+		}
+		if strings.Join(names, " ") != strings.Join(test.want, " ") {
+			t.Errorf("%s: loaded keys %v; want %v", test.name, names,
+				test.want)
+		}
+	}
+}
+
+func TestVerifyImage(t *testing.T) {
+	dir, keyPath, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	otherPath := filepath.Join(dir, "other.pem")
+	testWriteEcKey(t, otherPath)
+
+	trusted, err := LoadTrustStore([]string{otherPath, keyPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	untrusted, err := LoadTrustStore([]string{otherPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		signed  bool
+		tamper  bool
+		keys    []TrustedKey
+		want    string // Name of the matching key; "" for an error.
+		wantErr string
+	}{
+		{"trusted", true, false, trusted, keyPath, ""},
+		{"untrusted", true, false, untrusted, "",
+			"is not signed by any trusted key"},
+		{"unsigned", false, false, trusted, "",
+			"does not contain a signature TLV"},
+		{"tampered", true, true, trusted, "", "hash mismatch"},
+	}
+
+	for _, test := range tests {
+		imgPath := testGenerateImage(t, dir, keyPath, binPath, 0,
+			test.signed)
+		if test.tamper {
+			data, err := ioutil.ReadFile(imgPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data[IMAGE_HEADER_SIZE] ^= 0xff
+			if err := ioutil.WriteFile(imgPath, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		key, err := VerifyImage(imgPath, test.keys)
+		if test.wantErr != "" {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			} else if !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error \"%s\" does not contain \"%s\"",
+					test.name, err.Error(), test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+		if key.Name != test.want {
+			t.Errorf("%s: verified by %s; want %s", test.name, key.Name,
+				test.want)
+		}
+	}
+}
+
+func TestCheckImageHash(t *testing.T) {
+	dir, _, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	imgPath := testBuildImage(t, dir, binPath, nil)
+	tlvs, err := ReadImageTlvs(imgPath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashTlv := findImageTlv(tlvs, IMAGE_TLV_SHA256)
+	if hashTlv == nil {
+		t.Fatal("image has no hash TLV")
+	}
+	hashHex := hex.EncodeToString(hashTlv.Data)
+
+	tests := []struct {
+		name     string
+		expected string
+		match    bool
+		wantErr  bool
+	}{
+		{"match", hashHex, true, false},
+		{"upper case", strings.ToUpper(hashHex), true, false},
+		{"prefixed", " 0x" + hashHex + "\n", true, false},
+		{"mismatch", strings.Repeat("00", 32), false, false},
+		{"short", hashHex[:62], false, true},
+		{"not hex", strings.Repeat("zz", 32), false, true},
+	}
+
+	for _, test := range tests {
+		hash, match, err := CheckImageHash(imgPath, test.expected)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+
+		// The calculated hash is the one recorded in the hash TLV.
+		if !bytes.Equal(hash, hashTlv.Data) {
+			t.Errorf("%s: calculated hash %x; TLV records %x", test.name,
+				hash, hashTlv.Data)
+		}
+		if match != test.match {
+			t.Errorf("%s: match=%v; want %v", test.name, match, test.match)
+		}
+	}
+}
+
+func testWriteRsaKey(t *testing.T, path string) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pemData := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	if err := ioutil.WriteFile(path, pemData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
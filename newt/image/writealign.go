@@ -0,0 +1,79 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Ensures an image file's length is a multiple of writeSize, the program
+// unit of the flash device the image is written to.  A controller that only
+// programs whole units cannot write the final partial unit of a shorter
+// image.  If pad is true, a misaligned file is extended with padVal (the
+// device's erase value) to the next multiple, and the number of bytes added
+// is returned; otherwise, a misaligned file is an error.  The padding follows
+// the trailer, so it is neither hashed nor counted in the header's TLV size.
+func CheckWriteAlign(imgPath string, writeSize int, pad bool,
+	padVal byte) (int, error) {
+
+	if writeSize < 1 {
+		return 0, util.FmtNewtError(
+			"Invalid flash write size: %d", writeSize)
+	}
+
+	data, err := ioutil.ReadFile(imgPath)
+	if err != nil {
+		return 0, util.ChildNewtError(err)
+	}
+
+	// Ensure the file is a valid image before extending it.
+	if _, _, _, err := parseImage(imgPath, data); err != nil {
+		return 0, err
+	}
+
+	rem := len(data) % writeSize
+	if rem == 0 {
+		return 0, nil
+	}
+
+	padLen := writeSize - rem
+	if !pad {
+		return 0, util.FmtNewtError(
+			"Image %s length (%d) is not a multiple of the flash write "+
+				"size (%d); %d byte(s) of padding required",
+			imgPath, len(data), writeSize, padLen)
+	}
+
+	f, err := os.OpenFile(imgPath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return 0, util.ChildNewtError(err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(bytes.Repeat([]byte{padVal}, padLen)); err != nil {
+		return 0, util.ChildNewtError(err)
+	}
+
+	return padLen, nil
+}
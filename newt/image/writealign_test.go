@@ -0,0 +1,113 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package image
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCheckWriteAlign(t *testing.T) {
+	dir, keyPath, binPath := testImageFiles(t)
+	defer os.RemoveAll(dir)
+
+	imgPath := testGenerateImage(t, dir, keyPath, binPath, 0, false)
+	orig, err := ioutil.ReadFile(imgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		writeSize int
+		pad       bool
+		wantErr   bool
+	}{
+		{1, false, false},
+		{len(orig), false, false},
+		{len(orig) + 8, false, true},
+		{len(orig) + 8, true, false},
+		{0x100, true, false},
+		{0, true, true},
+	}
+
+	for _, test := range tests {
+		if err := ioutil.WriteFile(imgPath, orig, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		padLen, err := CheckWriteAlign(imgPath, test.writeSize, test.pad,
+			0xa5)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("writeSize=%d pad=%v: expected error",
+					test.writeSize, test.pad)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("writeSize=%d pad=%v: unexpected error: %v",
+				test.writeSize, test.pad, err)
+			continue
+		}
+
+		wantPad := 0
+		if rem := len(orig) % test.writeSize; rem != 0 {
+			wantPad = test.writeSize - rem
+		}
+		if padLen != wantPad {
+			t.Errorf("writeSize=%d: padded %d bytes; want %d",
+				test.writeSize, padLen, wantPad)
+		}
+
+		data, err := ioutil.ReadFile(imgPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data)%test.writeSize != 0 {
+			t.Errorf("writeSize=%d: length %d not a multiple",
+				test.writeSize, len(data))
+		}
+		if !bytes.Equal(data[:len(orig)], orig) ||
+			!bytes.Equal(data[len(orig):],
+				bytes.Repeat([]byte{0xa5}, wantPad)) {
+
+			t.Errorf("writeSize=%d: image not padded with erase value",
+				test.writeSize)
+		}
+
+		// The padding follows the trailer and does not disturb the TLVs.
+		if _, err := ReadImageTlvs(imgPath, 0); err != nil {
+			t.Errorf("writeSize=%d: padded image unreadable: %v",
+				test.writeSize, err)
+		}
+	}
+
+	// A file that is not an image is never padded.
+	if err := ioutil.WriteFile(imgPath, []byte("not an image"), 0644); err !=
+		nil {
+
+		t.Fatal(err)
+	}
+	if _, err := CheckWriteAlign(imgPath, 8, true, 0xff); err == nil {
+		t.Errorf("expected error for invalid image")
+	}
+}
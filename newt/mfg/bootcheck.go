@@ -0,0 +1,119 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/util"
+)
+
+// Inspects a boot area for evidence of a boot loader.  data contains the
+// flash device holding the area, starting at the device's first byte.  An
+// area that is entirely erased is reported as empty.  If magic is non-nil,
+// the area must contain it at magicOff.  A nil result indicates the area
+// looks correctly populated.
+func checkBootArea(data []byte, area flash.FlashArea, magic []byte,
+	magicOff int, eraseVal byte) *VerifyProblem {
+
+	problem := func(format string, args ...interface{}) *VerifyProblem {
+		return &VerifyProblem{area.Name, fmt.Sprintf(format, args...)}
+	}
+
+	end := area.Offset + area.Size
+	if end > len(data) {
+		end = len(data)
+	}
+	if area.Offset >= end {
+		return problem("area beyond end of data; offset=0x%x data-size=0x%x",
+			area.Offset, len(data))
+	}
+	contents := data[area.Offset:end]
+
+	if len(trimErased(contents, eraseVal)) == 0 {
+		return problem("area is empty; no boot loader present")
+	}
+
+	if magic == nil {
+		return nil
+	}
+
+	if magicOff+len(magic) > len(contents) {
+		return problem("boot magic extends beyond area; offset=0x%x "+
+			"magic-size=%d area-size=%d", magicOff, len(magic),
+			len(contents))
+	}
+
+	actual := contents[magicOff : magicOff+len(magic)]
+	if !bytes.Equal(actual, magic) {
+		return problem("boot magic mismatch at offset 0x%x; "+
+			"expected=%x actual=%x", magicOff, magic, actual)
+	}
+
+	return nil
+}
+
+// Confirms that each boot area contains a boot loader.  If dumpPath is
+// non-empty, it names a raw dump of flash device 0; otherwise, the
+// previously created manufacturing image is inspected.  The expected magic
+// is specified by the BSP's bsp.boot_magic and bsp.boot_magic_offset
+// settings; without them, areas are only checked for being empty.
+func (mi *MfgImage) CheckBoot(dumpPath string) ([]VerifyProblem, error) {
+	path := dumpPath
+	if path == "" {
+		path = mi.sectionBinPath(0)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	problems := []VerifyProblem{}
+	for _, name := range mi.bootAreas {
+		area, ok := mi.bsp.FlashMap.Areas[name]
+		if !ok {
+			return nil, util.FmtNewtError(
+				"Boot area \"%s\" not defined in flash map", name)
+		}
+		if area.Device != 0 {
+			return nil, util.FmtNewtError(
+				"Boot area \"%s\" not in flash device 0", name)
+		}
+
+		if p := checkBootArea(data, area, mi.bsp.BootMagic,
+			mi.bsp.BootMagicOffset,
+			mi.bsp.FlashMap.EraseVal(area.Device)); p != nil {
+
+			problems = append(problems, *p)
+		}
+	}
+
+	return problems, nil
+}
+
+// Indicates whether the BSP specifies the boot magic that CheckBoot looks
+// for.
+func (mi *MfgImage) HasBootMagic() bool {
+	return mi.bsp.BootMagic != nil
+}
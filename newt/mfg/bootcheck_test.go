@@ -0,0 +1,183 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/pkg"
+)
+
+func TestCheckBootArea(t *testing.T) {
+	area := flash.FlashArea{
+		Name:   flash.FLASH_AREA_NAME_BOOTLOADER,
+		Offset: 0x10,
+		Size:   0x20,
+	}
+
+	// Device contents with a boot loader beginning "\x3d\xb8\xf3\x96".
+	populated := bytes.Repeat([]byte{0xff}, 0x40)
+	copy(populated[0x10:], []byte{0x3d, 0xb8, 0xf3, 0x96, 0x01, 0x02})
+
+	tests := []struct {
+		name     string
+		data     []byte
+		magic    []byte
+		magicOff int
+		want     string
+	}{
+		{
+			name: "populated; no magic",
+			data: populated,
+		},
+		{
+			name:  "magic at start",
+			data:  populated,
+			magic: []byte{0x3d, 0xb8, 0xf3, 0x96},
+		},
+		{
+			name:     "magic at offset",
+			data:     populated,
+			magic:    []byte{0x01, 0x02},
+			magicOff: 4,
+		},
+		{
+			name: "erased",
+			data: bytes.Repeat([]byte{0xff}, 0x40),
+			want: "area is empty",
+		},
+		{
+			name:  "wrong magic",
+			data:  populated,
+			magic: []byte{0xaa, 0xbb},
+			want:  "boot magic mismatch",
+		},
+		{
+			name:     "magic beyond area",
+			data:     populated,
+			magic:    []byte{0x3d, 0xb8},
+			magicOff: 0x1f,
+			want:     "extends beyond area",
+		},
+		{
+			name: "truncated data",
+			data: populated[:0x8],
+			want: "beyond end of data",
+		},
+	}
+
+	for _, test := range tests {
+		p := checkBootArea(test.data, area, test.magic, test.magicOff, 0xff)
+		if test.want == "" {
+			if p != nil {
+				t.Errorf("%s: unexpected problem: %s", test.name, p.String())
+			}
+			continue
+		}
+		if p == nil {
+			t.Errorf("%s: expected problem containing \"%s\"; got none",
+				test.name, test.want)
+			continue
+		}
+		if p.Area != area.Name || !strings.Contains(p.Text, test.want) {
+			t.Errorf("%s: expected problem containing \"%s\" in area %s; "+
+				"got %s", test.name, test.want, area.Name, p.String())
+		}
+	}
+}
+
+func TestCheckBoot(t *testing.T) {
+	fm := testFlashMap(t)
+
+	dump := bytes.Repeat([]byte{0xff}, 0x8000)
+	copy(dump, []byte{0x3d, 0xb8, 0xf3, 0x96})
+
+	dir, path := testSectionFile(t, dump)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name      string
+		bootAreas []string
+		magic     []byte
+		problems  int
+		wantErr   string
+	}{
+		{
+			name:      "matching magic",
+			bootAreas: []string{flash.FLASH_AREA_NAME_BOOTLOADER},
+			magic:     []byte{0x3d, 0xb8, 0xf3, 0x96},
+		},
+		{
+			name:      "mismatched magic",
+			bootAreas: []string{flash.FLASH_AREA_NAME_BOOTLOADER},
+			magic:     []byte{0x00, 0x00},
+			problems:  1,
+		},
+		{
+			name: "empty boot area",
+			bootAreas: []string{
+				flash.FLASH_AREA_NAME_BOOTLOADER,
+				flash.FLASH_AREA_NAME_IMAGE_1,
+			},
+			problems: 1,
+		},
+		{
+			name:      "undefined area",
+			bootAreas: []string{"FLASH_AREA_BOGUS"},
+			wantErr:   "not defined in flash map",
+		},
+		{
+			name:      "area not in device 0",
+			bootAreas: []string{"FLASH_AREA_DATA"},
+			wantErr:   "not in flash device 0",
+		},
+	}
+
+	for _, test := range tests {
+		mi := &MfgImage{
+			bsp: &pkg.BspPackage{
+				FlashMap:  fm,
+				BootMagic: test.magic,
+			},
+			bootAreas: test.bootAreas,
+		}
+
+		problems, err := mi.CheckBoot(path)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: expected error containing \"%s\"; got %v",
+					test.name, test.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+		if len(problems) != test.problems {
+			t.Errorf("%s: got %d problems (%v); want %d",
+				test.name, len(problems), problems, test.problems)
+		}
+	}
+}
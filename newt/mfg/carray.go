@@ -0,0 +1,124 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// The number of bytes on each line of a generated C array.
+const cArrayBytesPerLine = 12
+
+var cIdentInvalidRe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Converts an arbitrary string (e.g., a package name) into a valid C
+// identifier.
+func cIdent(s string) string {
+	s = cIdentInvalidRe.ReplaceAllString(s, "_")
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		s = "_" + s
+	}
+	return s
+}
+
+// Generates C source containing a meta region as a uint8_t array.  Macros
+// give the region's size and the offsets, relative to the start of the region,
+// of the integrity values and each TLV.  The layout's offsets are relative to
+// the start of section 0, as usual.
+func metaCArray(name string, region []byte, layout MetaLayout) string {
+	ident := cIdent(name)
+	prefix := strings.ToUpper(ident)
+	b := &bytes.Buffer{}
+
+	b.WriteString("/* Meta region of manufacturing image " + name + ".\n")
+	b.WriteString(" * Generated by newt; do not edit. */\n\n")
+
+	define := func(suffix string, val int) {
+		fmt.Fprintf(b, "#define %-48s %d\n", prefix+"_"+suffix, val)
+	}
+
+	define("SIZE", len(region))
+	define("HASH_OFF", layout.HashOffset-layout.Offset)
+	if layout.HmacOffset != 0 {
+		define("HMAC_OFF", layout.HmacOffset-layout.Offset)
+	}
+	if layout.CrcOffset != 0 {
+		define("CRC_OFF", layout.CrcOffset-layout.Offset)
+	}
+	if layout.RegionCrcOffset != 0 {
+		define("REGION_CRC_OFF", layout.RegionCrcOffset-layout.Offset)
+	}
+
+	// Flash area TLVs are named after their areas; the others are named
+	// after their TLV type.
+	for _, tlv := range layout.Tlvs {
+		tlvName := tlv.Name
+		if tlv.Type != META_TLV_CODE_FLASH_AREA || tlvName == "" {
+			tlvName = strings.TrimPrefix(metaTlvName(uint8(tlv.Type)),
+				"META_TLV_CODE_")
+		}
+		define("TLV_"+strings.ToUpper(cIdent(tlvName))+"_OFF",
+			tlv.Offset-layout.Offset)
+	}
+	b.WriteString("\n")
+
+	fmt.Fprintf(b, "const uint8_t %s_meta[%d] = {\n", ident, len(region))
+	for i := 0; i < len(region); i += cArrayBytesPerLine {
+		b.WriteString("   ")
+		for j := i; j < len(region) && j < i+cArrayBytesPerLine; j++ {
+			fmt.Fprintf(b, " 0x%02x,", region[j])
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("};\n")
+
+	return b.String()
+}
+
+// Builds the manufacturing image and generates C source containing its
+// primary meta region as a uint8_t array; see metaCArray.  If the meta region
+// is chained, the secondary region is not included.
+func (mi *MfgImage) MetaCArray() (string, error) {
+	layout, err := mi.MetaLayout()
+	if err != nil {
+		return "", err
+	}
+
+	cs, err := mi.build()
+	if err != nil {
+		return "", err
+	}
+
+	section := cs.dsMap[layout.Section]
+	if layout.Offset+layout.Size > len(section) {
+		return "", util.FmtNewtError(
+			"Meta region (offset=0x%x size=%d) extends beyond section %d "+
+				"(size=%d)", layout.Offset, layout.Size, layout.Section,
+			len(section))
+	}
+	region := section[layout.Offset : layout.Offset+layout.Size]
+
+	return metaCArray(mi.basePkg.Name(), region, layout), nil
+}
@@ -0,0 +1,130 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCIdent(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"mfg_foo", "mfg_foo"},
+		{"mfgs/foo-bar", "mfgs_foo_bar"},
+		{"@apache-mynewt-core/mfg", "_apache_mynewt_core_mfg"},
+		{"2nd", "_2nd"},
+		{"", "_"},
+	}
+
+	for _, test := range tests {
+		if got := cIdent(test.in); got != test.want {
+			t.Errorf("cIdent(%q) = %q; want %q", test.in, got, test.want)
+		}
+	}
+}
+
+var cArrayByteRe = regexp.MustCompile(`0x([0-9a-f]{2}),`)
+var cDefineRe = regexp.MustCompile(`(?m)^#define (\S+)\s+(\d+)$`)
+
+func TestMetaCArray(t *testing.T) {
+	params := testMetaParams()
+	params.withHmac = true
+	section, _, layout := testInsertAndParse(t, params)
+	region := section[layout.Offset : layout.Offset+layout.Size]
+
+	src := metaCArray("mfgs/test-mfg", region, layout)
+
+	// The array contains exactly the region's bytes.
+	body := src[strings.Index(src, "{"):]
+	parsed := []byte{}
+	for _, m := range cArrayByteRe.FindAllStringSubmatch(body, -1) {
+		b, err := strconv.ParseUint(m[1], 16, 8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed = append(parsed, byte(b))
+	}
+	if !bytes.Equal(parsed, region) {
+		t.Errorf("array contents differ from meta region")
+	}
+
+	defines := map[string]int{}
+	for _, m := range cDefineRe.FindAllStringSubmatch(src, -1) {
+		defines[m[1]], _ = strconv.Atoi(m[2])
+	}
+
+	wantDefines := map[string]int{
+		"MFGS_TEST_MFG_SIZE":     len(region),
+		"MFGS_TEST_MFG_HASH_OFF": layout.HashOffset - layout.Offset,
+		"MFGS_TEST_MFG_HMAC_OFF": layout.HmacOffset - layout.Offset,
+		"MFGS_TEST_MFG_TLV_FLASH_AREA_BOOTLOADER_OFF": layout.Tlvs[0].Offset -
+			layout.Offset,
+	}
+	for name, want := range wantDefines {
+		got, ok := defines[name]
+		if !ok {
+			t.Errorf("missing #define %s", name)
+		} else if got != want {
+			t.Errorf("#define %s %d; want %d", name, got, want)
+		}
+	}
+	if _, ok := defines["MFGS_TEST_MFG_CRC_OFF"]; ok {
+		t.Errorf("unexpected CRC offset for region without CRC")
+	}
+
+	if !strings.Contains(src,
+		fmt.Sprintf("const uint8_t mfgs_test_mfg_meta[%d] = {", len(region))) {
+
+		t.Errorf("missing array declaration:\n%s", src)
+	}
+
+	if _, err := exec.LookPath("cc"); err != nil {
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "newt-carray-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "meta.c")
+	err = ioutil.WriteFile(path, []byte("#include <stdint.h>\n"+src), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("cc", "-fsyntax-only", "-Wall", "-Werror",
+		path).CombinedOutput()
+	if err != nil {
+		t.Errorf("generated source does not compile: %s\n%s", err.Error(),
+			out)
+	}
+}
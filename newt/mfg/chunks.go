@@ -0,0 +1,178 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Some programmers only accept small transfers.  For these, the sections of a
+// manufacturing image can additionally be written as a sequence of fixed-size
+// chunk files.  An index lists the chunks in programming order; each entry
+// records where the chunk is written and the CRC32 (IEEE) of its contents.
+// The final chunk of a section is shorter if the section size is not a
+// multiple of the chunk size.
+
+const MFG_CHUNK_INDEX_NAME = "chunks.json"
+
+type MfgChunk struct {
+	File   string `json:"file"`
+	Device int    `json:"device"`
+	// Offset within the device's section.
+	Offset int `json:"offset"`
+	// Offset plus the device's base address.
+	Address int    `json:"address"`
+	Size    int    `json:"size"`
+	Crc32   uint32 `json:"crc32"`
+}
+
+type MfgChunkIndex struct {
+	ChunkSize int        `json:"chunk_size"`
+	Chunks    []MfgChunk `json:"chunks"`
+}
+
+// Causes creation of the image to also emit its sections as chunk files of
+// the specified size, regardless of the mfg.chunk_size setting.
+func (mi *MfgImage) SetChunkSize(size int) {
+	mi.chunkSize = size
+}
+
+// Splits the specified sections into chunks.  The returned slice contains the
+// data of each chunk in the index.
+func splitChunks(dsMap map[int][]byte, chunkSize int, namePrefix string,
+	base func(device int) int) (MfgChunkIndex, [][]byte) {
+
+	devices := make([]int, 0, len(dsMap))
+	for device, _ := range dsMap {
+		devices = append(devices, device)
+	}
+	sort.Ints(devices)
+
+	index := MfgChunkIndex{
+		ChunkSize: chunkSize,
+		Chunks:    []MfgChunk{},
+	}
+	datas := [][]byte{}
+	for _, device := range devices {
+		section := dsMap[device]
+		for off := 0; off < len(section); off += chunkSize {
+			end := util.IntMin(off+chunkSize, len(section))
+			data := section[off:end]
+
+			index.Chunks = append(index.Chunks, MfgChunk{
+				File: fmt.Sprintf("%s-s%d-c%04d.bin", namePrefix, device,
+					off/chunkSize),
+				Device:  device,
+				Offset:  off,
+				Address: base(device) + off,
+				Size:    len(data),
+				Crc32:   crc32.ChecksumIEEE(data),
+			})
+			datas = append(datas, data)
+		}
+	}
+
+	return index, datas
+}
+
+// Writes the specified sections as chunk files, along with their index.  Any
+// chunks from a previous build are removed.
+func (mi *MfgImage) writeChunks(dsMap map[int][]byte) error {
+	dir := mi.ChunkDir()
+	if err := os.RemoveAll(dir); err != nil {
+		return util.ChildNewtError(err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	index, datas := splitChunks(dsMap, mi.chunkSize,
+		filepath.Base(mi.basePkg.Name()), mi.DeviceBase)
+
+	for i, chunk := range index.Chunks {
+		path := dir + "/" + chunk.File
+		if err := ioutil.WriteFile(path, datas[i], 0644); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+
+	buf, err := json.MarshalIndent(index, "", "    ")
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	if err := ioutil.WriteFile(mi.ChunkIndexPath(), buf, 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Reads a chunk index and the chunk files it lists, and reassembles the
+// sections they were split from; device => section.  Each chunk's size and
+// CRC are verified, and the chunks of a section must be contiguous.
+func ReassembleChunks(indexPath string) (map[int][]byte, error) {
+	buf, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	index := MfgChunkIndex{}
+	if err := json.Unmarshal(buf, &index); err != nil {
+		return nil, util.FmtNewtError(
+			"Failure decoding chunk index %s: %s", indexPath, err.Error())
+	}
+
+	dir := filepath.Dir(indexPath)
+	dsMap := map[int][]byte{}
+	for _, chunk := range index.Chunks {
+		data, err := ioutil.ReadFile(dir + "/" + chunk.File)
+		if err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+
+		if len(data) != chunk.Size {
+			return nil, util.FmtNewtError(
+				"Chunk %s size mismatch; index=%d file=%d",
+				chunk.File, chunk.Size, len(data))
+		}
+		if crc := crc32.ChecksumIEEE(data); crc != chunk.Crc32 {
+			return nil, util.FmtNewtError(
+				"Chunk %s CRC mismatch; index=0x%08x file=0x%08x",
+				chunk.File, chunk.Crc32, crc)
+		}
+		if chunk.Offset != len(dsMap[chunk.Device]) {
+			return nil, util.FmtNewtError(
+				"Chunk %s out of order; offset=0x%x, expected 0x%x",
+				chunk.File, chunk.Offset, len(dsMap[chunk.Device]))
+		}
+
+		dsMap[chunk.Device] = append(dsMap[chunk.Device], data...)
+	}
+
+	return dsMap, nil
+}
@@ -0,0 +1,166 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Writes the chunks of the specified sections and their index to dir, as
+// writeChunks does.  Returns the index path.
+func testWriteChunks(t *testing.T, dir string, dsMap map[int][]byte,
+	chunkSize int) (string, MfgChunkIndex) {
+
+	index, datas := splitChunks(dsMap, chunkSize, "test",
+		func(device int) int { return device * 0x10000000 })
+
+	for i, chunk := range index.Chunks {
+		err := ioutil.WriteFile(filepath.Join(dir, chunk.File), datas[i],
+			0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexPath := filepath.Join(dir, MFG_CHUNK_INDEX_NAME)
+	if err := ioutil.WriteFile(indexPath, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return indexPath, index
+}
+
+func TestChunksRoundTrip(t *testing.T) {
+	section0 := make([]byte, 0x1234)
+	for i := range section0 {
+		section0[i] = byte(i * 7)
+	}
+	dsMap := map[int][]byte{
+		0: section0,
+		1: bytes.Repeat([]byte{0x3c}, 0x800),
+	}
+
+	tests := []struct {
+		chunkSize  int
+		wantChunks int
+	}{
+		{0x100, 0x13 + 8},
+		{0x400, 5 + 2},
+		{0x800, 3 + 1},
+		{0x10000, 1 + 1},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "newt-chunks")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		indexPath, index := testWriteChunks(t, dir, dsMap, test.chunkSize)
+		if len(index.Chunks) != test.wantChunks {
+			t.Errorf("size=0x%x: %d chunks; want %d",
+				test.chunkSize, len(index.Chunks), test.wantChunks)
+		}
+
+		for _, chunk := range index.Chunks {
+			if chunk.Size > test.chunkSize {
+				t.Errorf("size=0x%x: chunk %s too large: %d",
+					test.chunkSize, chunk.File, chunk.Size)
+			}
+			if chunk.Address != chunk.Device*0x10000000+chunk.Offset {
+				t.Errorf("size=0x%x: chunk %s address=0x%x",
+					test.chunkSize, chunk.File, chunk.Address)
+			}
+			data := dsMap[chunk.Device][chunk.Offset : chunk.Offset+
+				chunk.Size]
+			if crc := crc32.ChecksumIEEE(data); crc != chunk.Crc32 {
+				t.Errorf("size=0x%x: chunk %s crc=%08x; want %08x",
+					test.chunkSize, chunk.File, chunk.Crc32, crc)
+			}
+		}
+
+		got, err := ReassembleChunks(indexPath)
+		if err != nil {
+			t.Fatalf("size=0x%x: %v", test.chunkSize, err)
+		}
+		for device, section := range dsMap {
+			if !bytes.Equal(got[device], section) {
+				t.Errorf("size=0x%x: section %d does not reassemble",
+					test.chunkSize, device)
+			}
+		}
+	}
+}
+
+func TestChunksCorrupt(t *testing.T) {
+	dsMap := map[int][]byte{0: bytes.Repeat([]byte{0x01}, 0x300)}
+
+	tests := []struct {
+		name    string
+		corrupt func(dir string, index *MfgChunkIndex)
+	}{
+		{"modified chunk", func(dir string, index *MfgChunkIndex) {
+			path := filepath.Join(dir, index.Chunks[1].File)
+			ioutil.WriteFile(path, bytes.Repeat([]byte{0x02}, 0x100), 0644)
+		}},
+		{"truncated chunk", func(dir string, index *MfgChunkIndex) {
+			path := filepath.Join(dir, index.Chunks[1].File)
+			ioutil.WriteFile(path, bytes.Repeat([]byte{0x01}, 0x80), 0644)
+		}},
+		{"missing chunk", func(dir string, index *MfgChunkIndex) {
+			os.Remove(filepath.Join(dir, index.Chunks[2].File))
+		}},
+		{"out of order", func(dir string, index *MfgChunkIndex) {
+			index.Chunks[0], index.Chunks[1] =
+				index.Chunks[1], index.Chunks[0]
+		}},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "newt-chunks")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		indexPath, index := testWriteChunks(t, dir, dsMap, 0x100)
+		test.corrupt(dir, &index)
+
+		buf, _ := json.Marshal(index)
+		if err := ioutil.WriteFile(indexPath, buf, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ReassembleChunks(indexPath); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
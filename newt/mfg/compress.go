@@ -0,0 +1,252 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// The sections of a manufacturing image can additionally be emitted
+// compressed, for programmers and update agents that transfer the image over
+// a slow link.  Each section is compressed separately with the zstd command
+// line tool, optionally with a shared dictionary; a dictionary improves the
+// ratio for firmware with repeated structures.  The compressed sections are
+// written alongside the uncompressed ones; the meta region and manifest
+// record the algorithm and dictionary ID.
+
+// Compression algorithm names, as specified by mfg.compression.
+const MFG_COMPRESS_ZSTD = "zstd"
+
+// Compression algorithm codes, as stored in the meta region.
+const META_COMPRESS_NONE = 0
+const META_COMPRESS_ZSTD = 1
+
+// Extension appended to the filename of each compressed section.
+const MFG_COMPRESS_EXT = ".zst"
+
+// Magic number at the start of a zstd dictionary.  A dictionary lacking it is
+// a raw content dictionary.
+const ZSTD_DICT_MAGIC = 0xec30a437
+
+// Compression level passed to the zstd tool.
+const MFG_ZSTD_LEVEL = 19
+
+// Parses a compression algorithm name.  An empty name indicates no
+// compression.
+func ParseCompressAlgo(name string) (uint8, error) {
+	switch name {
+	case "":
+		return META_COMPRESS_NONE, nil
+	case MFG_COMPRESS_ZSTD:
+		return META_COMPRESS_ZSTD, nil
+	default:
+		return 0, util.FmtNewtError(
+			"Invalid compression algorithm \"%s\"; must be %s",
+			name, MFG_COMPRESS_ZSTD)
+	}
+}
+
+func compressAlgoName(algo uint8) string {
+	switch algo {
+	case META_COMPRESS_NONE:
+		return "none"
+	case META_COMPRESS_ZSTD:
+		return MFG_COMPRESS_ZSTD
+	default:
+		return fmt.Sprintf("algorithm %d", algo)
+	}
+}
+
+// Determines the ID identifying a zstd dictionary.  A zstd dictionary embeds
+// its own ID; a raw content dictionary does not, so its CRC32 (IEEE) serves
+// instead.  An ID is never 0, which indicates no dictionary.
+func ZstdDictId(dict []byte) uint32 {
+	if len(dict) >= 8 &&
+		binary.LittleEndian.Uint32(dict[0:]) == ZSTD_DICT_MAGIC {
+
+		if id := binary.LittleEndian.Uint32(dict[4:]); id != 0 {
+			return id
+		}
+	}
+
+	id := crc32.ChecksumIEEE(dict)
+	if id == 0 {
+		id = 1
+	}
+	return id
+}
+
+// Causes creation of the image to also emit its sections compressed with the
+// specified algorithm, regardless of the mfg.compression setting.  An empty
+// dictionary path indicates that no dictionary is used.  An empty algorithm
+// disables compression.
+func (mi *MfgImage) SetCompression(algoName string, dictPath string) error {
+	algo, err := ParseCompressAlgo(algoName)
+	if err != nil {
+		return err
+	}
+	if algo == META_COMPRESS_NONE && dictPath != "" {
+		return util.FmtNewtError(
+			"Compression dictionary %s specified without a compression "+
+				"algorithm", dictPath)
+	}
+
+	var dictId uint32
+	if dictPath != "" {
+		dict, err := ioutil.ReadFile(dictPath)
+		if err != nil {
+			return util.FmtNewtError(
+				"Failed to read compression dictionary: %s", err.Error())
+		}
+		if len(dict) == 0 {
+			return util.FmtNewtError(
+				"Compression dictionary %s is empty", dictPath)
+		}
+		dictId = ZstdDictId(dict)
+	}
+
+	mi.compressAlgo = algo
+	mi.compressDictPath = dictPath
+	mi.compressDictId = dictId
+
+	return nil
+}
+
+// Returns the name of the algorithm the image's sections are compressed with,
+// or an empty string if they are not compressed.
+func (mi *MfgImage) CompressAlgo() string {
+	if mi.compressAlgo == META_COMPRESS_NONE {
+		return ""
+	}
+	return compressAlgoName(mi.compressAlgo)
+}
+
+func zstdDictArg(dictPath string) string {
+	if dictPath == "" {
+		return ""
+	}
+	return " -D " + dictPath
+}
+
+// Compresses a file with the zstd tool.
+func zstdCompress(srcPath string, dstPath string, dictPath string) error {
+	cmdStr := fmt.Sprintf("zstd -q -f -%d%s -o %s %s", MFG_ZSTD_LEVEL,
+		zstdDictArg(dictPath), dstPath, srcPath)
+	if _, err := util.ShellCommand(cmdStr); err != nil {
+		return util.FmtNewtError("Failed to compress %s: %s",
+			srcPath, err.Error())
+	}
+
+	return nil
+}
+
+// Decompresses a file with the zstd tool.
+func zstdDecompress(srcPath string, dstPath string, dictPath string) error {
+	cmdStr := fmt.Sprintf("zstd -q -f -d%s -o %s %s",
+		zstdDictArg(dictPath), dstPath, srcPath)
+	if _, err := util.ShellCommand(cmdStr); err != nil {
+		return util.FmtNewtError("Failed to decompress %s: %s",
+			srcPath, err.Error())
+	}
+
+	return nil
+}
+
+// Compresses a section file and ensures that the result decompresses to the
+// original contents.  Returns the size of the compressed file.
+func compressSection(srcPath string, dstPath string, dictPath string,
+	data []byte) (int, error) {
+
+	if err := zstdCompress(srcPath, dstPath, dictPath); err != nil {
+		return 0, err
+	}
+
+	tmp, err := ioutil.TempFile("", "newt-mfg")
+	if err != nil {
+		return 0, util.ChildNewtError(err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := zstdDecompress(dstPath, tmp.Name(), dictPath); err != nil {
+		return 0, err
+	}
+
+	inflated, err := ioutil.ReadFile(tmp.Name())
+	if err != nil {
+		return 0, util.ChildNewtError(err)
+	}
+	if !bytes.Equal(inflated, data) {
+		return 0, util.FmtNewtError(
+			"Compressed section %s does not decompress to its original "+
+				"contents", dstPath)
+	}
+
+	info, err := os.Stat(dstPath)
+	if err != nil {
+		return 0, util.ChildNewtError(err)
+	}
+
+	return int(info.Size()), nil
+}
+
+// Writes a compressed copy of each of the specified sections.  The
+// uncompressed sections must already have been written.
+func (mi *MfgImage) writeCompressed(dsMap map[int][]byte) (
+	*mfgManifestCompression, error) {
+
+	devices := make([]int, 0, len(dsMap))
+	for device, _ := range dsMap {
+		devices = append(devices, device)
+	}
+	sort.Ints(devices)
+
+	mc := &mfgManifestCompression{
+		Algorithm: compressAlgoName(mi.compressAlgo),
+		DictId:    mi.compressDictId,
+	}
+	for _, device := range devices {
+		srcPath := mi.sectionBinPath(device)
+		dstPath := srcPath + MFG_COMPRESS_EXT
+
+		size, err := compressSection(srcPath, dstPath, mi.compressDictPath,
+			dsMap[device])
+		if err != nil {
+			return nil, err
+		}
+
+		mc.Sections = append(mc.Sections, mfgManifestCompressedSection{
+			Device:         device,
+			File:           dstPath,
+			Size:           len(dsMap[device]),
+			CompressedSize: size,
+		})
+	}
+
+	return mc, nil
+}
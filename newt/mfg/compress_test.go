@@ -0,0 +1,213 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseCompressAlgo(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    uint8
+		wantErr bool
+	}{
+		{"", META_COMPRESS_NONE, false},
+		{"zstd", META_COMPRESS_ZSTD, false},
+		{"gzip", 0, true},
+		{"ZSTD", 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseCompressAlgo(test.name)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseCompressAlgo(%q): expected error", test.name)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("ParseCompressAlgo(%q) = %d, %v; want %d",
+				test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestZstdDictId(t *testing.T) {
+	formatted := make([]byte, 16)
+	binary.LittleEndian.PutUint32(formatted[0:], ZSTD_DICT_MAGIC)
+	binary.LittleEndian.PutUint32(formatted[4:], 0x12345678)
+
+	zeroId := make([]byte, 16)
+	binary.LittleEndian.PutUint32(zeroId[0:], ZSTD_DICT_MAGIC)
+
+	raw := []byte("raw content dictionary")
+
+	tests := []struct {
+		dict []byte
+		want uint32
+	}{
+		// A zstd dictionary carries its own ID.
+		{formatted, 0x12345678},
+
+		// A raw content dictionary is identified by its CRC.
+		{raw, crc32.ChecksumIEEE(raw)},
+	}
+
+	for _, test := range tests {
+		if got := ZstdDictId(test.dict); got != test.want {
+			t.Errorf("ZstdDictId(%x) = 0x%08x; want 0x%08x",
+				test.dict, got, test.want)
+		}
+	}
+
+	if ZstdDictId(zeroId) == 0 {
+		t.Errorf("ZstdDictId returned 0 for a dictionary without an ID")
+	}
+	if ZstdDictId(raw) == ZstdDictId([]byte("another dictionary")) {
+		t.Errorf("distinct raw dictionaries have the same ID")
+	}
+}
+
+// The compression TLV identifies the algorithm and dictionary, and makes the
+// region version 2.  The hash is unaffected; it is calculated over the
+// uncompressed sections.
+func TestCompressionTlv(t *testing.T) {
+	tests := []struct {
+		algo   uint8
+		dictId uint32
+	}{
+		{META_COMPRESS_NONE, 0},
+		{META_COMPRESS_ZSTD, 0},
+		{META_COMPRESS_ZSTD, 0xdeadbeef},
+	}
+
+	for _, test := range tests {
+		params := testMetaParams()
+		params.compressAlgo = test.algo
+		params.compressDictId = test.dictId
+
+		_, meta, _ := testInsertAndParse(t, params)
+
+		tlv := findMetaTlv(meta, META_TLV_CODE_COMPRESSION)
+		if test.algo == META_COMPRESS_NONE {
+			if tlv != nil {
+				t.Errorf("uncompressed image has compression TLV")
+			}
+			if meta.Version != META_VERSION_1 {
+				t.Errorf("uncompressed image has meta version %d",
+					meta.Version)
+			}
+			continue
+		}
+
+		if tlv == nil {
+			t.Errorf("algo %d: missing compression TLV", test.algo)
+			continue
+		}
+		if len(tlv.Data) != META_TLV_COMPRESSION_SZ {
+			t.Errorf("compression TLV size %d; want %d",
+				len(tlv.Data), META_TLV_COMPRESSION_SZ)
+			continue
+		}
+		if tlv.Data[0] != test.algo {
+			t.Errorf("compression TLV algo %d; want %d",
+				tlv.Data[0], test.algo)
+		}
+		if id := binary.LittleEndian.Uint32(tlv.Data[4:]); id != test.dictId {
+			t.Errorf("compression TLV dict ID 0x%x; want 0x%x",
+				id, test.dictId)
+		}
+		if meta.Version != META_VERSION_2 {
+			t.Errorf("compressed image has meta version %d; want %d",
+				meta.Version, META_VERSION_2)
+		}
+	}
+}
+
+func TestCompressSectionRoundTrip(t *testing.T) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		t.Skip("zstd tool not available")
+	}
+
+	dir, err := ioutil.TempDir("", "newt-mfg-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Firmware-like data: repeated structures separated by erased flash.
+	record := []byte("\x01\x02\x03\x04vector table entry\x00\x00\x00\x00")
+	data := bytes.Repeat(record, 200)
+	data = append(data, bytes.Repeat([]byte{0xff}, 4096)...)
+
+	dictPath := filepath.Join(dir, "dict")
+	if err := ioutil.WriteFile(dictPath, bytes.Repeat(record, 8),
+		0644); err != nil {
+
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		dictPath string
+	}{
+		{"nodict", ""},
+		{"dict", dictPath},
+	}
+
+	for _, test := range tests {
+		srcPath := filepath.Join(dir, test.name+".bin")
+		dstPath := srcPath + MFG_COMPRESS_EXT
+		if err := ioutil.WriteFile(srcPath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		size, err := compressSection(srcPath, dstPath, test.dictPath, data)
+		if err != nil {
+			t.Errorf("%s: compressSection: %s", test.name, err.Error())
+			continue
+		}
+		if size <= 0 || size >= len(data) {
+			t.Errorf("%s: compressed size %d; uncompressed %d",
+				test.name, size, len(data))
+		}
+
+		outPath := filepath.Join(dir, test.name+".out")
+		if err := zstdDecompress(dstPath, outPath, test.dictPath); err != nil {
+			t.Errorf("%s: zstdDecompress: %s", test.name, err.Error())
+			continue
+		}
+		out, err := ioutil.ReadFile(outPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Errorf("%s: round trip altered the section", test.name)
+		}
+	}
+}
@@ -20,16 +20,19 @@
 package mfg
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"time"
 
 	"mynewt.apache.org/newt/newt/builder"
 	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/target"
 	"mynewt.apache.org/newt/util"
@@ -38,16 +41,68 @@ import (
 type mfgManifest struct {
 	BuildTime   string `json:"build_time"`
 	MfgHash     string `json:"mfg_hash"`
+	MfgHmac     string `json:"mfg_hmac,omitempty"`
+	MfgSeal     string `json:"mfg_seal,omitempty"`
+	MfgCrc      string `json:"mfg_crc,omitempty"`
+	Serial      string `json:"serial,omitempty"`
 	MetaSection int    `json:"meta_section"`
 	MetaOffset  int    `json:"meta_offset"`
+
+	Devices    []mfgManifestDevice `json:"devices,omitempty"`
+	FlashAreas []mfgManifestArea   `json:"flash_areas,omitempty"`
+
+	Compression *mfgManifestCompression `json:"compression,omitempty"`
+}
+
+// The compressed copies of an image's sections.
+type mfgManifestCompression struct {
+	Algorithm string                         `json:"algorithm"`
+	DictId    uint32                         `json:"dict_id,omitempty"`
+	Sections  []mfgManifestCompressedSection `json:"sections"`
+}
+
+type mfgManifestCompressedSection struct {
+	Device         int    `json:"device"`
+	File           string `json:"file"`
+	Size           int    `json:"size"`
+	CompressedSize int    `json:"compressed_size"`
+}
+
+// A flash device and the address at which a programmer must write it.
+type mfgManifestDevice struct {
+	Device int `json:"device"`
+	Base   int `json:"base"`
+}
+
+// A flash area with both its device-relative offset and the absolute address
+// a programmer uses (device base + offset).
+type mfgManifestArea struct {
+	Name    string `json:"name"`
+	Id      int    `json:"id"`
+	Device  int    `json:"device"`
+	Offset  int    `json:"offset"`
+	Size    int    `json:"size"`
+	Address int    `json:"address"`
 }
 
 type createState struct {
 	// {0:[section0blob], 1:[section1blob], ...}
-	dsMap      map[int][]byte
-	metaOffset int
-	hashOffset int
-	hash       []byte
+	dsMap           map[int][]byte
+	metaOffset      int
+	hashOffset      int
+	hmacOffset      int
+	crcOffset       int
+	regionCrcOffset int
+	hash            []byte
+	hmac            []byte
+	seal            []byte
+	crc             *uint32
+
+	// Offset of the verification block within section 0; 0 if none.
+	verifyBlockOffset int
+
+	// The compressed copies of the sections; nil if none were written.
+	compression *mfgManifestCompression
 }
 
 func insertPartIntoBlob(blob []byte, part mfgPart) {
@@ -95,10 +150,11 @@ func (mi *MfgImage) partFromImage(
 
 	// If an image slot is used, the entire flash area is unwritable.  This
 	// restriction comes from the boot loader's need to write status at the end
-	// of an area.  Pad out part with unwriten flash (0xff).  This probably
-	// isn't terribly efficient...
+	// of an area.  Pad out part with unwriten flash (the device's erase
+	// value).  This probably isn't terribly efficient...
+	eraseVal := mi.bsp.FlashMap.EraseVal(area.Device)
 	for i := 0; i < -overflow; i++ {
-		part.data = append(part.data, 0xff)
+		part.data = append(part.data, eraseVal)
 	}
 
 	return part, nil
@@ -115,15 +171,17 @@ func partFromRawEntry(entry MfgRawEntry, entryIdx int) mfgPart {
 func (mi *MfgImage) targetParts() ([]mfgPart, error) {
 	parts := []mfgPart{}
 
+	// Each boot area receives a copy of the boot loader.
 	bootPath := mi.dstBootBinPath()
 	if bootPath != "" {
-		bootPart, err := mi.partFromImage(
-			bootPath, flash.FLASH_AREA_NAME_BOOTLOADER)
-		if err != nil {
-			return nil, err
-		}
+		for _, areaName := range mi.bootAreas {
+			bootPart, err := mi.partFromImage(bootPath, areaName)
+			if err != nil {
+				return nil, err
+			}
 
-		parts = append(parts, bootPart)
+			parts = append(parts, bootPart)
+		}
 	}
 
 	for i := 0; i < 2; i++ {
@@ -156,13 +214,13 @@ func sectionSize(parts []mfgPart) int {
 	return greatest
 }
 
-func sectionFromParts(parts []mfgPart) []byte {
+func sectionFromParts(parts []mfgPart, eraseVal byte) []byte {
 	sectionSize := sectionSize(parts)
 	section := make([]byte, sectionSize)
 
-	// Initialize section 0's data as unwritten flash (0xff).
+	// Initialize the section's data as unwritten flash.
 	for i, _ := range section {
-		section[i] = 0xff
+		section[i] = eraseVal
 	}
 
 	for _, part := range parts {
@@ -196,62 +254,284 @@ func (mi *MfgImage) devicePartMap() (map[int][]mfgPart, error) {
 	return dpMap, nil
 }
 
-func (mi *MfgImage) deviceSectionMap() (map[int][]byte, error) {
-	dpMap, err := mi.devicePartMap()
+// Ensures no flash area other than the one containing it overlaps a meta
+// region.  Data written to such an area would silently overwrite the region.
+func (mi *MfgImage) detectMetaOverlaps() error {
+	layout, err := mi.MetaLayout()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// Convert each part slice into a section (byte slice).
-	dsMap := map[int][]byte{}
-	for device, parts := range dpMap {
-		dsMap[device] = sectionFromParts(parts)
+	type region struct {
+		areaName string
+		layout   MetaLayout
+	}
+	regions := []region{{mi.metaAreaName(), layout}}
+	if layout.Chain != nil {
+		regions = append(regions, region{mi.metaChainArea, *layout.Chain})
 	}
 
-	return dsMap, nil
+	for _, r := range regions {
+		start := r.layout.Offset
+		end := r.layout.Offset + r.layout.Reserved
+
+		for _, area := range mi.bsp.FlashMap.SortedAreas() {
+			if area.Name == r.areaName || area.Device != r.layout.Section {
+				continue
+			}
+
+			if area.Offset < end && area.Offset+area.Size > start {
+				return util.FmtNewtError(
+					"Flash area %s overlaps meta region in %s; "+
+						"area=0x%x-0x%x meta=0x%x-0x%x",
+					area.Name, r.areaName, area.Offset,
+					area.Offset+area.Size, start, end)
+			}
+		}
+	}
+
+	return nil
 }
 
-func (mi *MfgImage) createSections() (createState, error) {
-	cs := createState{}
+// Ensures the boot loader fits in the primary boot area below the meta
+// region, leaving at least the configured margin.  This is checked against
+// the boot loader's size before any sections are assembled.
+func (mi *MfgImage) checkBootFit() error {
+	bootPath := mi.dstBootBinPath()
+	if bootPath == "" {
+		return nil
+	}
 
-	var err error
+	info, err := os.Stat(bootPath)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return mi.checkBootSize(int(info.Size()))
+}
+
+// Ensures a boot loader of the specified size fits in the primary boot area
+// below the meta region, leaving at least the configured margin.
+func (mi *MfgImage) checkBootSize(bootSize int) error {
+	layout, err := mi.MetaLayout()
+	if err != nil {
+		return err
+	}
+
+	areaName := mi.metaAreaName()
+	bootArea := mi.bsp.FlashMap.Areas[areaName]
+	avail := bootArea.Size - layout.Reserved
+	margin := avail - bootSize
+
+	if margin < 0 {
+		return util.FmtNewtError(
+			"Boot loader too large to accommodate meta region in %s; "+
+				"boot-size=%d available=%d overflow=%d",
+			areaName, bootSize, avail, -margin)
+	}
+	if margin < mi.bootMinMargin {
+		return util.FmtNewtError(
+			"Boot loader leaves insufficient margin below meta region in "+
+				"%s; margin=%d required=%d", areaName, margin,
+			mi.bootMinMargin)
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE,
+		"Boot loader fits in %s; size=%d available=%d margin=%d\n",
+		areaName, bootSize, avail, margin)
+
+	return nil
+}
+
+func (mi *MfgImage) createSections() (createState, error) {
+	cs := createState{
+		dsMap: map[int][]byte{},
+	}
 
 	if err := mi.detectOverlaps(); err != nil {
 		return cs, err
 	}
 
-	cs.dsMap, err = mi.deviceSectionMap()
-	if err != nil {
+	if err := mi.detectMetaOverlaps(); err != nil {
 		return cs, err
 	}
 
-	if cs.dsMap[0] == nil {
-		panic("Invalid state; no section 0")
+	if err := mi.checkBootFit(); err != nil {
+		return cs, err
 	}
 
-	cs.metaOffset, cs.hashOffset, err = insertMeta(cs.dsMap[0],
-		mi.bsp.FlashMap)
+	dpMap, err := mi.devicePartMap()
 	if err != nil {
 		return cs, err
 	}
 
-	// Calculate manufacturing hash.
-	devices := make([]int, 0, len(cs.dsMap))
-	for device, _ := range cs.dsMap {
+	if dpMap[0] == nil {
+		panic("Invalid state; no section 0")
+	}
+
+	devices := make([]int, 0, len(dpMap))
+	for device, _ := range dpMap {
 		devices = append(devices, device)
 	}
 	sort.Ints(devices)
 
+	// In incremental mode, each section is hashed as soon as it is
+	// assembled rather than in a single pass at the end.
+	var hasher *metaHasher
+	if mi.incrementalHash {
+		hasher = newMetaHasher(mi.metaSalt, mi.hmacKey)
+	}
+
+	// Convert each part slice into a section (byte slice).  Section 0 comes
+	// first; it receives the meta region with zeroed hash fields.
 	sections := make([][]byte, len(devices))
 	for i, device := range devices {
-		sections[i] = cs.dsMap[device]
+		section := sectionFromParts(dpMap[device],
+			mi.bsp.FlashMap.EraseVal(device))
+		section, err = mi.applyFillPatterns(device, section, dpMap[device])
+		if err != nil {
+			return cs, err
+		}
+
+		if device == 0 {
+			params := mi.metaParams()
+			if mi.verifyBlock {
+				cs.verifyBlockOffset, err = mi.calcVerifyBlockOffset(section)
+				if err != nil {
+					return cs, err
+				}
+				params.verifyBlockOffset = cs.verifyBlockOffset
+			}
+
+			var layout MetaLayout
+			section, layout, err = insertMeta(section, mi.bsp.FlashMap,
+				params)
+			if err != nil {
+				return cs, err
+			}
+
+			// Reserve space for the verification block; it is filled in
+			// along with the integrity values.
+			if cs.verifyBlockOffset != 0 {
+				eraseVal := mi.bsp.FlashMap.EraseVal(0)
+				for len(section) < cs.verifyBlockOffset+MFG_VERIFY_BLOCK_SZ {
+					section = append(section, eraseVal)
+				}
+			}
+			cs.metaOffset = layout.Offset
+			cs.hashOffset = layout.HashOffset
+			cs.hmacOffset = layout.HmacOffset
+			cs.crcOffset = layout.CrcOffset
+			cs.regionCrcOffset = layout.RegionCrcOffset
+		}
+
+		if hasher != nil {
+			if device == 0 {
+				hasher.addSection(mi.integrityView([][]byte{section},
+					cs.verifyBlockOffset)[0])
+			} else {
+				hasher.addSection(section)
+			}
+		}
+
+		cs.dsMap[device] = section
+		sections[i] = section
+	}
+
+	if err := mi.checkPlaceholdersErased(cs.dsMap); err != nil {
+		return cs, err
+	}
+
+	if err := mi.fillMetaIntegrity(&cs, sections, hasher); err != nil {
+		return cs, err
 	}
-	cs.hash = calcMetaHash(sections)
-	copy(cs.dsMap[0][cs.hashOffset:cs.hashOffset+META_HASH_SZ], cs.hash)
 
 	return cs, nil
 }
 
+// Ensures that nothing populates a placeholder area; placeholders must ship
+// erased.
+func (mi *MfgImage) checkPlaceholdersErased(dsMap map[int][]byte) error {
+	for _, area := range mi.placeholders() {
+		section := dsMap[area.Device]
+		eraseVal := mi.bsp.FlashMap.EraseVal(area.Device)
+
+		end := util.IntMin(area.Offset+area.Size, len(section))
+		for off := area.Offset; off < end; off++ {
+			if section[off] != eraseVal {
+				return util.FmtNewtError(
+					"Placeholder area \"%s\" is not erased; data present "+
+						"at offset 0x%x", area.Name, off)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Fills in the meta region's integrity values: the hash, HMAC, seal, CRC,
+// and region CRC, followed by the verification block, if any.  All of the
+// meta fields must be zeroed in section 0 when this function is called.  If
+// hasher is non-nil, it has already been fed every section.
+func (mi *MfgImage) fillMetaIntegrity(cs *createState, sections [][]byte,
+	hasher *metaHasher) error {
+
+	// Calculate manufacturing hash.  Both values are calculated with the hash,
+	// HMAC, and CRC fields zeroed.
+	if hasher != nil {
+		cs.hash, cs.hmac = hasher.sum()
+	} else {
+		view := mi.integrityView(sections, cs.verifyBlockOffset)
+		cs.hash = calcMetaHash(view, mi.metaSalt)
+		if mi.hmacKey != nil {
+			cs.hmac = calcMetaHmac(view, mi.hmacKey)
+		}
+	}
+
+	if cs.hmac != nil {
+		copy(cs.dsMap[0][cs.hmacOffset:cs.hmacOffset+META_TLV_HMAC_SZ],
+			cs.hmac)
+	}
+
+	// A sealing tool, if configured, supplies the hash TLV's contents.
+	hashData := cs.hash
+	if mi.sealCmd != "" {
+		var err error
+		cs.seal, err = runSealCmd(mi.sealCmd, cs.hash, META_TLV_HASH_SZ)
+		if err != nil {
+			return err
+		}
+		hashData = cs.seal
+	}
+	copy(cs.dsMap[0][cs.hashOffset:cs.hashOffset+META_HASH_SZ], hashData)
+
+	// The CRC comes last; it covers the hash and HMAC just filled in.
+	if mi.metaCrc {
+		crc := calcMetaCrc(mi.integrityView(sections, cs.verifyBlockOffset))
+		binary.LittleEndian.PutUint32(
+			cs.dsMap[0][cs.crcOffset:cs.crcOffset+META_TLV_CRC_SZ], crc)
+		cs.crc = &crc
+	}
+
+	// The region CRC covers the finished meta region, so it is filled in
+	// after every other integrity value.
+	if cs.regionCrcOffset != 0 {
+		fillRegionCrc(cs.dsMap[0], cs.metaOffset, cs.regionCrcOffset)
+	}
+
+	// The verification block records the hash, so it is written last.
+	if cs.verifyBlockOffset != 0 {
+		buildId, err := mi.imageBuildId()
+		if err != nil {
+			return err
+		}
+		copy(cs.dsMap[0][cs.verifyBlockOffset:],
+			encodeVerifyBlock(cs.hash, buildId, mi.bsp.FlashMap.EraseVal(0)))
+	}
+
+	return nil
+}
+
 func areaNameFromImgIdx(imgIdx int) (string, error) {
 	switch imgIdx {
 	case 0:
@@ -338,6 +618,10 @@ func (mi *MfgImage) copyBinFiles() error {
 		}
 	}
 
+	return mi.copyImageBinFiles()
+}
+
+func (mi *MfgImage) copyImageBinFiles() error {
 	for i, imgTarget := range mi.images {
 		imgPaths := imageFromPaths(imgTarget)
 		dstDir := MfgImageBinDir(mi.basePkg.Name(), i)
@@ -441,6 +725,37 @@ func (mi *MfgImage) createManifest(cs createState) ([]byte, error) {
 		MetaSection: 0,
 		MetaOffset:  cs.metaOffset,
 	}
+	if cs.hmac != nil {
+		manifest.MfgHmac = fmt.Sprintf("%x", cs.hmac)
+	}
+	if cs.seal != nil {
+		manifest.MfgSeal = fmt.Sprintf("%x", cs.seal)
+	}
+	if cs.crc != nil {
+		manifest.MfgCrc = fmt.Sprintf("%08x", *cs.crc)
+	}
+	if mi.serial != nil {
+		manifest.Serial = strconv.FormatUint(*mi.serial, 10)
+	}
+	manifest.Compression = cs.compression
+
+	for _, device := range mi.deviceIds() {
+		manifest.Devices = append(manifest.Devices, mfgManifestDevice{
+			Device: device,
+			Base:   mi.DeviceBase(device),
+		})
+	}
+	for _, area := range mi.bsp.FlashMap.SortedAreas() {
+		manifest.FlashAreas = append(manifest.FlashAreas, mfgManifestArea{
+			Name:    area.Name,
+			Id:      area.Id,
+			Device:  area.Device,
+			Offset:  area.Offset,
+			Size:    area.Size,
+			Address: mi.DeviceBase(area.Device) + area.Offset,
+		})
+	}
+
 	buffer, err := json.MarshalIndent(manifest, "", "  ")
 	if err != nil {
 		return nil, util.FmtNewtError("Failed to encode mfg manifest: %s",
@@ -474,40 +789,142 @@ func (mi *MfgImage) ToPaths() []string {
 	}
 
 	paths = append(paths, mi.SectionBinPaths()...)
+	paths = append(paths, mi.CompressedSectionPaths()...)
 	paths = append(paths, mi.ManifestPath())
 
+	if mi.metaSymbols {
+		paths = append(paths, MfgMetaLdPath(mi.basePkg.Name()))
+		paths = append(paths, MfgMetaHeaderPath(mi.basePkg.Name()))
+	}
+
+	if mi.srec {
+		paths = append(paths, mi.SrecPath())
+	}
+
+	if mi.chunkSize > 0 {
+		paths = append(paths, mi.ChunkIndexPath())
+	}
+
 	return paths
 }
 
 // @return                      [paths-of-artifacts], error
 func (mi *MfgImage) CreateMfgImage() ([]string, error) {
+	defer newtutil.StartPhase("mfg")()
+
 	cs, err := mi.build()
 	if err != nil {
 		return nil, err
 	}
 
+	if err := mi.writeOutput(cs); err != nil {
+		return nil, err
+	}
+
+	if mi.metaSymbols {
+		if _, err := mi.WriteMetaSymbols(); err != nil {
+			return nil, err
+		}
+	}
+
+	return mi.ToPaths(), nil
+}
+
+// Writes the sections and manifest of a built manufacturing image.  If the
+// image carries a serial number, the output files are numbered accordingly.
+func (mi *MfgImage) writeOutput(cs createState) error {
 	sectionDir := MfgSectionBinDir(mi.basePkg.Name())
 	if err := os.MkdirAll(sectionDir, 0755); err != nil {
-		return nil, util.ChildNewtError(err)
+		return util.ChildNewtError(err)
 	}
 
 	for device, section := range cs.dsMap {
-		sectionPath := MfgSectionBinPath(mi.basePkg.Name(), device)
+		sectionPath := mi.sectionBinPath(device)
 		if err := ioutil.WriteFile(sectionPath, section, 0644); err != nil {
-			return nil, util.ChildNewtError(err)
+			return util.ChildNewtError(err)
+		}
+	}
+
+	if mi.srec {
+		if err := mi.writeSrec(cs.dsMap); err != nil {
+			return err
+		}
+	}
+
+	if mi.chunkSize > 0 {
+		if err := mi.writeChunks(cs.dsMap); err != nil {
+			return err
+		}
+	}
+
+	if mi.compressAlgo != META_COMPRESS_NONE {
+		mc, err := mi.writeCompressed(cs.dsMap)
+		if err != nil {
+			return err
 		}
+		cs.compression = mc
 	}
 
+	return mi.writeManifest(cs)
+}
+
+func (mi *MfgImage) writeManifest(cs createState) error {
 	manifest, err := mi.createManifest(cs)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	manifestPath := mi.ManifestPath()
 	if err := ioutil.WriteFile(manifestPath, manifest, 0644); err != nil {
-		return nil, util.FmtNewtError("Failed to write mfg manifest file: %s",
+		return util.FmtNewtError("Failed to write mfg manifest file: %s",
 			err.Error())
 	}
 
-	return mi.ToPaths(), nil
+	return nil
+}
+
+// Creates one manufacturing image per serial number.  Each image is identical
+// except for its serial TLV and, consequently, its hash.  Serial numbers are
+// drawn from the specified source.
+//
+// @return                      [paths-of-artifacts], error
+func (mi *MfgImage) CreateSerialMfgImages(count int,
+	src SerialSource) ([]string, error) {
+
+	defer newtutil.StartPhase("mfg")()
+	defer func() { mi.serial = nil }()
+
+	if err := mi.copyBinFiles(); err != nil {
+		return nil, err
+	}
+
+	paths := []string{}
+	for i := 0; i < count; i++ {
+		serial, err := src()
+		if err != nil {
+			return nil, err
+		}
+		mi.serial = &serial
+
+		cs, err := mi.createSections()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := mi.writeOutput(cs); err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, mi.SectionBinPaths()...)
+		paths = append(paths, mi.CompressedSectionPaths()...)
+		paths = append(paths, mi.ManifestPath())
+		if mi.srec {
+			paths = append(paths, mi.SrecPath())
+		}
+		if mi.chunkSize > 0 {
+			paths = append(paths, mi.ChunkIndexPath())
+		}
+	}
+
+	return paths, nil
 }
@@ -0,0 +1,206 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// The decoded contents of a flash area TLV.
+type metaDiffArea struct {
+	device int
+	offset int
+	size   int
+}
+
+func metaTlvName(typ uint8) string {
+	for _, desc := range MetaTlvCodes() {
+		if desc.Code == int(typ) {
+			return desc.Name
+		}
+	}
+
+	return fmt.Sprintf("TLV type %d", typ)
+}
+
+// Indicates whether a TLV holds an integrity value: a hash, HMAC, or CRC.
+// These differ between any two distinct images.
+func isIntegrityTlv(typ uint8) bool {
+	return typ == META_TLV_CODE_HASH || typ == META_TLV_CODE_HMAC ||
+		typ == META_TLV_CODE_CRC
+}
+
+// Renders a TLV's data in a human-readable form.
+func formatMetaTlvData(tlv MetaTlv) string {
+	switch {
+	case tlv.Type == META_TLV_CODE_SERIAL &&
+		len(tlv.Data) == META_TLV_SERIAL_SZ:
+
+		return fmt.Sprintf("%d", binary.LittleEndian.Uint64(tlv.Data))
+
+	case tlv.Type == META_TLV_CODE_COMPRESSION &&
+		len(tlv.Data) == META_TLV_COMPRESSION_SZ:
+
+		return fmt.Sprintf("algorithm=%s dict_id=0x%08x",
+			compressAlgoName(tlv.Data[0]),
+			binary.LittleEndian.Uint32(tlv.Data[4:]))
+
+	case tlv.Type == META_TLV_CODE_LICENSE:
+		license, copyright := DecodeLicense(tlv.Data)
+		return fmt.Sprintf("license=\"%s\" copyright=\"%s\"",
+			license, copyright)
+
+	default:
+		return fmt.Sprintf("%x", tlv.Data)
+	}
+}
+
+func metaDiffAreas(meta Meta) map[int]metaDiffArea {
+	areas := map[int]metaDiffArea{}
+	for _, tlv := range meta.Tlvs {
+		if tlv.Type == META_TLV_CODE_FLASH_AREA &&
+			len(tlv.Data) == META_TLV_FLASH_AREA_SZ {
+
+			areas[int(tlv.Data[0])] = metaDiffArea{
+				device: int(tlv.Data[1]),
+				offset: int(binary.LittleEndian.Uint32(tlv.Data[4:])),
+				size:   int(binary.LittleEndian.Uint32(tlv.Data[8:])),
+			}
+		}
+	}
+
+	return areas
+}
+
+// Groups a region's non-flash-area TLVs by type.  The primary and secondary
+// regions never contain more than one TLV of any of these types.
+func metaDiffTlvs(meta Meta) map[uint8]MetaTlv {
+	tlvs := map[uint8]MetaTlv{}
+	for _, tlv := range meta.Tlvs {
+		if tlv.Type != META_TLV_CODE_FLASH_AREA {
+			tlvs[tlv.Type] = tlv
+		}
+	}
+
+	return tlvs
+}
+
+// Compares two parsed meta regions and describes each difference, one per
+// line.  Integrity TLVs (hash, HMAC, CRC) are only compared if withHash is
+// true.  An empty result indicates the regions are equivalent.
+func DiffMeta(a Meta, b Meta, withHash bool) []string {
+	diffs := []string{}
+	addDiff := func(format string, args ...interface{}) {
+		diffs = append(diffs, fmt.Sprintf(format, args...))
+	}
+
+	if a.Version != b.Version {
+		addDiff("version: %d -> %d", a.Version, b.Version)
+	}
+	if a.Offset != b.Offset {
+		addDiff("offset: 0x%x -> 0x%x", a.Offset, b.Offset)
+	}
+	if a.Size != b.Size {
+		addDiff("size: %d -> %d", a.Size, b.Size)
+	}
+
+	aAreas := metaDiffAreas(a)
+	bAreas := metaDiffAreas(b)
+
+	ids := []int{}
+	for id, _ := range aAreas {
+		ids = append(ids, id)
+	}
+	for id, _ := range bAreas {
+		if _, ok := aAreas[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		name := fmt.Sprintf("flash area %d (%s)", id, syntheticAreaName(id))
+		aArea, aOk := aAreas[id]
+		bArea, bOk := bAreas[id]
+
+		switch {
+		case !bOk:
+			addDiff("%s: removed", name)
+		case !aOk:
+			addDiff("%s: added; device=%d offset=0x%x size=0x%x",
+				name, bArea.device, bArea.offset, bArea.size)
+		default:
+			if aArea.device != bArea.device {
+				addDiff("%s: device %d -> %d",
+					name, aArea.device, bArea.device)
+			}
+			if aArea.offset != bArea.offset {
+				addDiff("%s: offset 0x%x -> 0x%x",
+					name, aArea.offset, bArea.offset)
+			}
+			if aArea.size != bArea.size {
+				addDiff("%s: size 0x%x -> 0x%x",
+					name, aArea.size, bArea.size)
+			}
+		}
+	}
+
+	aTlvs := metaDiffTlvs(a)
+	bTlvs := metaDiffTlvs(b)
+
+	types := []int{}
+	for typ, _ := range aTlvs {
+		types = append(types, int(typ))
+	}
+	for typ, _ := range bTlvs {
+		if _, ok := aTlvs[typ]; !ok {
+			types = append(types, int(typ))
+		}
+	}
+	sort.Ints(types)
+
+	for _, t := range types {
+		typ := uint8(t)
+		if isIntegrityTlv(typ) && !withHash {
+			continue
+		}
+
+		name := metaTlvName(typ)
+		aTlv, aOk := aTlvs[typ]
+		bTlv, bOk := bTlvs[typ]
+
+		switch {
+		case !bOk:
+			addDiff("%s: removed", name)
+		case !aOk:
+			addDiff("%s: added; %s", name, formatMetaTlvData(bTlv))
+		default:
+			aStr := formatMetaTlvData(aTlv)
+			bStr := formatMetaTlvData(bTlv)
+			if aStr != bStr {
+				addDiff("%s: %s -> %s", name, aStr, bStr)
+			}
+		}
+	}
+
+	return diffs
+}
@@ -0,0 +1,103 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+)
+
+// Builds and parses a meta region for a test flash map with the size of one
+// area changed.  The hash field is set to the specified value.
+func testDiffMeta(t *testing.T, imageSize int, hashByte byte,
+	params metaParams) Meta {
+
+	fm := testFlashMap(t)
+	areas := []flash.FlashArea{}
+	for _, area := range fm.SortedAreas() {
+		if area.Name == flash.FLASH_AREA_NAME_IMAGE_1 {
+			area.Size = imageSize
+		}
+		areas = append(areas, area)
+	}
+	fm, err := flash.NewFlashMap(areas)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	section, layout, err := insertMeta(testSection0(), fm, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < META_HASH_SZ; i++ {
+		section[layout.HashOffset+i] = hashByte
+	}
+
+	meta, err := ParseMeta(section)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return meta
+}
+
+func TestDiffMeta(t *testing.T) {
+	serial := uint64(42)
+	withSerial := testMetaParams()
+	withSerial.serial = &serial
+
+	base := testDiffMeta(t, 0x2000, 0x00, testMetaParams())
+
+	tests := []struct {
+		name     string
+		other    Meta
+		withHash bool
+		want     []string
+	}{
+		{"identical", testDiffMeta(t, 0x2000, 0x00, testMetaParams()),
+			false, nil},
+		{"area size", testDiffMeta(t, 0x3000, 0x00, testMetaParams()),
+			false, []string{"size 0x2000 -> 0x3000"}},
+		{"hash ignored", testDiffMeta(t, 0x2000, 0x11, testMetaParams()),
+			false, nil},
+		{"hash compared", testDiffMeta(t, 0x2000, 0x11, testMetaParams()),
+			true, []string{"META_TLV_CODE_HASH: 00"}},
+		{"serial added", testDiffMeta(t, 0x2000, 0x00, withSerial),
+			false, []string{"version: 1 -> 2", "offset:", "size:",
+				"added; 42"}},
+	}
+
+	for _, test := range tests {
+		diffs := DiffMeta(base, test.other, test.withHash)
+		if len(diffs) != len(test.want) {
+			t.Errorf("%s: diffs=%q; want %d of them",
+				test.name, diffs, len(test.want))
+			continue
+		}
+		for i, want := range test.want {
+			if !strings.Contains(diffs[i], want) {
+				t.Errorf("%s: diff %d=%q; want it to contain %q",
+					test.name, i, diffs[i], want)
+			}
+		}
+	}
+}
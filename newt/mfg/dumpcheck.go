@@ -0,0 +1,138 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/util"
+)
+
+// The first difference between the contents a manufacturing image writes to
+// a flash area and the contents of a device dump.
+type DumpMismatch struct {
+	Area   string
+	Device int
+
+	// Offset of the differing byte, relative to the start of the device.
+	Offset int
+
+	// Offset of the differing byte, relative to the start of the area.
+	AreaOffset int
+
+	// The differing bytes; a value of -1 indicates that the dump ends before
+	// the offset.
+	Expected int
+	Actual   int
+}
+
+func (m DumpMismatch) String() string {
+	actual := "<eof>"
+	if m.Actual >= 0 {
+		actual = fmt.Sprintf("0x%02x", m.Actual)
+	}
+
+	return fmt.Sprintf("%s: differs at offset 0x%x (area offset 0x%x); "+
+		"expected=0x%02x actual=%s",
+		m.Area, m.Offset, m.AreaOffset, m.Expected, actual)
+}
+
+// Compares a device dump against the section that a manufacturing image
+// writes to the same device, one flash area at a time.  Each area's expected
+// contents exclude its trailing erased padding; the device is free to have
+// programmed those bytes since.  Bytes outside of every area are not
+// compared.  The first mismatch in each area is reported.
+func CompareDump(section []byte, dump []byte, areas []flash.FlashArea,
+	eraseVal byte) []DumpMismatch {
+
+	mismatches := []DumpMismatch{}
+	for _, area := range areas {
+		if area.Offset >= len(section) {
+			continue
+		}
+
+		end := area.Offset + area.Size
+		if end > len(section) {
+			end = len(section)
+		}
+		data := trimErased(section[area.Offset:end], eraseVal)
+
+		for i, b := range data {
+			off := area.Offset + i
+
+			actual := -1
+			if off < len(dump) {
+				actual = int(dump[off])
+			}
+			if actual == int(b) {
+				continue
+			}
+
+			mismatches = append(mismatches, DumpMismatch{
+				Area:       area.Name,
+				Device:     area.Device,
+				Offset:     off,
+				AreaOffset: i,
+				Expected:   int(b),
+				Actual:     actual,
+			})
+			break
+		}
+	}
+
+	return mismatches
+}
+
+// Compares a raw dump of a flash device against the section that the
+// manufacturing image writes to that device.  An empty result indicates the
+// device was programmed as expected.  The image must already have been
+// created.
+func (mi *MfgImage) CheckDump(device int, dumpPath string) (
+	[]DumpMismatch, error) {
+
+	dsMap, _, err := mi.readSections()
+	if err != nil {
+		return nil, err
+	}
+
+	section, ok := dsMap[device]
+	if !ok {
+		return nil, util.FmtNewtError(
+			"Manufacturing image %s does not write to flash device %d",
+			mi.basePkg.Name(), device)
+	}
+
+	dump, err := ioutil.ReadFile(dumpPath)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	areas := []flash.FlashArea{}
+	for _, area := range mi.bsp.FlashMap.SortedAreas() {
+		if area.Device == device {
+			areas = append(areas, area)
+		}
+	}
+
+	return CompareDump(section, dump, areas,
+		mi.bsp.FlashMap.EraseVal(device)), nil
+}
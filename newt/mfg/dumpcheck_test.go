@@ -0,0 +1,122 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+)
+
+func TestCompareDump(t *testing.T) {
+	areas := []flash.FlashArea{
+		{Name: "A", Offset: 0x00, Size: 0x10},
+		{Name: "B", Offset: 0x20, Size: 0x10},
+		{Name: "C", Offset: 0x40, Size: 0x10},
+	}
+
+	// Area A is full, B holds 4 bytes followed by erased padding, and C
+	// lies beyond the end of the section.  The gaps are not in any area.
+	section := bytes.Repeat([]byte{0xff}, 0x30)
+	for i := 0x00; i < 0x10; i++ {
+		section[i] = byte(i)
+	}
+	for i := 0x20; i < 0x24; i++ {
+		section[i] = byte(i)
+	}
+
+	dump := func(f func(d []byte) []byte) []byte {
+		d := append([]byte{}, section...)
+		d = append(d, bytes.Repeat([]byte{0xff}, 0x20)...)
+		return f(d)
+	}
+
+	tests := []struct {
+		name string
+		dump []byte
+		want []DumpMismatch
+	}{
+		{"identical", dump(func(d []byte) []byte { return d }), nil},
+		{"gap modified", dump(func(d []byte) []byte {
+			d[0x18] = 0
+			return d
+		}), nil},
+		{"padding programmed", dump(func(d []byte) []byte {
+			d[0x28] = 0
+			return d
+		}), nil},
+		{"area outside section programmed", dump(func(d []byte) []byte {
+			d[0x40] = 0
+			return d
+		}), nil},
+		{"first mismatch per area", dump(func(d []byte) []byte {
+			d[0x03] = 0
+			d[0x05] = 0
+			d[0x23] = 0
+			return d
+		}), []DumpMismatch{
+			{Area: "A", Offset: 0x03, AreaOffset: 0x03, Expected: 0x03,
+				Actual: 0x00},
+			{Area: "B", Offset: 0x23, AreaOffset: 0x03, Expected: 0x23,
+				Actual: 0x00},
+		}},
+		{"dump truncated", section[:0x22], []DumpMismatch{
+			{Area: "B", Offset: 0x22, AreaOffset: 0x02, Expected: 0x22,
+				Actual: -1},
+		}},
+	}
+
+	for _, test := range tests {
+		got := CompareDump(section, test.dump, areas, 0xff)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: mismatches=%v; want %v", test.name, got, test.want)
+			continue
+		}
+		for i, m := range got {
+			if m != test.want[i] {
+				t.Errorf("%s: mismatch %d=%v; want %v",
+					test.name, i, m, test.want[i])
+			}
+		}
+	}
+}
+
+func TestDumpMismatchString(t *testing.T) {
+	tests := []struct {
+		m    DumpMismatch
+		want string
+	}{
+		{DumpMismatch{Area: "B", Offset: 0x23, AreaOffset: 0x3,
+			Expected: 0x0d, Actual: 0x00},
+			"B: differs at offset 0x23 (area offset 0x3); " +
+				"expected=0x0d actual=0x00"},
+		{DumpMismatch{Area: "B", Offset: 0x22, AreaOffset: 0x2,
+			Expected: 0x22, Actual: -1},
+			"B: differs at offset 0x22 (area offset 0x2); " +
+				"expected=0x22 actual=<eof>"},
+	}
+
+	for _, test := range tests {
+		if got := test.m.String(); got != test.want {
+			t.Errorf("String()=%q; want %q", got, test.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"mynewt.apache.org/newt/newt/flash"
+)
+
+// A flash area whose contents in a manufacturing image consist entirely of the
+// device's erase value.
+type EmptyArea struct {
+	Area   string
+	Device int
+	Offset int
+	Size   int
+
+	// Whether mfg.empty_areas lists the area; i.e., the area is meant to ship
+	// empty.  Otherwise, nothing in the image populates it.
+	Intentional bool
+}
+
+// Identifies the flash areas that a manufacturing image leaves erased.  An
+// area that extends past the end of its device's section is erased beyond
+// that point, since the section is programmed into erased flash.  The image
+// must already have been created.
+func (mi *MfgImage) EmptyAreas() ([]EmptyArea, error) {
+	intentional := map[string]bool{}
+	for _, name := range mi.emptyAreas {
+		if _, ok := mi.bsp.FlashMap.Areas[name]; !ok {
+			return nil, mi.loadError(
+				"mfg.empty_areas contains undefined flash area \"%s\"", name)
+		}
+		intentional[name] = true
+	}
+
+	dsMap, _, err := mi.readSections()
+	if err != nil {
+		return nil, err
+	}
+
+	return findEmptyAreas(mi.bsp.FlashMap, dsMap, intentional), nil
+}
+
+// Identifies the flash areas left erased by the specified sections.
+func findEmptyAreas(flashMap flash.FlashMap, dsMap map[int][]byte,
+	intentional map[string]bool) []EmptyArea {
+
+	empty := []EmptyArea{}
+	for _, area := range flashMap.SortedAreas() {
+		var data []byte
+		section, ok := dsMap[area.Device]
+		if ok && area.Offset < len(section) {
+			end := area.Offset + area.Size
+			if end > len(section) {
+				end = len(section)
+			}
+			data = section[area.Offset:end]
+		}
+
+		eraseVal := flashMap.EraseVal(area.Device)
+		if len(trimErased(data, eraseVal)) != 0 {
+			continue
+		}
+
+		empty = append(empty, EmptyArea{
+			Area:        area.Name,
+			Device:      area.Device,
+			Offset:      area.Offset,
+			Size:        area.Size,
+			Intentional: intentional[area.Name],
+		})
+	}
+
+	return empty
+}
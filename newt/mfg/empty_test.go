@@ -0,0 +1,82 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+)
+
+func TestFindEmptyAreas(t *testing.T) {
+	fm := testFlashMap(t)
+
+	// Boot loader and slot 0 populated; slot 1 erased; section ends before
+	// the chain area.
+	section0 := bytes.Repeat([]byte{0xff}, 0x8000)
+	section0[0] = 0x01
+	section0[0x4000] = 0x02
+
+	tests := []struct {
+		name        string
+		dsMap       map[int][]byte
+		intentional map[string]bool
+		want        []string
+	}{
+		{
+			name: "erased and missing areas",
+			dsMap: map[int][]byte{
+				0: section0,
+				1: {0x03},
+			},
+			want: []string{
+				flash.FLASH_AREA_NAME_IMAGE_1 + ":false",
+				testChainArea + ":false",
+			},
+		},
+		{
+			name: "intentional and absent section",
+			dsMap: map[int][]byte{
+				0: section0,
+			},
+			intentional: map[string]bool{"FLASH_AREA_DATA": true},
+			want: []string{
+				flash.FLASH_AREA_NAME_IMAGE_1 + ":false",
+				"FLASH_AREA_DATA:true",
+				testChainArea + ":false",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		empty := findEmptyAreas(fm, test.dsMap, test.intentional)
+
+		got := []string{}
+		for _, e := range empty {
+			got = append(got, fmt.Sprintf("%s:%t", e.Area, e.Intentional))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: got empty areas %v; want %v",
+				test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"io/ioutil"
+	"math"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Encrypted data is indistinguishable from random data, which approaches 8
+// bits of entropy per byte.  An area expected to be encrypted whose entropy
+// falls below this threshold probably contains plaintext.
+const ENTROPY_MIN_ENCRYPTED = 7.5
+
+// The entropy of the data a manufacturing image writes to a flash area.
+type AreaEntropy struct {
+	Area   string
+	Device int
+
+	// Number of bytes measured.  Erased flash at the end of the area is not
+	// measured; it would dilute the entropy of the data that precedes it.
+	Size int
+
+	// Shannon entropy, in bits per byte.
+	Entropy float64
+
+	// Whether mfg.encrypted_areas lists the area.
+	ExpectEncrypted bool
+
+	// Whether the area is expected to be encrypted but has too little
+	// entropy.
+	Low bool
+}
+
+// Calculates the Shannon entropy of the data, in bits per byte.  The result
+// ranges from 0 (a single repeated value) to 8 (uniformly distributed).
+func shannonEntropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	counts := make([]int, 256)
+	for _, b := range data {
+		counts[b]++
+	}
+
+	entropy := 0.0
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / float64(len(data))
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy
+}
+
+// Strips trailing erased bytes from a flash area's contents.
+func trimErased(data []byte, eraseVal byte) []byte {
+	end := len(data)
+	for end > 0 && data[end-1] == eraseVal {
+		end--
+	}
+
+	return data[:end]
+}
+
+// Calculates the entropy of each flash area written by the manufacturing
+// image.  Areas listed in mfg.encrypted_areas are flagged if their entropy
+// is less than minEntropy.  The image must already have been created.
+func (mi *MfgImage) AreaEntropies(minEntropy float64) ([]AreaEntropy, error) {
+	expected := map[string]bool{}
+	for _, name := range mi.encryptedAreas {
+		if _, ok := mi.bsp.FlashMap.Areas[name]; !ok {
+			return nil, mi.loadError(
+				"mfg.encrypted_areas contains undefined flash area \"%s\"",
+				name)
+		}
+		expected[name] = true
+	}
+
+	sections := map[int][]byte{}
+	for _, id := range mi.sectionIds() {
+		data, err := ioutil.ReadFile(mi.sectionBinPath(id))
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"Failed to read mfg section %d: %s", id, err.Error())
+		}
+		sections[id] = data
+	}
+
+	entropies := []AreaEntropy{}
+	for _, area := range mi.bsp.FlashMap.SortedAreas() {
+		section, ok := sections[area.Device]
+		if !ok || area.Offset >= len(section) {
+			continue
+		}
+
+		end := area.Offset + area.Size
+		if end > len(section) {
+			end = len(section)
+		}
+
+		data := trimErased(section[area.Offset:end],
+			mi.bsp.FlashMap.EraseVal(area.Device))
+
+		ae := AreaEntropy{
+			Area:            area.Name,
+			Device:          area.Device,
+			Size:            len(data),
+			Entropy:         shannonEntropy(data),
+			ExpectEncrypted: expected[area.Name],
+		}
+		ae.Low = ae.ExpectEncrypted && ae.Size > 0 && ae.Entropy < minEntropy
+
+		entropies = append(entropies, ae)
+	}
+
+	return entropies, nil
+}
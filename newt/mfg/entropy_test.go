@@ -0,0 +1,113 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestShannonEntropy(t *testing.T) {
+	uniform := make([]byte, 256*4)
+	for i, _ := range uniform {
+		uniform[i] = byte(i)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want float64
+	}{
+		{
+			name: "empty",
+			data: nil,
+			want: 0,
+		},
+		{
+			name: "single value",
+			data: bytes.Repeat([]byte{0x5a}, 64),
+			want: 0,
+		},
+		{
+			name: "two values",
+			data: bytes.Repeat([]byte{0x00, 0xff}, 32),
+			want: 1,
+		},
+		{
+			name: "four values",
+			data: bytes.Repeat([]byte{1, 2, 3, 4}, 16),
+			want: 2,
+		},
+		{
+			name: "uniform",
+			data: uniform,
+			want: 8,
+		},
+	}
+
+	for _, test := range tests {
+		got := shannonEntropy(test.data)
+		if math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%s: got entropy %f; want %f", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTrimErased(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		eraseVal byte
+		want     []byte
+	}{
+		{
+			name:     "no erased bytes",
+			data:     []byte{1, 2, 3},
+			eraseVal: 0xff,
+			want:     []byte{1, 2, 3},
+		},
+		{
+			name:     "trailing erased bytes",
+			data:     []byte{1, 0xff, 3, 0xff, 0xff},
+			eraseVal: 0xff,
+			want:     []byte{1, 0xff, 3},
+		},
+		{
+			name:     "zero erase value",
+			data:     []byte{1, 2, 0, 0},
+			eraseVal: 0,
+			want:     []byte{1, 2},
+		},
+		{
+			name:     "fully erased",
+			data:     []byte{0xff, 0xff},
+			eraseVal: 0xff,
+			want:     []byte{},
+		},
+	}
+
+	for _, test := range tests {
+		got := trimErased(test.data, test.eraseVal)
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("%s: got %v; want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Unpopulated flash areas can be filled with a recognizable pattern instead
+// of the erase value (mfg.fill_patterns):
+//
+//     mfg.fill_patterns:
+//         FLASH_AREA_NFFS: 0xdeadbeef
+//
+// A pattern is a string of hex digits; its bytes are written in the order
+// given, repeated to the end of the area.  Filled areas must not contain any
+// image or raw entry, and cannot be placeholders or areas meant to ship
+// empty.  The checks that the meta region occupies erased flash still use
+// the device's erase value.
+
+// Converts a fill pattern string (e.g., "0xdeadbeef") to its bytes.
+func parseFillPattern(s string) ([]byte, error) {
+	digits := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "0x")
+	pattern, err := hex.DecodeString(digits)
+	if err != nil || len(pattern) == 0 {
+		return nil, util.FmtNewtError(
+			"invalid fill pattern \"%s\"; must be a string of hex digits "+
+				"with an even length", s)
+	}
+
+	return pattern, nil
+}
+
+// Fills the unpopulated areas of the specified device's section with their
+// configured patterns.  The section is extended if an area ends past it.
+func (mi *MfgImage) applyFillPatterns(device int, section []byte,
+	parts []mfgPart) ([]byte, error) {
+
+	names := make([]string, 0, len(mi.fillPatterns))
+	for name, _ := range mi.fillPatterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mustBeErased := map[string]bool{}
+	for _, name := range mi.placeholderAreas {
+		mustBeErased[name] = true
+	}
+	for _, name := range mi.emptyAreas {
+		mustBeErased[name] = true
+	}
+
+	for _, name := range names {
+		area, ok := mi.bsp.FlashMap.Areas[name]
+		if !ok {
+			return nil, mi.loadError(
+				"mfg.fill_patterns contains undefined flash area \"%s\"", name)
+		}
+		if area.Device != device {
+			continue
+		}
+
+		if mustBeErased[name] {
+			return nil, mi.loadError(
+				"flash area \"%s\" cannot be filled with a pattern; it is "+
+					"a placeholder or listed in mfg.empty_areas", name)
+		}
+
+		for _, part := range parts {
+			if part.offset < area.Offset+area.Size &&
+				part.offset+len(part.data) > area.Offset {
+
+				return nil, mi.loadError(
+					"flash area \"%s\" cannot be filled with a pattern; it "+
+						"contains %s", name, part.name)
+			}
+		}
+
+		eraseVal := mi.bsp.FlashMap.EraseVal(device)
+		for len(section) < area.Offset+area.Size {
+			section = append(section, eraseVal)
+		}
+
+		pattern := mi.fillPatterns[name]
+		for i := 0; i < area.Size; i++ {
+			section[area.Offset+i] = pattern[i%len(pattern)]
+		}
+	}
+
+	return section, nil
+}
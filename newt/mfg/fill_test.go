@@ -0,0 +1,158 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/pkg"
+)
+
+func TestParseFillPattern(t *testing.T) {
+	tests := []struct {
+		str     string
+		want    []byte
+		wantErr bool
+	}{
+		{"0xdeadbeef", []byte{0xde, 0xad, 0xbe, 0xef}, false},
+		{" 0XA5 ", []byte{0xa5}, false},
+		{"00ff", []byte{0x00, 0xff}, false},
+		{"0xabc", nil, true},
+		{"0x", nil, true},
+		{"pattern", nil, true},
+	}
+
+	for _, test := range tests {
+		got, err := parseFillPattern(test.str)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected error", test.str)
+			}
+		} else if err != nil || !bytes.Equal(got, test.want) {
+			t.Errorf("%q: pattern=%x err=%v; want %x",
+				test.str, got, err, test.want)
+		}
+	}
+}
+
+func TestApplyFillPatterns(t *testing.T) {
+	img1 := flash.FLASH_AREA_NAME_IMAGE_1
+	pattern := []byte{0xde, 0xad, 0xbe}
+
+	slot0Part := mfgPart{
+		device: 0,
+		offset: 0x4000,
+		data:   []byte{1, 2, 3},
+		name:   "image 0",
+	}
+
+	tests := []struct {
+		name        string
+		patterns    map[string][]byte
+		placeholder []string
+		empty       []string
+		parts       []mfgPart
+		secLen      int
+		wantErr     string
+	}{
+		{
+			name:     "fill slot 1",
+			patterns: map[string][]byte{img1: pattern},
+			parts:    []mfgPart{slot0Part},
+			secLen:   0x8000,
+		},
+		{
+			name:     "other device untouched",
+			patterns: map[string][]byte{"FLASH_AREA_DATA": pattern},
+			secLen:   0x6000,
+		},
+		{
+			name:     "undefined area",
+			patterns: map[string][]byte{"FLASH_AREA_BOGUS": pattern},
+			wantErr:  "undefined flash area \"FLASH_AREA_BOGUS\"",
+		},
+		{
+			name:     "populated area",
+			patterns: map[string][]byte{flash.FLASH_AREA_NAME_IMAGE_0: pattern},
+			parts:    []mfgPart{slot0Part},
+			wantErr:  "it contains image 0",
+		},
+		{
+			name:        "placeholder area",
+			patterns:    map[string][]byte{img1: pattern},
+			placeholder: []string{img1},
+			wantErr:     "is a placeholder or listed in mfg.empty_areas",
+		},
+		{
+			name:     "empty area",
+			patterns: map[string][]byte{img1: pattern},
+			empty:    []string{img1},
+			wantErr:  "is a placeholder or listed in mfg.empty_areas",
+		},
+	}
+
+	for _, test := range tests {
+		mi := &MfgImage{
+			basePkg:          pkg.NewLocalPackage(nil, "/test/mfg"),
+			bsp:              &pkg.BspPackage{FlashMap: testFlashMap(t)},
+			fillPatterns:     test.patterns,
+			placeholderAreas: test.placeholder,
+			emptyAreas:       test.empty,
+		}
+
+		section := bytes.Repeat([]byte{0xff}, 0x6000)
+		section, err := mi.applyFillPatterns(0, section, test.parts)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: expected error containing \"%s\"; got %v",
+					test.name, test.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+		if len(section) != test.secLen {
+			t.Errorf("%s: section size 0x%x; want 0x%x", test.name,
+				len(section), test.secLen)
+			continue
+		}
+
+		if _, ok := test.patterns[img1]; ok {
+			area := section[0x6000:0x8000]
+			for i, b := range area {
+				if b != pattern[i%len(pattern)] {
+					t.Errorf("%s: byte 0x%x of %s is 0x%02x; want 0x%02x",
+						test.name, i, img1, b, pattern[i%len(pattern)])
+					break
+				}
+			}
+		}
+		if !bytes.Equal(section[:0x6000], bytes.Repeat([]byte{0xff},
+			0x6000)) {
+
+			t.Errorf("%s: bytes outside the filled area modified", test.name)
+		}
+	}
+}
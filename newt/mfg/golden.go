@@ -0,0 +1,179 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// A byte range of a manufacturing image section that a golden comparison
+// disregards, e.g., a build timestamp or a serial number.
+type GoldenRegion struct {
+	// Human-readable description; used in reports only.
+	Name   string
+	Offset int
+	Size   int
+}
+
+// The first difference found between a section and its golden counterpart.
+type GoldenMismatch struct {
+	Device int
+	Offset int
+
+	// The differing bytes; a value of -1 indicates that the corresponding
+	// file ends before the offset.
+	Golden int
+	Built  int
+}
+
+func (m GoldenMismatch) String() string {
+	byteStr := func(b int) string {
+		if b < 0 {
+			return "<eof>"
+		}
+		return fmt.Sprintf("0x%02x", b)
+	}
+
+	return fmt.Sprintf("device %d differs at offset 0x%x; golden=%s built=%s",
+		m.Device, m.Offset, byteStr(m.Golden), byteStr(m.Built))
+}
+
+// Parses an ignored region of the form "<offset>:<size>".
+func ParseGoldenRegion(s string) (GoldenRegion, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return GoldenRegion{}, util.FmtNewtError(
+			"Invalid ignored region \"%s\"; must be of the form "+
+				"<offset>:<size>", s)
+	}
+
+	off, err := util.AtoiNoOct(strings.TrimSpace(parts[0]))
+	if err != nil || off < 0 {
+		return GoldenRegion{}, util.FmtNewtError(
+			"Invalid ignored region \"%s\"; bad offset", s)
+	}
+	size, err := util.AtoiNoOct(strings.TrimSpace(parts[1]))
+	if err != nil || size <= 0 {
+		return GoldenRegion{}, util.FmtNewtError(
+			"Invalid ignored region \"%s\"; bad size", s)
+	}
+
+	return GoldenRegion{
+		Name:   s,
+		Offset: off,
+		Size:   size,
+	}, nil
+}
+
+func goldenIgnored(regions []GoldenRegion, off int) bool {
+	for _, r := range regions {
+		if off >= r.Offset && off < r.Offset+r.Size {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Compares a section against its golden counterpart, disregarding the
+// specified regions.  It returns the offset of the first difference outside
+// the ignored regions, or -1 if there is none.  If one section is longer than
+// the other, the bytes past the end of the shorter one differ.
+func CompareGolden(golden []byte, built []byte, ignore []GoldenRegion) int {
+	n := util.IntMax(len(golden), len(built))
+	for off := 0; off < n; off++ {
+		if off < len(golden) && off < len(built) &&
+			golden[off] == built[off] {
+
+			continue
+		}
+		if !goldenIgnored(ignore, off) {
+			return off
+		}
+	}
+
+	return -1
+}
+
+// Determines the region of a device's section occupied by the named flash
+// area.
+func (mi *MfgImage) AreaGoldenRegion(areaName string) (int, GoldenRegion,
+	error) {
+
+	area, ok := mi.bsp.FlashMap.Areas[areaName]
+	if !ok {
+		return 0, GoldenRegion{}, util.FmtNewtError(
+			"BSP flash map does not contain area \"%s\"", areaName)
+	}
+
+	return area.Device, GoldenRegion{
+		Name:   areaName,
+		Offset: area.Offset,
+		Size:   area.Size,
+	}, nil
+}
+
+// Compares the section that the manufacturing image writes to the specified
+// device against a golden file.  It returns nil if the two match outside the
+// ignored regions.  The image must already have been created.
+func (mi *MfgImage) CompareGolden(device int, goldenPath string,
+	ignore []GoldenRegion) (*GoldenMismatch, error) {
+
+	dsMap, _, err := mi.readSections()
+	if err != nil {
+		return nil, err
+	}
+
+	built, ok := dsMap[device]
+	if !ok {
+		return nil, util.FmtNewtError(
+			"Manufacturing image %s does not write to flash device %d",
+			mi.basePkg.Name(), device)
+	}
+
+	golden, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	off := CompareGolden(golden, built, ignore)
+	if off < 0 {
+		return nil, nil
+	}
+
+	m := &GoldenMismatch{
+		Device: device,
+		Offset: off,
+		Golden: -1,
+		Built:  -1,
+	}
+	if off < len(golden) {
+		m.Golden = int(golden[off])
+	}
+	if off < len(built) {
+		m.Built = int(built[off])
+	}
+
+	return m, nil
+}
@@ -0,0 +1,99 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"testing"
+)
+
+func TestParseGoldenRegion(t *testing.T) {
+	tests := []struct {
+		s       string
+		off     int
+		size    int
+		wantErr bool
+	}{
+		{"0x100:16", 0x100, 16, false},
+		{"256 : 0x10", 256, 16, false},
+		{"0x100", 0, 0, true},
+		{"x:16", 0, 0, true},
+		{"-1:16", 0, 0, true},
+		{"0x100:0", 0, 0, true},
+	}
+
+	for _, test := range tests {
+		r, err := ParseGoldenRegion(test.s)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected error", test.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.s, err)
+		} else if r.Offset != test.off || r.Size != test.size {
+			t.Errorf("%q: region=0x%x:%d; want 0x%x:%d",
+				test.s, r.Offset, r.Size, test.off, test.size)
+		}
+	}
+}
+
+func TestCompareGolden(t *testing.T) {
+	golden := make([]byte, 0x100)
+	for i := range golden {
+		golden[i] = byte(i)
+	}
+
+	modified := func(offs ...int) []byte {
+		b := append([]byte{}, golden...)
+		for _, off := range offs {
+			b[off] ^= 0xff
+		}
+		return b
+	}
+
+	serial := []GoldenRegion{{Name: "serial", Offset: 0x40, Size: 8}}
+
+	tests := []struct {
+		name   string
+		built  []byte
+		ignore []GoldenRegion
+		want   int
+	}{
+		{"identical", modified(), nil, -1},
+		{"differs", modified(0x80), nil, 0x80},
+		{"differs in ignored region", modified(0x40, 0x47), serial, -1},
+		{"differs after ignored region", modified(0x40, 0x48), serial,
+			0x48},
+		{"first of several", modified(0x90, 0x20), serial, 0x20},
+		{"built too short", golden[:0xf0], nil, 0xf0},
+		{"built too long", append(modified(), 0), nil, 0x100},
+		{"short within ignored region", golden[:0xf8],
+			[]GoldenRegion{{Offset: 0xf8, Size: 8}}, -1},
+	}
+
+	for _, test := range tests {
+		got := CompareGolden(golden, test.built, test.ignore)
+		if got != test.want {
+			t.Errorf("%s: first difference=0x%x; want 0x%x",
+				test.name, got, test.want)
+		}
+	}
+}
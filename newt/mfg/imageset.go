@@ -0,0 +1,337 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/image"
+	"mynewt.apache.org/newt/util"
+)
+
+// A set of artifacts intended to be deployed together: a boot loader, an app
+// image that will be delivered as a field update, and optionally the mfg
+// image the devices were manufactured with.  The boot loader and the app are
+// each expected to have the manifest.json produced by "newt build" in the
+// same directory.
+type ImageSet struct {
+	BootPath        string // Boot loader image or raw binary.
+	AppPath         string // App image.
+	MfgManifestPath string // mfg manifest; "" if there is no mfg image.
+}
+
+// The result of cross-validating an image set.
+type ImageSetCheck struct {
+	// Inconsistencies that would prevent a successful field update.
+	Problems []string
+
+	// Checks that could not be performed because an artifact lacks the
+	// necessary information.
+	Warnings []string
+}
+
+func (c ImageSetCheck) Consistent() bool {
+	return len(c.Problems) == 0
+}
+
+// A flash map along with a description of the artifact it came from.
+type imageSetFlashMap struct {
+	name     string
+	flashMap flash.FlashMap
+}
+
+// Returns the path of the manifest that "newt build" writes alongside the
+// specified image.
+func siblingManifestPath(imgPath string) string {
+	return filepath.Dir(imgPath) + "/manifest.json"
+}
+
+// Reads an image manifest.  nil is returned if the file does not exist.
+func readImageManifest(path string) (*image.ImageManifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, util.ChildNewtError(err)
+	}
+
+	manifest := &image.ImageManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, util.FmtNewtError(
+			"Failed to decode image manifest \"%s\": %s", path, err.Error())
+	}
+
+	return manifest, nil
+}
+
+func imageManifestFlashMap(
+	manifest *image.ImageManifest) (flash.FlashMap, error) {
+
+	areas := make([]flash.FlashArea, len(manifest.FlashMap))
+	for i, area := range manifest.FlashMap {
+		areas[i] = flash.FlashArea{
+			Name:   area.Name,
+			Id:     area.Id,
+			Device: area.Device,
+			Offset: area.Offset,
+			Size:   area.Size,
+		}
+	}
+
+	return flash.NewFlashMap(areas)
+}
+
+func mfgManifestFlashMap(manifest mfgManifest) (flash.FlashMap, error) {
+	areas := make([]flash.FlashArea, len(manifest.FlashAreas))
+	for i, area := range manifest.FlashAreas {
+		areas[i] = flash.FlashArea{
+			Name:   area.Name,
+			Id:     area.Id,
+			Device: area.Device,
+			Offset: area.Offset,
+			Size:   area.Size,
+		}
+	}
+
+	return flash.NewFlashMap(areas)
+}
+
+// Reads the flash map recorded in the manifest alongside an image.  nil is
+// returned, along with a warning, if there is no manifest or it does not
+// record a flash map.
+func imageSetManifestMap(name string, imgPath string,
+	manifest *image.ImageManifest) (*imageSetFlashMap, string, error) {
+
+	path := siblingManifestPath(imgPath)
+	if manifest == nil {
+		return nil, fmt.Sprintf("%s manifest %s not found; flash map not "+
+			"checked", name, path), nil
+	}
+	if len(manifest.FlashMap) == 0 {
+		return nil, fmt.Sprintf("%s manifest %s does not record a flash "+
+			"map; flash map not checked", name, path), nil
+	}
+
+	fm, err := imageManifestFlashMap(manifest)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &imageSetFlashMap{name: name, flashMap: fm}, "", nil
+}
+
+func fileSize(path string) (int, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, util.ChildNewtError(err)
+	}
+
+	return int(fi.Size()), nil
+}
+
+// Cross-validates the members of an image set.  The following are checked:
+//   - The boot loader can boot the app image (see image.CheckBootCompat),
+//     including the app's dependencies on the boot loader's version.
+//   - The boot loader, app, and mfg image agree on the location of each
+//     system flash area.
+//   - The flash map has two equally sized image slots, each large enough to
+//     hold the app image and its boot trailer, and a boot loader area large
+//     enough to hold the boot loader.
+//   - The mfg image contains the same boot loader build as the set.
+func CheckImageSet(set ImageSet) (ImageSetCheck, error) {
+	c := ImageSetCheck{}
+	problem := func(format string, args ...interface{}) {
+		c.Problems = append(c.Problems, fmt.Sprintf(format, args...))
+	}
+	warning := func(format string, args ...interface{}) {
+		c.Warnings = append(c.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	bc, err := image.CheckBootCompat(set.AppPath, set.BootPath,
+		image.BOOT_DEP_NAME, nil)
+	if err != nil {
+		return c, err
+	}
+	for _, p := range bc.Problems {
+		problem("%s", p)
+	}
+
+	bootManifest, err := readImageManifest(
+		siblingManifestPath(set.BootPath))
+	if err != nil {
+		return c, err
+	}
+	appManifest, err := readImageManifest(siblingManifestPath(set.AppPath))
+	if err != nil {
+		return c, err
+	}
+
+	// Collect the flash maps in order of authority: the mfg image defines
+	// the layout of devices in the field, so its map is preferred when
+	// checking slot geometry.
+	maps := []*imageSetFlashMap{}
+
+	var mfgMan *mfgManifest
+	if set.MfgManifestPath != "" {
+		data, err := ioutil.ReadFile(set.MfgManifestPath)
+		if err != nil {
+			return c, util.FmtNewtError(
+				"Failed to read mfg manifest file: %s", err.Error())
+		}
+		mfgMan = &mfgManifest{}
+		if err := json.Unmarshal(data, mfgMan); err != nil {
+			return c, util.FmtNewtError(
+				"Failed to decode mfg manifest file \"%s\": %s",
+				set.MfgManifestPath, err.Error())
+		}
+
+		if len(mfgMan.FlashAreas) == 0 {
+			warning("mfg manifest %s does not record a flash map; flash "+
+				"map not checked", set.MfgManifestPath)
+		} else {
+			fm, err := mfgManifestFlashMap(*mfgMan)
+			if err != nil {
+				return c, err
+			}
+			maps = append(maps, &imageSetFlashMap{"mfg", fm})
+		}
+	}
+
+	for _, m := range []struct {
+		name     string
+		path     string
+		manifest *image.ImageManifest
+	}{
+		{"app", set.AppPath, appManifest},
+		{"boot loader", set.BootPath, bootManifest},
+	} {
+		fm, warn, err := imageSetManifestMap(m.name, m.path, m.manifest)
+		if err != nil {
+			return c, err
+		}
+		if warn != "" {
+			warning("%s", warn)
+		} else {
+			maps = append(maps, fm)
+		}
+	}
+
+	if len(maps) == 0 {
+		warning("no flash map available; slot geometry not checked")
+	} else {
+		ref := maps[0]
+		for _, m := range maps[1:] {
+			for _, p := range flash.SystemAreaProblems(ref.name, ref.flashMap,
+				m.name, m.flashMap) {
+
+				problem("%s", p)
+			}
+		}
+
+		if err := checkImageSetGeometry(set, ref, problem); err != nil {
+			return c, err
+		}
+	}
+
+	if mfgMan != nil {
+		bootPath := filepath.Dir(set.MfgManifestPath) + "/bootloader/" +
+			"manifest.json"
+		mfgBoot, err := readImageManifest(bootPath)
+		if err != nil {
+			return c, err
+		}
+
+		switch {
+		case mfgBoot == nil:
+			// The mfg image does not contain a boot loader.
+
+		case bootManifest == nil || bootManifest.BuildID == "" ||
+			mfgBoot.BuildID == "":
+
+			warning("boot loader build ID unknown; mfg boot loader not " +
+				"checked")
+
+		case bootManifest.BuildID != mfgBoot.BuildID:
+			problem("mfg image contains a different boot loader build; "+
+				"mfg: id=%s version=%s, boot loader: id=%s version=%s",
+				mfgBoot.BuildID, mfgBoot.Version,
+				bootManifest.BuildID, bootManifest.Version)
+		}
+	}
+
+	return c, nil
+}
+
+// Checks that the image slots and boot loader area of a flash map can hold
+// the members of an image set.
+func checkImageSetGeometry(set ImageSet, ref *imageSetFlashMap,
+	problem func(format string, args ...interface{})) error {
+
+	fm := ref.flashMap
+
+	if _, ok := fm.Areas[flash.FLASH_AREA_NAME_IMAGE_1]; !ok {
+		problem("%s flash map has no %s; image cannot be updated in the "+
+			"field", ref.name, flash.FLASH_AREA_NAME_IMAGE_1)
+	}
+
+	slot0, ok0 := fm.Areas[flash.FLASH_AREA_NAME_IMAGE_0]
+	slot1, ok1 := fm.Areas[flash.FLASH_AREA_NAME_IMAGE_1]
+	if ok0 && ok1 && slot0.Size != slot1.Size {
+		problem("image slots differ in size; %s: size=%d, %s: size=%d",
+			slot0.Name, slot0.Size, slot1.Name, slot1.Size)
+	}
+
+	appSize, err := fileSize(set.AppPath)
+	if err != nil {
+		return err
+	}
+
+	// Use the smallest possible write alignment; the actual trailer can
+	// only be larger.
+	need := appSize + image.BootTrailerSize(image.BOOT_TRAILER_SLOT, 1)
+	for _, name := range []string{
+		flash.FLASH_AREA_NAME_IMAGE_0,
+		flash.FLASH_AREA_NAME_IMAGE_1,
+	} {
+		if area, ok := fm.Areas[name]; ok && need > area.Size {
+			problem("app image (%d bytes plus boot trailer) does not fit "+
+				"in %s (%d bytes)", appSize, name, area.Size)
+		}
+	}
+
+	bootSize, err := fileSize(set.BootPath)
+	if err != nil {
+		return err
+	}
+	if area, ok := fm.Areas[flash.FLASH_AREA_NAME_BOOTLOADER]; ok &&
+		bootSize > area.Size {
+
+		problem("boot loader (%d bytes) does not fit in %s (%d bytes)",
+			bootSize, flash.FLASH_AREA_NAME_BOOTLOADER, area.Size)
+	}
+
+	return nil
+}
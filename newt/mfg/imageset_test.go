@@ -0,0 +1,224 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/image"
+)
+
+func testWriteJson(t *testing.T, path string, v interface{}) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testManifestAreas(fm flash.FlashMap) []image.ImageManifestFlashArea {
+	areas := []image.ImageManifestFlashArea{}
+	for _, area := range fm.SortedAreas() {
+		areas = append(areas, image.ImageManifestFlashArea{
+			Name:   area.Name,
+			Id:     area.Id,
+			Device: area.Device,
+			Offset: area.Offset,
+			Size:   area.Size,
+		})
+	}
+
+	return areas
+}
+
+// Writes an image set rooted at dir: a raw boot loader, an app image, and an
+// mfg manifest, each with the manifests that accompany them.  The app's
+// flash map is adjusted by appMap, if non-nil.  The mfg image's boot loader
+// has build ID "boot-1".
+func testWriteImageSet(t *testing.T, dir string, bootMagic bool,
+	appSize int, appMap func(areas []image.ImageManifestFlashArea),
+	bootId string) ImageSet {
+
+	fm := testFlashMap(t)
+	set := ImageSet{
+		BootPath:        filepath.Join(dir, "boot", "boot.bin"),
+		AppPath:         filepath.Join(dir, "app", "app.img"),
+		MfgManifestPath: filepath.Join(dir, "mfg", "manifest.json"),
+	}
+
+	// The boot loader's code must reference the app's header magic.
+	boot := make([]byte, 0x100)
+	if bootMagic {
+		binary.LittleEndian.PutUint32(boot[0x40:], image.IMAGE_MAGIC)
+	}
+	testWriteJson(t, siblingManifestPath(set.BootPath), image.ImageManifest{
+		BuildID:  bootId,
+		FlashMap: testManifestAreas(fm),
+	})
+	if err := ioutil.WriteFile(set.BootPath, boot, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	binPath := filepath.Join(dir, "app", "app.bin")
+	if err := os.MkdirAll(filepath.Dir(binPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(binPath, make([]byte, appSize),
+		0644); err != nil {
+
+		t.Fatal(err)
+	}
+	img, err := image.NewImage(binPath, set.AppPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := img.Generate(nil); err != nil {
+		t.Fatal(err)
+	}
+	areas := testManifestAreas(fm)
+	if appMap != nil {
+		appMap(areas)
+	}
+	testWriteJson(t, siblingManifestPath(set.AppPath), image.ImageManifest{
+		FlashMap: areas,
+	})
+
+	mfgMan := mfgManifest{}
+	for _, area := range fm.SortedAreas() {
+		mfgMan.FlashAreas = append(mfgMan.FlashAreas, mfgManifestArea{
+			Name:   area.Name,
+			Id:     area.Id,
+			Device: area.Device,
+			Offset: area.Offset,
+			Size:   area.Size,
+		})
+	}
+	testWriteJson(t, set.MfgManifestPath, mfgMan)
+	testWriteJson(t, filepath.Join(dir, "mfg", "bootloader", "manifest.json"),
+		image.ImageManifest{BuildID: "boot-1"})
+
+	return set
+}
+
+func TestCheckImageSet(t *testing.T) {
+	tests := []struct {
+		name      string
+		bootMagic bool
+		appSize   int
+		appMap    func(areas []image.ImageManifestFlashArea)
+		bootId    string
+		want      string // Expected problem; "" if the set is consistent.
+	}{
+		{
+			name:      "consistent",
+			bootMagic: true,
+			appSize:   1000,
+			bootId:    "boot-1",
+		},
+		{
+			name:      "boot loader lacks magic",
+			bootMagic: false,
+			appSize:   1000,
+			bootId:    "boot-1",
+			want:      "does not reference the app image's header magic",
+		},
+		{
+			name:      "app slot moved",
+			bootMagic: true,
+			appSize:   1000,
+			appMap: func(areas []image.ImageManifestFlashArea) {
+				for i, _ := range areas {
+					if areas[i].Name == flash.FLASH_AREA_NAME_IMAGE_1 {
+						areas[i].Offset += 0x1000
+					}
+				}
+			},
+			bootId: "boot-1",
+			want: "FLASH_AREA_IMAGE_1 differs; mfg: id=2 device=0 " +
+				"offset=0x6000 size=8192, app: id=2 device=0 " +
+				"offset=0x7000 size=8192",
+		},
+		{
+			name:      "app too large",
+			bootMagic: true,
+			appSize:   0x2000,
+			bootId:    "boot-1",
+			want:      "does not fit in FLASH_AREA_IMAGE_0",
+		},
+		{
+			name:      "different boot loader build",
+			bootMagic: true,
+			appSize:   1000,
+			bootId:    "boot-2",
+			want:      "mfg image contains a different boot loader build",
+		},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "newt-imageset-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		set := testWriteImageSet(t, dir, test.bootMagic, test.appSize,
+			test.appMap, test.bootId)
+		c, err := CheckImageSet(set)
+		os.RemoveAll(dir)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+
+		if len(c.Warnings) != 0 {
+			t.Errorf("%s: unexpected warnings: %v", test.name, c.Warnings)
+		}
+
+		if test.want == "" {
+			if !c.Consistent() {
+				t.Errorf("%s: unexpected problems: %v", test.name,
+					c.Problems)
+			}
+			continue
+		}
+
+		found := false
+		for _, p := range c.Problems {
+			if strings.Contains(p, test.want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: problems=%v, want one containing \"%s\"",
+				test.name, c.Problems, test.want)
+		}
+	}
+}
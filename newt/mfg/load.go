@@ -20,6 +20,7 @@
 package mfg
 
 import (
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"sort"
@@ -28,6 +29,7 @@ import (
 
 	"github.com/spf13/cast"
 
+	"mynewt.apache.org/newt/newt/flash"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
 	"mynewt.apache.org/newt/newt/target"
@@ -47,7 +49,19 @@ func (s partSorter) Swap(i, j int) {
 	s.parts[i], s.parts[j] = s.parts[j], s.parts[i]
 }
 func (s partSorter) Less(i, j int) bool {
-	return s.parts[i].offset < s.parts[j].offset
+	a := s.parts[i]
+	b := s.parts[j]
+
+	// Parts are ordered by device, then offset, then name, as flash areas
+	// sharing an ID are, so that the assembled section does not depend on
+	// the order the parts were collected in.
+	if a.device != b.device {
+		return a.device < b.device
+	}
+	if a.offset != b.offset {
+		return a.offset < b.offset
+	}
+	return a.name < b.name
 }
 
 func sortParts(parts []mfgPart) []mfgPart {
@@ -163,6 +177,105 @@ func (mi *MfgImage) detectInvalidDevices() error {
 			"flash map: %s", listStr)
 }
 
+// Ensures each boot area exists, resides in section 0, and does not overlap
+// any other boot area.
+func (mi *MfgImage) validateBootAreas() error {
+	areas := make([]flash.FlashArea, 0, len(mi.bootAreas))
+
+	for _, name := range mi.bootAreas {
+		area, ok := mi.bsp.FlashMap.Areas[name]
+		if !ok {
+			return mi.loadError(
+				"boot area \"%s\" not present in the BSP's flash map", name)
+		}
+
+		if area.Device != 0 {
+			return mi.loadError(
+				"boot area \"%s\" must reside in flash device 0; device=%d",
+				name, area.Device)
+		}
+
+		for _, other := range areas {
+			if other.Name == area.Name {
+				return mi.loadError("boot area \"%s\" specified twice",
+					name)
+			}
+
+			if area.Offset < other.Offset+other.Size &&
+				other.Offset < area.Offset+area.Size {
+
+				return mi.loadError("boot areas \"%s\" and \"%s\" overlap",
+					other.Name, area.Name)
+			}
+		}
+
+		areas = append(areas, area)
+	}
+
+	return nil
+}
+
+// Ensures each placeholder area exists and is not used by the boot loader or
+// the meta region.  An area excluded from the hash must reside in section 0.
+func (mi *MfgImage) validatePlaceholderAreas() error {
+	for _, name := range mi.placeholderAreas {
+		area, ok := mi.bsp.FlashMap.Areas[name]
+		if !ok {
+			return mi.loadError(
+				"placeholder area \"%s\" not present in the BSP's flash map",
+				name)
+		}
+
+		if mi.placeholdersUnhashed && area.Device != 0 {
+			return mi.loadError(
+				"placeholder area \"%s\" must reside in flash device 0 to "+
+					"be excluded from the hash; device=%d", name, area.Device)
+		}
+
+		reserved := append([]string{mi.metaChainArea}, mi.bootAreas...)
+		for _, r := range reserved {
+			if name == r {
+				return mi.loadError(
+					"placeholder area \"%s\" is also a boot or meta chain "+
+						"area", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Ensures the meta chain area, if any, exists, resides in section 0, and is
+// not also used as a boot area.
+func (mi *MfgImage) validateChainArea() error {
+	if mi.metaChainArea == "" {
+		return nil
+	}
+
+	area, ok := mi.bsp.FlashMap.Areas[mi.metaChainArea]
+	if !ok {
+		return mi.loadError(
+			"meta chain area \"%s\" not present in the BSP's flash map",
+			mi.metaChainArea)
+	}
+
+	if area.Device != 0 {
+		return mi.loadError(
+			"meta chain area \"%s\" must reside in flash device 0; "+
+				"device=%d", mi.metaChainArea, area.Device)
+	}
+
+	for _, name := range mi.bootAreas {
+		if name == mi.metaChainArea {
+			return mi.loadError(
+				"meta chain area \"%s\" is also a boot area",
+				mi.metaChainArea)
+		}
+	}
+
+	return nil
+}
+
 func (mi *MfgImage) detectOverlaps() error {
 	type overlap struct {
 		part0 mfgPart
@@ -238,6 +351,16 @@ func Load(basePkg *pkg.LocalPackage) (*MfgImage, error) {
 		return nil, err
 	}
 
+	mi.metaMaxVersion, err = mi.boot.MetaVersion()
+	if err != nil {
+		return nil, mi.loadError("%s", err.Error())
+	}
+
+	mi.metaOrder, err = ParseMetaOrderPolicy(mi.boot.MetaTlvOrder())
+	if err != nil {
+		return nil, mi.loadError("target.meta_tlv_order: %s", err.Error())
+	}
+
 	imgNames := v.GetStringSlice("mfg.images")
 	if imgNames != nil {
 		for _, imgName := range imgNames {
@@ -250,6 +373,134 @@ func Load(basePkg *pkg.LocalPackage) (*MfgImage, error) {
 		}
 	}
 
+	// By default, the boot loader occupies the single standard boot area.
+	// Redundant boot designs list multiple areas; the first is primary.
+	mi.bootAreas = v.GetStringSlice("mfg.boot_areas")
+	if len(mi.bootAreas) == 0 {
+		mi.bootAreas = []string{flash.FLASH_AREA_NAME_BOOTLOADER}
+	}
+
+	metaAlignStr := v.GetString("mfg.meta_align")
+	if metaAlignStr != "" {
+		mi.metaAlign, err = util.AtoiNoOct(metaAlignStr)
+		if err != nil || mi.metaAlign <= 0 ||
+			mi.metaAlign&(mi.metaAlign-1) != 0 {
+
+			return nil, mi.loadError(
+				"invalid mfg.meta_align: %s; must be a power of two",
+				metaAlignStr)
+		}
+	}
+
+	marginStr := v.GetString("mfg.boot_min_margin")
+	if marginStr != "" {
+		mi.bootMinMargin, err = util.AtoiNoOct(marginStr)
+		if err != nil || mi.bootMinMargin < 0 {
+			return nil, mi.loadError(
+				"invalid mfg.boot_min_margin: %s", marginStr)
+		}
+	}
+
+	mi.expectedHashOffset = -1
+	hashOffStr := v.GetString("mfg.meta_hash_offset")
+	if hashOffStr != "" {
+		mi.expectedHashOffset, err = util.AtoiNoOct(hashOffStr)
+		if err != nil || mi.expectedHashOffset < 0 {
+			return nil, mi.loadError(
+				"invalid mfg.meta_hash_offset: %s", hashOffStr)
+		}
+	}
+
+	mi.metaChainArea = v.GetString("mfg.meta_chain_area")
+	mi.placeholderAreas = v.GetStringSlice("mfg.placeholder_areas")
+
+	switch policy := v.GetString("mfg.placeholder_hash"); policy {
+	case "", "include":
+		mi.placeholdersUnhashed = false
+	case "exclude":
+		mi.placeholdersUnhashed = true
+	default:
+		return nil, mi.loadError(
+			"invalid mfg.placeholder_hash: %s; must be include or exclude",
+			policy)
+	}
+	mi.incrementalHash = v.GetBool("mfg.incremental_hash")
+	mi.metaCrc = v.GetBool("mfg.meta_crc")
+	mi.metaRegionCrc = v.GetBool("mfg.meta_region_crc")
+	mi.verifyBlock = v.GetBool("mfg.verify_block")
+	mi.sealCmd = v.GetString("mfg.seal_cmd")
+	mi.encryptedAreas = v.GetStringSlice("mfg.encrypted_areas")
+	mi.emptyAreas = v.GetStringSlice("mfg.empty_areas")
+
+	mi.fillPatterns = map[string][]byte{}
+	for name, patternStr := range v.GetStringMapString("mfg.fill_patterns") {
+		pattern, err := parseFillPattern(patternStr)
+		if err != nil {
+			return nil, mi.loadError("mfg.fill_patterns: %s: %s", name,
+				err.Error())
+		}
+		mi.fillPatterns[name] = pattern
+	}
+	mi.metaSymbols = v.GetBool("mfg.meta_symbols")
+	mi.srec = v.GetBool("mfg.srec")
+
+	dictPath := v.GetString("mfg.compression_dict")
+	if dictPath != "" && !strings.HasPrefix(dictPath, "/") {
+		dictPath = mi.basePkg.BasePath() + "/" + dictPath
+	}
+	if err := mi.SetCompression(v.GetString("mfg.compression"),
+		dictPath); err != nil {
+
+		return nil, mi.loadError("%s", err.Error())
+	}
+
+	chunkSizeStr := v.GetString("mfg.chunk_size")
+	if chunkSizeStr != "" {
+		mi.chunkSize, err = util.AtoiNoOct(chunkSizeStr)
+		if err != nil || mi.chunkSize <= 0 {
+			return nil, mi.loadError(
+				"invalid mfg.chunk_size: %s", chunkSizeStr)
+		}
+	}
+
+	if v.GetBool("mfg.include_license") {
+		proj := project.GetProject()
+		if proj.License() == "" && proj.Copyright() == "" {
+			return nil, mi.loadError(
+				"mfg.include_license specified, but project.yml defines " +
+					"neither project.license nor project.copyright")
+		}
+
+		var truncated bool
+		mi.metaLicense, truncated = encodeLicense(proj.License(),
+			proj.Copyright())
+		if truncated {
+			util.StatusMessage(util.VERBOSITY_QUIET,
+				"Warning: license and copyright text exceeds %d bytes; "+
+					"truncating meta region license TLV\n",
+				META_TLV_LICENSE_MAX_SZ)
+		}
+	}
+
+	saltStr := v.GetString("mfg.meta_salt")
+	if saltStr != "" {
+		mi.metaSalt, err = hex.DecodeString(saltStr)
+		if err != nil || len(mi.metaSalt) > META_TLV_SALT_MAX_SZ {
+			return nil, mi.loadError(
+				"invalid mfg.meta_salt: %s; must be a hex string of at "+
+					"most %d bytes", saltStr, META_TLV_SALT_MAX_SZ)
+		}
+	}
+
+	sectorSizeStr := v.GetString("mfg.meta_sector_size")
+	if sectorSizeStr != "" {
+		mi.metaSectorSize, err = util.AtoiNoOct(sectorSizeStr)
+		if err != nil || mi.metaSectorSize <= 0 {
+			return nil, mi.loadError(
+				"invalid mfg.meta_sector_size: %s", sectorSizeStr)
+		}
+	}
+
 	if len(mi.images) > 2 {
 		return nil, mi.loadError("too many images (%d); maximum is 2",
 			len(mi.images))
@@ -280,7 +531,23 @@ func Load(basePkg *pkg.LocalPackage) (*MfgImage, error) {
 	}
 	mi.bsp, err = pkg.NewBspPackage(bspLpkg)
 	if err != nil {
-		return nil, mi.loadError(err.Error())
+		return nil, mi.loadError("%s", err.Error())
+	}
+
+	// Each flash device is mapped at its own base address when programmed.
+	mi.deviceBases = map[int]int{}
+	for _, id := range mi.deviceIds() {
+		key := fmt.Sprintf("mfg.device_base.%d", id)
+		baseStr := v.GetString(key)
+		if baseStr == "" {
+			continue
+		}
+
+		base, err := util.AtoiNoOct(baseStr)
+		if err != nil || base < 0 {
+			return nil, mi.loadError("invalid %s: %s", key, baseStr)
+		}
+		mi.deviceBases[id] = base
 	}
 
 	for _, imgTarget := range mi.images {
@@ -301,5 +568,27 @@ func Load(basePkg *pkg.LocalPackage) (*MfgImage, error) {
 		return nil, err
 	}
 
+	if err := mi.validateBootAreas(); err != nil {
+		return nil, err
+	}
+
+	if err := mi.validateChainArea(); err != nil {
+		return nil, err
+	}
+
+	if err := mi.validatePlaceholderAreas(); err != nil {
+		return nil, err
+	}
+
+	errText := mi.bsp.FlashMap.SectorAlignmentErrorText()
+	if errText != "" {
+		return nil, mi.loadError("%s", strings.TrimSpace(errText))
+	}
+
+	errText = mi.bsp.FlashMap.CapacityErrorText()
+	if errText != "" {
+		return nil, mi.loadError("%s", strings.TrimSpace(errText))
+	}
+
 	return mi, nil
 }
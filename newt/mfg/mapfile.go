@@ -0,0 +1,184 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"mynewt.apache.org/newt/util"
+)
+
+const MAP_SOURCE_ERASED = "(erased)"
+
+// A byte range of a manufacturing image section and the source of its
+// contents.
+type MapEntry struct {
+	Device int
+	Offset int
+	Size   int
+	Source string
+}
+
+// A candidate source for a byte range.  Where sources overlap, the one with
+// the higher priority wins; the meta region, for example, is written over
+// the tail of the boot area.
+type mapSource struct {
+	offset   int
+	end      int
+	name     string
+	priority int
+}
+
+// Divides a section into contiguous entries, each attributed to the highest
+// priority source covering it.  Bytes not covered by any source are
+// attributed to erased flash.  The entries cover the whole section, in
+// order, with no gaps or overlaps.
+func mapSection(device int, size int, sources []mapSource) []MapEntry {
+	bounds := []int{0, size}
+	for _, src := range sources {
+		if src.offset < size {
+			bounds = append(bounds, src.offset)
+		}
+		if src.end < size {
+			bounds = append(bounds, src.end)
+		}
+	}
+	sort.Ints(bounds)
+
+	entries := []MapEntry{}
+	for i := 0; i < len(bounds)-1; i++ {
+		lo, hi := bounds[i], bounds[i+1]
+		if lo == hi {
+			continue
+		}
+
+		name := MAP_SOURCE_ERASED
+		best := -1
+		for _, src := range sources {
+			if src.offset <= lo && src.end >= hi && src.priority > best {
+				name = src.name
+				best = src.priority
+			}
+		}
+
+		// Coalesce with the preceding entry if the source is unchanged.
+		if n := len(entries); n > 0 && entries[n-1].Source == name {
+			entries[n-1].Size += hi - lo
+			continue
+		}
+
+		entries = append(entries, MapEntry{
+			Device: device,
+			Offset: lo,
+			Size:   hi - lo,
+			Source: name,
+		})
+	}
+
+	return entries
+}
+
+// Describes the source of every byte of the manufacturing image: the boot
+// loader, image slots, raw entries, and meta region.  The image must already
+// have been created; the section files determine the extent of the map.
+func (mi *MfgImage) LayoutMap() ([]MapEntry, error) {
+	dpMap, err := mi.devicePartMap()
+	if err != nil {
+		return nil, err
+	}
+
+	layout, err := mi.MetaLayout()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := mi.sectionIds()
+	sizes, err := fileSizes(mi.sectionPaths())
+	if err != nil {
+		return nil, err
+	}
+
+	devSources := map[int][]mapSource{}
+	for device, parts := range dpMap {
+		for _, part := range parts {
+			devSources[device] = append(devSources[device], mapSource{
+				offset:   part.offset,
+				end:      part.offset + len(part.data),
+				name:     part.name,
+				priority: 0,
+			})
+		}
+	}
+
+	regions := []*MetaLayout{&layout}
+	if layout.Chain != nil {
+		regions = append(regions, layout.Chain)
+	}
+	for i, region := range regions {
+		name := "meta region"
+		if i > 0 {
+			name = "meta region (chained)"
+		}
+		devSources[region.Section] = append(devSources[region.Section],
+			mapSource{
+				offset:   region.Offset,
+				end:      region.Offset + region.Size,
+				name:     name,
+				priority: 1,
+			})
+	}
+
+	entries := []MapEntry{}
+	for i, id := range ids {
+		entries = append(entries, mapSection(id, sizes[i], devSources[id])...)
+	}
+
+	return entries, nil
+}
+
+// Writes the layout map to the mfg bin directory.
+//
+// @return                      path-of-map-file, error
+func (mi *MfgImage) WriteMapFile() (string, error) {
+	entries, err := mi.LayoutMap()
+	if err != nil {
+		return "", err
+	}
+
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "# Layout of manufacturing image %s\n",
+		mi.basePkg.Name())
+	fmt.Fprintf(b, "# %-6s %-10s %-10s %s\n",
+		"device", "offset", "size", "source")
+	for _, e := range entries {
+		fmt.Fprintf(b, "  %-6d 0x%08x 0x%08x %s\n",
+			e.Device, e.Offset, e.Size, e.Source)
+	}
+
+	path := MfgMapPath(mi.basePkg.Name())
+	if err := ioutil.WriteFile(path, b.Bytes(), 0644); err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	return path, nil
+}
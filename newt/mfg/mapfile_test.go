@@ -0,0 +1,98 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMapSection(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		sources []mapSource
+		want    []MapEntry
+	}{
+		{
+			name:    "no sources",
+			size:    0x100,
+			sources: nil,
+			want: []MapEntry{
+				{Offset: 0, Size: 0x100, Source: MAP_SOURCE_ERASED},
+			},
+		},
+		{
+			name: "gap between sources",
+			size: 0x100,
+			sources: []mapSource{
+				{offset: 0, end: 0x40, name: "boot"},
+				{offset: 0x80, end: 0xc0, name: "image"},
+			},
+			want: []MapEntry{
+				{Offset: 0, Size: 0x40, Source: "boot"},
+				{Offset: 0x40, Size: 0x40, Source: MAP_SOURCE_ERASED},
+				{Offset: 0x80, Size: 0x40, Source: "image"},
+				{Offset: 0xc0, Size: 0x40, Source: MAP_SOURCE_ERASED},
+			},
+		},
+		{
+			name: "higher priority overlays",
+			size: 0x100,
+			sources: []mapSource{
+				{offset: 0, end: 0x100, name: "boot", priority: 0},
+				{offset: 0xe0, end: 0x100, name: "meta", priority: 1},
+			},
+			want: []MapEntry{
+				{Offset: 0, Size: 0xe0, Source: "boot"},
+				{Offset: 0xe0, Size: 0x20, Source: "meta"},
+			},
+		},
+		{
+			name: "adjacent ranges coalesce",
+			size: 0x100,
+			sources: []mapSource{
+				{offset: 0, end: 0x80, name: "raw"},
+				{offset: 0x80, end: 0x100, name: "raw"},
+			},
+			want: []MapEntry{
+				{Offset: 0, Size: 0x100, Source: "raw"},
+			},
+		},
+		{
+			name: "source past end of section",
+			size: 0x80,
+			sources: []mapSource{
+				{offset: 0x40, end: 0x200, name: "image"},
+			},
+			want: []MapEntry{
+				{Offset: 0, Size: 0x40, Source: MAP_SOURCE_ERASED},
+				{Offset: 0x40, Size: 0x40, Source: "image"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got := mapSection(0, test.size, test.sources)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v; want %+v", test.name, got, test.want)
+		}
+	}
+}
@@ -21,20 +21,28 @@ package mfg
 
 import (
 	"bytes"
+	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"strings"
 
 	"mynewt.apache.org/newt/newt/flash"
 	"mynewt.apache.org/newt/util"
 )
 
 // The "manufacturing meta region" is located at the end of the boot loader
-// flash area.  This region has the following structure.
+// flash area.  If the manufacturing image uses redundant boot loaders, the
+// region is located at the end of the primary boot area.  If the boot loader
+// requires the region to start on a particular boundary, erased padding may
+// follow the region.  This region has the following structure.
 //
 //  0                   1                   2                   3
 //  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
 // +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
-// |Version (0x01) |                  0xff padding                 |
+// |    Version    |              erase-value padding              |
 // +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 // |   TLV type    |   TLV size    | TLV data ("TLV size" bytes)   ~
 // +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+                               ~
@@ -44,7 +52,7 @@ import (
 // +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+                               ~
 // ~                                                               ~
 // +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
-// |   Region size                 |         0xff padding          |
+// |   Region size                 |      erase-value padding      |
 // +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 // |                       Magic (0x3bb2a269)                      |
 // +-+-+-+-+-+--+-+-+-+-end of boot loader area+-+-+-+-+-+-+-+-+-+-+
@@ -52,9 +60,60 @@ import (
 // The number of TLVs is variable; two are shown above for illustrative
 // purposes.
 //
+// If the manufacturing image includes provenance data, a license TLV follows
+// the flash area (or chain) TLVs.  Its data consists of a license identifier
+// and a copyright string separated by a null byte.
+//
+// If the manufacturing image's sections are also emitted compressed, a
+// compression TLV follows the flash area (or chain) TLVs.  It identifies the
+// compression algorithm and the dictionary, if any, that the compressed
+// sections require; the inflate side uses it to select the right dictionary.
+// The hash, HMAC, and CRCs are always calculated over the uncompressed
+// sections.
+//
+// If the manufacturing image is one of a set of serialized copies, a serial
+// TLV containing the copy's 64-bit serial number follows the license TLV.
+//
+// If the manufacturing image declares placeholder areas, a placeholder TLV
+// follows the flash area (or chain) TLVs for each.  A placeholder area is
+// shipped erased and provisioned later, e.g., with keys or certificates.  The
+// TLV identifies the area and indicates whether its contents are excluded
+// from the hash, HMAC, and CRC; an excluded area reads as zeros when these are
+// calculated, so provisioning it does not invalidate them.
+//
+// If the manufacturing image is created with a hash salt, a salt TLV
+// immediately precedes the hash TLV.  The salt is prepended to the image data
+// when the hash is calculated.
+//
+// If the manufacturing image uses a chained layout, the flash area TLVs are
+// moved to a secondary region at the end of another flash area.  The primary
+// region then contains a chain TLV in their place, indicating the device,
+// size, and offset of the secondary region.  The secondary region has the
+// same structure as the primary, but contains no hash TLV.
+//
+// If the manufacturing image is created with an HMAC key, an HMAC-SHA256 TLV
+// immediately follows the hash TLV.  This allows devices without asymmetric
+// crypto support to authenticate the image with a factory secret.
+//
+// If the manufacturing image is created with a CRC, a CRC32 TLV follows the
+// hash (and HMAC) TLVs.  The hash is calculated first, with the hash, HMAC,
+// and CRC fields all zeroed.  The CRC is calculated last, over the finished
+// image with only the CRC field zeroed; it therefore covers the hash.
+//
+// If the manufacturing image is created with a region CRC, a region CRC TLV
+// is the final TLV of the region.  It holds a CRC32 calculated over the
+// region itself, from the start of the header through the end of the
+// preceding TLV.  This allows a boot loader to validate the region without
+// reading the rest of the image.  The region CRC is calculated after every
+// other integrity value has been filled in; the hash and image CRC are
+// calculated with the region CRC field zeroed.  A secondary region contains
+// its own region CRC TLV.
+//
 // Fields:
 // <Header>
-// 1. Version: Manufacturing meta version number; always 0x01.
+// 1. Version: Manufacturing meta version number.  A region containing only
+//    hash, flash area, and HMAC TLVs is version 1; a region containing any
+//    other TLV type is version 2.
 //
 // <TLVs>
 // 2. TLV type: Indicates the type of data to follow.
@@ -67,24 +126,84 @@ import (
 // 6. Magic: indicates the presence of the manufacturing meta region.
 
 const META_MAGIC = 0x3bb2a269
-const META_VERSION = 1
+const META_VERSION_1 = 1
+const META_VERSION_2 = 2
+
+// The newest meta version that newt emits.
+const META_VERSION = META_VERSION_2
+
 const META_TLV_CODE_HASH = 0x01
 const META_TLV_CODE_FLASH_AREA = 0x02
+const META_TLV_CODE_HMAC = 0x03
+const META_TLV_CODE_SALT = 0x04
+const META_TLV_CODE_CHAIN = 0x05
+const META_TLV_CODE_LICENSE = 0x06
+const META_TLV_CODE_SERIAL = 0x07
+const META_TLV_CODE_CRC = 0x08
+const META_TLV_CODE_REGION_CRC = 0x09
+const META_TLV_CODE_PLACEHOLDER = 0x0a
+const META_TLV_CODE_VERIFY_BLOCK = 0x0b
+const META_TLV_CODE_COMPRESSION = 0x0c
 
 const META_HASH_SZ = 32
 const META_FOOTER_SZ = 8
 const META_TLV_HASH_SZ = META_HASH_SZ
 const META_TLV_FLASH_AREA_SZ = 12
+const META_TLV_HMAC_SZ = META_HASH_SZ
+const META_TLV_SALT_MAX_SZ = 255
+const META_TLV_CHAIN_SZ = 8
+const META_TLV_LICENSE_MAX_SZ = 255
+const META_TLV_SERIAL_SZ = 8
+const META_TLV_CRC_SZ = 4
+const META_TLV_REGION_CRC_SZ = 4
+const META_TLV_PLACEHOLDER_SZ = 4
+const META_TLV_VERIFY_BLOCK_SZ = 8
+const META_TLV_COMPRESSION_SZ = 8
+
+// Placeholder TLV flags.
+const META_PLACEHOLDER_F_UNHASHED = 0x01
+
+// Describes a TLV type that newt can write to the meta region.  Size is the
+// length of the TLV data, excluding the TLV header, or -1 if the length
+// varies.
+type MetaTlvCodeDesc struct {
+	Name string
+	Code int
+	Size int
+}
+
+// Returns every meta region TLV type, ordered by code.
+func MetaTlvCodes() []MetaTlvCodeDesc {
+	return []MetaTlvCodeDesc{
+		{"META_TLV_CODE_HASH", META_TLV_CODE_HASH, META_TLV_HASH_SZ},
+		{"META_TLV_CODE_FLASH_AREA", META_TLV_CODE_FLASH_AREA,
+			META_TLV_FLASH_AREA_SZ},
+		{"META_TLV_CODE_HMAC", META_TLV_CODE_HMAC, META_TLV_HMAC_SZ},
+		{"META_TLV_CODE_SALT", META_TLV_CODE_SALT, -1},
+		{"META_TLV_CODE_CHAIN", META_TLV_CODE_CHAIN, META_TLV_CHAIN_SZ},
+		{"META_TLV_CODE_LICENSE", META_TLV_CODE_LICENSE, -1},
+		{"META_TLV_CODE_SERIAL", META_TLV_CODE_SERIAL, META_TLV_SERIAL_SZ},
+		{"META_TLV_CODE_CRC", META_TLV_CODE_CRC, META_TLV_CRC_SZ},
+		{"META_TLV_CODE_REGION_CRC", META_TLV_CODE_REGION_CRC,
+			META_TLV_REGION_CRC_SZ},
+		{"META_TLV_CODE_PLACEHOLDER", META_TLV_CODE_PLACEHOLDER,
+			META_TLV_PLACEHOLDER_SZ},
+		{"META_TLV_CODE_VERIFY_BLOCK", META_TLV_CODE_VERIFY_BLOCK,
+			META_TLV_VERIFY_BLOCK_SZ},
+		{"META_TLV_CODE_COMPRESSION", META_TLV_CODE_COMPRESSION,
+			META_TLV_COMPRESSION_SZ},
+	}
+}
 
 type metaHeader struct {
-	version uint8  // 1
-	pad8    uint8  // 0xff
-	pad16   uint16 // 0xffff
+	version uint8  // META_VERSION_1 or META_VERSION_2
+	pad8    uint8  // Erase value.
+	pad16   uint16 // Erase value.
 }
 
 type metaFooter struct {
 	size  uint16 // Includes header, TLVs, and footer.
-	pad16 uint16 // 0xffff
+	pad16 uint16 // Erase value.
 	magic uint32 // META_MAGIC
 }
 
@@ -97,16 +216,55 @@ type metaTlvFlashArea struct {
 	header   metaTlvHeader
 	areaId   uint8  // Unique value identifying this flash area.
 	deviceId uint8  // Indicates host flash device (aka section number).
-	pad16    uint16 // 0xffff
+	pad16    uint16 // Erase value.
 	offset   uint32 // The byte offset within the flash device.
 	size     uint32 // Size, in bytes, of entire flash area.
 }
 
+type metaTlvChain struct {
+	header   metaTlvHeader
+	deviceId uint8  // Flash device containing the secondary region.
+	pad8     uint8  // Erase value.
+	size     uint16 // Size of the secondary region.
+	offset   uint32 // The byte offset of the region within the device.
+}
+
+type metaTlvPlaceholder struct {
+	header metaTlvHeader
+	areaId uint8  // Flash area to be provisioned later.
+	flags  uint8  // META_PLACEHOLDER_F_[...]
+	pad16  uint16 // Erase value.
+}
+
+type metaTlvVerifyBlock struct {
+	header metaTlvHeader
+	offset uint32 // The byte offset of the block within section 0.
+	size   uint32 // Size of the block.
+}
+
+type metaTlvCompression struct {
+	header metaTlvHeader
+	algo   uint8  // META_COMPRESS_[...]
+	pad8   uint8  // Erase value.
+	pad16  uint16 // Erase value.
+	dictId uint32 // Dictionary the sections require; 0 if none.
+}
+
+type metaTlvSerial struct {
+	header metaTlvHeader
+	serial uint64
+}
+
 type metaTlvHash struct {
 	header metaTlvHeader
 	hash   [META_HASH_SZ]byte
 }
 
+type metaTlvCrc struct {
+	header metaTlvHeader
+	crc    uint32
+}
+
 func writeElem(elem interface{}, buf *bytes.Buffer) error {
 	/* XXX: Assume target platform uses little endian. */
 	if err := binary.Write(buf, binary.LittleEndian, elem); err != nil {
@@ -115,19 +273,24 @@ func writeElem(elem interface{}, buf *bytes.Buffer) error {
 	return nil
 }
 
-func writeHeader(buf *bytes.Buffer) error {
+// Returns the 16-bit padding value corresponding to a device's erase value.
+func pad16(eraseVal byte) uint16 {
+	return uint16(eraseVal)<<8 | uint16(eraseVal)
+}
+
+func writeHeader(version uint8, eraseVal byte, buf *bytes.Buffer) error {
 	hdr := metaHeader{
-		version: META_VERSION,
-		pad8:    0xff,
-		pad16:   0xffff,
+		version: version,
+		pad8:    eraseVal,
+		pad16:   pad16(eraseVal),
 	}
 	return writeElem(hdr, buf)
 }
 
-func writeFooter(buf *bytes.Buffer) error {
+func writeFooter(eraseVal byte, buf *bytes.Buffer) error {
 	ftr := metaFooter{
 		size:  uint16(buf.Len() + META_FOOTER_SZ),
-		pad16: 0xffff,
+		pad16: pad16(eraseVal),
 		magic: META_MAGIC,
 	}
 	return writeElem(ftr, buf)
@@ -135,35 +298,38 @@ func writeFooter(buf *bytes.Buffer) error {
 
 func writeTlvHeader(typ uint8, size uint8, buf *bytes.Buffer) error {
 	tlvHdr := metaTlvHeader{
-		typ:  typ,
+		typ:  metaTlvToWire(typ),
 		size: size,
 	}
 	return writeElem(tlvHdr, buf)
 }
 
 // Writes a single entry of the flash map TLV.
-func writeFlashMapEntry(area flash.FlashArea, buf *bytes.Buffer) error {
+func writeFlashMapEntry(area flash.FlashArea, eraseVal byte,
+	buf *bytes.Buffer) error {
+
 	tlv := metaTlvFlashArea{
 		header: metaTlvHeader{
-			typ:  META_TLV_CODE_FLASH_AREA,
+			typ:  metaTlvToWire(META_TLV_CODE_FLASH_AREA),
 			size: META_TLV_FLASH_AREA_SZ,
 		},
 		areaId:   uint8(area.Id),
 		deviceId: uint8(area.Device),
-		pad16:    0xffff,
+		pad16:    pad16(eraseVal),
 		offset:   uint32(area.Offset),
 		size:     uint32(area.Size),
 	}
 	return writeElem(tlv, buf)
 }
 
-// Writes a zeroed-out hash TLV.  The hash's original value must be zero for
-// the actual hash to be calculated later.  After the actual value is
-// calculated, it replaces the zeros in the TLV.
-func writeZeroHash(buf *bytes.Buffer) error {
+// Writes a zeroed-out hash TLV of the specified type.  The hash's original
+// value must be zero for the actual hash to be calculated later.  After the
+// actual value is calculated, it replaces the zeros in the TLV.  This is used
+// for both the plain hash and the HMAC TLVs.
+func writeZeroHash(typ uint8, buf *bytes.Buffer) error {
 	tlv := metaTlvHash{
 		header: metaTlvHeader{
-			typ:  META_TLV_CODE_HASH,
+			typ:  metaTlvToWire(typ),
 			size: META_TLV_HASH_SZ,
 		},
 		hash: [META_HASH_SZ]byte{},
@@ -171,77 +337,1150 @@ func writeZeroHash(buf *bytes.Buffer) error {
 	return writeElem(tlv, buf)
 }
 
-// @return						meta-offset, hash-offset, error
-func insertMeta(section0Data []byte, flashMap flash.FlashMap) (
-	int, int, error) {
+// Writes a zeroed-out CRC TLV of the specified type.  As with the hash TLVs,
+// the actual value replaces the zeros once it has been calculated.  This is
+// used for both the image CRC and the region CRC TLVs.
+func writeZeroCrc(typ uint8, buf *bytes.Buffer) error {
+	tlv := metaTlvCrc{
+		header: metaTlvHeader{
+			typ:  metaTlvToWire(typ),
+			size: META_TLV_CRC_SZ,
+		},
+	}
+	return writeElem(tlv, buf)
+}
 
-	buf := &bytes.Buffer{}
+// Writes a placeholder TLV for the specified flash area.
+func writePlaceholder(area flash.FlashArea, unhashed bool, eraseVal byte,
+	buf *bytes.Buffer) error {
+
+	tlv := metaTlvPlaceholder{
+		header: metaTlvHeader{
+			typ:  metaTlvToWire(META_TLV_CODE_PLACEHOLDER),
+			size: META_TLV_PLACEHOLDER_SZ,
+		},
+		areaId: uint8(area.Id),
+		pad16:  pad16(eraseVal),
+	}
+	if unhashed {
+		tlv.flags |= META_PLACEHOLDER_F_UNHASHED
+	}
+	return writeElem(tlv, buf)
+}
+
+// Writes a verification block TLV pointing to a block at the specified offset
+// of section 0.
+func writeVerifyBlockTlv(offset int, buf *bytes.Buffer) error {
+	tlv := metaTlvVerifyBlock{
+		header: metaTlvHeader{
+			typ:  metaTlvToWire(META_TLV_CODE_VERIFY_BLOCK),
+			size: META_TLV_VERIFY_BLOCK_SZ,
+		},
+		offset: uint32(offset),
+		size:   MFG_VERIFY_BLOCK_SZ,
+	}
+	return writeElem(tlv, buf)
+}
+
+// Writes a compression TLV identifying the algorithm and dictionary used to
+// compress the sections.
+func writeCompression(algo uint8, dictId uint32, eraseVal byte,
+	buf *bytes.Buffer) error {
+
+	tlv := metaTlvCompression{
+		header: metaTlvHeader{
+			typ:  metaTlvToWire(META_TLV_CODE_COMPRESSION),
+			size: META_TLV_COMPRESSION_SZ,
+		},
+		algo:   algo,
+		pad8:   eraseVal,
+		pad16:  pad16(eraseVal),
+		dictId: dictId,
+	}
+	return writeElem(tlv, buf)
+}
+
+// Writes a salt TLV containing the specified value.
+func writeSalt(salt []byte, buf *bytes.Buffer) error {
+	if len(salt) > META_TLV_SALT_MAX_SZ {
+		return util.FmtNewtError("Meta hash salt too long: %d bytes; "+
+			"maximum is %d", len(salt), META_TLV_SALT_MAX_SZ)
+	}
+
+	if err := writeTlvHeader(META_TLV_CODE_SALT, uint8(len(salt)),
+		buf); err != nil {
+
+		return err
+	}
+
+	buf.Write(salt)
+	return nil
+}
+
+// Encodes the data of a license TLV.  The result is truncated to the maximum
+// size of a TLV; the second return value indicates whether truncation
+// occurred.
+func encodeLicense(license string, copyright string) ([]byte, bool) {
+	data := []byte(license + "\x00" + copyright)
+	if len(data) > META_TLV_LICENSE_MAX_SZ {
+		return data[:META_TLV_LICENSE_MAX_SZ], true
+	}
+
+	return data, false
+}
+
+// Decodes the data of a license TLV into its license identifier and copyright
+// string.
+func DecodeLicense(data []byte) (string, string) {
+	fields := strings.SplitN(string(data), "\x00", 2)
+	if len(fields) < 2 {
+		return fields[0], ""
+	}
+
+	return fields[0], fields[1]
+}
+
+// Writes a serial TLV containing the specified serial number.
+func writeSerial(serial uint64, buf *bytes.Buffer) error {
+	tlv := metaTlvSerial{
+		header: metaTlvHeader{
+			typ:  metaTlvToWire(META_TLV_CODE_SERIAL),
+			size: META_TLV_SERIAL_SZ,
+		},
+		serial: serial,
+	}
+	return writeElem(tlv, buf)
+}
+
+// Writes a license TLV containing the specified encoded value.
+func writeLicense(license []byte, buf *bytes.Buffer) error {
+	if len(license) > META_TLV_LICENSE_MAX_SZ {
+		return util.FmtNewtError("License TLV too long: %d bytes; "+
+			"maximum is %d", len(license), META_TLV_LICENSE_MAX_SZ)
+	}
+
+	if err := writeTlvHeader(META_TLV_CODE_LICENSE, uint8(len(license)),
+		buf); err != nil {
+
+		return err
+	}
+
+	buf.Write(license)
+	return nil
+}
+
+// Describes the location of a single TLV within the meta region.
+type MetaTlvLayout struct {
+	Type   int    `json:"type"`
+	Name   string `json:"name,omitempty"`
+	Offset int    `json:"offset"`
+	Size   int    `json:"size"` // Includes TLV header.
+}
+
+// Describes the geometry of the meta region.  Offsets are relative to the
+// start of section 0.
+type MetaLayout struct {
+	Section    int             `json:"section"`
+	Offset     int             `json:"offset"`
+	Size       int             `json:"size"`
+	HashOffset int             `json:"hash_offset"`
+	HmacOffset int             `json:"hmac_offset,omitempty"`
+	CrcOffset  int             `json:"crc_offset,omitempty"`
+	Tlvs       []MetaTlvLayout `json:"tlvs"`
+
+	// Offset of the region CRC's data, or 0 if the region has none.
+	RegionCrcOffset int `json:"region_crc_offset,omitempty"`
+
+	// Number of bytes at the end of the boot area unavailable to the boot
+	// loader.  This exceeds the region size if alignment padding follows the
+	// region.
+	Reserved int `json:"reserved"`
+
+	// The secondary region of a chained layout, if any.
+	Chain *MetaLayout `json:"chain,omitempty"`
+}
+
+// Controls the contents and placement of the meta region.
+type metaParams struct {
+	// The boot area whose end the region is placed at.
+	bootArea string
 
-	if err := writeHeader(buf); err != nil {
-		return 0, 0, err
+	// Whether the region includes an HMAC TLV.
+	withHmac bool
+
+	// Whether the region includes a CRC TLV.
+	withCrc bool
+
+	// Whether the region (and the secondary region, if any) ends with a
+	// region CRC TLV.
+	withRegionCrc bool
+
+	// If non-empty, the region includes a salt TLV with this value.
+	salt []byte
+
+	// If non-empty, the region includes a license TLV with this value.
+	license []byte
+
+	// If non-nil, the region includes a serial TLV with this value.
+	serial *uint64
+
+	// Required alignment of the region's start; 0 or 1 for none.
+	align int
+
+	// Size of the device's erase sectors; 0 if the region may span sectors.
+	sectorSize int
+
+	// If non-empty, the flash map TLVs are moved to a secondary region at
+	// the end of this flash area.
+	chainArea string
+
+	// The newest meta version the boot loader understands; 0 if
+	// unrestricted.
+	maxVersion int
+
+	// The TLV ordering rules the boot loader imposes.
+	orderPolicy MetaOrderPolicy
+
+	// Flash areas to be provisioned after manufacture, and whether their
+	// contents are excluded from the hash, HMAC, and CRC.
+	placeholders         []flash.FlashArea
+	placeholdersUnhashed bool
+
+	// Whether the region includes a verification block TLV, and the offset
+	// within section 0 of the block it points to.  The offset is 0 when only
+	// the region's layout is of interest.
+	verifyBlock       bool
+	verifyBlockOffset int
+
+	// The algorithm the sections are compressed with (META_COMPRESS_[...]),
+	// and the ID of the dictionary they require.  The region includes a
+	// compression TLV if the algorithm is not META_COMPRESS_NONE.
+	compressAlgo   uint8
+	compressDictId uint32
+
+	// The values written to the padding fields of the region and of the
+	// secondary region; each is the erase value of the device holding the
+	// region.
+	eraseVal      byte
+	chainEraseVal byte
+}
+
+// Returns the erase value of the device holding the specified flash area.
+func areaEraseVal(flashMap flash.FlashMap, areaName string) byte {
+	return flashMap.EraseVal(flashMap.Areas[areaName].Device)
+}
+
+// Lists the features of the region that require a meta version newer than
+// version 1.
+func (params metaParams) v2Features() []string {
+	features := []string{}
+	add := func(cond bool, name string) {
+		if cond {
+			features = append(features, name)
+		}
 	}
 
+	add(len(params.salt) > 0, "hash salt")
+	add(params.chainArea != "", "chained layout")
+	add(len(params.license) > 0, "license")
+	add(params.serial != nil, "serial number")
+	add(params.withCrc, "CRC")
+	add(params.withRegionCrc, "region CRC")
+	add(len(params.placeholders) > 0, "placeholder areas")
+	add(params.verifyBlock, "verification block")
+	add(params.compressAlgo != META_COMPRESS_NONE, "compression")
+
+	return features
+}
+
+// Determines the meta version of the region: the oldest version that
+// supports all of its TLVs.
+func (params metaParams) version() uint8 {
+	if len(params.v2Features()) > 0 {
+		return META_VERSION_2
+	}
+	return META_VERSION_1
+}
+
+// Calculates the offset of a region of the specified size placed at the very
+// end of the named flash area.
+func placeRegion(flashMap flash.FlashMap, areaName string, size int,
+	params metaParams) (flash.FlashArea, int, error) {
+
+	area, ok := flashMap.Areas[areaName]
+	if !ok {
+		return area, 0, util.FmtNewtError(
+			"Required meta region flash area missing: %s", areaName)
+	}
+
+	areaEnd := area.Offset + area.Size
+	metaOff := areaEnd - size
+
+	// Round the start of the region down to the required boundary.
+	if params.align > 1 {
+		metaOff -= metaOff % params.align
+	}
+
+	if metaOff < area.Offset {
+		return area, 0, util.FmtNewtError(
+			"Flash area %s too small to accommodate meta region; "+
+				"area=%d meta=%d", areaName, area.Size, areaEnd-metaOff)
+	}
+
+	if res := flashMap.ReserveOverlapping(area.Device, metaOff,
+		areaEnd-metaOff); res != nil {
+
+		return area, 0, util.FmtNewtError(
+			"Meta region 0x%x-0x%x in flash area %s overlaps reserved "+
+				"flash region %s (0x%x-0x%x)", metaOff, areaEnd, areaName,
+			res.Name, res.Offset, res.Offset+res.Size)
+	}
+
+	// Some flash parts cannot reliably write a region that spans two
+	// sectors in a single pass.
+	if params.sectorSize > 0 &&
+		metaOff/params.sectorSize != (areaEnd-1)/params.sectorSize {
+
+		return area, 0, util.FmtNewtError(
+			"Meta region straddles a flash sector boundary; "+
+				"meta=0x%x-0x%x sector-size=%d.  Align the end of flash "+
+				"area %s to a sector boundary or set mfg.meta_align to "+
+				"the sector size",
+			metaOff, areaEnd, params.sectorSize, areaName)
+	}
+
+	return area, metaOff, nil
+}
+
+// Fills in the geometry of a region that has been placed at the specified
+// offset.  TLV offsets are converted from region-relative to
+// section-relative.
+func (layout *MetaLayout) setPlacement(area flash.FlashArea, metaOff int,
+	size int) {
+
+	layout.Section = area.Device
+	layout.Offset = metaOff
+	layout.Size = size
+	layout.Reserved = area.Offset + area.Size - metaOff
+	for i, _ := range layout.Tlvs {
+		layout.Tlvs[i].Offset += metaOff
+	}
+}
+
+func writeFlashMapEntries(flashMap flash.FlashMap, eraseVal byte,
+	buf *bytes.Buffer, layout *MetaLayout) error {
+
 	for _, area := range flashMap.SortedAreas() {
-		if err := writeFlashMapEntry(area, buf); err != nil {
-			return 0, 0, err
+		tlvOff := buf.Len()
+		if err := writeFlashMapEntry(area, eraseVal, buf); err != nil {
+			return err
+		}
+
+		layout.Tlvs = append(layout.Tlvs, MetaTlvLayout{
+			Type:   META_TLV_CODE_FLASH_AREA,
+			Name:   area.Name,
+			Offset: tlvOff,
+			Size:   buf.Len() - tlvOff,
+		})
+	}
+
+	return nil
+}
+
+// Writes a chain TLV pointing to the specified secondary region.
+func writeChain(chain MetaLayout, eraseVal byte, buf *bytes.Buffer) error {
+	tlv := metaTlvChain{
+		header: metaTlvHeader{
+			typ:  metaTlvToWire(META_TLV_CODE_CHAIN),
+			size: META_TLV_CHAIN_SZ,
+		},
+		deviceId: uint8(chain.Section),
+		pad8:     eraseVal,
+		size:     uint16(chain.Size),
+		offset:   uint32(chain.Offset),
+	}
+	return writeElem(tlv, buf)
+}
+
+// Writes a zeroed-out region CRC TLV and records it in the layout.  Returns
+// the offset of the TLV's data within buf.
+func writeRegionCrcTlv(buf *bytes.Buffer, layout *MetaLayout) (int, error) {
+	tlvOff := buf.Len()
+	if err := writeZeroCrc(META_TLV_CODE_REGION_CRC, buf); err != nil {
+		return 0, err
+	}
+
+	layout.Tlvs = append(layout.Tlvs, MetaTlvLayout{
+		Type:   META_TLV_CODE_REGION_CRC,
+		Offset: tlvOff,
+		Size:   buf.Len() - tlvOff,
+	})
+
+	return buf.Len() - META_TLV_REGION_CRC_SZ, nil
+}
+
+// Calculates the CRC32 (IEEE) of a meta region, from the start of its header
+// (regionOff) up to the region CRC TLV, whose data is at crcOff.
+func calcRegionCrc(data []byte, regionOff int, crcOff int) uint32 {
+	return crc32.ChecksumIEEE(data[regionOff : crcOff-2])
+}
+
+// Calculates a region's CRC and writes it into the region CRC TLV.
+func fillRegionCrc(data []byte, regionOff int, crcOff int) uint32 {
+	crc := calcRegionCrc(data, regionOff, crcOff)
+	binary.LittleEndian.PutUint32(data[crcOff:crcOff+META_TLV_REGION_CRC_SZ],
+		crc)
+
+	return crc
+}
+
+// Serializes the secondary meta region of a chained layout.  The secondary
+// region contains the flash map TLVs; it is placed at the end of the chain
+// area.
+func buildChainMeta(flashMap flash.FlashMap, params metaParams) (
+	[]byte, MetaLayout, error) {
+
+	layout := MetaLayout{}
+	buf := &bytes.Buffer{}
+
+	if err := writeHeader(params.version(), params.chainEraseVal,
+		buf); err != nil {
+
+		return nil, layout, err
+	}
+	if err := writeFlashMapEntries(flashMap, params.chainEraseVal, buf,
+		&layout); err != nil {
+
+		return nil, layout, err
+	}
+
+	// Nothing in the secondary region is filled in later, so its region CRC
+	// can be calculated immediately.
+	regionCrcSubOff := -1
+	if params.withRegionCrc {
+		var err error
+		regionCrcSubOff, err = writeRegionCrcTlv(buf, &layout)
+		if err != nil {
+			return nil, layout, err
 		}
+		fillRegionCrc(buf.Bytes(), 0, regionCrcSubOff)
+	}
+
+	if err := writeFooter(params.chainEraseVal, buf); err != nil {
+		return nil, layout, err
 	}
 
-	if err := writeZeroHash(buf); err != nil {
-		return 0, 0, err
+	area, metaOff, err := placeRegion(flashMap, params.chainArea, buf.Len(),
+		params)
+	if err != nil {
+		return nil, layout, err
+	}
+	layout.setPlacement(area, metaOff, buf.Len())
+	if regionCrcSubOff != -1 {
+		layout.RegionCrcOffset = metaOff + regionCrcSubOff
+	}
+
+	return buf.Bytes(), layout, nil
+}
+
+// Serializes the meta region and calculates where it gets placed within
+// section 0.  The hash and HMAC in the returned region are zeroed.  If the
+// layout is chained, only the primary region is returned; the secondary
+// region is described by the layout's Chain field.
+func buildMeta(flashMap flash.FlashMap, params metaParams) (
+	[]byte, MetaLayout, error) {
+
+	layout := MetaLayout{}
+	buf := &bytes.Buffer{}
+
+	if err := writeHeader(params.version(), params.eraseVal,
+		buf); err != nil {
+
+		return nil, layout, err
+	}
+
+	if params.chainArea == "" {
+		if err := writeFlashMapEntries(flashMap, params.eraseVal, buf,
+			&layout); err != nil {
+
+			return nil, layout, err
+		}
+	} else {
+		_, chainLayout, err := buildChainMeta(flashMap, params)
+		if err != nil {
+			return nil, layout, err
+		}
+
+		tlvOff := buf.Len()
+		if err := writeChain(chainLayout, params.eraseVal,
+			buf); err != nil {
+
+			return nil, layout, err
+		}
+
+		layout.Tlvs = append(layout.Tlvs, MetaTlvLayout{
+			Type:   META_TLV_CODE_CHAIN,
+			Name:   params.chainArea,
+			Offset: tlvOff,
+			Size:   buf.Len() - tlvOff,
+		})
+		layout.Chain = &chainLayout
+	}
+
+	for _, area := range params.placeholders {
+		tlvOff := buf.Len()
+		if err := writePlaceholder(area, params.placeholdersUnhashed,
+			params.eraseVal, buf); err != nil {
+
+			return nil, layout, err
+		}
+
+		layout.Tlvs = append(layout.Tlvs, MetaTlvLayout{
+			Type:   META_TLV_CODE_PLACEHOLDER,
+			Name:   area.Name,
+			Offset: tlvOff,
+			Size:   buf.Len() - tlvOff,
+		})
+	}
+
+	if params.verifyBlock {
+		tlvOff := buf.Len()
+		if err := writeVerifyBlockTlv(params.verifyBlockOffset,
+			buf); err != nil {
+
+			return nil, layout, err
+		}
+
+		layout.Tlvs = append(layout.Tlvs, MetaTlvLayout{
+			Type:   META_TLV_CODE_VERIFY_BLOCK,
+			Offset: tlvOff,
+			Size:   buf.Len() - tlvOff,
+		})
+	}
+
+	if params.compressAlgo != META_COMPRESS_NONE {
+		tlvOff := buf.Len()
+		if err := writeCompression(params.compressAlgo,
+			params.compressDictId, params.eraseVal, buf); err != nil {
+
+			return nil, layout, err
+		}
+
+		layout.Tlvs = append(layout.Tlvs, MetaTlvLayout{
+			Type:   META_TLV_CODE_COMPRESSION,
+			Offset: tlvOff,
+			Size:   buf.Len() - tlvOff,
+		})
+	}
+
+	if len(params.license) > 0 {
+		tlvOff := buf.Len()
+		if err := writeLicense(params.license, buf); err != nil {
+			return nil, layout, err
+		}
+
+		layout.Tlvs = append(layout.Tlvs, MetaTlvLayout{
+			Type:   META_TLV_CODE_LICENSE,
+			Offset: tlvOff,
+			Size:   buf.Len() - tlvOff,
+		})
+	}
+
+	if params.serial != nil {
+		tlvOff := buf.Len()
+		if err := writeSerial(*params.serial, buf); err != nil {
+			return nil, layout, err
+		}
+
+		layout.Tlvs = append(layout.Tlvs, MetaTlvLayout{
+			Type:   META_TLV_CODE_SERIAL,
+			Offset: tlvOff,
+			Size:   buf.Len() - tlvOff,
+		})
+	}
+
+	if len(params.salt) > 0 {
+		tlvOff := buf.Len()
+		if err := writeSalt(params.salt, buf); err != nil {
+			return nil, layout, err
+		}
+
+		layout.Tlvs = append(layout.Tlvs, MetaTlvLayout{
+			Type:   META_TLV_CODE_SALT,
+			Offset: tlvOff,
+			Size:   buf.Len() - tlvOff,
+		})
+	}
+
+	tlvOff := buf.Len()
+	if err := writeZeroHash(META_TLV_CODE_HASH, buf); err != nil {
+		return nil, layout, err
 	}
 	hashSubOff := buf.Len() - META_HASH_SZ
 
-	if err := writeFooter(buf); err != nil {
-		return 0, 0, err
+	layout.Tlvs = append(layout.Tlvs, MetaTlvLayout{
+		Type:   META_TLV_CODE_HASH,
+		Offset: tlvOff,
+		Size:   buf.Len() - tlvOff,
+	})
+
+	hmacSubOff := -1
+	if params.withHmac {
+		tlvOff := buf.Len()
+		if err := writeZeroHash(META_TLV_CODE_HMAC, buf); err != nil {
+			return nil, layout, err
+		}
+		hmacSubOff = buf.Len() - META_TLV_HMAC_SZ
+
+		layout.Tlvs = append(layout.Tlvs, MetaTlvLayout{
+			Type:   META_TLV_CODE_HMAC,
+			Offset: tlvOff,
+			Size:   buf.Len() - tlvOff,
+		})
+	}
+
+	crcSubOff := -1
+	if params.withCrc {
+		tlvOff := buf.Len()
+		if err := writeZeroCrc(META_TLV_CODE_CRC, buf); err != nil {
+			return nil, layout, err
+		}
+		crcSubOff = buf.Len() - META_TLV_CRC_SZ
+
+		layout.Tlvs = append(layout.Tlvs, MetaTlvLayout{
+			Type:   META_TLV_CODE_CRC,
+			Offset: tlvOff,
+			Size:   buf.Len() - tlvOff,
+		})
+	}
+
+	// The region CRC covers the hash, HMAC, and CRC; it is filled in after
+	// all of them.
+	regionCrcSubOff := -1
+	if params.withRegionCrc {
+		var err error
+		regionCrcSubOff, err = writeRegionCrcTlv(buf, &layout)
+		if err != nil {
+			return nil, layout, err
+		}
+	}
+
+	if err := writeFooter(params.eraseVal, buf); err != nil {
+		return nil, layout, err
 	}
 
 	// The meta region gets placed at the very end of the boot loader slot.
-	bootArea, ok := flashMap.Areas[flash.FLASH_AREA_NAME_BOOTLOADER]
-	if !ok {
-		return 0, 0,
-			util.NewNewtError("Required boot loader flash area missing")
+	bootArea, metaOff, err := placeRegion(flashMap, params.bootArea,
+		buf.Len(), params)
+	if err != nil {
+		return nil, layout, err
+	}
+
+	layout.setPlacement(bootArea, metaOff, buf.Len())
+	layout.HashOffset = metaOff + hashSubOff
+	if hmacSubOff != -1 {
+		layout.HmacOffset = metaOff + hmacSubOff
+	}
+	if crcSubOff != -1 {
+		layout.CrcOffset = metaOff + crcSubOff
+	}
+	if regionCrcSubOff != -1 {
+		layout.RegionCrcOffset = metaOff + regionCrcSubOff
+	}
+
+	return buf.Bytes(), layout, nil
+}
+
+// Copies a region into section 0.  The region must only overwrite unwritten
+// flash.  Any alignment padding following the region must remain unwritten
+// as well.
+func copyRegion(section0Data []byte, region []byte, layout MetaLayout,
+	eraseVal byte, what string) error {
+
+	for i := layout.Offset; i < layout.Offset+layout.Reserved; i++ {
+		if section0Data[i] != eraseVal {
+			return util.FmtNewtError(
+				"%s extends into meta region; "+
+					"meta region starts at offset %d", what, layout.Offset)
+		}
+	}
+
+	copy(section0Data[layout.Offset:], region)
+	return nil
+}
+
+// Confirms that a meta region written to section 0 describes its own length
+// correctly.  The footer's size field is re-read from the written bytes and
+// compared with the true length of the region, header through footer.  The
+// boot loader locates the start of the region using this field, so a wrong
+// value makes the region unreadable.
+func checkMetaFooter(section0Data []byte, layout MetaLayout,
+	regionLen int) error {
+
+	end := layout.Offset + regionLen
+	if regionLen < 4+META_FOOTER_SZ || end > len(section0Data) {
+		return util.FmtNewtError(
+			"Meta region at offset %d has invalid length %d",
+			layout.Offset, regionLen)
 	}
 
-	if bootArea.Size < buf.Len() {
-		return 0, 0, util.FmtNewtError(
-			"Boot loader flash area too small to accommodate meta region; "+
-				"boot=%d meta=%d", bootArea.Size, buf.Len())
+	footer := section0Data[end-META_FOOTER_SZ : end]
+	if binary.LittleEndian.Uint32(footer[4:]) != META_MAGIC {
+		return util.FmtNewtError(
+			"Meta region at offset %d lacks a footer at offset %d",
+			layout.Offset, end-META_FOOTER_SZ)
 	}
 
-	metaOff := bootArea.Offset + bootArea.Size - buf.Len()
-	for i := metaOff; i < bootArea.Size; i++ {
-		if section0Data[i] != 0xff {
-			return 0, 0, util.FmtNewtError(
-				"Boot loader extends into meta region; "+
-					"meta region starts at offset %d", metaOff)
+	size := int(binary.LittleEndian.Uint16(footer))
+	if size != regionLen || layout.Size != regionLen {
+		return util.FmtNewtError(
+			"Meta region at offset %d has incorrect footer size; "+
+				"footer=%d layout=%d actual=%d",
+			layout.Offset, size, layout.Size, regionLen)
+	}
+
+	return nil
+}
+
+// Describes each element of a meta region in the order it was written: the
+// header, every TLV, and the footer.  Each line indicates the element's
+// offset within its section, its size, and its type.  A chained layout's
+// secondary region is described after the primary.
+func metaTrace(layout MetaLayout, label string) []string {
+	lines := []string{fmt.Sprintf(
+		"%s meta region: section=%d offset=0x%x size=%d reserved=%d",
+		label, layout.Section, layout.Offset, layout.Size, layout.Reserved)}
+
+	add := func(off int, size int, desc string) {
+		lines = append(lines, fmt.Sprintf("    0x%06x %4d %s", off, size, desc))
+	}
+
+	add(layout.Offset, 4, "header")
+	for _, tlv := range layout.Tlvs {
+		desc := metaTlvName(uint8(tlv.Type))
+		if tlv.Name != "" {
+			desc += " (" + tlv.Name + ")"
 		}
+		add(tlv.Offset, tlv.Size, desc)
 	}
+	add(layout.Offset+layout.Size-META_FOOTER_SZ, META_FOOTER_SZ, "footer")
 
-	// Copy the meta region into the manufacturing image.  The meta hash is
-	// still zeroed.
-	copy(section0Data[metaOff:], buf.Bytes())
+	if layout.Chain != nil {
+		lines = append(lines, metaTrace(*layout.Chain, "secondary")...)
+	}
 
-	return metaOff, metaOff + hashSubOff, nil
+	return lines
+}
+
+// Inserts the meta region into section 0.  The section is extended with
+// unwritten flash if a chained region lies beyond its end; the possibly
+// extended section is returned.
+func insertMeta(section0Data []byte, flashMap flash.FlashMap,
+	params metaParams) ([]byte, MetaLayout, error) {
+
+	// Refuse to emit a region the boot loader cannot parse.
+	if params.maxVersion != 0 && int(params.version()) > params.maxVersion {
+		return nil, MetaLayout{}, util.FmtNewtError(
+			"Meta region requires version %d, but the boot loader "+
+				"supports version %d at most (target.meta_version); "+
+				"features requiring version %d: %s", params.version(),
+			params.maxVersion, META_VERSION_2,
+			strings.Join(params.v2Features(), ", "))
+	}
+
+	meta, layout, err := buildMeta(flashMap, params)
+	if err != nil {
+		return nil, layout, err
+	}
+
+	for _, line := range metaTrace(layout, "primary") {
+		util.StatusMessage(util.VERBOSITY_VERBOSE, "%s\n", line)
+	}
+
+	if err := params.orderPolicy.checkLayout(layout); err != nil {
+		return nil, layout, err
+	}
+
+	eraseVal := flashMap.EraseVal(layout.Section)
+
+	if layout.Chain != nil {
+		chain, chainLayout, err := buildChainMeta(flashMap, params)
+		if err != nil {
+			return nil, layout, err
+		}
+
+		// The entire chain area must be unwritten.
+		chainArea := flashMap.Areas[params.chainArea]
+		chainEnd := chainArea.Offset + chainArea.Size
+		for len(section0Data) < chainEnd {
+			section0Data = append(section0Data, eraseVal)
+		}
+		for i := chainArea.Offset; i < chainEnd; i++ {
+			if section0Data[i] != eraseVal {
+				return nil, layout, util.FmtNewtError(
+					"Meta chain area %s is not erased; "+
+						"data present at offset %d", params.chainArea, i)
+			}
+		}
+
+		if err := copyRegion(section0Data, chain, chainLayout, eraseVal,
+			"Chain area data"); err != nil {
+
+			return nil, layout, err
+		}
+		if err := checkMetaFooter(section0Data, chainLayout,
+			len(chain)); err != nil {
+
+			return nil, layout, err
+		}
+	}
+
+	// Copy the meta region into the manufacturing image.  The meta hash (and
+	// HMAC, if present) is still zeroed.
+	if err := copyRegion(section0Data, meta, layout, eraseVal,
+		"Boot loader"); err != nil {
+
+		return nil, layout, err
+	}
+	if err := checkMetaFooter(section0Data, layout, len(meta)); err != nil {
+		return nil, layout, err
+	}
+
+	return section0Data, layout, nil
 }
 
 // Calculates the SHA256 hash, using the full manufacturing image as input.
 // Hash-calculation algorithm is as follows:
 // 1. Concatenate sections in ascending order of index.
 // 2. Zero out the 32 bytes that will contain the hash.
-// 3. Apply SHA256 to the result.
+// 3. Prepend the salt, if any.
+// 4. Apply SHA256 to the result.
 //
 // This function assumes that the 32 bytes of hash data have already been
 // zeroed.
-func calcMetaHash(sections [][]byte) []byte {
-	// Concatenate all sections.
+func calcMetaHash(sections [][]byte, salt []byte) []byte {
+	// Concatenate the salt and all sections.
+	blob := append([]byte{}, salt...)
+	blob = append(blob, concatSections(sections)...)
+
+	// Calculate hash.
+	hash := sha256.Sum256(blob)
+
+	return hash[:]
+}
+
+// Calculates the HMAC-SHA256 of the full manufacturing image using the
+// specified key.  The input is identical to that of the plain hash: both the
+// hash and the HMAC fields must be zeroed when this function is called.
+func calcMetaHmac(sections [][]byte, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(concatSections(sections))
+
+	return mac.Sum(nil)
+}
+
+// Calculates the CRC32 (IEEE) of the full manufacturing image.  Unlike the
+// hash, the CRC covers the filled-in hash and HMAC fields; only the CRC and
+// region CRC fields must be zeroed when this function is called.
+func calcMetaCrc(sections [][]byte) uint32 {
+	return crc32.ChecksumIEEE(concatSections(sections))
+}
+
+// Accumulates the meta hash, and optionally the HMAC, one section at a time.
+// Adding the sections in ascending order of index yields the same values as
+// calcMetaHash and calcMetaHmac.  As with those functions, the hash and HMAC
+// fields must be zeroed when section 0 is added.
+type metaHasher struct {
+	hash hash.Hash
+	mac  hash.Hash
+}
+
+func newMetaHasher(salt []byte, hmacKey []byte) *metaHasher {
+	mh := &metaHasher{
+		hash: sha256.New(),
+	}
+	mh.hash.Write(salt)
+
+	if hmacKey != nil {
+		mh.mac = hmac.New(sha256.New, hmacKey)
+	}
+
+	return mh
+}
+
+func (mh *metaHasher) addSection(section []byte) {
+	mh.hash.Write(section)
+	if mh.mac != nil {
+		mh.mac.Write(section)
+	}
+}
+
+// Returns the hash and HMAC of all added sections.  The HMAC is nil if no key
+// was specified.
+func (mh *metaHasher) sum() ([]byte, []byte) {
+	var mac []byte
+	if mh.mac != nil {
+		mac = mh.mac.Sum(nil)
+	}
+
+	return mh.hash.Sum(nil), mac
+}
+
+func concatSections(sections [][]byte) []byte {
 	blob := []byte{}
 	for _, section := range sections {
 		blob = append(blob, section...)
 	}
 
-	// Calculate hash.
-	hash := sha256.Sum256(blob)
+	return blob
+}
 
-	return hash[:]
+// A single TLV parsed from a meta region.
+type MetaTlv struct {
+	Type   uint8
+	Offset int // Offset of the TLV header within the parsed data.
+	Data   []byte
+}
+
+// A meta region parsed from raw flash contents.  If the primary region links
+// to a secondary region, the secondary region's TLVs are appended to Tlvs.
+type Meta struct {
+	Version uint8
+	Offset  int // Offset of the region within the parsed data.
+	Size    int
+	Tlvs    []MetaTlv
+
+	// The secondary region, if the primary region contains a chain TLV.
+	Chain *Meta
+}
+
+// Attempts to parse a meta region ending at the specified offset.
+func parseMetaAt(data []byte, end int) (Meta, bool) {
+	meta := Meta{}
+
+	if end < META_FOOTER_SZ ||
+		binary.LittleEndian.Uint32(data[end-4:]) != META_MAGIC {
+
+		return meta, false
+	}
+
+	meta.Size = int(binary.LittleEndian.Uint16(data[end-META_FOOTER_SZ:]))
+	meta.Offset = end - meta.Size
+	if meta.Offset < 0 || meta.Size < 4+META_FOOTER_SZ ||
+		data[meta.Offset] < META_VERSION_1 ||
+		data[meta.Offset] > META_VERSION {
+
+		return meta, false
+	}
+	meta.Version = data[meta.Offset]
+
+	// TLVs lie between the header and the footer.
+	tlvsEnd := end - META_FOOTER_SZ
+	for off := meta.Offset + 4; off < tlvsEnd; {
+		if off+2 > tlvsEnd {
+			return meta, false
+		}
+
+		tlv := MetaTlv{
+			Type:   metaTlvFromWire(data[off]),
+			Offset: off,
+		}
+		dataStart := off + 2
+		dataEnd := dataStart + int(data[off+1])
+		if dataEnd > tlvsEnd {
+			return meta, false
+		}
+		tlv.Data = data[dataStart:dataEnd]
+		meta.Tlvs = append(meta.Tlvs, tlv)
+
+		off = dataEnd
+	}
+
+	return meta, true
+}
+
+// Verifies the region CRC TLV of a single parsed region, if it has one.  The
+// TLV must be the region's last; the CRC covers everything before it.  This
+// must be done before any of the region's other TLVs are trusted.
+func (meta *Meta) verifyRegionCrc(data []byte) error {
+	tlv := findMetaTlv(*meta, META_TLV_CODE_REGION_CRC)
+	if tlv == nil {
+		return nil
+	}
+
+	if len(tlv.Data) != META_TLV_REGION_CRC_SZ {
+		return util.FmtNewtError(
+			"Region CRC TLV at offset %d has invalid size: %d",
+			tlv.Offset, len(tlv.Data))
+	}
+	if tlv.Offset != meta.Tlvs[len(meta.Tlvs)-1].Offset {
+		return util.FmtNewtError(
+			"Region CRC TLV at offset %d is not the region's final TLV",
+			tlv.Offset)
+	}
+
+	stored := binary.LittleEndian.Uint32(tlv.Data)
+	crc := calcRegionCrc(data, meta.Offset, tlv.Offset+2)
+	if crc != stored {
+		return util.FmtNewtError(
+			"Meta region at offset 0x%x is corrupt; "+
+				"region CRC mismatch: meta=%08x calculated=%08x",
+			meta.Offset, stored, crc)
+	}
+
+	return nil
+}
+
+// Parses the secondary region that the primary region's chain TLV points to
+// and merges its TLVs into the primary.
+func (meta *Meta) followChain(data []byte) error {
+	tlv := findMetaTlv(*meta, META_TLV_CODE_CHAIN)
+	if tlv == nil {
+		return nil
+	}
+
+	if len(tlv.Data) != META_TLV_CHAIN_SZ {
+		return util.FmtNewtError(
+			"Chain TLV at offset %d has invalid size: %d",
+			tlv.Offset, len(tlv.Data))
+	}
+
+	device := int(tlv.Data[0])
+	size := int(binary.LittleEndian.Uint16(tlv.Data[2:]))
+	offset := int(binary.LittleEndian.Uint32(tlv.Data[4:]))
+
+	if device != 0 {
+		return util.FmtNewtError(
+			"Chained meta region in flash device %d not supported", device)
+	}
+
+	end := offset + size
+	if end > len(data) {
+		return util.FmtNewtError(
+			"Chained meta region extends beyond end of data; "+
+				"offset=0x%x size=%d", offset, size)
+	}
+
+	chain, ok := parseMetaAt(data, end)
+	if !ok || chain.Offset != offset {
+		return util.FmtNewtError(
+			"No chained meta region found at offset 0x%x", offset)
+	}
+	if err := chain.verifyRegionCrc(data); err != nil {
+		return err
+	}
+	if findMetaTlv(chain, META_TLV_CODE_CHAIN) != nil {
+		return util.FmtNewtError(
+			"Chained meta region at offset 0x%x contains a chain TLV",
+			offset)
+	}
+
+	meta.Chain = &chain
+	meta.Tlvs = append(meta.Tlvs, chain.Tlvs...)
+
+	return nil
+}
+
+// Locates and parses the meta region in a raw dump of flash device 0.  The
+// region is found by searching backwards for the footer magic.  Only a region
+// containing a hash TLV is accepted; this skips over the secondary region of
+// a chained layout, which is then located via the primary's chain TLV.  If a
+// region contains a region CRC TLV, the CRC is verified before the region's
+// other TLVs are used.
+func ParseMeta(data []byte) (Meta, error) {
+	for end := len(data); end >= META_FOOTER_SZ; end-- {
+		meta, ok := parseMetaAt(data, end)
+		if !ok || findMetaTlv(meta, META_TLV_CODE_HASH) == nil {
+			continue
+		}
+
+		if err := meta.verifyRegionCrc(data); err != nil {
+			return meta, err
+		}
+
+		if err := meta.followChain(data); err != nil {
+			return meta, err
+		}
+		return meta, nil
+	}
+
+	return Meta{}, util.NewNewtError("No manufacturing meta region found")
+}
+
+// Generates a name for a flash area read from a meta region.  Flash area TLVs
+// do not contain names, so only system areas can be named accurately.
+func syntheticAreaName(id int) string {
+	for name, sysId := range flash.SYSTEM_AREA_NAME_ID_MAP {
+		if sysId == id {
+			return name
+		}
+	}
+
+	if id >= flash.AREA_USER_ID_MIN {
+		return fmt.Sprintf("FLASH_AREA_USER_%d", id-flash.AREA_USER_ID_MIN)
+	}
+	return fmt.Sprintf("FLASH_AREA_%d", id)
+}
+
+// Reconstructs a flash map from the flash area TLVs of a parsed meta region.
+func (meta Meta) FlashMap() (flash.FlashMap, error) {
+	areas := []flash.FlashArea{}
+
+	for _, tlv := range meta.Tlvs {
+		if tlv.Type != META_TLV_CODE_FLASH_AREA {
+			continue
+		}
+
+		if len(tlv.Data) != META_TLV_FLASH_AREA_SZ {
+			return flash.FlashMap{}, util.FmtNewtError(
+				"Flash area TLV at offset %d has invalid size: %d",
+				tlv.Offset, len(tlv.Data))
+		}
+
+		id := int(tlv.Data[0])
+		areas = append(areas, flash.FlashArea{
+			Name:   syntheticAreaName(id),
+			Id:     id,
+			Device: int(tlv.Data[1]),
+			Offset: int(binary.LittleEndian.Uint32(tlv.Data[4:])),
+			Size:   int(binary.LittleEndian.Uint32(tlv.Data[8:])),
+		})
+	}
+
+	return flash.NewFlashMap(areas)
+}
+
+// Parses a set of "<device>=<base>" strings into a map of device ID to the
+// address at which the device is programmed.  These bases translate the
+// device-relative offsets in flash area TLVs into absolute addresses.
+func ParseDeviceBases(strs []string) (map[int]int, error) {
+	bases := map[int]int{}
+
+	for _, s := range strs {
+		parts := strings.SplitN(s, "=", 2)
+		if len(parts) != 2 {
+			return nil, util.FmtNewtError(
+				"Invalid device base \"%s\"; expected <device>=<base>", s)
+		}
+
+		device, err := util.AtoiNoOct(strings.TrimSpace(parts[0]))
+		if err != nil || device < 0 || device > 0xff {
+			return nil, util.FmtNewtError(
+				"Invalid device ID in device base \"%s\"", s)
+		}
+
+		base, err := util.AtoiNoOct(strings.TrimSpace(parts[1]))
+		if err != nil || base < 0 {
+			return nil, util.FmtNewtError(
+				"Invalid base address in device base \"%s\"", s)
+		}
+
+		if _, ok := bases[device]; ok {
+			return nil, util.FmtNewtError(
+				"Duplicate base for device %d", device)
+		}
+		bases[device] = base
+	}
+
+	return bases, nil
 }
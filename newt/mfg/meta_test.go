@@ -0,0 +1,1264 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+)
+
+// Writes section 0 to a file and checks its HMAC with the specified key, the
+// same way mfg verify does.
+func testVerifyHmac(t *testing.T, section []byte, key []byte) (bool, error) {
+	dir, path := testSectionFile(t, section)
+	defer os.RemoveAll(dir)
+
+	meta, err := ParseMeta(section)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return VerifyMetaHmac([]string{path}, meta, key)
+}
+
+func TestMetaHmac(t *testing.T) {
+	key := []byte("factory secret")
+
+	tests := []struct {
+		desc    string
+		verKey  []byte
+		tamper  int // Offset within section 0 to corrupt; -1 for none.
+		wantErr bool
+	}{
+		{"correct key", key, -1, false},
+		{"wrong key", []byte("other secret"), -1, true},
+		{"tampered boot loader", key, 0x10, true},
+		{"tampered flash area TLV", key, -2, true},
+	}
+
+	for _, test := range tests {
+		params := testMetaParams()
+		params.withHmac = true
+		section, meta, layout := testInsertAndParse(t, params)
+
+		if layout.HmacOffset == 0 {
+			t.Fatalf("layout has no HMAC offset")
+		}
+		if findMetaTlv(meta, META_TLV_CODE_HMAC) == nil {
+			t.Fatalf("region has no HMAC TLV")
+		}
+
+		// HMAC alone does not require meta version 2.
+		if meta.Version != META_VERSION_1 {
+			t.Errorf("HMAC region has meta version %d; want %d",
+				meta.Version, META_VERSION_1)
+		}
+
+		sections := [][]byte{section}
+		mac := calcMetaHmac(sections, key)
+		copy(section[layout.HmacOffset:], mac)
+
+		switch {
+		case test.tamper >= 0:
+			section[test.tamper] ^= 0xff
+		case test.tamper == -2:
+			section[layout.Tlvs[0].Offset+4] ^= 0xff
+		}
+
+		ok, err := testVerifyHmac(t, section, test.verKey)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.desc, err.Error())
+		}
+		if test.wantErr && ok {
+			t.Errorf("%s: expected HMAC mismatch", test.desc)
+		}
+		if !test.wantErr && !ok {
+			t.Errorf("%s: unexpected HMAC mismatch", test.desc)
+		}
+	}
+}
+
+// The HMAC is calculated with the hash field zeroed, so filling in the hash
+// does not invalidate it.
+func TestMetaHmacIgnoresHash(t *testing.T) {
+	key := []byte("factory secret")
+
+	params := testMetaParams()
+	params.withHmac = true
+	section, _, layout := testInsertAndParse(t, params)
+
+	sections := [][]byte{section}
+	hash := calcMetaHash(sections, nil)
+	mac := calcMetaHmac(sections, key)
+	copy(section[layout.HashOffset:], hash)
+	copy(section[layout.HmacOffset:], mac)
+
+	ok, err := testVerifyHmac(t, section, key)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+	}
+	if !ok {
+		t.Errorf("HMAC mismatch after filling in hash")
+	}
+}
+
+func TestMetaHmacAbsent(t *testing.T) {
+	section, meta, _ := testInsertAndParse(t, testMetaParams())
+
+	if findMetaTlv(meta, META_TLV_CODE_HMAC) != nil {
+		t.Errorf("region without HMAC contains HMAC TLV")
+	}
+	if _, err := testVerifyHmac(t, section, []byte("key")); err == nil {
+		t.Errorf("expected error verifying region without HMAC")
+	}
+}
+
+func TestMetaChain(t *testing.T) {
+	tests := []struct {
+		desc      string
+		regionCrc bool
+	}{
+		{"plain", false},
+		{"with region CRC", true},
+	}
+
+	fm := testFlashMap(t)
+	chainArea := fm.Areas[testChainArea]
+
+	for _, test := range tests {
+		params := testMetaParams()
+		params.chainArea = testChainArea
+		params.withRegionCrc = test.regionCrc
+
+		section, meta, layout := testInsertAndParse(t, params)
+
+		if layout.Chain == nil {
+			t.Fatalf("%s: layout has no secondary region", test.desc)
+		}
+		chainEnd := layout.Chain.Offset + layout.Chain.Size
+		if chainEnd != chainArea.Offset+chainArea.Size {
+			t.Errorf("%s: secondary region ends at 0x%x; want 0x%x",
+				test.desc, chainEnd, chainArea.Offset+chainArea.Size)
+		}
+		if len(section) < chainEnd {
+			t.Errorf("%s: section 0 not extended to secondary region; "+
+				"len=0x%x", test.desc, len(section))
+		}
+		if meta.Version != META_VERSION_2 {
+			t.Errorf("%s: chained region has meta version %d",
+				test.desc, meta.Version)
+		}
+
+		// The primary region holds a chain TLV in place of the flash
+		// areas; the secondary region holds the flash areas.
+		if meta.Chain == nil {
+			t.Fatalf("%s: parsed region has no secondary region", test.desc)
+		}
+		if meta.Chain.Offset != layout.Chain.Offset {
+			t.Errorf("%s: secondary region parsed at 0x%x; want 0x%x",
+				test.desc, meta.Chain.Offset, layout.Chain.Offset)
+		}
+		for _, tlv := range meta.Chain.Tlvs {
+			if tlv.Type == META_TLV_CODE_HASH ||
+				tlv.Type == META_TLV_CODE_CHAIN {
+
+				t.Errorf("%s: secondary region contains TLV type %d",
+					test.desc, tlv.Type)
+			}
+		}
+		if findMetaTlv(*meta.Chain, META_TLV_CODE_REGION_CRC) != nil !=
+			test.regionCrc {
+
+			t.Errorf("%s: secondary region CRC presence mismatch", test.desc)
+		}
+
+		// The parsed TLVs reproduce the flash map.
+		parsed, err := meta.FlashMap()
+		if err != nil {
+			t.Fatalf("%s: %s", test.desc, err.Error())
+		}
+		if len(parsed.Areas) != len(fm.Areas) {
+			t.Errorf("%s: parsed %d flash areas; want %d",
+				test.desc, len(parsed.Areas), len(fm.Areas))
+		}
+		for _, area := range fm.Areas {
+			found := false
+			for _, p := range parsed.Areas {
+				if p.Id == area.Id && p.Device == area.Device &&
+					p.Offset == area.Offset && p.Size == area.Size {
+
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("%s: flash area %s missing from parsed map",
+					test.desc, area.Name)
+			}
+		}
+	}
+}
+
+func TestMetaChainCorrupt(t *testing.T) {
+	params := testMetaParams()
+	params.chainArea = testChainArea
+	params.withRegionCrc = true
+
+	section, _, layout := testInsertAndParse(t, params)
+
+	tests := []struct {
+		desc   string
+		offset int
+	}{
+		// A flash area TLV in the secondary region; caught by its CRC.
+		{"secondary TLV", layout.Chain.Tlvs[0].Offset + 4},
+
+		// The secondary region's footer magic.
+		{"secondary magic", layout.Chain.Offset + layout.Chain.Size - 1},
+	}
+
+	for _, test := range tests {
+		corrupt := append([]byte{}, section...)
+		corrupt[test.offset] ^= 0xff
+
+		if _, err := ParseMeta(corrupt); err == nil {
+			t.Errorf("%s: expected error parsing corrupt chain", test.desc)
+		}
+	}
+}
+
+func TestMetaChainMissingArea(t *testing.T) {
+	params := testMetaParams()
+	params.chainArea = "FLASH_AREA_NONEXISTENT"
+
+	if _, _, err := insertMeta(testSection0(), testFlashMap(t),
+		params); err == nil {
+
+		t.Errorf("expected error chaining to undefined flash area")
+	}
+}
+
+func tlvIndex(meta Meta, typ uint8) int {
+	for i, tlv := range meta.Tlvs {
+		if tlv.Type == typ {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestMetaSalt(t *testing.T) {
+	tests := []struct {
+		salt    []byte
+		wantErr bool
+	}{
+		{nil, false},
+		{[]byte{0x01}, false},
+		{bytes.Repeat([]byte{0xa5}, 32), false},
+		{bytes.Repeat([]byte{0xa5}, META_TLV_SALT_MAX_SZ), false},
+		{bytes.Repeat([]byte{0xa5}, META_TLV_SALT_MAX_SZ+1), true},
+	}
+
+	for _, test := range tests {
+		params := testMetaParams()
+		params.salt = test.salt
+
+		if test.wantErr {
+			if _, _, err := insertMeta(testSection0(), testFlashMap(t),
+				params); err == nil {
+
+				t.Errorf("salt of %d bytes: expected error", len(test.salt))
+			}
+			continue
+		}
+
+		section, meta, _ := testInsertAndParse(t, params)
+
+		saltIdx := tlvIndex(meta, META_TLV_CODE_SALT)
+		hashIdx := tlvIndex(meta, META_TLV_CODE_HASH)
+		if len(test.salt) == 0 {
+			if saltIdx != -1 {
+				t.Errorf("unsalted region contains salt TLV")
+			}
+			if meta.Version != META_VERSION_1 {
+				t.Errorf("unsalted region has meta version %d", meta.Version)
+			}
+			continue
+		}
+
+		// The salt TLV immediately precedes the hash TLV.
+		if saltIdx == -1 || saltIdx != hashIdx-1 {
+			t.Errorf("salt of %d bytes: salt TLV at %d, hash TLV at %d",
+				len(test.salt), saltIdx, hashIdx)
+			continue
+		}
+		if !bytes.Equal(meta.Tlvs[saltIdx].Data, test.salt) {
+			t.Errorf("salt TLV contains %x; want %x",
+				meta.Tlvs[saltIdx].Data, test.salt)
+		}
+		if meta.Version != META_VERSION_2 {
+			t.Errorf("salted region has meta version %d", meta.Version)
+		}
+
+		// The salt is prepended to the image when the hash is calculated.
+		sections := [][]byte{section}
+		want := sha256.Sum256(append(append([]byte{}, test.salt...),
+			section...))
+		if got := calcMetaHash(sections, test.salt); !bytes.Equal(got,
+			want[:]) {
+
+			t.Errorf("salted hash %x; want %x", got, want)
+		}
+		if bytes.Equal(calcMetaHash(sections, test.salt),
+			calcMetaHash(sections, nil)) {
+
+			t.Errorf("salt does not affect hash")
+		}
+	}
+}
+
+func TestLicenseEncoding(t *testing.T) {
+	long := strings.Repeat("c", META_TLV_LICENSE_MAX_SZ)
+
+	tests := []struct {
+		license       string
+		copyright     string
+		wantTruncated bool
+		wantLicense   string
+		wantCopyright string
+	}{
+		{"Apache-2.0", "Copyright 2026 Example", false,
+			"Apache-2.0", "Copyright 2026 Example"},
+		{"", "Copyright 2026 Example", false, "", "Copyright 2026 Example"},
+		{"MIT", "", false, "MIT", ""},
+		{"MIT", long, true, "MIT", long[:META_TLV_LICENSE_MAX_SZ-4]},
+	}
+
+	for _, test := range tests {
+		data, truncated := encodeLicense(test.license, test.copyright)
+		if truncated != test.wantTruncated {
+			t.Errorf("encodeLicense(%q, %q): truncated=%v; want %v",
+				test.license, test.copyright, truncated, test.wantTruncated)
+		}
+		if len(data) > META_TLV_LICENSE_MAX_SZ {
+			t.Errorf("encodeLicense(%q, ...): %d bytes exceeds maximum",
+				test.license, len(data))
+		}
+
+		license, copyright := DecodeLicense(data)
+		if license != test.wantLicense || copyright != test.wantCopyright {
+			t.Errorf("DecodeLicense(encodeLicense(%q, %q)) = %q, %q",
+				test.license, test.copyright, license, copyright)
+		}
+	}
+}
+
+func TestMetaLicenseTlv(t *testing.T) {
+	data, _ := encodeLicense("Apache-2.0", "Copyright 2026 Example")
+
+	params := testMetaParams()
+	params.license = data
+	_, meta, _ := testInsertAndParse(t, params)
+
+	tlv := findMetaTlv(meta, META_TLV_CODE_LICENSE)
+	if tlv == nil {
+		t.Fatalf("region contains no license TLV")
+	}
+	if !bytes.Equal(tlv.Data, data) {
+		t.Errorf("license TLV contains %q; want %q", tlv.Data, data)
+	}
+	if meta.Version != META_VERSION_2 {
+		t.Errorf("licensed region has meta version %d", meta.Version)
+	}
+
+	// The license follows the flash area TLVs.
+	lastArea := -1
+	for i, tlv := range meta.Tlvs {
+		if tlv.Type == META_TLV_CODE_FLASH_AREA {
+			lastArea = i
+		}
+	}
+	if idx := tlvIndex(meta, META_TLV_CODE_LICENSE); idx < lastArea {
+		t.Errorf("license TLV at %d precedes flash area TLV at %d",
+			idx, lastArea)
+	}
+
+	// A license too long for a TLV is rejected rather than emitted.
+	params.license = bytes.Repeat([]byte{'x'}, META_TLV_LICENSE_MAX_SZ+1)
+	if _, _, err := insertMeta(testSection0(), testFlashMap(t),
+		params); err == nil {
+
+		t.Errorf("expected error for oversized license TLV")
+	}
+}
+
+func TestMetaCrc(t *testing.T) {
+	params := testMetaParams()
+	params.withCrc = true
+	params.withRegionCrc = true
+	section, meta, layout := testInsertAndParse(t, params)
+
+	if layout.CrcOffset == 0 {
+		t.Fatalf("layout does not record CRC offset")
+	}
+	if tlv := findMetaTlv(meta, META_TLV_CODE_CRC); tlv == nil ||
+		tlv.Offset+2 != layout.CrcOffset {
+
+		t.Fatalf("CRC TLV not at layout offset 0x%x", layout.CrcOffset)
+	}
+
+	// The CRC is calculated with the CRC and region CRC fields zeroed.
+	zeroed := make([]byte, len(section))
+	copy(zeroed, section)
+	for i := 0; i < META_TLV_REGION_CRC_SZ; i++ {
+		zeroed[layout.RegionCrcOffset+i] = 0
+	}
+	want := calcMetaCrc([][]byte{zeroed})
+
+	// Streaming a section with the fields filled in must produce the same
+	// CRC, as the zero windows mask them out.
+	binary.LittleEndian.PutUint32(section[layout.CrcOffset:], want)
+
+	dir, err := ioutil.TempDir("", "newt-meta-crc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "section0.bin")
+	if err := ioutil.WriteFile(path, section, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := streamMetaCrc([]string{path}, crcZeroWindows(meta))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("streamed CRC=%08x; want %08x", got, want)
+	}
+
+	// Unlike the hash, the CRC covers the boot loader and every other byte
+	// outside the meta region.
+	section[0] ^= 0xff
+	if err := ioutil.WriteFile(path, section, 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err = streamMetaCrc([]string{path}, crcZeroWindows(meta))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == want {
+		t.Errorf("CRC unchanged after modifying boot loader")
+	}
+}
+
+func TestMetaRegionCrc(t *testing.T) {
+	params := testMetaParams()
+	params.withRegionCrc = true
+	section, meta, layout := testInsertAndParse(t, params)
+
+	if last := meta.Tlvs[len(meta.Tlvs)-1]; last.Type !=
+		META_TLV_CODE_REGION_CRC {
+
+		t.Fatalf("region CRC TLV is not the final TLV; type=%d", last.Type)
+	}
+
+	tests := []struct {
+		name    string
+		offset  int
+		wantErr bool
+	}{
+		{"boot loader", 0, false},
+		{"region header", layout.Offset, true},
+		{"flash area TLV", layout.Tlvs[0].Offset + 2, true},
+		{"region CRC data", layout.RegionCrcOffset, true},
+		{"before region", layout.Offset - 1, false},
+	}
+
+	for _, test := range tests {
+		corrupt := make([]byte, len(section))
+		copy(corrupt, section)
+		corrupt[test.offset] ^= 0x01
+
+		_, err := ParseMeta(corrupt)
+		if test.wantErr && err == nil {
+			t.Errorf("%s: expected region CRC error", test.name)
+		} else if !test.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+	}
+}
+
+func TestMetaMaxVersion(t *testing.T) {
+	serial := uint64(1)
+	v2 := func(f func(p *metaParams)) metaParams {
+		p := testMetaParams()
+		f(&p)
+		return p
+	}
+
+	tests := []struct {
+		name       string
+		params     metaParams
+		maxVersion int
+		wantErr    bool
+		wantVer    uint8
+	}{
+		{"v1 unrestricted", testMetaParams(), 0, false, META_VERSION_1},
+		{"v1 pinned to v1", testMetaParams(), 1, false, META_VERSION_1},
+		{"salt pinned to v1",
+			v2(func(p *metaParams) { p.salt = []byte{1} }), 1, true, 0},
+		{"crc pinned to v1",
+			v2(func(p *metaParams) { p.withCrc = true }), 1, true, 0},
+		{"serial pinned to v1",
+			v2(func(p *metaParams) { p.serial = &serial }), 1, true, 0},
+		{"chain pinned to v1",
+			v2(func(p *metaParams) { p.chainArea = testChainArea }), 1,
+			true, 0},
+		{"crc pinned to v2",
+			v2(func(p *metaParams) { p.withCrc = true }), 2, false,
+			META_VERSION_2},
+		{"crc unrestricted",
+			v2(func(p *metaParams) { p.withCrc = true }), 0, false,
+			META_VERSION_2},
+	}
+
+	for _, test := range tests {
+		params := test.params
+		params.maxVersion = test.maxVersion
+
+		section, layout, err := insertMeta(testSection0(),
+			testFlashMap(t), params)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected version error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if layout.RegionCrcOffset != 0 {
+			fillRegionCrc(section, layout.Offset, layout.RegionCrcOffset)
+		}
+		meta, err := ParseMeta(section)
+		if err != nil {
+			t.Errorf("%s: parse failed: %v", test.name, err)
+			continue
+		}
+		if meta.Version != test.wantVer {
+			t.Errorf("%s: version=%d; want %d",
+				test.name, meta.Version, test.wantVer)
+		}
+	}
+}
+
+func TestMetaPlaceholders(t *testing.T) {
+	fm := testFlashMap(t)
+	area := fm.Areas[flash.FLASH_AREA_NAME_IMAGE_1]
+
+	for _, unhashed := range []bool{false, true} {
+		params := testMetaParams()
+		params.placeholders = []flash.FlashArea{area}
+		params.placeholdersUnhashed = unhashed
+		section, meta, _ := testInsertAndParse(t, params)
+
+		tlv := findMetaTlv(meta, META_TLV_CODE_PLACEHOLDER)
+		if tlv == nil {
+			t.Fatalf("unhashed=%v: region contains no placeholder TLV",
+				unhashed)
+		}
+		if int(tlv.Data[0]) != area.Id {
+			t.Errorf("unhashed=%v: placeholder TLV area=%d; want %d",
+				unhashed, tlv.Data[0], area.Id)
+		}
+		if got := tlv.Data[1]&META_PLACEHOLDER_F_UNHASHED != 0; got !=
+			unhashed {
+
+			t.Errorf("unhashed=%v: placeholder TLV unhashed flag=%v",
+				unhashed, got)
+		}
+		if meta.Version != META_VERSION_2 {
+			t.Errorf("unhashed=%v: meta version %d", unhashed, meta.Version)
+		}
+
+		// Extend section 0 through the placeholder area, then provision
+		// the area.  The hash changes only if the area is hashed.
+		section = append(section,
+			bytes.Repeat([]byte{0xff}, area.Offset+area.Size-len(section))...)
+		provisioned := make([]byte, len(section))
+		copy(provisioned, section)
+		for i := 0; i < area.Size; i++ {
+			provisioned[area.Offset+i] = 0xa5
+		}
+
+		hashes := [][]byte{}
+		for _, data := range [][]byte{section, provisioned} {
+			dir, path := testSectionFile(t, data)
+			defer os.RemoveAll(dir)
+
+			hash, err := streamMetaHash([]string{path},
+				hashZeroWindows(meta), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hashes = append(hashes, hash)
+		}
+
+		same := bytes.Equal(hashes[0], hashes[1])
+		if same != unhashed {
+			t.Errorf("unhashed=%v: provisioning changed hash: %v",
+				unhashed, !same)
+		}
+	}
+}
+
+func TestMetaAlign(t *testing.T) {
+	bootEnd := 0x4000
+
+	tests := []struct {
+		align   int
+		bootLen int // Length of boot loader data at the start of section 0.
+		wantErr bool
+	}{
+		{0, 0x100, false},
+		{1, 0x100, false},
+		{4, 0x100, false},
+		{256, 0x100, false},
+		{0x1000, 0x100, false},
+		// Boot loader data lies within the space the alignment claims.
+		{0x1000, 0x3100, true},
+	}
+
+	for _, test := range tests {
+		section := testSection0()
+		for i := 0; i < test.bootLen; i++ {
+			section[i] = byte(i)
+		}
+
+		params := testMetaParams()
+		params.align = test.align
+		section, layout, err := insertMeta(section, testFlashMap(t), params)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("align=%d: expected error", test.align)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("align=%d: unexpected error: %v", test.align, err)
+			continue
+		}
+
+		if test.align > 1 && layout.Offset%test.align != 0 {
+			t.Errorf("align=%d: region offset 0x%x not aligned",
+				test.align, layout.Offset)
+		}
+		if layout.Reserved != bootEnd-layout.Offset {
+			t.Errorf("align=%d: reserved=%d; want %d",
+				test.align, layout.Reserved, bootEnd-layout.Offset)
+		}
+		if test.align <= 1 && layout.Reserved != layout.Size {
+			t.Errorf("align=%d: unaligned region not flush with area end",
+				test.align)
+		}
+
+		// The parser locates the region at its aligned start.
+		meta, err := ParseMeta(section)
+		if err != nil {
+			t.Errorf("align=%d: parse failed: %v", test.align, err)
+		} else if meta.Offset != layout.Offset {
+			t.Errorf("align=%d: parsed offset 0x%x; want 0x%x",
+				test.align, meta.Offset, layout.Offset)
+		}
+	}
+}
+
+func TestMetaSectorStraddle(t *testing.T) {
+	_, plain, _ := testInsertAndParse(t, testMetaParams())
+
+	tests := []struct {
+		name       string
+		sectorSize int
+		align      int
+		wantErr    bool
+	}{
+		{"no sector size", 0, 0, false},
+		{"large sectors", 0x1000, 0, false},
+		{"sectors smaller than region", plain.Size / 2, 0, true},
+		// The sectors are larger than the region, but a boundary falls
+		// two bytes before the boot area end.
+		{"boundary inside region", 0x1fff, 0, true},
+		// Aligning the start to the sector size keeps it in one sector.
+		{"aligned to sector", 256, 256, false},
+	}
+
+	for _, test := range tests {
+		params := testMetaParams()
+		params.sectorSize = test.sectorSize
+		params.align = test.align
+
+		_, layout, err := insertMeta(testSection0(), testFlashMap(t),
+			params)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected straddle error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if test.sectorSize > 0 {
+			end := layout.Offset + layout.Reserved - 1
+			if layout.Offset/test.sectorSize != end/test.sectorSize {
+				t.Errorf("%s: region 0x%x-0x%x straddles sectors",
+					test.name, layout.Offset, end)
+			}
+		}
+	}
+}
+
+func TestMetaHasherIncremental(t *testing.T) {
+	sections := [][]byte{
+		testSection0(),
+		bytes.Repeat([]byte{0x5a}, 0x1000),
+		{},
+		[]byte("last section"),
+	}
+
+	tests := []struct {
+		name string
+		salt []byte
+		key  []byte
+	}{
+		{"plain", nil, nil},
+		{"salted", []byte("salt"), nil},
+		{"hmac", nil, []byte("factory-secret")},
+		{"salted hmac", []byte("salt"), []byte("factory-secret")},
+	}
+
+	for _, test := range tests {
+		mh := newMetaHasher(test.salt, test.key)
+		for _, section := range sections {
+			mh.addSection(section)
+		}
+		hash, mac := mh.sum()
+
+		if want := calcMetaHash(sections, test.salt); !bytes.Equal(hash,
+			want) {
+
+			t.Errorf("%s: incremental hash=%x; want %x",
+				test.name, hash, want)
+		}
+
+		if test.key == nil {
+			if mac != nil {
+				t.Errorf("%s: HMAC calculated without a key", test.name)
+			}
+		} else if want := calcMetaHmac(sections, test.key); !bytes.Equal(
+			mac, want) {
+
+			t.Errorf("%s: incremental HMAC=%x; want %x",
+				test.name, mac, want)
+		}
+	}
+}
+
+func TestMetaFooterSize(t *testing.T) {
+	for _, count := range []int{0, 1, 2, 7, 16} {
+		areas := []flash.FlashArea{{
+			Name:   flash.FLASH_AREA_NAME_BOOTLOADER,
+			Id:     0,
+			Offset: 0,
+			Size:   0x4000,
+		}}
+		for i := 0; i < count; i++ {
+			areas = append(areas, flash.FlashArea{
+				Name:   fmt.Sprintf("FLASH_AREA_TEST_%d", i),
+				Id:     i + 1,
+				Offset: 0x4000 + i*0x1000,
+				Size:   0x1000,
+			})
+		}
+		fm, err := flash.NewFlashMap(areas)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		section, layout, err := insertMeta(testSection0(), fm,
+			testMetaParams())
+		if err != nil {
+			t.Fatalf("%d areas: %v", count, err)
+		}
+
+		// Header, one TLV per flash area, hash TLV, footer.
+		want := 4 + (count+1)*(2+META_TLV_FLASH_AREA_SZ) +
+			2 + META_TLV_HASH_SZ + META_FOOTER_SZ
+		if layout.Size != want {
+			t.Errorf("%d areas: region size=%d; want %d",
+				count, layout.Size, want)
+		}
+
+		end := layout.Offset + layout.Size
+		footerSize := int(binary.LittleEndian.Uint16(
+			section[end-META_FOOTER_SZ:]))
+		if footerSize != want {
+			t.Errorf("%d areas: footer size=%d; want %d",
+				count, footerSize, want)
+		}
+
+		// A footer with the wrong size is caught.
+		bad := append([]byte{}, section...)
+		binary.LittleEndian.PutUint16(bad[end-META_FOOTER_SZ:],
+			uint16(want+1))
+		if err := checkMetaFooter(bad, layout, layout.Size); err == nil {
+			t.Errorf("%d areas: incorrect footer size not detected", count)
+		}
+	}
+}
+
+func TestMetaReserve(t *testing.T) {
+	_, plain, _ := testInsertAndParse(t, testMetaParams())
+
+	tests := []struct {
+		name    string
+		res     flash.FlashReserve
+		wantErr bool
+	}{
+		{"clear of region", flash.FlashReserve{Name: "R", Device: 0,
+			Offset: 0x1000, Size: 0x100}, false},
+		{"other device", flash.FlashReserve{Name: "R", Device: 1,
+			Offset: plain.Offset, Size: 0x10}, false},
+		{"overlaps region", flash.FlashReserve{Name: "R", Device: 0,
+			Offset: plain.Offset + 4, Size: 0x10}, true},
+		{"overlaps footer", flash.FlashReserve{Name: "R", Device: 0,
+			Offset: 0x3fff, Size: 0x10}, true},
+	}
+
+	for _, test := range tests {
+		fm := testFlashMap(t)
+		fm.Reserves[test.res.Name] = test.res
+
+		_, _, err := insertMeta(testSection0(), fm, testMetaParams())
+		if test.wantErr != (err != nil) {
+			t.Errorf("%s: error=%v; want error=%v",
+				test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestMetaEraseVal(t *testing.T) {
+	tests := []struct {
+		name     string
+		eraseVal byte
+		fill     byte
+		wantErr  bool
+	}{
+		{"erases to 0xff", 0xff, 0xff, false},
+		{"erases to 0x00", 0x00, 0x00, false},
+		// The region's space holds 0xff, which is data on a device that
+		// erases to 0x00.
+		{"0xff padding on 0x00 device", 0x00, 0xff, true},
+		{"0x00 padding on 0xff device", 0xff, 0x00, true},
+	}
+
+	for _, test := range tests {
+		fm := testFlashMap(t)
+		if test.eraseVal != flash.ERASE_VAL_DFLT {
+			fm.EraseVals[0] = test.eraseVal
+		}
+
+		section := bytes.Repeat([]byte{test.fill}, 0x4000)
+		for i := 0; i < 0x100; i++ {
+			section[i] = byte(i)
+		}
+
+		params := testMetaParams()
+		params.eraseVal = test.eraseVal
+
+		section, layout, err := insertMeta(section, fm, params)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if _, err := ParseMeta(section); err != nil {
+			t.Errorf("%s: parse failed: %v", test.name, err)
+		}
+		if layout.Offset < 0x100 {
+			t.Errorf("%s: region overlaps boot loader", test.name)
+		}
+	}
+}
+
+func TestMetaPadding(t *testing.T) {
+	tests := []struct {
+		name     string
+		eraseVal byte
+		chained  bool
+	}{
+		{"erases to 0xff", 0xff, false},
+		{"erases to 0x00", 0x00, false},
+		{"erases to 0x00, chained", 0x00, true},
+	}
+
+	// Offsets of the padding bytes within each TLV type, relative to the
+	// start of the TLV's header.
+	tlvPads := map[int][]int{
+		META_TLV_CODE_FLASH_AREA:  {4, 5},
+		META_TLV_CODE_CHAIN:       {3},
+		META_TLV_CODE_PLACEHOLDER: {4, 5},
+		META_TLV_CODE_COMPRESSION: {3, 4, 5},
+	}
+
+	checkRegion := func(name string, section []byte, layout MetaLayout,
+		eraseVal byte) {
+
+		region := section[layout.Offset : layout.Offset+layout.Size]
+		pads := map[string][]byte{
+			"header": region[1:4],
+			"footer": region[len(region)-6 : len(region)-4],
+		}
+		for _, tlv := range layout.Tlvs {
+			for _, off := range tlvPads[tlv.Type] {
+				key := fmt.Sprintf("%s TLV at 0x%x",
+					metaTlvName(uint8(tlv.Type)), tlv.Offset)
+				pads[key] = append(pads[key], section[tlv.Offset+off])
+			}
+		}
+
+		for field, pad := range pads {
+			for _, b := range pad {
+				if b != eraseVal {
+					t.Errorf("%s: %s padding=0x%02x; want 0x%02x",
+						name, field, b, eraseVal)
+				}
+			}
+		}
+	}
+
+	for _, test := range tests {
+		fm := testFlashMap(t)
+		fm.EraseVals[0] = test.eraseVal
+
+		params := testMetaParams()
+		params.eraseVal = test.eraseVal
+		params.chainEraseVal = test.eraseVal
+		params.placeholders = []flash.FlashArea{
+			fm.Areas[flash.FLASH_AREA_NAME_IMAGE_1],
+		}
+		params.compressAlgo = META_COMPRESS_ZSTD
+		if test.chained {
+			params.chainArea = testChainArea
+		}
+
+		section := bytes.Repeat([]byte{test.eraseVal}, 0x4000)
+		for i := 0; i < 0x100; i++ {
+			section[i] = byte(i)
+		}
+
+		section, layout, err := insertMeta(section, fm, params)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		checkRegion(test.name, section, layout, test.eraseVal)
+		if layout.Chain != nil {
+			checkRegion(test.name+" (secondary)", section, *layout.Chain,
+				test.eraseVal)
+		}
+
+		block := encodeVerifyBlock(nil, nil, test.eraseVal)
+		if block[5] != test.eraseVal {
+			t.Errorf("%s: verification block padding=0x%02x; want 0x%02x",
+				test.name, block[5], test.eraseVal)
+		}
+	}
+}
+
+func TestMetaFlashMap(t *testing.T) {
+	for _, chained := range []bool{false, true} {
+		params := testMetaParams()
+		if chained {
+			params.chainArea = testChainArea
+		}
+		section, _, _ := testInsertAndParse(t, params)
+
+		// A dump covers the whole device; the remainder reads as erased.
+		dump := append(section, bytes.Repeat([]byte{0xff}, 0x10000)...)
+		meta, err := ParseMeta(dump)
+		if err != nil {
+			t.Fatalf("chained=%v: %v", chained, err)
+		}
+
+		fm, err := meta.FlashMap()
+		if err != nil {
+			t.Fatalf("chained=%v: %v", chained, err)
+		}
+
+		orig := testFlashMap(t)
+		if len(fm.Areas) != len(orig.Areas) {
+			t.Fatalf("chained=%v: %d areas; want %d",
+				chained, len(fm.Areas), len(orig.Areas))
+		}
+
+		// Areas are named by ID: system areas by their actual name, and
+		// user areas synthetically.
+		for _, want := range orig.SortedAreas() {
+			name := syntheticAreaName(want.Id)
+			got, ok := fm.Areas[name]
+			if !ok {
+				t.Errorf("chained=%v: area %s (id %d) missing",
+					chained, name, want.Id)
+				continue
+			}
+			if got.Id != want.Id || got.Device != want.Device ||
+				got.Offset != want.Offset || got.Size != want.Size {
+
+				t.Errorf("chained=%v: area %s=%+v; want %+v",
+					chained, name, got, want)
+			}
+		}
+	}
+
+	tests := []struct {
+		id   int
+		want string
+	}{
+		{0, flash.FLASH_AREA_NAME_BOOTLOADER},
+		{2, flash.FLASH_AREA_NAME_IMAGE_1},
+		{flash.AREA_USER_ID_MIN, "FLASH_AREA_USER_0"},
+		{flash.AREA_USER_ID_MIN + 4, "FLASH_AREA_USER_4"},
+		{9, "FLASH_AREA_9"},
+	}
+	for _, test := range tests {
+		if got := syntheticAreaName(test.id); got != test.want {
+			t.Errorf("syntheticAreaName(%d)=%s; want %s",
+				test.id, got, test.want)
+		}
+	}
+}
+
+// TLV codes are listed in increasing order, without duplicates.
+func TestMetaTlvCodes(t *testing.T) {
+	prev := 0
+	for _, desc := range MetaTlvCodes() {
+		if desc.Code <= prev {
+			t.Errorf("%s: code %d follows %d", desc.Name, desc.Code, prev)
+		}
+		if desc.Size == 0 || desc.Size < -1 {
+			t.Errorf("%s: invalid size %d", desc.Name, desc.Size)
+		}
+		prev = desc.Code
+	}
+}
+
+// The reported layout describes the region that actually gets inserted.
+func TestMetaLayout(t *testing.T) {
+	salt := []byte{1, 2, 3, 4}
+
+	tests := []struct {
+		desc   string
+		params func(p *metaParams)
+	}{
+		{"plain", func(p *metaParams) {}},
+		{"hmac", func(p *metaParams) { p.withHmac = true }},
+		{"crc", func(p *metaParams) { p.withCrc = true }},
+		{"salt", func(p *metaParams) { p.salt = salt }},
+		{"region crc", func(p *metaParams) { p.withRegionCrc = true }},
+	}
+
+	for _, test := range tests {
+		params := testMetaParams()
+		test.params(&params)
+		section, meta, layout := testInsertAndParse(t, params)
+
+		if layout.Section != 0 {
+			t.Errorf("%s: layout section %d; want 0", test.desc,
+				layout.Section)
+		}
+		if layout.Offset != meta.Offset || layout.Size != meta.Size {
+			t.Errorf("%s: layout region [%d, +%d); parsed [%d, +%d)",
+				test.desc, layout.Offset, layout.Size, meta.Offset,
+				meta.Size)
+		}
+		if layout.Offset+layout.Size != len(section) {
+			t.Errorf("%s: region ends at %d; want %d", test.desc,
+				layout.Offset+layout.Size, len(section))
+		}
+
+		// Every parsed TLV appears in the layout at the same location.
+		if len(layout.Tlvs) != len(meta.Tlvs) {
+			t.Errorf("%s: layout has %d TLVs; region has %d", test.desc,
+				len(layout.Tlvs), len(meta.Tlvs))
+			continue
+		}
+		for i, tlv := range meta.Tlvs {
+			lt := layout.Tlvs[i]
+			if lt.Type != int(tlv.Type) || lt.Offset != tlv.Offset ||
+				lt.Size != 2+len(tlv.Data) {
+
+				t.Errorf("%s: TLV %d: layout {type=%d off=%d size=%d}; "+
+					"region {type=%d off=%d size=%d}", test.desc, i,
+					lt.Type, lt.Offset, lt.Size,
+					tlv.Type, tlv.Offset, 2+len(tlv.Data))
+			}
+		}
+
+		hash := findMetaTlv(meta, META_TLV_CODE_HASH)
+		if hash == nil || layout.HashOffset != hash.Offset+2 {
+			t.Errorf("%s: hash offset %d does not match hash TLV",
+				test.desc, layout.HashOffset)
+		}
+	}
+}
+
+func TestParseDeviceBases(t *testing.T) {
+	tests := []struct {
+		name    string
+		strs    []string
+		want    map[int]int
+		wantErr string
+	}{
+		{
+			name: "none",
+			strs: nil,
+			want: map[int]int{},
+		},
+		{
+			name: "hex and decimal",
+			strs: []string{"0=0x08000000", " 1 = 4096 "},
+			want: map[int]int{0: 0x08000000, 1: 4096},
+		},
+		{
+			name:    "missing separator",
+			strs:    []string{"0x08000000"},
+			wantErr: "expected <device>=<base>",
+		},
+		{
+			name:    "bad device",
+			strs:    []string{"256=0"},
+			wantErr: "Invalid device ID",
+		},
+		{
+			name:    "bad base",
+			strs:    []string{"0=flash"},
+			wantErr: "Invalid base address",
+		},
+		{
+			name:    "duplicate device",
+			strs:    []string{"0=0", "0=0x1000"},
+			wantErr: "Duplicate base for device 0",
+		},
+	}
+
+	for _, test := range tests {
+		bases, err := ParseDeviceBases(test.strs)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: expected error containing \"%s\"; got %v",
+					test.name, test.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+		if fmt.Sprint(bases) != fmt.Sprint(test.want) {
+			t.Errorf("%s: got bases %v; want %v", test.name, bases, test.want)
+		}
+	}
+}
+
+func TestMetaTrace(t *testing.T) {
+	params := testMetaParams()
+	params.withHmac = true
+	_, _, layout := testInsertAndParse(t, params)
+
+	lines := metaTrace(layout, "primary")
+
+	// A summary line, the header, each TLV, and the footer.
+	if len(lines) != len(layout.Tlvs)+3 {
+		t.Fatalf("got %d trace lines; want %d:\n%s", len(lines),
+			len(layout.Tlvs)+3, strings.Join(lines, "\n"))
+	}
+
+	tests := []struct {
+		line int
+		want string
+	}{
+		{0, fmt.Sprintf("primary meta region: section=0 offset=0x%x size=%d",
+			layout.Offset, layout.Size)},
+		{1, fmt.Sprintf("0x%06x    4 header", layout.Offset)},
+		{len(lines) - 1, fmt.Sprintf("0x%06x %4d footer",
+			layout.Offset+layout.Size-META_FOOTER_SZ, META_FOOTER_SZ)},
+	}
+	for i, tlv := range layout.Tlvs {
+		tests = append(tests, struct {
+			line int
+			want string
+		}{i + 2, fmt.Sprintf("0x%06x %4d %s", tlv.Offset, tlv.Size,
+			metaTlvName(uint8(tlv.Type)))})
+	}
+
+	for _, test := range tests {
+		if !strings.Contains(lines[test.line], test.want) {
+			t.Errorf("line %d: got \"%s\"; want it to contain \"%s\"",
+				test.line, lines[test.line], test.want)
+		}
+	}
+
+	// A chained layout's secondary region follows the primary.
+	chained := layout
+	chained.Chain = &MetaLayout{Section: 1, Offset: 0x100, Size: 0x20}
+	lines = metaTrace(chained, "primary")
+	found := false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "secondary meta region: section=1") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("chained trace lacks secondary region:\n%s",
+			strings.Join(lines, "\n"))
+	}
+}
@@ -0,0 +1,135 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"encoding/binary"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/util"
+)
+
+// Selects the optional TLVs to include when calculating the size of a meta
+// region.
+type MetaSizeOptions struct {
+	Hmac        bool
+	Crc         bool
+	RegionCrc   bool
+	Serial      bool
+	SaltSize    int
+	LicenseSize int
+}
+
+// One line of a meta region size breakdown: the header, the footer, or all
+// TLVs of a single type.  Size includes TLV headers.
+type MetaSizeEntry struct {
+	Name  string
+	Count int
+	Size  int
+}
+
+// The bytes a meta region consumes, broken down by element.  Size is the sum
+// of the entries' sizes; Reserved additionally includes any alignment
+// padding following the region.
+type MetaSizeBreakdown struct {
+	Entries  []MetaSizeEntry
+	Size     int
+	Reserved int
+}
+
+// Calculates the size of the meta region that would be placed at the end of
+// the boot loader area of the specified flash map.  Nothing is built; only
+// the flash map and the selected optional TLVs affect the result.
+func CalcMetaSize(flashMap flash.FlashMap, opts MetaSizeOptions) (
+	MetaSizeBreakdown, error) {
+
+	bd := MetaSizeBreakdown{}
+
+	if opts.SaltSize < 0 || opts.SaltSize > META_TLV_SALT_MAX_SZ {
+		return bd, util.FmtNewtError(
+			"invalid salt size: %d; must be between 0 and %d",
+			opts.SaltSize, META_TLV_SALT_MAX_SZ)
+	}
+	if opts.LicenseSize < 0 || opts.LicenseSize > META_TLV_LICENSE_MAX_SZ {
+		return bd, util.FmtNewtError(
+			"invalid license size: %d; must be between 0 and %d",
+			opts.LicenseSize, META_TLV_LICENSE_MAX_SZ)
+	}
+
+	params := metaParams{
+		bootArea:      flash.FLASH_AREA_NAME_BOOTLOADER,
+		withHmac:      opts.Hmac,
+		withCrc:       opts.Crc,
+		withRegionCrc: opts.RegionCrc,
+		salt:          make([]byte, opts.SaltSize),
+		license:       make([]byte, opts.LicenseSize),
+		eraseVal: areaEraseVal(flashMap,
+			flash.FLASH_AREA_NAME_BOOTLOADER),
+	}
+	if opts.Serial {
+		var serial uint64
+		params.serial = &serial
+	}
+
+	_, layout, err := buildMeta(flashMap, params)
+	if err != nil {
+		return bd, err
+	}
+
+	bd.Entries = append(bd.Entries, MetaSizeEntry{
+		Name:  "HEADER",
+		Count: 1,
+		Size:  binary.Size(metaHeader{}),
+	})
+
+	// TLVs of the same type are contiguous; combine each run into one entry.
+	for _, tlv := range layout.Tlvs {
+		name := metaTlvName(uint8(tlv.Type))
+		last := len(bd.Entries) - 1
+		if bd.Entries[last].Name == name {
+			bd.Entries[last].Count++
+			bd.Entries[last].Size += tlv.Size
+		} else {
+			bd.Entries = append(bd.Entries, MetaSizeEntry{
+				Name:  name,
+				Count: 1,
+				Size:  tlv.Size,
+			})
+		}
+	}
+
+	bd.Entries = append(bd.Entries, MetaSizeEntry{
+		Name:  "FOOTER",
+		Count: 1,
+		Size:  META_FOOTER_SZ,
+	})
+
+	for _, e := range bd.Entries {
+		bd.Size += e.Size
+	}
+	if bd.Size != layout.Size {
+		return bd, util.FmtNewtError(
+			"meta region size breakdown (%d bytes) does not match region "+
+				"size (%d bytes)", bd.Size, layout.Size)
+	}
+	bd.Reserved = layout.Reserved
+
+	return bd, nil
+}
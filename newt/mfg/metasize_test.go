@@ -0,0 +1,102 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"testing"
+)
+
+func TestCalcMetaSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    MetaSizeOptions
+		wantErr bool
+	}{
+		{"minimal", MetaSizeOptions{}, false},
+		{"hmac", MetaSizeOptions{Hmac: true}, false},
+		{"all", MetaSizeOptions{
+			Hmac:        true,
+			Crc:         true,
+			RegionCrc:   true,
+			Serial:      true,
+			SaltSize:    16,
+			LicenseSize: 40,
+		}, false},
+		{"salt too long", MetaSizeOptions{
+			SaltSize: META_TLV_SALT_MAX_SZ + 1}, true},
+		{"negative license", MetaSizeOptions{LicenseSize: -1}, true},
+	}
+
+	fm := testFlashMap(t)
+
+	for _, test := range tests {
+		bd, err := CalcMetaSize(fm, test.opts)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		// The breakdown must account for every byte of the region that
+		// insertMeta actually writes.
+		params := testMetaParams()
+		params.withHmac = test.opts.Hmac
+		params.withCrc = test.opts.Crc
+		params.withRegionCrc = test.opts.RegionCrc
+		params.salt = make([]byte, test.opts.SaltSize)
+		params.license = make([]byte, test.opts.LicenseSize)
+		if test.opts.Serial {
+			serial := uint64(0)
+			params.serial = &serial
+		}
+		_, meta, _ := testInsertAndParse(t, params)
+
+		sum := 0
+		counts := map[string]int{}
+		for _, e := range bd.Entries {
+			sum += e.Size
+			counts[e.Name] += e.Count
+		}
+		if sum != bd.Size || bd.Size != meta.Size {
+			t.Errorf("%s: breakdown sums to %d, size=%d; region is %d bytes",
+				test.name, sum, bd.Size, meta.Size)
+		}
+
+		if n := counts[metaTlvName(META_TLV_CODE_FLASH_AREA)]; n !=
+			len(fm.Areas) {
+
+			t.Errorf("%s: %d flash area TLVs; want %d",
+				test.name, n, len(fm.Areas))
+		}
+		if counts["HEADER"] != 1 || counts["FOOTER"] != 1 {
+			t.Errorf("%s: breakdown lacks header or footer", test.name)
+		}
+		if n := counts[metaTlvName(META_TLV_CODE_HMAC)]; (n == 1) !=
+			test.opts.Hmac {
+
+			t.Errorf("%s: %d HMAC TLVs", test.name, n)
+		}
+	}
+}
@@ -22,8 +22,10 @@ package mfg
 import (
 	"sort"
 
+	"mynewt.apache.org/newt/newt/flash"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/util"
 )
 
 type MfgRawEntry struct {
@@ -50,6 +52,104 @@ type MfgImage struct {
 	boot       *target.Target
 	images     []*target.Target
 	rawEntries []MfgRawEntry
+
+	// Flash areas that receive a copy of the boot loader.  The first entry is
+	// the primary boot area; it contains the meta region.
+	bootAreas []string
+
+	// Required alignment of the meta region's start address.
+	metaAlign int
+
+	// Minimum number of unused bytes required between the end of the boot
+	// loader and the start of the meta region.
+	bootMinMargin int
+
+	// Erase sector size of the meta region's device; 0 if unspecified.
+	metaSectorSize int
+
+	// If non-empty, the flash area containing the secondary meta region.
+	metaChainArea string
+
+	// The newest meta version the boot loader understands; 0 if
+	// unrestricted.
+	metaMaxVersion int
+
+	// The TLV ordering rules the boot loader imposes.
+	metaOrder MetaOrderPolicy
+
+	// Flash areas shipped erased, to be provisioned after manufacture.
+	placeholderAreas []string
+
+	// Whether placeholder areas are excluded from the hash, HMAC, and CRC.
+	placeholdersUnhashed bool
+
+	// If non-empty, the encoded contents of the meta region's license TLV.
+	metaLicense []byte
+
+	// If non-empty, this salt is prepended to the image when the meta hash is
+	// calculated.
+	metaSalt []byte
+
+	// If non-nil, the meta region includes a serial TLV with this value.  Set
+	// only while serialized copies are being created.
+	serial *uint64
+
+	// If non-nil, the meta region includes an HMAC keyed with this value.
+	hmacKey []byte
+
+	// Whether the meta hash is calculated as each section is assembled.
+	incrementalHash bool
+
+	// Whether the meta region includes a CRC TLV.
+	metaCrc bool
+
+	// Whether the meta region includes a region CRC TLV.
+	metaRegionCrc bool
+
+	// Whether section 0 ends with a verification block.
+	verifyBlock bool
+
+	// If non-empty, the shell command that seals the meta hash.
+	sealCmd string
+
+	// Flash areas whose contents are expected to be encrypted.
+	encryptedAreas []string
+
+	// Flash areas that are meant to ship without content, such as an
+	// unprovisioned image slot.
+	emptyAreas []string
+
+	// Unpopulated flash areas filled with a repeating pattern rather than the
+	// erase value; area name => pattern.
+	fillPatterns map[string][]byte
+
+	// Whether creating the image also emits the meta region's location as
+	// linker symbols and C macros.
+	metaSymbols bool
+
+	// Whether creating the image also emits its sections as an S-record
+	// file.
+	srec bool
+
+	// If non-zero, creating the image also emits its sections as chunk files
+	// of this size.
+	chunkSize int
+
+	// The algorithm with which creating the image also emits its sections
+	// compressed (META_COMPRESS_[...]), and the dictionary the compression
+	// uses.  The dictionary path is empty and the ID is 0 if no dictionary is
+	// used.
+	compressAlgo     uint8
+	compressDictPath string
+	compressDictId   uint32
+
+	// The offset within section 0 that the meta hash is expected to occupy,
+	// or -1 if no offset is recorded.
+	expectedHashOffset int
+
+	// Address at which each flash device is programmed; device => base.
+	// Devices not present are programmed at address 0.
+	deviceBases map[int]int
 }
 
 func (mi *MfgImage) imgApps(imageIdx int) (
@@ -65,6 +165,31 @@ func (mi *MfgImage) imgApps(imageIdx int) (
 	return
 }
 
+// Retrieves the IDs of all flash devices that the mfg image knows about: those
+// in the BSP flash map and those that receive a section.
+func (mi *MfgImage) deviceIds() []int {
+	idMap := map[int]struct{}{}
+	for _, id := range mi.sectionIds() {
+		idMap[id] = struct{}{}
+	}
+	for _, id := range mi.bsp.FlashMap.DeviceIds() {
+		idMap[id] = struct{}{}
+	}
+
+	ids := make([]int, 0, len(idMap))
+	for id, _ := range idMap {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return ids
+}
+
+// Indicates the address at which the specified flash device is programmed.
+func (mi *MfgImage) DeviceBase(device int) int {
+	return mi.deviceBases[device]
+}
+
 func (mi *MfgImage) sectionIds() []int {
 	idMap := map[int]struct{}{}
 
@@ -84,6 +209,125 @@ func (mi *MfgImage) sectionIds() []int {
 	return ids
 }
 
+// Returns the name of the boot area that contains the meta region.
+func (mi *MfgImage) metaAreaName() string {
+	return mi.bootAreas[0]
+}
+
+func (mi *MfgImage) placeholders() []flash.FlashArea {
+	areas := make([]flash.FlashArea, len(mi.placeholderAreas))
+	for i, name := range mi.placeholderAreas {
+		areas[i] = mi.bsp.FlashMap.Areas[name]
+	}
+
+	return areas
+}
+
+// Returns the sections as the meta hash, HMAC, and CRC see them: placeholder
+// areas excluded from these values and the verification block at
+// verifyBlockOff (if non-zero) read as zeros.  The first section must be
+// section 0.  The sections themselves are not modified.
+func (mi *MfgImage) integrityView(sections [][]byte,
+	verifyBlockOff int) [][]byte {
+
+	windows := []zeroWindow{}
+	if mi.placeholdersUnhashed {
+		for _, area := range mi.placeholders() {
+			windows = append(windows, zeroWindow{area.Offset, area.Size})
+		}
+	}
+	if verifyBlockOff != 0 {
+		windows = append(windows,
+			zeroWindow{verifyBlockOff, MFG_VERIFY_BLOCK_SZ})
+	}
+	if len(windows) == 0 {
+		return sections
+	}
+
+	view := append([][]byte{}, sections...)
+	view[0] = append([]byte{}, sections[0]...)
+	applyZeroWindows(view[0], 0, windows)
+
+	return view
+}
+
+func (mi *MfgImage) metaParams() metaParams {
+	return metaParams{
+		bootArea:      mi.metaAreaName(),
+		withHmac:      mi.hmacKey != nil,
+		withCrc:       mi.metaCrc,
+		withRegionCrc: mi.metaRegionCrc,
+		salt:          mi.metaSalt,
+		align:         mi.metaAlign,
+		sectorSize:    mi.metaSectorSize,
+		chainArea:     mi.metaChainArea,
+		license:       mi.metaLicense,
+		serial:        mi.serial,
+		maxVersion:    mi.metaMaxVersion,
+		orderPolicy:   mi.metaOrder,
+
+		placeholders:         mi.placeholders(),
+		placeholdersUnhashed: mi.placeholdersUnhashed,
+
+		verifyBlock: mi.verifyBlock,
+
+		compressAlgo:   mi.compressAlgo,
+		compressDictId: mi.compressDictId,
+
+		eraseVal:      areaEraseVal(mi.bsp.FlashMap, mi.metaAreaName()),
+		chainEraseVal: areaEraseVal(mi.bsp.FlashMap, mi.metaChainArea),
+	}
+}
+
 func (mi *MfgImage) NumImages() int {
 	return len(mi.images)
 }
+
+// Calculates the layout of the meta region without building the
+// manufacturing image.  The layout depends only on the BSP's flash map.
+func (mi *MfgImage) MetaLayout() (MetaLayout, error) {
+	_, layout, err := buildMeta(mi.bsp.FlashMap, mi.metaParams())
+	return layout, err
+}
+
+// Ensures that the meta hash lands at the expected offset within section 0.
+// Boot loaders that locate the hash at a hardcoded address rely on this
+// offset, but it moves if the meta region's TLVs change.  If expected is
+// negative, the offset recorded in mfg.meta_hash_offset is used.  The actual
+// offset is returned.
+func (mi *MfgImage) CheckHashOffset(expected int) (int, error) {
+	layout, err := mi.MetaLayout()
+	if err != nil {
+		return 0, err
+	}
+
+	if expected < 0 {
+		expected = mi.expectedHashOffset
+	}
+	if expected < 0 {
+		return layout.HashOffset, util.FmtNewtError(
+			"No expected meta hash offset; specify one or record "+
+				"\"mfg.meta_hash_offset: 0x%x\" in %s", layout.HashOffset,
+			mi.basePkg.Name())
+	}
+
+	if layout.HashOffset != expected {
+		return layout.HashOffset, util.FmtNewtError(
+			"Meta hash offset has shifted; expected=0x%x actual=0x%x",
+			expected, layout.HashOffset)
+	}
+
+	return layout.HashOffset, nil
+}
+
+// Specifies the key used to calculate the meta region's HMAC.  A nil key
+// omits the HMAC TLV.
+func (mi *MfgImage) SetHmacKey(key []byte) {
+	mi.hmacKey = key
+}
+
+// Causes creation of the image to also emit an S-record file, regardless of
+// the mfg.srec setting.
+func (mi *MfgImage) EnableSrec() {
+	mi.srec = true
+}
@@ -0,0 +1,454 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/pkg"
+)
+
+// The flash area of the test flash map that can hold a secondary meta region.
+const testChainArea = "FLASH_AREA_MFG_CHAIN"
+
+// A small flash map with a boot loader area, two image slots, an area for a
+// secondary meta region, and a data area on a second device.
+func testFlashMap(t *testing.T) flash.FlashMap {
+	fm, err := flash.NewFlashMap([]flash.FlashArea{
+		{
+			Name:   flash.FLASH_AREA_NAME_BOOTLOADER,
+			Id:     0,
+			Device: 0,
+			Offset: 0,
+			Size:   0x4000,
+		},
+		{
+			Name:   flash.FLASH_AREA_NAME_IMAGE_0,
+			Id:     1,
+			Device: 0,
+			Offset: 0x4000,
+			Size:   0x2000,
+		},
+		{
+			Name:   flash.FLASH_AREA_NAME_IMAGE_1,
+			Id:     2,
+			Device: 0,
+			Offset: 0x6000,
+			Size:   0x2000,
+		},
+		{
+			Name:   "FLASH_AREA_DATA",
+			Id:     3,
+			Device: 1,
+			Offset: 0,
+			Size:   0x1000,
+		},
+		{
+			Name:   testChainArea,
+			Id:     16,
+			Device: 0,
+			Offset: 0x8000,
+			Size:   0x1000,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fm
+}
+
+// Returns a section 0 consisting of a small boot loader followed by erased
+// flash through the end of the boot loader area.
+func testSection0() []byte {
+	section := bytes.Repeat([]byte{0xff}, 0x4000)
+	for i := 0; i < 0x100; i++ {
+		section[i] = byte(i)
+	}
+	return section
+}
+
+func testMetaParams() metaParams {
+	return metaParams{
+		bootArea:      flash.FLASH_AREA_NAME_BOOTLOADER,
+		eraseVal:      flash.ERASE_VAL_DFLT,
+		chainEraseVal: flash.ERASE_VAL_DFLT,
+	}
+}
+
+// Inserts a meta region built from the specified parameters into a test
+// section 0 and parses it back.  The hash, HMAC, and CRC remain zeroed, but
+// the region CRC is filled in, as it must be for the region to parse.
+func testInsertAndParse(t *testing.T, params metaParams) ([]byte, Meta,
+	MetaLayout) {
+
+	section, layout, err := insertMeta(testSection0(), testFlashMap(t),
+		params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout.RegionCrcOffset != 0 {
+		fillRegionCrc(section, layout.Offset, layout.RegionCrcOffset)
+	}
+
+	meta, err := ParseMeta(section)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return section, meta, layout
+}
+
+// Writes a section to a file in a new temporary directory.  The caller must
+// remove the directory.
+func testSectionFile(t *testing.T, section []byte) (string, string) {
+	dir, err := ioutil.TempDir("", "newt-mfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "section0.bin")
+	if err := ioutil.WriteFile(path, section, 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return dir, path
+}
+
+// Parts are ordered by device, then offset, then name, regardless of the
+// order they were collected in; the same tie-break order as flash areas.
+func TestSortPartsDeterministic(t *testing.T) {
+	want := []string{"d0-a", "d0-b", "d0-c", "d1-a"}
+	orders := [][]int{
+		{0, 1, 2, 3},
+		{3, 2, 1, 0},
+		{2, 0, 3, 1},
+		{1, 3, 0, 2},
+	}
+
+	parts := []mfgPart{
+		{device: 0, offset: 0x0000, name: "d0-a"},
+		{device: 0, offset: 0x1000, name: "d0-b"},
+		{device: 0, offset: 0x1000, name: "d0-c"},
+		{device: 1, offset: 0x0000, name: "d1-a"},
+	}
+
+	for _, order := range orders {
+		shuffled := make([]mfgPart, len(order))
+		for i, idx := range order {
+			shuffled[i] = parts[idx]
+		}
+
+		sorted := sortParts(shuffled)
+		for i, part := range sorted {
+			if part.name != want[i] {
+				t.Errorf("order %v: part %d is %s; want %s",
+					order, i, part.name, want[i])
+			}
+		}
+	}
+}
+
+func TestValidateBootAreas(t *testing.T) {
+	fm := testFlashMap(t)
+
+	// An area overlapping the standard boot area.
+	overlapping := flash.FlashArea{
+		Name:   "FLASH_AREA_BOOT_ALT",
+		Id:     17,
+		Device: 0,
+		Offset: 0x2000,
+		Size:   0x1000,
+	}
+	fm.Areas[overlapping.Name] = overlapping
+
+	boot := flash.FLASH_AREA_NAME_BOOTLOADER
+
+	tests := []struct {
+		name    string
+		areas   []string
+		wantErr string
+	}{
+		{"single", []string{boot}, ""},
+		{"redundant", []string{boot, testChainArea}, ""},
+		{"missing", []string{boot, "FLASH_AREA_NONE"}, "not present"},
+		{"wrong device", []string{boot, "FLASH_AREA_DATA"}, "device 0"},
+		{"duplicate", []string{boot, boot}, "specified twice"},
+		{"overlap", []string{boot, overlapping.Name}, "overlap"},
+	}
+
+	for _, test := range tests {
+		mi := &MfgImage{
+			basePkg:   pkg.NewLocalPackage(nil, "/test/mfg"),
+			bsp:       &pkg.BspPackage{FlashMap: fm},
+			bootAreas: test.areas,
+		}
+
+		err := mi.validateBootAreas()
+		if test.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			}
+		} else if err == nil {
+			t.Errorf("%s: expected error", test.name)
+		} else if !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: error \"%s\" does not contain \"%s\"", test.name,
+				err.Error(), test.wantErr)
+		}
+	}
+}
+
+// With redundant boot loaders, the meta region is placed at the end of the
+// primary boot area.
+func TestMetaPrimaryBootArea(t *testing.T) {
+	fm := testFlashMap(t)
+	chain := fm.Areas[testChainArea]
+	end := chain.Offset + chain.Size
+
+	section := bytes.Repeat([]byte{0xff}, end)
+	copy(section, testSection0())
+
+	params := testMetaParams()
+	params.bootArea = testChainArea
+	section, layout, err := insertMeta(section, fm, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if layout.Offset+layout.Size != end {
+		t.Errorf("meta region ends at 0x%x; want 0x%x",
+			layout.Offset+layout.Size, end)
+	}
+
+	meta, err := ParseMeta(section)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Offset != layout.Offset {
+		t.Errorf("parsed meta region at 0x%x; want 0x%x", meta.Offset,
+			layout.Offset)
+	}
+
+	params.bootArea = "FLASH_AREA_NONE"
+	if _, _, err := insertMeta(section, fm, params); err == nil {
+		t.Errorf("expected error for missing boot area")
+	}
+}
+
+func TestDetectMetaOverlaps(t *testing.T) {
+	tests := []struct {
+		name      string
+		area      *flash.FlashArea // Added to the test flash map.
+		chainArea string
+		wantErr   bool
+	}{
+		{"no extra area", nil, "", false},
+		{
+			"overlaps meta region",
+			&flash.FlashArea{Device: 0, Offset: 0x3ff0, Size: 0x10},
+			"", true,
+		},
+		{
+			"before meta region",
+			&flash.FlashArea{Device: 0, Offset: 0x1000, Size: 0x100},
+			"", false,
+		},
+		{
+			"other device",
+			&flash.FlashArea{Device: 1, Offset: 0x3ff0, Size: 0x10},
+			"", false,
+		},
+		{
+			"overlaps secondary region",
+			&flash.FlashArea{Device: 0, Offset: 0x8ff0, Size: 0x10},
+			testChainArea, true,
+		},
+		{
+			"secondary region not in use",
+			&flash.FlashArea{Device: 0, Offset: 0x8ff0, Size: 0x10},
+			"", false,
+		},
+	}
+
+	for _, test := range tests {
+		fm := testFlashMap(t)
+		if test.area != nil {
+			area := *test.area
+			area.Name = "FLASH_AREA_EXTRA"
+			area.Id = 20
+			fm.Areas[area.Name] = area
+		}
+
+		mi := &MfgImage{
+			bsp:           &pkg.BspPackage{FlashMap: fm},
+			bootAreas:     []string{flash.FLASH_AREA_NAME_BOOTLOADER},
+			metaChainArea: test.chainArea,
+		}
+
+		err := mi.detectMetaOverlaps()
+		if test.wantErr && err == nil {
+			t.Errorf("%s: expected error", test.name)
+		} else if !test.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+		}
+	}
+}
+
+func TestCheckBootSize(t *testing.T) {
+	mi := &MfgImage{
+		bsp:       &pkg.BspPackage{FlashMap: testFlashMap(t)},
+		bootAreas: []string{flash.FLASH_AREA_NAME_BOOTLOADER},
+	}
+	layout, err := mi.MetaLayout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	avail := 0x4000 - layout.Reserved
+
+	tests := []struct {
+		name     string
+		bootSize int
+		margin   int
+		wantErr  string
+	}{
+		{"small", 0x100, 0, ""},
+		{"exact fit", avail, 0, ""},
+		{"overflow", avail + 1, 0, "overflow=1"},
+		{"sufficient margin", avail - 0x100, 0x100, ""},
+		{"insufficient margin", avail - 0xff, 0x100, "margin=255"},
+	}
+
+	for _, test := range tests {
+		mi.bootMinMargin = test.margin
+		err := mi.checkBootSize(test.bootSize)
+
+		if test.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			}
+		} else if err == nil {
+			t.Errorf("%s: expected error", test.name)
+		} else if !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: error \"%s\" does not contain \"%s\"", test.name,
+				err.Error(), test.wantErr)
+		}
+	}
+}
+
+// Every device in the flash map has a base; unspecified bases are 0.
+func TestDeviceBases(t *testing.T) {
+	mi := &MfgImage{
+		bsp:         &pkg.BspPackage{FlashMap: testFlashMap(t)},
+		deviceBases: map[int]int{1: 0x60000000},
+	}
+
+	ids := mi.deviceIds()
+	if len(ids) != 2 || ids[0] != 0 || ids[1] != 1 {
+		t.Fatalf("got device IDs %v; want [0 1]", ids)
+	}
+
+	tests := []struct {
+		device int
+		want   int
+	}{
+		{0, 0},
+		{1, 0x60000000},
+	}
+	for _, test := range tests {
+		if base := mi.DeviceBase(test.device); base != test.want {
+			t.Errorf("device %d: got base 0x%x; want 0x%x",
+				test.device, base, test.want)
+		}
+	}
+}
+
+func TestCheckHashOffset(t *testing.T) {
+	newMi := func(recorded int) *MfgImage {
+		return &MfgImage{
+			basePkg:            pkg.NewLocalPackage(nil, "/test/mfg"),
+			bsp:                &pkg.BspPackage{FlashMap: testFlashMap(t)},
+			bootAreas:          []string{flash.FLASH_AREA_NAME_BOOTLOADER},
+			expectedHashOffset: recorded,
+		}
+	}
+
+	layout, err := newMi(-1).MetaLayout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := layout.HashOffset
+
+	tests := []struct {
+		name     string
+		recorded int
+		expected int
+		wantErr  string
+	}{
+		{
+			name:     "explicit match",
+			recorded: -1,
+			expected: actual,
+		},
+		{
+			name:     "recorded match",
+			recorded: actual,
+			expected: -1,
+		},
+		{
+			name:     "explicit overrides recorded",
+			recorded: actual + 4,
+			expected: actual,
+		},
+		{
+			name:     "shifted",
+			recorded: actual + 4,
+			expected: -1,
+			wantErr:  "Meta hash offset has shifted",
+		},
+		{
+			name:     "nothing recorded",
+			recorded: -1,
+			expected: -1,
+			wantErr:  "No expected meta hash offset",
+		},
+	}
+
+	for _, test := range tests {
+		off, err := newMi(test.recorded).CheckHashOffset(test.expected)
+		if off != actual {
+			t.Errorf("%s: got offset 0x%x; want 0x%x", test.name, off, actual)
+		}
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: expected error containing \"%s\"; got %v",
+					test.name, test.wantErr, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+		}
+	}
+}
@@ -78,14 +78,84 @@ func MfgSectionBinPath(mfgPkgName string, sectionNum int) string {
 		filepath.Base(mfgPkgName), sectionNum)
 }
 
+func MfgSerialSectionBinPath(mfgPkgName string, sectionNum int,
+	serial uint64) string {
+
+	return fmt.Sprintf("%s/%s-s%d-%d.bin", MfgSectionBinDir(mfgPkgName),
+		filepath.Base(mfgPkgName), sectionNum, serial)
+}
+
 func MfgManifestPath(mfgPkgName string) string {
 	return MfgBinDir(mfgPkgName) + "/manifest.json"
 }
 
+func MfgMapPath(mfgPkgName string) string {
+	return MfgBinDir(mfgPkgName) + "/mfg.map"
+}
+
+func MfgMetaLdPath(mfgPkgName string) string {
+	return MfgBinDir(mfgPkgName) + "/mfg_meta.ld"
+}
+
+func MfgMetaHeaderPath(mfgPkgName string) string {
+	return MfgBinDir(mfgPkgName) + "/mfg_meta.h"
+}
+
+func MfgSrecPath(mfgPkgName string) string {
+	return fmt.Sprintf("%s/%s.srec", MfgBinDir(mfgPkgName),
+		filepath.Base(mfgPkgName))
+}
+
+func MfgSerialSrecPath(mfgPkgName string, serial uint64) string {
+	return fmt.Sprintf("%s/%s-%d.srec", MfgBinDir(mfgPkgName),
+		filepath.Base(mfgPkgName), serial)
+}
+
+func MfgChunkDir(mfgPkgName string) string {
+	return MfgBinDir(mfgPkgName) + "/chunks"
+}
+
+func MfgSerialChunkDir(mfgPkgName string, serial uint64) string {
+	return fmt.Sprintf("%s/chunks-%d", MfgBinDir(mfgPkgName), serial)
+}
+
+func MfgSerialManifestPath(mfgPkgName string, serial uint64) string {
+	return fmt.Sprintf("%s/manifest-%d.json", MfgBinDir(mfgPkgName), serial)
+}
+
 func (mi *MfgImage) ManifestPath() string {
+	if mi.serial != nil {
+		return MfgSerialManifestPath(mi.basePkg.Name(), *mi.serial)
+	}
 	return MfgManifestPath(mi.basePkg.Name())
 }
 
+func (mi *MfgImage) SrecPath() string {
+	if mi.serial != nil {
+		return MfgSerialSrecPath(mi.basePkg.Name(), *mi.serial)
+	}
+	return MfgSrecPath(mi.basePkg.Name())
+}
+
+func (mi *MfgImage) ChunkDir() string {
+	if mi.serial != nil {
+		return MfgSerialChunkDir(mi.basePkg.Name(), *mi.serial)
+	}
+	return MfgChunkDir(mi.basePkg.Name())
+}
+
+func (mi *MfgImage) ChunkIndexPath() string {
+	return mi.ChunkDir() + "/" + MFG_CHUNK_INDEX_NAME
+}
+
+func (mi *MfgImage) sectionBinPath(sectionId int) string {
+	if mi.serial != nil {
+		return MfgSerialSectionBinPath(mi.basePkg.Name(), sectionId,
+			*mi.serial)
+	}
+	return MfgSectionBinPath(mi.basePkg.Name(), sectionId)
+}
+
 func (mi *MfgImage) BootBinPath() string {
 	if mi.boot == nil {
 		return ""
@@ -161,7 +231,21 @@ func (mi *MfgImage) SectionBinPaths() []string {
 
 	paths := make([]string, len(sectionIds))
 	for i, sectionId := range sectionIds {
-		paths[i] = MfgSectionBinPath(mi.basePkg.Name(), sectionId)
+		paths[i] = mi.sectionBinPath(sectionId)
+	}
+	return paths
+}
+
+// Returns the paths of the compressed sections, or nil if the image is not
+// compressed.
+func (mi *MfgImage) CompressedSectionPaths() []string {
+	if mi.compressAlgo == META_COMPRESS_NONE {
+		return nil
+	}
+
+	paths := []string{}
+	for _, path := range mi.SectionBinPaths() {
+		paths = append(paths, path+MFG_COMPRESS_EXT)
 	}
 	return paths
 }
@@ -0,0 +1,151 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+const FLASH_SCRIPT_TOOL_JLINK = "jlink"
+const FLASH_SCRIPT_TOOL_OPENOCD = "openocd"
+
+var flashScriptTools = []string{
+	FLASH_SCRIPT_TOOL_JLINK,
+	FLASH_SCRIPT_TOOL_OPENOCD,
+}
+
+// A single contiguous region to erase and program.
+type flashRegion struct {
+	device     int
+	path       string // Section file containing the region's data.
+	fileOffset int    // Offset of the region within the section file.
+	addr       int    // Absolute address the region is programmed at.
+	size       int
+	sectorSize int
+}
+
+// Quotes a string for safe inclusion in a POSIX shell command.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func regionFilename(idx int) string {
+	return fmt.Sprintf("\"$TMPDIR/region-%d.bin\"", idx)
+}
+
+func writeJlinkCmds(regions []flashRegion, b *bytes.Buffer) {
+	b.WriteString("cat > \"$TMPDIR/program.jlink\" <<EOF\n")
+	b.WriteString("r\nh\n")
+	for i, r := range regions {
+		fmt.Fprintf(b, "erase 0x%08x 0x%08x\n", r.addr, r.addr+r.size-1)
+		fmt.Fprintf(b, "loadbin $TMPDIR/region-%d.bin 0x%08x\n", i, r.addr)
+	}
+	b.WriteString("r\ng\nq\nEOF\n\n")
+
+	b.WriteString("\"${JLINK:-JLinkExe}\" " +
+		"-device \"${JLINK_DEVICE:?JLINK_DEVICE must be set}\" " +
+		"-if \"${JLINK_IF:-SWD}\" -speed \"${JLINK_SPEED:-4000}\" " +
+		"-autoconnect 1 -CommanderScript \"$TMPDIR/program.jlink\"\n")
+}
+
+func writeOpenocdCmds(regions []flashRegion, b *bytes.Buffer) {
+	b.WriteString("\"${OPENOCD:-openocd}\" " +
+		"-f \"${OPENOCD_CFG:?OPENOCD_CFG must be set}\" \\\n")
+	b.WriteString("    -c init -c \"reset halt\" \\\n")
+	for i, r := range regions {
+		fmt.Fprintf(b, "    -c \"flash erase_address 0x%08x 0x%x\" \\\n",
+			r.addr, r.size)
+		fmt.Fprintf(b, "    -c \"flash write_image "+
+			"$TMPDIR/region-%d.bin 0x%08x bin\" \\\n", i, r.addr)
+	}
+	b.WriteString("    -c \"reset run\" -c shutdown\n")
+}
+
+// Generates a shell script that erases and programs each region with the
+// specified tool.  Each region is first extracted from its section file; the
+// regions are sector-aligned, so the extraction copies whole sectors.
+func flashScript(tool string, name string, regions []flashRegion) (
+	string, error) {
+
+	b := &bytes.Buffer{}
+
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(b, "# Programs manufacturing image %s using %s.\n", name, tool)
+	b.WriteString("# Generated by newt; do not edit.\n\n")
+	b.WriteString("set -e\n\n")
+	b.WriteString("TMPDIR=$(mktemp -d)\n")
+	b.WriteString("trap 'rm -rf \"$TMPDIR\"' EXIT\n\n")
+
+	for i, r := range regions {
+		fmt.Fprintf(b, "# Region %d: device=%d address=0x%08x "+
+			"file-offset=0x%x size=0x%x\n",
+			i, r.device, r.addr, r.fileOffset, r.size)
+		fmt.Fprintf(b, "dd if=%s of=%s bs=%d skip=%d count=%d 2>/dev/null\n",
+			shellQuote(r.path), regionFilename(i), r.sectorSize,
+			r.fileOffset/r.sectorSize, r.size/r.sectorSize)
+	}
+	b.WriteString("\n")
+
+	switch tool {
+	case FLASH_SCRIPT_TOOL_JLINK:
+		writeJlinkCmds(regions, b)
+
+	case FLASH_SCRIPT_TOOL_OPENOCD:
+		writeOpenocdCmds(regions, b)
+
+	default:
+		return "", util.FmtNewtError(
+			"Unsupported flash programming tool: \"%s\"; must be one of: %s",
+			tool, strings.Join(flashScriptTools, ", "))
+	}
+
+	return b.String(), nil
+}
+
+// Generates a shell script that programs the manufacturing image onto a
+// device with the specified tool ("jlink" or "openocd").  Only the sectors
+// that the image writes are erased and programmed.  Each flash device's
+// regions are programmed at the device's base address, as specified by the
+// mfg.device_base.<device> setting.  The image must already have been
+// created.
+func (mi *MfgImage) FlashScript(tool string) (string, error) {
+	ranges, err := mi.SectorRanges()
+	if err != nil {
+		return "", err
+	}
+
+	regions := make([]flashRegion, len(ranges))
+	for i, r := range ranges {
+		regions[i] = flashRegion{
+			device:     r.Device,
+			path:       mi.sectionBinPath(r.Device),
+			fileOffset: r.Offset,
+			addr:       mi.DeviceBase(r.Device) + r.Offset,
+			size:       r.Size,
+			sectorSize: mi.bsp.FlashMap.SectorSize(r.Device),
+		}
+	}
+
+	return flashScript(tool, mi.basePkg.Name(), regions)
+}
@@ -0,0 +1,131 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []string{
+		"plain",
+		"with space",
+		"it's",
+		"$HOME `cmd` \"q\"",
+		"",
+	}
+
+	for _, s := range tests {
+		out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(s)).
+			Output()
+		if err != nil {
+			t.Fatalf("sh: %s", err.Error())
+		}
+		if string(out) != s {
+			t.Errorf("shellQuote(%q) evaluates to %q", s, out)
+		}
+	}
+}
+
+func TestFlashScript(t *testing.T) {
+	regions := []flashRegion{
+		{
+			device:     0,
+			path:       "bin/mfg/section 0.bin",
+			fileOffset: 0x4000,
+			addr:       0x08004000,
+			size:       0x2000,
+			sectorSize: 0x1000,
+		},
+		{
+			device:     1,
+			path:       "bin/mfg/section1.bin",
+			fileOffset: 0,
+			addr:       0x90000000,
+			size:       0x100,
+			sectorSize: 0x100,
+		},
+	}
+
+	extract := []string{
+		"dd if='bin/mfg/section 0.bin' of=\"$TMPDIR/region-0.bin\" " +
+			"bs=4096 skip=4 count=2",
+		"dd if='bin/mfg/section1.bin' of=\"$TMPDIR/region-1.bin\" " +
+			"bs=256 skip=0 count=1",
+	}
+
+	tests := []struct {
+		tool    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			tool: FLASH_SCRIPT_TOOL_JLINK,
+			want: []string{
+				"erase 0x08004000 0x08005fff\n",
+				"loadbin $TMPDIR/region-0.bin 0x08004000\n",
+				"erase 0x90000000 0x900000ff\n",
+				"loadbin $TMPDIR/region-1.bin 0x90000000\n",
+				"JLINK_DEVICE must be set",
+			},
+		},
+		{
+			tool: FLASH_SCRIPT_TOOL_OPENOCD,
+			want: []string{
+				"-c \"flash erase_address 0x08004000 0x2000\"",
+				"-c \"flash write_image $TMPDIR/region-0.bin 0x08004000 bin\"",
+				"-c \"flash erase_address 0x90000000 0x100\"",
+				"OPENOCD_CFG must be set",
+			},
+		},
+		{tool: "stlink", wantErr: true},
+	}
+
+	for _, test := range tests {
+		script, err := flashScript(test.tool, "test-mfg", regions)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.tool)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.tool, err.Error())
+			continue
+		}
+
+		if !strings.HasPrefix(script, "#!/bin/sh\n") {
+			t.Errorf("%s: script lacks interpreter line", test.tool)
+		}
+		for _, s := range append(extract, test.want...) {
+			if !strings.Contains(script, s) {
+				t.Errorf("%s: script lacks \"%s\":\n%s", test.tool, s,
+					script)
+			}
+		}
+
+		if err := exec.Command("sh", "-n", "-c", script).Run(); err != nil {
+			t.Errorf("%s: script has invalid syntax: %s", test.tool,
+				err.Error())
+		}
+	}
+}
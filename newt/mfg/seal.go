@@ -0,0 +1,91 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os/exec"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Passes the meta hash to an external sealing tool (e.g., an HSM client) and
+// returns the bytes the tool produces.  These bytes get stored in the hash TLV
+// in place of the plain digest.
+//
+// The tool is executed by the shell with the hex-encoded digest appended as
+// its final argument.  It must write the hex-encoded result to stdout; the
+// decoded result must be exactly size bytes long.  Anything the tool writes
+// to stderr is included in the error if it fails.
+func runSealCmd(sealCmd string, digest []byte, size int) ([]byte, error) {
+	cmdStr := sealCmd + " " + hex.EncodeToString(digest)
+	log.Debug(cmdStr)
+
+	cmd := exec.Command("sh", "-c", cmdStr)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, util.FmtNewtError("Sealing command \"%s\" failed: %s; %s",
+			sealCmd, err.Error(), strings.TrimSpace(stderr.String()))
+	}
+
+	seal, err := hex.DecodeString(strings.TrimSpace(string(out)))
+	if err != nil {
+		return nil, util.FmtNewtError(
+			"Sealing command \"%s\" produced invalid hex output: %s",
+			sealCmd, err.Error())
+	}
+
+	if len(seal) != size {
+		return nil, util.FmtNewtError(
+			"Sealing command \"%s\" produced %d bytes; hash TLV requires %d",
+			sealCmd, len(seal), size)
+	}
+
+	return seal, nil
+}
+
+// Calculates the meta hash of the manufacturing image without writing any
+// output or running the sealing tool.  This is the digest that the sealing
+// tool, if configured, would be given.  The returned offset is that of the
+// hash TLV's data within section 0.
+func (mi *MfgImage) SealDigest() ([]byte, int, error) {
+	sealCmd := mi.sealCmd
+	mi.sealCmd = ""
+	defer func() { mi.sealCmd = sealCmd }()
+
+	cs, err := mi.build()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return cs.hash, cs.hashOffset, nil
+}
+
+// Returns the sealing tool configured by mfg.seal_cmd; empty if none.
+func (mi *MfgImage) SealCmd() string {
+	return mi.sealCmd
+}
@@ -0,0 +1,89 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunSealCmd(t *testing.T) {
+	digest := []byte{0xde, 0xad, 0xbe, 0xef}
+
+	tests := []struct {
+		name    string
+		cmd     string
+		size    int
+		want    []byte
+		wantErr string
+	}{
+		{
+			// The digest is appended as the final argument.
+			name: "echo digest",
+			cmd:  "echo",
+			size: 4,
+			want: digest,
+		},
+		{
+			name: "fixed seal",
+			cmd:  "printf '0102\\n'; true",
+			size: 2,
+			want: []byte{1, 2},
+		},
+		{
+			name:    "wrong size",
+			cmd:     "echo",
+			size:    32,
+			wantErr: "produced 4 bytes",
+		},
+		{
+			name:    "bad hex",
+			cmd:     "echo xyz; true",
+			size:    4,
+			wantErr: "invalid hex",
+		},
+		{
+			name:    "failure",
+			cmd:     "echo hsm offline >&2; false",
+			size:    4,
+			wantErr: "hsm offline",
+		},
+	}
+
+	for _, test := range tests {
+		seal, err := runSealCmd(test.cmd, digest, test.size)
+		if test.wantErr != "" {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			} else if !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error \"%s\" does not contain \"%s\"",
+					test.name, err.Error(), test.wantErr)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+		} else if !bytes.Equal(seal, test.want) {
+			t.Errorf("%s: seal %x; want %x", test.name, seal, test.want)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+
+	"mynewt.apache.org/newt/newt/image"
+	"mynewt.apache.org/newt/util"
+)
+
+// The size of the windows searched for high-entropy data.  Random data
+// scores at least SECRET_MIN_ENTROPY in a window of this size; compiled code
+// rarely does.
+const SECRET_WINDOW_SZ = 64
+const SECRET_MIN_ENTROPY = 5.4
+
+const SECRET_KIND_ENTROPY = "high-entropy data"
+
+// The longest a PEM block may be for its end marker to be located.
+const secretPemMaxSz = 16 * 1024
+
+// How much of a matched pattern is included in a finding's description.
+const secretTextMaxSz = 40
+
+type secretPattern struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+var secretPatterns = []secretPattern{
+	{"PEM block", regexp.MustCompile(`-----BEGIN [A-Z0-9 ]{1,64}-----`)},
+	{"JWT", regexp.MustCompile(
+		`eyJ[A-Za-z0-9_-]{4,}\.eyJ[A-Za-z0-9_-]{4,}\.[A-Za-z0-9_-]{16,}`)},
+	{"AWS access key ID", regexp.MustCompile(`(AKIA|ASIA)[0-9A-Z]{16}`)},
+}
+
+var secretPemEndRe = regexp.MustCompile(`-----END [A-Z0-9 ]{1,64}-----`)
+
+// Data that looks like a secret.
+type SecretFinding struct {
+	Kind   string
+	Device int
+
+	// Location of the data within its flash device, or within the image file
+	// for an app image.
+	Offset int
+	Size   int
+
+	// The flash area containing the start of the data; empty if none does.
+	Area string
+
+	// The start of the matched text, or the entropy of high-entropy data.
+	Detail string
+}
+
+func (f SecretFinding) String() string {
+	area := f.Area
+	if area == "" {
+		area = "(no flash area)"
+	}
+
+	return fmt.Sprintf("%s: device=%d offset=0x%x size=%d area=%s: %s",
+		f.Kind, f.Device, f.Offset, f.Size, area, f.Detail)
+}
+
+type secretFindingSorter struct {
+	findings []SecretFinding
+}
+
+func (s secretFindingSorter) Len() int {
+	return len(s.findings)
+}
+func (s secretFindingSorter) Swap(i, j int) {
+	s.findings[i], s.findings[j] = s.findings[j], s.findings[i]
+}
+func (s secretFindingSorter) Less(i, j int) bool {
+	a, b := s.findings[i], s.findings[j]
+	if a.Device != b.Device {
+		return a.Device < b.Device
+	}
+	return a.Offset < b.Offset
+}
+
+func overlapsWindow(off int, size int, windows []zeroWindow) bool {
+	for _, win := range windows {
+		if off < win.offset+win.size && win.offset < off+size {
+			return true
+		}
+	}
+
+	return false
+}
+
+func secretText(data []byte) string {
+	if len(data) > secretTextMaxSz {
+		return fmt.Sprintf("%q...", data[:secretTextMaxSz])
+	}
+	return fmt.Sprintf("%q", data)
+}
+
+// Searches data for known secret patterns and, if minEntropy is nonzero, for
+// runs of high-entropy data.  Windows containing a pattern match or
+// overlapping any of the noEntropy ranges are not checked for entropy.  The
+// findings' offsets are relative to the start of data.
+func scanSecrets(data []byte, minEntropy float64,
+	noEntropy []zeroWindow) []SecretFinding {
+
+	findings := []SecretFinding{}
+	matched := []zeroWindow{}
+
+	for _, pat := range secretPatterns {
+		for _, loc := range pat.re.FindAllIndex(data, -1) {
+			start, end := loc[0], loc[1]
+
+			// Extend a PEM header to cover the whole block.
+			if pat.re == secretPatterns[0].re {
+				limit := util.IntMin(len(data), start+secretPemMaxSz)
+				if endLoc := secretPemEndRe.FindIndex(
+					data[end:limit]); endLoc != nil {
+
+					end += endLoc[1]
+				}
+			}
+
+			findings = append(findings, SecretFinding{
+				Kind:   pat.kind,
+				Offset: start,
+				Size:   end - start,
+				Detail: secretText(data[start:loc[1]]),
+			})
+			matched = append(matched, zeroWindow{start, end - start})
+		}
+	}
+
+	if minEntropy > 0 {
+		skip := append(matched, noEntropy...)
+
+		var run *SecretFinding
+		runEntropy := 0.0
+		flush := func() {
+			if run != nil {
+				run.Detail = fmt.Sprintf("entropy=%.3f bits/byte", runEntropy)
+				findings = append(findings, *run)
+				run = nil
+			}
+		}
+
+		// Consecutive windows overlap by half so that data straddling a
+		// window boundary is still detected.
+		step := SECRET_WINDOW_SZ / 2
+		for off := 0; off+SECRET_WINDOW_SZ <= len(data); off += step {
+			if overlapsWindow(off, SECRET_WINDOW_SZ, skip) {
+				flush()
+				continue
+			}
+
+			entropy := shannonEntropy(data[off : off+SECRET_WINDOW_SZ])
+			if entropy < minEntropy {
+				flush()
+				continue
+			}
+
+			if run == nil {
+				run = &SecretFinding{
+					Kind:   SECRET_KIND_ENTROPY,
+					Offset: off,
+				}
+				runEntropy = 0
+			}
+			run.Size = off + SECRET_WINDOW_SZ - run.Offset
+			if entropy > runEntropy {
+				runEntropy = entropy
+			}
+		}
+		flush()
+	}
+
+	return findings
+}
+
+// Returns the range of an image's header and trailer; these contain hashes
+// and signatures, which are expected to have high entropy.
+func imageMetadataWindows(data []byte, off int) []zeroWindow {
+	start, end, ok := image.PayloadBounds(data)
+	if !ok {
+		return nil
+	}
+
+	return []zeroWindow{
+		{off, start},
+		{off + end, len(data) - end},
+	}
+}
+
+// Scans a previously created manufacturing image for data that looks like a
+// secret: PEM blocks, JWTs, cloud credentials, and, if minEntropy is
+// nonzero, high-entropy data.  The meta region, image headers and trailers,
+// and areas listed in mfg.encrypted_areas are expected to have high entropy;
+// they are searched only for patterns.  Each finding is attributed to the
+// flash area containing it.
+func (mi *MfgImage) ScanSecrets(minEntropy float64) ([]SecretFinding, error) {
+	dsMap, _, err := mi.readSections()
+	if err != nil {
+		return nil, err
+	}
+
+	dpMap, err := mi.devicePartMap()
+	if err != nil {
+		return nil, err
+	}
+
+	layout, err := mi.MetaLayout()
+	if err != nil {
+		return nil, err
+	}
+
+	noEntropy := map[int][]zeroWindow{}
+	for device, parts := range dpMap {
+		for _, part := range parts {
+			noEntropy[device] = append(noEntropy[device],
+				imageMetadataWindows(part.data, part.offset)...)
+		}
+	}
+
+	regions := []*MetaLayout{&layout}
+	if layout.Chain != nil {
+		regions = append(regions, layout.Chain)
+	}
+	for _, region := range regions {
+		noEntropy[region.Section] = append(noEntropy[region.Section],
+			zeroWindow{region.Offset, region.Size})
+	}
+
+	for _, name := range mi.encryptedAreas {
+		area, ok := mi.bsp.FlashMap.Areas[name]
+		if !ok {
+			return nil, mi.loadError(
+				"mfg.encrypted_areas contains undefined flash area \"%s\"",
+				name)
+		}
+		noEntropy[area.Device] = append(noEntropy[area.Device],
+			zeroWindow{area.Offset, area.Size})
+	}
+
+	findings := []SecretFinding{}
+	for _, device := range mi.sectionIds() {
+		data := dsMap[device]
+		for _, f := range scanSecrets(data, minEntropy, noEntropy[device]) {
+			f.Device = device
+			for _, area := range mi.bsp.FlashMap.SortedAreas() {
+				if area.Device == device && f.Offset >= area.Offset &&
+					f.Offset < area.Offset+area.Size {
+
+					f.Area = area.Name
+					break
+				}
+			}
+			findings = append(findings, f)
+		}
+	}
+
+	sort.Sort(secretFindingSorter{findings})
+	return findings, nil
+}
+
+// Scans an app image file for data that looks like a secret.  The image
+// header and trailer are searched only for patterns.  Every finding is
+// attributed to the specified flash area, the slot the image is destined
+// for.
+func ScanImageSecrets(imgPath string, areaName string,
+	minEntropy float64) ([]SecretFinding, error) {
+
+	// Reject files that aren't images.
+	if _, _, err := image.ReadImage(imgPath); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(imgPath)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	findings := scanSecrets(data, minEntropy,
+		imageMetadataWindows(data, 0))
+	for i, _ := range findings {
+		findings[i].Area = areaName
+	}
+
+	sort.Sort(secretFindingSorter{findings})
+	return findings, nil
+}
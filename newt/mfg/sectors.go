@@ -0,0 +1,143 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"sort"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// A run of contiguous erase sectors within a single flash device.  First and
+// Last are sector indices; Last is inclusive.
+type SectorRange struct {
+	Device int
+	First  int
+	Last   int
+	Offset int
+	Size   int
+}
+
+// A byte range within a flash device that the manufacturing image writes.
+type dataExtent struct {
+	device int
+	offset int
+	size   int
+}
+
+// Converts a set of data extents into the erase sector ranges they touch.
+// Contiguous sectors are coalesced into a single range.  The result is sorted
+// by device, then by offset.
+func sectorRanges(extents []dataExtent, sectorSizes map[int]int) (
+	[]SectorRange, error) {
+
+	devSectors := map[int]map[int]struct{}{}
+	for _, ext := range extents {
+		if ext.size <= 0 {
+			continue
+		}
+
+		sectorSize := sectorSizes[ext.device]
+		if sectorSize <= 0 {
+			return nil, util.FmtNewtError(
+				"Flash device %d does not specify a sector size", ext.device)
+		}
+
+		if devSectors[ext.device] == nil {
+			devSectors[ext.device] = map[int]struct{}{}
+		}
+
+		first := ext.offset / sectorSize
+		last := (ext.offset + ext.size - 1) / sectorSize
+		for i := first; i <= last; i++ {
+			devSectors[ext.device][i] = struct{}{}
+		}
+	}
+
+	devices := make([]int, 0, len(devSectors))
+	for device, _ := range devSectors {
+		devices = append(devices, device)
+	}
+	sort.Ints(devices)
+
+	ranges := []SectorRange{}
+	for _, device := range devices {
+		indices := make([]int, 0, len(devSectors[device]))
+		for idx, _ := range devSectors[device] {
+			indices = append(indices, idx)
+		}
+		sort.Ints(indices)
+
+		sectorSize := sectorSizes[device]
+		for _, idx := range indices {
+			n := len(ranges)
+			if n > 0 && ranges[n-1].Device == device &&
+				ranges[n-1].Last == idx-1 {
+
+				ranges[n-1].Last = idx
+				ranges[n-1].Size += sectorSize
+				continue
+			}
+
+			ranges = append(ranges, SectorRange{
+				Device: device,
+				First:  idx,
+				Last:   idx,
+				Offset: idx * sectorSize,
+				Size:   sectorSize,
+			})
+		}
+	}
+
+	return ranges, nil
+}
+
+// Lists the erase sectors that the manufacturing image writes: those
+// covered by its boot loader, images, raw entries, and meta regions.  The
+// sector size of each device comes from the BSP's flash map.  The image's
+// input files must already have been copied to the mfg bin directory (i.e.,
+// the image must already have been created).
+func (mi *MfgImage) SectorRanges() ([]SectorRange, error) {
+	dpMap, err := mi.devicePartMap()
+	if err != nil {
+		return nil, err
+	}
+
+	extents := []dataExtent{}
+	for device, parts := range dpMap {
+		for _, part := range parts {
+			extents = append(extents,
+				dataExtent{device, part.offset, len(part.data)})
+		}
+	}
+
+	layout, err := mi.MetaLayout()
+	if err != nil {
+		return nil, err
+	}
+	extents = append(extents,
+		dataExtent{layout.Section, layout.Offset, layout.Size})
+	if layout.Chain != nil {
+		extents = append(extents, dataExtent{
+			layout.Chain.Section, layout.Chain.Offset, layout.Chain.Size})
+	}
+
+	return sectorRanges(extents, mi.bsp.FlashMap.SectorSizes)
+}
@@ -0,0 +1,91 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"testing"
+)
+
+func TestSectorRanges(t *testing.T) {
+	sizes := map[int]int{0: 0x1000, 1: 0x100}
+
+	tests := []struct {
+		name    string
+		extents []dataExtent
+		want    []SectorRange
+		wantErr bool
+	}{
+		{"empty", nil, []SectorRange{}, false},
+		{"single sector", []dataExtent{{0, 0x10, 0x20}},
+			[]SectorRange{{0, 0, 0, 0, 0x1000}}, false},
+		{"spans sectors", []dataExtent{{0, 0xff0, 0x20}},
+			[]SectorRange{{0, 0, 1, 0, 0x2000}}, false},
+		// Adjacent extents touching neighbouring sectors coalesce; the gap
+		// at sector 3 splits the result.
+		{"coalesced", []dataExtent{
+			{0, 0x2000, 0x800},
+			{0, 0x0000, 0x1000},
+			{0, 0x1800, 0x100},
+			{0, 0x4000, 0x1},
+		}, []SectorRange{
+			{0, 0, 2, 0, 0x3000},
+			{0, 4, 4, 0x4000, 0x1000},
+		}, false},
+		{"overlapping extents", []dataExtent{
+			{0, 0x0000, 0x1800},
+			{0, 0x1000, 0x100},
+		}, []SectorRange{{0, 0, 1, 0, 0x2000}}, false},
+		{"sorted by device", []dataExtent{
+			{1, 0x200, 0x100},
+			{0, 0x0, 0x10},
+		}, []SectorRange{
+			{0, 0, 0, 0, 0x1000},
+			{1, 2, 2, 0x200, 0x100},
+		}, false},
+		{"empty extent ignored", []dataExtent{{2, 0, 0}}, []SectorRange{},
+			false},
+		{"no sector size", []dataExtent{{2, 0, 1}}, nil, true},
+	}
+
+	for _, test := range tests {
+		got, err := sectorRanges(test.extents, sizes)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if len(got) != len(test.want) {
+			t.Errorf("%s: ranges=%+v; want %+v", test.name, got, test.want)
+			continue
+		}
+		for i, r := range got {
+			if r != test.want[i] {
+				t.Errorf("%s: range %d=%+v; want %+v",
+					test.name, i, r, test.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// How long to wait for another process to release a serial counter file.
+const SERIAL_LOCK_TIMEOUT = 10 * time.Second
+
+// Produces the serial number of the next manufacturing image copy.
+type SerialSource func() (uint64, error)
+
+func lockCounterFile(path string) (string, error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(SERIAL_LOCK_TIMEOUT)
+
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY,
+			0644)
+		if err == nil {
+			f.Close()
+			return lockPath, nil
+		}
+
+		if !os.IsExist(err) {
+			return "", util.ChildNewtError(err)
+		}
+
+		if time.Now().After(deadline) {
+			return "", util.FmtNewtError(
+				"Timed out waiting for serial counter lock %s; remove it if "+
+					"no other newt process is running", lockPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Reads the next serial number from a counter file and writes back its
+// successor.  The file contains a single decimal number; a missing file is
+// treated as containing 0.  A lock file prevents concurrent newt processes
+// from allocating the same serial, and the new value is written via rename
+// so an interrupted run never corrupts the counter.
+func nextCounterSerial(path string) (uint64, error) {
+	lockPath, err := lockCounterFile(path)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(lockPath)
+
+	var serial uint64
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		serial, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10,
+			64)
+		if err != nil {
+			return 0, util.FmtNewtError(
+				"Serial counter file %s contains invalid value: %s",
+				path, strings.TrimSpace(string(data)))
+		}
+	} else if !os.IsNotExist(err) {
+		return 0, util.ChildNewtError(err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return 0, util.ChildNewtError(err)
+	}
+	_, err = tmp.WriteString(strconv.FormatUint(serial+1, 10) + "\n")
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, util.ChildNewtError(err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return 0, util.ChildNewtError(err)
+	}
+
+	return serial, nil
+}
+
+// Creates a serial source backed by the specified counter file.  Each call
+// allocates one serial number.
+func CounterFileSerialSource(path string) SerialSource {
+	return func() (uint64, error) {
+		return nextCounterSerial(path)
+	}
+}
@@ -0,0 +1,115 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCounterFileSerialSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents *string
+		want     []uint64
+		wantErr  bool
+	}{
+		{"missing file", nil, []uint64{0, 1, 2}, false},
+		{"existing counter", strPtr("41\n"), []uint64{41, 42}, false},
+		{"whitespace", strPtr("  7 \n\n"), []uint64{7}, false},
+		{"invalid contents", strPtr("abc"), nil, true},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "newt-serial")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "counter")
+		if test.contents != nil {
+			err := ioutil.WriteFile(path, []byte(*test.contents), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		src := CounterFileSerialSource(path)
+		if test.wantErr {
+			if _, err := src(); err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+
+		for _, want := range test.want {
+			got, err := src()
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", test.name, err)
+			}
+			if got != want {
+				t.Errorf("%s: serial=%d; want %d", test.name, got, want)
+			}
+		}
+
+		if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+			t.Errorf("%s: lock file left behind", test.name)
+		}
+	}
+}
+
+func TestMetaSerialTlv(t *testing.T) {
+	for _, serial := range []uint64{0, 1, 0x0123456789abcdef} {
+		s := serial
+
+		params := testMetaParams()
+		params.serial = &s
+		_, meta, _ := testInsertAndParse(t, params)
+
+		tlv := findMetaTlv(meta, META_TLV_CODE_SERIAL)
+		if tlv == nil {
+			t.Fatalf("serial %d: region contains no serial TLV", serial)
+		}
+		if len(tlv.Data) != META_TLV_SERIAL_SZ {
+			t.Fatalf("serial %d: TLV size=%d; want %d",
+				serial, len(tlv.Data), META_TLV_SERIAL_SZ)
+		}
+		if got := binary.LittleEndian.Uint64(tlv.Data); got != serial {
+			t.Errorf("serial TLV contains %d; want %d", got, serial)
+		}
+		if meta.Version != META_VERSION_2 {
+			t.Errorf("serialized region has meta version %d", meta.Version)
+		}
+	}
+
+	// Without a serial number, no serial TLV is emitted.
+	_, meta, _ := testInsertAndParse(t, testMetaParams())
+	if findMetaTlv(meta, META_TLV_CODE_SERIAL) != nil {
+		t.Errorf("unserialized region contains a serial TLV")
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,183 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/util"
+)
+
+// Creates an erased model of each flash device.  A device is as large as its
+// capacity, if the BSP specifies one, or else just large enough to hold its
+// last flash area.
+func flashModel(flashMap flash.FlashMap, ids []int) map[int][]byte {
+	areasByDevice := flashMap.AreasByDevice()
+
+	model := map[int][]byte{}
+	for _, id := range ids {
+		size := flashMap.Capacity(id)
+		if size == 0 {
+			for _, area := range areasByDevice[id] {
+				size = util.IntMax(size, area.Offset+area.Size)
+			}
+		}
+
+		dev := make([]byte, size)
+		eraseVal := flashMap.EraseVal(id)
+		for i, _ := range dev {
+			dev[i] = eraseVal
+		}
+		model[id] = dev
+	}
+
+	return model
+}
+
+// Writes each section into the corresponding device of a flash model.  A
+// section that does not fit its device is reported and not written.
+func programModel(model map[int][]byte,
+	dsMap map[int][]byte) []VerifyProblem {
+
+	ids := make([]int, 0, len(dsMap))
+	for id, _ := range dsMap {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	problems := []VerifyProblem{}
+	for _, id := range ids {
+		dev := model[id]
+		if len(dsMap[id]) > len(dev) {
+			problems = append(problems, VerifyProblem{"", fmt.Sprintf(
+				"section %d does not fit flash device; "+
+					"section-size=%d device-size=%d",
+				id, len(dsMap[id]), len(dev))})
+			continue
+		}
+
+		copy(dev, dsMap[id])
+	}
+
+	return problems
+}
+
+func metaRegionBytes(data []byte, meta Meta) []byte {
+	return data[meta.Offset : meta.Offset+meta.Size]
+}
+
+// Compares the meta region parsed from a flash model against the region in
+// the built image.
+func compareSimulatedMeta(built Meta, builtData []byte, sim Meta,
+	simData []byte) []VerifyProblem {
+
+	problems := []VerifyProblem{}
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems,
+			VerifyProblem{"", fmt.Sprintf(format, args...)})
+	}
+
+	if sim.Offset != built.Offset || sim.Size != built.Size {
+		addProblem("meta region moved; built offset=0x%x size=%d, "+
+			"flash offset=0x%x size=%d",
+			built.Offset, built.Size, sim.Offset, sim.Size)
+	} else if !bytes.Equal(metaRegionBytes(builtData, built),
+		metaRegionBytes(simData, sim)) {
+
+		addProblem("meta region contents differ from built image")
+	}
+
+	switch {
+	case built.Chain == nil && sim.Chain != nil:
+		addProblem("flash contains an unexpected chained meta region")
+
+	case built.Chain != nil && sim.Chain == nil:
+		addProblem("chained meta region missing from flash")
+
+	case built.Chain != nil:
+		if sim.Chain.Offset != built.Chain.Offset ||
+			sim.Chain.Size != built.Chain.Size ||
+			!bytes.Equal(metaRegionBytes(builtData, *built.Chain),
+				metaRegionBytes(simData, *sim.Chain)) {
+
+			addProblem("chained meta region differs from built image")
+		}
+	}
+
+	return problems
+}
+
+// Simulates programming a previously created manufacturing image into erased
+// flash, then locates and parses the meta region in the flash model as a
+// device would.  The region must be found where the flash map places it, must
+// match the built image byte for byte, and its flash area TLVs must match the
+// BSP's flash map.  Failures to read the image are returned as an error; each
+// discrepancy is reported as a problem.
+func (mi *MfgImage) SimulateFlash() ([]VerifyProblem, error) {
+	dsMap, _, err := mi.readSections()
+	if err != nil {
+		return nil, err
+	}
+
+	built, err := ParseMeta(dsMap[0])
+	if err != nil {
+		return nil, util.PreNewtError(err, "Built image")
+	}
+
+	layout, err := mi.MetaLayout()
+	if err != nil {
+		return nil, err
+	}
+
+	model := flashModel(mi.bsp.FlashMap, mi.deviceIds())
+	problems := programModel(model, dsMap)
+
+	window := model[0]
+	if end := mi.metaWindowEnd(); end < len(window) {
+		window = window[:end]
+	}
+
+	sim, err := ParseMeta(window)
+	if err != nil {
+		problems = append(problems, VerifyProblem{"",
+			"meta region not readable from flash: " + err.Error()})
+		return problems, nil
+	}
+
+	if sim.Offset != layout.Offset {
+		problems = append(problems, VerifyProblem{"", fmt.Sprintf(
+			"meta region at offset 0x%x; flash map places it at 0x%x",
+			sim.Offset, layout.Offset)})
+	}
+
+	problems = append(problems,
+		compareSimulatedMeta(built, dsMap[0], sim, window)...)
+
+	areaProblems, err := verifyAreas(mi.bsp.FlashMap, sim)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, areaProblems...)
+
+	return problems, nil
+}
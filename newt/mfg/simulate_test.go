@@ -0,0 +1,177 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFlashModel(t *testing.T) {
+	fm := testFlashMap(t)
+
+	tests := []struct {
+		name       string
+		capacities map[int]int
+		eraseVals  map[int]byte
+		wantSizes  map[int]int
+		wantErase  map[int]byte
+	}{
+		{
+			name:      "sized by areas",
+			wantSizes: map[int]int{0: 0x9000, 1: 0x1000},
+			wantErase: map[int]byte{0: 0xff, 1: 0xff},
+		},
+		{
+			name:       "capacity and erase value",
+			capacities: map[int]int{0: 0x10000},
+			eraseVals:  map[int]byte{1: 0x00},
+			wantSizes:  map[int]int{0: 0x10000, 1: 0x1000},
+			wantErase:  map[int]byte{0: 0xff, 1: 0x00},
+		},
+	}
+
+	for _, test := range tests {
+		fm.Capacities = test.capacities
+		fm.EraseVals = test.eraseVals
+
+		model := flashModel(fm, []int{0, 1})
+		for id, size := range test.wantSizes {
+			dev := model[id]
+			if len(dev) != size {
+				t.Errorf("%s: device %d: got size 0x%x; want 0x%x",
+					test.name, id, len(dev), size)
+				continue
+			}
+			want := bytes.Repeat([]byte{test.wantErase[id]}, size)
+			if !bytes.Equal(dev, want) {
+				t.Errorf("%s: device %d: not erased to 0x%02x",
+					test.name, id, test.wantErase[id])
+			}
+		}
+	}
+}
+
+func TestProgramModel(t *testing.T) {
+	model := map[int][]byte{
+		0: bytes.Repeat([]byte{0xff}, 8),
+		1: bytes.Repeat([]byte{0xff}, 4),
+	}
+	dsMap := map[int][]byte{
+		0: {1, 2, 3},
+		1: {1, 2, 3, 4, 5},
+	}
+
+	problems := programModel(model, dsMap)
+	if len(problems) != 1 ||
+		!strings.Contains(problems[0].Text, "section 1 does not fit") {
+
+		t.Errorf("got problems %v; want section 1 misfit", problems)
+	}
+
+	want := []byte{1, 2, 3, 0xff, 0xff, 0xff, 0xff, 0xff}
+	if !bytes.Equal(model[0], want) {
+		t.Errorf("device 0: got %v; want %v", model[0], want)
+	}
+	if !bytes.Equal(model[1], bytes.Repeat([]byte{0xff}, 4)) {
+		t.Errorf("device 1 written despite misfit: %v", model[1])
+	}
+}
+
+func TestCompareSimulatedMeta(t *testing.T) {
+	section, built, _ := testInsertAndParse(t, testMetaParams())
+
+	corrupt := append([]byte{}, section...)
+	corrupt[built.Offset] ^= 0xff
+
+	moved := built
+	moved.Offset -= 8
+
+	chain := &Meta{Offset: built.Offset, Size: built.Size}
+	withChain := built
+	withChain.Chain = chain
+
+	tests := []struct {
+		name    string
+		built   Meta
+		sim     Meta
+		simData []byte
+		want    string
+	}{
+		{
+			name:    "identical",
+			built:   built,
+			sim:     built,
+			simData: section,
+		},
+		{
+			name:    "corrupted contents",
+			built:   built,
+			sim:     built,
+			simData: corrupt,
+			want:    "contents differ",
+		},
+		{
+			name:    "moved region",
+			built:   built,
+			sim:     moved,
+			simData: section,
+			want:    "meta region moved",
+		},
+		{
+			name:    "unexpected chain",
+			built:   built,
+			sim:     withChain,
+			simData: section,
+			want:    "unexpected chained meta region",
+		},
+		{
+			name:    "missing chain",
+			built:   withChain,
+			sim:     built,
+			simData: section,
+			want:    "chained meta region missing",
+		},
+		{
+			name:    "matching chain",
+			built:   withChain,
+			sim:     withChain,
+			simData: section,
+		},
+	}
+
+	for _, test := range tests {
+		problems := compareSimulatedMeta(test.built, section, test.sim,
+			test.simData)
+		if test.want == "" {
+			if len(problems) != 0 {
+				t.Errorf("%s: unexpected problems: %v", test.name, problems)
+			}
+			continue
+		}
+		if len(problems) != 1 ||
+			!strings.Contains(problems[0].Text, test.want) {
+
+			t.Errorf("%s: got problems %v; want one containing \"%s\"",
+				test.name, problems, test.want)
+		}
+	}
+}
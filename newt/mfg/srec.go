@@ -0,0 +1,188 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// An S-record file consists of a header record (S0), the data records, a
+// count of the data records (S5 or S6), and a termination record.  The width
+// of every data record's address is determined by the highest address in the
+// file: S1 records have 16-bit addresses, S2 24-bit, and S3 32-bit.  The
+// termination record (S9, S8, or S7, respectively) must match.
+
+// The number of data bytes in each S-record.
+const SREC_DATA_LEN = 32
+
+// A contiguous run of bytes to be written at the specified address.
+type srecSegment struct {
+	addr int
+	data []byte
+}
+
+type srecSegmentSorter struct {
+	segs []srecSegment
+}
+
+func (s srecSegmentSorter) Len() int {
+	return len(s.segs)
+}
+func (s srecSegmentSorter) Swap(i, j int) {
+	s.segs[i], s.segs[j] = s.segs[j], s.segs[i]
+}
+func (s srecSegmentSorter) Less(i, j int) bool {
+	return s.segs[i].addr < s.segs[j].addr
+}
+
+// Returns the number of address bytes required to express every address up
+// to and including maxAddr.
+func srecAddrLen(maxAddr int) (int, error) {
+	switch {
+	case maxAddr <= 0xffff:
+		return 2, nil
+	case maxAddr <= 0xffffff:
+		return 3, nil
+	case maxAddr <= 0xffffffff:
+		return 4, nil
+	default:
+		return 0, util.FmtNewtError(
+			"address 0x%x too large for an S-record file", maxAddr)
+	}
+}
+
+// Formats a single record.  The byte count covers the address, the data, and
+// the checksum; the checksum is the ones' complement of the least significant
+// byte of the sum of the count, address, and data bytes.
+func srecRecord(typ int, addrLen int, addr int, data []byte) string {
+	rec := []byte{byte(addrLen + len(data) + 1)}
+	for i := addrLen - 1; i >= 0; i-- {
+		rec = append(rec, byte(addr>>(8*uint(i))))
+	}
+	rec = append(rec, data...)
+
+	sum := byte(0)
+	for _, b := range rec {
+		sum += b
+	}
+	rec = append(rec, ^sum)
+
+	return fmt.Sprintf("S%d%X\n", typ, rec)
+}
+
+// Encodes a set of segments as an S-record file.  Segments must not overlap.
+func encodeSrec(header string, segs []srecSegment) ([]byte, error) {
+	sorted := make([]srecSegment, len(segs))
+	copy(sorted, segs)
+	sort.Sort(srecSegmentSorter{sorted})
+
+	maxAddr := 0
+	for i, seg := range sorted {
+		if i > 0 {
+			prev := sorted[i-1]
+			if prev.addr+len(prev.data) > seg.addr {
+				return nil, util.FmtNewtError(
+					"S-record segments overlap; 0x%x-0x%x and 0x%x-0x%x",
+					prev.addr, prev.addr+len(prev.data),
+					seg.addr, seg.addr+len(seg.data))
+			}
+		}
+		if len(seg.data) > 0 {
+			maxAddr = util.IntMax(maxAddr, seg.addr+len(seg.data)-1)
+		}
+	}
+
+	addrLen, err := srecAddrLen(maxAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// S1, S2, and S3 data records are terminated by S9, S8, and S7 records.
+	dataType := addrLen - 1
+	termType := 11 - addrLen
+
+	buf := bytes.Buffer{}
+	buf.WriteString(srecRecord(0, 2, 0, []byte(header)))
+
+	count := 0
+	for _, seg := range sorted {
+		for off := 0; off < len(seg.data); off += SREC_DATA_LEN {
+			end := off + SREC_DATA_LEN
+			if end > len(seg.data) {
+				end = len(seg.data)
+			}
+			buf.WriteString(srecRecord(dataType, addrLen, seg.addr+off,
+				seg.data[off:end]))
+			count++
+		}
+	}
+
+	if count <= 0xffff {
+		buf.WriteString(srecRecord(5, 2, count, nil))
+	} else if count <= 0xffffff {
+		buf.WriteString(srecRecord(6, 3, count, nil))
+	}
+
+	buf.WriteString(srecRecord(termType, addrLen, 0, nil))
+
+	return buf.Bytes(), nil
+}
+
+// Encodes the specified sections as an S-record file.  Each section is placed
+// at the address its device is programmed at (mfg.device_base.<id>,
+// or 0).
+func (mi *MfgImage) sectionsSrec(dsMap map[int][]byte) ([]byte, error) {
+	segs := []srecSegment{}
+	for id, data := range dsMap {
+		segs = append(segs, srecSegment{
+			addr: mi.DeviceBase(id),
+			data: data,
+		})
+	}
+
+	srec, err := encodeSrec(mi.basePkg.Name(), segs)
+	if err != nil {
+		return nil, util.PreNewtError(err,
+			"Cannot encode manufacturing image %s as S-records; flash "+
+				"devices must be programmed at distinct addresses",
+			mi.basePkg.Name())
+	}
+
+	return srec, nil
+}
+
+// Writes the specified sections to the image's S-record file.
+func (mi *MfgImage) writeSrec(dsMap map[int][]byte) error {
+	srec, err := mi.sectionsSrec(dsMap)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(mi.SrecPath(), srec, 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"testing"
+)
+
+func TestSrecRecord(t *testing.T) {
+	tests := []struct {
+		typ     int
+		addrLen int
+		addr    int
+		data    []byte
+		want    string
+	}{
+		{0, 2, 0, []byte("hello     \x00\x00"),
+			"S00F000068656C6C6F202020202000003C\n"},
+		{1, 2, 0x7af0, []byte{0x0a, 0x0a, 0x0d, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0},
+			"S1137AF00A0A0D0000000000000000000000000061\n"},
+		{5, 2, 3, nil, "S5030003F9\n"},
+		{9, 2, 0, nil, "S9030000FC\n"},
+	}
+
+	for _, test := range tests {
+		got := srecRecord(test.typ, test.addrLen, test.addr, test.data)
+		if got != test.want {
+			t.Errorf("srecRecord(%d, %d, 0x%x, %x)=%q; want %q",
+				test.typ, test.addrLen, test.addr, test.data, got, test.want)
+		}
+	}
+}
+
+func TestSrecAddrLen(t *testing.T) {
+	tests := []struct {
+		maxAddr int
+		want    int
+		wantErr bool
+	}{
+		{0, 2, false},
+		{0xffff, 2, false},
+		{0x10000, 3, false},
+		{0xffffff, 3, false},
+		{0x1000000, 4, false},
+		{0xffffffff, 4, false},
+		{0x100000000, 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := srecAddrLen(test.maxAddr)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("0x%x: expected error", test.maxAddr)
+			}
+		} else if err != nil || got != test.want {
+			t.Errorf("0x%x: addrLen=%d err=%v; want %d",
+				test.maxAddr, got, err, test.want)
+		}
+	}
+}
+
+// The fixture image is two segments requiring 24-bit addresses.  The first
+// spans more than one data record.
+const testSrecFixture = "" +
+	"S00A000066697874757265EE\n" +
+	"S224010000000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D" +
+	"1E1FEA\n" +
+	"S2080100202021222350\n" +
+	"S206020000AABB92\n" +
+	"S5030003F9\n" +
+	"S804000000FB\n"
+
+func TestEncodeSrec(t *testing.T) {
+	first := make([]byte, 0x24)
+	for i := range first {
+		first[i] = byte(i)
+	}
+
+	// Segments are supplied out of order; the encoder sorts them.
+	segs := []srecSegment{
+		{addr: 0x20000, data: []byte{0xaa, 0xbb}},
+		{addr: 0x10000, data: first},
+	}
+
+	got, err := encodeSrec("fixture", segs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != testSrecFixture {
+		t.Errorf("S-record mismatch; got:\n%s\nwant:\n%s",
+			got, testSrecFixture)
+	}
+
+	overlapping := []srecSegment{
+		{addr: 0x1000, data: make([]byte, 0x10)},
+		{addr: 0x1008, data: make([]byte, 0x10)},
+	}
+	if _, err := encodeSrec("fixture", overlapping); err == nil {
+		t.Errorf("expected error for overlapping segments")
+	}
+}
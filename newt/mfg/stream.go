@@ -0,0 +1,231 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"mynewt.apache.org/newt/util"
+)
+
+const streamChunkSz = 64 * 1024
+
+// A byte range within section 0 that reads as zeros while hashing.
+type zeroWindow struct {
+	offset int
+	size   int
+}
+
+func tlvZeroWindows(meta Meta, types ...uint8) []zeroWindow {
+	windows := []zeroWindow{}
+	for _, tlv := range meta.Tlvs {
+		for _, typ := range types {
+			if tlv.Type == typ {
+				windows = append(windows,
+					zeroWindow{tlv.Offset + 2, len(tlv.Data)})
+			}
+		}
+	}
+
+	return windows
+}
+
+// Returns the window covering the data of the primary region's region CRC
+// TLV, if any.  The secondary region's CRC is calculated when the region is
+// built, so it is never zeroed.
+func regionCrcZeroWindows(meta Meta) []zeroWindow {
+	windows := []zeroWindow{}
+	for _, win := range tlvZeroWindows(meta, META_TLV_CODE_REGION_CRC) {
+		if win.offset >= meta.Offset && win.offset < meta.Offset+meta.Size {
+			windows = append(windows, win)
+		}
+	}
+
+	return windows
+}
+
+// Returns the windows covering the placeholder areas that the meta region
+// excludes from its integrity values.  Each area's location is taken from the
+// region's flash area TLVs.
+func placeholderZeroWindows(meta Meta) []zeroWindow {
+	windows := []zeroWindow{}
+
+	fm, err := meta.FlashMap()
+	if err != nil {
+		return windows
+	}
+
+	for _, tlv := range meta.Tlvs {
+		if tlv.Type != META_TLV_CODE_PLACEHOLDER ||
+			len(tlv.Data) != META_TLV_PLACEHOLDER_SZ ||
+			tlv.Data[1]&META_PLACEHOLDER_F_UNHASHED == 0 {
+
+			continue
+		}
+
+		for _, area := range fm.Areas {
+			if area.Id == int(tlv.Data[0]) && area.Device == 0 {
+				windows = append(windows,
+					zeroWindow{area.Offset, area.Size})
+			}
+		}
+	}
+
+	return windows
+}
+
+// Returns the windows covering the data of the meta region's hash, HMAC, CRC,
+// and region CRC TLVs, and any placeholder areas excluded from them.  These
+// bytes are zeroed when the hash is calculated.
+func hashZeroWindows(meta Meta) []zeroWindow {
+	windows := tlvZeroWindows(meta,
+		META_TLV_CODE_HASH, META_TLV_CODE_HMAC, META_TLV_CODE_CRC)
+	windows = append(windows, placeholderZeroWindows(meta)...)
+	windows = append(windows, verifyBlockZeroWindows(meta)...)
+	return append(windows, regionCrcZeroWindows(meta)...)
+}
+
+// Returns the windows covering the data of the meta region's CRC and region
+// CRC TLVs, and any placeholder areas excluded from the CRC.  The CRC is
+// calculated after the hash is filled in, but before the region CRC.
+func crcZeroWindows(meta Meta) []zeroWindow {
+	windows := tlvZeroWindows(meta, META_TLV_CODE_CRC)
+	windows = append(windows, placeholderZeroWindows(meta)...)
+	windows = append(windows, verifyBlockZeroWindows(meta)...)
+	return append(windows, regionCrcZeroWindows(meta)...)
+}
+
+// Zeroes the parts of buf that fall within any of the windows.  buf holds the
+// bytes starting at offset pos.
+func applyZeroWindows(buf []byte, pos int, windows []zeroWindow) {
+	for _, win := range windows {
+		start := util.IntMax(win.offset, pos) - pos
+		end := util.IntMin(win.offset+win.size, pos+len(buf)) - pos
+		for i := start; i < end; i++ {
+			buf[i] = 0
+		}
+	}
+}
+
+// Writes the contents of the specified section files to w, in order.  Bytes
+// of the first file that fall within a zero window are replaced with zeros.
+// The files are read one chunk at a time, so an image never needs to fit in
+// memory.  The resulting byte stream is identical to the concatenation
+// performed by calcMetaHash.
+func streamSections(paths []string, windows []zeroWindow, w io.Writer) error {
+	buf := make([]byte, streamChunkSz)
+
+	for i, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return util.FmtNewtError(
+				"Failed to read mfg section file: %s", err.Error())
+		}
+
+		pos := 0
+		for {
+			n, err := f.Read(buf)
+			if n > 0 {
+				chunk := buf[:n]
+				if i == 0 {
+					applyZeroWindows(chunk, pos, windows)
+				}
+				w.Write(chunk)
+				pos += n
+			}
+
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				f.Close()
+				return util.FmtNewtError(
+					"Failed to read mfg section file: %s", err.Error())
+			}
+		}
+
+		f.Close()
+	}
+
+	return nil
+}
+
+// Calculates the meta hash of a set of section files without reading them
+// into memory.  The result matches calcMetaHash applied to the same sections
+// with the windows zeroed.
+func streamMetaHash(paths []string, windows []zeroWindow,
+	salt []byte) ([]byte, error) {
+
+	h := sha256.New()
+	h.Write(salt)
+	if err := streamSections(paths, windows, h); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// Calculates the meta HMAC of a set of section files without reading them
+// into memory.  The result matches calcMetaHmac.
+func streamMetaHmac(paths []string, windows []zeroWindow,
+	key []byte) ([]byte, error) {
+
+	mac := hmac.New(sha256.New, key)
+	if err := streamSections(paths, windows, mac); err != nil {
+		return nil, err
+	}
+
+	return mac.Sum(nil), nil
+}
+
+// Calculates the meta CRC of a set of section files without reading them
+// into memory.  The result matches calcMetaCrc.
+func streamMetaCrc(paths []string, windows []zeroWindow) (uint32, error) {
+	h := crc32.NewIEEE()
+	if err := streamSections(paths, windows, h); err != nil {
+		return 0, err
+	}
+
+	return h.Sum32(), nil
+}
+
+// Reads the first size bytes of a file.  If the file is shorter, its entire
+// contents are returned.
+func readFileHead(path string, size int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, util.FmtNewtError(
+			"Failed to read mfg section file: %s", err.Error())
+	}
+	defer f.Close()
+
+	buf := make([]byte, size)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, util.FmtNewtError(
+			"Failed to read mfg section file: %s", err.Error())
+	}
+
+	return buf[:n], nil
+}
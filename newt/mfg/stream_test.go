@@ -0,0 +1,176 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyZeroWindows(t *testing.T) {
+	tests := []struct {
+		name    string
+		pos     int
+		windows []zeroWindow
+		want    []byte
+	}{
+		{"no windows", 10, nil, []byte{1, 2, 3, 4}},
+		{"inside", 10, []zeroWindow{{11, 2}}, []byte{1, 0, 0, 4}},
+		{"before", 10, []zeroWindow{{4, 6}}, []byte{1, 2, 3, 4}},
+		{"after", 10, []zeroWindow{{14, 6}}, []byte{1, 2, 3, 4}},
+		{"straddles start", 10, []zeroWindow{{8, 3}}, []byte{0, 2, 3, 4}},
+		{"straddles end", 10, []zeroWindow{{13, 3}}, []byte{1, 2, 3, 0}},
+		{"covers", 10, []zeroWindow{{0, 100}}, []byte{0, 0, 0, 0}},
+		{
+			"multiple",
+			10,
+			[]zeroWindow{{10, 1}, {12, 1}},
+			[]byte{0, 2, 0, 4},
+		},
+	}
+
+	for _, test := range tests {
+		buf := []byte{1, 2, 3, 4}
+		applyZeroWindows(buf, test.pos, test.windows)
+		if !bytes.Equal(buf, test.want) {
+			t.Errorf("%s: applyZeroWindows() = %v; want %v", test.name, buf,
+				test.want)
+		}
+	}
+}
+
+// Streaming the sections through the hash, HMAC, and CRC yields the same
+// values as calculating them over the zeroed sections in memory.
+func TestStreamSections(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-mfg-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	section0 := make([]byte, 2*streamChunkSz+100)
+	for i, _ := range section0 {
+		section0[i] = byte(i * 7)
+	}
+	section1 := bytes.Repeat([]byte{0xa5}, 300)
+
+	paths := []string{
+		filepath.Join(dir, "section0.bin"),
+		filepath.Join(dir, "section1.bin"),
+	}
+	for i, data := range [][]byte{section0, section1} {
+		if err := ioutil.WriteFile(paths[i], data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	salt := []byte("salt")
+	key := []byte("key")
+
+	tests := []struct {
+		name    string
+		windows []zeroWindow
+	}{
+		{"no windows", nil},
+		{"first chunk", []zeroWindow{{16, 32}}},
+		{"chunk boundary", []zeroWindow{{streamChunkSz - 4, 8}}},
+		{
+			"several",
+			[]zeroWindow{{0, 4}, {streamChunkSz, 1}, {len(section0) - 8, 8}},
+		},
+	}
+
+	for _, test := range tests {
+		zeroed := append([]byte{}, section0...)
+		applyZeroWindows(zeroed, 0, test.windows)
+		sections := [][]byte{zeroed, section1}
+
+		hash, err := streamMetaHash(paths, test.windows, salt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := calcMetaHash(sections, salt); !bytes.Equal(hash, want) {
+			t.Errorf("%s: streamed hash %x; want %x", test.name, hash, want)
+		}
+
+		mac, err := streamMetaHmac(paths, test.windows, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := calcMetaHmac(sections, key); !bytes.Equal(mac, want) {
+			t.Errorf("%s: streamed HMAC %x; want %x", test.name, mac, want)
+		}
+
+		crc, err := streamMetaCrc(paths, test.windows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := calcMetaCrc(sections); crc != want {
+			t.Errorf("%s: streamed CRC %08x; want %08x", test.name, crc,
+				want)
+		}
+	}
+
+	// Windows only apply to section 0.
+	window := []zeroWindow{{0, len(section1)}}
+	hash, err := streamMetaHash(paths, window, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeroed := append([]byte{}, section0...)
+	applyZeroWindows(zeroed, 0, window)
+	want := calcMetaHash([][]byte{zeroed, section1}, nil)
+	if !bytes.Equal(hash, want) {
+		t.Errorf("window applied beyond section 0")
+	}
+
+	missing := []string{filepath.Join(dir, "missing.bin")}
+	if _, err := streamMetaHash(missing, nil, nil); err == nil {
+		t.Errorf("expected error for missing section file")
+	}
+}
+
+func TestReadFileHead(t *testing.T) {
+	dir, path := testSectionFile(t, []byte{1, 2, 3, 4, 5})
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		size int
+		want []byte
+	}{
+		{0, []byte{}},
+		{3, []byte{1, 2, 3}},
+		{5, []byte{1, 2, 3, 4, 5}},
+		{10, []byte{1, 2, 3, 4, 5}},
+	}
+
+	for _, test := range tests {
+		got, err := readFileHead(path, test.size)
+		if err != nil {
+			t.Errorf("size %d: unexpected error: %s", test.size, err.Error())
+		} else if !bytes.Equal(got, test.want) {
+			t.Errorf("size %d: readFileHead() = %v; want %v", test.size, got,
+				test.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+// Firmware that reads the meta region at runtime locates it with these
+// symbols.  Offsets are relative to the region's flash device; addresses add
+// the device's programming base (mfg.device_base.<device>).
+
+const MFG_META_SYM_PREFIX = "mfg_meta"
+const MFG_META_MACRO_PREFIX = "MFG_META"
+
+type metaSymbol struct {
+	name  string
+	value int
+}
+
+func metaSymbols(layout MetaLayout, bases map[int]int) []metaSymbol {
+	syms := []metaSymbol{
+		{"device", layout.Section},
+		{"offset", layout.Offset},
+		{"size", layout.Size},
+		{"addr", bases[layout.Section] + layout.Offset},
+	}
+
+	if layout.Chain != nil {
+		syms = append(syms,
+			metaSymbol{"chain_offset", layout.Chain.Offset},
+			metaSymbol{"chain_size", layout.Chain.Size},
+			metaSymbol{"chain_addr",
+				bases[layout.Chain.Section] + layout.Chain.Offset},
+		)
+	}
+
+	return syms
+}
+
+// Produces a linker script fragment defining the meta region symbols.
+func metaSymbolsLd(layout MetaLayout, bases map[int]int) []byte {
+	buf := bytes.Buffer{}
+
+	fmt.Fprintf(&buf, "/* Manufacturing meta region; generated by newt. */\n")
+	for _, sym := range metaSymbols(layout, bases) {
+		fmt.Fprintf(&buf, "%s_%s = 0x%x;\n",
+			MFG_META_SYM_PREFIX, sym.name, sym.value)
+	}
+
+	return buf.Bytes()
+}
+
+// Produces a C header defining the meta region macros.
+func metaSymbolsHeader(layout MetaLayout, bases map[int]int) []byte {
+	buf := bytes.Buffer{}
+
+	fmt.Fprintf(&buf, "%s", newtutil.GeneratedPreamble())
+	fmt.Fprintf(&buf, "#ifndef H_MFG_META_\n")
+	fmt.Fprintf(&buf, "#define H_MFG_META_\n\n")
+	for _, sym := range metaSymbols(layout, bases) {
+		fmt.Fprintf(&buf, "#define %s_%s 0x%x\n",
+			MFG_META_MACRO_PREFIX, strings.ToUpper(sym.name), sym.value)
+	}
+	fmt.Fprintf(&buf, "\n#endif\n")
+
+	return buf.Bytes()
+}
+
+// Writes a linker script fragment and a C header describing the location of
+// the meta region.  The location depends only on the BSP's flash map, so the
+// files can be generated before the images that include them are built.
+//
+// @return                      [paths-of-written-files], error
+func (mi *MfgImage) WriteMetaSymbols() ([]string, error) {
+	layout, err := mi.MetaLayout()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(MfgBinDir(mi.basePkg.Name()), 0755); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	ldPath := MfgMetaLdPath(mi.basePkg.Name())
+	if err := ioutil.WriteFile(ldPath, metaSymbolsLd(layout, mi.deviceBases),
+		0644); err != nil {
+
+		return nil, util.ChildNewtError(err)
+	}
+
+	hdrPath := MfgMetaHeaderPath(mi.basePkg.Name())
+	if err := ioutil.WriteFile(hdrPath,
+		metaSymbolsHeader(layout, mi.deviceBases), 0644); err != nil {
+
+		return nil, util.ChildNewtError(err)
+	}
+
+	return []string{ldPath, hdrPath}, nil
+}
@@ -0,0 +1,118 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetaSymbols(t *testing.T) {
+	layout := MetaLayout{
+		Section: 0,
+		Offset:  0x3f00,
+		Size:    0x100,
+	}
+	chained := layout
+	chained.Chain = &MetaLayout{
+		Section: 1,
+		Offset:  0x800,
+		Size:    0x80,
+	}
+
+	tests := []struct {
+		name    string
+		layout  MetaLayout
+		bases   map[int]int
+		wantLd  []string
+		wantHdr []string
+	}{
+		{
+			name:   "no bases",
+			layout: layout,
+			wantLd: []string{
+				"mfg_meta_device = 0x0;\n",
+				"mfg_meta_offset = 0x3f00;\n",
+				"mfg_meta_size = 0x100;\n",
+				"mfg_meta_addr = 0x3f00;\n",
+			},
+			wantHdr: []string{
+				"#define MFG_META_OFFSET 0x3f00\n",
+				"#define MFG_META_ADDR 0x3f00\n",
+			},
+		},
+		{
+			name:   "device base",
+			layout: layout,
+			bases:  map[int]int{0: 0x08000000},
+			wantLd: []string{
+				"mfg_meta_offset = 0x3f00;\n",
+				"mfg_meta_addr = 0x8003f00;\n",
+			},
+			wantHdr: []string{
+				"#define MFG_META_ADDR 0x8003f00\n",
+			},
+		},
+		{
+			name:   "chained region",
+			layout: chained,
+			bases:  map[int]int{0: 0x08000000, 1: 0x60000000},
+			wantLd: []string{
+				"mfg_meta_chain_offset = 0x800;\n",
+				"mfg_meta_chain_size = 0x80;\n",
+				"mfg_meta_chain_addr = 0x60000800;\n",
+			},
+			wantHdr: []string{
+				"#define MFG_META_CHAIN_ADDR 0x60000800\n",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		ld := string(metaSymbolsLd(test.layout, test.bases))
+		for _, want := range test.wantLd {
+			if !strings.Contains(ld, want) {
+				t.Errorf("%s: linker script missing \"%s\"; got:\n%s",
+					test.name, strings.TrimSpace(want), ld)
+			}
+		}
+
+		hdr := string(metaSymbolsHeader(test.layout, test.bases))
+		for _, want := range test.wantHdr {
+			if !strings.Contains(hdr, want) {
+				t.Errorf("%s: header missing \"%s\"; got:\n%s",
+					test.name, strings.TrimSpace(want), hdr)
+			}
+		}
+		if !strings.Contains(hdr, "#ifndef H_MFG_META_") ||
+			!strings.HasSuffix(hdr, "#endif\n") {
+
+			t.Errorf("%s: header lacks include guard; got:\n%s",
+				test.name, hdr)
+		}
+	}
+
+	// Chain symbols are only emitted for chained layouts.
+	if ld := string(metaSymbolsLd(layout, nil)); strings.Contains(ld,
+		"chain") {
+
+		t.Errorf("unchained layout emits chain symbols:\n%s", ld)
+	}
+}
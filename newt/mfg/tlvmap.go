@@ -0,0 +1,123 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Maps meta TLV types to the codes written to flash.  Vendors who fork the
+// meta format may renumber TLVs; types absent from this map use their
+// standard META_TLV_CODE_[...] value.  Everything outside this file deals in
+// the standard codes; translation happens only when a TLV header is written
+// or parsed.
+var metaTlvWireCodes = map[uint8]uint8{}
+
+// Resolves a TLV type name, either the full constant name
+// ("META_TLV_CODE_HASH") or its suffix ("hash"), to its standard code.
+func metaTlvCodeByName(name string) (uint8, bool) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(name, "META_TLV_CODE_") {
+		name = "META_TLV_CODE_" + name
+	}
+
+	for _, desc := range MetaTlvCodes() {
+		if desc.Name == name {
+			return uint8(desc.Code), true
+		}
+	}
+
+	return 0, false
+}
+
+// Replaces the TLV code mapping.  The keys of codes are TLV type names
+// (e.g., "hash"); the values are the codes to use in their place.  An empty
+// map restores the standard codes.  No two TLV types may end up sharing a
+// code.
+func SetMetaTlvCodes(codes map[string]string) error {
+	wireCodes := map[uint8]uint8{}
+	for name, codeStr := range codes {
+		typ, ok := metaTlvCodeByName(name)
+		if !ok {
+			return util.FmtNewtError(
+				"Unknown meta TLV type in TLV code override: \"%s\"", name)
+		}
+
+		code, err := util.AtoiNoOct(codeStr)
+		if err != nil || code <= 0 || code > 0xff {
+			return util.FmtNewtError(
+				"Invalid code for meta TLV type \"%s\": \"%s\"; "+
+					"must be in the range 1-255", name, codeStr)
+		}
+
+		wireCodes[typ] = uint8(code)
+	}
+
+	owners := map[uint8]string{}
+	for _, desc := range MetaTlvCodes() {
+		code := uint8(desc.Code)
+		if wire, ok := wireCodes[code]; ok {
+			code = wire
+		}
+
+		if owner, ok := owners[code]; ok {
+			return util.FmtNewtError(
+				"Meta TLV types %s and %s both use code 0x%02x",
+				owner, desc.Name, code)
+		}
+		owners[code] = desc.Name
+	}
+
+	metaTlvWireCodes = wireCodes
+	return nil
+}
+
+// Returns the code written to flash for the specified TLV type.
+func metaTlvToWire(typ uint8) uint8 {
+	if code, ok := metaTlvWireCodes[typ]; ok {
+		return code
+	}
+	return typ
+}
+
+// Returns the TLV type denoted by a code read from flash.  A code that
+// belongs to no known type is returned unchanged, unless it is the standard
+// code of a type that has been renumbered; such a code is foreign to the
+// configured format and yields 0, which matches no type.
+func metaTlvFromWire(code uint8) uint8 {
+	for typ, wire := range metaTlvWireCodes {
+		if wire == code {
+			return typ
+		}
+	}
+
+	if _, ok := metaTlvWireCodes[code]; ok {
+		return 0
+	}
+	return code
+}
+
+// Returns the code written to flash for the specified TLV type, taking any
+// override into account.
+func MetaTlvWireCode(typ int) int {
+	return int(metaTlvToWire(uint8(typ)))
+}
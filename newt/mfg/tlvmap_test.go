@@ -0,0 +1,115 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"testing"
+)
+
+func TestSetMetaTlvCodes(t *testing.T) {
+	defer SetMetaTlvCodes(nil)
+
+	tests := []struct {
+		name    string
+		codes   map[string]string
+		wantErr bool
+	}{
+		{"none", map[string]string{}, false},
+		{"suffix", map[string]string{"hash": "0x80"}, false},
+		{"full name", map[string]string{"META_TLV_CODE_HMAC": "129"}, false},
+		{
+			"swapped",
+			map[string]string{"hash": "2", "flash_area": "1"},
+			false,
+		},
+		{"unknown type", map[string]string{"bogus": "0x80"}, true},
+		{"zero code", map[string]string{"hash": "0"}, true},
+		{"code too large", map[string]string{"hash": "0x100"}, true},
+		{"not a number", map[string]string{"hash": "x"}, true},
+		{"collides with standard", map[string]string{"hash": "2"}, true},
+		{
+			"collides with override",
+			map[string]string{"hash": "0x80", "hmac": "0x80"},
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		err := SetMetaTlvCodes(test.codes)
+		if test.wantErr && err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+		if !test.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+		}
+	}
+}
+
+func TestMetaTlvWireCodes(t *testing.T) {
+	defer SetMetaTlvCodes(nil)
+
+	if err := SetMetaTlvCodes(map[string]string{"hash": "0x80"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		typ  uint8
+		wire uint8
+	}{
+		{META_TLV_CODE_HASH, 0x80},
+		{META_TLV_CODE_FLASH_AREA, META_TLV_CODE_FLASH_AREA},
+	}
+	for _, test := range tests {
+		if got := metaTlvToWire(test.typ); got != test.wire {
+			t.Errorf("metaTlvToWire(0x%02x) = 0x%02x; want 0x%02x",
+				test.typ, got, test.wire)
+		}
+		if got := metaTlvFromWire(test.wire); got != test.typ {
+			t.Errorf("metaTlvFromWire(0x%02x) = 0x%02x; want 0x%02x",
+				test.wire, got, test.typ)
+		}
+	}
+
+	// The standard hash code is foreign to the renumbered format.
+	if got := metaTlvFromWire(META_TLV_CODE_HASH); got != 0 {
+		t.Errorf("metaTlvFromWire(0x%02x) = 0x%02x; want 0",
+			META_TLV_CODE_HASH, got)
+	}
+
+	// A region written with renumbered codes carries the override in flash
+	// and parses back to the standard types.
+	section, meta, layout := testInsertAndParse(t, testMetaParams())
+	found := false
+	for _, tlv := range layout.Tlvs {
+		if tlv.Type == META_TLV_CODE_HASH {
+			found = true
+			if section[tlv.Offset] != 0x80 {
+				t.Errorf("hash TLV written with code 0x%02x; want 0x80",
+					section[tlv.Offset])
+			}
+		}
+	}
+	if !found {
+		t.Errorf("layout has no hash TLV")
+	}
+	if tlvIndex(meta, META_TLV_CODE_HASH) == -1 {
+		t.Errorf("parsed region has no hash TLV")
+	}
+}
@@ -0,0 +1,171 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"fmt"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// TLV ordering rules a boot loader may impose on each meta region.
+const (
+	// The hash TLV, if the region has one, is the region's last TLV.
+	META_ORDER_HASH_LAST = "hash_last"
+
+	// The region's flash area TLVs form a single unbroken run.
+	META_ORDER_FLASH_AREAS_CONTIGUOUS = "flash_areas_contiguous"
+)
+
+var metaOrderRuleNames = []string{
+	META_ORDER_FLASH_AREAS_CONTIGUOUS,
+	META_ORDER_HASH_LAST,
+}
+
+// The TLV ordering rules a boot loader imposes; the zero value imposes none.
+type MetaOrderPolicy struct {
+	HashLast             bool
+	FlashAreasContiguous bool
+}
+
+// Parses a list of ordering rule names (META_ORDER_[...]).
+func ParseMetaOrderPolicy(rules []string) (MetaOrderPolicy, error) {
+	policy := MetaOrderPolicy{}
+
+	for _, rule := range rules {
+		switch rule {
+		case META_ORDER_HASH_LAST:
+			policy.HashLast = true
+
+		case META_ORDER_FLASH_AREAS_CONTIGUOUS:
+			policy.FlashAreasContiguous = true
+
+		default:
+			return policy, util.FmtNewtError(
+				"Unknown meta TLV ordering rule \"%s\"; valid rules: %s",
+				rule, strings.Join(metaOrderRuleNames, ", "))
+		}
+	}
+
+	return policy, nil
+}
+
+// Checks the TLV types of a single region, in order, against the policy.
+// Returns a description of each violation.
+func (policy MetaOrderPolicy) checkRegion(label string,
+	types []uint8) []string {
+
+	violations := []string{}
+
+	if policy.HashLast {
+		for i, typ := range types {
+			if typ == META_TLV_CODE_HASH && i != len(types)-1 {
+				violations = append(violations, fmt.Sprintf(
+					"%s region: hash TLV is followed by %s (%s)", label,
+					metaTlvName(types[i+1]), META_ORDER_HASH_LAST))
+			}
+		}
+	}
+
+	if policy.FlashAreasContiguous {
+		runs := 0
+		for i, typ := range types {
+			if typ == META_TLV_CODE_FLASH_AREA &&
+				(i == 0 || types[i-1] != META_TLV_CODE_FLASH_AREA) {
+
+				runs++
+			}
+		}
+		if runs > 1 {
+			violations = append(violations, fmt.Sprintf(
+				"%s region: flash area TLVs are split into %d runs (%s)",
+				label, runs, META_ORDER_FLASH_AREAS_CONTIGUOUS))
+		}
+	}
+
+	return violations
+}
+
+// Builds the error reported for a set of ordering violations; nil if there
+// are none.
+func metaOrderError(violations []string) error {
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return util.FmtNewtError(
+		"Meta region violates the boot loader's TLV ordering rules:\n%s",
+		"    * "+strings.Join(violations, "\n    * "))
+}
+
+// Checks the TLV order of a region the meta builder has laid out.
+func (policy MetaOrderPolicy) checkLayout(layout MetaLayout) error {
+	regions := []*MetaLayout{&layout}
+	if layout.Chain != nil {
+		regions = append(regions, layout.Chain)
+	}
+
+	violations := []string{}
+	for i, region := range regions {
+		types := make([]uint8, len(region.Tlvs))
+		for j, tlv := range region.Tlvs {
+			types[j] = uint8(tlv.Type)
+		}
+
+		label := "primary"
+		if i > 0 {
+			label = "secondary"
+		}
+		violations = append(violations, policy.checkRegion(label, types)...)
+	}
+
+	return metaOrderError(violations)
+}
+
+// Checks the TLV order of a parsed meta region, and of its secondary region
+// if it has one.
+func (meta Meta) CheckOrder(policy MetaOrderPolicy) error {
+	primary := meta.Tlvs
+	if meta.Chain != nil {
+		primary = meta.Tlvs[:len(meta.Tlvs)-len(meta.Chain.Tlvs)]
+	}
+
+	regions := [][]MetaTlv{primary}
+	if meta.Chain != nil {
+		regions = append(regions, meta.Chain.Tlvs)
+	}
+
+	violations := []string{}
+	for i, tlvs := range regions {
+		types := make([]uint8, len(tlvs))
+		for j, tlv := range tlvs {
+			types[j] = tlv.Type
+		}
+
+		label := "primary"
+		if i > 0 {
+			label = "secondary"
+		}
+		violations = append(violations, policy.checkRegion(label, types)...)
+	}
+
+	return metaOrderError(violations)
+}
@@ -0,0 +1,123 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"testing"
+)
+
+func TestParseMetaOrderPolicy(t *testing.T) {
+	tests := []struct {
+		rules   []string
+		want    MetaOrderPolicy
+		wantErr bool
+	}{
+		{nil, MetaOrderPolicy{}, false},
+		{[]string{META_ORDER_HASH_LAST}, MetaOrderPolicy{HashLast: true},
+			false},
+		{[]string{META_ORDER_FLASH_AREAS_CONTIGUOUS, META_ORDER_HASH_LAST},
+			MetaOrderPolicy{HashLast: true, FlashAreasContiguous: true},
+			false},
+		{[]string{"hash_first"}, MetaOrderPolicy{}, true},
+	}
+
+	for _, test := range tests {
+		policy, err := ParseMetaOrderPolicy(test.rules)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%v: expected error", test.rules)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.rules, err)
+		} else if policy != test.want {
+			t.Errorf("%v: policy=%+v; want %+v",
+				test.rules, policy, test.want)
+		}
+	}
+}
+
+func TestMetaOrderCheckRegion(t *testing.T) {
+	fa := uint8(META_TLV_CODE_FLASH_AREA)
+	hash := uint8(META_TLV_CODE_HASH)
+	hmac := uint8(META_TLV_CODE_HMAC)
+	lic := uint8(META_TLV_CODE_LICENSE)
+	both := MetaOrderPolicy{HashLast: true, FlashAreasContiguous: true}
+
+	tests := []struct {
+		name       string
+		policy     MetaOrderPolicy
+		types      []uint8
+		violations int
+	}{
+		{"in order", both, []uint8{fa, fa, lic, hash}, 0},
+		{"no hash", both, []uint8{fa, fa}, 0},
+		{"hash not last", both, []uint8{fa, hash, hmac}, 1},
+		{"split flash areas", both, []uint8{fa, lic, fa, hash}, 1},
+		{"both violated", both, []uint8{fa, lic, fa, hash, hmac}, 2},
+		{"no policy", MetaOrderPolicy{}, []uint8{fa, hash, fa}, 0},
+		{"hash last only", MetaOrderPolicy{HashLast: true},
+			[]uint8{fa, lic, fa, hash}, 0},
+	}
+
+	for _, test := range tests {
+		violations := test.policy.checkRegion("primary", test.types)
+		if len(violations) != test.violations {
+			t.Errorf("%s: violations=%q; want %d of them",
+				test.name, violations, test.violations)
+		}
+	}
+}
+
+func TestMetaOrderPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		hmac    bool
+		policy  MetaOrderPolicy
+		wantErr bool
+	}{
+		{"hash last", false, MetaOrderPolicy{HashLast: true}, false},
+		{"hmac follows hash", true, MetaOrderPolicy{HashLast: true}, true},
+		{"contiguous with hmac", true,
+			MetaOrderPolicy{FlashAreasContiguous: true}, false},
+	}
+
+	for _, test := range tests {
+		params := testMetaParams()
+		params.withHmac = test.hmac
+		params.orderPolicy = test.policy
+
+		_, _, err := insertMeta(testSection0(), testFlashMap(t), params)
+		if test.wantErr != (err != nil) {
+			t.Errorf("%s: insertMeta error=%v; want error=%v",
+				test.name, err, test.wantErr)
+		}
+
+		// A region built without the policy is checked by the parser.
+		params.orderPolicy = MetaOrderPolicy{}
+		_, meta, _ := testInsertAndParse(t, params)
+		err = meta.CheckOrder(test.policy)
+		if test.wantErr != (err != nil) {
+			t.Errorf("%s: CheckOrder error=%v; want error=%v",
+				test.name, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/util"
+)
+
+// Identifies the flash areas in the BSP's flash map that nothing uses: the
+// manufacturing image leaves them erased, the mfg package assigns them no
+// role, and no syscfg setting of the boot loader or any image names them.
+// Such an area often indicates a configuration mistake, such as a
+// misspelled area name in a setting.  System areas are never reported; the
+// boot loader uses them at run time.  The image must already have been
+// created.
+func (mi *MfgImage) UnreferencedAreas() ([]flash.FlashArea, error) {
+	empty, err := mi.EmptyAreas()
+	if err != nil {
+		return nil, err
+	}
+
+	used := mi.assignedAreas()
+
+	targets := []*target.Target{}
+	if mi.boot != nil {
+		targets = append(targets, mi.boot)
+	}
+	targets = append(targets, mi.images...)
+
+	for _, t := range targets {
+		tb, err := builder.NewTargetBuilder(t)
+		if err != nil {
+			return nil, err
+		}
+
+		refs, err := tb.SyscfgFlashRefs()
+		if err != nil {
+			return nil, util.PreNewtError(err,
+				"Failed to resolve syscfg of target %s", t.FullName())
+		}
+		for _, ref := range refs {
+			used[ref.Area] = true
+		}
+	}
+
+	return unreferencedAreas(mi.bsp.FlashMap, empty, used), nil
+}
+
+// Retrieves the names of the flash areas that the mfg package assigns a
+// role, including the system areas.
+func (mi *MfgImage) assignedAreas() map[string]bool {
+	assigned := map[string]bool{}
+	for name, _ := range flash.SYSTEM_AREA_NAME_ID_MAP {
+		assigned[name] = true
+	}
+	for _, name := range mi.bootAreas {
+		assigned[name] = true
+	}
+	for _, name := range mi.placeholderAreas {
+		assigned[name] = true
+	}
+	if mi.metaChainArea != "" {
+		assigned[mi.metaChainArea] = true
+	}
+
+	return assigned
+}
+
+// Selects the empty areas that are neither meant to ship empty nor used.
+func unreferencedAreas(flashMap flash.FlashMap, empty []EmptyArea,
+	used map[string]bool) []flash.FlashArea {
+
+	unrefd := []flash.FlashArea{}
+	for _, ea := range empty {
+		if ea.Intentional || used[ea.Area] {
+			continue
+		}
+
+		unrefd = append(unrefd, flashMap.Areas[ea.Area])
+	}
+
+	return unrefd
+}
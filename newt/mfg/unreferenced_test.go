@@ -0,0 +1,94 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"fmt"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/pkg"
+)
+
+func TestUnreferencedAreas(t *testing.T) {
+	fm := testFlashMap(t)
+
+	// Image slot 1, the data area, and the chain area are all erased.
+	empty := []EmptyArea{
+		{Area: flash.FLASH_AREA_NAME_IMAGE_1},
+		{Area: "FLASH_AREA_DATA"},
+		{Area: testChainArea},
+	}
+
+	tests := []struct {
+		name        string
+		chainArea   string
+		intentional string
+		refs        []string
+		want        []string
+	}{
+		{
+			name: "nothing references user areas",
+			want: []string{"FLASH_AREA_DATA", testChainArea},
+		},
+		{
+			name:      "chain area assigned",
+			chainArea: testChainArea,
+			want:      []string{"FLASH_AREA_DATA"},
+		},
+		{
+			name:        "meant to ship empty",
+			intentional: "FLASH_AREA_DATA",
+			want:        []string{testChainArea},
+		},
+		{
+			name: "named by syscfg",
+			refs: []string{"FLASH_AREA_DATA", testChainArea},
+			want: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		mi := &MfgImage{
+			bsp:           &pkg.BspPackage{FlashMap: fm},
+			bootAreas:     []string{flash.FLASH_AREA_NAME_BOOTLOADER},
+			metaChainArea: test.chainArea,
+		}
+
+		used := mi.assignedAreas()
+		for _, ref := range test.refs {
+			used[ref] = true
+		}
+
+		ea := append([]EmptyArea{}, empty...)
+		for i, _ := range ea {
+			ea[i].Intentional = ea[i].Area == test.intentional
+		}
+
+		got := []string{}
+		for _, area := range unreferencedAreas(fm, ea, used) {
+			got = append(got, area.Name)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: got unreferenced areas %v; want %v",
+				test.name, got, test.want)
+		}
+	}
+}
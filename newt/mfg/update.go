@@ -0,0 +1,184 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"io/ioutil"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/util"
+)
+
+// Determines which image slot occupies the specified flash area.
+func imgIdxFromAreaName(areaName string) (int, error) {
+	switch areaName {
+	case flash.FLASH_AREA_NAME_IMAGE_0:
+		return 0, nil
+	case flash.FLASH_AREA_NAME_IMAGE_1:
+		return 1, nil
+	default:
+		return 0, util.FmtNewtError(
+			"Cannot update flash area \"%s\"; only %s and %s can be updated "+
+				"in place", areaName, flash.FLASH_AREA_NAME_IMAGE_0,
+			flash.FLASH_AREA_NAME_IMAGE_1)
+	}
+}
+
+// Reads the sections of a previously created manufacturing image.
+func (mi *MfgImage) readSections() (map[int][]byte, [][]byte, error) {
+	dsMap := map[int][]byte{}
+	ids := mi.sectionIds()
+	sections := make([][]byte, len(ids))
+
+	for i, id := range ids {
+		data, err := ioutil.ReadFile(mi.sectionBinPath(id))
+		if err != nil {
+			return nil, nil, util.FmtNewtError(
+				"Failed to read mfg section %d; the image must be created "+
+					"first: %s", id, err.Error())
+		}
+
+		dsMap[id] = data
+		sections[i] = data
+	}
+
+	return dsMap, sections, nil
+}
+
+func zeroField(data []byte, off int, size int) {
+	for i := off; i < off+size; i++ {
+		data[i] = 0
+	}
+}
+
+// Rebuilds a previously created manufacturing image after the image in the
+// specified slot has changed.  Only the slot's flash area is rewritten; all
+// other bytes are carried over from the existing sections.  The meta
+// region's integrity values are then recalculated.  The existing meta region
+// must have the layout newt would produce for it now; otherwise a full
+// rebuild is required.
+//
+// @return                      [paths-of-artifacts], error
+func (mi *MfgImage) UpdateArea(areaName string) ([]string, error) {
+	imgIdx, err := imgIdxFromAreaName(areaName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mi.copyImageBinFiles(); err != nil {
+		return nil, err
+	}
+
+	imgPath := mi.dstImgPath(imgIdx)
+	if imgPath == "" {
+		return nil, util.FmtNewtError(
+			"Manufacturing image %s does not contain an image in flash "+
+				"area \"%s\"", mi.basePkg.Name(), areaName)
+	}
+
+	// Ensure the new image fits in its slot without clobbering anything.
+	if err := mi.detectOverlaps(); err != nil {
+		return nil, err
+	}
+	part, err := mi.partFromImage(imgPath, areaName)
+	if err != nil {
+		return nil, err
+	}
+
+	layout, err := mi.MetaLayout()
+	if err != nil {
+		return nil, err
+	}
+
+	dsMap, sections, err := mi.readSections()
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := ParseMeta(dsMap[0])
+	if err != nil {
+		return nil, err
+	}
+	if meta.Offset != layout.Offset || meta.Size != layout.Size {
+		return nil, util.FmtNewtError(
+			"Existing meta region of %s does not match its configured "+
+				"layout (offset=0x%x size=%d; expected offset=0x%x size=%d); "+
+				"a full rebuild is required",
+			mi.basePkg.Name(), meta.Offset, meta.Size,
+			layout.Offset, layout.Size)
+	}
+
+	if len(dsMap[0]) < part.offset+len(part.data) {
+		return nil, util.FmtNewtError(
+			"Existing mfg section 0 is too small to contain flash area "+
+				"\"%s\"; a full rebuild is required", areaName)
+	}
+
+	// The verification block follows all other data; a larger image must
+	// not reach it.
+	verifyBlockOff := meta.verifyBlockOffset()
+	if verifyBlockOff > 0 && part.offset+len(part.data) > verifyBlockOff {
+		return nil, util.FmtNewtError(
+			"Updated image in flash area \"%s\" overlaps the verification "+
+				"block at offset 0x%x; a full rebuild is required",
+			areaName, verifyBlockOff)
+	}
+	insertPartIntoBlob(dsMap[0], part)
+
+	cs := createState{
+		dsMap:           dsMap,
+		metaOffset:      layout.Offset,
+		hashOffset:      layout.HashOffset,
+		hmacOffset:      layout.HmacOffset,
+		crcOffset:       layout.CrcOffset,
+		regionCrcOffset: layout.RegionCrcOffset,
+	}
+	if verifyBlockOff > 0 {
+		cs.verifyBlockOffset = verifyBlockOff
+	}
+
+	// The integrity values must be zeroed before they are recalculated.
+	zeroField(dsMap[0], cs.hashOffset, META_HASH_SZ)
+	if mi.hmacKey != nil {
+		zeroField(dsMap[0], cs.hmacOffset, META_TLV_HMAC_SZ)
+	}
+	if mi.metaCrc {
+		zeroField(dsMap[0], cs.crcOffset, META_TLV_CRC_SZ)
+	}
+	if cs.regionCrcOffset != 0 {
+		zeroField(dsMap[0], cs.regionCrcOffset, META_TLV_REGION_CRC_SZ)
+	}
+
+	if err := mi.fillMetaIntegrity(&cs, sections, nil); err != nil {
+		return nil, err
+	}
+
+	// Only section 0 contains image slots.
+	if err := ioutil.WriteFile(mi.sectionBinPath(0), dsMap[0],
+		0644); err != nil {
+
+		return nil, util.ChildNewtError(err)
+	}
+	if err := mi.writeManifest(cs); err != nil {
+		return nil, err
+	}
+
+	return []string{mi.sectionBinPath(0), mi.ManifestPath()}, nil
+}
@@ -0,0 +1,112 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+)
+
+func TestImgIdxFromAreaName(t *testing.T) {
+	tests := []struct {
+		name     string
+		areaName string
+		want     int
+		wantErr  string
+	}{
+		{
+			name:     "slot 0",
+			areaName: flash.FLASH_AREA_NAME_IMAGE_0,
+			want:     0,
+		},
+		{
+			name:     "slot 1",
+			areaName: flash.FLASH_AREA_NAME_IMAGE_1,
+			want:     1,
+		},
+		{
+			name:     "boot loader",
+			areaName: flash.FLASH_AREA_NAME_BOOTLOADER,
+			wantErr:  "can be updated in place",
+		},
+		{
+			name:     "unknown area",
+			areaName: "FLASH_AREA_USER_0",
+			wantErr:  "FLASH_AREA_USER_0",
+		},
+	}
+
+	for _, test := range tests {
+		got, err := imgIdxFromAreaName(test.areaName)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: expected error containing \"%s\"; got %v",
+					test.name, test.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: got index %d; want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestZeroField(t *testing.T) {
+	tests := []struct {
+		name string
+		off  int
+		size int
+		want []byte
+	}{
+		{
+			name: "empty field",
+			off:  2,
+			size: 0,
+			want: []byte{1, 2, 3, 4, 5, 6},
+		},
+		{
+			name: "interior field",
+			off:  1,
+			size: 3,
+			want: []byte{1, 0, 0, 0, 5, 6},
+		},
+		{
+			name: "trailing field",
+			off:  4,
+			size: 2,
+			want: []byte{1, 2, 3, 4, 0, 0},
+		},
+	}
+
+	for _, test := range tests {
+		data := []byte{1, 2, 3, 4, 5, 6}
+		zeroField(data, test.off, test.size)
+		if !bytes.Equal(data, test.want) {
+			t.Errorf("%s: got %v; want %v", test.name, data, test.want)
+		}
+	}
+}
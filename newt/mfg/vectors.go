@@ -0,0 +1,440 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/util"
+)
+
+const META_VECTORS_JSON_NAME = "vectors.json"
+
+// Describes how the integrity values of each test vector are calculated.
+// Each vector stands alone, as if it were the entire contents of flash.
+const metaVectorHashInput = "hash: SHA256 of the salt (if any) followed by " +
+	"the vector, with the hash, CRC, and region CRC data zeroed; crc: " +
+	"CRC32 (IEEE) of the vector with the CRC and region CRC data zeroed; " +
+	"region_crc: CRC32 (IEEE) of the vector up to the region CRC TLV header"
+
+// Fixed inputs for the optional TLVs of the full vectors.
+var metaVectorSalt = []byte("newt-test-vector-salt")
+var metaVectorSerial uint64 = 0x0123456789abcdef
+
+const metaVectorLicense = "Apache-2.0"
+const metaVectorCopyright = "Test vector"
+
+// The layout and options of a single test vector.
+type metaVectorSpec struct {
+	numAreas  int
+	full      bool // Include every optional TLV.
+	secondary bool // A secondary region of a chained layout; has no hash.
+	bigEndian bool
+}
+
+func (spec metaVectorSpec) name() string {
+	kind := "basic"
+	if spec.secondary {
+		kind = "secondary"
+	} else if spec.full {
+		kind = "full"
+	}
+
+	order := "le"
+	if spec.bigEndian {
+		order = "be"
+	}
+
+	return fmt.Sprintf("meta-%s-a%d-%s", kind, spec.numAreas, order)
+}
+
+// The expected parse results of a test vector.
+type MetaVectorTlv struct {
+	Type   int    `json:"type"`
+	Name   string `json:"name"`
+	Offset int    `json:"offset"` // Offset of the TLV header.
+	Data   string `json:"data"`   // Hex.
+}
+
+type MetaVectorArea struct {
+	Id     int `json:"id"`
+	Device int `json:"device"`
+	Offset int `json:"offset"`
+	Size   int `json:"size"`
+}
+
+type MetaVector struct {
+	File      string           `json:"file"`
+	ByteOrder string           `json:"byte_order"`
+	Version   int              `json:"version"`
+	Size      int              `json:"size"`
+	HasHash   bool             `json:"has_hash"`
+	Tlvs      []MetaVectorTlv  `json:"tlvs"`
+	Areas     []MetaVectorArea `json:"flash_areas"`
+
+	Hash      string  `json:"hash,omitempty"`
+	Salt      string  `json:"salt,omitempty"`
+	Serial    *uint64 `json:"serial,omitempty"`
+	Crc       *uint32 `json:"crc,omitempty"`
+	RegionCrc *uint32 `json:"region_crc,omitempty"`
+}
+
+type MetaVectorSet struct {
+	HashInput string       `json:"hash_input"`
+	Vectors   []MetaVector `json:"vectors"`
+}
+
+// Returns the layouts of every test vector.
+func metaVectorSpecs() []metaVectorSpec {
+	specs := []metaVectorSpec{}
+	for _, bigEndian := range []bool{false, true} {
+		for _, numAreas := range []int{1, 4, 16} {
+			specs = append(specs,
+				metaVectorSpec{numAreas: numAreas, bigEndian: bigEndian},
+				metaVectorSpec{numAreas: numAreas, full: true,
+					bigEndian: bigEndian})
+			if numAreas > 1 {
+				specs = append(specs, metaVectorSpec{numAreas: numAreas,
+					secondary: true, bigEndian: bigEndian})
+			}
+		}
+	}
+
+	return specs
+}
+
+// Creates a flash map with the specified number of areas.  The first is the
+// boot area; the others alternate between devices 0 and 1.
+func metaVectorFlashMap(numAreas int) (flash.FlashMap, error) {
+	areas := []flash.FlashArea{
+		{
+			Name:   flash.FLASH_AREA_NAME_BOOTLOADER,
+			Id:     0,
+			Device: 0,
+			Offset: 0,
+			Size:   0x4000,
+		},
+	}
+	for i := 1; i < numAreas; i++ {
+		areas = append(areas, flash.FlashArea{
+			Name:   fmt.Sprintf("FLASH_AREA_VECTOR_%d", i),
+			Id:     i,
+			Device: (i + 1) % 2,
+			Offset: 0x4000 * (i + 1),
+			Size:   0x1000 * i,
+		})
+	}
+
+	return flash.NewFlashMap(areas)
+}
+
+func swap16(data []byte) {
+	binary.BigEndian.PutUint16(data, binary.LittleEndian.Uint16(data))
+}
+
+func swap32(data []byte) {
+	binary.BigEndian.PutUint32(data, binary.LittleEndian.Uint32(data))
+}
+
+// Converts the multi-byte fields of a little endian region to big endian.
+// The integrity values are recalculated afterwards.  TLV offsets are relative
+// to the start of the region.
+func swapMetaRegion(region []byte, tlvs []MetaTlvLayout) {
+	for _, tlv := range tlvs {
+		data := region[tlv.Offset+2 : tlv.Offset+tlv.Size]
+
+		switch tlv.Type {
+		case META_TLV_CODE_FLASH_AREA:
+			swap16(data[2:])
+			swap32(data[4:])
+			swap32(data[8:])
+
+		case META_TLV_CODE_CHAIN:
+			swap16(data[2:])
+			swap32(data[4:])
+
+		case META_TLV_CODE_SERIAL:
+			binary.BigEndian.PutUint64(data, binary.LittleEndian.Uint64(data))
+
+		case META_TLV_CODE_PLACEHOLDER:
+			swap16(data[2:])
+
+		case META_TLV_CODE_VERIFY_BLOCK:
+			swap32(data[0:])
+			swap32(data[4:])
+
+		case META_TLV_CODE_COMPRESSION:
+			swap16(data[2:])
+			swap32(data[4:])
+		}
+	}
+
+	// Header padding and footer.
+	swap16(region[2:])
+	footer := region[len(region)-META_FOOTER_SZ:]
+	swap16(footer[0:])
+	swap16(footer[2:])
+	swap32(footer[4:])
+}
+
+// Builds a single test vector and its expected parse results.
+func buildMetaVector(spec metaVectorSpec) (MetaVector, []byte, error) {
+	vec := MetaVector{
+		File:      spec.name() + ".bin",
+		ByteOrder: "little",
+		HasHash:   !spec.secondary,
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if spec.bigEndian {
+		vec.ByteOrder = "big"
+		order = binary.BigEndian
+	}
+
+	fm, err := metaVectorFlashMap(spec.numAreas)
+	if err != nil {
+		return vec, nil, err
+	}
+
+	params := metaParams{
+		bootArea:      flash.FLASH_AREA_NAME_BOOTLOADER,
+		eraseVal:      flash.ERASE_VAL_DFLT,
+		chainEraseVal: flash.ERASE_VAL_DFLT,
+	}
+	if spec.full {
+		license, _ := encodeLicense(metaVectorLicense, metaVectorCopyright)
+		serial := metaVectorSerial
+
+		params.withCrc = true
+		params.withRegionCrc = true
+		params.salt = metaVectorSalt
+		params.license = license
+		params.serial = &serial
+	}
+
+	var region []byte
+	var layout MetaLayout
+	if spec.secondary {
+		params.withRegionCrc = true
+		params.chainArea = fmt.Sprintf("FLASH_AREA_VECTOR_%d",
+			spec.numAreas-1)
+		region, layout, err = buildChainMeta(fm, params)
+	} else {
+		region, layout, err = buildMeta(fm, params)
+	}
+	if err != nil {
+		return vec, nil, err
+	}
+
+	// Make every offset relative to the start of the region.
+	rel := func(off int) int {
+		if off == 0 {
+			return 0
+		}
+		return off - layout.Offset
+	}
+	tlvs := make([]MetaTlvLayout, len(layout.Tlvs))
+	for i, tlv := range layout.Tlvs {
+		tlvs[i] = tlv
+		tlvs[i].Offset = rel(tlv.Offset)
+	}
+	hashOff := rel(layout.HashOffset)
+	crcOff := rel(layout.CrcOffset)
+	regionCrcOff := rel(layout.RegionCrcOffset)
+
+	if spec.bigEndian {
+		swapMetaRegion(region, tlvs)
+	}
+
+	// Fill in the integrity values in the order newt calculates them; each
+	// is calculated with the ones that follow it still zeroed.
+	if regionCrcOff != 0 {
+		zeroField(region, regionCrcOff, META_TLV_REGION_CRC_SZ)
+	}
+	if !spec.secondary {
+		hash := calcMetaHash([][]byte{region}, params.salt)
+		copy(region[hashOff:], hash)
+		vec.Hash = hex.EncodeToString(hash)
+	}
+	if crcOff != 0 {
+		crc := calcMetaCrc([][]byte{region})
+		order.PutUint32(region[crcOff:], crc)
+		vec.Crc = &crc
+	}
+	if regionCrcOff != 0 {
+		crc := calcRegionCrc(region, 0, regionCrcOff)
+		order.PutUint32(region[regionCrcOff:], crc)
+		vec.RegionCrc = &crc
+	}
+
+	vec.Version = int(region[0])
+	vec.Size = len(region)
+	for _, tlv := range tlvs {
+		vec.Tlvs = append(vec.Tlvs, MetaVectorTlv{
+			Type:   int(region[tlv.Offset]),
+			Name:   metaTlvName(uint8(tlv.Type)),
+			Offset: tlv.Offset,
+			Data: hex.EncodeToString(
+				region[tlv.Offset+2 : tlv.Offset+tlv.Size]),
+		})
+	}
+	for _, area := range fm.SortedAreas() {
+		vec.Areas = append(vec.Areas, MetaVectorArea{
+			Id:     area.Id,
+			Device: area.Device,
+			Offset: area.Offset,
+			Size:   area.Size,
+		})
+	}
+	if len(params.salt) > 0 {
+		vec.Salt = hex.EncodeToString(params.salt)
+	}
+	vec.Serial = params.serial
+
+	return vec, region, nil
+}
+
+// Parses a little endian test vector and ensures the results match its
+// description.  newt only parses little endian regions, so big endian
+// vectors are not checked.
+func checkMetaVector(vec MetaVector, region []byte) error {
+	if vec.ByteOrder != "little" {
+		return nil
+	}
+
+	fail := func(format string, args ...interface{}) error {
+		return util.FmtNewtError("Test vector %s: %s", vec.File,
+			fmt.Sprintf(format, args...))
+	}
+
+	var meta Meta
+	if vec.HasHash {
+		var err error
+		meta, err = ParseMeta(region)
+		if err != nil {
+			return fail("%s", err.Error())
+		}
+	} else {
+		var ok bool
+		meta, ok = parseMetaAt(region, len(region))
+		if !ok {
+			return fail("failed to parse")
+		}
+		if err := meta.verifyRegionCrc(region); err != nil {
+			return fail("%s", err.Error())
+		}
+	}
+
+	if meta.Offset != 0 || meta.Size != vec.Size ||
+		int(meta.Version) != vec.Version {
+
+		return fail("region mismatch; offset=%d size=%d version=%d",
+			meta.Offset, meta.Size, meta.Version)
+	}
+
+	if len(meta.Tlvs) != len(vec.Tlvs) {
+		return fail("TLV count mismatch; expected=%d actual=%d",
+			len(vec.Tlvs), len(meta.Tlvs))
+	}
+	for i, tlv := range meta.Tlvs {
+		exp := vec.Tlvs[i]
+		if int(metaTlvToWire(tlv.Type)) != exp.Type ||
+			tlv.Offset != exp.Offset ||
+			hex.EncodeToString(tlv.Data) != exp.Data {
+
+			return fail("TLV %d mismatch", i)
+		}
+	}
+
+	fm, err := meta.FlashMap()
+	if err != nil {
+		return fail("%s", err.Error())
+	}
+	areas := fm.SortedAreas()
+	if len(areas) != len(vec.Areas) {
+		return fail("flash area count mismatch; expected=%d actual=%d",
+			len(vec.Areas), len(areas))
+	}
+	for i, area := range areas {
+		exp := vec.Areas[i]
+		if area.Id != exp.Id || area.Device != exp.Device ||
+			area.Offset != exp.Offset || area.Size != exp.Size {
+
+			return fail("flash area %d mismatch", area.Id)
+		}
+	}
+
+	return nil
+}
+
+// Writes a set of meta region test vectors to the specified directory: one
+// binary file per vector, and a JSON file describing each vector's expected
+// parse results.  Each little endian vector is parsed back and checked
+// against its description before anything is written.
+//
+// @return                      path-of-json-file, vectors, error
+func WriteMetaVectors(dir string) (string, []MetaVector, error) {
+	set := MetaVectorSet{
+		HashInput: metaVectorHashInput,
+	}
+	regions := [][]byte{}
+
+	for _, spec := range metaVectorSpecs() {
+		vec, region, err := buildMetaVector(spec)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := checkMetaVector(vec, region); err != nil {
+			return "", nil, err
+		}
+
+		set.Vectors = append(set.Vectors, vec)
+		regions = append(regions, region)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", nil, util.ChildNewtError(err)
+	}
+
+	for i, vec := range set.Vectors {
+		path := filepath.Join(dir, vec.File)
+		if err := ioutil.WriteFile(path, regions[i], 0644); err != nil {
+			return "", nil, util.ChildNewtError(err)
+		}
+	}
+
+	buf, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return "", nil, util.ChildNewtError(err)
+	}
+
+	jsonPath := filepath.Join(dir, META_VECTORS_JSON_NAME)
+	if err := ioutil.WriteFile(jsonPath, append(buf, '\n'), 0644); err != nil {
+		return "", nil, util.ChildNewtError(err)
+	}
+
+	return jsonPath, set.Vectors, nil
+}
@@ -0,0 +1,164 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMetaVectorSpecName(t *testing.T) {
+	tests := []struct {
+		spec metaVectorSpec
+		want string
+	}{
+		{metaVectorSpec{numAreas: 1}, "meta-basic-a1-le"},
+		{metaVectorSpec{numAreas: 4, full: true}, "meta-full-a4-le"},
+		{metaVectorSpec{numAreas: 16, secondary: true, bigEndian: true},
+			"meta-secondary-a16-be"},
+	}
+
+	for _, test := range tests {
+		if got := test.spec.name(); got != test.want {
+			t.Errorf("got name %s; want %s", got, test.want)
+		}
+	}
+}
+
+func TestWriteMetaVectors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-mfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	jsonPath, vectors, err := WriteMetaVectors(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) != len(metaVectorSpecs()) {
+		t.Fatalf("got %d vectors; want %d", len(vectors),
+			len(metaVectorSpecs()))
+	}
+
+	buf, err := ioutil.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := MetaVectorSet{}
+	if err := json.Unmarshal(buf, &set); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Vectors) != len(vectors) {
+		t.Errorf("JSON describes %d vectors; want %d", len(set.Vectors),
+			len(vectors))
+	}
+
+	files := map[string]bool{}
+	for _, vec := range vectors {
+		if files[vec.File] {
+			t.Errorf("%s: duplicate vector file", vec.File)
+		}
+		files[vec.File] = true
+
+		region, err := ioutil.ReadFile(filepath.Join(dir, vec.File))
+		if err != nil {
+			t.Errorf("%s: %s", vec.File, err.Error())
+			continue
+		}
+		if len(region) != vec.Size {
+			t.Errorf("%s: file size %d; want %d", vec.File, len(region),
+				vec.Size)
+		}
+
+		var order binary.ByteOrder = binary.LittleEndian
+		if vec.ByteOrder == "big" {
+			order = binary.BigEndian
+		}
+		if magic := order.Uint32(region[len(region)-4:]); magic !=
+			META_MAGIC {
+
+			t.Errorf("%s: footer magic 0x%08x; want 0x%08x", vec.File,
+				magic, META_MAGIC)
+		}
+		if vec.HasHash != (vec.Hash != "") {
+			t.Errorf("%s: has_hash=%t but hash=\"%s\"", vec.File,
+				vec.HasHash, vec.Hash)
+		}
+	}
+}
+
+func TestCheckMetaVector(t *testing.T) {
+	vec, region, err := buildMetaVector(metaVectorSpec{numAreas: 4,
+		full: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkMetaVector(vec, region); err != nil {
+		t.Fatalf("unmodified vector: %s", err.Error())
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(vec *MetaVector, region []byte)
+		wantErr string
+	}{
+		{
+			name: "corrupt region",
+			modify: func(vec *MetaVector, region []byte) {
+				region[vec.Tlvs[0].Offset+2] ^= 0xff
+			},
+			wantErr: vec.File,
+		},
+		{
+			name: "wrong TLV count",
+			modify: func(vec *MetaVector, region []byte) {
+				vec.Tlvs = vec.Tlvs[1:]
+			},
+			wantErr: "TLV count mismatch",
+		},
+		{
+			name: "wrong flash area",
+			modify: func(vec *MetaVector, region []byte) {
+				vec.Areas[0].Size++
+			},
+			wantErr: "flash area 0 mismatch",
+		},
+	}
+
+	for _, test := range tests {
+		v := vec
+		v.Tlvs = append([]MetaVectorTlv{}, vec.Tlvs...)
+		v.Areas = append([]MetaVectorArea{}, vec.Areas...)
+		r := append([]byte{}, region...)
+		test.modify(&v, r)
+
+		err := checkMetaVector(v, r)
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: expected error containing \"%s\"; got %v",
+				test.name, test.wantErr, err)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/util"
+)
+
+// A single discrepancy detected while verifying a manufacturing image.  Area
+// is empty if the problem does not pertain to a particular flash area.
+type VerifyProblem struct {
+	Area string
+	Text string
+}
+
+func (p VerifyProblem) String() string {
+	if p.Area == "" {
+		return p.Text
+	}
+	return fmt.Sprintf("%s: %s", p.Area, p.Text)
+}
+
+func (mi *MfgImage) readManifest() (mfgManifest, error) {
+	manifest := mfgManifest{}
+
+	data, err := ioutil.ReadFile(mi.ManifestPath())
+	if err != nil {
+		return manifest, util.FmtNewtError(
+			"Failed to read mfg manifest file: %s", err.Error())
+	}
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, util.FmtNewtError(
+			"Failed to decode mfg manifest file \"%s\": %s",
+			mi.ManifestPath(), err.Error())
+	}
+
+	return manifest, nil
+}
+
+// Returns the paths of the section files produced by a previous "mfg
+// create", in ascending order of section index.
+func (mi *MfgImage) sectionPaths() []string {
+	ids := mi.sectionIds()
+	paths := make([]string, len(ids))
+	for i, id := range ids {
+		paths[i] = mi.sectionBinPath(id)
+	}
+
+	return paths
+}
+
+// Returns the size of each of the specified files.
+func fileSizes(paths []string) ([]int, error) {
+	sizes := make([]int, len(paths))
+	for i, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"Failed to read mfg section file: %s", err.Error())
+		}
+		sizes[i] = int(info.Size())
+	}
+
+	return sizes, nil
+}
+
+// Returns the offset just past the last byte of section 0 that may contain
+// meta region data.  Only this leading portion of the section is read into
+// memory in order to parse the meta region.
+func (mi *MfgImage) metaWindowEnd() int {
+	end := 0
+	for _, name := range []string{mi.metaAreaName(), mi.metaChainArea} {
+		if area, ok := mi.bsp.FlashMap.Areas[name]; ok {
+			end = util.IntMax(end, area.Offset+area.Size)
+		}
+	}
+
+	return end
+}
+
+func findMetaTlv(meta Meta, typ uint8) *MetaTlv {
+	for i, _ := range meta.Tlvs {
+		if meta.Tlvs[i].Type == typ {
+			return &meta.Tlvs[i]
+		}
+	}
+
+	return nil
+}
+
+// Compares each of the BSP's flash areas against the corresponding flash area
+// TLV in the meta region.
+func verifyAreas(expected flash.FlashMap, meta Meta) ([]VerifyProblem, error) {
+	problems := []VerifyProblem{}
+
+	actual, err := meta.FlashMap()
+	if err != nil {
+		return nil, err
+	}
+
+	actualById := map[int]flash.FlashArea{}
+	for _, area := range actual.Areas {
+		actualById[area.Id] = area
+	}
+
+	for _, area := range expected.SortedAreas() {
+		tlvArea, ok := actualById[area.Id]
+		if !ok {
+			problems = append(problems, VerifyProblem{area.Name,
+				"missing from meta region"})
+			continue
+		}
+		delete(actualById, area.Id)
+
+		if tlvArea.Device != area.Device {
+			problems = append(problems, VerifyProblem{area.Name,
+				fmt.Sprintf("device mismatch; expected=%d actual=%d",
+					area.Device, tlvArea.Device)})
+		}
+		if tlvArea.Offset != area.Offset {
+			problems = append(problems, VerifyProblem{area.Name,
+				fmt.Sprintf("offset mismatch; expected=0x%x actual=0x%x",
+					area.Offset, tlvArea.Offset)})
+		}
+		if tlvArea.Size != area.Size {
+			problems = append(problems, VerifyProblem{area.Name,
+				fmt.Sprintf("size mismatch; expected=%d actual=%d",
+					area.Size, tlvArea.Size)})
+		}
+	}
+
+	for _, area := range actual.SortedAreas() {
+		if _, ok := actualById[area.Id]; ok {
+			problems = append(problems, VerifyProblem{area.Name,
+				"present in meta region but not in BSP flash map"})
+		}
+	}
+
+	return problems, nil
+}
+
+// Ensures no section extends past the last flash area of its device.
+func (mi *MfgImage) verifySectionSizes(sizes []int) []VerifyProblem {
+	problems := []VerifyProblem{}
+
+	areasByDevice := mi.bsp.FlashMap.AreasByDevice()
+	for i, id := range mi.sectionIds() {
+		end := 0
+		for _, area := range areasByDevice[id] {
+			end = util.IntMax(end, area.Offset+area.Size)
+		}
+
+		if sizes[i] > end {
+			problems = append(problems, VerifyProblem{"",
+				fmt.Sprintf("section %d too large for device; "+
+					"section-size=%d device-size=%d",
+					id, sizes[i], end)})
+		}
+	}
+
+	return problems
+}
+
+// Indicates whether the HMAC TLV of a manufacturing image matches the
+// specified key.  The section files must be supplied in ascending order of
+// index; meta is the parsed meta region of section 0.  An error is returned
+// if the meta region has no HMAC TLV or a section file cannot be read.
+func VerifyMetaHmac(paths []string, meta Meta, key []byte) (bool, error) {
+	hmacTlv := findMetaTlv(meta, META_TLV_CODE_HMAC)
+	if hmacTlv == nil {
+		return false, util.NewNewtError(
+			"Meta region does not contain an HMAC TLV")
+	}
+
+	mac, err := streamMetaHmac(paths, hashZeroWindows(meta), key)
+	if err != nil {
+		return false, err
+	}
+
+	return hmac.Equal(mac, hmacTlv.Data), nil
+}
+
+// Re-checks a previously created manufacturing image against its manifest
+// and the BSP's flash map.  Decoding and I/O failures are returned as an
+// error; each discrepancy in the image itself is reported as a problem.
+//
+// The section files are streamed through the hash rather than read into
+// memory, so arbitrarily large images can be verified.
+func (mi *MfgImage) Verify() ([]VerifyProblem, error) {
+	manifest, err := mi.readManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	paths := mi.sectionPaths()
+	sizes, err := fileSizes(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := readFileHead(paths[0], mi.metaWindowEnd())
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := ParseMeta(head)
+	if err != nil {
+		return nil, err
+	}
+	windows := hashZeroWindows(meta)
+
+	problems := []VerifyProblem{}
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems,
+			VerifyProblem{"", fmt.Sprintf(format, args...)})
+	}
+
+	if err := meta.CheckOrder(mi.metaOrder); err != nil {
+		addProblem("%s", err.Error())
+	}
+
+	if meta.Offset != manifest.MetaOffset {
+		addProblem("meta region offset mismatch; manifest=0x%x actual=0x%x",
+			manifest.MetaOffset, meta.Offset)
+	}
+
+	// The expected layout depends on whether the image was created with an
+	// HMAC, not on whether a key was supplied for verification.
+	params := mi.metaParams()
+	params.withHmac = findMetaTlv(meta, META_TLV_CODE_HMAC) != nil
+	params.withCrc = findMetaTlv(meta, META_TLV_CODE_CRC) != nil
+	params.withRegionCrc =
+		findMetaTlv(meta, META_TLV_CODE_REGION_CRC) != nil
+	params.salt = nil
+	if saltTlv := findMetaTlv(meta, META_TLV_CODE_SALT); saltTlv != nil {
+		params.salt = saltTlv.Data
+	}
+	params.verifyBlock = findMetaTlv(meta, META_TLV_CODE_VERIFY_BLOCK) != nil
+	params.compressAlgo = META_COMPRESS_NONE
+	params.compressDictId = 0
+	compressTlv := findMetaTlv(meta, META_TLV_CODE_COMPRESSION)
+	if compressTlv != nil && len(compressTlv.Data) == META_TLV_COMPRESSION_SZ {
+		params.compressAlgo = compressTlv.Data[0]
+		params.compressDictId = binary.LittleEndian.Uint32(compressTlv.Data[4:])
+	}
+	serialTlv := findMetaTlv(meta, META_TLV_CODE_SERIAL)
+	if serialTlv != nil && len(serialTlv.Data) == META_TLV_SERIAL_SZ {
+		serial := binary.LittleEndian.Uint64(serialTlv.Data)
+		params.serial = &serial
+	}
+	_, layout, err := buildMeta(mi.bsp.FlashMap, params)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Size != layout.Size {
+		addProblem("meta region size mismatch; expected=%d actual=%d",
+			layout.Size, meta.Size)
+	}
+
+	hashTlv := findMetaTlv(meta, META_TLV_CODE_HASH)
+	if hashTlv == nil {
+		addProblem("meta region does not contain a hash TLV")
+	} else {
+		rawHash, err := streamMetaHash(paths, windows, params.salt)
+		if err != nil {
+			return nil, err
+		}
+
+		// A sealed image stores the sealing tool's output rather than the
+		// digest.  The seal cannot be recalculated; it is compared against
+		// the manifest instead.
+		hash := hex.EncodeToString(rawHash)
+		if manifest.MfgSeal != "" {
+			if manifest.MfgSeal != hex.EncodeToString(hashTlv.Data) {
+				addProblem("seal mismatch; meta=%x manifest=%s",
+					hashTlv.Data, manifest.MfgSeal)
+			}
+		} else if hash != hex.EncodeToString(hashTlv.Data) {
+			addProblem("hash mismatch; meta=%x calculated=%s",
+				hashTlv.Data, hash)
+		}
+		if hash != manifest.MfgHash {
+			addProblem("hash mismatch; manifest=%s calculated=%s",
+				manifest.MfgHash, hash)
+		}
+	}
+
+	if mi.hmacKey != nil {
+		if findMetaTlv(meta, META_TLV_CODE_HMAC) == nil {
+			addProblem("meta region does not contain an HMAC TLV")
+		} else {
+			ok, err := VerifyMetaHmac(paths, meta, mi.hmacKey)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				addProblem("HMAC mismatch")
+			}
+		}
+	}
+
+	if crcTlv := findMetaTlv(meta, META_TLV_CODE_CRC); crcTlv != nil {
+		if len(crcTlv.Data) != META_TLV_CRC_SZ {
+			addProblem("CRC TLV has invalid size: %d", len(crcTlv.Data))
+		} else {
+			crc, err := streamMetaCrc(paths, crcZeroWindows(meta))
+			if err != nil {
+				return nil, err
+			}
+
+			stored := binary.LittleEndian.Uint32(crcTlv.Data)
+			if crc != stored {
+				addProblem("CRC mismatch; meta=%08x calculated=%08x",
+					stored, crc)
+			}
+			if manifest.MfgCrc != "" &&
+				manifest.MfgCrc != fmt.Sprintf("%08x", crc) {
+
+				addProblem("CRC mismatch; manifest=%s calculated=%08x",
+					manifest.MfgCrc, crc)
+			}
+		}
+	}
+
+	if off := meta.verifyBlockOffset(); off >= 0 {
+		vb, err := readVerifyBlock(paths[0], off)
+		if err != nil {
+			addProblem("%s", err.Error())
+		} else if hex.EncodeToString(vb.Hash) != manifest.MfgHash {
+			addProblem("verification block hash mismatch; block=%x "+
+				"manifest=%s", vb.Hash, manifest.MfgHash)
+		}
+	} else if mi.verifyBlock {
+		addProblem("meta region does not contain a verification block TLV")
+	}
+
+	areaProblems, err := verifyAreas(mi.bsp.FlashMap, meta)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, areaProblems...)
+	problems = append(problems, mi.verifySectionSizes(sizes)...)
+
+	return problems, nil
+}
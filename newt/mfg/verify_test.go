@@ -0,0 +1,163 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/pkg"
+)
+
+func TestVerifyAreas(t *testing.T) {
+	_, meta, _ := testInsertAndParse(t, testMetaParams())
+
+	img0 := flash.FLASH_AREA_NAME_IMAGE_0
+
+	tests := []struct {
+		name   string
+		modify func(areas map[string]flash.FlashArea)
+		area   string
+		want   string
+	}{
+		{"unmodified", func(areas map[string]flash.FlashArea) {}, "", ""},
+		{
+			"offset",
+			func(areas map[string]flash.FlashArea) {
+				a := areas[img0]
+				a.Offset += 0x100
+				areas[img0] = a
+			},
+			img0, "offset mismatch",
+		},
+		{
+			"size",
+			func(areas map[string]flash.FlashArea) {
+				a := areas[img0]
+				a.Size -= 0x100
+				areas[img0] = a
+			},
+			img0, "size mismatch",
+		},
+		{
+			"device",
+			func(areas map[string]flash.FlashArea) {
+				a := areas["FLASH_AREA_DATA"]
+				a.Device = 2
+				areas["FLASH_AREA_DATA"] = a
+			},
+			"FLASH_AREA_DATA", "device mismatch",
+		},
+		{
+			"area added to BSP",
+			func(areas map[string]flash.FlashArea) {
+				areas["FLASH_AREA_NEW"] = flash.FlashArea{
+					Name:   "FLASH_AREA_NEW",
+					Id:     20,
+					Device: 0,
+					Offset: 0xa000,
+					Size:   0x1000,
+				}
+			},
+			"FLASH_AREA_NEW", "missing from meta region",
+		},
+		{
+			"area removed from BSP",
+			func(areas map[string]flash.FlashArea) {
+				delete(areas, testChainArea)
+			},
+			// The meta region only records the area's ID, from which its
+			// name is derived.
+			"FLASH_AREA_USER_0", "not in BSP flash map",
+		},
+	}
+
+	for _, test := range tests {
+		areas := map[string]flash.FlashArea{}
+		for _, area := range testFlashMap(t).SortedAreas() {
+			areas[area.Name] = area
+		}
+		test.modify(areas)
+
+		list := []flash.FlashArea{}
+		for _, area := range areas {
+			list = append(list, area)
+		}
+		fm, err := flash.NewFlashMap(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		problems, err := verifyAreas(fm, meta)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+
+		if test.want == "" {
+			if len(problems) != 0 {
+				t.Errorf("%s: unexpected problems: %v", test.name, problems)
+			}
+			continue
+		}
+
+		if len(problems) != 1 {
+			t.Errorf("%s: got %d problems; want 1: %v", test.name,
+				len(problems), problems)
+			continue
+		}
+		if problems[0].Area != test.area ||
+			!strings.Contains(problems[0].Text, test.want) {
+
+			t.Errorf("%s: problem \"%s\"; want %s: ...%s...", test.name,
+				problems[0].String(), test.area, test.want)
+		}
+	}
+}
+
+func TestVerifySectionSizes(t *testing.T) {
+	// A raw entry places data in section 1.
+	mi := &MfgImage{
+		bsp:        &pkg.BspPackage{FlashMap: testFlashMap(t)},
+		rawEntries: []MfgRawEntry{{device: 1}},
+	}
+
+	// Device 0 ends with the chain area at 0x9000; device 1 with the data
+	// area at 0x1000.
+	tests := []struct {
+		name  string
+		sizes []int
+		want  int
+	}{
+		{"fits", []int{0x9000, 0x1000}, 0},
+		{"smaller", []int{0x4000, 0x800}, 0},
+		{"section 0 too large", []int{0x9001, 0x1000}, 1},
+		{"both too large", []int{0xa000, 0x2000}, 2},
+	}
+
+	for _, test := range tests {
+		problems := mi.verifySectionSizes(test.sizes)
+		if len(problems) != test.want {
+			t.Errorf("%s: got %d problems; want %d: %v", test.name,
+				len(problems), test.want, problems)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+
+	"mynewt.apache.org/newt/newt/image"
+	"mynewt.apache.org/newt/util"
+)
+
+// A manufacturing image can end with a verification block
+// (mfg.verify_block): a small record placed immediately after the last
+// populated byte of section 0 that lets an end-of-line tester confirm what
+// was programmed without parsing the meta region.  The block holds the
+// manufacturing hash and the build ID of the first image, and is protected
+// by its own CRC.  The meta region's verification block TLV records the
+// block's location.  Since the block contains the hash, the hash, HMAC, and
+// CRC treat the block as zeros.
+//
+// Block layout (little endian):
+//     magic     uint32  MFG_VERIFY_BLOCK_MAGIC
+//     version   uint8   MFG_VERIFY_BLOCK_VERSION
+//     pad8      uint8   Erase value of section 0.
+//     size      uint16  MFG_VERIFY_BLOCK_SZ
+//     hash      [32]    Manufacturing hash (unsealed).
+//     build_id  [32]    Build ID of image 0, zero-padded; zeros if none.
+//     crc       uint32  CRC32 (IEEE) of all preceding block bytes.
+
+const MFG_VERIFY_BLOCK_MAGIC = 0x4b4c4256 // "VBLK"
+const MFG_VERIFY_BLOCK_VERSION = 1
+const MFG_VERIFY_BLOCK_BUILD_ID_SZ = 32
+const MFG_VERIFY_BLOCK_SZ = 8 + META_HASH_SZ + MFG_VERIFY_BLOCK_BUILD_ID_SZ + 4
+
+// Required alignment of the block's offset within section 0.
+const MFG_VERIFY_BLOCK_ALIGN = 4
+
+// The decoded contents of a verification block.
+type VerifyBlock struct {
+	Offset  int
+	Hash    []byte
+	BuildId []byte
+	Crc     uint32
+}
+
+func encodeVerifyBlock(hash []byte, buildId []byte, eraseVal byte) []byte {
+	buf := &bytes.Buffer{}
+
+	binary.Write(buf, binary.LittleEndian, uint32(MFG_VERIFY_BLOCK_MAGIC))
+	buf.WriteByte(MFG_VERIFY_BLOCK_VERSION)
+	buf.WriteByte(eraseVal)
+	binary.Write(buf, binary.LittleEndian, uint16(MFG_VERIFY_BLOCK_SZ))
+
+	field := make([]byte, META_HASH_SZ)
+	copy(field, hash)
+	buf.Write(field)
+
+	field = make([]byte, MFG_VERIFY_BLOCK_BUILD_ID_SZ)
+	copy(field, buildId)
+	buf.Write(field)
+
+	binary.Write(buf, binary.LittleEndian, crc32.ChecksumIEEE(buf.Bytes()))
+
+	return buf.Bytes()
+}
+
+// Decodes a verification block and checks its magic, size, and CRC.
+func ParseVerifyBlock(data []byte, offset int) (VerifyBlock, error) {
+	vb := VerifyBlock{Offset: offset}
+
+	if len(data) < MFG_VERIFY_BLOCK_SZ {
+		return vb, util.FmtNewtError(
+			"Verification block at offset 0x%x truncated; size=%d "+
+				"expected=%d", offset, len(data), MFG_VERIFY_BLOCK_SZ)
+	}
+	data = data[:MFG_VERIFY_BLOCK_SZ]
+
+	magic := binary.LittleEndian.Uint32(data[0:])
+	if magic != MFG_VERIFY_BLOCK_MAGIC {
+		return vb, util.FmtNewtError(
+			"Verification block at offset 0x%x has bad magic; "+
+				"expected=0x%08x actual=0x%08x",
+			offset, MFG_VERIFY_BLOCK_MAGIC, magic)
+	}
+	if size := binary.LittleEndian.Uint16(data[6:]); size !=
+		MFG_VERIFY_BLOCK_SZ {
+
+		return vb, util.FmtNewtError(
+			"Verification block at offset 0x%x has invalid size: %d",
+			offset, size)
+	}
+
+	crcOff := MFG_VERIFY_BLOCK_SZ - 4
+	vb.Crc = binary.LittleEndian.Uint32(data[crcOff:])
+	if calc := crc32.ChecksumIEEE(data[:crcOff]); calc != vb.Crc {
+		return vb, util.FmtNewtError(
+			"Verification block at offset 0x%x CRC mismatch; "+
+				"stored=%08x calculated=%08x", offset, vb.Crc, calc)
+	}
+
+	vb.Hash = data[8 : 8+META_HASH_SZ]
+	vb.BuildId = data[8+META_HASH_SZ : crcOff]
+
+	return vb, nil
+}
+
+// Returns the offset of the verification block of the meta region, or -1 if
+// the region has no verification block TLV.
+func (meta Meta) verifyBlockOffset() int {
+	tlv := findMetaTlv(meta, META_TLV_CODE_VERIFY_BLOCK)
+	if tlv == nil || len(tlv.Data) != META_TLV_VERIFY_BLOCK_SZ {
+		return -1
+	}
+
+	return int(binary.LittleEndian.Uint32(tlv.Data))
+}
+
+// Returns the window covering the verification block, if any.  The block
+// reads as zeros when the hash, HMAC, and CRC are calculated.
+func verifyBlockZeroWindows(meta Meta) []zeroWindow {
+	off := meta.verifyBlockOffset()
+	if off < 0 {
+		return []zeroWindow{}
+	}
+
+	return []zeroWindow{zeroWindow{off, MFG_VERIFY_BLOCK_SZ}}
+}
+
+// Determines where the verification block goes: after everything that
+// populates section 0, including a chained meta region.
+func (mi *MfgImage) calcVerifyBlockOffset(section0 []byte) (int, error) {
+	end := len(section0)
+	if mi.metaChainArea != "" {
+		area := mi.bsp.FlashMap.Areas[mi.metaChainArea]
+		end = util.IntMax(end, area.Offset+area.Size)
+	}
+	if rem := end % MFG_VERIFY_BLOCK_ALIGN; rem != 0 {
+		end += MFG_VERIFY_BLOCK_ALIGN - rem
+	}
+
+	if capacity := mi.bsp.FlashMap.Capacity(0); capacity > 0 &&
+		end+MFG_VERIFY_BLOCK_SZ > capacity {
+
+		return 0, util.FmtNewtError(
+			"Verification block does not fit in flash device 0; "+
+				"offset=0x%x size=%d capacity=%d",
+			end, MFG_VERIFY_BLOCK_SZ, capacity)
+	}
+
+	if res := mi.bsp.FlashMap.ReserveOverlapping(0, end,
+		MFG_VERIFY_BLOCK_SZ); res != nil {
+
+		return 0, util.FmtNewtError(
+			"Verification block at offset 0x%x overlaps reserved flash "+
+				"region %s", end, res.Name)
+	}
+
+	for _, area := range mi.placeholders() {
+		if area.Device == 0 && end < area.Offset+area.Size &&
+			end+MFG_VERIFY_BLOCK_SZ > area.Offset {
+
+			return 0, util.FmtNewtError(
+				"Verification block at offset 0x%x overlaps placeholder "+
+					"area \"%s\"", end, area.Name)
+		}
+	}
+
+	return end, nil
+}
+
+// Reads the build ID of the first image from its manifest.  Returns nil if
+// the manufacturing image contains no images.
+func (mi *MfgImage) imageBuildId() ([]byte, error) {
+	path := mi.ImageManifestPath(0)
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	manifest := image.ImageManifest{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, util.FmtNewtError(
+			"Failed to decode image manifest \"%s\": %s", path, err.Error())
+	}
+
+	buildId, err := hex.DecodeString(manifest.BuildID)
+	if err != nil {
+		return nil, util.FmtNewtError(
+			"Image manifest \"%s\" contains invalid build ID: %s",
+			path, manifest.BuildID)
+	}
+	if len(buildId) > MFG_VERIFY_BLOCK_BUILD_ID_SZ {
+		buildId = buildId[:MFG_VERIFY_BLOCK_BUILD_ID_SZ]
+	}
+
+	return buildId, nil
+}
+
+// Reads the verification block from the section 0 file of a previously
+// created manufacturing image.
+func readVerifyBlock(section0Path string, offset int) (VerifyBlock, error) {
+	f, err := os.Open(section0Path)
+	if err != nil {
+		return VerifyBlock{}, util.ChildNewtError(err)
+	}
+	defer f.Close()
+
+	data := make([]byte, MFG_VERIFY_BLOCK_SZ)
+	n, _ := f.ReadAt(data, int64(offset))
+
+	return ParseVerifyBlock(data[:n], offset)
+}
@@ -0,0 +1,163 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/pkg"
+)
+
+func TestParseVerifyBlock(t *testing.T) {
+	hash := bytes.Repeat([]byte{0x11}, META_HASH_SZ)
+	buildId := []byte{0xde, 0xad, 0xbe, 0xef}
+	block := encodeVerifyBlock(hash, buildId, flash.ERASE_VAL_DFLT)
+
+	if len(block) != MFG_VERIFY_BLOCK_SZ {
+		t.Fatalf("block size=%d; want %d", len(block), MFG_VERIFY_BLOCK_SZ)
+	}
+
+	vb, err := ParseVerifyBlock(block, 0x100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(vb.Hash, hash) {
+		t.Errorf("hash=%x; want %x", vb.Hash, hash)
+	}
+	if !bytes.Equal(vb.BuildId[:len(buildId)], buildId) ||
+		!bytes.Equal(vb.BuildId[len(buildId):],
+			make([]byte, MFG_VERIFY_BLOCK_BUILD_ID_SZ-len(buildId))) {
+
+		t.Errorf("build ID=%x; want %x, zero-padded", vb.BuildId, buildId)
+	}
+	if vb.Offset != 0x100 {
+		t.Errorf("offset=0x%x; want 0x100", vb.Offset)
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(b []byte) []byte
+	}{
+		{"bad magic", func(b []byte) []byte { b[0] ^= 0xff; return b }},
+		{"bad size", func(b []byte) []byte { b[6]++; return b }},
+		{"bad hash", func(b []byte) []byte { b[8] ^= 0x01; return b }},
+		{"bad crc", func(b []byte) []byte { b[len(b)-1] ^= 0x01; return b }},
+		{"truncated", func(b []byte) []byte { return b[:len(b)-1] }},
+	}
+
+	for _, test := range tests {
+		corrupt := test.corrupt(append([]byte{}, block...))
+		if _, err := ParseVerifyBlock(corrupt, 0); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
+
+func TestMetaVerifyBlockTlv(t *testing.T) {
+	params := testMetaParams()
+	params.verifyBlock = true
+	params.verifyBlockOffset = 0x4000
+	section, meta, _ := testInsertAndParse(t, params)
+
+	tlv := findMetaTlv(meta, META_TLV_CODE_VERIFY_BLOCK)
+	if tlv == nil {
+		t.Fatalf("region contains no verification block TLV")
+	}
+	if size := binary.LittleEndian.Uint32(tlv.Data[4:]); size !=
+		MFG_VERIFY_BLOCK_SZ {
+
+		t.Errorf("TLV block size=%d; want %d", size, MFG_VERIFY_BLOCK_SZ)
+	}
+	if off := meta.verifyBlockOffset(); off != params.verifyBlockOffset {
+		t.Errorf("TLV block offset=0x%x; want 0x%x",
+			off, params.verifyBlockOffset)
+	}
+
+	// The block contains the hash, so the hash treats it as zeros.
+	section = append(section, encodeVerifyBlock(
+		bytes.Repeat([]byte{0x22}, META_HASH_SZ), nil,
+		flash.ERASE_VAL_DFLT)...)
+	zeroed := append([]byte{}, section...)
+	applyZeroWindows(zeroed, 0, verifyBlockZeroWindows(meta))
+	if !bytes.Equal(zeroed[params.verifyBlockOffset:],
+		make([]byte, MFG_VERIFY_BLOCK_SZ)) {
+
+		t.Errorf("verification block not covered by its zero window")
+	}
+	if !bytes.Equal(zeroed[:params.verifyBlockOffset],
+		section[:params.verifyBlockOffset]) {
+
+		t.Errorf("zero window extends before verification block")
+	}
+
+	// Without the option, neither the TLV nor the window exists.
+	_, meta, _ = testInsertAndParse(t, testMetaParams())
+	if meta.verifyBlockOffset() != -1 {
+		t.Errorf("region without verification block has block TLV")
+	}
+	if len(verifyBlockZeroWindows(meta)) != 0 {
+		t.Errorf("region without verification block has zero window")
+	}
+}
+
+func TestCalcVerifyBlockOffset(t *testing.T) {
+	fm := testFlashMap(t)
+
+	tests := []struct {
+		name         string
+		sectionSize  int
+		chainArea    string
+		placeholders []string
+		want         int
+		wantErr      bool
+	}{
+		{"aligned end", 0x4000, "", nil, 0x4000, false},
+		{"unaligned end", 0x4001, "", nil, 0x4004, false},
+		{"after chain area", 0x4000, testChainArea, nil, 0x9000, false},
+		{"overlaps placeholder", 0x4000, "",
+			[]string{flash.FLASH_AREA_NAME_IMAGE_0}, 0, true},
+		{"before placeholder", 0x3000, "",
+			[]string{flash.FLASH_AREA_NAME_IMAGE_0}, 0x3000, false},
+	}
+
+	for _, test := range tests {
+		mi := &MfgImage{
+			bsp:              &pkg.BspPackage{FlashMap: fm},
+			metaChainArea:    test.chainArea,
+			placeholderAreas: test.placeholders,
+		}
+
+		off, err := mi.calcVerifyBlockOffset(make([]byte, test.sectionSize))
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		} else if off != test.want {
+			t.Errorf("%s: offset=0x%x; want 0x%x", test.name, off, test.want)
+		}
+	}
+}
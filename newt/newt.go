@@ -28,6 +28,7 @@ import (
 
 	"mynewt.apache.org/newt/newt/cli"
 	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/syscfg"
 	"mynewt.apache.org/newt/util"
 )
 
@@ -36,6 +37,7 @@ var newtSilent bool
 var newtQuiet bool
 var newtVerbose bool
 var newtLogFile string
+var newtBuildLogFile string
 
 func newtCmd() *cobra.Command {
 	newtHelpText := cli.FormatHelp(`Newt allows you to create your own embedded 
@@ -79,6 +81,12 @@ func newtCmd() *cobra.Command {
 			if err != nil {
 				cli.NewtUsage(nil, err)
 			}
+
+			if newtBuildLogFile != "" {
+				if err := util.OpenLogFile(newtBuildLogFile); err != nil {
+					cli.NewtUsage(nil, err)
+				}
+			}
 		},
 		Run: func(cmd *cobra.Command, args []string) {
 			cmd.Help()
@@ -95,6 +103,14 @@ func newtCmd() *cobra.Command {
 		"WARN", "Log level")
 	newtCmd.PersistentFlags().StringVarP(&newtLogFile, "outfile", "o",
 		"", "Filename to tee output to")
+	newtCmd.PersistentFlags().StringVarP(&newtBuildLogFile, "log-file", "",
+		"", "Filename to write a copy of all output to; the file is "+
+			"replaced atomically when newt exits")
+	newtCmd.PersistentFlags().BoolVarP(&newtutil.PhaseTimingEnabled,
+		"timing", "", false, "Report the time spent in each build phase")
+	newtCmd.PersistentFlags().StringVarP(&syscfg.OverrideFlag, "syscfg", "",
+		"", "Syscfg overrides (NAME=VALUE[:NAME=VALUE...]); these take "+
+			"precedence over $"+syscfg.SYSCFG_ENV_PREFIX+"<NAME>")
 
 	versHelpText := cli.FormatHelp(`Display the Newt version number.`)
 	versHelpEx := "  newt version"
@@ -144,4 +160,12 @@ func main() {
 	}
 
 	cmd.Execute()
+
+	if timingText := newtutil.PhaseTimingText(); timingText != "" {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s", timingText)
+	}
+
+	if err := util.CloseLogFile(); err != nil {
+		cli.NewtUsage(nil, err)
+	}
 }
@@ -0,0 +1,83 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package newtutil
+
+import (
+	"fmt"
+	"time"
+)
+
+// Build phase timing.  Disabled by default; when disabled, StartPhase does
+// not read the clock at all.
+var PhaseTimingEnabled bool
+
+type phaseTime struct {
+	name string
+	dur  time.Duration
+}
+
+// Phases in the order they were first entered.
+var phaseTimes []phaseTime
+
+func recordPhase(name string, dur time.Duration) {
+	for i, _ := range phaseTimes {
+		if phaseTimes[i].name == name {
+			phaseTimes[i].dur += dur
+			return
+		}
+	}
+
+	phaseTimes = append(phaseTimes, phaseTime{name, dur})
+}
+
+// Starts timing the named build phase.  The returned function stops the
+// timer and must be called when the phase completes; typical usage is:
+//
+//	defer newtutil.StartPhase("compile")()
+//
+// Time spent in a phase that is entered multiple times is accumulated.
+func StartPhase(name string) func() {
+	if !PhaseTimingEnabled {
+		return func() {}
+	}
+
+	start := time.Now()
+	return func() {
+		recordPhase(name, time.Since(start))
+	}
+}
+
+// Produces a printable summary of the time spent in each build phase.
+// Returns an empty string if no phases were timed.
+func PhaseTimingText() string {
+	if len(phaseTimes) == 0 {
+		return ""
+	}
+
+	total := time.Duration(0)
+	str := "Build timing:\n"
+	for _, pt := range phaseTimes {
+		str += fmt.Sprintf("    %-10s %10.3fs\n", pt.name, pt.dur.Seconds())
+		total += pt.dur
+	}
+	str += fmt.Sprintf("    %-10s %10.3fs\n", "total", total.Seconds())
+
+	return str
+}
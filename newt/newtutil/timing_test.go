@@ -0,0 +1,102 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package newtutil
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPhaseTiming(t *testing.T) {
+	defer func(enabled bool) {
+		PhaseTimingEnabled = enabled
+		phaseTimes = nil
+	}(PhaseTimingEnabled)
+
+	tests := []struct {
+		name    string
+		enabled bool
+		phases  []string
+		want    []string
+	}{
+		{"disabled", false, []string{"compile", "link"}, nil},
+		{
+			"enabled",
+			true,
+			[]string{"resolve", "compile", "link"},
+			[]string{"resolve", "compile", "link"},
+		},
+		{
+			"repeated phases accumulate",
+			true,
+			[]string{"compile", "link", "compile"},
+			[]string{"compile", "link"},
+		},
+	}
+
+	for _, test := range tests {
+		PhaseTimingEnabled = test.enabled
+		phaseTimes = nil
+
+		for _, phase := range test.phases {
+			stop := StartPhase(phase)
+			time.Sleep(time.Millisecond)
+			stop()
+		}
+
+		var got []string
+		for _, pt := range phaseTimes {
+			got = append(got, pt.name)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: phases %v; want %v", test.name, got, test.want)
+		}
+
+		text := PhaseTimingText()
+		if test.want == nil {
+			if text != "" {
+				t.Errorf("%s: unexpected timing text: %q", test.name, text)
+			}
+			continue
+		}
+
+		for _, name := range append(test.want, "total") {
+			if !strings.Contains(text, name) {
+				t.Errorf("%s: timing text lacks %s: %q", test.name, name,
+					text)
+			}
+		}
+	}
+
+	// A repeated phase's times are summed.
+	PhaseTimingEnabled = true
+	phaseTimes = nil
+	recordPhase("compile", 2*time.Second)
+	recordPhase("link", time.Second)
+	recordPhase("compile", 3*time.Second)
+	if phaseTimes[0].dur != 5*time.Second {
+		t.Errorf("accumulated compile time %s; want 5s", phaseTimes[0].dur)
+	}
+	if !strings.Contains(PhaseTimingText(), "6.000s") {
+		t.Errorf("timing text lacks 6.000s total: %q", PhaseTimingText())
+	}
+}
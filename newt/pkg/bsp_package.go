@@ -20,11 +20,13 @@
 package pkg
 
 import (
+	"encoding/hex"
 	"strings"
 
 	"mynewt.apache.org/newt/newt/flash"
 	"mynewt.apache.org/newt/newt/interfaces"
 	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/toolchain"
 	"mynewt.apache.org/newt/util"
 	"mynewt.apache.org/newt/viper"
 )
@@ -41,6 +43,47 @@ type BspPackage struct {
 	DebugScript        string
 	FlashMap           flash.FlashMap
 	BspV               *viper.Viper
+
+	// If non-empty, a linker script template from which a script replacing
+	// LinkerScripts is generated at build time.
+	LinkerScriptTemplate string
+
+	// If set, the build profile's linker scripts
+	// (bsp.linkerscript_profile.<profile>) replace the default ones.
+	BuildProfile string
+
+	// Bytes a correctly placed boot loader contains at BootMagicOffset
+	// within the boot loader flash area; nil if unspecified.
+	BootMagic       []byte
+	BootMagicOffset int
+
+	// Boundary that the boot loader requires image slots to start on
+	// (bsp.image_slot_align).  0 indicates the erase sector size; -1
+	// indicates that the BSP imposes no requirement.
+	ImageSlotAlign int
+
+	// Range of compiler versions that the BSP supports
+	// (bsp.toolchain_min_version, bsp.toolchain_max_version); nil
+	// indicates no bound.
+	ToolchainMinVersion toolchain.CompilerVersion
+	ToolchainMaxVersion toolchain.CompilerVersion
+}
+
+func (bsp *BspPackage) versionSetting(
+	features map[string]bool, key string) (toolchain.CompilerVersion, error) {
+
+	val := newtutil.GetStringFeatures(bsp.BspV, features, key)
+	if val == "" {
+		return nil, nil
+	}
+
+	v, err := toolchain.ParseCompilerVersion(val)
+	if err != nil {
+		return nil, util.FmtNewtError(
+			"BSP \"%s\" specifies invalid %s: %s", bsp.Name(), key, val)
+	}
+
+	return v, nil
 }
 
 func (bsp *BspPackage) resolvePathSetting(
@@ -98,6 +141,50 @@ func (bsp *BspPackage) resolveLinkerScriptSetting(
 	return paths, nil
 }
 
+// Replaces the default linker scripts with those of the BSP's build profile,
+// if the BSP specifies any for the profile.  Each profile-specific script must
+// exist.
+func (bsp *BspPackage) applyProfileLinkerScripts(
+	features map[string]bool) error {
+
+	if bsp.BuildProfile == "" {
+		return nil
+	}
+
+	key := "bsp.linkerscript_profile." + bsp.BuildProfile
+	scripts, err := bsp.resolveLinkerScriptSetting(features, key)
+	if err != nil {
+		return err
+	}
+
+	paths := []string{}
+	for _, script := range scripts {
+		if script == "" {
+			continue
+		}
+		if util.NodeNotExist(script) {
+			return util.FmtNewtError(
+				"BSP \"%s\" specifies nonexistent linker script for "+
+					"build profile \"%s\": %s",
+				bsp.Name(), bsp.BuildProfile, script)
+		}
+		paths = append(paths, script)
+	}
+
+	if len(paths) > 0 {
+		bsp.LinkerScripts = paths
+	}
+
+	return nil
+}
+
+// Selects the build profile whose linker scripts are used, and reloads the
+// BSP's settings accordingly.
+func (bsp *BspPackage) SetBuildProfile(profile string) error {
+	bsp.BuildProfile = profile
+	return bsp.Reload(nil)
+}
+
 func (bsp *BspPackage) Reload(features map[string]bool) error {
 	var err error
 
@@ -120,12 +207,22 @@ func (bsp *BspPackage) Reload(features map[string]bool) error {
 		return err
 	}
 
+	if err := bsp.applyProfileLinkerScripts(features); err != nil {
+		return err
+	}
+
 	bsp.Part2LinkerScripts, err = bsp.resolveLinkerScriptSetting(
 		features, "bsp.part2linkerscript")
 	if err != nil {
 		return err
 	}
 
+	bsp.LinkerScriptTemplate, err = bsp.resolvePathSetting(
+		features, "bsp.linkerscript_template")
+	if err != nil {
+		return err
+	}
+
 	bsp.DownloadScript, err = bsp.resolvePathSetting(
 		features, "bsp.downloadscript")
 	if err != nil {
@@ -147,13 +244,88 @@ func (bsp *BspPackage) Reload(features map[string]bool) error {
 			"(bsp.arch)")
 	}
 
+	bsp.BootMagic = nil
+	bsp.BootMagicOffset = 0
+	magicStr := newtutil.GetStringFeatures(bsp.BspV, features,
+		"bsp.boot_magic")
+	if magicStr != "" {
+		bsp.BootMagic, err = hex.DecodeString(
+			strings.TrimPrefix(magicStr, "0x"))
+		if err != nil || len(bsp.BootMagic) == 0 {
+			return util.FmtNewtError(
+				"BSP \"%s\" specifies invalid bsp.boot_magic: %s; must be "+
+					"a hex string", bsp.Name(), magicStr)
+		}
+
+		offStr := newtutil.GetStringFeatures(bsp.BspV, features,
+			"bsp.boot_magic_offset")
+		if offStr != "" {
+			bsp.BootMagicOffset, err = util.AtoiNoOct(offStr)
+			if err != nil || bsp.BootMagicOffset < 0 {
+				return util.FmtNewtError(
+					"BSP \"%s\" specifies invalid bsp.boot_magic_offset: %s",
+					bsp.Name(), offStr)
+			}
+		}
+	}
+
+	bsp.ImageSlotAlign = -1
+	alignStr := newtutil.GetStringFeatures(bsp.BspV, features,
+		"bsp.image_slot_align")
+	switch alignStr {
+	case "":
+	case "sector":
+		bsp.ImageSlotAlign = 0
+	default:
+		bsp.ImageSlotAlign, err = util.AtoiNoOct(alignStr)
+		if err != nil || bsp.ImageSlotAlign <= 0 {
+			return util.FmtNewtError(
+				"BSP \"%s\" specifies invalid bsp.image_slot_align: %s; "+
+					"must be a positive integer or \"sector\"",
+				bsp.Name(), alignStr)
+		}
+	}
+
+	bsp.ToolchainMinVersion, err = bsp.versionSetting(features,
+		"bsp.toolchain_min_version")
+	if err != nil {
+		return err
+	}
+	bsp.ToolchainMaxVersion, err = bsp.versionSetting(features,
+		"bsp.toolchain_max_version")
+	if err != nil {
+		return err
+	}
+	if bsp.ToolchainMinVersion != nil && bsp.ToolchainMaxVersion != nil &&
+		bsp.ToolchainMinVersion.Compare(bsp.ToolchainMaxVersion) > 0 {
+
+		return util.FmtNewtError(
+			"BSP \"%s\" specifies bsp.toolchain_min_version (%s) greater "+
+				"than bsp.toolchain_max_version (%s)", bsp.Name(),
+			bsp.ToolchainMinVersion.String(),
+			bsp.ToolchainMaxVersion.String())
+	}
+
+	// A BSP that describes its flash in device tree source can point to the
+	// source file instead of specifying the flash map directly.
+	dtsPath, err := bsp.resolvePathSetting(features, "bsp.flash_map_dts")
+	if err != nil {
+		return err
+	}
+
 	ymlFlashMap := newtutil.GetStringMapFeatures(bsp.BspV, features,
 		"bsp.flash_map")
-	if ymlFlashMap == nil {
+	switch {
+	case ymlFlashMap != nil:
+		bsp.FlashMap, err = flash.Read(ymlFlashMap)
+
+	case dtsPath != "":
+		bsp.FlashMap, err = flash.ReadDts(dtsPath)
+
+	default:
 		return util.NewNewtError("BSP does not specify a flash map " +
-			"(bsp.flash_map)")
+			"(bsp.flash_map or bsp.flash_map_dts)")
 	}
-	bsp.FlashMap, err = flash.Read(ymlFlashMap)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,152 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package pkg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/newt/toolchain"
+)
+
+// A project in which every path is relative to a single directory.
+type testBspProject struct {
+	dir string
+}
+
+func (proj *testBspProject) Name() string {
+	return "test"
+}
+func (proj *testBspProject) Path() string {
+	return proj.dir
+}
+func (proj *testBspProject) ResolveDependency(
+	dep interfaces.DependencyInterface) interfaces.PackageInterface {
+
+	return nil
+}
+func (proj *testBspProject) ResolvePath(
+	basePath string, name string) (string, error) {
+
+	return filepath.Join(proj.dir, name), nil
+}
+func (proj *testBspProject) PackageList() interfaces.PackageList {
+	return nil
+}
+
+const testProfileBspYml = `bsp.arch: cortex_m4
+bsp.compiler: compiler/arm-none-eabi-m4
+bsp.linkerscript: nrf52xxaa.ld
+bsp.linkerscript_profile.ram: ram.ld
+bsp.linkerscript_profile.split:
+    - split_app.ld
+    - split_common.ld
+bsp.linkerscript_profile.broken: missing.ld
+bsp.flash_map:
+    areas:
+        FLASH_AREA_BOOTLOADER:
+            device: 0
+            offset: 0x00000000
+            size: 16kB
+`
+
+func TestProfileLinkerScripts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-bsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		BSP_YAML_FILENAME: testProfileBspYml,
+		"nrf52xxaa.ld":    "",
+		"ram.ld":          "",
+		"split_app.ld":    "",
+		"split_common.ld": "",
+		"unreferenced.ld": "",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name),
+			[]byte(contents), 0644); err != nil {
+
+			t.Fatal(err)
+		}
+	}
+
+	defer interfaces.SetProject(interfaces.GetProject())
+	interfaces.SetProject(&testBspProject{dir})
+
+	tests := []struct {
+		profile string
+		want    []string
+		wantErr string
+	}{
+		{"", []string{"nrf52xxaa.ld"}, ""},
+		{"ram", []string{"ram.ld"}, ""},
+		{"split", []string{"split_app.ld", "split_common.ld"}, ""},
+		{"debug", []string{"nrf52xxaa.ld"}, ""},
+		{"broken", nil,
+			"nonexistent linker script for build profile \"broken\""},
+	}
+
+	for _, test := range tests {
+		bsp := &BspPackage{
+			LocalPackage: NewLocalPackage(&repo.Repo{}, dir),
+		}
+
+		err := bsp.SetBuildProfile(test.profile)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("profile \"%s\": error=%v; want \"%s\"",
+					test.profile, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("profile \"%s\": unexpected error: %v", test.profile,
+				err)
+			continue
+		}
+
+		got := []string{}
+		for _, path := range bsp.LinkerScripts {
+			got = append(got, filepath.Base(path))
+		}
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("profile \"%s\": linker scripts=%v; want %v",
+				test.profile, got, test.want)
+		}
+
+		// The builder hands the BSP's linker scripts to the compiler.
+		c := &toolchain.Compiler{LinkerScripts: bsp.LinkerScripts}
+		cmd := c.LinkCmd("bin/app.elf", []string{"bin/app.a"}, nil, "")
+		for _, path := range bsp.LinkerScripts {
+			if !strings.Contains(cmd, " -T "+path) {
+				t.Errorf("profile \"%s\": link command \"%s\" lacks %s",
+					test.profile, cmd, path)
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package pkg
+
+import (
+	"regexp"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+// Conditional dependencies are listed under pkg.deps_cond.  Each entry has
+// the form "<package> if <condition>", where the condition is one of:
+//
+//     SETTING              The setting is enabled.
+//     !SETTING             The setting is disabled or undefined.
+//     SETTING==VALUE       The setting has the specified value.
+//     SETTING!=VALUE       The setting does not have the specified value.
+//
+// For example:
+//
+//     pkg.deps_cond:
+//         - "@apache-mynewt-core/sys/shell if SHELL_TASK"
+//         - "fs/nffs if FS_TYPE==nffs"
+
+const PKG_COND_DEPS_KEY = "pkg.deps_cond"
+
+const (
+	COND_OP_TRUE  = ""
+	COND_OP_FALSE = "!"
+	COND_OP_EQ    = "=="
+	COND_OP_NE    = "!="
+)
+
+type DepCond struct {
+	Setting string
+	Op      string
+	Value   string
+}
+
+type CondDep struct {
+	// Dependency string, as it would appear under pkg.deps.
+	Dep  string
+	Cond DepCond
+}
+
+var condSettingRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (cond DepCond) String() string {
+	switch cond.Op {
+	case COND_OP_EQ, COND_OP_NE:
+		return cond.Setting + cond.Op + cond.Value
+	default:
+		return cond.Op + cond.Setting
+	}
+}
+
+func (cd CondDep) String() string {
+	return cd.Dep + " if " + cd.Cond.String()
+}
+
+// Parses a condition of the form accepted by pkg.deps_cond.
+func ParseDepCond(s string) (DepCond, error) {
+	cond := DepCond{}
+	s = strings.TrimSpace(s)
+
+	switch {
+	case strings.Contains(s, COND_OP_NE):
+		parts := strings.SplitN(s, COND_OP_NE, 2)
+		cond.Setting, cond.Op, cond.Value = parts[0], COND_OP_NE, parts[1]
+
+	case strings.Contains(s, COND_OP_EQ):
+		parts := strings.SplitN(s, COND_OP_EQ, 2)
+		cond.Setting, cond.Op, cond.Value = parts[0], COND_OP_EQ, parts[1]
+
+	case strings.HasPrefix(s, COND_OP_FALSE):
+		cond.Setting, cond.Op = s[1:], COND_OP_FALSE
+
+	default:
+		cond.Setting, cond.Op = s, COND_OP_TRUE
+	}
+
+	cond.Setting = strings.TrimSpace(cond.Setting)
+	cond.Value = strings.Trim(strings.TrimSpace(cond.Value), "\"")
+
+	if !condSettingRe.MatchString(cond.Setting) {
+		return cond, util.FmtNewtError(
+			"Invalid dependency condition \"%s\"; setting name must be a "+
+				"C identifier", s)
+	}
+
+	return cond, nil
+}
+
+// Parses a single pkg.deps_cond entry.
+func ParseCondDep(s string) (CondDep, error) {
+	cd := CondDep{}
+
+	parts := strings.SplitN(s, " if ", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return cd, util.FmtNewtError(
+			"Invalid conditional dependency \"%s\"; must be of the form "+
+				"\"<package> if <condition>\"", s)
+	}
+
+	cond, err := ParseDepCond(parts[1])
+	if err != nil {
+		return cd, err
+	}
+
+	cd.Dep = strings.TrimSpace(parts[0])
+	cd.Cond = cond
+
+	return cd, nil
+}
+
+// Retrieves the package's conditional dependencies, regardless of whether
+// their conditions hold.  features selects feature-specific variants of the
+// pkg.deps_cond key, as with pkg.deps.
+func (pkg *LocalPackage) CondDeps(features map[string]bool) (
+	[]CondDep, error) {
+
+	strs := newtutil.GetStringSliceFeatures(pkg.PkgV, features,
+		PKG_COND_DEPS_KEY)
+
+	cds := make([]CondDep, 0, len(strs))
+	for _, s := range strs {
+		cd, err := ParseCondDep(s)
+		if err != nil {
+			return nil, util.FmtNewtError("%s: %s", pkg.FullName(),
+				err.Error())
+		}
+		cds = append(cds, cd)
+	}
+
+	return cds, nil
+}
@@ -0,0 +1,105 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package pkg
+
+import (
+	"path/filepath"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+// Conditional source files are listed under pkg.src_files_cond.  Each entry
+// has the form "<file> if <condition>", where the file path is relative to the
+// package directory and the condition takes the form accepted by
+// pkg.deps_cond.  In addition to syscfg settings, a condition may test the
+// pseudo-setting ARCH, which holds the architecture of the target's BSP.
+// A listed file is compiled only if its condition holds.  For example:
+//
+//     pkg.src_files_cond:
+//         - "src/crc_hw.c if ARCH==cortex_m4"
+//         - "src/crc_sw.c if ARCH!=cortex_m4"
+//         - "src/log_console.c if LOG_CONSOLE"
+
+const PKG_COND_SRCS_KEY = "pkg.src_files_cond"
+
+// The pseudo-setting that a source file condition uses to test the BSP
+// architecture.
+const COND_SETTING_ARCH = "ARCH"
+
+type CondSrc struct {
+	// Source file path, relative to the package directory.
+	File string
+	Cond DepCond
+}
+
+func (cs CondSrc) String() string {
+	return cs.File + " if " + cs.Cond.String()
+}
+
+// Parses a single pkg.src_files_cond entry.
+func ParseCondSrc(s string) (CondSrc, error) {
+	cs := CondSrc{}
+
+	parts := strings.SplitN(s, " if ", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return cs, util.FmtNewtError(
+			"Invalid conditional source file \"%s\"; must be of the form "+
+				"\"<file> if <condition>\"", s)
+	}
+
+	cond, err := ParseDepCond(parts[1])
+	if err != nil {
+		return cs, err
+	}
+
+	cs.File = filepath.Clean(strings.TrimSpace(parts[0]))
+	cs.Cond = cond
+
+	return cs, nil
+}
+
+// Retrieves the package's conditional source files, regardless of whether
+// their conditions hold.  features selects feature-specific variants of the
+// pkg.src_files_cond key.
+func (pkg *LocalPackage) CondSrcs(features map[string]bool) (
+	[]CondSrc, error) {
+
+	strs := newtutil.GetStringSliceFeatures(pkg.PkgV, features,
+		PKG_COND_SRCS_KEY)
+
+	css := make([]CondSrc, 0, len(strs))
+	for _, s := range strs {
+		cs, err := ParseCondSrc(s)
+		if err != nil {
+			return nil, util.FmtNewtError("%s: %s", pkg.FullName(),
+				err.Error())
+		}
+		if filepath.IsAbs(cs.File) || strings.HasPrefix(cs.File, "..") {
+			return nil, util.FmtNewtError(
+				"%s: conditional source file \"%s\" must be relative to "+
+					"the package directory", pkg.FullName(), cs.File)
+		}
+		css = append(css, cs)
+	}
+
+	return css, nil
+}
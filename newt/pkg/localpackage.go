@@ -233,6 +233,13 @@ func (pkg *LocalPackage) sequenceString(key string) string {
 }
 
 func (lpkg *LocalPackage) SaveSyscfgVals() error {
+	return lpkg.WriteSyscfgVals(
+		lpkg.SyscfgV.GetStringMapString("syscfg.vals"))
+}
+
+// Writes the specified syscfg values to the package's syscfg.yml file.  The
+// file is removed if there are no values.
+func (lpkg *LocalPackage) WriteSyscfgVals(syscfgVals map[string]string) error {
 	dirpath := lpkg.BasePath()
 	if err := os.MkdirAll(dirpath, 0755); err != nil {
 		return util.NewNewtError(err.Error())
@@ -240,7 +247,6 @@ func (lpkg *LocalPackage) SaveSyscfgVals() error {
 
 	filepath := dirpath + "/" + SYSCFG_YAML_FILENAME
 
-	syscfgVals := lpkg.SyscfgV.GetStringMapString("syscfg.vals")
 	if syscfgVals == nil || len(syscfgVals) == 0 {
 		os.Remove(filepath)
 		return nil
@@ -0,0 +1,170 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/util"
+)
+
+// A directory that appears to contain a package, but which is skipped during
+// package resolution because it lacks a usable pkg.yml file.
+type OrphanPackage struct {
+	Repo   *repo.Repo
+	Path   string // Relative to the repo's base path.
+	Reason string
+}
+
+var orphanSrcExts = map[string]bool{
+	".c":   true,
+	".cc":  true,
+	".cpp": true,
+	".h":   true,
+	".hpp": true,
+	".s":   true,
+	".S":   true,
+}
+
+// Indicates whether the specified directory contains any C, C++, or assembly
+// files, at any depth.
+func dirHasSources(dir string) bool {
+	found := false
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || found {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && orphanSrcExts[filepath.Ext(path)] {
+			found = true
+			return filepath.SkipDir
+		}
+		return nil
+	})
+
+	return found
+}
+
+// Indicates whether a directory without a pkg.yml file is laid out like a
+// package: it has a "src" or "include" directory containing source files.
+func looksLikePackage(dir string) bool {
+	for _, sub := range []string{"src", "include"} {
+		subDir := filepath.Join(dir, sub)
+		if info, err := os.Stat(subDir); err == nil && info.IsDir() &&
+			dirHasSources(subDir) {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// Determines why the package directory at pkgDir would be skipped during
+// package resolution.  An empty string indicates that the directory is not
+// an orphan: it either contains a valid package or does not look like one.
+func orphanReason(r *repo.Repo, pkgDir string) string {
+	if util.NodeNotExist(filepath.Join(pkgDir, PACKAGE_FILE_NAME)) {
+		if looksLikePackage(pkgDir) {
+			return "contains source files but no " + PACKAGE_FILE_NAME
+		}
+		return ""
+	}
+
+	lpkg, err := LoadLocalPackage(r, pkgDir)
+	if err != nil {
+		return PACKAGE_FILE_NAME + " cannot be parsed: " + err.Error()
+	}
+	if lpkg.Name() == "" {
+		return PACKAGE_FILE_NAME + " is empty or does not specify pkg.name"
+	}
+
+	return ""
+}
+
+func findOrphansRecursive(r *repo.Repo, basePath string, pkgName string,
+	orphans []OrphanPackage) ([]OrphanPackage, error) {
+
+	dirList, err := r.FilteredSearchList(pkgName)
+	if err != nil {
+		return orphans, util.NewNewtError(err.Error())
+	}
+
+	reason := orphanReason(r, filepath.Join(basePath, pkgName))
+	if reason != "" {
+		orphans = append(orphans, OrphanPackage{
+			Repo:   r,
+			Path:   pkgName,
+			Reason: reason,
+		})
+	}
+
+	for _, name := range dirList {
+		if LocalPackageSpecialName(name) || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		orphans, err = findOrphansRecursive(r, basePath,
+			filepath.Join(pkgName, name), orphans)
+		if err != nil {
+			return orphans, err
+		}
+	}
+
+	return orphans, nil
+}
+
+// Scans a repo for directories that look like packages but that package
+// resolution ignores: those with source files but no pkg.yml, and those
+// whose pkg.yml is empty or cannot be parsed.  The same directories are
+// searched as by ReadLocalPackages.
+func FindOrphanPackages(r *repo.Repo, basePath string) (
+	[]OrphanPackage, error) {
+
+	orphans := []OrphanPackage{}
+
+	searchPaths, err := r.FilteredSearchList("")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range searchPaths {
+		if util.NodeNotExist(filepath.Join(basePath, path)) {
+			continue
+		}
+
+		dirList, err := r.FilteredSearchList(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, subDir := range dirList {
+			orphans, err = findOrphansRecursive(r, basePath,
+				filepath.Join(path, subDir), orphans)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return orphans, nil
+}
@@ -0,0 +1,108 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package pkg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/repo"
+)
+
+func TestFindOrphanPackages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-orphan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"apps/blinky/pkg.yml":                "pkg.name: apps/blinky\n",
+		"apps/blinky/src/main.c":             "int main(void) { return 0; }\n",
+		"hw/drivers/sensor/src/sensor.c":     "int sensor_init(void);\n",
+		"libs/broken/pkg.yml":                "pkg.name: [libs/broken\n",
+		"libs/broken/src/broken.c":           "\n",
+		"libs/empty/pkg.yml":                 "",
+		"libs/headers/include/headers/hdr.h": "#define HDR 1\n",
+		"libs/docs/README.md":                "Not a package.\n",
+		"libs/.hidden/src/hidden.c":          "\n",
+		"libs/scripts/src/build.py":          "\n",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer interfaces.SetProject(interfaces.GetProject())
+	interfaces.SetProject(&testBspProject{dir})
+
+	r, err := repo.NewLocalRepo("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orphans, err := FindOrphanPackages(r, r.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		path   string
+		reason string
+	}{
+		{"hw/drivers/sensor", "contains source files but no pkg.yml"},
+		{"libs/broken", "pkg.yml cannot be parsed"},
+		{"libs/empty", "pkg.yml is empty or does not specify pkg.name"},
+		{"libs/headers", "contains source files but no pkg.yml"},
+	}
+
+	if len(orphans) != len(expected) {
+		paths := []string{}
+		for _, o := range orphans {
+			paths = append(paths, o.Path)
+		}
+		t.Fatalf("wrong orphan count: want=%d have=%d (%s)",
+			len(expected), len(orphans), strings.Join(paths, ", "))
+	}
+
+	for i, exp := range expected {
+		o := orphans[i]
+		if o.Path != exp.path {
+			t.Errorf("orphan %d: wrong path: want=%s have=%s",
+				i, exp.path, o.Path)
+		}
+		if !strings.HasPrefix(o.Reason, exp.reason) {
+			t.Errorf("%s: wrong reason: want=\"%s...\" have=\"%s\"",
+				exp.path, exp.reason, o.Reason)
+		}
+		if o.Repo != r {
+			t.Errorf("%s: wrong repo", exp.path)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package pkg
+
+import (
+	"sort"
+	"strings"
+)
+
+// Descriptive keys; these always come first, in this order.
+var pkgYmlHeaderKeys = []string{
+	"pkg.name",
+	"pkg.type",
+	"pkg.description",
+	"pkg.author",
+	"pkg.homepage",
+	"pkg.keywords",
+}
+
+// Keys whose list items get sorted.  Feature-conditional variants (e.g.,
+// "pkg.deps.BLE_DEVICE") are sorted as well.
+var pkgYmlSortedListKeys = []string{
+	"pkg.deps",
+	"pkg.deps_cond",
+	"pkg.apis",
+	"pkg.req_apis",
+}
+
+// A top-level key and everything that belongs to it: the comments
+// immediately preceding it, the key line itself, and its indented body.
+type pkgYmlBlock struct {
+	key      string
+	comments []string
+	lines    []string
+}
+
+// A list item, along with the comments immediately preceding it.
+type pkgYmlItem struct {
+	comments []string
+	line     string
+}
+
+func isBlankLine(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func isCommentLine(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "#")
+}
+
+// Returns the key defined by a top-level line, or "" if the line does not
+// define a top-level key.
+func topLevelKey(line string) string {
+	if line == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '#' ||
+		line[0] == '-' {
+
+		return ""
+	}
+
+	colon := strings.Index(line, ":")
+	if colon == -1 {
+		return ""
+	}
+
+	return strings.Trim(strings.TrimSpace(line[:colon]), "\"'")
+}
+
+func pkgYmlKeyRank(key string) int {
+	for i, k := range pkgYmlHeaderKeys {
+		if k == key {
+			return i
+		}
+	}
+
+	return len(pkgYmlHeaderKeys)
+}
+
+func isSortedListKey(key string) bool {
+	for _, k := range pkgYmlSortedListKeys {
+		if key == k || strings.HasPrefix(key, k+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+type pkgYmlBlockSorter struct {
+	blocks []pkgYmlBlock
+}
+
+func (s pkgYmlBlockSorter) Len() int {
+	return len(s.blocks)
+}
+func (s pkgYmlBlockSorter) Swap(i, j int) {
+	s.blocks[i], s.blocks[j] = s.blocks[j], s.blocks[i]
+}
+func (s pkgYmlBlockSorter) Less(i, j int) bool {
+	ri := pkgYmlKeyRank(s.blocks[i].key)
+	rj := pkgYmlKeyRank(s.blocks[j].key)
+	if ri != rj {
+		return ri < rj
+	}
+
+	return s.blocks[i].key < s.blocks[j].key
+}
+
+type pkgYmlItemSorter struct {
+	items []pkgYmlItem
+}
+
+func (s pkgYmlItemSorter) Len() int {
+	return len(s.items)
+}
+func (s pkgYmlItemSorter) Swap(i, j int) {
+	s.items[i], s.items[j] = s.items[j], s.items[i]
+}
+func (s pkgYmlItemSorter) Less(i, j int) bool {
+	return listItemValue(s.items[i].line) < listItemValue(s.items[j].line)
+}
+
+func listItemValue(line string) string {
+	val := strings.TrimSpace(line)
+	val = strings.TrimSpace(strings.TrimPrefix(val, "-"))
+	return strings.Trim(val, "\"'")
+}
+
+// Sorts the items of a block whose body is a plain list.  Comments preceding
+// an item stay with it.  If the body contains anything other than list items
+// and comments, the block is left untouched.
+func (block *pkgYmlBlock) sortListItems() {
+	body := block.lines[1:]
+
+	items := []pkgYmlItem{}
+	comments := []string{}
+	for _, line := range body {
+		switch {
+		case isBlankLine(line):
+			// Blank lines within a sorted list are dropped.
+
+		case isCommentLine(line):
+			comments = append(comments, line)
+
+		case strings.HasPrefix(strings.TrimSpace(line), "- "):
+			items = append(items, pkgYmlItem{comments, line})
+			comments = []string{}
+
+		default:
+			return
+		}
+	}
+
+	// Trailing comments have no item to attach to; leave the block alone.
+	if len(comments) > 0 {
+		return
+	}
+
+	sort.Stable(pkgYmlItemSorter{items})
+
+	lines := []string{block.lines[0]}
+	for _, item := range items {
+		lines = append(lines, item.comments...)
+		lines = append(lines, item.line)
+	}
+	block.lines = lines
+}
+
+// Splits a pkg.yml file into its preamble (everything preceding the first
+// top-level key) and its top-level blocks.  Comments directly above a key
+// are attached to that key's block.
+func splitPkgYml(contents string) ([]string, []pkgYmlBlock) {
+	lines := strings.Split(strings.TrimRight(contents, "\n"), "\n")
+
+	preamble := []string{}
+	blocks := []pkgYmlBlock{}
+	pending := []string{}
+
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		key := topLevelKey(line)
+
+		if key != "" {
+			// The pending comments belong to this key; any earlier
+			// non-comment lines belong to the previous block.
+			split := len(pending)
+			for split > 0 && isCommentLine(pending[split-1]) {
+				split--
+			}
+
+			if len(blocks) == 0 {
+				preamble = append(preamble, pending[:split]...)
+			} else {
+				prev := &blocks[len(blocks)-1]
+				prev.lines = append(prev.lines, pending[:split]...)
+			}
+
+			blocks = append(blocks, pkgYmlBlock{
+				key:      key,
+				comments: append([]string{}, pending[split:]...),
+				lines:    []string{line},
+			})
+			pending = []string{}
+		} else if isBlankLine(line) || isCommentLine(line) {
+			pending = append(pending, line)
+		} else if len(blocks) == 0 {
+			preamble = append(preamble, pending...)
+			preamble = append(preamble, line)
+			pending = []string{}
+		} else {
+			prev := &blocks[len(blocks)-1]
+			prev.lines = append(prev.lines, pending...)
+			prev.lines = append(prev.lines, line)
+			pending = []string{}
+		}
+	}
+
+	if len(blocks) == 0 {
+		preamble = append(preamble, pending...)
+	} else {
+		prev := &blocks[len(blocks)-1]
+		prev.lines = append(prev.lines, pending...)
+	}
+
+	return preamble, blocks
+}
+
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && isBlankLine(lines[0]) {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && isBlankLine(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// Rewrites the contents of a pkg.yml file in canonical form:
+//   - The descriptive keys (name, type, description, author, homepage,
+//     keywords) come first, followed by all other keys in alphabetical order.
+//   - Dependency and API lists are sorted.
+//   - A single blank line separates the descriptive keys from the rest of the
+//     file, and each of the remaining keys from one another.
+//
+// Comments directly above a key or list item move with it.  Formatting an
+// already-normalized file has no effect.
+func FormatPkgYml(contents string) string {
+	preamble, blocks := splitPkgYml(contents)
+
+	for i, _ := range blocks {
+		blocks[i].lines = trimBlankLines(blocks[i].lines)
+		if isSortedListKey(blocks[i].key) {
+			blocks[i].sortListItems()
+		}
+	}
+	sort.Stable(pkgYmlBlockSorter{blocks})
+
+	out := []string{}
+	preamble = trimBlankLines(preamble)
+	if len(preamble) > 0 {
+		out = append(out, preamble...)
+		out = append(out, "")
+	}
+
+	for i, block := range blocks {
+		isHeader := pkgYmlKeyRank(block.key) < len(pkgYmlHeaderKeys)
+		if i > 0 && (!isHeader || len(block.comments) > 0) {
+			out = append(out, "")
+		}
+
+		out = append(out, block.comments...)
+		out = append(out, block.lines...)
+	}
+
+	return strings.Join(out, "\n") + "\n"
+}
@@ -0,0 +1,126 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package pkg
+
+import (
+	"testing"
+)
+
+func TestFormatPkgYml(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "keys and dependencies sorted",
+			in: `# Licensed to the Apache Software Foundation.
+
+pkg.deps:
+    - "@apache-mynewt-core/sys/log/full"
+    # The OS must be present.
+    - "@apache-mynewt-core/kernel/os"
+    - "@apache-mynewt-core/hw/hal"
+pkg.description: Blinky app.
+pkg.name: apps/blinky
+pkg.type: app
+pkg.apis:
+    - log
+    - console
+`,
+			want: `# Licensed to the Apache Software Foundation.
+
+pkg.name: apps/blinky
+pkg.type: app
+pkg.description: Blinky app.
+
+pkg.apis:
+    - console
+    - log
+
+pkg.deps:
+    - "@apache-mynewt-core/hw/hal"
+    # The OS must be present.
+    - "@apache-mynewt-core/kernel/os"
+    - "@apache-mynewt-core/sys/log/full"
+`,
+		},
+		{
+			name: "conditional dependencies and key comments",
+			in: `pkg.name: sys/stats
+pkg.deps.STATS_CLI:
+    - sys/shell
+    - sys/console
+# Always required.
+pkg.deps:
+    - kernel/os
+pkg.cflags:
+    - -DZ
+    - -DA
+`,
+			want: `pkg.name: sys/stats
+
+pkg.cflags:
+    - -DZ
+    - -DA
+
+# Always required.
+pkg.deps:
+    - kernel/os
+
+pkg.deps.STATS_CLI:
+    - sys/console
+    - sys/shell
+`,
+		},
+		{
+			name: "mapping body left untouched",
+			in: `pkg.name: sys/log
+pkg.deps:
+    - kernel/os
+pkg.init:
+    z_init: 500
+    a_init: 100
+`,
+			want: `pkg.name: sys/log
+
+pkg.deps:
+    - kernel/os
+
+pkg.init:
+    z_init: 500
+    a_init: 100
+`,
+		},
+	}
+
+	for _, test := range tests {
+		got := FormatPkgYml(test.in)
+		if got != test.want {
+			t.Errorf("%s: got:\n%s\nwant:\n%s", test.name, got, test.want)
+		}
+
+		// Formatting a normalized file has no effect.
+		if again := FormatPkgYml(got); again != got {
+			t.Errorf("%s: not idempotent; second pass:\n%s", test.name,
+				again)
+		}
+	}
+}
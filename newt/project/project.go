@@ -50,6 +50,22 @@ type Project struct {
 	// Name of this project
 	name string
 
+	// Provenance metadata (project.license and project.copyright).
+	license   string
+	copyright string
+
+	// Minimum versions of other components that the project's images
+	// require (project.image_dependencies); name => version string.
+	imageDeps map[string]string
+
+	// Image header magic used throughout the project (project.image_magic);
+	// empty for the standard value.
+	imageMagic string
+
+	// Manufacturing meta TLV codes that differ from the standard values
+	// (project.meta_tlv_codes); TLV type name => code.
+	metaTlvCodes map[string]string
+
 	// Base path of the project
 	BasePath string
 
@@ -144,6 +160,26 @@ func (proj *Project) Name() string {
 	return proj.name
 }
 
+func (proj *Project) License() string {
+	return proj.license
+}
+
+func (proj *Project) Copyright() string {
+	return proj.copyright
+}
+
+func (proj *Project) ImageDependencies() map[string]string {
+	return proj.imageDeps
+}
+
+func (proj *Project) ImageMagic() string {
+	return proj.imageMagic
+}
+
+func (proj *Project) MetaTlvCodes() map[string]string {
+	return proj.metaTlvCodes
+}
+
 func (proj *Project) Repos() map[string]*repo.Repo {
 	return proj.repos
 }
@@ -161,6 +197,12 @@ func (proj *Project) LocalRepo() *repo.Repo {
 	return proj.localRepo
 }
 
+// Returns the installed version of the specified repo, or nil if the repo is
+// not installed.
+func (proj *Project) InstalledVersion(rname string) *repo.Version {
+	return proj.projState.GetInstalledVersion(rname)
+}
+
 func (proj *Project) Warnings() []string {
 	return proj.warnings
 }
@@ -321,6 +363,12 @@ func (proj *Project) Install(upgrade bool, force bool) error {
 		}
 	}
 
+	// Report requirements that no version can satisfy before attempting to
+	// resolve them.
+	if err := repo.CheckVersionConflicts(proj.Repos()); err != nil {
+		return err
+	}
+
 	// Get repository list, and print every repo and it's dependencies.
 	if err := repo.CheckDeps(upgrade, proj.Repos()); err != nil {
 		return err
@@ -367,6 +415,16 @@ func (proj *Project) Install(upgrade bool, force bool) error {
 	return nil
 }
 
+// Downloads the description of each repository and determines which
+// repositories have version requirements that cannot be satisfied together.
+func (proj *Project) VersionConflicts() ([]repo.VersionConflict, error) {
+	if err := proj.UpdateRepos(); err != nil {
+		return nil, err
+	}
+
+	return repo.VersionConflicts(proj.Repos()), nil
+}
+
 func (proj *Project) Upgrade(force bool) error {
 	return proj.Install(true, force)
 }
@@ -380,8 +438,7 @@ func (proj *Project) loadRepo(rname string, v *viper.Viper) error {
 			"repository %s.", rname))
 	}
 	if repoVars["type"] == "" {
-		return util.NewNewtError(fmt.Sprintf("Missing type for repository " +
-			rname))
+		return util.FmtNewtError("Missing type for repository %s", rname)
 	}
 
 	dl, err := downloader.LoadDownloader(rname, repoVars)
@@ -431,6 +488,11 @@ func (proj *Project) loadConfig() error {
 	}
 
 	proj.name = v.GetString("project.name")
+	proj.license = v.GetString("project.license")
+	proj.copyright = v.GetString("project.copyright")
+	proj.imageDeps = v.GetStringMapString("project.image_dependencies")
+	proj.imageMagic = v.GetString("project.image_magic")
+	proj.metaTlvCodes = v.GetStringMapString("project.meta_tlv_codes")
 
 	// Local repository always included in initialization
 	r, err := repo.NewLocalRepo(proj.name)
@@ -0,0 +1,162 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/util"
+)
+
+// A package that depends on another package, either directly or through
+// one or more intermediate packages.
+type RevDep struct {
+	Pkg    *pkg.LocalPackage
+	Direct bool
+
+	// For a transitive dependent, the dependency of Pkg through which it
+	// reaches the depended-on package.
+	Via *pkg.LocalPackage
+}
+
+// Returns the names of every package that lpkg could depend on: its
+// unconditional dependencies, those conditional on any feature, and its
+// pkg.deps_cond entries.  Targets also depend on their app, loader, and BSP.
+func pkgAllDepNames(lpkg *pkg.LocalPackage) []string {
+	names := []string{}
+
+	v := lpkg.PkgV
+	for _, key := range v.AllKeys() {
+		if key == "pkg.deps" || strings.HasPrefix(key, "pkg.deps.") {
+			names = append(names, cast.ToStringSlice(v.Get(key))...)
+		}
+	}
+
+	// Conditional dependencies count regardless of their conditions.
+	if cds, err := lpkg.CondDeps(nil); err == nil {
+		for _, cd := range cds {
+			names = append(names, cd.Dep)
+		}
+	}
+
+	if lpkg.Type() == pkg.PACKAGE_TYPE_TARGET {
+		tv, err := util.ReadConfig(lpkg.BasePath(), "target")
+		if err == nil {
+			for _, key := range []string{
+				"target.app", "target.loader", "target.bsp"} {
+
+				if name := tv.GetString(key); name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+
+	return names
+}
+
+// Builds a map of each package to the packages that directly depend on it.
+// Dependencies that cannot be resolved are ignored.
+func (proj *Project) reverseDepGraph() map[*pkg.LocalPackage][]*pkg.LocalPackage {
+	graph := map[*pkg.LocalPackage][]*pkg.LocalPackage{}
+
+	for _, pack := range proj.PackagesOfType(-1) {
+		lpkg := pack.(*pkg.LocalPackage)
+
+		seen := map[*pkg.LocalPackage]bool{}
+		for _, name := range pkgAllDepNames(lpkg) {
+			dep, err := pkg.NewDependency(lpkg.Repo(), name)
+			if err != nil {
+				log.Debugf("Ignoring invalid dependency \"%s\" of %s",
+					name, lpkg.FullName())
+				continue
+			}
+
+			depPkg, ok := proj.ResolveDependency(dep).(*pkg.LocalPackage)
+			if !ok {
+				log.Debugf("Ignoring unresolvable dependency \"%s\" of %s",
+					name, lpkg.FullName())
+				continue
+			}
+
+			if depPkg != lpkg && !seen[depPkg] {
+				seen[depPkg] = true
+				graph[depPkg] = append(graph[depPkg], lpkg)
+			}
+		}
+	}
+
+	return graph
+}
+
+// Lists the packages in the project that depend on lpkg, directly or
+// transitively.  Every dependency a package could have is considered,
+// including those conditional on features, so the result covers all
+// targets.  Direct dependents come first; each group is sorted by name.
+func (proj *Project) ReverseDeps(lpkg *pkg.LocalPackage) []RevDep {
+	graph := proj.reverseDepGraph()
+
+	// Breadth-first search outward from lpkg.  The first package through
+	// which a dependent is found is recorded as its "via" package.
+	via := map[*pkg.LocalPackage]*pkg.LocalPackage{}
+	queue := []*pkg.LocalPackage{lpkg}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		for _, dependent := range pkg.SortLclPkgs(graph[cur]) {
+			if _, ok := via[dependent]; ok || dependent == lpkg {
+				continue
+			}
+			via[dependent] = cur
+			queue = append(queue, dependent)
+		}
+	}
+
+	direct := []*pkg.LocalPackage{}
+	transitive := []*pkg.LocalPackage{}
+	for dependent, v := range via {
+		if v == lpkg {
+			direct = append(direct, dependent)
+		} else {
+			transitive = append(transitive, dependent)
+		}
+	}
+
+	revDeps := []RevDep{}
+	for _, dependent := range pkg.SortLclPkgs(direct) {
+		revDeps = append(revDeps, RevDep{
+			Pkg:    dependent,
+			Direct: true,
+		})
+	}
+	for _, dependent := range pkg.SortLclPkgs(transitive) {
+		revDeps = append(revDeps, RevDep{
+			Pkg: dependent,
+			Via: via[dependent],
+		})
+	}
+
+	return revDeps
+}
@@ -0,0 +1,157 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+)
+
+// Package directories and their configuration files.  Three packages depend
+// on libs/common directly, one of them only when a feature is enabled;
+// others reach it through those packages.
+var testRevDepFiles = map[string]string{
+	"project.yml": "project.name: test\n",
+
+	"libs/common/pkg.yml": "pkg.name: libs/common\n",
+
+	"libs/unused/pkg.yml": "pkg.name: libs/unused\n",
+
+	"sys/log/pkg.yml": "pkg.name: sys/log\n" +
+		"pkg.deps:\n" +
+		"    - libs/common\n",
+
+	"sys/stats/pkg.yml": "pkg.name: sys/stats\n" +
+		"pkg.deps:\n" +
+		"    - libs/common\n" +
+		"    - hw/missing\n",
+
+	"sys/shell/pkg.yml": "pkg.name: sys/shell\n" +
+		"pkg.deps.SHELL_LOG:\n" +
+		"    - libs/common\n",
+
+	"net/ble/pkg.yml": "pkg.name: net/ble\n" +
+		"pkg.deps:\n" +
+		"    - sys/log\n",
+
+	"apps/blinky/pkg.yml": "pkg.name: apps/blinky\n" +
+		"pkg.type: app\n" +
+		"pkg.deps:\n" +
+		"    - net/ble\n" +
+		"    - sys/stats\n",
+
+	"targets/blinky_sim/pkg.yml": "pkg.name: targets/blinky_sim\n" +
+		"pkg.type: target\n",
+
+	"targets/blinky_sim/target.yml": "target.app: apps/blinky\n" +
+		"target.bsp: hw/bsp/native\n",
+}
+
+func TestReverseDeps(t *testing.T) {
+	defer interfaces.SetProject(interfaces.GetProject())
+	defer ResetProject()
+
+	dir, err := ioutil.TempDir("", "newt-revdeps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, contents := range testRevDepFiles {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := InitProject(dir); err != nil {
+		t.Fatal(err)
+	}
+	proj := GetProject()
+
+	tests := []struct {
+		pkgName    string
+		direct     []string
+		transitive []string
+	}{
+		{
+			pkgName: "libs/common",
+			direct:  []string{"sys/log", "sys/shell", "sys/stats"},
+			transitive: []string{
+				"apps/blinky via sys/stats",
+				"net/ble via sys/log",
+				"targets/blinky_sim via apps/blinky",
+			},
+		},
+		{
+			pkgName: "sys/log",
+			direct:  []string{"net/ble"},
+			transitive: []string{
+				"apps/blinky via net/ble",
+				"targets/blinky_sim via apps/blinky",
+			},
+		},
+		{
+			pkgName:    "apps/blinky",
+			direct:     []string{"targets/blinky_sim"},
+			transitive: []string{},
+		},
+		{
+			pkgName:    "libs/unused",
+			direct:     []string{},
+			transitive: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		lpkg, err := proj.ResolvePackage(proj.LocalRepo(), test.pkgName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		direct := []string{}
+		transitive := []string{}
+		for _, rd := range proj.ReverseDeps(lpkg) {
+			if rd.Direct {
+				direct = append(direct, rd.Pkg.Name())
+			} else {
+				transitive = append(transitive,
+					rd.Pkg.Name()+" via "+rd.Via.Name())
+			}
+		}
+
+		if !reflect.DeepEqual(direct, test.direct) {
+			t.Errorf("%s: direct dependents: want=%v have=%v",
+				test.pkgName, test.direct, direct)
+		}
+		if !reflect.DeepEqual(transitive, test.transitive) {
+			t.Errorf("%s: transitive dependents: want=%v have=%v",
+				test.pkgName, test.transitive, transitive)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newt/viper"
+)
+
+// A project can declare conventions for its project.yml and pkg.yml files in
+// project_schema.yml, at the project root:
+//
+//     project.required:
+//         - project.license
+//     pkg.required:
+//         - pkg.description
+//         - pkg.author
+//     pkg.allowed:
+//         pkg.type: [lib, app, bsp, target, unittest]
+//
+// A required field must be present and non-empty.  An allowed-values field,
+// if present, may only contain the listed values; for a list-valued field,
+// every element must be listed.
+
+const PROJECT_SCHEMA_FILE_NAME = "project_schema.yml"
+
+type SchemaRules struct {
+	Required []string
+	Allowed  map[string][]string
+}
+
+type Schema struct {
+	Project SchemaRules
+	Pkg     SchemaRules
+}
+
+// A single way in which a file fails to conform to the project schema.
+type SchemaViolation struct {
+	Path string
+	Text string
+}
+
+func (sv SchemaViolation) String() string {
+	return fmt.Sprintf("%s: %s", sv.Path, sv.Text)
+}
+
+func readSchemaRules(v *viper.Viper, prefix string) SchemaRules {
+	rules := SchemaRules{
+		Required: v.GetStringSlice(prefix + ".required"),
+		Allowed:  map[string][]string{},
+	}
+
+	for field, vals := range cast.ToStringMap(v.Get(prefix + ".allowed")) {
+		rules.Allowed[field] = cast.ToStringSlice(vals)
+	}
+
+	return rules
+}
+
+// Reads the project's schema.  The boolean is false if the project does not
+// declare one.
+func (proj *Project) Schema() (Schema, bool, error) {
+	path := proj.BasePath + "/" + PROJECT_SCHEMA_FILE_NAME
+	if util.NodeNotExist(path) {
+		return Schema{}, false, nil
+	}
+
+	v, err := util.ReadConfig(proj.BasePath,
+		strings.TrimSuffix(PROJECT_SCHEMA_FILE_NAME, ".yml"))
+	if err != nil {
+		return Schema{}, false, err
+	}
+
+	schema := Schema{
+		Project: readSchemaRules(v, "project"),
+		Pkg:     readSchemaRules(v, "pkg"),
+	}
+
+	return schema, true, nil
+}
+
+func fieldStrings(val interface{}) []string {
+	switch val.(type) {
+	case []interface{}, []string:
+		return cast.ToStringSlice(val)
+	default:
+		return []string{cast.ToString(val)}
+	}
+}
+
+func fieldEmpty(val interface{}) bool {
+	if val == nil {
+		return true
+	}
+	if m, ok := val.(map[string]interface{}); ok {
+		return len(m) == 0
+	}
+
+	for _, s := range fieldStrings(val) {
+		if strings.TrimSpace(s) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func valueAllowed(allowed []string, val string) bool {
+	for _, a := range allowed {
+		if a == val {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks a single configuration file against a set of schema rules.
+func (rules SchemaRules) Check(path string,
+	v *viper.Viper) []SchemaViolation {
+
+	violations := []SchemaViolation{}
+
+	for _, field := range rules.Required {
+		if fieldEmpty(v.Get(field)) {
+			violations = append(violations, SchemaViolation{
+				Path: path,
+				Text: fmt.Sprintf("missing required field %s", field),
+			})
+		}
+	}
+
+	fields := make([]string, 0, len(rules.Allowed))
+	for field, _ := range rules.Allowed {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		val := v.Get(field)
+		if val == nil {
+			continue
+		}
+
+		allowed := rules.Allowed[field]
+		for _, s := range fieldStrings(val) {
+			if !valueAllowed(allowed, s) {
+				violations = append(violations, SchemaViolation{
+					Path: path,
+					Text: fmt.Sprintf(
+						"field %s has disallowed value \"%s\"; "+
+							"allowed values: %s",
+						field, s, strings.Join(allowed, ", ")),
+				})
+			}
+		}
+	}
+
+	return violations
+}
+
+// Checks project.yml and the pkg.yml file of each package against the
+// schema.  Unless allRepos is set, only packages in the local repo are
+// checked.
+func (proj *Project) Validate(schema Schema,
+	allRepos bool) []SchemaViolation {
+
+	violations := schema.Project.Check(
+		proj.BasePath+"/"+PROJECT_FILE_NAME, proj.v)
+
+	lpkgs := []*pkg.LocalPackage{}
+	for _, pack := range proj.PackagesOfType(-1) {
+		lpkg := pack.(*pkg.LocalPackage)
+		if allRepos || lpkg.Repo().IsLocal() {
+			lpkgs = append(lpkgs, lpkg)
+		}
+	}
+
+	for _, lpkg := range pkg.SortLclPkgs(lpkgs) {
+		violations = append(violations, schema.Pkg.Check(
+			lpkg.BasePath()+"/"+pkg.PACKAGE_FILE_NAME, lpkg.PkgV)...)
+	}
+
+	return violations
+}
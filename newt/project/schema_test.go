@@ -0,0 +1,135 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+)
+
+const testSchemaYml = `project.required:
+    - project.license
+pkg.required:
+    - pkg.description
+pkg.allowed:
+    pkg.type: [lib, app, target]
+    pkg.keywords: [log, stats, ble]
+`
+
+// Creates a project from a list of (path, contents) pairs and loads it.
+func testSchemaProject(t *testing.T, files ...string) string {
+	dir, err := ioutil.TempDir("", "newt-schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i+1 < len(files); i += 2 {
+		path := filepath.Join(dir, files[i])
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(files[i+1]), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := InitProject(dir); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestValidateSchema(t *testing.T) {
+	defer interfaces.SetProject(interfaces.GetProject())
+	defer ResetProject()
+
+	dir := testSchemaProject(t,
+		"project.yml", "project.name: test\n",
+		PROJECT_SCHEMA_FILE_NAME, testSchemaYml,
+		"apps/blinky/pkg.yml", "pkg.name: apps/blinky\n"+
+			"pkg.type: app\n"+
+			"pkg.description: Blinks an LED.\n",
+		"sys/log/pkg.yml", "pkg.name: sys/log\n"+
+			"pkg.keywords:\n"+
+			"    - log\n"+
+			"    - logging\n",
+		"sys/stats/pkg.yml", "pkg.name: sys/stats\n"+
+			"pkg.type: sdk\n"+
+			"pkg.description: \"\"\n",
+	)
+	defer os.RemoveAll(dir)
+
+	proj := GetProject()
+	schema, ok, err := proj.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatalf("project schema not found")
+	}
+
+	exp := []string{
+		"project.yml: missing required field project.license",
+		"sys/log/pkg.yml: missing required field pkg.description",
+		"sys/log/pkg.yml: field pkg.keywords has disallowed value " +
+			"\"logging\"; allowed values: log, stats, ble",
+		"sys/stats/pkg.yml: missing required field pkg.description",
+		"sys/stats/pkg.yml: field pkg.type has disallowed value \"sdk\"; " +
+			"allowed values: lib, app, target",
+	}
+
+	act := []string{}
+	for _, sv := range proj.Validate(schema, false) {
+		act = append(act, strings.TrimPrefix(sv.String(), proj.BasePath+"/"))
+	}
+
+	if !reflect.DeepEqual(act, exp) {
+		t.Errorf("wrong violations:\nwant=%s\nhave=%s",
+			strings.Join(exp, "\n     "), strings.Join(act, "\n     "))
+	}
+}
+
+func TestValidateNoSchema(t *testing.T) {
+	defer interfaces.SetProject(interfaces.GetProject())
+	defer ResetProject()
+
+	dir := testSchemaProject(t,
+		"project.yml", "project.name: test\n",
+		"sys/log/pkg.yml", "pkg.name: sys/log\n",
+	)
+	defer os.RemoveAll(dir)
+
+	_, ok, err := GetProject().Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Errorf("schema reported for project without %s",
+			PROJECT_SCHEMA_FILE_NAME)
+	}
+}
@@ -0,0 +1,151 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package repo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/util"
+)
+
+// A version requirement one repository (or the project) places on another.
+type VersionRequester struct {
+	// The name of the requesting repository; "project.yml" for
+	// requirements listed in the project file.
+	Name string
+	Reqs string
+}
+
+// A repository whose combined version requirements no version in its
+// repository description satisfies.
+type VersionConflict struct {
+	RepoName   string
+	Requesters []VersionRequester
+}
+
+func (vc VersionConflict) String() string {
+	strs := make([]string, len(vc.Requesters))
+	for i, r := range vc.Requesters {
+		strs[i] = fmt.Sprintf("%s requires %s", r.Name, r.Reqs)
+	}
+
+	return fmt.Sprintf("no version of %s satisfies every requirement: %s",
+		vc.RepoName, strings.Join(strs, "; "))
+}
+
+func (rd *RepoDependency) VersionRequirementsString() string {
+	str := ""
+	for _, vreq := range rd.versreq {
+		str += vreq.String()
+	}
+
+	return str
+}
+
+type versionRequesterSorter struct {
+	reqs []VersionRequester
+}
+
+func (s versionRequesterSorter) Len() int {
+	return len(s.reqs)
+}
+func (s versionRequesterSorter) Swap(i, j int) {
+	s.reqs[i], s.reqs[j] = s.reqs[j], s.reqs[i]
+}
+func (s versionRequesterSorter) Less(i, j int) bool {
+	return s.reqs[i].Name < s.reqs[j].Name
+}
+
+// Collects the version requirements that the specified repositories place on
+// each other and determines which cannot be satisfied together.  A
+// repository's requirements are only checked if its repository description
+// has been downloaded.  The result is sorted by repository name.
+func VersionConflicts(checkRepos map[string]*Repo) []VersionConflict {
+	reqMap := map[string][]interfaces.VersionReqInterface{}
+	requesterMap := map[string][]VersionRequester{}
+
+	for _, r := range checkRepos {
+		requester := r.Name()
+		if r.IsLocal() {
+			requester = "project.yml"
+		}
+
+		for _, rd := range r.Deps() {
+			reqMap[rd.Name()] = append(reqMap[rd.Name()], rd.versreq...)
+			requesterMap[rd.Name()] = append(requesterMap[rd.Name()],
+				VersionRequester{
+					Name: requester,
+					Reqs: rd.VersionRequirementsString(),
+				})
+		}
+	}
+
+	names := make([]string, 0, len(reqMap))
+	for name, _ := range reqMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	conflicts := []VersionConflict{}
+	for _, name := range names {
+		r := checkRepos[name]
+		if r == nil || r.rdesc == nil {
+			continue
+		}
+
+		satisfied := false
+		for vers, _ := range r.rdesc.vers {
+			if r.rdesc.SatisfiesVersion(vers, reqMap[name]) {
+				satisfied = true
+				break
+			}
+		}
+
+		if !satisfied {
+			requesters := requesterMap[name]
+			sort.Sort(versionRequesterSorter{requesters})
+			conflicts = append(conflicts, VersionConflict{
+				RepoName:   name,
+				Requesters: requesters,
+			})
+		}
+	}
+
+	return conflicts
+}
+
+// Returns an error describing each unsatisfiable combination of version
+// requirements; nil if there are none.
+func CheckVersionConflicts(checkRepos map[string]*Repo) error {
+	conflicts := VersionConflicts(checkRepos)
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	errText := "Conflicting repository version requirements detected:\n"
+	for _, c := range conflicts {
+		errText += fmt.Sprintf("    * %s\n", c.String())
+	}
+
+	return util.NewNewtError(strings.TrimSpace(errText))
+}
@@ -0,0 +1,149 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package repo
+
+import (
+	"strings"
+	"testing"
+)
+
+// Creates a repository whose description lists the specified versions.  Each
+// element of deps is a "<repo-name> <requirements>" pair.
+func testConflictRepo(t *testing.T, name string, local bool,
+	versions []string, deps ...string) *Repo {
+
+	r := &Repo{
+		name:  name,
+		local: local,
+	}
+
+	if versions != nil {
+		versMap := map[string]string{}
+		for _, v := range versions {
+			versMap[v] = "v" + strings.Replace(v, ".", "_", -1)
+		}
+
+		rdesc, err := NewRepoDesc(name, versMap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.rdesc = rdesc
+	}
+
+	for _, dep := range deps {
+		fields := strings.SplitN(dep, " ", 2)
+		rd, err := NewRepoDependency(fields[0], fields[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.AddDependency(rd)
+	}
+
+	return r
+}
+
+func TestVersionConflicts(t *testing.T) {
+	tests := []struct {
+		name      string
+		repos     []*Repo
+		conflicts []string
+	}{
+		{
+			name: "compatible",
+			repos: []*Repo{
+				testConflictRepo(t, "test", true, nil,
+					"apache-mynewt-core >=1.0.0",
+					"apache-mynewt-nimble >=1.0.0"),
+				testConflictRepo(t, "apache-mynewt-core", false,
+					[]string{"1.0.0", "1.1.0", "1.2.0"}),
+				testConflictRepo(t, "apache-mynewt-nimble", false,
+					[]string{"1.0.0"},
+					"apache-mynewt-core >=1.2.0"),
+			},
+			conflicts: []string{},
+		},
+		{
+			name: "incompatible",
+			repos: []*Repo{
+				testConflictRepo(t, "test", true, nil,
+					"apache-mynewt-core >=1.0.0",
+					"apache-mynewt-nimble >=1.0.0",
+					"mcuboot >=1.0.0"),
+				testConflictRepo(t, "apache-mynewt-core", false,
+					[]string{"1.0.0", "1.1.0", "1.2.0"}),
+				testConflictRepo(t, "apache-mynewt-nimble", false,
+					[]string{"1.0.0"},
+					"apache-mynewt-core >=1.2.0"),
+				testConflictRepo(t, "mcuboot", false,
+					[]string{"1.0.0"},
+					"apache-mynewt-core <1.1.0"),
+			},
+			conflicts: []string{
+				"no version of apache-mynewt-core satisfies every " +
+					"requirement: apache-mynewt-nimble requires " +
+					">=1.2.0-none; mcuboot requires <1.1.0-none; " +
+					"project.yml requires >=1.0.0-none",
+			},
+		},
+		{
+			name: "description not downloaded",
+			repos: []*Repo{
+				testConflictRepo(t, "test", true, nil,
+					"apache-mynewt-core >=3.0.0"),
+				testConflictRepo(t, "apache-mynewt-core", false, nil),
+			},
+			conflicts: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		repos := map[string]*Repo{}
+		for _, r := range test.repos {
+			repos[r.Name()] = r
+		}
+
+		conflicts := []string{}
+		for _, c := range VersionConflicts(repos) {
+			conflicts = append(conflicts, c.String())
+		}
+
+		if strings.Join(conflicts, "\n") !=
+			strings.Join(test.conflicts, "\n") {
+
+			t.Errorf("%s: wrong conflicts:\nwant=%q\nhave=%q",
+				test.name, test.conflicts, conflicts)
+		}
+
+		err := CheckVersionConflicts(repos)
+		if len(test.conflicts) == 0 && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+		}
+		if len(test.conflicts) > 0 {
+			if err == nil {
+				t.Errorf("%s: expected error; none reported", test.name)
+			} else if !strings.Contains(err.Error(),
+				"    * "+test.conflicts[0]) {
+
+				t.Errorf("%s: conflict missing from error: %s",
+					test.name, err.Error())
+			}
+		}
+	}
+}
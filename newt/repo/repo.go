@@ -155,10 +155,11 @@ func CheckDeps(upgrade bool, checkRepos map[string]*Repo) error {
 			for _, curVers := range depVersList {
 				if depVers.CompareVersions(depVers, curVers) != 0 ||
 					depVers.Stability() != curVers.Stability() {
-					return util.NewNewtError(fmt.Sprintf(
-						"Conflict detected.  Repository %s has multiple dependency versions on %s. "+
-							"Notion of repository version is %s, whereas required is %s ",
-						repoName, curVers, depVers))
+					return util.FmtNewtError(
+						"Conflict detected.  Multiple dependency versions "+
+							"on repository %s.  Notion of repository "+
+							"version is %s, whereas required is %s",
+						repoName, curVers, depVers)
 				}
 			}
 		}
@@ -0,0 +1,127 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package repo
+
+import (
+	"os/exec"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// The state of a repository's working copy.
+type RepoStatus struct {
+	Name string
+
+	// False if the repository directory does not exist.
+	Installed bool
+
+	// False if the repository is not a git working copy; the remaining git
+	// fields are then unset.
+	IsGit bool
+
+	// Current branch, or "" if HEAD is detached.
+	Branch string
+	Commit string
+
+	// Whether the working copy contains uncommitted changes.
+	Dirty bool
+
+	// Version recorded in project.state, and the branch or tag that version
+	// maps to in the repository description.  Unset for the local repository
+	// and for repositories without an installed version.
+	Version  *Version
+	Expected string
+
+	// Whether HEAD is the commit that Expected refers to.
+	Matches bool
+}
+
+// Runs a git command in the specified directory and returns its trimmed
+// output.
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	o, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", util.FmtNewtError("git %s failed in %s: %s",
+			strings.Join(args, " "), dir, strings.TrimSpace(string(o)))
+	}
+
+	return strings.TrimSpace(string(o)), nil
+}
+
+// Determines the state of the repository's working copy.  vers is the version
+// installed according to the project state; it may be nil.  A missing or
+// non-git repository directory is not an error; it is reported in the
+// returned status.
+func (r *Repo) Status(vers *Version) (RepoStatus, error) {
+	rs := RepoStatus{
+		Name:    r.Name(),
+		Version: vers,
+	}
+
+	if util.NodeNotExist(r.Path()) {
+		return rs, nil
+	}
+	rs.Installed = true
+
+	// Only a directory at the root of a working copy counts; a repository
+	// nested inside some other working copy is not under git control itself.
+	if util.NodeNotExist(r.Path() + "/.git") {
+		return rs, nil
+	}
+	rs.IsGit = true
+
+	var err error
+	rs.Commit, err = gitOutput(r.Path(), "rev-parse", "HEAD")
+	if err != nil {
+		return rs, err
+	}
+
+	branch, err := gitOutput(r.Path(), "symbolic-ref", "-q", "--short",
+		"HEAD")
+	if err == nil {
+		rs.Branch = branch
+	}
+
+	changes, err := gitOutput(r.Path(), "status", "--porcelain")
+	if err != nil {
+		return rs, err
+	}
+	rs.Dirty = changes != ""
+
+	if vers != nil && !r.IsLocal() {
+		if _, _, err := r.ReadDesc(); err == nil {
+			rs.Expected, _, _ = r.rdesc.MatchVersion(vers)
+		}
+	}
+
+	if rs.Expected != "" {
+		expCommit, err := gitOutput(r.Path(), "rev-parse", "-q", "--verify",
+			rs.Expected+"^{commit}")
+		if err == nil {
+			rs.Matches = expCommit == rs.Commit
+		}
+	}
+
+	return rs, nil
+}
@@ -0,0 +1,220 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+)
+
+type testStatusProject struct {
+	dir string
+}
+
+func (proj *testStatusProject) Name() string {
+	return "test"
+}
+func (proj *testStatusProject) Path() string {
+	return proj.dir
+}
+func (proj *testStatusProject) ResolveDependency(
+	dep interfaces.DependencyInterface) interfaces.PackageInterface {
+
+	return nil
+}
+func (proj *testStatusProject) ResolvePath(
+	basePath string, name string) (string, error) {
+
+	return filepath.Join(basePath, name), nil
+}
+func (proj *testStatusProject) PackageList() interfaces.PackageList {
+	return nil
+}
+
+func runTestGit(t *testing.T, dir string, args ...string) {
+	args = append([]string{
+		"-c", "user.name=newt", "-c", "user.email=newt@example.com",
+	}, args...)
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if o, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %s: %s", args, err.Error(), string(o))
+	}
+}
+
+func writeTestFile(t *testing.T, path string, contents string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Creates a git working copy containing two commits on the "develop"
+// branch.  The first commit is tagged "v1_0_0".
+func initTestGitRepo(t *testing.T, dir string) {
+	writeTestFile(t, filepath.Join(dir, "README"), "first\n")
+	runTestGit(t, dir, "init", "-q")
+	runTestGit(t, dir, "checkout", "-q", "-b", "develop")
+	runTestGit(t, dir, "add", "README")
+	runTestGit(t, dir, "commit", "-q", "-m", "first")
+	runTestGit(t, dir, "tag", "v1_0_0")
+
+	writeTestFile(t, filepath.Join(dir, "README"), "second\n")
+	runTestGit(t, dir, "commit", "-q", "-a", "-m", "second")
+}
+
+func TestRepoStatus(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	dir, err := ioutil.TempDir("", "newt-status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer interfaces.SetProject(interfaces.GetProject())
+	interfaces.SetProject(&testStatusProject{dir})
+
+	for _, name := range []string{"tagged", "ahead", "dirty", "detached"} {
+		writeTestFile(t, filepath.Join(dir, REPOS_DIR, ".configs", name,
+			REPO_FILE_NAME),
+			"repo.name: "+name+"\n"+
+				"repo.versions:\n"+
+				"    \"1.0.0\": v1_0_0\n"+
+				"    \"2.0.0\": v2_0_0\n")
+		initTestGitRepo(t, filepath.Join(dir, REPOS_DIR, name))
+	}
+
+	runTestGit(t, filepath.Join(dir, REPOS_DIR, "tagged"),
+		"checkout", "-q", "-B", "develop", "v1_0_0")
+	writeTestFile(t, filepath.Join(dir, REPOS_DIR, "dirty", "README"),
+		"modified\n")
+	runTestGit(t, filepath.Join(dir, REPOS_DIR, "detached"),
+		"checkout", "-q", "--detach", "v1_0_0")
+
+	writeTestFile(t, filepath.Join(dir, REPOS_DIR, "plain", "README"),
+		"not under git\n")
+
+	tests := []struct {
+		name     string
+		vers     string
+		expected RepoStatus
+	}{
+		{
+			name: "tagged",
+			vers: "1.0.0",
+			expected: RepoStatus{
+				Installed: true,
+				IsGit:     true,
+				Branch:    "develop",
+				Expected:  "v1_0_0",
+				Matches:   true,
+			},
+		},
+		{
+			name: "ahead",
+			vers: "1.0.0",
+			expected: RepoStatus{
+				Installed: true,
+				IsGit:     true,
+				Branch:    "develop",
+				Expected:  "v1_0_0",
+				Matches:   false,
+			},
+		},
+		{
+			name: "dirty",
+			vers: "2.0.0",
+			expected: RepoStatus{
+				Installed: true,
+				IsGit:     true,
+				Branch:    "develop",
+				Dirty:     true,
+				Expected:  "v2_0_0",
+				Matches:   false,
+			},
+		},
+		{
+			name: "detached",
+			expected: RepoStatus{
+				Installed: true,
+				IsGit:     true,
+			},
+		},
+		{
+			name: "plain",
+			vers: "1.0.0",
+			expected: RepoStatus{
+				Installed: true,
+			},
+		},
+		{
+			name:     "missing",
+			expected: RepoStatus{},
+		},
+	}
+
+	for _, test := range tests {
+		r, err := NewRepo(test.name, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var vers *Version
+		if test.vers != "" {
+			vers, err = LoadVersion(test.vers)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		rs, err := r.Status(vers)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+
+		if rs.IsGit && len(rs.Commit) != 40 {
+			t.Errorf("%s: invalid commit \"%s\"", test.name, rs.Commit)
+		}
+		if rs.Version != vers {
+			t.Errorf("%s: wrong version", test.name)
+		}
+
+		exp := test.expected
+		exp.Name = test.name
+		exp.Commit = rs.Commit
+		exp.Version = rs.Version
+		if rs != exp {
+			t.Errorf("%s: wrong status: want=%+v have=%+v",
+				test.name, exp, rs)
+		}
+	}
+}
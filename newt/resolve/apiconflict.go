@@ -0,0 +1,116 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package resolve
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/pkg"
+)
+
+// Multiple packages in the dependency closure that provide the same API.
+type ApiConflict struct {
+	Api       string
+	Providers []*pkg.LocalPackage
+
+	// The provider selected by an explicit preference; nil if no preference
+	// names one of the providers.
+	Preferred *pkg.LocalPackage
+}
+
+func lpkgMatchesName(lpkg *pkg.LocalPackage, name string) bool {
+	return lpkg.FullName() == name || lpkg.Name() == name
+}
+
+// Identifies every API provided by more than one package in the resolved
+// dependency closure.  Conflicts are sorted by API name.
+func (r *Resolver) detectApiConflicts(
+	apiPrefs map[string]string) []ApiConflict {
+
+	providers := map[string][]*pkg.LocalPackage{}
+
+	lpkgs := pkg.SortLclPkgs(r.lpkgSlice())
+	for _, lpkg := range lpkgs {
+		features := r.cfg.FeaturesForLpkg(lpkg)
+		apis := newtutil.GetStringSliceFeatures(lpkg.PkgV, features,
+			"pkg.apis")
+		for _, api := range apis {
+			providers[api] = append(providers[api], lpkg)
+		}
+	}
+
+	apis := make([]string, 0, len(providers))
+	for api, _ := range providers {
+		apis = append(apis, api)
+	}
+	sort.Strings(apis)
+
+	conflicts := []ApiConflict{}
+	for _, api := range apis {
+		if len(providers[api]) <= 1 {
+			continue
+		}
+
+		conflict := ApiConflict{
+			Api:       api,
+			Providers: providers[api],
+		}
+		if prefName, ok := apiPrefs[api]; ok {
+			for _, lpkg := range conflict.Providers {
+				if lpkgMatchesName(lpkg, prefName) {
+					conflict.Preferred = lpkg
+				}
+			}
+		}
+
+		conflicts = append(conflicts, conflict)
+	}
+
+	return conflicts
+}
+
+// Produces the error text for API conflicts that have not been resolved by
+// a preference.
+func (cfgResolution *CfgResolution) apiConflictErrorText() string {
+	str := ""
+
+	for _, conflict := range cfgResolution.ApiConflicts {
+		if conflict.Preferred != nil {
+			continue
+		}
+
+		names := make([]string, len(conflict.Providers))
+		for i, lpkg := range conflict.Providers {
+			names[i] = lpkg.FullName()
+		}
+		str += fmt.Sprintf("    * %s, provided by: %s\n", conflict.Api,
+			strings.Join(names, ", "))
+	}
+
+	if str == "" {
+		return ""
+	}
+
+	return "API provider conflicts detected (specify a preference with " +
+		"target.api_prefs):\n" + str
+}
@@ -0,0 +1,158 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package resolve
+
+import (
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/repo"
+)
+
+func testApiPkg(name string, key string, apis ...string) *pkg.LocalPackage {
+	lpkg := pkg.NewLocalPackage(&repo.Repo{}, "/test/"+name)
+	lpkg.SetName(name)
+	lpkg.PkgV.Set(key, apis)
+
+	return lpkg
+}
+
+// Two drivers provide the "uart" API, which the app requires.
+func TestApiConflicts(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// Whether the preferred driver is seeded first, making it the
+		// provider the resolver would find first on its own.
+		prefFirst    bool
+		prefs        map[string]string
+		wantProvider string
+		wantErr      string
+	}{
+		{
+			name:    "no preference",
+			prefs:   map[string]string{},
+			wantErr: "uart, provided by: hw/drivers/uart_a, hw/drivers/uart_b",
+		},
+		{
+			name:         "second provider preferred",
+			prefs:        map[string]string{"uart": "hw/drivers/uart_b"},
+			wantProvider: "hw/drivers/uart_b",
+		},
+		{
+			name:         "first provider preferred",
+			prefFirst:    true,
+			prefs:        map[string]string{"uart": "hw/drivers/uart_b"},
+			wantProvider: "hw/drivers/uart_b",
+		},
+		{
+			name:    "preference names neither provider",
+			prefs:   map[string]string{"uart": "hw/drivers/uart_c"},
+			wantErr: "API provider conflicts detected",
+		},
+	}
+
+	for _, test := range tests {
+		app := testApiPkg("apps/console", "pkg.req_apis", "uart")
+		uartA := testApiPkg("hw/drivers/uart_a", "pkg.apis", "uart")
+		uartB := testApiPkg("hw/drivers/uart_b", "pkg.apis", "uart")
+
+		seeds := []*pkg.LocalPackage{app, uartA, uartB}
+		if test.prefFirst {
+			seeds = []*pkg.LocalPackage{app, uartB, uartA}
+		}
+
+		res, err := ResolveCfg(seeds, nil, nil, flash.FlashMap{},
+			test.prefs, nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if len(res.ApiConflicts) != 1 || res.ApiConflicts[0].Api != "uart" ||
+			len(res.ApiConflicts[0].Providers) != 2 {
+
+			t.Errorf("%s: conflicts=%+v; want one for uart", test.name,
+				res.ApiConflicts)
+			continue
+		}
+
+		errText := res.apiConflictErrorText()
+		if test.wantErr != "" {
+			if !strings.Contains(errText, test.wantErr) {
+				t.Errorf("%s: error text=\"%s\"; want \"%s\"",
+					test.name, errText, test.wantErr)
+			}
+			continue
+		}
+
+		if errText != "" {
+			t.Errorf("%s: unexpected error text: %s", test.name, errText)
+		}
+
+		// The preference is applied to the resolution itself, not just to
+		// the conflict report.
+		if got := res.ApiMap["uart"]; got == nil ||
+			got.Name() != test.wantProvider {
+
+			t.Errorf("%s: uart provided by %v; want %s",
+				test.name, got, test.wantProvider)
+		}
+	}
+}
+
+// The resolver's own API map, which API requirements are satisfied from,
+// honors the preference regardless of the order providers are found in.
+func TestAddApiPreferred(t *testing.T) {
+	uartA := newResolvePkg(testApiPkg("hw/drivers/uart_a", "pkg.apis", "uart"))
+	uartB := newResolvePkg(testApiPkg("hw/drivers/uart_b", "pkg.apis", "uart"))
+
+	tests := []struct {
+		name  string
+		order []*ResolvePackage
+		prefs map[string]string
+		want  *ResolvePackage
+	}{
+		{"first found", []*ResolvePackage{uartA, uartB}, nil, uartA},
+		{"preferred found second", []*ResolvePackage{uartA, uartB},
+			map[string]string{"uart": "hw/drivers/uart_b"}, uartB},
+		{"preferred found first", []*ResolvePackage{uartB, uartA},
+			map[string]string{"uart": "hw/drivers/uart_b"}, uartB},
+	}
+
+	for _, test := range tests {
+		r := newResolver()
+		r.apiPrefs = test.prefs
+
+		for i, rpkg := range test.order {
+			if isNew := r.addApi("uart", rpkg); isNew != (i == 0) {
+				t.Errorf("%s: addApi(%s) new=%v", test.name, rpkg.Name(),
+					isNew)
+			}
+		}
+
+		if got := r.apis["uart"]; got != test.want {
+			t.Errorf("%s: uart provided by %s; want %s", test.name,
+				got.Name(), test.want.Name())
+		}
+	}
+}
@@ -0,0 +1,176 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package resolve
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/util"
+)
+
+// The packages of the project used by TestExcludePkgs.  The app requires the
+// "console" API, which only the UART console driver provides.
+var testExcludePkgYmls = map[string]string{
+	"apps/blinky": `pkg.name: apps/blinky
+pkg.type: app
+pkg.deps:
+    - sys/log
+    - hw/drivers/uart_console
+pkg.req_apis:
+    - console
+`,
+	"sys/log": `pkg.name: sys/log
+pkg.deps:
+    - sys/stats
+`,
+	"sys/stats": `pkg.name: sys/stats
+`,
+	"hw/drivers/uart_console": `pkg.name: hw/drivers/uart_console
+pkg.apis:
+    - console
+`,
+}
+
+// Creates a project containing the specified packages and makes it the global
+// project.  The caller must remove the returned directory and reset the
+// project.
+func testExcludeProject(t *testing.T, pkgYmls map[string]string) string {
+	dir, err := ioutil.TempDir("", "newt-resolve")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"project.yml": "project.name: test\n",
+	}
+	for name, yml := range pkgYmls {
+		files[filepath.Join(name, "pkg.yml")] = yml
+	}
+
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := project.InitProject(dir); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestExcludePkgs(t *testing.T) {
+	defer interfaces.SetProject(interfaces.GetProject())
+
+	dir := testExcludeProject(t, testExcludePkgYmls)
+	defer os.RemoveAll(dir)
+	defer project.ResetProject()
+
+	proj := project.GetProject()
+	app, err := proj.ResolvePackage(proj.LocalRepo(), "apps/blinky")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeds := []*pkg.LocalPackage{app}
+
+	tests := []struct {
+		name     string
+		excludes []string
+		wantPkgs []string
+		wantErr  string
+	}{
+		{
+			name: "nothing excluded",
+			wantPkgs: []string{"apps/blinky", "hw/drivers/uart_console",
+				"sys/log", "sys/stats"},
+		},
+		{
+			name:     "transitive dependency excluded",
+			excludes: []string{"sys/stats"},
+			wantPkgs: []string{"apps/blinky", "hw/drivers/uart_console",
+				"sys/log"},
+		},
+		{
+			name:     "API provider excluded",
+			excludes: []string{"hw/drivers/uart_console"},
+			wantErr: "console, required by: apps/blinky\n" +
+				"    (target excludes: hw/drivers/uart_console)",
+		},
+		{
+			name:     "seed package excluded",
+			excludes: []string{"apps/blinky"},
+			wantErr:  "Cannot exclude package apps/blinky",
+		},
+	}
+
+	for _, test := range tests {
+		res, err := ResolveCfg(seeds, nil, nil, flash.FlashMap{}, nil,
+			test.excludes)
+		if err == nil {
+			if errText := res.ErrorText(); errText != "" {
+				err = util.NewNewtError(errText)
+			}
+		}
+
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error=%v; want \"%s\"", test.name, err,
+					test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		lpkgs, err := ResolvePkgs(res, seeds)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		names := []string{}
+		for _, lpkg := range lpkgs {
+			names = append(names, lpkg.Name())
+		}
+		sort.Strings(names)
+
+		if strings.Join(names, " ") != strings.Join(test.wantPkgs, " ") {
+			t.Errorf("%s: resolved=%v; want %v", test.name, names,
+				test.wantPkgs)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package resolve
+
+import (
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/repo"
+)
+
+// Creates a BSP package that defines the specified boolean settings.  The
+// definitions have the types the YAML parser produces.
+func testFeatureBsp(settings map[string]int) *pkg.LocalPackage {
+	lpkg := pkg.NewLocalPackage(&repo.Repo{}, "/test/hw/bsp/nrf52dk")
+	lpkg.SetName("hw/bsp/nrf52dk")
+
+	defs := map[string]interface{}{}
+	for name, val := range settings {
+		defs[name] = map[interface{}]interface{}{
+			"description": "Test setting",
+			"value":       val,
+		}
+	}
+	lpkg.SyscfgV.Set("syscfg.defs", defs)
+
+	return lpkg
+}
+
+func TestRequiredFeatures(t *testing.T) {
+	bspSettings := map[string]int{
+		"BSP_UART": 1,
+		"BSP_SPI":  0,
+	}
+
+	tests := []struct {
+		name        string
+		required    []string
+		wantMissing []string
+	}{
+		{"none required", nil, nil},
+		{"provided by BSP", []string{"BSP_UART"}, nil},
+		{"disabled by BSP", []string{"BSP_SPI", "BSP_UART"},
+			[]string{"BSP_SPI"}},
+		{"unknown to BSP", []string{"BSP_USB", "BSP_BLE"},
+			[]string{"BSP_BLE", "BSP_USB"}},
+	}
+
+	for _, test := range tests {
+		res, err := ResolveCfg(
+			[]*pkg.LocalPackage{testFeatureBsp(bspSettings)}, nil, nil,
+			flash.FlashMap{}, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		res.CheckRequiredFeatures(test.required)
+
+		if strings.Join(res.MissingFeatures, " ") !=
+			strings.Join(test.wantMissing, " ") {
+
+			t.Errorf("%s: missing=%v; want %v", test.name,
+				res.MissingFeatures, test.wantMissing)
+		}
+
+		errText := res.ErrorText()
+		if len(test.wantMissing) == 0 {
+			if strings.Contains(errText, "requires features") {
+				t.Errorf("%s: unexpected error text: %s", test.name,
+					errText)
+			}
+			continue
+		}
+
+		if !strings.Contains(errText,
+			"Target requires features that are not enabled") {
+
+			t.Errorf("%s: error text lacks missing features: %s",
+				test.name, errText)
+		}
+		for _, f := range test.wantMissing {
+			if !strings.Contains(errText, "* "+f) {
+				t.Errorf("%s: error text does not name %s: %s",
+					test.name, f, errText)
+			}
+		}
+	}
+}
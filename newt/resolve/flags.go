@@ -0,0 +1,175 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package resolve
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/pkg"
+)
+
+// Characters which have special meaning to the shell; a flag containing any
+// of these is almost certainly a typo.
+const flagShellMetachars = ";|&$`<>"
+
+// Package settings which contain flags that get passed to the toolchain.
+var flagSettings = []string{
+	"pkg.cflags",
+	"pkg.lflags",
+	"pkg.aflags",
+}
+
+// Options whose argument is passed as the following token (e.g.,
+// "-include foo.h").  The argument is not itself a flag.
+var flagArgOptions = map[string]bool{
+	"-include": true,
+	"-imacros": true,
+	"-isystem": true,
+	"-iquote":  true,
+	"-I":       true,
+	"-L":       true,
+	"-T":       true,
+	"-x":       true,
+	"-MF":      true,
+	"-MT":      true,
+	"-o":       true,
+}
+
+type FlagProblem struct {
+	Lpkg    *pkg.LocalPackage
+	Setting string
+	Text    string
+}
+
+// Checks the shape of a single flag.  An empty string is returned if the flag
+// is well-formed.  The value of a macro definition (-D<name>=<value>) may
+// contain any characters; only the name is checked for shell metacharacters.
+func flagShapeError(flag string) string {
+	if !strings.HasPrefix(flag, "-") {
+		return fmt.Sprintf("flag \"%s\" does not begin with '-'", flag)
+	}
+
+	checked := flag
+	if strings.HasPrefix(flag, "-D") {
+		checked = strings.SplitN(flag, "=", 2)[0]
+	}
+
+	if i := strings.IndexAny(checked, flagShellMetachars); i != -1 {
+		return fmt.Sprintf("flag \"%s\" contains shell metacharacter '%c'",
+			flag, checked[i])
+	}
+
+	return ""
+}
+
+// Checks the shape of each flag in a package's flag list.  The token
+// following an option that takes a separate argument is treated as that
+// argument rather than as a flag.
+func flagShapeErrors(flags []string) []string {
+	errs := []string{}
+
+	for i := 0; i < len(flags); i++ {
+		flag := flags[i]
+		if text := flagShapeError(flag); text != "" {
+			errs = append(errs, text)
+			continue
+		}
+
+		if flagArgOptions[flag] {
+			if i+1 >= len(flags) {
+				errs = append(errs, fmt.Sprintf(
+					"flag \"%s\" requires an argument", flag))
+			}
+			i++
+		}
+	}
+
+	return errs
+}
+
+// Detects optimization flags which override one another (e.g., "-O0 -O2").
+func flagOptConflict(flags []string) string {
+	levels := []string{}
+	for _, flag := range flags {
+		if strings.HasPrefix(flag, "-O") {
+			if len(levels) == 0 || levels[len(levels)-1] != flag {
+				levels = append(levels, flag)
+			}
+		}
+	}
+
+	if len(levels) <= 1 {
+		return ""
+	}
+
+	return fmt.Sprintf("conflicting optimization levels: %s",
+		strings.Join(levels, " "))
+}
+
+// Examines the toolchain flags specified by each resolved package.  Malformed
+// flags are reported as errors; flags that conflict with one another are
+// reported as warnings.
+func (r *Resolver) checkFlags() ([]FlagProblem, []FlagProblem) {
+	errs := []FlagProblem{}
+	warnings := []FlagProblem{}
+
+	lpkgs := pkg.SortLclPkgs(r.lpkgSlice())
+
+	for _, lpkg := range lpkgs {
+		features := r.cfg.FeaturesForLpkg(lpkg)
+		for _, setting := range flagSettings {
+			flags := newtutil.GetStringSliceFeatures(lpkg.PkgV, features,
+				setting)
+			for _, text := range flagShapeErrors(flags) {
+				errs = append(errs, FlagProblem{lpkg, setting, text})
+			}
+
+			if text := flagOptConflict(flags); text != "" {
+				warnings = append(warnings,
+					FlagProblem{lpkg, setting, text})
+			}
+		}
+	}
+
+	return errs, warnings
+}
+
+func flagProblemsText(problems []FlagProblem) string {
+	lines := make([]string, len(problems))
+	for i, p := range problems {
+		lines[i] = fmt.Sprintf("    * %s (%s): %s\n", p.Lpkg.Name(),
+			p.Setting, p.Text)
+	}
+	sort.Strings(lines)
+
+	return strings.Join(lines, "")
+}
+
+func (cfgResolution *CfgResolution) FlagWarningText() string {
+	if len(cfgResolution.FlagWarnings) == 0 {
+		return ""
+	}
+
+	return "Package flag warnings:\n" +
+		flagProblemsText(cfgResolution.FlagWarnings)
+}
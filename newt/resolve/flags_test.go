@@ -0,0 +1,158 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package resolve
+
+import (
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/syscfg"
+)
+
+func TestFlagShapeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags []string
+		want  []string
+	}{
+		{
+			name: "plain flags",
+			flags: []string{"-Wall", "-Werror", "-O2",
+				"-DFOO=1", "-std=c99"},
+		},
+		{
+			name: "options with separate arguments",
+			flags: []string{"-include", "foo.h", "-T", "link.ld",
+				"-isystem", "dir", "-x", "c", "-MF", "deps.d",
+				"-I", "include", "-o", "out.o"},
+		},
+		{
+			name:  "metacharacters in define value",
+			flags: []string{"-DX=(1<<2)", "-DLIST=a|b", "-DAMP=&x"},
+		},
+		{
+			name:  "missing dash",
+			flags: []string{"-Wall", "Werror"},
+			want:  []string{"\"Werror\" does not begin with '-'"},
+		},
+		{
+			name:  "metacharacter in flag",
+			flags: []string{"-Wall;rm"},
+			want:  []string{"\"-Wall;rm\" contains shell metacharacter ';'"},
+		},
+		{
+			name:  "metacharacter in define name",
+			flags: []string{"-DA$B=1"},
+			want:  []string{"contains shell metacharacter '$'"},
+		},
+		{
+			name:  "argument is not a flag",
+			flags: []string{"-include", "foo.h", "bar.h"},
+			want:  []string{"\"bar.h\" does not begin with '-'"},
+		},
+		{
+			name:  "missing argument",
+			flags: []string{"-Wall", "-include"},
+			want:  []string{"\"-include\" requires an argument"},
+		},
+	}
+
+	for _, test := range tests {
+		errs := flagShapeErrors(test.flags)
+		if len(errs) != len(test.want) {
+			t.Errorf("%s: got errors %q; want %q", test.name, errs,
+				test.want)
+			continue
+		}
+		for i, want := range test.want {
+			if !strings.Contains(errs[i], want) {
+				t.Errorf("%s: error %d = %q; want it to contain %q",
+					test.name, i, errs[i], want)
+			}
+		}
+	}
+}
+
+func TestFlagOptConflict(t *testing.T) {
+	tests := []struct {
+		flags []string
+		want  string
+	}{
+		{[]string{"-Wall"}, ""},
+		{[]string{"-O2"}, ""},
+		{[]string{"-O2", "-Wall", "-O2"}, ""},
+		{[]string{"-O0", "-O2"}, "conflicting optimization levels: -O0 -O2"},
+		{[]string{"-Os", "-g", "-O3"},
+			"conflicting optimization levels: -Os -O3"},
+	}
+
+	for _, test := range tests {
+		if got := flagOptConflict(test.flags); got != test.want {
+			t.Errorf("%q: got %q; want %q", test.flags, got, test.want)
+		}
+	}
+}
+
+func testFlagsPkg(name string, cflags string) *pkg.LocalPackage {
+	lpkg := pkg.NewLocalPackage(nil, "/test/"+name)
+	lpkg.SetName(name)
+	lpkg.PkgV.Set("pkg.cflags", cflags)
+
+	return lpkg
+}
+
+// Flag problems are reported during resolution: malformed flags as errors,
+// conflicting optimization levels as warnings.
+func TestCheckFlags(t *testing.T) {
+	good := testFlagsPkg("good",
+		"-Wall -include foo.h -T link.ld -DX=(1<<2)")
+	bad := testFlagsPkg("bad", "-O0 Wall -O2")
+
+	r := &Resolver{
+		pkgMap: map[*pkg.LocalPackage]*ResolvePackage{
+			good: &ResolvePackage{LocalPackage: good},
+			bad:  &ResolvePackage{LocalPackage: bad},
+		},
+		cfg: syscfg.NewCfg(),
+	}
+
+	errs, warnings := r.checkFlags()
+
+	if len(errs) != 1 || errs[0].Lpkg != bad ||
+		errs[0].Setting != "pkg.cflags" ||
+		!strings.Contains(errs[0].Text, "\"Wall\" does not begin") {
+
+		t.Errorf("got errors %+v; want one malformed flag in bad", errs)
+	}
+
+	if len(warnings) != 1 || warnings[0].Lpkg != bad ||
+		warnings[0].Text != "conflicting optimization levels: -O0 -O2" {
+
+		t.Errorf("got warnings %+v; want one -O conflict in bad", warnings)
+	}
+
+	text := (&CfgResolution{FlagWarnings: warnings}).FlagWarningText()
+	want := "Package flag warnings:\n    * bad (pkg.cflags): " +
+		"conflicting optimization levels: -O0 -O2\n"
+	if text != want {
+		t.Errorf("warning text %q; want %q", text, want)
+	}
+}
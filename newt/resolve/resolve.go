@@ -38,8 +38,26 @@ type Resolver struct {
 	apis             map[string]*ResolvePackage
 	pkgMap           map[*pkg.LocalPackage]*ResolvePackage
 	injectedSettings map[string]string
+	overrides        map[string]string
 	flashMap         flash.FlashMap
 	cfg              syscfg.Cfg
+
+	// Names of packages that are never added to the resolved set.
+	excludes []string
+
+	// Maps API names to the package that provides the API when multiple
+	// packages do (target.api_prefs).
+	apiPrefs map[string]string
+
+	// Conditional dependencies whose conditions held when they were added,
+	// keyed by depender and dependency.
+	condIncls map[string]condInclusion
+}
+
+// A package pulled in by a conditional dependency.
+type condInclusion struct {
+	depender *pkg.LocalPackage
+	condDep  pkg.CondDep
 }
 
 type ResolvePackage struct {
@@ -56,6 +74,20 @@ type CfgResolution struct {
 	Cfg             syscfg.Cfg
 	ApiMap          map[string]*pkg.LocalPackage
 	UnsatisfiedApis map[string][]*pkg.LocalPackage
+
+	// Malformed and conflicting toolchain flags specified by packages.
+	FlagErrors   []FlagProblem
+	FlagWarnings []FlagProblem
+
+	// APIs provided by more than one package.
+	ApiConflicts []ApiConflict
+
+	// Features required by the target but not enabled by the resolved
+	// configuration.
+	MissingFeatures []string
+
+	// Names of packages removed from the resolved set by the target.
+	Excludes []string
 }
 
 func newResolver() *Resolver {
@@ -64,6 +96,7 @@ func newResolver() *Resolver {
 		pkgMap:           map[*pkg.LocalPackage]*ResolvePackage{},
 		injectedSettings: map[string]string{},
 		cfg:              syscfg.NewCfg(),
+		condIncls:        map[string]condInclusion{},
 	}
 }
 
@@ -106,6 +139,19 @@ func (r *Resolver) apiSlice() []string {
 	return apis
 }
 
+// Indicates whether a package matches any of the specified exclusions.  An
+// exclusion matches either the package's full name or its repo-relative
+// name.
+func PkgExcluded(lpkg *pkg.LocalPackage, excludes []string) bool {
+	for _, name := range excludes {
+		if name == lpkg.FullName() || name == lpkg.Name() {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (r *Resolver) addPkg(lpkg *pkg.LocalPackage) *ResolvePackage {
 	rpkg := newResolvePkg(lpkg)
 	r.pkgMap[lpkg] = rpkg
@@ -119,10 +165,17 @@ func (r *Resolver) addApi(apiString string, rpkg *ResolvePackage) bool {
 		r.apis[apiString] = rpkg
 		return true
 	} else {
+		// Multiple providers are reported as conflicts once resolution
+		// completes.  A preferred provider replaces whichever one was found
+		// first.
 		if curRpkg != rpkg {
-			util.StatusMessage(util.VERBOSITY_QUIET,
-				"Warning: API conflict: %s (%s <-> %s)\n", apiString,
+			log.Debugf("API conflict: %s (%s <-> %s)", apiString,
 				curRpkg.Name(), rpkg.Name())
+
+			prefName, ok := r.apiPrefs[apiString]
+			if ok && lpkgMatchesName(rpkg.LocalPackage, prefName) {
+				r.apis[apiString] = rpkg
+			}
 		}
 		return false
 	}
@@ -190,33 +243,92 @@ func (r *Resolver) satisfyApis(rpkg *ResolvePackage) bool {
 	return newDeps
 }
 
+// Adds the package named by a dependency string to the resolved set.  The
+// returned bool is true if the package was not already present.
+func (r *Resolver) addDepStr(rpkg *ResolvePackage, depStr string) (
+	bool, error) {
+
+	proj := project.GetProject()
+
+	newDep, err := pkg.NewDependency(rpkg.Repo(), depStr)
+	if err != nil {
+		return false, err
+	}
+
+	lpkg, ok := proj.ResolveDependency(newDep).(*pkg.LocalPackage)
+	if !ok {
+		return false,
+			util.FmtNewtError("Could not resolve package dependency: "+
+				"%s; depender: %s", newDep.String(), rpkg.Name())
+	}
+
+	if PkgExcluded(lpkg, r.excludes) {
+		log.Debugf("Excluding package %s; depender: %s", lpkg.Name(),
+			rpkg.Name())
+		return false, nil
+	}
+
+	if r.pkgMap[lpkg] != nil {
+		return false, nil
+	}
+
+	r.addPkg(lpkg)
+	return true, nil
+}
+
+// Identifies conditional dependencies that were pulled in but whose
+// conditions no longer hold under the current configuration.  The results
+// are sorted by description.
+func (r *Resolver) staleCondIncls() []string {
+	stale := []string{}
+	for key, ci := range r.condIncls {
+		if !r.cfg.CondHolds(ci.depender, ci.condDep.Cond) {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(stale)
+
+	return stale
+}
+
 // @return bool                 True if this this function changed the builder
 //                                  state; another full iteration is required
 //                                  in this case.
 //         error                non-nil on failure.
 func (r *Resolver) loadDepsForPkg(rpkg *ResolvePackage) (bool, error) {
-	proj := project.GetProject()
 	features := r.cfg.FeaturesForLpkg(rpkg.LocalPackage)
 
 	changed := false
 
 	newDeps := newtutil.GetStringSliceFeatures(rpkg.PkgV, features, "pkg.deps")
 	for _, newDepStr := range newDeps {
-		newDep, err := pkg.NewDependency(rpkg.Repo(), newDepStr)
+		added, err := r.addDepStr(rpkg, newDepStr)
 		if err != nil {
 			return false, err
 		}
+		if added {
+			changed = true
+		}
+	}
 
-		lpkg, ok := proj.ResolveDependency(newDep).(*pkg.LocalPackage)
-		if !ok {
-			return false,
-				util.FmtNewtError("Could not resolve package dependency: "+
-					"%s; depender: %s", newDep.String(), rpkg.Name())
+	// Conditional dependencies are evaluated against the configuration
+	// determined so far.
+	condDeps, err := r.cfg.CondDepsForLpkg(rpkg.LocalPackage)
+	if err != nil {
+		return false, err
+	}
+	for _, cd := range condDeps {
+		r.condIncls[rpkg.FullName()+" "+cd.String()] = condInclusion{
+			depender: rpkg.LocalPackage,
+			condDep:  cd,
 		}
 
-		if r.pkgMap[lpkg] == nil {
+		added, err := r.addDepStr(rpkg, cd.Dep)
+		if err != nil {
+			return false, err
+		}
+		if added {
 			changed = true
-			r.addPkg(lpkg)
 		}
 	}
 
@@ -279,8 +391,8 @@ func (r *Resolver) reloadCfg() (bool, error) {
 	// required for reloading syscfg, as features may unlock additional
 	// settings.
 	features := r.cfg.Features()
-	cfg, err := syscfg.Read(lpkgs, apis, r.injectedSettings, features,
-		r.flashMap)
+	cfg, err := syscfg.Read(lpkgs, apis, r.injectedSettings, r.overrides,
+		features, r.flashMap)
 	if err != nil {
 		return false, err
 	}
@@ -397,6 +509,7 @@ func ResolvePkgs(cfgResolution CfgResolution,
 
 	r := newResolver()
 	r.cfg = cfgResolution.Cfg
+	r.excludes = cfgResolution.Excludes
 	for _, lpkg := range seedPkgs {
 		r.addPkg(lpkg)
 	}
@@ -466,28 +579,89 @@ func ResolveSplitPkgs(cfgResolution CfgResolution,
 	return
 }
 
+// apiPrefs maps API names to the name of the package that should provide the
+// API when multiple packages do.  Packages named in excludes are left out of
+// the resolved set even if other packages depend on them; APIs they would
+// have provided are reported as unsatisfied.  overrides replace the values of
+// the named settings; each must name a defined setting.
 func ResolveCfg(seedPkgs []*pkg.LocalPackage,
 	injectedSettings map[string]string,
-	flashMap flash.FlashMap) (CfgResolution, error) {
+	overrides map[string]string,
+	flashMap flash.FlashMap,
+	apiPrefs map[string]string,
+	excludes []string) (CfgResolution, error) {
 
 	resolution := newCfgResolution()
+	resolution.Excludes = excludes
+
+	for _, lpkg := range seedPkgs {
+		if PkgExcluded(lpkg, excludes) {
+			return resolution, util.FmtNewtError(
+				"Cannot exclude package %s; it is required by the target",
+				lpkg.FullName())
+		}
+	}
 
-	r := newResolver()
-	r.flashMap = flashMap
 	if injectedSettings == nil {
 		injectedSettings = map[string]string{}
 	}
-	r.injectedSettings = injectedSettings
 
-	for _, lpkg := range seedPkgs {
-		r.addPkg(lpkg)
+	newSeededResolver := func() *Resolver {
+		r := newResolver()
+		r.flashMap = flashMap
+		r.excludes = excludes
+		r.apiPrefs = apiPrefs
+		r.injectedSettings = injectedSettings
+		r.overrides = overrides
+
+		for _, lpkg := range seedPkgs {
+			r.addPkg(lpkg)
+		}
+
+		return r
 	}
 
+	r := newSeededResolver()
 	if err := r.loadDepsAndCfg(); err != nil {
 		return resolution, err
 	}
 
+	// A conditional dependency may have been pulled in before the package
+	// that disables its condition was discovered.  Since resolution never
+	// removes packages, start over, using the configuration just calculated
+	// to evaluate conditions during the initial pass.  If a condition still
+	// fails to hold, including the dependency is what disables it.
+	if stale := r.staleCondIncls(); len(stale) > 0 {
+		prevCfg := r.cfg
+
+		r = newSeededResolver()
+		r.cfg = prevCfg
+		if _, err := r.loadDepsOnce(); err != nil {
+			return resolution, err
+		}
+		r.cfg = syscfg.NewCfg()
+
+		if err := r.loadDepsAndCfg(); err != nil {
+			return resolution, err
+		}
+
+		if stale := r.staleCondIncls(); len(stale) > 0 {
+			return resolution, util.FmtNewtError(
+				"Circular syscfg condition; the following conditional "+
+					"dependencies disable their own conditions:\n    %s",
+				strings.Join(stale, "\n    "))
+		}
+	}
+
+	if unknown := r.cfg.UnknownOverrides(overrides); len(unknown) > 0 {
+		return resolution, util.FmtNewtError(
+			"Override of undefined syscfg setting(s): %s",
+			strings.Join(unknown, ", "))
+	}
+
 	resolution.Cfg = r.cfg
+	resolution.FlagErrors, resolution.FlagWarnings = r.checkFlags()
+	resolution.ApiConflicts = r.detectApiConflicts(apiPrefs)
 	resolution.ApiMap = make(map[string]*pkg.LocalPackage, len(r.apis))
 	anyUnsatisfied := false
 	for api, rpkg := range r.apis {
@@ -513,6 +687,21 @@ func ResolveCfg(seedPkgs []*pkg.LocalPackage,
 	return resolution, nil
 }
 
+// Records each of the specified features that the resolved configuration
+// does not enable.  Missing features are reported by ErrorText().
+func (cfgResolution *CfgResolution) CheckRequiredFeatures(reqs []string) {
+	features := cfgResolution.Cfg.Features()
+
+	cfgResolution.MissingFeatures = nil
+	for _, req := range reqs {
+		if !features[req] {
+			cfgResolution.MissingFeatures =
+				append(cfgResolution.MissingFeatures, req)
+		}
+	}
+	sort.Strings(cfgResolution.MissingFeatures)
+}
+
 func (cfgResolution *CfgResolution) ErrorText() string {
 	str := ""
 
@@ -537,6 +726,25 @@ func (cfgResolution *CfgResolution) ErrorText() string {
 			str += strings.Join(pkgNames, ", ")
 			str += "\n"
 		}
+
+		if len(cfgResolution.Excludes) > 0 {
+			str += fmt.Sprintf("    (target excludes: %s)\n",
+				strings.Join(cfgResolution.Excludes, ", "))
+		}
+	}
+
+	str += cfgResolution.apiConflictErrorText()
+
+	if len(cfgResolution.MissingFeatures) > 0 {
+		str += "Target requires features that are not enabled:\n"
+		for _, feature := range cfgResolution.MissingFeatures {
+			str += fmt.Sprintf("    * %s\n", feature)
+		}
+	}
+
+	if len(cfgResolution.FlagErrors) > 0 {
+		str += "Malformed package flags detected:\n"
+		str += flagProblemsText(cfgResolution.FlagErrors)
 	}
 
 	str += cfgResolution.Cfg.ErrorText()
@@ -545,5 +753,5 @@ func (cfgResolution *CfgResolution) ErrorText() string {
 }
 
 func (cfgResolution *CfgResolution) WarningText() string {
-	return cfgResolution.Cfg.WarningText()
+	return cfgResolution.FlagWarningText() + cfgResolution.Cfg.WarningText()
 }
@@ -0,0 +1,188 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package symbol
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Describes a single object file's symbol, as reported by objdump.
+type testSym struct {
+	bpkg    string
+	name    string
+	code    string
+	section string
+}
+
+// Builds one symbol map per package from the supplied symbols.
+func testSymbolMaps(syms []testSym) []*SymbolMap {
+	pkgMaps := map[string]*SymbolMap{}
+	maps := []*SymbolMap{}
+
+	for _, s := range syms {
+		sm := pkgMaps[s.bpkg]
+		if sm == nil {
+			sm = NewSymbolMap()
+			pkgMaps[s.bpkg] = sm
+			maps = append(maps, sm)
+		}
+
+		sm.Add(SymbolInfo{
+			Bpkg:    s.bpkg,
+			Name:    s.name,
+			Code:    s.code,
+			Section: s.section,
+		})
+	}
+
+	return maps
+}
+
+func symbolPkgs(infos []SymbolInfo) []string {
+	pkgs := []string{}
+	for _, info := range infos {
+		pkgs = append(pkgs, info.Bpkg)
+	}
+
+	return pkgs
+}
+
+func TestDuplicateSymbols(t *testing.T) {
+	type expDup struct {
+		name   string
+		strong []string
+		weak   []string
+	}
+
+	tests := []struct {
+		name string
+		syms []testSym
+		exp  []expDup
+	}{
+		{
+			name: "strong in two packages",
+			syms: []testSym{
+				{"hw/bsp/nrf52dk", "hal_bsp_init", "g     F", ".text"},
+				{"apps/blinky", "hal_bsp_init", "g     F", ".text"},
+				{"apps/blinky", "main", "g     F", ".text"},
+			},
+			exp: []expDup{
+				{
+					name:   "hal_bsp_init",
+					strong: []string{"apps/blinky", "hw/bsp/nrf52dk"},
+					weak:   []string{},
+				},
+			},
+		},
+		{
+			name: "weak overridden by strong",
+			syms: []testSym{
+				{"kernel/os", "os_bsp_systick", " w    F", ".text"},
+				{"hw/mcu/nrf52", "os_bsp_systick", "g     F", ".text"},
+			},
+			exp: []expDup{},
+		},
+		{
+			name: "weak alongside strong duplicates",
+			syms: []testSym{
+				{"kernel/os", "os_tick_init", " w    F", ".text"},
+				{"hw/mcu/nrf52", "os_tick_init", "g     F", ".text"},
+				{"hw/mcu/nrf51", "os_tick_init", "g     F", ".text"},
+			},
+			exp: []expDup{
+				{
+					name:   "os_tick_init",
+					strong: []string{"hw/mcu/nrf51", "hw/mcu/nrf52"},
+					weak:   []string{"kernel/os"},
+				},
+			},
+		},
+		{
+			name: "common only",
+			syms: []testSym{
+				{"sys/log", "g_log_level", "g     O", "*COM*"},
+				{"sys/stats", "g_log_level", "g     O", "*COM*"},
+			},
+			exp: []expDup{},
+		},
+		{
+			name: "common and strong",
+			syms: []testSym{
+				{"sys/log", "g_log_level", "g     O", "*COM*"},
+				{"sys/stats", "g_log_level", "g     O", ".data"},
+			},
+			exp: []expDup{
+				{
+					name:   "g_log_level",
+					strong: []string{"sys/log", "sys/stats"},
+					weak:   []string{},
+				},
+			},
+		},
+		{
+			name: "local symbols",
+			syms: []testSym{
+				{"sys/log", "log_lock", "l     F", ".text"},
+				{"sys/stats", "log_lock", "l     F", ".text"},
+			},
+			exp: []expDup{},
+		},
+		{
+			name: "sorted by name",
+			syms: []testSym{
+				{"libs/a", "zeta", "g     F", ".text"},
+				{"libs/b", "zeta", "g     F", ".text"},
+				{"libs/a", "alpha", "g     O", ".bss"},
+				{"libs/b", "alpha", "g     O", ".bss"},
+			},
+			exp: []expDup{
+				{
+					name:   "alpha",
+					strong: []string{"libs/a", "libs/b"},
+					weak:   []string{},
+				},
+				{
+					name:   "zeta",
+					strong: []string{"libs/a", "libs/b"},
+					weak:   []string{},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		dups := DuplicateSymbols(testSymbolMaps(test.syms))
+
+		act := []expDup{}
+		for _, dup := range dups {
+			act = append(act, expDup{
+				name:   dup.Name,
+				strong: symbolPkgs(dup.Strong),
+				weak:   symbolPkgs(dup.Weak),
+			})
+		}
+
+		if !reflect.DeepEqual(act, test.exp) {
+			t.Errorf("%s: duplicates: want=%+v have=%+v",
+				test.name, test.exp, act)
+		}
+	}
+}
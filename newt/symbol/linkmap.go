@@ -0,0 +1,207 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package symbol
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// An input section listed in a GNU ld link map.
+type mapSection struct {
+	name    string // E.g., ".text.os_init".
+	archive string // The archive (or object file) that contributed it.
+}
+
+// Extracts the archive path from a link map file name of the form
+// "path/libfoo.a(foo.o)".  Object files are returned unchanged.
+func mapArchive(file string) string {
+	if i := strings.Index(file, "("); i != -1 {
+		return file[:i]
+	}
+	return file
+}
+
+// Retrieves the name of the symbol that a per-symbol input section (as
+// emitted by -ffunction-sections or -fdata-sections) contains.  C identifiers
+// never contain a period, so the name is whatever follows the last one.
+func mapSectionSymbol(section string) string {
+	return section[strings.LastIndex(section, ".")+1:]
+}
+
+func isMapAddr(s string) bool {
+	if !strings.HasPrefix(s, "0x") {
+		return false
+	}
+	_, err := strconv.ParseUint(s, 0, 64)
+	return err == nil
+}
+
+// Parses a GNU ld link map (-Wl,-Map) and reports the weak symbols that are
+// overridden by a strong definition from a different archive.
+//
+// The map lists every input section, including the ones garbage collected
+// from the link, along with the archive that contributed it.  Beneath each
+// retained section it lists the global symbols the section defines.  A weak
+// definition that loses to a strong one defines nothing in the map, so an
+// override shows up as a per-symbol section from one archive whose symbol is
+// defined in another.  This relies on packages being compiled with
+// -ffunction-sections and -fdata-sections.
+//
+// The Bpkg field of each reported symbol is the path of the archive as it
+// appears in the map.  The result is sorted by symbol name.
+func ParseMapWeakOverrides(r io.Reader) ([]WeakOverride, error) {
+	const (
+		stateHeader = iota
+		stateDiscarded
+		stateMemConfig
+		stateMemMap
+	)
+
+	state := stateHeader
+	sections := []mapSection{}
+	defs := map[string]mapSection{}
+
+	// The input section that symbol lines are attributed to.
+	var cur *mapSection
+
+	// The name of an input section whose address, size, and file have been
+	// wrapped onto the following line.
+	pending := ""
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case strings.HasPrefix(line, "Discarded input sections"):
+			state = stateDiscarded
+			continue
+		case strings.HasPrefix(line, "Memory Configuration"):
+			state = stateMemConfig
+			continue
+		case strings.HasPrefix(line, "Linker script and memory map"):
+			state = stateMemMap
+			continue
+		}
+
+		if state != stateDiscarded && state != stateMemMap {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		// Output sections and linker script directives start in the first
+		// column; input sections and symbols are indented.
+		if !strings.HasPrefix(line, " ") {
+			cur = nil
+			pending = ""
+			continue
+		}
+
+		name := pending
+		pending = ""
+		if strings.HasPrefix(fields[0], ".") {
+			name = fields[0]
+			fields = fields[1:]
+			if len(fields) == 0 {
+				pending = name
+				continue
+			}
+		}
+
+		if name != "" {
+			// <address> <size> <file>
+			if len(fields) != 3 || !isMapAddr(fields[0]) {
+				cur = nil
+				continue
+			}
+			sections = append(sections, mapSection{
+				name:    name,
+				archive: mapArchive(fields[2]),
+			})
+			cur = nil
+			if state == stateMemMap {
+				cur = &sections[len(sections)-1]
+			}
+			continue
+		}
+
+		// <address> <symbol>
+		if cur != nil && len(fields) == 2 && isMapAddr(fields[0]) &&
+			!isMapAddr(fields[1]) {
+
+			defs[fields[1]] = *cur
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	byName := map[string][]WeakOverride{}
+	seen := map[string]bool{}
+	for _, section := range sections {
+		name := mapSectionSymbol(section.name)
+		def, ok := defs[name]
+		if !ok || def.archive == section.archive {
+			continue
+		}
+
+		key := name + "\x00" + section.archive
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		byName[name] = append(byName[name], WeakOverride{
+			Weak: SymbolInfo{
+				Bpkg:    section.archive,
+				Name:    name,
+				Section: section.name,
+			},
+			Strong: SymbolInfo{
+				Bpkg:    def.archive,
+				Name:    name,
+				Section: def.name,
+			},
+		})
+	}
+
+	names := make([]string, 0, len(byName))
+	for name, _ := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	overrides := []WeakOverride{}
+	for _, name := range names {
+		overrides = append(overrides, byName[name]...)
+	}
+
+	return overrides, nil
+}
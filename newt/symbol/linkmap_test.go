@@ -0,0 +1,168 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package symbol
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// A link map in which the app's strong hal_timer_cb overrides the weak
+// default in the hal package.  The weak definition's section was garbage
+// collected.
+const testMapGc = `Archive member included to satisfy reference by file (symbol)
+
+bin/libs/hal/hal.a(hal_timer.o)
+                              bin/apps/blinky/blinky.a(main.o) (hal_timer_init)
+
+Discarded input sections
+
+ .text          0x0000000000000000        0x0 bin/libs/hal/hal.a(hal_timer.o)
+ .text.hal_timer_cb
+                0x0000000000000000        0x4 bin/libs/hal/hal.a(hal_timer.o)
+ .text.unused_fn
+                0x0000000000000000        0x8 bin/libs/hal/hal.a(hal_timer.o)
+
+Memory Configuration
+
+Name             Origin             Length             Attributes
+FLASH            0x0000000000008000 0x0000000000020000 xr
+RAM              0x0000000020000000 0x0000000000010000 xrw
+*default*        0x0000000000000000 0xffffffffffffffff
+
+Linker script and memory map
+
+.text           0x0000000000008000      0x120
+ *(.text*)
+ .text.main     0x0000000000008000       0x20 bin/apps/blinky/blinky.a(main.o)
+                0x0000000000008000                main
+ .text.hal_timer_cb
+                0x0000000000008020       0x10 bin/apps/blinky/blinky.a(main.o)
+                0x0000000000008020                hal_timer_cb
+ .text.hal_timer_init
+                0x0000000000008030       0x30 bin/libs/hal/hal.a(hal_timer.o)
+                0x0000000000008030                hal_timer_init
+ *fill*         0x0000000000008060        0x0
+                0x0000000000008060                _etext = .
+
+.bss            0x0000000020000000       0x10
+ .bss.timer_cnt
+                0x0000000020000000        0x4 bin/libs/hal/hal.a(hal_timer.o)
+                0x0000000020000000                timer_cnt
+OUTPUT(bin/apps/blinky/blinky.elf elf32-littlearm)
+`
+
+// A link map produced without --gc-sections.  The overridden weak definitions
+// remain in the image, but the map attributes their symbols to the
+// overriding packages.
+const testMapNoGc = `Linker script and memory map
+
+.text           0x0000000000008000      0x120
+ .text.os_idle  0x0000000000008000       0x10 bin/kernel/os/os.a(os.o)
+ .text.os_idle  0x0000000000008010       0x10 bin/apps/app/app.a(idle.o)
+                0x0000000000008010                os_idle
+ .text.sysinit_panic
+                0x0000000000008020       0x10 bin/sys/sys.a(sysinit.o)
+ .text.sysinit_panic
+                0x0000000000008030       0x10 bin/bsp/bsp.a(bsp.o)
+                0x0000000000008030                sysinit_panic
+ .text.app_start
+                0x0000000000008040       0x10 bin/apps/app/app.a(main.o)
+                0x0000000000008040                app_start
+
+.data           0x0000000020000000        0x8
+ .data.cfg_val  0x0000000020000000        0x4 bin/sys/sys.a(cfg.o)
+ .data.cfg_val  0x0000000020000004        0x4 bin/apps/app/app.a(main.o)
+                0x0000000020000004                cfg_val
+`
+
+func overrideStrings(overrides []WeakOverride) []string {
+	strs := make([]string, len(overrides))
+	for i, o := range overrides {
+		strs[i] = fmt.Sprintf("%s: %s -> %s", o.Weak.Name, o.Weak.Bpkg,
+			o.Strong.Bpkg)
+	}
+	return strs
+}
+
+func TestParseMapWeakOverrides(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "weak definition garbage collected",
+			text: testMapGc,
+			want: []string{
+				"hal_timer_cb: bin/libs/hal/hal.a -> " +
+					"bin/apps/blinky/blinky.a",
+			},
+		},
+		{
+			name: "weak definitions retained",
+			text: testMapNoGc,
+			want: []string{
+				"cfg_val: bin/sys/sys.a -> bin/apps/app/app.a",
+				"os_idle: bin/kernel/os/os.a -> bin/apps/app/app.a",
+				"sysinit_panic: bin/sys/sys.a -> bin/bsp/bsp.a",
+			},
+		},
+		{
+			name: "no memory map",
+			text: "Memory Configuration\n\n" +
+				"FLASH  0x0000000000008000 0x0000000000020000 xr\n",
+			want: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		overrides, err := ParseMapWeakOverrides(strings.NewReader(test.text))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		got := overrideStrings(overrides)
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: overrides=%q; want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseMapWeakOverridesSections(t *testing.T) {
+	overrides, err := ParseMapWeakOverrides(strings.NewReader(testMapGc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overrides) != 1 {
+		t.Fatalf("got %d overrides; want 1", len(overrides))
+	}
+
+	o := overrides[0]
+	if o.Weak.Section != ".text.hal_timer_cb" {
+		t.Errorf("weak section=%s; want .text.hal_timer_cb", o.Weak.Section)
+	}
+	if o.Strong.Section != ".text.hal_timer_cb" {
+		t.Errorf("strong section=%s; want .text.hal_timer_cb",
+			o.Strong.Section)
+	}
+}
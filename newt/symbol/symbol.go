@@ -167,7 +167,7 @@ func sprintfSi(si *SymbolInfo) string {
 }
 
 func dumpSi(si *SymbolInfo) {
-	fmt.Printf(sprintfSi(si))
+	fmt.Print(sprintfSi(si))
 }
 
 func (si *SymbolInfo) Dump() {
@@ -320,3 +320,94 @@ func (s *SymbolMap) Find(name string) (*SymbolInfo, bool) {
 	val, ok := (*s)[name]
 	return &val, ok
 }
+
+// Describes a weak symbol definition that is overridden by a strong definition
+// in a different package.
+type WeakOverride struct {
+	Weak   SymbolInfo
+	Strong SymbolInfo
+}
+
+func (si *SymbolInfo) IsCommon() bool {
+	return si.IsSection("*COM*")
+}
+
+// Describes a global symbol that is defined by more than one package.  Weak
+// lists any weak definitions of the symbol; these are overridden
+// intentionally and do not contribute to the conflict.
+type DuplicateSymbol struct {
+	Name   string
+	Strong []SymbolInfo
+	Weak   []SymbolInfo
+}
+
+type symbolInfoPkgSorter []SymbolInfo
+
+func (s symbolInfoPkgSorter) Len() int {
+	return len(s)
+}
+func (s symbolInfoPkgSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s symbolInfoPkgSorter) Less(i, j int) bool {
+	return s[i].Bpkg < s[j].Bpkg
+}
+
+// Searches the supplied symbol maps for global symbols with a strong
+// definition in more than one package; these cause "multiple definition"
+// errors at link time.  Common symbols are only considered a conflict if
+// they are also defined strongly elsewhere, as the linker may merge them.
+// The result is sorted by symbol name.
+func DuplicateSymbols(maps []*SymbolMap) []DuplicateSymbol {
+	strongMap := map[string][]SymbolInfo{}
+	weakMap := map[string][]SymbolInfo{}
+
+	for _, sm := range maps {
+		for _, info := range *sm {
+			if info.IsLocal() {
+				continue
+			}
+
+			if info.IsWeak() {
+				weakMap[info.Name] = append(weakMap[info.Name], info)
+			} else {
+				strongMap[info.Name] = append(strongMap[info.Name], info)
+			}
+		}
+	}
+
+	names := []string{}
+	for name, infos := range strongMap {
+		if len(infos) < 2 {
+			continue
+		}
+
+		allCommon := true
+		for _, info := range infos {
+			if !info.IsCommon() {
+				allCommon = false
+				break
+			}
+		}
+		if !allCommon {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	dups := make([]DuplicateSymbol, len(names))
+	for i, name := range names {
+		strong := strongMap[name]
+		weak := weakMap[name]
+		sort.Sort(symbolInfoPkgSorter(strong))
+		sort.Sort(symbolInfoPkgSorter(weak))
+
+		dups[i] = DuplicateSymbol{
+			Name:   name,
+			Strong: strong,
+			Weak:   weak,
+		}
+	}
+
+	return dups
+}
@@ -0,0 +1,124 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package syscfg
+
+import (
+	"sort"
+)
+
+// A setting whose resolved value differs between two configurations, or that
+// only one of them defines.
+type CfgDiff struct {
+	Name string
+
+	// Values in each configuration; only meaningful if the corresponding
+	// "In" field is set.
+	ValueA string
+	ValueB string
+
+	InA bool
+	InB bool
+}
+
+// Compares two resolved configurations.  The result lists every setting that
+// is defined by only one configuration or that has different values in the
+// two, sorted by setting name.
+func DiffCfgs(a Cfg, b Cfg) []CfgDiff {
+	names := map[string]struct{}{}
+	for name, _ := range a.Settings {
+		names[name] = struct{}{}
+	}
+	for name, _ := range b.Settings {
+		names[name] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name, _ := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	diffs := []CfgDiff{}
+	for _, name := range sorted {
+		entryA, inA := a.Settings[name]
+		entryB, inB := b.Settings[name]
+
+		if inA && inB && entryA.Value == entryB.Value {
+			continue
+		}
+
+		diffs = append(diffs, CfgDiff{
+			Name:   name,
+			ValueA: entryA.Value,
+			ValueB: entryB.Value,
+			InA:    inA,
+			InB:    inB,
+		})
+	}
+
+	return diffs
+}
+
+// A setting whose resolved value differs from the default declared by the
+// package that defines it.
+type CfgOverride struct {
+	Name    string
+	Default string
+	Value   string
+
+	// The package that declares the setting and the package that supplied
+	// its final value.
+	DefinedBy    string
+	OverriddenBy string
+}
+
+// Lists the settings whose resolved values differ from their declared
+// defaults, sorted by setting name.  A setting that is overridden with a value
+// equal to its default is not listed.
+func (cfg *Cfg) OverriddenSettings() []CfgOverride {
+	names := make([]string, 0, len(cfg.Settings))
+	for name, _ := range cfg.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	overrides := []CfgOverride{}
+	for _, name := range names {
+		entry := cfg.Settings[name]
+		if len(entry.History) == 0 {
+			continue
+		}
+
+		def := entry.History[0]
+		if entry.Value == def.Value {
+			continue
+		}
+
+		overrides = append(overrides, CfgOverride{
+			Name:         name,
+			Default:      def.Value,
+			Value:        entry.Value,
+			DefinedBy:    def.Name(),
+			OverriddenBy: mostRecentPoint(entry).Name(),
+		})
+	}
+
+	return overrides
+}
@@ -0,0 +1,118 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package syscfg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffCfgs(t *testing.T) {
+	tests := []struct {
+		name string
+		a    map[string]string
+		b    map[string]string
+		want []CfgDiff
+	}{
+		{
+			"identical",
+			map[string]string{"A": "1", "B": "0"},
+			map[string]string{"A": "1", "B": "0"},
+			[]CfgDiff{},
+		},
+		{
+			"value differs",
+			map[string]string{"A": "1", "B": "0"},
+			map[string]string{"A": "1", "B": "2"},
+			[]CfgDiff{
+				{Name: "B", ValueA: "0", ValueB: "2", InA: true, InB: true},
+			},
+		},
+		{
+			"defined by one",
+			map[string]string{"A": "1", "C": "3"},
+			map[string]string{"A": "1", "B": "2"},
+			[]CfgDiff{
+				{Name: "B", ValueB: "2", InB: true},
+				{Name: "C", ValueA: "3", InA: true},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got := DiffCfgs(testCfg(test.a), testCfg(test.b))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: DiffCfgs() = %+v; want %+v", test.name, got,
+				test.want)
+		}
+	}
+}
+
+func TestOverriddenSettings(t *testing.T) {
+	defs := func() map[string]map[interface{}]interface{} {
+		return map[string]map[interface{}]interface{}{
+			"A": {"value": "0"},
+			"B": {"value": "1"},
+			"C": {"value": ""},
+		}
+	}
+
+	tests := []struct {
+		name string
+		vals map[string]string
+		want []CfgOverride
+	}{
+		{"defaults", nil, []CfgOverride{}},
+		{
+			"overridden with default",
+			map[string]string{"A": "0", "B": "1"},
+			[]CfgOverride{},
+		},
+		{
+			"overridden",
+			map[string]string{"C": "foo", "A": "5", "B": "1"},
+			[]CfgOverride{
+				{
+					Name:         "A",
+					Default:      "0",
+					Value:        "5",
+					DefinedBy:    "test/lib",
+					OverriddenBy: "test/target",
+				},
+				{
+					Name:         "C",
+					Default:      "",
+					Value:        "foo",
+					DefinedBy:    "test/lib",
+					OverriddenBy: "test/target",
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		cfg := testDefCfg(t, defs(), test.vals)
+		got := cfg.OverriddenSettings()
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: OverriddenSettings() = %+v; want %+v", test.name,
+				got, test.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package syscfg
+
+import (
+	"mynewt.apache.org/newt/newt/pkg"
+)
+
+// Retrieves a setting's value as seen by the specified package.  Settings
+// injected into the package are consulted if the configuration does not
+// define the setting.  An undefined setting has an empty value.
+func (cfg *Cfg) valueForLpkg(lpkg *pkg.LocalPackage, name string) string {
+	if entry, ok := cfg.Settings[name]; ok {
+		return entry.Value
+	}
+
+	return lpkg.InjectedSettings()[name]
+}
+
+// Indicates whether a pkg.deps_cond condition holds for the specified
+// package.
+func (cfg *Cfg) CondHolds(lpkg *pkg.LocalPackage, cond pkg.DepCond) bool {
+	return condValueHolds(cfg.valueForLpkg(lpkg, cond.Setting), cond)
+}
+
+// Indicates whether a condition holds when its setting has the specified
+// value.
+func condValueHolds(val string, cond pkg.DepCond) bool {
+	switch cond.Op {
+	case pkg.COND_OP_FALSE:
+		return !ValueIsTrue(val)
+	case pkg.COND_OP_EQ:
+		return val == cond.Value
+	case pkg.COND_OP_NE:
+		return val != cond.Value
+	default:
+		return ValueIsTrue(val)
+	}
+}
+
+// Returns the package's conditional dependencies whose conditions hold.
+func (cfg *Cfg) CondDepsForLpkg(lpkg *pkg.LocalPackage) (
+	[]pkg.CondDep, error) {
+
+	cds, err := lpkg.CondDeps(cfg.FeaturesForLpkg(lpkg))
+	if err != nil {
+		return nil, err
+	}
+
+	held := []pkg.CondDep{}
+	for _, cd := range cds {
+		if cfg.CondHolds(lpkg, cd.Cond) {
+			held = append(held, cd)
+		}
+	}
+
+	return held, nil
+}
+
+// Returns the package's conditional source files whose conditions do not hold.
+// arch is the value of the ARCH pseudo-setting.
+func (cfg *Cfg) ExcludedSrcsForLpkg(lpkg *pkg.LocalPackage, arch string) (
+	[]pkg.CondSrc, error) {
+
+	css, err := lpkg.CondSrcs(cfg.FeaturesForLpkg(lpkg))
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := []pkg.CondSrc{}
+	for _, cs := range css {
+		var holds bool
+		if cs.Cond.Setting == pkg.COND_SETTING_ARCH {
+			holds = condValueHolds(arch, cs.Cond)
+		} else {
+			holds = cfg.CondHolds(lpkg, cs.Cond)
+		}
+		if !holds {
+			excluded = append(excluded, cs)
+		}
+	}
+
+	return excluded, nil
+}
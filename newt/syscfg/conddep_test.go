@@ -0,0 +1,109 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package syscfg
+
+import (
+	"reflect"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/pkg"
+)
+
+func TestCondHolds(t *testing.T) {
+	cfg := testCfg(map[string]string{
+		"ON":    "1",
+		"OFF":   "0",
+		"EMPTY": "",
+		"MODE":  "fast",
+	})
+
+	lpkg := pkg.NewLocalPackage(nil, "/test/pkg")
+	lpkg.InjectedSettings()["INJECTED"] = "1"
+
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{"ON", true},
+		{"OFF", false},
+		{"EMPTY", false},
+		{"UNDEFINED", false},
+		{"INJECTED", true},
+		{"!ON", false},
+		{"!OFF", true},
+		{"!UNDEFINED", true},
+		{"MODE==fast", true},
+		{"MODE==slow", false},
+		{"MODE!=slow", true},
+		{"MODE!=fast", false},
+		{" MODE == fast ", true},
+	}
+
+	for _, test := range tests {
+		cond, err := pkg.ParseDepCond(test.cond)
+		if err != nil {
+			t.Errorf("ParseDepCond(%q): unexpected error: %s", test.cond,
+				err.Error())
+			continue
+		}
+
+		if got := cfg.CondHolds(lpkg, cond); got != test.want {
+			t.Errorf("CondHolds(%q) = %v; want %v", test.cond, got,
+				test.want)
+		}
+	}
+}
+
+func TestExcludedSrcsForLpkg(t *testing.T) {
+	cfg := testCfg(map[string]string{"LOG_CONSOLE": "0"})
+
+	lpkg := pkg.NewLocalPackage(nil, "/test/pkg")
+	lpkg.PkgV.Set(pkg.PKG_COND_SRCS_KEY, []interface{}{
+		"src/crc_hw.c if ARCH==cortex_m4",
+		"src/crc_sw.c if ARCH!=cortex_m4",
+		"src/log_console.c if LOG_CONSOLE",
+	})
+
+	tests := []struct {
+		arch string
+		want []string
+	}{
+		{"cortex_m4", []string{"src/crc_sw.c", "src/log_console.c"}},
+		{"sim", []string{"src/crc_hw.c", "src/log_console.c"}},
+	}
+
+	for _, test := range tests {
+		excluded, err := cfg.ExcludedSrcsForLpkg(lpkg, test.arch)
+		if err != nil {
+			t.Errorf("arch %s: unexpected error: %s", test.arch,
+				err.Error())
+			continue
+		}
+
+		got := []string{}
+		for _, cs := range excluded {
+			got = append(got, cs.File)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("arch %s: excluded %v; want %v", test.arch, got,
+				test.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package syscfg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Finds exclusion groups with more than one enabled setting.  A setting
+// joins a group by listing it in its definition's exclusion_groups field;
+// this allows, e.g., two conflicting drivers to declare that they cannot
+// both be enabled.
+func (cfg *Cfg) detectExclusions() {
+	groups := map[string][]string{}
+	for _, entry := range cfg.Settings {
+		if !entry.IsTrue() {
+			continue
+		}
+
+		for _, group := range entry.ExclusionGroups {
+			groups[group] = append(groups[group], entry.Name)
+		}
+	}
+
+	for group, names := range groups {
+		if len(names) > 1 {
+			sort.Strings(names)
+			cfg.Exclusions[group] = names
+		}
+	}
+}
+
+func exclusionText(group string, names []string) string {
+	return fmt.Sprintf("At most one setting in exclusion group \"%s\" may "+
+		"be enabled; enabled: %s", group, strings.Join(names, ", "))
+}
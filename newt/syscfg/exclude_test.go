@@ -0,0 +1,83 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package syscfg
+
+import (
+	"strings"
+	"testing"
+)
+
+// At most one setting in an exclusion group may be enabled.
+func TestExclusionGroups(t *testing.T) {
+	defs := func() map[string]map[interface{}]interface{} {
+		return map[string]map[interface{}]interface{}{
+			"DRIVER_A": {
+				"value":            "0",
+				"exclusion_groups": []interface{}{"uart_driver"},
+			},
+			"DRIVER_B": {
+				"value":            "0",
+				"exclusion_groups": []interface{}{"uart_driver"},
+			},
+			"DRIVER_C": {
+				"value": "0",
+			},
+		}
+	}
+
+	tests := []struct {
+		name string
+		vals map[string]string
+		want string // Expected error text; "" if none.
+	}{
+		{"none enabled", nil, ""},
+		{"one enabled", map[string]string{"DRIVER_A": "1"}, ""},
+		{
+			"one enabled with ungrouped",
+			map[string]string{"DRIVER_B": "1", "DRIVER_C": "1"},
+			"",
+		},
+		{
+			"both enabled",
+			map[string]string{"DRIVER_A": "1", "DRIVER_B": "1"},
+			"At most one setting in exclusion group \"uart_driver\" may " +
+				"be enabled; enabled: DRIVER_A, DRIVER_B",
+		},
+	}
+
+	for _, test := range tests {
+		cfg := testDefCfg(t, defs(), test.vals)
+
+		cfg.detectExclusions()
+		text := cfg.ErrorText()
+
+		if test.want == "" {
+			if text != "" {
+				t.Errorf("%s: unexpected error: %s", test.name, text)
+			}
+			continue
+		}
+
+		if !strings.Contains(text, test.want) {
+			t.Errorf("%s: error text \"%s\" does not contain \"%s\"",
+				test.name, text, test.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package syscfg
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Environment variables with this prefix override the syscfg setting named
+// by the remainder of the variable name.
+const SYSCFG_ENV_PREFIX = "NEWT_SYSCFG_"
+
+// The overrides specified with the global --syscfg option.
+var OverrideFlag string
+
+var overrideNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func validateOverride(name string, value string, origin string) error {
+	if !overrideNameRe.MatchString(name) {
+		return util.FmtNewtError(
+			"Invalid syscfg override \"%s\" (%s); setting name must be a "+
+				"C identifier", name, origin)
+	}
+	if value == "" {
+		return util.FmtNewtError(
+			"Invalid syscfg override \"%s\" (%s); value is empty",
+			name, origin)
+	}
+
+	return nil
+}
+
+// Parses a set of syscfg overrides of the form
+// "NAME=VALUE[:NAME=VALUE...]", as specified on the command line.
+func ParseOverrides(s string) (map[string]string, error) {
+	overrides := map[string]string{}
+	if s == "" {
+		return overrides, nil
+	}
+
+	for _, field := range strings.Split(s, ":") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return nil, util.FmtNewtError(
+				"Invalid syscfg override \"%s\"; must be of the form "+
+					"NAME=VALUE", field)
+		}
+
+		name := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		if err := validateOverride(name, value, "--syscfg"); err != nil {
+			return nil, err
+		}
+		overrides[name] = value
+	}
+
+	return overrides, nil
+}
+
+// Collects syscfg overrides from environment variables of the form
+// "NEWT_SYSCFG_<NAME>=<VALUE>".  environ has the format of os.Environ().
+func EnvOverrides(environ []string) (map[string]string, error) {
+	overrides := map[string]string{}
+
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, SYSCFG_ENV_PREFIX) {
+			continue
+		}
+
+		parts := strings.SplitN(kv[len(SYSCFG_ENV_PREFIX):], "=", 2)
+		value := ""
+		if len(parts) == 2 {
+			value = parts[1]
+		}
+
+		origin := "$" + SYSCFG_ENV_PREFIX + parts[0]
+		if err := validateOverride(parts[0], value, origin); err != nil {
+			return nil, err
+		}
+		overrides[parts[0]] = value
+	}
+
+	return overrides, nil
+}
+
+// Combines the syscfg overrides specified in the environment with those
+// specified on the command line (flagStr).  If both specify the same
+// setting, the command line wins.
+func Overrides(flagStr string) (map[string]string, error) {
+	overrides, err := EnvOverrides(os.Environ())
+	if err != nil {
+		return nil, err
+	}
+
+	flagOverrides, err := ParseOverrides(flagStr)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range flagOverrides {
+		overrides[name] = value
+	}
+
+	return overrides, nil
+}
+
+// Replaces the values of overridden settings.  Overrides of settings that
+// have not been defined (yet) are ignored; see UnknownOverrides.
+func (cfg *Cfg) applyOverrides(overrides map[string]string) {
+	for name, value := range overrides {
+		entry, ok := cfg.Settings[name]
+		if !ok {
+			continue
+		}
+
+		entry.Value = value
+		entry.History = append(entry.History, CfgPoint{
+			Value:  value,
+			Source: nil,
+		})
+		cfg.Settings[name] = entry
+	}
+}
+
+// Returns the sorted names of overrides that do not correspond to any
+// defined setting.
+func (cfg *Cfg) UnknownOverrides(overrides map[string]string) []string {
+	names := []string{}
+	for name, _ := range overrides {
+		if _, ok := cfg.Settings[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,233 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package syscfg
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/pkg"
+)
+
+func testCfg(settings map[string]string) Cfg {
+	lpkg := pkg.NewLocalPackage(nil, "/test/pkg")
+
+	cfg := NewCfg()
+	for name, value := range settings {
+		cfg.Settings[name] = CfgEntry{
+			Name:  name,
+			Value: value,
+			History: []CfgPoint{
+				{Value: value, Source: lpkg},
+			},
+		}
+	}
+
+	return cfg
+}
+
+func TestParseOverrides(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"A=1", map[string]string{"A": "1"}, false},
+		{"A=1:B_2=foo", map[string]string{"A": "1", "B_2": "foo"}, false},
+		{" A = 1 ", map[string]string{"A": "1"}, false},
+		{"A=1:A=2", map[string]string{"A": "2"}, false},
+		{"A", nil, true},
+		{"A=", nil, true},
+		{"1A=1", nil, true},
+		{"A-B=1", nil, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseOverrides(test.in)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseOverrides(%q): expected error", test.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseOverrides(%q): unexpected error: %s",
+				test.in, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseOverrides(%q) = %v; want %v",
+				test.in, got, test.want)
+		}
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	tests := []struct {
+		environ []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{[]string{"PATH=/bin"}, map[string]string{}, false},
+		{
+			[]string{"PATH=/bin", SYSCFG_ENV_PREFIX + "A=1"},
+			map[string]string{"A": "1"},
+			false,
+		},
+		{[]string{SYSCFG_ENV_PREFIX + "A="}, nil, true},
+		{[]string{SYSCFG_ENV_PREFIX + "A"}, nil, true},
+		{[]string{SYSCFG_ENV_PREFIX + "1A=1"}, nil, true},
+	}
+
+	for _, test := range tests {
+		got, err := EnvOverrides(test.environ)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("EnvOverrides(%v): expected error", test.environ)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("EnvOverrides(%v): unexpected error: %s",
+				test.environ, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("EnvOverrides(%v) = %v; want %v",
+				test.environ, got, test.want)
+		}
+	}
+}
+
+// The command line takes precedence over the environment.
+func TestOverridesFlagBeatsEnv(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		flag string
+		want map[string]string
+	}{
+		{map[string]string{}, "", map[string]string{}},
+		{map[string]string{"A": "env"}, "", map[string]string{"A": "env"}},
+		{map[string]string{}, "A=flag", map[string]string{"A": "flag"}},
+		{
+			map[string]string{"A": "env"},
+			"A=flag",
+			map[string]string{"A": "flag"},
+		},
+		{
+			map[string]string{"A": "env", "B": "env"},
+			"A=flag",
+			map[string]string{"A": "flag", "B": "env"},
+		},
+	}
+
+	for _, test := range tests {
+		for name, value := range test.env {
+			os.Setenv(SYSCFG_ENV_PREFIX+name, value)
+		}
+
+		got, err := Overrides(test.flag)
+
+		for name, _ := range test.env {
+			os.Unsetenv(SYSCFG_ENV_PREFIX + name)
+		}
+
+		if err != nil {
+			t.Errorf("Overrides(%q) with env %v: unexpected error: %s",
+				test.flag, test.env, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Overrides(%q) with env %v = %v; want %v",
+				test.flag, test.env, got, test.want)
+		}
+	}
+}
+
+// Overrides take precedence over values assigned in yml files.
+func TestApplyOverrides(t *testing.T) {
+	tests := []struct {
+		yml       map[string]string
+		overrides map[string]string
+		want      map[string]string
+		unknown   []string
+	}{
+		{
+			map[string]string{"A": "0"},
+			map[string]string{},
+			map[string]string{"A": "0"},
+			[]string{},
+		},
+		{
+			map[string]string{"A": "0", "B": "0"},
+			map[string]string{"A": "1"},
+			map[string]string{"A": "1", "B": "0"},
+			[]string{},
+		},
+		{
+			map[string]string{"A": "0"},
+			map[string]string{"A": "1", "Z": "1", "Y": "1"},
+			map[string]string{"A": "1"},
+			[]string{"Y", "Z"},
+		},
+	}
+
+	for _, test := range tests {
+		cfg := testCfg(test.yml)
+		cfg.applyOverrides(test.overrides)
+
+		for name, want := range test.want {
+			entry := cfg.Settings[name]
+			if entry.Value != want {
+				t.Errorf("setting %s = %s; want %s", name, entry.Value, want)
+			}
+
+			if _, ok := test.overrides[name]; ok {
+				if len(entry.History) != 2 {
+					t.Errorf("setting %s: history length %d; want 2",
+						name, len(entry.History))
+					continue
+				}
+
+				// Overrides are attributed to newt itself.
+				if point := entry.History[1]; point.Name() != "newt" {
+					t.Errorf("setting %s: override attributed to %s",
+						name, point.Name())
+				}
+			}
+		}
+
+		for name, _ := range test.overrides {
+			if _, ok := test.want[name]; !ok {
+				if _, ok := cfg.Settings[name]; ok {
+					t.Errorf("unknown override %s defined a setting", name)
+				}
+			}
+		}
+
+		unknown := cfg.UnknownOverrides(test.overrides)
+		if !reflect.DeepEqual(unknown, test.unknown) {
+			t.Errorf("UnknownOverrides(%v) = %v; want %v",
+				test.overrides, unknown, test.unknown)
+		}
+	}
+}
@@ -30,11 +30,13 @@ type CfgRestrictionCode int
 
 const (
 	CFG_RESTRICTION_CODE_NOTNULL = iota
+	CFG_RESTRICTION_CODE_NOTDEFAULT
 	CFG_RESTRICTION_CODE_EXPR
 )
 
 var cfgRestrictionNameCodeMap = map[string]CfgRestrictionCode{
-	"$notnull": CFG_RESTRICTION_CODE_NOTNULL,
+	"$notnull":    CFG_RESTRICTION_CODE_NOTNULL,
+	"$notdefault": CFG_RESTRICTION_CODE_NOTDEFAULT,
 }
 
 type CfgRestrictionExpr struct {
@@ -67,13 +69,19 @@ func parseRestrictionExprConsequent(field string) (string, bool) {
 
 // Parses a restriction value.
 //
-// Currently, two forms of restrictions are supported:
+// Currently, three forms of restrictions are supported:
 // 1. "$notnull"
-// 2. expression
+// 2. "$notdefault"
+// 3. expression
 //
 // The "$notnull" string indicates that the setting must be set to something
 // other than the empty string.
 //
+// The "$notdefault" string indicates that the setting must be overridden with
+// a value other than the one it is defined with.  This is useful for settings
+// that have no sensible default, such as a key slot that must be chosen for
+// each product.
+//
 // An expression string indicates dependencies on other settings.  It would be
 // better to have a real expression parser.  For now, only very simple
 // expressions are supported.  A restriction expression must be of the
@@ -139,8 +147,13 @@ func readRestriction(baseSetting string, text string) (CfgRestriction, error) {
 }
 
 func (cfg *Cfg) violationText(entry CfgEntry, r CfgRestriction) string {
-	if r.Code == CFG_RESTRICTION_CODE_NOTNULL {
+	switch r.Code {
+	case CFG_RESTRICTION_CODE_NOTNULL:
 		return entry.Name + " must not be null"
+
+	case CFG_RESTRICTION_CODE_NOTDEFAULT:
+		return fmt.Sprintf("%s must be overridden; it has its default "+
+			"value (%s)", entry.Name, entry.Value)
 	}
 
 	str := fmt.Sprintf("%s=%s ", entry.Name, entry.Value)
@@ -163,14 +176,14 @@ func (cfg *Cfg) violationText(entry CfgEntry, r CfgRestriction) string {
 
 func (r *CfgRestriction) relevantSettingNames() []string {
 	switch r.Code {
-	case CFG_RESTRICTION_CODE_NOTNULL:
+	case CFG_RESTRICTION_CODE_NOTNULL, CFG_RESTRICTION_CODE_NOTDEFAULT:
 		return []string{r.BaseSetting}
 
 	case CFG_RESTRICTION_CODE_EXPR:
 		return []string{r.BaseSetting, r.Expr.ReqSetting}
 
 	default:
-		panic("Invalid restriction code: " + string(r.Code))
+		panic(fmt.Sprintf("Invalid restriction code: %d", r.Code))
 	}
 }
 
@@ -182,6 +195,11 @@ func (cfg *Cfg) restrictionMet(r CfgRestriction) bool {
 	case CFG_RESTRICTION_CODE_NOTNULL:
 		return baseEntry.Value != ""
 
+	case CFG_RESTRICTION_CODE_NOTDEFAULT:
+		// The first history entry is the value the setting was defined with.
+		return len(baseEntry.History) == 0 ||
+			baseEntry.Value != baseEntry.History[0].Value
+
 	case CFG_RESTRICTION_CODE_EXPR:
 		if baseVal != r.Expr.BaseVal {
 			// Restriction does not apply.
@@ -194,6 +212,6 @@ func (cfg *Cfg) restrictionMet(r CfgRestriction) bool {
 		return reqVal == r.Expr.ReqVal
 
 	default:
-		panic("Invalid restriction code: " + string(r.Code))
+		panic(fmt.Sprintf("Invalid restriction code: %d", r.Code))
 	}
 }
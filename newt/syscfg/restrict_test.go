@@ -0,0 +1,63 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package syscfg
+
+import (
+	"strings"
+	"testing"
+)
+
+// A "$notdefault" setting must be overridden with a different value.
+func TestNotDefaultRestriction(t *testing.T) {
+	tests := []struct {
+		name     string
+		vals     map[string]string
+		violated bool
+	}{
+		{"not overridden", nil, true},
+		{"overridden with default", map[string]string{"KEY_SLOT": "0"}, true},
+		{"overridden", map[string]string{"KEY_SLOT": "3"}, false},
+	}
+
+	for _, test := range tests {
+		cfg := testDefCfg(t, map[string]map[interface{}]interface{}{
+			"KEY_SLOT": {
+				"value":        "0",
+				"restrictions": []interface{}{"$notdefault"},
+			},
+		}, test.vals)
+
+		cfg.detectViolations()
+		text := cfg.ErrorText()
+
+		if !test.violated {
+			if text != "" {
+				t.Errorf("%s: unexpected error: %s", test.name, text)
+			}
+			continue
+		}
+
+		want := "KEY_SLOT must be overridden; it has its default value (0)"
+		if !strings.Contains(text, want) {
+			t.Errorf("%s: error text \"%s\" does not contain \"%s\"",
+				test.name, text, want)
+		}
+	}
+}
@@ -21,6 +21,7 @@ package syscfg
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -81,6 +82,17 @@ type CfgEntry struct {
 	SettingType  CfgSettingType
 	Restrictions []CfgRestriction
 
+	// Exclusion groups the setting belongs to (exclusion_groups).  At most
+	// one setting in a group may be enabled.
+	ExclusionGroups []string
+
+	// Declared bounds of an integer setting (min, max); nil if unbounded.
+	Min *int
+	Max *int
+
+	// Values the setting may take (choices); empty if unrestricted.
+	Choices []string
+
 	History []CfgPoint
 }
 
@@ -115,6 +127,14 @@ type Cfg struct {
 	// Setting restrictions not met.
 	Violations map[string][]CfgRestriction
 
+	// Exclusion groups with more than one setting enabled; group name =>
+	// names of the enabled settings.
+	Exclusions map[string][]string
+
+	// Names of settings whose values violate their declared bounds or
+	// choices.
+	RangeViolations []string
+
 	// Attempted override by bottom-priority packages (libraries).
 	Laterals []CfgLateral
 
@@ -127,6 +147,7 @@ func NewCfg() Cfg {
 		Orphans:        map[string][]CfgPoint{},
 		Ambiguities:    map[string][]CfgPoint{},
 		Violations:     map[string][]CfgRestriction{},
+		Exclusions:     map[string][]string{},
 		Laterals:       []CfgLateral{},
 		FlashConflicts: []CfgFlashConflict{},
 	}
@@ -156,6 +177,25 @@ func (cfg *Cfg) Features() map[string]bool {
 	return features
 }
 
+// Calculates a SHA256 hash identifying the resolved configuration.  The hash
+// covers the name and value of every setting, in sorted order, so it is
+// reproducible across builds of the same configuration.  Each is quoted so
+// that a value containing a newline cannot mimic another setting.
+func (cfg *Cfg) Hash() []byte {
+	names := make([]string, 0, len(cfg.Settings))
+	for name, _ := range cfg.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(hash, "%q=%q\n", name, cfg.Settings[name].Value)
+	}
+
+	return hash.Sum(nil)
+}
+
 func (cfg *Cfg) FeaturesForLpkg(lpkg *pkg.LocalPackage) map[string]bool {
 	features := cfg.Features()
 
@@ -304,6 +344,12 @@ func readSetting(name string, lpkg *pkg.LocalPackage,
 		entry.Restrictions = append(entry.Restrictions, r)
 	}
 
+	entry.ExclusionGroups = cast.ToStringSlice(vals["exclusion_groups"])
+
+	if err := entry.readValueRange(vals); err != nil {
+		return entry, err
+	}
+
 	return entry, nil
 }
 
@@ -440,6 +486,24 @@ func (cfg *Cfg) detectFlashConflicts(flashMap flash.FlashMap) {
 		}
 	}
 
+	// Settings of other types may still refer to a flash area by its macro
+	// name (e.g., a log storage area).  Ensure any such area exists.
+	for _, entry := range cfg.Settings {
+		if entry.SettingType == CFG_SETTING_TYPE_FLASH_OWNER {
+			continue
+		}
+
+		if strings.HasPrefix(entry.Value, flash.FLASH_AREA_NAME_PREFIX) {
+			if _, ok := flashMap.Areas[entry.Value]; !ok {
+				conflict := CfgFlashConflict{
+					SettingNames: []string{entry.Name},
+					Code:         CFG_FLASH_CONFLICT_CODE_BAD_NAME,
+				}
+				cfg.FlashConflicts = append(cfg.FlashConflicts, conflict)
+			}
+		}
+	}
+
 	// Settings with type flash_owner must have unique values.
 	for _, entries := range areaEntryMap {
 		if len(entries) > 1 {
@@ -475,7 +539,8 @@ func (cfg *Cfg) flashConflictErrorText(conflict CfgFlashConflict) string {
 			entry.Value)
 
 	default:
-		panic("Invalid flash conflict code: " + string(conflict.Code))
+		panic(fmt.Sprintf("Invalid flash conflict code: %d",
+			conflict.Code))
 	}
 }
 
@@ -523,6 +588,33 @@ func (cfg *Cfg) ErrorText() string {
 		}
 	}
 
+	if len(cfg.Exclusions) > 0 {
+		str += "Syscfg exclusion group violations detected:\n"
+
+		groups := make([]string, 0, len(cfg.Exclusions))
+		for group, _ := range cfg.Exclusions {
+			groups = append(groups, group)
+		}
+		sort.Strings(groups)
+
+		for _, group := range groups {
+			names := cfg.Exclusions[group]
+			for _, name := range names {
+				historyMap[name] = cfg.Settings[name].History
+			}
+			str += "    " + exclusionText(group, names) + "\n"
+		}
+	}
+
+	if len(cfg.RangeViolations) > 0 {
+		str += "Syscfg range violations detected:\n"
+		for _, name := range cfg.RangeViolations {
+			entry := cfg.Settings[name]
+			historyMap[name] = entry.History
+			str += "    " + rangeViolationText(entry) + "\n"
+		}
+	}
+
 	if len(cfg.Ambiguities) > 0 {
 		str += "Syscfg ambiguities detected:\n"
 
@@ -673,9 +765,10 @@ func (cfg *Cfg) detectAmbiguities() {
 	}
 }
 
+// Overrides take precedence over all package-specified values.
 func Read(lpkgs []*pkg.LocalPackage, apis []string,
-	injectedSettings map[string]string, features map[string]bool,
-	flashMap flash.FlashMap) (Cfg, error) {
+	injectedSettings map[string]string, overrides map[string]string,
+	features map[string]bool, flashMap flash.FlashMap) (Cfg, error) {
 
 	cfg := NewCfg()
 	for k, v := range injectedSettings {
@@ -717,8 +810,12 @@ func Read(lpkgs []*pkg.LocalPackage, apis []string,
 		}
 	}
 
+	cfg.applyOverrides(overrides)
+
 	cfg.detectAmbiguities()
 	cfg.detectViolations()
+	cfg.detectExclusions()
+	cfg.detectRangeViolations()
 	cfg.detectFlashConflicts(flashMap)
 
 	return cfg, nil
@@ -796,7 +893,7 @@ func calcPriorities(cfg Cfg, settingType CfgSettingType, max int,
 		greatest++
 		if greatest > max {
 			return util.FmtNewtError("could not assign 'any' priority: "+
-				"value too great (> %d); setting=%s value=%s pkg=%s",
+				"value too great (> %d); setting=%s value=%d pkg=%s",
 				max, name, greatest,
 				mostRecentPoint(entry).Name())
 		}
@@ -896,7 +993,7 @@ func writeSettings(cfg Cfg, w io.Writer) {
 }
 
 func write(cfg Cfg, w io.Writer) {
-	fmt.Fprintf(w, newtutil.GeneratedPreamble())
+	fmt.Fprint(w, newtutil.GeneratedPreamble())
 
 	fmt.Fprintf(w, "#ifndef H_MYNEWT_SYSCFG_\n")
 	fmt.Fprintf(w, "#define H_MYNEWT_SYSCFG_\n\n")
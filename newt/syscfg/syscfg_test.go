@@ -0,0 +1,161 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package syscfg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/pkg"
+)
+
+// Builds a configuration from setting definitions, as they would appear in
+// a package's syscfg.defs section, and values, as they would appear in a
+// higher priority package's syscfg.vals section.
+func testDefCfg(t *testing.T, defs map[string]map[interface{}]interface{},
+	vals map[string]string) Cfg {
+
+	defPkg := pkg.NewLocalPackage(nil, "/test/lib")
+	defPkg.SetName("test/lib")
+	valPkg := pkg.NewLocalPackage(nil, "/test/target")
+	valPkg.SetName("test/target")
+
+	cfg := NewCfg()
+	for name, def := range defs {
+		entry, err := readSetting(name, defPkg, def)
+		if err != nil {
+			t.Fatalf("readSetting(%s): %s", name, err.Error())
+		}
+		cfg.Settings[name] = entry
+	}
+
+	for name, value := range vals {
+		entry := cfg.Settings[name]
+		entry.appendValue(valPkg, value)
+		cfg.Settings[name] = entry
+	}
+
+	return cfg
+}
+
+// Settings that name a flash area must name one in the flash map.
+func TestFlashAreaReferences(t *testing.T) {
+	fm, err := flash.NewFlashMap([]flash.FlashArea{
+		{
+			Name:   flash.FLASH_AREA_NAME_BOOTLOADER,
+			Id:     0,
+			Offset: 0,
+			Size:   0x4000,
+		},
+		{
+			Name:   "FLASH_AREA_LOG",
+			Id:     16,
+			Offset: 0x4000,
+			Size:   0x4000,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		typ   string
+		want  string // Expected error text; "" if none.
+	}{
+		{"no area", "5", "", ""},
+		{"known area", "FLASH_AREA_LOG", "", ""},
+		{"known owner", "FLASH_AREA_LOG", "flash_owner", ""},
+		{
+			"unknown area",
+			"FLASH_AREA_BOGUS",
+			"",
+			"Setting LOG_AREA specifies unknown flash area: " +
+				"FLASH_AREA_BOGUS",
+		},
+		{
+			"unknown owner",
+			"FLASH_AREA_BOGUS",
+			"flash_owner",
+			"Setting LOG_AREA specifies unknown flash area: " +
+				"FLASH_AREA_BOGUS",
+		},
+	}
+
+	for _, test := range tests {
+		def := map[interface{}]interface{}{"value": test.value}
+		if test.typ != "" {
+			def["type"] = test.typ
+		}
+		cfg := testDefCfg(t,
+			map[string]map[interface{}]interface{}{"LOG_AREA": def}, nil)
+
+		cfg.detectFlashConflicts(fm)
+		text := cfg.ErrorText()
+
+		if test.want == "" {
+			if text != "" {
+				t.Errorf("%s: unexpected error: %s", test.name, text)
+			}
+			continue
+		}
+
+		if len(cfg.FlashConflicts) != 1 {
+			t.Errorf("%s: got %d flash conflicts; want 1", test.name,
+				len(cfg.FlashConflicts))
+		}
+		if !strings.Contains(text, test.want) {
+			t.Errorf("%s: error text \"%s\" does not contain \"%s\"",
+				test.name, text, test.want)
+		}
+	}
+}
+
+// The configuration hash depends on every setting's name and value, but not
+// on how the values were arrived at.
+func TestCfgHash(t *testing.T) {
+	base := testCfg(map[string]string{"A": "1", "B": "0"})
+	baseHash := base.Hash()
+
+	tests := []struct {
+		name     string
+		settings map[string]string
+		same     bool
+	}{
+		{"identical", map[string]string{"B": "0", "A": "1"}, true},
+		{"value differs", map[string]string{"A": "1", "B": "1"}, false},
+		{"setting added", map[string]string{"A": "1", "B": "0", "C": ""},
+			false},
+		{"setting renamed", map[string]string{"A": "1", "C": "0"}, false},
+		{"boundary moved", map[string]string{"A": "1\nB=0"}, false},
+	}
+
+	for _, test := range tests {
+		cfg := testCfg(test.settings)
+		same := bytes.Equal(cfg.Hash(), baseHash)
+		if same != test.same {
+			t.Errorf("%s: hash equal=%v; want %v", test.name, same,
+				test.same)
+		}
+	}
+}
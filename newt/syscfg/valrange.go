@@ -0,0 +1,140 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package syscfg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Reads the bounds (min, max) and permitted values (choices) from a setting
+// definition.
+func (entry *CfgEntry) readValueRange(
+	vals map[interface{}]interface{}) error {
+
+	readBound := func(key string) (*int, error) {
+		if vals[key] == nil {
+			return nil, nil
+		}
+
+		str := stringValue(vals[key])
+		n, err := util.AtoiNoOct(str)
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"setting %s specifies invalid %s: %s", entry.Name, key, str)
+		}
+		return &n, nil
+	}
+
+	var err error
+	if entry.Min, err = readBound("min"); err != nil {
+		return err
+	}
+	if entry.Max, err = readBound("max"); err != nil {
+		return err
+	}
+	if entry.Min != nil && entry.Max != nil && *entry.Min > *entry.Max {
+		return util.FmtNewtError(
+			"setting %s specifies min (%d) greater than max (%d)",
+			entry.Name, *entry.Min, *entry.Max)
+	}
+
+	for _, c := range cast.ToStringSlice(vals["choices"]) {
+		entry.Choices = append(entry.Choices, strings.TrimSpace(c))
+	}
+
+	return nil
+}
+
+// Indicates whether a setting's value is permitted by its declared choices.
+// A setting without choices permits any value.
+func (entry *CfgEntry) valueIsChoice() bool {
+	if len(entry.Choices) == 0 {
+		return true
+	}
+
+	for _, c := range entry.Choices {
+		if c == entry.Value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Indicates whether a setting's value lies outside its declared bounds or
+// is not one of its declared choices.  Values that are not integer literals
+// (e.g., C expressions) cannot be checked against bounds and are accepted.
+// An empty value is always accepted.
+func (entry *CfgEntry) valueOutOfRange() bool {
+	if entry.Value == "" {
+		return false
+	}
+
+	if !entry.valueIsChoice() {
+		return true
+	}
+
+	if entry.Min == nil && entry.Max == nil {
+		return false
+	}
+
+	n, err := util.AtoiNoOct(entry.Value)
+	if err != nil {
+		return false
+	}
+
+	return (entry.Min != nil && n < *entry.Min) ||
+		(entry.Max != nil && n > *entry.Max)
+}
+
+// Finds settings whose values violate their declared bounds or choices.
+func (cfg *Cfg) detectRangeViolations() {
+	for _, entry := range cfg.Settings {
+		if entry.valueOutOfRange() {
+			cfg.RangeViolations = append(cfg.RangeViolations, entry.Name)
+		}
+	}
+
+	sort.Strings(cfg.RangeViolations)
+}
+
+func rangeViolationText(entry CfgEntry) string {
+	if !entry.valueIsChoice() {
+		return fmt.Sprintf("Setting %s has value %s; must be one of: %s",
+			entry.Name, entry.Value, strings.Join(entry.Choices, ", "))
+	}
+
+	bounds := []string{}
+	if entry.Min != nil {
+		bounds = append(bounds, fmt.Sprintf("min=%d", *entry.Min))
+	}
+	if entry.Max != nil {
+		bounds = append(bounds, fmt.Sprintf("max=%d", *entry.Max))
+	}
+
+	return fmt.Sprintf("Setting %s has value %s; out of range (%s)",
+		entry.Name, entry.Value, strings.Join(bounds, " "))
+}
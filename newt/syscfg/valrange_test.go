@@ -0,0 +1,114 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package syscfg
+
+import (
+	"strings"
+	"testing"
+)
+
+// Values must lie within a setting's declared bounds and choices.
+func TestRangeViolations(t *testing.T) {
+	tests := []struct {
+		name  string
+		def   map[interface{}]interface{}
+		value string
+		want  string // Expected error text; "" if none.
+	}{
+		{
+			"in range",
+			map[interface{}]interface{}{"min": 1, "max": 10},
+			"10",
+			"",
+		},
+		{
+			"below min",
+			map[interface{}]interface{}{"min": 1, "max": 10},
+			"0",
+			"Setting SIZE has value 0; out of range (min=1 max=10)",
+		},
+		{
+			"above max",
+			map[interface{}]interface{}{"max": 0x10},
+			"0x11",
+			"Setting SIZE has value 0x11; out of range (max=16)",
+		},
+		{
+			"expression",
+			map[interface{}]interface{}{"max": 10},
+			"(MYNEWT_VAL(X) * 2)",
+			"",
+		},
+		{
+			"choice",
+			map[interface{}]interface{}{
+				"choices": []interface{}{"8", "16"},
+			},
+			"16",
+			"",
+		},
+		{
+			"not a choice",
+			map[interface{}]interface{}{
+				"choices": []interface{}{"8", "16"},
+			},
+			"32",
+			"Setting SIZE has value 32; must be one of: 8, 16",
+		},
+	}
+
+	for _, test := range tests {
+		test.def["value"] = "8"
+		cfg := testDefCfg(t,
+			map[string]map[interface{}]interface{}{"SIZE": test.def},
+			map[string]string{"SIZE": test.value})
+
+		cfg.detectRangeViolations()
+		text := cfg.ErrorText()
+
+		if test.want == "" {
+			if text != "" {
+				t.Errorf("%s: unexpected error: %s", test.name, text)
+			}
+			continue
+		}
+
+		if !strings.Contains(text, test.want) {
+			t.Errorf("%s: error text \"%s\" does not contain \"%s\"",
+				test.name, text, test.want)
+		}
+	}
+}
+
+func TestReadValueRangeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		def  map[interface{}]interface{}
+	}{
+		{"invalid min", map[interface{}]interface{}{"min": "abc"}},
+		{"min above max", map[interface{}]interface{}{"min": 5, "max": 4}},
+	}
+
+	for _, test := range tests {
+		if _, err := readSetting("SIZE", nil, test.def); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
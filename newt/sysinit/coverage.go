@@ -0,0 +1,184 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package sysinit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/util"
+)
+
+// Matches the comment that precedes each init call in a generated sysinit
+// function: "/* <stage>.<index>: <package> */".
+var callCommentRe = regexp.MustCompile(`^\s*/\* (\d+)\.(\d+): (\S+) \*/$`)
+
+// Matches an init call: "<function>();".
+var callRe = regexp.MustCompile(`^\s*(\w+)\(\);$`)
+
+// An init call read from a generated sysinit source file.
+type GeneratedCall struct {
+	Stage   int
+	Index   int
+	PkgName string
+	FnName  string
+}
+
+// Extracts the init calls from the contents of a generated sysinit source
+// file.  The call to os_init(), which belongs to no package, is not included.
+func ParseGenerated(data []byte) ([]GeneratedCall, error) {
+	calls := []GeneratedCall{}
+
+	var pending *GeneratedCall
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+
+		if m := callCommentRe.FindStringSubmatch(line); m != nil {
+			stage, _ := strconv.Atoi(m[1])
+			index, _ := strconv.Atoi(m[2])
+			pending = &GeneratedCall{
+				Stage:   stage,
+				Index:   index,
+				PkgName: m[3],
+			}
+			continue
+		}
+
+		if pending != nil {
+			m := callRe.FindStringSubmatch(line)
+			if m == nil {
+				return nil, util.FmtNewtError(
+					"line %d: expected init call for package %s",
+					lineNum, pending.PkgName)
+			}
+			pending.FnName = m[1]
+			calls = append(calls, *pending)
+			pending = nil
+		}
+	}
+
+	return calls, nil
+}
+
+// Returns the path of the sysinit source file generated for a target.
+func GeneratedPath(srcDir string, targetName string, isLoader bool) string {
+	if isLoader {
+		return fmt.Sprintf("%s/%s-sysinit-loader.c", srcDir, targetName)
+	}
+	return fmt.Sprintf("%s/%s-sysinit-app.c", srcDir, targetName)
+}
+
+// Determines whether a generated sysinit function calls the init function of
+// every specified package that declares one, at the package's declared stage.
+// A package that declares an init function without a numeric init stage is
+// also reported, as is a generated call belonging to no such package.  Each
+// problem is described by a string; the result is empty if the generated
+// function is complete.
+func CoverageProblems(pkgs []*pkg.LocalPackage,
+	generated []GeneratedCall) []string {
+
+	genMap := map[string]GeneratedCall{}
+	for _, c := range generated {
+		genMap[c.PkgName] = c
+	}
+
+	problems := []string{}
+	declared := map[string]bool{}
+	for _, p := range pkg.SortLclPkgs(onlyPkgsWithInit(pkgs)) {
+		declared[p.Name()] = true
+
+		stageStr := ""
+		if p.PkgV != nil {
+			stageStr = p.PkgV.GetString("pkg.init_stage")
+		}
+		if _, err := strconv.Atoi(stageStr); err != nil {
+			problems = append(problems, fmt.Sprintf(
+				"package %s declares init function %s without a valid "+
+					"pkg.init_stage (\"%s\")",
+				p.Name(), p.InitFnName(), stageStr))
+		}
+
+		c, ok := genMap[p.Name()]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf(
+				"package %s declares init function %s, but it is not "+
+					"called", p.Name(), p.InitFnName()))
+
+		case c.FnName != p.InitFnName():
+			problems = append(problems, fmt.Sprintf(
+				"package %s declares init function %s, but %s is called",
+				p.Name(), p.InitFnName(), c.FnName))
+
+		case c.Stage != p.InitStage():
+			problems = append(problems, fmt.Sprintf(
+				"package %s declares init stage %d, but %s is called in "+
+					"stage %d", p.Name(), p.InitStage(), c.FnName, c.Stage))
+		}
+	}
+
+	names := make([]string, 0, len(genMap))
+	for name, _ := range genMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !declared[name] {
+			problems = append(problems, fmt.Sprintf(
+				"%s is called for package %s, which does not declare an "+
+					"init function in this build", genMap[name].FnName, name))
+		}
+	}
+
+	return problems
+}
+
+// Reads a target's generated sysinit source file and checks it against the
+// specified packages.
+func CheckGeneratedCoverage(pkgs []*pkg.LocalPackage, srcDir string,
+	targetName string, isLoader bool) ([]string, error) {
+
+	path := GeneratedPath(srcDir, targetName, isLoader)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, util.FmtNewtError(
+				"Generated sysinit file %s does not exist; build the "+
+					"target first", path)
+		}
+		return nil, util.ChildNewtError(err)
+	}
+
+	calls, err := ParseGenerated(data)
+	if err != nil {
+		return nil, util.PreNewtError(err, "Cannot parse %s", path)
+	}
+
+	return CoverageProblems(pkgs, calls), nil
+}
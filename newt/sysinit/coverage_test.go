@@ -0,0 +1,201 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package sysinit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/repo"
+)
+
+var testCoveragePkgYmls = map[string]string{
+	"kernel/os": `pkg.name: kernel/os
+pkg.init_function: os_pkg_init
+pkg.init_stage: 0
+`,
+	"sys/log": `pkg.name: sys/log
+pkg.init_function: log_init
+pkg.init_stage: 100
+`,
+	"sys/stats": `pkg.name: sys/stats
+pkg.init_function: stats_module_init
+pkg.init_stage: 101
+`,
+	"sys/shell": `pkg.name: sys/shell
+pkg.init_function: shell_init
+pkg.init_stage: early
+`,
+	"hw/hal": `pkg.name: hw/hal
+`,
+}
+
+// Loads the named test packages.  A package's pkg.yml can be replaced via the
+// overrides map.
+func loadTestCoveragePkgs(t *testing.T, dir string, names []string,
+	overrides map[string]string) []*pkg.LocalPackage {
+
+	lpkgs := []*pkg.LocalPackage{}
+	for _, name := range names {
+		pkgDir := filepath.Join(dir, "pkgs", name)
+		if err := os.MkdirAll(pkgDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		yml, ok := overrides[name]
+		if !ok {
+			yml = testCoveragePkgYmls[name]
+		}
+		err := ioutil.WriteFile(filepath.Join(pkgDir, "pkg.yml"),
+			[]byte(yml), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lpkg, err := pkg.LoadLocalPackage(&repo.Repo{}, pkgDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lpkgs = append(lpkgs, lpkg)
+	}
+
+	return lpkgs
+}
+
+func TestCheckGeneratedCoverage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-sysinit-coverage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcDir := filepath.Join(dir, "generated", "src")
+	if err := os.MkdirAll(srcDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Generate sysinit code for everything except sys/stats and sys/shell.
+	genPkgs := loadTestCoveragePkgs(t, dir,
+		[]string{"kernel/os", "sys/log", "hw/hal"}, nil)
+	if err := EnsureWritten(genPkgs, srcDir, "blinky", false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		pkgs      []string
+		overrides map[string]string
+		problems  []string
+	}{
+		{
+			name:     "complete",
+			pkgs:     []string{"kernel/os", "sys/log", "hw/hal"},
+			problems: []string{},
+		},
+		{
+			name: "excluded init",
+			pkgs: []string{"kernel/os", "sys/log", "sys/stats", "hw/hal"},
+			problems: []string{
+				"package sys/stats declares init function " +
+					"stats_module_init, but it is not called",
+			},
+		},
+		{
+			name: "invalid stage",
+			pkgs: []string{"kernel/os", "sys/log", "sys/shell"},
+			problems: []string{
+				"package sys/shell declares init function shell_init " +
+					"without a valid pkg.init_stage (\"early\")",
+				"package sys/shell declares init function shell_init, " +
+					"but it is not called",
+			},
+		},
+		{
+			name: "changed stage and function",
+			pkgs: []string{"kernel/os", "sys/log"},
+			overrides: map[string]string{
+				"kernel/os": "pkg.name: kernel/os\n" +
+					"pkg.init_function: os_init_early\n" +
+					"pkg.init_stage: 0\n",
+				"sys/log": "pkg.name: sys/log\n" +
+					"pkg.init_function: log_init\n" +
+					"pkg.init_stage: 200\n",
+			},
+			problems: []string{
+				"package kernel/os declares init function " +
+					"os_init_early, but os_pkg_init is called",
+				"package sys/log declares init stage 200, but log_init " +
+					"is called in stage 100",
+			},
+		},
+		{
+			name: "stray call",
+			pkgs: []string{"sys/log"},
+			problems: []string{
+				"os_pkg_init is called for package kernel/os, which " +
+					"does not declare an init function in this build",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		lpkgs := loadTestCoveragePkgs(t, filepath.Join(dir, test.name),
+			test.pkgs, test.overrides)
+
+		problems, err := CheckGeneratedCoverage(lpkgs, srcDir, "blinky",
+			false)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(problems, test.problems) {
+			t.Errorf("%s: wrong problems:\nwant=%q\nhave=%q",
+				test.name, test.problems, problems)
+		}
+	}
+
+	// The loader file was never generated.
+	_, err = CheckGeneratedCoverage(genPkgs, srcDir, "blinky", true)
+	if err == nil || !strings.Contains(err.Error(), "build the target") {
+		t.Errorf("missing loader file not reported: %v", err)
+	}
+}
+
+func TestParseGeneratedInvalid(t *testing.T) {
+	src := "void\nsysinit_app(void)\n{\n" +
+		"    /* 100.0: sys/log */\n" +
+		"    log_init(1);\n" +
+		"}\n"
+
+	_, err := ParseGenerated([]byte(src))
+	if err == nil {
+		t.Fatalf("expected error; none reported")
+	}
+
+	exp := "line 5: expected init call for package sys/log"
+	if err.Error() != exp {
+		t.Errorf("wrong error: want=%s have=%s", exp, err.Error())
+	}
+}
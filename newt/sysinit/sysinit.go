@@ -27,6 +27,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	log "github.com/Sirupsen/logrus"
 
@@ -75,12 +76,7 @@ func onlyPkgsWithInit(pkgs []*pkg.LocalPackage) []*pkg.LocalPackage {
 	return good
 }
 
-func write(pkgs []*pkg.LocalPackage, isLoader bool,
-	w io.Writer) {
-
-	goodPkgs := onlyPkgsWithInit(pkgs)
-	stageMap := buildStageMap(goodPkgs)
-
+func sortedStages(stageMap map[int][]*pkg.LocalPackage) []int {
 	i := 0
 	stages := make([]int, len(stageMap))
 	for k, _ := range stageMap {
@@ -89,7 +85,90 @@ func write(pkgs []*pkg.LocalPackage, isLoader bool,
 	}
 	sort.Ints(stages)
 
-	fmt.Fprintf(w, newtutil.GeneratedPreamble())
+	return stages
+}
+
+// A single call in a generated sysinit function.
+type InitCall struct {
+	Stage  int
+	Index  int // Position within the stage.
+	FnName string
+	Pkg    *pkg.LocalPackage
+}
+
+// Calculates the order in which the generated sysinit function calls the
+// init functions of the specified packages.
+func CallOrder(pkgs []*pkg.LocalPackage) []InitCall {
+	stageMap := buildStageMap(onlyPkgsWithInit(pkgs))
+
+	calls := []InitCall{}
+	for _, s := range sortedStages(stageMap) {
+		for i, p := range pkg.SortLclPkgs(stageMap[s]) {
+			calls = append(calls, InitCall{
+				Stage:  s,
+				Index:  i,
+				FnName: p.InitFnName(),
+				Pkg:    p,
+			})
+		}
+	}
+
+	return calls
+}
+
+// Produces a description of each questionable part of a sysinit call order.
+// A stage containing several packages is flagged, since packages in the same
+// stage are called in order of package name, which is unlikely to be
+// intended.  An init function called more than once is also flagged.
+func CallConflicts(calls []InitCall) []string {
+	conflicts := []string{}
+
+	stageNames := map[int][]string{}
+	fnPkgs := map[string][]string{}
+	for _, c := range calls {
+		stageNames[c.Stage] = append(stageNames[c.Stage], c.Pkg.Name())
+		fnPkgs[c.FnName] = append(fnPkgs[c.FnName], c.Pkg.Name())
+	}
+
+	stages := make([]int, 0, len(stageNames))
+	for s, _ := range stageNames {
+		stages = append(stages, s)
+	}
+	sort.Ints(stages)
+
+	for _, s := range stages {
+		if names := stageNames[s]; len(names) > 1 {
+			conflicts = append(conflicts, fmt.Sprintf(
+				"stage %d is shared by %d packages; order is by package "+
+					"name: %s", s, len(names), strings.Join(names, ", ")))
+		}
+	}
+
+	fnNames := make([]string, 0, len(fnPkgs))
+	for fn, _ := range fnPkgs {
+		fnNames = append(fnNames, fn)
+	}
+	sort.Strings(fnNames)
+
+	for _, fn := range fnNames {
+		if names := fnPkgs[fn]; len(names) > 1 {
+			conflicts = append(conflicts, fmt.Sprintf(
+				"init function %s is called by %d packages: %s",
+				fn, len(names), strings.Join(names, ", ")))
+		}
+	}
+
+	return conflicts
+}
+
+func write(pkgs []*pkg.LocalPackage, isLoader bool,
+	w io.Writer) {
+
+	goodPkgs := onlyPkgsWithInit(pkgs)
+	stageMap := buildStageMap(goodPkgs)
+	stages := sortedStages(stageMap)
+
+	fmt.Fprint(w, newtutil.GeneratedPreamble())
 
 	if isLoader {
 		fmt.Fprintf(w, "#if SPLIT_LOADER\n\n")
@@ -140,12 +219,7 @@ func EnsureWritten(pkgs []*pkg.LocalPackage, srcDir string, targetName string,
 	buf := bytes.Buffer{}
 	write(pkgs, isLoader, &buf)
 
-	var path string
-	if isLoader {
-		path = fmt.Sprintf("%s/%s-sysinit-loader.c", srcDir, targetName)
-	} else {
-		path = fmt.Sprintf("%s/%s-sysinit-app.c", srcDir, targetName)
-	}
+	path := GeneratedPath(srcDir, targetName, isLoader)
 
 	writeReqd, err := writeRequired(buf.Bytes(), path)
 	if err != nil {
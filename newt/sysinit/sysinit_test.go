@@ -0,0 +1,150 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package sysinit
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/repo"
+)
+
+// Each package's init function and stage.  Packages without an init function
+// are not called.
+var testInitPkgs = []struct {
+	name  string
+	fn    string
+	stage int
+}{
+	{"sys/stats", "stats_module_init", 100},
+	{"net/ble", "ble_hs_init", 200},
+	{"kernel/os", "os_pkg_init", 0},
+	{"libs/util", "", 0},
+	{"sys/log", "log_init", 100},
+	{"libs/compat", "log_init", 300},
+	{"sys/console", "console_pkg_init", 20},
+}
+
+func loadTestInitPkgs(t *testing.T, dir string) []*pkg.LocalPackage {
+	lpkgs := []*pkg.LocalPackage{}
+	for _, p := range testInitPkgs {
+		yml := "pkg.name: " + p.name + "\n"
+		if p.fn != "" {
+			yml += fmt.Sprintf("pkg.init_function: %s\n"+
+				"pkg.init_stage: %d\n", p.fn, p.stage)
+		}
+
+		pkgDir := filepath.Join(dir, p.name)
+		if err := os.MkdirAll(pkgDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		err := ioutil.WriteFile(filepath.Join(pkgDir, "pkg.yml"),
+			[]byte(yml), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lpkg, err := pkg.LoadLocalPackage(&repo.Repo{}, pkgDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lpkgs = append(lpkgs, lpkg)
+	}
+
+	return lpkgs
+}
+
+func TestCallOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-sysinit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lpkgs := loadTestInitPkgs(t, dir)
+	calls := CallOrder(lpkgs)
+
+	expCalls := []string{
+		"0.0 kernel/os os_pkg_init",
+		"20.0 sys/console console_pkg_init",
+		"100.0 sys/log log_init",
+		"100.1 sys/stats stats_module_init",
+		"200.0 net/ble ble_hs_init",
+		"300.0 libs/compat log_init",
+	}
+
+	actCalls := []string{}
+	for _, c := range calls {
+		actCalls = append(actCalls, fmt.Sprintf("%d.%d %s %s",
+			c.Stage, c.Index, c.Pkg.Name(), c.FnName))
+	}
+	if !reflect.DeepEqual(actCalls, expCalls) {
+		t.Errorf("wrong call order:\nwant=%v\nhave=%v", expCalls, actCalls)
+	}
+
+	// The reported order must match the generated sysinit function.
+	buf := &bytes.Buffer{}
+	write(lpkgs, false, buf)
+
+	genCalls := []string{}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		var stage, index int
+		var name string
+		n, _ := fmt.Sscanf(strings.TrimSpace(line), "/* %d.%d: %s */",
+			&stage, &index, &name)
+		if n == 3 {
+			genCalls = append(genCalls,
+				fmt.Sprintf("%d.%d %s", stage, index, name))
+		}
+	}
+
+	expGen := []string{}
+	for _, c := range calls {
+		expGen = append(expGen,
+			fmt.Sprintf("%d.%d %s", c.Stage, c.Index, c.Pkg.Name()))
+	}
+	if !reflect.DeepEqual(genCalls, expGen) {
+		t.Errorf("call order differs from generated code:\n"+
+			"generated=%v\nreported=%v", genCalls, expGen)
+	}
+
+	expConflicts := []string{
+		"stage 100 is shared by 2 packages; order is by package name: " +
+			"sys/log, sys/stats",
+		"init function log_init is called by 2 packages: " +
+			"sys/log, libs/compat",
+	}
+	conflicts := CallConflicts(calls)
+	if !reflect.DeepEqual(conflicts, expConflicts) {
+		t.Errorf("wrong conflicts:\nwant=%q\nhave=%q",
+			expConflicts, conflicts)
+	}
+
+	if conflicts := CallConflicts(calls[:2]); len(conflicts) != 0 {
+		t.Errorf("unexpected conflicts: %q", conflicts)
+	}
+}
@@ -0,0 +1,132 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package target
+
+import (
+	"sort"
+
+	"mynewt.apache.org/newt/newt/project"
+)
+
+// The version strings reported for BSPs in the project's local repo and in
+// repos that aren't installed.
+const BSP_VERSION_LOCAL = "local"
+const BSP_VERSION_UNKNOWN = "unknown"
+
+// The BSP used by a target, along with the installed version of the repo
+// containing it.
+type BspVersion struct {
+	Target  *Target
+	BspName string
+	Repo    string
+	Version string
+}
+
+type bspVersionSorter []BspVersion
+
+func (s bspVersionSorter) Len() int {
+	return len(s)
+}
+func (s bspVersionSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s bspVersionSorter) Less(i, j int) bool {
+	return s[i].Target.FullName() < s[j].Target.FullName()
+}
+
+// Describes the BSP repo versions used by a set of targets.
+type BspVersionReport struct {
+	// All targets with a resolvable BSP, sorted by target name.
+	Versions []BspVersion
+
+	// The version most targets use.  In a tie, the lowest version string
+	// wins.
+	Majority string
+
+	// Targets whose BSP repo version differs from the majority.
+	Outliers []BspVersion
+}
+
+// Determines the majority version and flags the targets that don't use it.
+func newBspVersionReport(versions []BspVersion) BspVersionReport {
+	report := BspVersionReport{
+		Versions: versions,
+		Outliers: []BspVersion{},
+	}
+
+	counts := map[string]int{}
+	for _, bv := range versions {
+		counts[bv.Version]++
+	}
+
+	vstrs := make([]string, 0, len(counts))
+	for v, _ := range counts {
+		vstrs = append(vstrs, v)
+	}
+	sort.Strings(vstrs)
+
+	for _, v := range vstrs {
+		if report.Majority == "" || counts[v] > counts[report.Majority] {
+			report.Majority = v
+		}
+	}
+
+	for _, bv := range versions {
+		if bv.Version != report.Majority {
+			report.Outliers = append(report.Outliers, bv)
+		}
+	}
+
+	return report
+}
+
+// Reports the BSP repo version used by each of the specified targets.
+// Targets whose BSP cannot be resolved are skipped.
+func BspVersions(targets []*Target) BspVersionReport {
+	proj := project.GetProject()
+
+	versions := []BspVersion{}
+	for _, t := range targets {
+		bsp := t.Bsp()
+		if bsp == nil {
+			continue
+		}
+
+		r := bsp.Repo()
+		bv := BspVersion{
+			Target:  t,
+			BspName: bsp.FullName(),
+			Repo:    r.Name(),
+			Version: BSP_VERSION_LOCAL,
+		}
+		if !r.IsLocal() {
+			bv.Version = BSP_VERSION_UNKNOWN
+			if vers := proj.InstalledVersion(r.Name()); vers != nil {
+				bv.Version = vers.String()
+			}
+		}
+
+		versions = append(versions, bv)
+	}
+
+	sort.Sort(bspVersionSorter(versions))
+
+	return newBspVersionReport(versions)
+}
@@ -0,0 +1,119 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package target
+
+import (
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/repo"
+)
+
+// Describes a target that uses a BSP from a repo at the specified version.
+func testBspVersion(name string, version string) BspVersion {
+	lpkg := pkg.NewLocalPackage(&repo.Repo{}, "/test/targets/"+name)
+	lpkg.SetName("targets/" + name)
+
+	return BspVersion{
+		Target:  &Target{basePkg: lpkg},
+		BspName: "@apache-mynewt-core/hw/bsp/nrf52dk",
+		Repo:    "apache-mynewt-core",
+		Version: version,
+	}
+}
+
+func TestBspVersionReport(t *testing.T) {
+	tests := []struct {
+		name         string
+		versions     []BspVersion
+		wantMajority string
+		wantOutliers []string
+	}{
+		{
+			name: "consistent",
+			versions: []BspVersion{
+				testBspVersion("blinky", "1.4.0"),
+				testBspVersion("slinky", "1.4.0"),
+			},
+			wantMajority: "1.4.0",
+		},
+		{
+			name: "one target on a different version",
+			versions: []BspVersion{
+				testBspVersion("blinky", "1.4.0"),
+				testBspVersion("bleprph", "1.3.0"),
+				testBspVersion("slinky", "1.4.0"),
+			},
+			wantMajority: "1.4.0",
+			wantOutliers: []string{"targets/bleprph"},
+		},
+		{
+			name: "tie won by lowest version string",
+			versions: []BspVersion{
+				testBspVersion("a", "1.4.0"),
+				testBspVersion("b", "1.3.0"),
+				testBspVersion("c", "1.4.0"),
+				testBspVersion("d", "1.3.0"),
+			},
+			wantMajority: "1.3.0",
+			wantOutliers: []string{"targets/a", "targets/c"},
+		},
+		{
+			name: "local and unknown versions",
+			versions: []BspVersion{
+				testBspVersion("a", BSP_VERSION_LOCAL),
+				testBspVersion("b", BSP_VERSION_UNKNOWN),
+				testBspVersion("c", BSP_VERSION_LOCAL),
+			},
+			wantMajority: BSP_VERSION_LOCAL,
+			wantOutliers: []string{"targets/b"},
+		},
+		{
+			name:     "no targets",
+			versions: []BspVersion{},
+		},
+	}
+
+	for _, test := range tests {
+		report := newBspVersionReport(test.versions)
+
+		if report.Majority != test.wantMajority {
+			t.Errorf("%s: majority=%s; want %s", test.name, report.Majority,
+				test.wantMajority)
+		}
+
+		outliers := []string{}
+		for _, bv := range report.Outliers {
+			outliers = append(outliers, bv.Target.Name())
+		}
+		if strings.Join(outliers, " ") !=
+			strings.Join(test.wantOutliers, " ") {
+
+			t.Errorf("%s: outliers=%v; want %v", test.name, outliers,
+				test.wantOutliers)
+		}
+
+		if len(report.Versions) != len(test.versions) {
+			t.Errorf("%s: report lists %d targets; want %d", test.name,
+				len(report.Versions), len(test.versions))
+		}
+	}
+}
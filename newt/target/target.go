@@ -22,21 +22,32 @@ package target
 import (
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 
+	"github.com/spf13/cast"
+
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
 	"mynewt.apache.org/newt/newt/repo"
 	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newt/viper"
 	"mynewt.apache.org/newt/yaml"
 )
 
 const TARGET_FILENAME string = "target.yml"
 const DEFAULT_BUILD_PROFILE string = "default"
 
+// Names the target whose settings this target inherits.  The target's own
+// settings override inherited ones.
+const TARGET_INHERITS_KEY string = "target.inherits"
+
 var globalTargetMap map[string]*Target
 
+// Matches a valid environment variable name.
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 type Target struct {
 	basePkg *pkg.LocalPackage
 
@@ -45,8 +56,27 @@ type Target struct {
 	LoaderName   string
 	BuildProfile string
 
-	// target.yml configuration structure
+	// Strip debug sections from the final elf; optionally retain an
+	// unstripped copy for symbolication.
+	StripDebug     bool
+	KeepUnstripped bool
+
+	// If non-empty, the UF2 family of the device the target runs on; a UF2
+	// file is generated alongside each image.
+	Uf2Family string
+
+	// target.yml configuration structure, including inherited settings.
 	Vars map[string]string
+
+	// Settings and syscfg values inherited from parent targets
+	// (target.inherits).
+	inheritedVars   map[string]string
+	inheritedSyscfg map[string]string
+
+	// The settings and syscfg values the target sets itself.  These are saved
+	// even if they match the inherited values.
+	ownVars   map[string]bool
+	ownSyscfg map[string]bool
 }
 
 func NewTarget(basePkg *pkg.LocalPackage) *Target {
@@ -66,20 +96,159 @@ func LoadTarget(basePkg *pkg.LocalPackage) (*Target, error) {
 
 func (target *Target) Init(basePkg *pkg.LocalPackage) {
 	target.basePkg = basePkg
+	target.Vars = map[string]string{}
+	target.inheritedVars = map[string]string{}
+	target.inheritedSyscfg = map[string]string{}
+	target.ownVars = map[string]bool{}
+	target.ownSyscfg = map[string]bool{}
 }
 
-func (target *Target) Load(basePkg *pkg.LocalPackage) error {
-	v, err := util.ReadConfig(basePkg.BasePath(),
+func readTargetVars(lpkg *pkg.LocalPackage) (map[string]string, error) {
+	v, err := util.ReadConfig(lpkg.BasePath(),
 		strings.TrimSuffix(TARGET_FILENAME, ".yml"))
+	if err != nil {
+		return nil, err
+	}
+
+	vars := map[string]string{}
+	for k, val := range v.AllSettings() {
+		vars[k] = cast.ToString(val)
+	}
+
+	return vars, nil
+}
+
+// Reads the syscfg values from a target's syscfg.yml file.  The file is read
+// directly rather than through the package's in-memory settings, which also
+// hold inherited values once the target is loaded.
+func readTargetSyscfg(lpkg *pkg.LocalPackage) (map[string]string, error) {
+	vals := map[string]string{}
+
+	path := lpkg.BasePath() + "/" + pkg.SYSCFG_YAML_FILENAME
+	if !util.NodeExist(path) {
+		return vals, nil
+	}
+
+	v, err := util.ReadConfig(lpkg.BasePath(),
+		strings.TrimSuffix(pkg.SYSCFG_YAML_FILENAME, ".yml"))
+	if err != nil {
+		return nil, err
+	}
+
+	for k, val := range v.GetStringMap("syscfg.vals") {
+		vals[k] = cast.ToString(val)
+	}
+
+	return vals, nil
+}
+
+// Collects the settings and syscfg values a target inherits from the chain
+// of parents starting with parentName.  Nearer parents override more distant
+// ones.  chain holds the names of the targets visited so far; it is used to
+// detect cycles.  lookup resolves a target name to its package.
+func (target *Target) readInherited(parentName string, chain []string,
+	lookup func(name string) *pkg.LocalPackage) (
+	map[string]string, map[string]string, error) {
+
+	parent := lookup(parentName)
+	if parent == nil {
+		return nil, nil, util.FmtNewtError(
+			"Target %s inherits from unknown target \"%s\"",
+			target.basePkg.FullName(), parentName)
+	}
+	if parent.Type() != pkg.PACKAGE_TYPE_TARGET {
+		return nil, nil, util.FmtNewtError(
+			"Target %s inherits from %s, which is not a target",
+			target.basePkg.FullName(), parent.FullName())
+	}
+
+	for _, name := range chain {
+		if name == parent.FullName() {
+			return nil, nil, util.FmtNewtError(
+				"Target inheritance cycle: %s -> %s",
+				strings.Join(chain, " -> "), parent.FullName())
+		}
+	}
+	chain = append(chain, parent.FullName())
+
+	vars, err := readTargetVars(parent)
+	if err != nil {
+		return nil, nil, err
+	}
+	syscfgVals, err := readTargetSyscfg(parent)
+	if err != nil {
+		return nil, nil, err
+	}
+	target.basePkg.AddCfgFilename(parent.BasePath() + "/" + TARGET_FILENAME)
+	if len(syscfgVals) > 0 {
+		target.basePkg.AddCfgFilename(parent.BasePath() + "/" +
+			pkg.SYSCFG_YAML_FILENAME)
+	}
+
+	mergedVars := map[string]string{}
+	mergedSyscfg := map[string]string{}
+	if grandparent := vars[TARGET_INHERITS_KEY]; grandparent != "" {
+		mergedVars, mergedSyscfg, err = target.readInherited(grandparent,
+			chain, lookup)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	for k, v := range vars {
+		mergedVars[k] = v
+	}
+	for k, v := range syscfgVals {
+		mergedSyscfg[k] = v
+	}
+
+	return mergedVars, mergedSyscfg, nil
+}
+
+func (target *Target) Load(basePkg *pkg.LocalPackage) error {
+	return target.load(basePkg, target.resolvePackageName)
+}
+
+func (target *Target) load(basePkg *pkg.LocalPackage,
+	lookup func(name string) *pkg.LocalPackage) error {
+
+	ownVars, err := readTargetVars(basePkg)
 	if err != nil {
 		return err
 	}
+	ownSyscfg, err := readTargetSyscfg(basePkg)
+	if err != nil {
+		return err
+	}
+
+	target.inheritedVars = map[string]string{}
+	target.inheritedSyscfg = map[string]string{}
+	if parentName := ownVars[TARGET_INHERITS_KEY]; parentName != "" {
+		target.inheritedVars, target.inheritedSyscfg, err =
+			target.readInherited(parentName, []string{basePkg.FullName()},
+				lookup)
+		if err != nil {
+			return err
+		}
+	}
 
 	target.Vars = map[string]string{}
+	target.ownVars = map[string]bool{}
+	for k, v := range target.inheritedVars {
+		target.Vars[k] = v
+	}
+	for k, v := range ownVars {
+		target.Vars[k] = v
+		target.ownVars[k] = true
+	}
 
-	settings := v.AllSettings()
-	for k, v := range settings {
-		target.Vars[k] = v.(string)
+	// Inherited syscfg values apply to the build as though the target had
+	// set them itself.
+	target.ownSyscfg = map[string]bool{}
+	for k, _ := range ownSyscfg {
+		target.ownSyscfg[k] = true
+	}
+	if len(target.inheritedSyscfg) > 0 {
+		target.setSyscfgVals(ownSyscfg)
 	}
 
 	target.BspName = target.Vars["target.bsp"]
@@ -91,6 +260,10 @@ func (target *Target) Load(basePkg *pkg.LocalPackage) error {
 		target.BuildProfile = DEFAULT_BUILD_PROFILE
 	}
 
+	target.StripDebug = cast.ToBool(target.Vars["target.strip_debug"])
+	target.KeepUnstripped = cast.ToBool(target.Vars["target.keep_unstripped"])
+	target.Uf2Family = target.Vars["target.uf2_family"]
+
 	// Note: App not required in the case of unit tests.
 
 	// Remember the name of the configuration file so that it can be specified
@@ -100,6 +273,166 @@ func (target *Target) Load(basePkg *pkg.LocalPackage) error {
 	return nil
 }
 
+// Replaces the package's syscfg values with the inherited ones overridden by
+// vals.
+func (target *Target) setSyscfgVals(vals map[string]string) {
+	merged := map[string]interface{}{}
+	for k, v := range target.inheritedSyscfg {
+		merged[k] = v
+	}
+	for k, v := range vals {
+		merged[k] = v
+	}
+
+	target.basePkg.SyscfgV = viper.New()
+	target.basePkg.SyscfgV.Set("syscfg.vals", merged)
+}
+
+// Assigns a value to one of the target's settings.
+func (t *Target) SetVar(key string, val string) {
+	t.Vars[key] = val
+	t.ownVars[key] = true
+}
+
+// Removes one of the target's settings.  An inherited setting reverts to the
+// parent's value.
+func (t *Target) UnsetVar(key string) {
+	delete(t.Vars, key)
+	delete(t.ownVars, key)
+}
+
+// Replaces the syscfg values the target sets.  Inherited values remain in
+// effect unless vals overrides them.
+func (t *Target) SetSyscfgVals(vals map[string]string) {
+	t.ownSyscfg = map[string]bool{}
+	for k, _ := range vals {
+		t.ownSyscfg[k] = true
+	}
+	t.setSyscfgVals(vals)
+}
+
+// Determines whether Save writes a setting.  Inherited settings are left to
+// the parent target unless this target sets them itself or overrides them.
+func savedSetting(key string, val string, inherited map[string]string,
+	own map[string]bool) bool {
+
+	iv, ok := inherited[key]
+	return own[key] || !ok || iv != val
+}
+
+// Parses the target's API provider preferences (target.api_prefs).  The
+// setting is a whitespace-separated list of <api>=<package> pairs; the named
+// package provides the API when multiple packages in the build do.
+func (target *Target) ApiPrefs() (map[string]string, error) {
+	prefs := map[string]string{}
+
+	for _, field := range strings.Fields(target.Vars["target.api_prefs"]) {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, util.FmtNewtError(
+				"Invalid target.api_prefs entry \"%s\"; "+
+					"must have the form <api>=<package>", field)
+		}
+
+		prefs[parts[0]] = parts[1]
+	}
+
+	return prefs, nil
+}
+
+// Parses the environment variables the target sets for its compile and link
+// subprocesses (target.build_env).  The setting is a whitespace-separated
+// list of <name>=<value> pairs; ${VAR} references in a value are expanded
+// from newt's own environment.  The result contains one NAME=VALUE string
+// per variable, ordered as in the setting.
+func (target *Target) BuildEnv() ([]string, error) {
+	env := []string{}
+
+	for _, field := range strings.Fields(target.Vars["target.build_env"]) {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 || !envNameRe.MatchString(parts[0]) {
+			return nil, util.FmtNewtError(
+				"Invalid target.build_env entry \"%s\"; "+
+					"must have the form <name>=<value>", field)
+		}
+
+		env = append(env, parts[0]+"="+os.ExpandEnv(parts[1]))
+	}
+
+	return env, nil
+}
+
+// Returns the features the target depends on (target.required_features, a
+// whitespace-separated list).  The build fails if the resolved configuration
+// does not enable all of them.
+func (target *Target) RequiredFeatures() []string {
+	return strings.Fields(target.Vars["target.required_features"])
+}
+
+// Returns the strings that must not appear in the target's generated files
+// (target.forbidden_markers, a whitespace-separated list).  Template
+// placeholders such as TODO or FIXME are typical entries.
+func (target *Target) ForbiddenMarkers() []string {
+	return strings.Fields(target.Vars["target.forbidden_markers"])
+}
+
+// Returns the image header magic the target's boot loader expects
+// (target.image_magic), or an empty string if the target does not override
+// the project's setting.
+func (target *Target) ImageMagic() string {
+	return target.Vars["target.image_magic"]
+}
+
+// Returns the names of packages excluded from the target's build
+// (target.exclude_pkgs, a whitespace-separated list).
+func (target *Target) ExcludedPkgs() []string {
+	return strings.Fields(target.Vars["target.exclude_pkgs"])
+}
+
+// Returns the maximum permitted size, in bytes, of each of the target's
+// image files (target.max_image_size), or 0 if there is no limit.  The limit
+// is a policy ceiling independent of the flash map's slot size.
+func (target *Target) MaxImageSize() (int, error) {
+	str := strings.TrimSpace(target.Vars["target.max_image_size"])
+	if str == "" {
+		return 0, nil
+	}
+
+	size, err := util.AtoiNoOct(str)
+	if err != nil || size <= 0 {
+		return 0, util.FmtNewtError(
+			"Invalid target.max_image_size \"%s\"; must be a positive "+
+				"integer", str)
+	}
+
+	return size, nil
+}
+
+// Returns the newest manufacturing meta version the target's boot loader
+// understands (target.meta_version), or 0 if the target does not restrict it.
+func (target *Target) MetaVersion() (int, error) {
+	str := strings.TrimSpace(target.Vars["target.meta_version"])
+	if str == "" {
+		return 0, nil
+	}
+
+	version, err := util.AtoiNoOct(str)
+	if err != nil || version <= 0 {
+		return 0, util.FmtNewtError(
+			"Invalid target.meta_version \"%s\"; must be a positive "+
+				"integer", str)
+	}
+
+	return version, nil
+}
+
+// Returns the TLV ordering rules the target's boot loader imposes on the
+// manufacturing meta region (target.meta_tlv_order, a whitespace-separated
+// list).
+func (target *Target) MetaTlvOrder() []string {
+	return strings.Fields(target.Vars["target.meta_tlv_order"])
+}
+
 func (target *Target) Validate(appRequired bool) error {
 	if target.BspName == "" {
 		return util.NewNewtError("Target does not specify a BSP package " +
@@ -180,6 +513,103 @@ func (target *Target) Clone(newRepo *repo.Repo, newName string) *Target {
 	return &newTarget
 }
 
+// Renames the target, moving its directory (and any user files in it) to the
+// location of the new name.  Other targets that inherit from this one are
+// updated to refer to the new name.  If any of the affected targets cannot be
+// saved, the rename is undone.
+func (target *Target) Rename(newRepo *repo.Repo, newName string) (
+	*Target, error) {
+
+	dst := target.Clone(newRepo, newName)
+
+	lookup := func(from *Target, name string) *pkg.LocalPackage {
+		return from.resolvePackageName(name)
+	}
+	if err := target.renameTo(dst, lookup); err != nil {
+		delete(GetTargets(), dst.FullName())
+		return nil, err
+	}
+
+	delete(GetTargets(), target.FullName())
+	return dst, nil
+}
+
+// Moves the target to the location of dst, a clone carrying the new name, and
+// points the target's children at dst.  lookup resolves a target.inherits
+// value relative to the target that specifies it.
+func (target *Target) renameTo(dst *Target,
+	lookup func(from *Target, name string) *pkg.LocalPackage) error {
+
+	children := []*Target{}
+	for _, name := range sortedTargetNames(GetTargets()) {
+		other := GetTargets()[name]
+		if other == target || other == dst ||
+			!other.ownVars[TARGET_INHERITS_KEY] {
+
+			continue
+		}
+		if lookup(other, other.Vars[TARGET_INHERITS_KEY]) == target.basePkg {
+			children = append(children, other)
+		}
+	}
+
+	srcPath := target.basePkg.BasePath()
+	dstPath := dst.basePkg.BasePath()
+	if util.NodeExist(dstPath) {
+		return util.FmtNewtError(
+			"Cannot rename target %s to %s; %s already exists",
+			target.FullName(), dst.FullName(), dstPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return util.ChildNewtError(err)
+	}
+	if err := os.Rename(srcPath, dstPath); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	// Restores the original target and the first n children.
+	undo := func(n int, cause error) error {
+		for _, child := range children[:n] {
+			child.SetVar(TARGET_INHERITS_KEY, target.FullName())
+			child.Save()
+		}
+
+		if err := os.Rename(dstPath, srcPath); err != nil {
+			return util.FmtNewtError(
+				"Failed to rename target %s: %s; failed to restore %s: %s",
+				target.FullName(), cause.Error(), srcPath, err.Error())
+		}
+		target.Save()
+
+		return util.FmtNewtError("Failed to rename target %s: %s",
+			target.FullName(), cause.Error())
+	}
+
+	// Rewrite the package and target files so they reflect the new name.
+	if err := dst.Save(); err != nil {
+		return undo(0, err)
+	}
+
+	for i, child := range children {
+		child.SetVar(TARGET_INHERITS_KEY, dst.FullName())
+		if err := child.Save(); err != nil {
+			return undo(i+1, err)
+		}
+	}
+
+	return nil
+}
+
+func sortedTargetNames(targets map[string]*Target) []string {
+	names := make([]string, 0, len(targets))
+	for name, _ := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
 func (target *Target) resolvePackageName(name string) *pkg.LocalPackage {
 	dep, err := pkg.NewDependency(target.basePkg.Repo(), name)
 	if err != nil {
@@ -241,8 +671,10 @@ func (t *Target) Save() error {
 	file.WriteString("### Target: " + t.Name() + "\n")
 
 	keys := []string{}
-	for k, _ := range t.Vars {
-		keys = append(keys, k)
+	for k, v := range t.Vars {
+		if savedSetting(k, v, t.inheritedVars, t.ownVars) {
+			keys = append(keys, k)
+		}
 	}
 	sort.Strings(keys)
 
@@ -250,7 +682,14 @@ func (t *Target) Save() error {
 		file.WriteString(k + ": " + yaml.EscapeString(t.Vars[k]) + "\n")
 	}
 
-	if err := t.basePkg.SaveSyscfgVals(); err != nil {
+	syscfgVals := map[string]string{}
+	allVals := t.basePkg.SyscfgV.GetStringMapString("syscfg.vals")
+	for k, v := range allVals {
+		if savedSetting(k, v, t.inheritedSyscfg, t.ownSyscfg) {
+			syscfgVals[k] = v
+		}
+	}
+	if err := t.basePkg.WriteSyscfgVals(syscfgVals); err != nil {
 		return err
 	}
 
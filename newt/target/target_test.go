@@ -0,0 +1,527 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package target
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/util"
+)
+
+// Describes a target package written to disk for a test.
+type testTargetSpec struct {
+	name   string
+	vars   map[string]string
+	syscfg map[string]string
+}
+
+func writeTestTarget(t *testing.T, dir string, spec testTargetSpec) {
+	path := filepath.Join(dir, spec.name)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	pkgYml := fmt.Sprintf("pkg.name: %s\npkg.type: target\n", spec.name)
+	if err := ioutil.WriteFile(filepath.Join(path, "pkg.yml"),
+		[]byte(pkgYml), 0644); err != nil {
+
+		t.Fatal(err)
+	}
+
+	targetYml := ""
+	for k, v := range spec.vars {
+		targetYml += k + ": " + v + "\n"
+	}
+	if err := ioutil.WriteFile(filepath.Join(path, TARGET_FILENAME),
+		[]byte(targetYml), 0644); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if len(spec.syscfg) > 0 {
+		syscfgYml := "syscfg.vals:\n"
+		for k, v := range spec.syscfg {
+			syscfgYml += "    " + k + ": " + v + "\n"
+		}
+		if err := ioutil.WriteFile(
+			filepath.Join(path, pkg.SYSCFG_YAML_FILENAME),
+			[]byte(syscfgYml), 0644); err != nil {
+
+			t.Fatal(err)
+		}
+	}
+}
+
+// Writes the specified targets to a temporary directory and loads them.  The
+// targets resolve target.inherits among themselves.
+func loadTestTargets(t *testing.T, specs []testTargetSpec) (
+	map[string]*Target, map[string]error, string) {
+
+	dir, err := ioutil.TempDir("", "newt-target")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &repo.Repo{}
+	lpkgs := map[string]*pkg.LocalPackage{}
+	for _, spec := range specs {
+		writeTestTarget(t, dir, spec)
+
+		lpkg, err := pkg.LoadLocalPackage(r, filepath.Join(dir, spec.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lpkgs[spec.name] = lpkg
+	}
+
+	lookup := func(name string) *pkg.LocalPackage {
+		return lpkgs[name]
+	}
+
+	targets := map[string]*Target{}
+	errs := map[string]error{}
+	for _, spec := range specs {
+		target := NewTarget(lpkgs[spec.name])
+		if err := target.load(lpkgs[spec.name], lookup); err != nil {
+			errs[spec.name] = err
+		} else {
+			targets[spec.name] = target
+		}
+	}
+
+	return targets, errs, dir
+}
+
+func testTargetSyscfg(target *Target) map[string]string {
+	return target.Package().SyscfgV.GetStringMapString("syscfg.vals")
+}
+
+// Sorted "key=value" strings, for comparing maps in failure messages.
+func kvStrings(m map[string]string) []string {
+	strs := []string{}
+	for k, v := range m {
+		strs = append(strs, k+"="+v)
+	}
+	sort.Strings(strs)
+	return strs
+}
+
+func TestTargetInherits(t *testing.T) {
+	specs := []testTargetSpec{
+		{
+			name: "base",
+			vars: map[string]string{
+				"target.bsp":           "hw/bsp/nordic_pca10056",
+				"target.app":           "apps/blinky",
+				"target.build_profile": "optimized",
+			},
+			syscfg: map[string]string{
+				"LOG_LEVEL":    "1",
+				"SHELL_TASK":   "1",
+				"CONSOLE_UART": "1",
+			},
+		},
+		{
+			name: "child_app",
+			vars: map[string]string{
+				"target.inherits": "base",
+				"target.app":      "apps/bleprph",
+			},
+			syscfg: map[string]string{
+				"LOG_LEVEL": "0",
+			},
+		},
+		{
+			name: "child_profile",
+			vars: map[string]string{
+				"target.inherits":      "base",
+				"target.build_profile": "debug",
+			},
+			syscfg: map[string]string{
+				"SHELL_TASK": "0",
+			},
+		},
+		{
+			name: "grandchild",
+			vars: map[string]string{
+				"target.inherits":      "child_app",
+				"target.build_profile": "debug",
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		app        string
+		profile    string
+		wantSyscfg map[string]string
+	}{
+		{
+			name:    "base",
+			app:     "apps/blinky",
+			profile: "optimized",
+			wantSyscfg: map[string]string{
+				"LOG_LEVEL": "1", "SHELL_TASK": "1", "CONSOLE_UART": "1",
+			},
+		},
+		{
+			name:    "child_app",
+			app:     "apps/bleprph",
+			profile: "optimized",
+			wantSyscfg: map[string]string{
+				"LOG_LEVEL": "0", "SHELL_TASK": "1", "CONSOLE_UART": "1",
+			},
+		},
+		{
+			name:    "child_profile",
+			app:     "apps/blinky",
+			profile: "debug",
+			wantSyscfg: map[string]string{
+				"LOG_LEVEL": "1", "SHELL_TASK": "0", "CONSOLE_UART": "1",
+			},
+		},
+		{
+			name:    "grandchild",
+			app:     "apps/bleprph",
+			profile: "debug",
+			wantSyscfg: map[string]string{
+				"LOG_LEVEL": "0", "SHELL_TASK": "1", "CONSOLE_UART": "1",
+			},
+		},
+	}
+
+	targets, errs, dir := loadTestTargets(t, specs)
+	defer os.RemoveAll(dir)
+
+	for _, test := range tests {
+		target := targets[test.name]
+		if target == nil {
+			t.Errorf("%s: load failed: %v", test.name, errs[test.name])
+			continue
+		}
+
+		if target.BspName != "hw/bsp/nordic_pca10056" {
+			t.Errorf("%s: bsp=%s; want hw/bsp/nordic_pca10056",
+				test.name, target.BspName)
+		}
+		if target.AppName != test.app {
+			t.Errorf("%s: app=%s; want %s", test.name, target.AppName,
+				test.app)
+		}
+		if target.BuildProfile != test.profile {
+			t.Errorf("%s: build profile=%s; want %s",
+				test.name, target.BuildProfile, test.profile)
+		}
+
+		got := kvStrings(testTargetSyscfg(target))
+		want := kvStrings(test.wantSyscfg)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: syscfg=%v; want %v", test.name, got, want)
+		}
+	}
+}
+
+func TestTargetInheritsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []testTargetSpec
+		target  string
+		wantErr string
+	}{
+		{
+			name: "cycle",
+			specs: []testTargetSpec{
+				{name: "a", vars: map[string]string{"target.inherits": "b"}},
+				{name: "b", vars: map[string]string{"target.inherits": "c"}},
+				{name: "c", vars: map[string]string{"target.inherits": "a"}},
+			},
+			target:  "a",
+			wantErr: "inheritance cycle: a -> b -> c -> a",
+		},
+		{
+			name: "unknown parent",
+			specs: []testTargetSpec{
+				{name: "a", vars: map[string]string{
+					"target.inherits": "missing"}},
+			},
+			target:  "a",
+			wantErr: "unknown target \"missing\"",
+		},
+	}
+
+	for _, test := range tests {
+		_, errs, dir := loadTestTargets(t, test.specs)
+		os.RemoveAll(dir)
+
+		err := errs[test.target]
+		if err == nil {
+			t.Errorf("%s: expected error", test.name)
+		} else if !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: error=\"%s\"; want \"%s\"",
+				test.name, err.Error(), test.wantErr)
+		}
+	}
+}
+
+func TestTargetSaveInherited(t *testing.T) {
+	specs := []testTargetSpec{
+		{
+			name: "base",
+			vars: map[string]string{
+				"target.bsp": "hw/bsp/native",
+				"target.app": "apps/blinky",
+			},
+			syscfg: map[string]string{
+				"LOG_LEVEL":  "1",
+				"SHELL_TASK": "1",
+			},
+		},
+		{
+			// Sets the app and LOG_LEVEL to the values it would inherit
+			// anyway.
+			name: "child",
+			vars: map[string]string{
+				"target.inherits": "base",
+				"target.app":      "apps/blinky",
+			},
+			syscfg: map[string]string{
+				"LOG_LEVEL": "1",
+			},
+		},
+	}
+
+	targets, errs, dir := loadTestTargets(t, specs)
+	defer os.RemoveAll(dir)
+
+	child := targets["child"]
+	if child == nil {
+		t.Fatalf("load failed: %v", errs["child"])
+	}
+
+	// Set a value that matches the inherited one, and one that doesn't.
+	child.SetVar("target.bsp", "hw/bsp/native")
+	child.SetVar("target.build_profile", "debug")
+	if err := child.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := readTargetVars(child.Package())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"target.app=apps/blinky",
+		"target.bsp=hw/bsp/native",
+		"target.build_profile=debug",
+		"target.inherits=base",
+	}
+	if got := kvStrings(reloaded); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("saved vars=%v; want %v", got, want)
+	}
+
+	syscfg, err := readTargetSyscfg(child.Package())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := kvStrings(syscfg); fmt.Sprint(got) != "[LOG_LEVEL=1]" {
+		t.Errorf("saved syscfg=%v; want [LOG_LEVEL=1]", got)
+	}
+
+	// Unset settings are not written, even if inherited.
+	child.UnsetVar("target.app")
+	child.SetSyscfgVals(map[string]string{})
+	if err := child.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err = readTargetVars(child.Package())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded["target.app"]; ok {
+		t.Errorf("unset target.app still saved")
+	}
+	syscfg, err = readTargetSyscfg(child.Package())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(syscfg) != 0 {
+		t.Errorf("saved syscfg=%v; want none", kvStrings(syscfg))
+	}
+	if got := testTargetSyscfg(child)["SHELL_TASK"]; got != "1" {
+		t.Errorf("inherited SHELL_TASK=%s after save; want 1", got)
+	}
+}
+
+// Creates a clone of the specified target that carries a new name, as
+// Target.Clone does for a target in a project.
+func testRenameClone(src *Target, dir string, newName string) *Target {
+	dstPkg := *src.Package()
+	dstPkg.SetName(newName)
+	dstPkg.SetBasePath(filepath.Join(dir, newName))
+
+	dst := *src
+	dst.basePkg = &dstPkg
+	globalTargetMap[newName] = &dst
+
+	return &dst
+}
+
+func testRenameLookup(from *Target, name string) *pkg.LocalPackage {
+	if t := globalTargetMap[name]; t != nil {
+		return t.Package()
+	}
+	return nil
+}
+
+func TestTargetRename(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// Prepares the target directory; returns the expected error text.
+		setup   func(dir string) string
+		wantErr string
+	}{
+		{
+			name:  "renamed",
+			setup: func(dir string) string { return "" },
+		},
+		{
+			name: "destination exists",
+			setup: func(dir string) string {
+				os.MkdirAll(filepath.Join(dir, "renamed"), 0755)
+				return "already exists"
+			},
+		},
+		{
+			// The renamed target's pkg.yml cannot be rewritten.
+			name: "save fails",
+			setup: func(dir string) string {
+				pkgYml := filepath.Join(dir, "base", "pkg.yml")
+				os.Remove(pkgYml)
+				os.Mkdir(pkgYml, 0755)
+				return "Failed to rename target base"
+			},
+		},
+	}
+
+	for _, test := range tests {
+		specs := []testTargetSpec{
+			{
+				name: "base",
+				vars: map[string]string{
+					"target.bsp":           "hw/bsp/native",
+					"target.app":           "apps/blinky",
+					"target.build_profile": "debug",
+				},
+				syscfg: map[string]string{"LOG_LEVEL": "2"},
+			},
+			{
+				name: "child",
+				vars: map[string]string{
+					"target.inherits": "base",
+					"target.app":      "apps/slinky",
+				},
+			},
+		}
+
+		targets, errs, dir := loadTestTargets(t, specs)
+		if len(errs) > 0 {
+			t.Fatalf("%s: load failed: %v", test.name, errs)
+		}
+		globalTargetMap = targets
+
+		wantErr := test.setup(dir)
+		src := targets["base"]
+		dst := testRenameClone(src, dir, "renamed")
+		err := src.renameTo(dst, testRenameLookup)
+
+		srcExists := util.NodeExist(filepath.Join(dir, "base"))
+		inherits, _ := readTargetVars(targets["child"].Package())
+
+		if wantErr != "" {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			} else if !strings.Contains(err.Error(), wantErr) {
+				t.Errorf("%s: error=\"%s\"; want \"%s\"",
+					test.name, err.Error(), wantErr)
+			}
+			if !srcExists {
+				t.Errorf("%s: original target directory missing", test.name)
+			}
+			if got := inherits[TARGET_INHERITS_KEY]; got != "base" {
+				t.Errorf("%s: child inherits %s; want base", test.name, got)
+			}
+		} else {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			if srcExists {
+				t.Errorf("%s: original target directory remains", test.name)
+			}
+			if got := inherits[TARGET_INHERITS_KEY]; got != "renamed" {
+				t.Errorf("%s: child inherits %s; want renamed",
+					test.name, got)
+			}
+
+			// The renamed target keeps its settings.
+			lpkg, err := pkg.LoadLocalPackage(&repo.Repo{},
+				filepath.Join(dir, "renamed"))
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			if lpkg.Name() != "renamed" {
+				t.Errorf("%s: package name=%s; want renamed",
+					test.name, lpkg.Name())
+			}
+
+			renamed := NewTarget(lpkg)
+			if err := renamed.load(lpkg, func(name string) *pkg.LocalPackage {
+				return nil
+			}); err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			want := kvStrings(map[string]string{
+				"target.bsp":           "hw/bsp/native",
+				"target.app":           "apps/blinky",
+				"target.build_profile": "debug",
+			})
+			if got := kvStrings(renamed.Vars); fmt.Sprint(got) !=
+				fmt.Sprint(want) {
+
+				t.Errorf("%s: vars=%v; want %v", test.name, got, want)
+			}
+			if got := testTargetSyscfg(renamed)["LOG_LEVEL"]; got != "2" {
+				t.Errorf("%s: LOG_LEVEL=%s; want 2", test.name, got)
+			}
+		}
+
+		ResetTargets()
+		os.RemoveAll(dir)
+	}
+}
@@ -41,6 +41,15 @@ import (
 
 const COMPILER_FILENAME string = "compiler.yml"
 
+// A build profile that instruments host builds for gcov-style coverage
+// analysis.  It extends the debug profile; a compiler package may specify
+// additional flags for it under compiler.flags.coverage.
+const COVERAGE_BUILD_PROFILE string = "coverage"
+const COVERAGE_BASE_PROFILE string = "debug"
+
+var CoverageCflags = []string{"-fprofile-arcs", "-ftest-coverage"}
+var CoverageLflags = []string{"--coverage"}
+
 const (
 	COMPILER_TYPE_C       = 0
 	COMPILER_TYPE_ASM     = 1
@@ -55,12 +64,29 @@ type CompilerInfo struct {
 	Aflags      []string
 	IgnoreFiles []*regexp.Regexp
 	IgnoreDirs  []*regexp.Regexp
+
+	// Absolute paths of individual source files to skip.
+	IgnorePaths []string
 }
 
 type Compiler struct {
 	ObjPathList   map[string]bool
 	LinkerScripts []string
 
+	// If true, debug sections are stripped from linked elf files.  If
+	// KeepUnstripped is also true, the unstripped elf is retained as
+	// <elf>.debug.
+	StripDebug     bool
+	KeepUnstripped bool
+
+	// If true, a warning is printed for each header a C or C++ source file
+	// includes without appearing to use.
+	DetectUnusedIncludes bool
+
+	// Additional environment variables, each of the form NAME=VALUE, set
+	// for the compile and link subprocesses.
+	Env []string
+
 	depTracker            DepTracker
 	ccPath                string
 	cppPath               string
@@ -97,6 +123,7 @@ func NewCompilerInfo() *CompilerInfo {
 	ci.Aflags = []string{}
 	ci.IgnoreFiles = []*regexp.Regexp{}
 	ci.IgnoreDirs = []*regexp.Regexp{}
+	ci.IgnorePaths = []string{}
 
 	return ci
 }
@@ -167,6 +194,7 @@ func (ci *CompilerInfo) AddCompilerInfo(newCi *CompilerInfo) {
 	ci.Aflags = addFlags("aflag", ci.Aflags, newCi.Aflags)
 	ci.IgnoreFiles = append(ci.IgnoreFiles, newCi.IgnoreFiles...)
 	ci.IgnoreDirs = append(ci.IgnoreDirs, newCi.IgnoreDirs...)
+	ci.IgnorePaths = append(ci.IgnorePaths, newCi.IgnorePaths...)
 }
 
 func NewCompiler(compilerDir string, dstDir string,
@@ -220,6 +248,9 @@ func (c *Compiler) load(compilerDir string, buildProfile string) error {
 		buildProfile:                  true,
 		strings.ToUpper(runtime.GOOS): true,
 	}
+	if buildProfile == COVERAGE_BUILD_PROFILE {
+		features[COVERAGE_BASE_PROFILE] = true
+	}
 
 	c.ccPath = newtutil.GetStringFeatures(v, features, "compiler.path.cc")
 	c.cppPath = newtutil.GetStringFeatures(v, features, "compiler.path.cpp")
@@ -258,6 +289,11 @@ func (c *Compiler) load(compilerDir string, buildProfile string) error {
 			buildProfile, runtime.GOOS)
 	}
 
+	if buildProfile == COVERAGE_BUILD_PROFILE {
+		c.lclInfo.Cflags = append(c.lclInfo.Cflags, CoverageCflags...)
+		c.lclInfo.Lflags = append(c.lclInfo.Lflags, CoverageLflags...)
+	}
+
 	return nil
 }
 
@@ -306,6 +342,65 @@ func (c *Compiler) includesString() string {
 	return "-I" + strings.Join(includes, " -I")
 }
 
+// Returns the include directories passed to the compiler, in command line
+// order: directories specified with -I among the C flags come first, followed
+// by the include paths.  Duplicates are omitted.
+func (c *Compiler) IncludePaths() []string {
+	paths := []string{}
+	for _, flag := range util.SortFields(c.info.Cflags...) {
+		if strings.HasPrefix(flag, "-I") {
+			paths = append(paths, strings.TrimPrefix(flag, "-I"))
+		}
+	}
+	paths = append(paths, util.SortFields(c.info.Includes...)...)
+
+	return util.UniqueStrings(paths)
+}
+
+// Returns a description of everything that affects the compiler's output
+// other than the source files themselves: the C, assembler, and linker flags,
+// the include path, and the linker scripts.  Used when fingerprinting a build.
+func (c *Compiler) FlagSummary() []string {
+	c.ensureLclInfoAdded()
+
+	return []string{
+		"cflags " + c.cflagsString(),
+		"aflags " + strings.Join(util.SortFields(c.info.Aflags...), " "),
+		"lflags " + c.lflagsString(),
+		"includes " + c.includesString(),
+		"linker_scripts " + strings.Join(c.LinkerScripts, " "),
+	}
+}
+
+// Returns the first line of the C compiler's "--version" output, or an empty
+// string if the compiler cannot be executed.
+func (c *Compiler) Version() string {
+	o, err := c.shellCommand(c.ccPath + " --version")
+	if err != nil {
+		return ""
+	}
+
+	return strings.SplitN(strings.TrimSpace(string(o)), "\n", 2)[0]
+}
+
+// Returns the first line of the linker's version output, or an empty string
+// if the linker does not report one.  Linking is performed through the
+// compiler driver, so the linker is queried through it as well.
+func (c *Compiler) LinkerVersion() string {
+	o, err := c.shellCommand(c.ccPath + " -Wl,--version")
+	if err != nil {
+		return ""
+	}
+
+	return strings.SplitN(strings.TrimSpace(string(o)), "\n", 2)[0]
+}
+
+// Runs a toolchain command on the shell with the compiler's additional
+// environment variables.
+func (c *Compiler) shellCommand(cmdStr string) ([]byte, error) {
+	return util.ShellCommandEnv(cmdStr, c.Env)
+}
+
 func (c *Compiler) cflagsString() string {
 	cflags := util.SortFields(c.info.Cflags...)
 	return strings.Join(cflags, " ")
@@ -353,6 +448,47 @@ func (c *Compiler) CompileFileCmd(file string,
 	return cmd, nil
 }
 
+// Calculates the command-line invocation that checks the specified C or C++
+// file for errors without producing an object file.
+//
+// @param file                  The filename of the source file to check.
+// @param compilerType          COMPILER_TYPE_C or COMPILER_TYPE_CPP.
+//
+// @return                      (success) The command string.
+func (c *Compiler) CheckFileCmd(file string,
+	compilerType int) (string, error) {
+
+	var cmd string
+
+	switch compilerType {
+	case COMPILER_TYPE_C:
+		cmd = c.ccPath
+	case COMPILER_TYPE_CPP:
+		cmd = c.cppPath
+	default:
+		return "", util.NewNewtError("Unknown compiler type")
+	}
+
+	cmd += " -fsyntax-only " + file +
+		" " + c.cflagsString() + " " + c.includesString()
+
+	return cmd, nil
+}
+
+// Checks the specified C or C++ file for errors without producing an object
+// file.  On failure, the returned error contains the compiler's output.
+func (c *Compiler) CheckFile(file string, compilerType int) error {
+	c.ensureLclInfoAdded()
+
+	cmd, err := c.CheckFileCmd(file, compilerType)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.shellCommand(cmd)
+	return err
+}
+
 // Generates a dependency Makefile (.d) for the specified source C file.
 //
 // @param file                  The name of the source file.
@@ -370,7 +506,7 @@ func (c *Compiler) GenDepsForFile(file string) error {
 
 	cmd = c.ccPath + " " + c.cflagsString() + " " + c.includesString() +
 		" -MM -MG " + file + " > " + depFile
-	o, err := util.ShellCommand(cmd)
+	o, err := c.shellCommand(cmd)
 	if err != nil {
 		return util.NewNewtError(string(o))
 	}
@@ -448,7 +584,7 @@ func (c *Compiler) CompileFile(file string, compilerType int) error {
 		return util.NewNewtError("Unknown compiler type")
 	}
 
-	_, err = util.ShellCommand(cmd)
+	_, err = c.shellCommand(cmd)
 	if err != nil {
 		return err
 	}
@@ -471,6 +607,16 @@ func (c *Compiler) shouldIgnoreFile(file string) bool {
 		}
 	}
 
+	if len(c.info.IgnorePaths) > 0 {
+		if abs, err := filepath.Abs(file); err == nil {
+			for _, path := range c.info.IgnorePaths {
+				if abs == path {
+					return true
+				}
+			}
+		}
+	}
+
 	return false
 }
 
@@ -508,6 +654,12 @@ func (c *Compiler) CompileC() error {
 		if err != nil {
 			return err
 		}
+
+		if c.DetectUnusedIncludes {
+			if err := c.reportUnusedIncludes(file); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -551,6 +703,12 @@ func (c *Compiler) CompileCpp() error {
 		if err != nil {
 			return err
 		}
+
+		if c.DetectUnusedIncludes {
+			if err := c.reportUnusedIncludes(file); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -764,6 +922,19 @@ func (c *Compiler) CompileBinaryCmd(dstFile string, options map[string]bool,
 	return cmd
 }
 
+// Calculates the command-line invocation that CompileElf would use to link
+// the specified elf file.
+func (c *Compiler) LinkCmd(dstFile string, objFiles []string,
+	keepSymbols []string, elfLib string) string {
+
+	options := map[string]bool{"mapFile": c.ldMapFile,
+		"listFile": true, "binFile": c.ldBinFile}
+
+	c.ensureLclInfoAdded()
+
+	return c.CompileBinaryCmd(dstFile, options, objFiles, keepSymbols, elfLib)
+}
+
 // Links the specified elf file.
 //
 // @param dstFile               The filename of the destination elf file to
@@ -789,12 +960,20 @@ func (c *Compiler) CompileBinary(dstFile string, options map[string]bool,
 	}
 
 	cmd := c.CompileBinaryCmd(dstFile, options, objFiles, keepSymbols, elfLib)
-	_, err := util.ShellCommand(cmd)
+	_, err := c.shellCommand(cmd)
 	if err != nil {
 		return err
 	}
 
-	err = writeCommandFile(dstFile, cmd)
+	if c.StripDebug {
+		if err := c.stripDebug(dstFile); err != nil {
+			return err
+		}
+	}
+
+	// The command file is written last; a failed strip must not leave an
+	// unstripped elf that appears up to date.
+	err = writeCommandFile(dstFile, c.linkCmdRecord(dstFile, cmd))
 	if err != nil {
 		return err
 	}
@@ -802,6 +981,22 @@ func (c *Compiler) CompileBinary(dstFile string, options map[string]bool,
 	return nil
 }
 
+// Produces the text recorded in a linked elf's command file: the link command
+// followed by the strip step, if any.  Changing the strip settings of an
+// up-to-date build changes the recorded text, so the elf is relinked.
+func (c *Compiler) linkCmdRecord(dstFile string, linkCmd string) string {
+	if !c.StripDebug {
+		return linkCmd
+	}
+
+	rec := linkCmd + "\n" + c.stripCmd(dstFile)
+	if c.KeepUnstripped {
+		rec += "\nunstripped copy: " + dstFile + ".debug"
+	}
+
+	return rec
+}
+
 // Generates the following build artifacts:
 //    * lst file
 //    * map file
@@ -820,7 +1015,7 @@ func (c *Compiler) generateExtras(elfFilename string,
 		binFile := elfFilename + ".bin"
 		cmd = c.ocPath + " -R .bss -R .bss.core -R .bss.core.nz -O binary " +
 			elfFilename + " " + binFile
-		_, err := util.ShellCommand(cmd)
+		_, err := c.shellCommand(cmd)
 		if err != nil {
 			return err
 		}
@@ -836,7 +1031,7 @@ func (c *Compiler) generateExtras(elfFilename string,
 		}
 
 		cmd = c.odPath + " -wxdS " + elfFilename + " >> " + listFile
-		_, err := util.ShellCommand(cmd)
+		_, err := c.shellCommand(cmd)
 		if err != nil {
 			// XXX: gobjdump appears to always crash.  Until we get that sorted
 			// out, don't fail the link process if lst generation fails.
@@ -847,11 +1042,11 @@ func (c *Compiler) generateExtras(elfFilename string,
 		for _, sect := range sects {
 			cmd = c.odPath + " -s -j " + sect + " " + elfFilename + " >> " +
 				listFile
-			util.ShellCommand(cmd)
+			c.shellCommand(cmd)
 		}
 
 		cmd = c.osPath + " " + elfFilename + " >> " + listFile
-		_, err = util.ShellCommand(cmd)
+		_, err = c.shellCommand(cmd)
 		if err != nil {
 			return err
 		}
@@ -860,9 +1055,58 @@ func (c *Compiler) generateExtras(elfFilename string,
 	return nil
 }
 
+// Removes the debug sections from the specified elf file.  This happens
+// before the bin file is generated, so the image is built from the stripped
+// elf.
+func (c *Compiler) stripDebug(elfFilename string) error {
+	debugFilename := elfFilename + ".debug"
+	if c.KeepUnstripped {
+		if err := util.CopyFile(elfFilename, debugFilename); err != nil {
+			return err
+		}
+	} else if err := os.RemoveAll(debugFilename); err != nil {
+		// A copy left by an earlier build no longer matches the image.
+		return util.ChildNewtError(err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE,
+		"Stripping debug info from %s\n", elfFilename)
+
+	if _, err := c.shellCommand(c.stripCmd(elfFilename)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Produces the command that removes the debug sections from an elf file.
+func (c *Compiler) stripCmd(elfFilename string) string {
+	return c.ocPath + " --strip-debug " + elfFilename
+}
+
+// Determines the architecture of an object file or archive, as reported by
+// objdump (e.g., "arm").  For an archive, the architecture of the first member
+// is reported.
+func (c *Compiler) ObjArch(filename string) (string, error) {
+	out, err := c.shellCommand(c.odPath + " -f " + filename)
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "architecture: ") {
+			arch := strings.TrimPrefix(line, "architecture: ")
+			return strings.TrimSpace(strings.SplitN(arch, ",", 2)[0]), nil
+		}
+	}
+
+	return "", util.FmtNewtError(
+		"Could not determine architecture of %s", filename)
+}
+
 func (c *Compiler) PrintSize(elfFilename string) (string, error) {
 	cmd := c.osPath + " " + elfFilename
-	rsp, err := util.ShellCommand(cmd)
+	rsp, err := c.shellCommand(cmd)
 	if err != nil {
 		return "", err
 	}
@@ -1038,7 +1282,7 @@ func (c *Compiler) CompileArchive(archiveFile string) error {
 	}
 
 	cmd := c.CompileArchiveCmd(archiveFile, objFiles)
-	_, err = util.ShellCommand(cmd)
+	_, err = c.shellCommand(cmd)
 	if err != nil {
 		return err
 	}
@@ -1125,7 +1369,7 @@ func (c *Compiler) RenameSymbols(sm *symbol.SymbolMap, libraryFile string, ext s
 
 	cmd := c.RenameSymbolsCmd(sm, libraryFile, ext)
 
-	_, err := util.ShellCommand(cmd)
+	_, err := c.shellCommand(cmd)
 
 	return err
 }
@@ -1133,7 +1377,7 @@ func (c *Compiler) RenameSymbols(sm *symbol.SymbolMap, libraryFile string, ext s
 func (c *Compiler) ParseLibrary(libraryFile string) (error, []byte) {
 	cmd := c.ParseLibraryCmd(libraryFile)
 
-	out, err := util.ShellCommand(cmd)
+	out, err := c.shellCommand(cmd)
 	if err != nil {
 		return err, nil
 	}
@@ -1143,7 +1387,7 @@ func (c *Compiler) ParseLibrary(libraryFile string) (error, []byte) {
 func (c *Compiler) CopySymbols(infile string, outfile string, sm *symbol.SymbolMap) error {
 	cmd := c.CopySymbolsCmd(infile, outfile, sm)
 
-	_, err := util.ShellCommand(cmd)
+	_, err := c.shellCommand(cmd)
 	if err != nil {
 		return err
 	}
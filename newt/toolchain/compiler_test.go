@@ -0,0 +1,584 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package toolchain
+
+import (
+	"debug/elf"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompilerEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  []string
+		want string
+	}{
+		{"no env", nil, "[] --version"},
+		{"env", []string{"NEWT_TEST_ENV=abc"}, "[abc] --version"},
+		{
+			"last setting wins",
+			[]string{"NEWT_TEST_ENV=abc", "NEWT_TEST_ENV=def"},
+			"[def] --version",
+		},
+	}
+
+	os.Unsetenv("NEWT_TEST_ENV")
+	for _, test := range tests {
+		c := &Compiler{
+			ccPath: "echo [$NEWT_TEST_ENV]",
+			Env:    test.env,
+		}
+		if got := c.Version(); got != test.want {
+			t.Errorf("%s: Version() = %q; want %q", test.name, got,
+				test.want)
+		}
+	}
+}
+
+func TestToolVersions(t *testing.T) {
+	tests := []struct {
+		name       string
+		ccPath     string
+		wantCc     string
+		wantLinker string
+	}{
+		{
+			name:       "first line only",
+			ccPath:     "printf 'gcc 9.2.1\\nCopyright\\n'; true",
+			wantCc:     "gcc 9.2.1",
+			wantLinker: "gcc 9.2.1",
+		},
+		{
+			name:       "linker queried through driver",
+			ccPath:     "echo",
+			wantCc:     "--version",
+			wantLinker: "-Wl,--version",
+		},
+		{
+			name:   "tool fails",
+			ccPath: "false",
+		},
+	}
+
+	for _, test := range tests {
+		c := &Compiler{ccPath: test.ccPath}
+		if got := c.Version(); got != test.wantCc {
+			t.Errorf("%s: Version() = %q; want %q", test.name, got,
+				test.wantCc)
+		}
+		if got := c.LinkerVersion(); got != test.wantLinker {
+			t.Errorf("%s: LinkerVersion() = %q; want %q", test.name, got,
+				test.wantLinker)
+		}
+	}
+}
+
+func testCompilerDir(t *testing.T, yml string) string {
+	dir, err := ioutil.TempDir("", "newt-compiler-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, COMPILER_FILENAME)
+	if err := ioutil.WriteFile(path, []byte(yml), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestCoverageProfile(t *testing.T) {
+	dir := testCompilerDir(t, `
+compiler.path.cc: gcc
+compiler.flags.debug: [-O0]
+compiler.flags.coverage: [-DCOVERAGE]
+compiler.ld.flags.debug: [-g]
+`)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		profile string
+		cflags  []string
+		lflags  []string
+		absent  []string
+		wantErr bool
+	}{
+		{
+			profile: "debug",
+			cflags:  []string{"-O0"},
+			lflags:  []string{"-g"},
+			absent: append(append([]string{"-DCOVERAGE"},
+				CoverageCflags...), CoverageLflags...),
+		},
+		{
+			profile: COVERAGE_BUILD_PROFILE,
+			cflags:  append([]string{"-O0", "-DCOVERAGE"}, CoverageCflags...),
+			lflags:  append([]string{"-g"}, CoverageLflags...),
+		},
+		{
+			profile: "optimized",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		c, err := NewCompiler(dir, filepath.Join(dir, "bin"), test.profile)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.profile)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.profile, err.Error())
+			continue
+		}
+
+		has := func(flags []string, flag string) bool {
+			for _, f := range flags {
+				if f == flag {
+					return true
+				}
+			}
+			return false
+		}
+
+		for _, flag := range test.cflags {
+			if !has(c.lclInfo.Cflags, flag) {
+				t.Errorf("%s: cflags %v missing %s", test.profile,
+					c.lclInfo.Cflags, flag)
+			}
+		}
+		for _, flag := range test.lflags {
+			if !has(c.lclInfo.Lflags, flag) {
+				t.Errorf("%s: lflags %v missing %s", test.profile,
+					c.lclInfo.Lflags, flag)
+			}
+		}
+		for _, flag := range test.absent {
+			if has(c.lclInfo.Cflags, flag) || has(c.lclInfo.Lflags, flag) {
+				t.Errorf("%s: unexpected flag %s", test.profile, flag)
+			}
+		}
+	}
+}
+
+func TestCheckFile(t *testing.T) {
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("cc not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "newt-checkfile-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	incDir := filepath.Join(dir, "include")
+	if err := os.MkdirAll(incDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(incDir, "foo.h"),
+		[]byte("int foo(void);\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := filepath.Join(dir, "src.c")
+	err = ioutil.WriteFile(src,
+		[]byte("#include \"foo.h\"\nint bar(void) { return foo(); }\n"),
+		0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		includes []string
+		typ      int
+		wantErr  bool
+	}{
+		{"declared include", []string{incDir}, COMPILER_TYPE_C, false},
+		{"missing include", nil, COMPILER_TYPE_C, true},
+		{"assembly", []string{incDir}, COMPILER_TYPE_ASM, true},
+	}
+
+	for _, test := range tests {
+		c := &Compiler{
+			ccPath: "cc",
+			dstDir: dir,
+		}
+		c.AddInfo(&CompilerInfo{Includes: test.includes})
+
+		err := c.CheckFile(src, test.typ)
+		if test.wantErr && err == nil {
+			t.Errorf("%s: expected error", test.name)
+		} else if !test.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+		}
+	}
+
+	objs, err := filepath.Glob(filepath.Join(dir, "*.o"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 0 {
+		t.Errorf("CheckFile produced object files: %v", objs)
+	}
+}
+
+// Reports whether the specified elf file contains debug info.
+func testHasDebugInfo(t *testing.T, path string) bool {
+	f, err := elf.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	return f.Section(".debug_info") != nil
+}
+
+func TestStripDebug(t *testing.T) {
+	for _, tool := range []string{"cc", "objcopy"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skip(tool + " not installed")
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "newt-strip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src.c")
+	err = ioutil.WriteFile(src, []byte("int foo(int x) { return x + 1; }\n"),
+		0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, keep := range []bool{false, true} {
+		elfPath := filepath.Join(dir, "src.elf")
+		os.Remove(elfPath + ".debug")
+
+		cmd := exec.Command("cc", "-g", "-c", "-o", elfPath, src)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("cc: %s: %s", err.Error(), out)
+		}
+		if !testHasDebugInfo(t, elfPath) {
+			t.Fatalf("cc -g produced no debug info")
+		}
+		before, err := os.Stat(elfPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := &Compiler{
+			ocPath:         "objcopy",
+			StripDebug:     true,
+			KeepUnstripped: keep,
+		}
+		if err := c.stripDebug(elfPath); err != nil {
+			t.Fatalf("keep=%v: unexpected error: %s", keep, err.Error())
+		}
+
+		if testHasDebugInfo(t, elfPath) {
+			t.Errorf("keep=%v: elf retains debug info", keep)
+		}
+		after, err := os.Stat(elfPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after.Size() >= before.Size() {
+			t.Errorf("keep=%v: stripped elf is %d bytes; unstripped was %d",
+				keep, after.Size(), before.Size())
+		}
+
+		debug, err := os.Stat(elfPath + ".debug")
+		if !keep {
+			if err == nil {
+				t.Errorf("keep=%v: unstripped copy retained", keep)
+			}
+		} else if err != nil {
+			t.Errorf("keep=%v: unstripped copy missing", keep)
+		} else if !testHasDebugInfo(t, elfPath+".debug") {
+			t.Errorf("keep=%v: unstripped copy lacks debug info", keep)
+		} else if debug.Size() != before.Size() {
+			t.Errorf("keep=%v: unstripped copy is %d bytes; want %d",
+				keep, debug.Size(), before.Size())
+		}
+	}
+}
+
+// Changing the strip settings of an up-to-date elf requires a relink.
+func TestLinkRequiredStrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-strip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	elfPath := filepath.Join(dir, "app.elf")
+	if err := ioutil.WriteFile(elfPath, []byte("elf"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name  string
+		strip bool
+		keep  bool
+		want  bool
+	}{
+		{"initial link", false, false, true},
+		{"unchanged", false, false, false},
+		{"strip enabled", true, false, true},
+		{"unchanged stripped", true, false, false},
+		{"keep enabled", true, true, true},
+		{"strip disabled", false, true, true},
+	}
+
+	c := &Compiler{ccPath: "cc", ocPath: "objcopy"}
+	tracker := NewDepTracker(c)
+	options := map[string]bool{}
+
+	for _, step := range steps {
+		c.StripDebug = step.strip
+		c.KeepUnstripped = step.keep
+
+		got, err := tracker.LinkRequired(elfPath, options, nil, nil, "")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", step.name, err.Error())
+		}
+		if got != step.want {
+			t.Errorf("%s: link required=%v; want %v", step.name, got,
+				step.want)
+		}
+
+		// Record the link as CompileBinary would.
+		cmd := c.CompileBinaryCmd(elfPath, options, nil, nil, "")
+		if err := writeCommandFile(elfPath,
+			c.linkCmdRecord(elfPath, cmd)); err != nil {
+
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestObjArch(t *testing.T) {
+	// Each objdump "command" prints canned output and ignores its
+	// arguments.
+	objdump := func(output string) string {
+		return "printf '" + output + "'; true"
+	}
+
+	tests := []struct {
+		name    string
+		odPath  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "arm",
+			odPath: objdump("\\nfoo.o:     file format elf32-littlearm\\n" +
+				"architecture: arm, flags 0x00000011:\\n" +
+				"HAS_RELOC, HAS_SYMS\\n"),
+			want: "arm",
+		},
+		{
+			name: "x86-64 archive",
+			odPath: objdump("In archive libfoo.a:\\n\\n" +
+				"foo.o:     file format elf64-x86-64\\n" +
+				"architecture: i386:x86-64, flags 0x00000011:\\n"),
+			want: "i386:x86-64",
+		},
+		{
+			name:    "no architecture",
+			odPath:  objdump("foo.o:     file format unknown\\n"),
+			wantErr: true,
+		},
+		{
+			name:    "objdump fails",
+			odPath:  "false",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		c := &Compiler{odPath: test.odPath}
+		arch, err := c.ObjArch("foo.o")
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+		} else if arch != test.want {
+			t.Errorf("%s: ObjArch() = %q; want %q", test.name, arch,
+				test.want)
+		}
+	}
+}
+
+func TestIncludePaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		cflags   []string
+		includes []string
+		want     []string
+	}{
+		{"none", nil, nil, []string{}},
+		{
+			"cflags only",
+			[]string{"-O2", "-Iinc/b -Iinc/a", "-DFOO"},
+			nil,
+			[]string{"inc/a", "inc/b"},
+		},
+		{
+			"cflags before includes",
+			[]string{"-Izz"},
+			[]string{"pkg/include", "aa"},
+			[]string{"zz", "aa", "pkg/include"},
+		},
+		{
+			"duplicates omitted",
+			[]string{"-Ipkg/include"},
+			[]string{"pkg/include", "other", "other"},
+			[]string{"pkg/include", "other"},
+		},
+	}
+
+	for _, test := range tests {
+		c := &Compiler{}
+		c.AddInfo(&CompilerInfo{
+			Cflags:   test.cflags,
+			Includes: test.includes,
+		})
+
+		got := c.IncludePaths()
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: IncludePaths() = %v; want %v", test.name, got,
+				test.want)
+		}
+	}
+}
+
+// The flag summary does not depend on the order flags were added in.
+func TestFlagSummary(t *testing.T) {
+	summary := func(infos ...CompilerInfo) []string {
+		c := &Compiler{}
+		for i, _ := range infos {
+			c.AddInfo(&infos[i])
+		}
+		return c.FlagSummary()
+	}
+
+	a := CompilerInfo{Cflags: []string{"-O2"}, Lflags: []string{"-lm"}}
+	b := CompilerInfo{
+		Cflags:   []string{"-DFOO"},
+		Includes: []string{"inc"},
+		Aflags:   []string{"-x"},
+	}
+	c := CompilerInfo{Cflags: []string{"-DBAR"}}
+
+	if !reflect.DeepEqual(summary(a, b), summary(b, a)) {
+		t.Errorf("flag summary depends on order: %v vs. %v", summary(a, b),
+			summary(b, a))
+	}
+	if reflect.DeepEqual(summary(a, b), summary(a, c)) {
+		t.Errorf("flag summary ignores cflags: %v", summary(a, b))
+	}
+}
+
+func TestLinkCmd(t *testing.T) {
+	tests := []struct {
+		name     string
+		mapFile  bool
+		circular bool
+		elfLib   string
+		want     []string
+		absent   []string
+	}{
+		{
+			name: "plain",
+			want: []string{
+				"gcc -o bin/app.elf ",
+				" -O2",
+				" bin/a.a bin/b.a",
+				" -lm",
+				" -T bsp.ld",
+			},
+			absent: []string{"-Map=", "--start-group", "--just-symbols"},
+		},
+		{
+			name:    "map file",
+			mapFile: true,
+			want:    []string{" -Wl,-Map=bin/app.elf.map"},
+		},
+		{
+			name:     "circular deps",
+			circular: true,
+			want: []string{
+				" -Wl,--start-group bin/a.a bin/b.a -Wl,--end-group",
+			},
+		},
+		{
+			name:   "split image",
+			elfLib: "bin/loader.elf",
+			want:   []string{" -Wl,--just-symbols=bin/loader.elf"},
+		},
+	}
+
+	for _, test := range tests {
+		c := &Compiler{
+			ccPath:                "gcc",
+			ldMapFile:             test.mapFile,
+			ldResolveCircularDeps: test.circular,
+			LinkerScripts:         []string{"bsp.ld"},
+		}
+		c.lclInfo.Cflags = []string{"-O2"}
+		c.lclInfo.Lflags = []string{"-lm"}
+
+		cmd := c.LinkCmd("bin/app.elf", []string{"bin/b.a", "bin/a.a"}, nil,
+			test.elfLib)
+
+		for _, s := range test.want {
+			if !strings.Contains(cmd, s) {
+				t.Errorf("%s: link command \"%s\" lacks \"%s\"", test.name,
+					cmd, s)
+			}
+		}
+		for _, s := range test.absent {
+			if strings.Contains(cmd, s) {
+				t.Errorf("%s: link command \"%s\" contains \"%s\"",
+					test.name, cmd, s)
+			}
+		}
+	}
+}
@@ -325,10 +325,12 @@ func (tracker *DepTracker) LinkRequired(dstFile string,
 	options map[string]bool, objFiles []string,
 	keepSymbols []string, elfLib string) (bool, error) {
 
-	// If the elf file was previously built with a different set of options, a
-	// rebuild is required.
+	// If the elf file was previously built with a different set of options
+	// (including the strip settings), a rebuild is required.
 	cmd := tracker.compiler.CompileBinaryCmd(dstFile, options, objFiles, keepSymbols, elfLib)
-	if commandHasChanged(dstFile, cmd) {
+	if commandHasChanged(dstFile,
+		tracker.compiler.linkCmdRecord(dstFile, cmd)) {
+
 		util.StatusMessage(util.VERBOSITY_VERBOSE, "%s - link required; "+
 			"different command\n", dstFile)
 		return true, nil
@@ -0,0 +1,395 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package toolchain
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// An #include directive whose header appears to be unnecessary.
+type UnusedInclude struct {
+	SrcFile string
+	Line    int
+	Header  string // As written in the directive.
+	Path    string // Resolved from the dependency file.
+}
+
+type includeDirective struct {
+	line int
+	name string
+}
+
+var includeRe = regexp.MustCompile(`^\s*#\s*include\s*["<]([^">]+)[">]`)
+var includeDirRe = regexp.MustCompile(`^\s*#\s*include\b`)
+var defineRe = regexp.MustCompile(`^\s*#\s*define\s+([A-Za-z_][A-Za-z0-9_]*)`)
+var cTokenRe = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*|[^\sA-Za-z0-9_]`)
+
+var cKeywords = map[string]bool{
+	"auto": true, "break": true, "case": true, "char": true, "const": true,
+	"continue": true, "default": true, "do": true, "double": true,
+	"else": true, "enum": true, "extern": true, "float": true, "for": true,
+	"goto": true, "if": true, "inline": true, "int": true, "long": true,
+	"register": true, "restrict": true, "return": true, "short": true,
+	"signed": true, "sizeof": true, "static": true, "struct": true,
+	"switch": true, "typedef": true, "union": true, "unsigned": true,
+	"void": true, "volatile": true, "while": true,
+}
+
+// Replaces comments and string and character literals with spaces.  Newlines
+// are retained so that line numbers are unaffected.
+func stripCComments(src []byte) string {
+	out := make([]byte, 0, len(src))
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			if i < len(src) {
+				out = append(out, '\n')
+			}
+
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			i += 2
+			for i < len(src) && !(src[i] == '*' && i+1 < len(src) &&
+				src[i+1] == '/') {
+
+				if src[i] == '\n' {
+					out = append(out, '\n')
+				}
+				i++
+			}
+			i++
+			out = append(out, ' ')
+
+		case c == '"' || c == '\'':
+			for i++; i < len(src) && src[i] != c && src[i] != '\n'; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+			}
+			out = append(out, ' ')
+
+		default:
+			out = append(out, c)
+		}
+	}
+
+	return string(out)
+}
+
+// Splits C text into logical lines, joining those continued with a
+// backslash.
+func cLogicalLines(text string) []string {
+	return strings.Split(strings.Replace(text, "\\\n", " ", -1), "\n")
+}
+
+// Parses the #include directives in C text.  stripped is the text with
+// comments and literals removed; it identifies the directives that aren't
+// commented out.  The header names are read from the original text.
+func parseIncludes(text string, stripped string) []includeDirective {
+	lines := strings.Split(text, "\n")
+	includes := []includeDirective{}
+
+	for i, line := range strings.Split(stripped, "\n") {
+		if i >= len(lines) || !includeDirRe.MatchString(line) {
+			continue
+		}
+		if m := includeRe.FindStringSubmatch(lines[i]); m != nil {
+			includes = append(includes, includeDirective{
+				line: i + 1,
+				name: m[1],
+			})
+		}
+	}
+
+	return includes
+}
+
+// Collects the identifiers that a header declares: macros, functions,
+// variables, typedefs, struct / union / enum tags, and enumerators.  This is
+// a heuristic; the header is not actually parsed.
+func headerDecls(text string) map[string]bool {
+	decls := map[string]bool{}
+	code := []string{}
+
+	for _, line := range cLogicalLines(text) {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			if m := defineRe.FindStringSubmatch(line); m != nil {
+				decls[m[1]] = true
+			}
+		} else {
+			code = append(code, line)
+		}
+	}
+
+	toks := cTokenRe.FindAllString(strings.Join(code, "\n"), -1)
+	tok := func(i int) string {
+		if i < 0 || i >= len(toks) {
+			return ""
+		}
+		return toks[i]
+	}
+	isIdent := func(s string) bool {
+		return s != "" && !cKeywords[s] &&
+			(s[0] == '_' || (s[0] >= 'A' && s[0] <= 'Z') ||
+				(s[0] >= 'a' && s[0] <= 'z'))
+	}
+
+	// Braces that don't open a scope (extern "C" blocks) are transparent.
+	braceStack := []bool{}
+	depth := 0
+	parens := 0
+	enumDepth := -1
+	pendingEnum := false
+
+	for i, t := range toks {
+		switch t {
+		case "{":
+			transparent := tok(i-1) == "extern"
+			braceStack = append(braceStack, transparent)
+			if !transparent {
+				depth++
+				if pendingEnum {
+					enumDepth = depth
+					pendingEnum = false
+				}
+			}
+			continue
+
+		case "}":
+			if len(braceStack) > 0 {
+				if !braceStack[len(braceStack)-1] {
+					if depth == enumDepth {
+						enumDepth = -1
+					}
+					depth--
+				}
+				braceStack = braceStack[:len(braceStack)-1]
+			}
+			continue
+
+		case "(":
+			parens++
+			continue
+
+		case ")":
+			parens--
+			continue
+
+		case ";":
+			pendingEnum = false
+			continue
+
+		case "enum":
+			pendingEnum = true
+			continue
+		}
+
+		if !isIdent(t) {
+			continue
+		}
+
+		prev := tok(i - 1)
+		next := tok(i + 1)
+
+		switch {
+		case prev == "struct" || prev == "union" || prev == "enum":
+			decls[t] = true
+
+		case depth == enumDepth && (prev == "{" || prev == ","):
+			decls[t] = true
+
+		case depth == 0 && parens == 0 &&
+			(next == "(" || next == ";" || next == "[" || next == "=" ||
+				next == ","):
+			decls[t] = true
+
+		case depth == 0 && parens == 1 && prev == "*" && next == ")":
+			// Function pointer typedef or variable.
+			decls[t] = true
+		}
+	}
+
+	return decls
+}
+
+// Collects the identifiers used by C text, excluding those in #include
+// directives.
+func usedIdents(text string) map[string]bool {
+	idents := map[string]bool{}
+	for _, line := range cLogicalLines(text) {
+		if includeDirRe.MatchString(line) {
+			continue
+		}
+		for _, t := range cTokenRe.FindAllString(line, -1) {
+			idents[t] = true
+		}
+	}
+
+	return idents
+}
+
+// Finds the dependency file entry corresponding to an included header.
+func resolveInclude(name string, deps []string) string {
+	for _, dep := range deps {
+		dep = filepath.ToSlash(dep)
+		if dep == name || strings.HasSuffix(dep, "/"+name) {
+			return dep
+		}
+	}
+
+	return ""
+}
+
+type includeAnalyzer struct {
+	deps []string
+
+	// Cache of the identifiers declared by each header, including those
+	// declared by the headers it includes.
+	declMap map[string]map[string]bool
+}
+
+func (ia *includeAnalyzer) decls(path string) map[string]bool {
+	if decls, ok := ia.declMap[path]; ok {
+		return decls
+	}
+
+	// Guard against include cycles.
+	decls := map[string]bool{}
+	ia.declMap[path] = decls
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return decls
+	}
+	text := stripCComments(data)
+
+	for name, _ := range headerDecls(text) {
+		decls[name] = true
+	}
+
+	// A header is also used if the source relies on a header that it
+	// includes.
+	for _, inc := range parseIncludes(string(data), text) {
+		if incPath := resolveInclude(inc.name, ia.deps); incPath != "" {
+			for name, _ := range ia.decls(incPath) {
+				decls[name] = true
+			}
+		}
+	}
+
+	return decls
+}
+
+// Reports the headers that a source file includes but whose declarations it
+// doesn't appear to use.  deps is the list of the source file's
+// dependencies, as read from its dependency (.d) file; headers not listed
+// there (e.g., missing headers) are not reported.  The analysis is heuristic
+// and intended as advice only.
+func FindUnusedIncludes(srcFile string, deps []string) (
+	[]UnusedInclude, error) {
+
+	data, err := ioutil.ReadFile(srcFile)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+	text := stripCComments(data)
+	used := usedIdents(text)
+
+	ia := &includeAnalyzer{
+		deps:    deps,
+		declMap: map[string]map[string]bool{},
+	}
+
+	unused := []UnusedInclude{}
+	for _, inc := range parseIncludes(string(data), text) {
+		path := resolveInclude(inc.name, deps)
+		if path == "" || util.NodeNotExist(path) {
+			continue
+		}
+
+		decls := ia.decls(path)
+		if len(decls) == 0 {
+			// Nothing to judge by.
+			continue
+		}
+
+		isUsed := false
+		for name, _ := range decls {
+			if used[name] {
+				isUsed = true
+				break
+			}
+		}
+
+		if !isUsed {
+			unused = append(unused, UnusedInclude{
+				SrcFile: srcFile,
+				Line:    inc.line,
+				Header:  inc.name,
+				Path:    path,
+			})
+		}
+	}
+
+	return unused, nil
+}
+
+// Prints a warning for each apparently unused include in the specified
+// source file.  The file's dependency file must already have been generated.
+func (c *Compiler) reportUnusedIncludes(file string) error {
+	depFile := c.dstDir + "/" +
+		strings.TrimSuffix(file, filepath.Ext(file)) + ".d"
+	if util.NodeNotExist(depFile) {
+		return nil
+	}
+
+	deps, err := ParseDepsFile(depFile)
+	if err != nil {
+		return err
+	}
+
+	unused, err := FindUnusedIncludes(file, deps)
+	if err != nil {
+		return err
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	for _, u := range unused {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Warning: %s:%d: include of \"%s\" appears unused\n",
+			filepath.ToSlash(filepath.Join(wd, u.SrcFile)), u.Line, u.Header)
+	}
+
+	return nil
+}
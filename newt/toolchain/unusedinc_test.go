@@ -0,0 +1,203 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package toolchain
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestStripCComments(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"int x; // foo\nint y;", "int x; \nint y;"},
+		{"a /* b\nc */ d", "a \n  d"},
+		{`s = "// not a comment";`, "s =  ;"},
+		{`c = '"'; d;`, "c =  ; d;"},
+		{`s = "esc\"aped"; e;`, "s =  ; e;"},
+	}
+
+	for _, test := range tests {
+		if got := stripCComments([]byte(test.src)); got != test.want {
+			t.Errorf("stripCComments(%q) = %q; want %q", test.src, got,
+				test.want)
+		}
+	}
+}
+
+func TestHeaderDecls(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "macros",
+			text: "#define FOO 1\n#define BAR(x) (x)\n#ifdef FOO\n#endif\n",
+			want: []string{"BAR", "FOO"},
+		},
+		{
+			name: "function and variable",
+			text: "int foo_init(int arg);\nextern int foo_count;\n" +
+				"extern char foo_buf[16];\n",
+			want: []string{"foo_buf", "foo_count", "foo_init"},
+		},
+		{
+			name: "struct with members",
+			text: "struct foo {\n    int a;\n    int b;\n};\n",
+			want: []string{"foo"},
+		},
+		{
+			name: "enum",
+			text: "enum foo_state { FOO_IDLE, FOO_BUSY = 2 };\n",
+			want: []string{"FOO_BUSY", "FOO_IDLE", "foo_state"},
+		},
+		{
+			name: "typedefs",
+			text: "typedef unsigned int foo_t;\n" +
+				"typedef void (*foo_cb)(int arg);\n",
+			want: []string{"foo_cb", "foo_t"},
+		},
+		{
+			name: "extern C block",
+			text: "extern \"C\" {\nint foo(void);\n}\n",
+			want: []string{"foo"},
+		},
+	}
+
+	for _, test := range tests {
+		decls := headerDecls(stripCComments([]byte(test.text)))
+		got := []string{}
+		for name, _ := range decls {
+			got = append(got, name)
+		}
+		sort.Strings(got)
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: headerDecls() = %v; want %v", test.name, got,
+				test.want)
+		}
+	}
+}
+
+func TestFindUnusedIncludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-unusedinc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	headers := map[string]string{
+		"foo.h":   "int foo(void);\n",
+		"bar.h":   "#define BAR_MAX 10\n",
+		"baz.h":   "struct baz { int x; };\n",
+		"outer.h": "#include \"inner.h\"\n",
+		"inner.h": "int inner(void);\n",
+		"empty.h": "#pragma once\n",
+	}
+	deps := []string{}
+	for name, text := range headers {
+		path := filepath.Join(dir, "include", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		deps = append(deps, path)
+	}
+
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "all used",
+			src: "#include \"foo.h\"\n#include <bar.h>\n" +
+				"int x[BAR_MAX];\nint f(void) { return foo(); }\n",
+			want: []string{},
+		},
+		{
+			name: "unused function header",
+			src:  "#include \"foo.h\"\nint x;\n",
+			want: []string{"foo.h"},
+		},
+		{
+			name: "use in comment only",
+			src:  "#include \"foo.h\"\n/* foo() */\nint x;\n",
+			want: []string{"foo.h"},
+		},
+		{
+			name: "struct tag used",
+			src:  "#include \"baz.h\"\nstruct baz b;\n",
+			want: []string{},
+		},
+		{
+			name: "used through nested include",
+			src:  "#include \"outer.h\"\nint f(void) { return inner(); }\n",
+			want: []string{},
+		},
+		{
+			name: "header without declarations",
+			src:  "#include \"empty.h\"\n",
+			want: []string{},
+		},
+		{
+			name: "header not in deps",
+			src:  "#include \"missing.h\"\n",
+			want: []string{},
+		},
+		{
+			name: "commented out include",
+			src:  "// #include \"foo.h\"\nint x;\n",
+			want: []string{},
+		},
+	}
+
+	srcPath := filepath.Join(dir, "src.c")
+	for _, test := range tests {
+		err := ioutil.WriteFile(srcPath, []byte(test.src), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		unused, err := FindUnusedIncludes(srcPath, deps)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+
+		got := []string{}
+		for _, u := range unused {
+			got = append(got, u.Header)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: FindUnusedIncludes() = %v; want %v", test.name,
+				got, test.want)
+		}
+	}
+}
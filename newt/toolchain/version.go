@@ -0,0 +1,146 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package toolchain
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// A dotted numeric version (e.g., 7.3.1).  Missing trailing components
+// compare as zero.
+type CompilerVersion []int
+
+var compilerVersionRe = regexp.MustCompile(`\b\d+\.\d+(\.\d+)*\b`)
+
+func (v CompilerVersion) String() string {
+	parts := make([]string, len(v))
+	for i, n := range v {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Returns a negative number if v < other, 0 if they are equal, or a positive
+// number if v > other.
+func (v CompilerVersion) Compare(other CompilerVersion) int {
+	for i := 0; i < len(v) || i < len(other); i++ {
+		a := 0
+		if i < len(v) {
+			a = v[i]
+		}
+		b := 0
+		if i < len(other) {
+			b = other[i]
+		}
+		if a != b {
+			return a - b
+		}
+	}
+
+	return 0
+}
+
+// Parses a version setting of the form "<major>[.<minor>[.<patch>]]".
+func ParseCompilerVersion(s string) (CompilerVersion, error) {
+	fields := strings.Split(strings.TrimSpace(s), ".")
+	v := make(CompilerVersion, len(fields))
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return nil, util.FmtNewtError("invalid version: \"%s\"", s)
+		}
+		v[i] = n
+	}
+
+	return v, nil
+}
+
+// Extracts the version number from a compiler's "--version" line (e.g.,
+// "arm-none-eabi-gcc (GNU Tools for Arm Embedded Processors 7-2018-q2)
+// 7.3.1 20180622").  The first dotted number in the line is taken to be the
+// version; if the line contains a version with at least three components,
+// the first such one is preferred, since a package version string in
+// parentheses often precedes the compiler version.  Returns nil if the line
+// does not contain a version.
+func ExtractCompilerVersion(line string) CompilerVersion {
+	matches := compilerVersionRe.FindAllString(line, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	s := matches[0]
+	for _, m := range matches {
+		if strings.Count(m, ".") >= 2 {
+			s = m
+			break
+		}
+	}
+
+	v, err := ParseCompilerVersion(s)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+// Verifies that the C compiler's version lies within [min, max].  Either
+// bound may be nil to leave that end of the range open.
+func (c *Compiler) CheckVersion(min, max CompilerVersion) error {
+	if min == nil && max == nil {
+		return nil
+	}
+
+	line := c.Version()
+	if line == "" {
+		return util.FmtNewtError(
+			"cannot determine version of compiler \"%s\"; "+
+				"failed to execute \"%s --version\"", c.ccPath, c.ccPath)
+	}
+
+	v := ExtractCompilerVersion(line)
+	if v == nil {
+		return util.FmtNewtError(
+			"cannot determine version of compiler \"%s\" from \"%s\"",
+			c.ccPath, line)
+	}
+
+	if (min != nil && v.Compare(min) < 0) ||
+		(max != nil && v.Compare(max) > 0) {
+
+		var req string
+		switch {
+		case max == nil:
+			req = ">= " + min.String()
+		case min == nil:
+			req = "<= " + max.String()
+		default:
+			req = ">= " + min.String() + " and <= " + max.String()
+		}
+		return util.FmtNewtError(
+			"compiler \"%s\" has version %s; version %s required "+
+				"(compiler reports \"%s\")", c.ccPath, v.String(), req, line)
+	}
+
+	return nil
+}
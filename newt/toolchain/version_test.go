@@ -0,0 +1,132 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package toolchain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompilerVersionCompare(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"7.3.1", "7.3.1", 0},
+		{"7.3", "7.3.0", 0},
+		{"7.3.1", "7.3", 1},
+		{"6.9", "7", -1},
+		{"10.1", "9.4.2", 1},
+	}
+
+	for _, test := range tests {
+		a, err := ParseCompilerVersion(test.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ParseCompilerVersion(test.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := a.Compare(b)
+		if (got < 0) != (test.want < 0) || (got > 0) != (test.want > 0) {
+			t.Errorf("Compare(%s, %s) = %d; want sign of %d", test.a, test.b,
+				got, test.want)
+		}
+	}
+
+	for _, s := range []string{"", "7.", "a.b", "7.-1", "v7"} {
+		if _, err := ParseCompilerVersion(s); err == nil {
+			t.Errorf("ParseCompilerVersion(%q): expected error", s)
+		}
+	}
+}
+
+func TestExtractCompilerVersion(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"gcc (GCC) 7.3.1 20180622", "7.3.1"},
+		{"arm-none-eabi-gcc (GNU Tools for Arm Embedded Processors " +
+			"7-2018-q2-update) 7.3.1 20180622 (release)", "7.3.1"},
+		{"gcc (Ubuntu 5.4.0-6ubuntu1~16.04.4) 5.4.0 20160609", "5.4.0"},
+		{"clang version 6.0 (tags/RELEASE_600/final)", "6.0"},
+		{"no version here", ""},
+	}
+
+	for _, test := range tests {
+		got := ""
+		if v := ExtractCompilerVersion(test.line); v != nil {
+			got = v.String()
+		}
+		if got != test.want {
+			t.Errorf("ExtractCompilerVersion(%q) = %q; want %q", test.line,
+				got, test.want)
+		}
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	ver := func(s string) CompilerVersion {
+		if s == "" {
+			return nil
+		}
+		v, err := ParseCompilerVersion(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name    string
+		ccPath  string
+		min     string
+		max     string
+		wantErr string
+	}{
+		{"no requirement", "false", "", "", ""},
+		{"within range", "echo gcc 7.3.1", "7", "8", ""},
+		{"at minimum", "echo gcc 7.3.1", "7.3.1", "", ""},
+		{"too old", "echo gcc 7.3.1", "8", "", "version >= 8 required"},
+		{"too new", "echo gcc 7.3.1", "", "7.2", "version <= 7.2 required"},
+		{"not executable", "false", "7", "", "failed to execute"},
+		{"no version", "echo gcc", "7", "", "cannot determine version"},
+	}
+
+	for _, test := range tests {
+		c := &Compiler{ccPath: test.ccPath}
+		err := c.CheckVersion(ver(test.min), ver(test.max))
+
+		if test.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			}
+		} else if err == nil {
+			t.Errorf("%s: expected error", test.name)
+		} else if !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: error \"%s\" does not contain \"%s\"", test.name,
+				err.Error(), test.wantErr)
+		}
+	}
+}
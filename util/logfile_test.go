@@ -0,0 +1,133 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Redirects stdout and stderr to a single temporary file for the duration
+// of the test, returning the file.
+func captureConsole(t *testing.T, dir string) (*os.File, func()) {
+	f, err := os.Create(filepath.Join(dir, "console.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	stderr := os.Stderr
+	os.Stdout = f
+	os.Stderr = f
+
+	return f, func() {
+		os.Stdout = stdout
+		os.Stderr = stderr
+		f.Close()
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newt-logfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldVerbosity := Verbosity
+	defer func() { Verbosity = oldVerbosity }()
+	Verbosity = VERBOSITY_DEFAULT
+
+	console, restore := captureConsole(t, dir)
+	defer restore()
+
+	logPath := filepath.Join(dir, "build.log")
+	if err := OpenLogFile(logPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := OpenLogFile(logPath); err == nil {
+		t.Errorf("opening a second log file succeeded")
+	}
+
+	StatusMessage(VERBOSITY_DEFAULT, "Building target %s\n", "blinky")
+	StatusMessage(VERBOSITY_VERBOSE, "Compiling src/main.c\n")
+	ErrorMessage(VERBOSITY_QUIET, "Error: %s\n", "undefined reference")
+	StatusMessage(VERBOSITY_QUIET, "Target build failed\n")
+
+	// The destination is only created once the log is closed.
+	if NodeExist(logPath) {
+		t.Errorf("log file exists before being closed")
+	}
+
+	if err := CloseLogFile(); err != nil {
+		t.Fatal(err)
+	}
+	if err := CloseLogFile(); err != nil {
+		t.Errorf("closing an already closed log file failed: %s",
+			err.Error())
+	}
+
+	// Output after closing only goes to the console.
+	StatusMessage(VERBOSITY_DEFAULT, "Done\n")
+
+	restore()
+
+	consoleText, err := ioutil.ReadFile(console.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logText, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expLog := "Building target blinky\n" +
+		"Error: undefined reference\n" +
+		"Target build failed\n"
+	if string(logText) != expLog {
+		t.Errorf("log file: want=%q have=%q", expLog, string(logText))
+	}
+	if string(consoleText) != expLog+"Done\n" {
+		t.Errorf("console: want=%q have=%q", expLog+"Done\n",
+			string(consoleText))
+	}
+
+	// No temporary files are left behind.
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "console.txt" && entry.Name() != "build.log" {
+			t.Errorf("unexpected file in log directory: %s", entry.Name())
+		}
+	}
+}
+
+func TestOpenLogFileBadDir(t *testing.T) {
+	err := OpenLogFile(filepath.Join(os.TempDir(), "newt-no-such-dir",
+		"build.log"))
+	if err == nil {
+		CloseLogFile()
+		t.Fatalf("opening a log file in a missing directory succeeded")
+	}
+}
@@ -45,6 +45,11 @@ import (
 var Verbosity int
 var logFile *os.File
 
+// The file specified with --log-file.  Output is written to a temporary file
+// in the same directory, which replaces the destination when it is closed.
+var buildLogFile *os.File
+var buildLogPath string
+
 func ParseEqualsPair(v string) (string, string, error) {
 	s := strings.Split(v, "=")
 	return s[0], s[1], nil
@@ -116,6 +121,9 @@ func WriteMessage(f *os.File, level int, message string,
 		if logFile != nil {
 			logFile.WriteString(str)
 		}
+		if buildLogFile != nil {
+			buildLogFile.WriteString(str)
+		}
 	}
 }
 
@@ -209,28 +217,92 @@ func (f *logFormatter) Format(entry *log.Entry) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
+// Returns the writer that log output gets sent to: stderr, plus any files
+// that output is being teed to.
+func logWriter() io.Writer {
+	writers := []io.Writer{os.Stderr}
+	if logFile != nil {
+		writers = append(writers, logFile)
+	}
+	if buildLogFile != nil {
+		writers = append(writers, buildLogFile)
+	}
+
+	return io.MultiWriter(writers...)
+}
+
 func initLog(level log.Level, logFilename string) error {
 	log.SetLevel(level)
 
-	var writer io.Writer
-	if logFilename == "" {
-		writer = os.Stderr
-	} else {
+	if logFilename != "" {
 		var err error
 		logFile, err = os.Create(logFilename)
 		if err != nil {
 			return NewNewtError(err.Error())
 		}
-
-		writer = io.MultiWriter(os.Stderr, logFile)
 	}
 
-	log.SetOutput(writer)
+	log.SetOutput(logWriter())
 	log.SetFormatter(&logFormatter{})
 
 	return nil
 }
 
+// Starts teeing status messages and log output to the specified file.
+// Console output is unaffected; the log level and verbosity apply to the file
+// as well.  The file is only created when CloseLogFile is called, so it never
+// contains partial output from a run that is still in progress.
+func OpenLogFile(path string) error {
+	if buildLogFile != nil {
+		return FmtNewtError("Log file already open: %s", buildLogPath)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path),
+		"."+filepath.Base(path)+".")
+	if err != nil {
+		return FmtNewtError("Failed to create log file: %s", err.Error())
+	}
+
+	buildLogFile = f
+	buildLogPath = path
+	log.SetOutput(logWriter())
+
+	return nil
+}
+
+// Stops teeing output to the file opened with OpenLogFile and moves the file
+// into place.  This is called on both success and failure, so the log of a
+// failed run is kept.  It does nothing if no log file is open.
+func CloseLogFile() error {
+	if buildLogFile == nil {
+		return nil
+	}
+
+	f := buildLogFile
+	buildLogFile = nil
+	log.SetOutput(logWriter())
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return ChildNewtError(err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return ChildNewtError(err)
+	}
+
+	// TempFile creates the file with restrictive permissions.
+	os.Chmod(f.Name(), 0644)
+
+	if err := os.Rename(f.Name(), buildLogPath); err != nil {
+		os.Remove(f.Name())
+		return ChildNewtError(err)
+	}
+
+	return nil
+}
+
 // Initialize the util module
 func Init(logLevel log.Level, logFile string, verbosity int) error {
 	// Configure logging twice.  First just configure the filter for stderr;
@@ -308,8 +380,19 @@ func DescendantDirsOfParent(rootPath string, parentName string, fullPath bool) (
 
 // Execute the command specified by cmdStr on the shell and return results
 func ShellCommand(cmdStr string) ([]byte, error) {
+	return ShellCommandEnv(cmdStr, nil)
+}
+
+// Execute the command specified by cmdStr on the shell with additional
+// environment variables and return results.  Each element of env has the
+// form NAME=VALUE and takes precedence over newt's own environment.
+func ShellCommandEnv(cmdStr string, env []string) ([]byte, error) {
 	log.Debug(cmdStr)
 	cmd := exec.Command("sh", "-c", cmdStr)
+	if len(env) > 0 {
+		log.Debugf("env=%v", env)
+		cmd.Env = append(os.Environ(), env...)
+	}
 
 	o, err := cmd.CombinedOutput()
 	log.Debugf("o=%s", string(o))